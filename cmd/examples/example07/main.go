@@ -3,9 +3,17 @@
 // the database. Then these chunks are sent to the Llama model to create a
 // coherent response.
 //
+// With the -verify flag, the answer is checked for hallucinations. Each
+// sentence of the answer is given to a judge model together with the chunks
+// the answer was based on, and the judge decides if the chunks support the
+// sentence. This is the same idea as a cross-encoder, the claim and the
+// evidence are judged together instead of being compared as embeddings.
+// Sentences the chunks don't support are flagged in the output.
+//
 // # Running the example:
 //
 //	$ make example7
+//	$ make example07-verify
 //
 // # This requires running the following commands:
 //
@@ -18,6 +26,7 @@ package main
 import (
 	"bufio"
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -32,8 +41,9 @@ import (
 )
 
 const (
-	url   = "http://localhost:11434"
-	model = "bge-m3:latest"
+	url        = "http://localhost:11434"
+	model      = "bge-m3:latest"
+	judgeModel = "qwen2.5vl:latest"
 )
 
 type searchResult struct {
@@ -52,6 +62,9 @@ func main() {
 }
 
 func run() error {
+	verify := flag.Bool("verify", false, "check the answer is supported by the retrieved chunks")
+	flag.Parse()
+
 	reader := bufio.NewReader(os.Stdin)
 	fmt.Print("\nAsk Bill a question about Go: ")
 
@@ -70,10 +83,19 @@ func run() error {
 		return fmt.Errorf("vectorSearch: %w", err)
 	}
 
-	if err := questionResponse(ctx, question, results); err != nil {
+	answer, chunks, err := questionResponse(ctx, question, results)
+	if err != nil {
 		return fmt.Errorf("questionResponse: %w", err)
 	}
 
+	if !*verify || answer == "" {
+		return nil
+	}
+
+	if err := groundingCheck(ctx, answer, chunks); err != nil {
+		return fmt.Errorf("groundingCheck: %w", err)
+	}
+
 	return nil
 }
 
@@ -155,7 +177,7 @@ func vectorSearch(ctx context.Context, question string) ([]searchResult, error)
 	return results, nil
 }
 
-func questionResponse(ctx context.Context, question string, results []searchResult) error {
+func questionResponse(ctx context.Context, question string, results []searchResult) (string, string, error) {
 
 	// Open a connection with ollama to access the model.
 	llm, err := ollama.New(
@@ -163,7 +185,7 @@ func questionResponse(ctx context.Context, question string, results []searchResu
 		ollama.WithServerURL("http://localhost:11434"),
 	)
 	if err != nil {
-		return fmt.Errorf("ollama: %w", err)
+		return "", "", fmt.Errorf("ollama: %w", err)
 	}
 
 	// Format a prompt to direct the model what to do with the content and
@@ -198,7 +220,7 @@ Question: %s
 	content := chunks.String()
 	if content == "" {
 		fmt.Println("Don't have enough information to provide an answer")
-		return nil
+		return "", "", nil
 	}
 
 	finalPrompt := fmt.Sprintf(prompt, content, question)
@@ -214,14 +236,115 @@ Question: %s
 	}
 
 	// Send the prompt to the model server.
-	_, err = llm.Call(
+	answer, err := llm.Call(
 		ctx,
 		finalPrompt,
 		llms.WithStreamingFunc(f),
 		llms.WithMaxTokens(1000))
 	if err != nil {
-		return fmt.Errorf("call: %w", err)
+		return "", "", fmt.Errorf("call: %w", err)
+	}
+
+	return answer, content, nil
+}
+
+// =============================================================================
+
+func groundingCheck(ctx context.Context, answer string, chunks string) error {
+	fmt.Print("\n\nChecking the answer against the retrieved chunks...\n\n")
+
+	// Open a connection with ollama to access the judge model.
+	llm, err := ollama.New(
+		ollama.WithModel(judgeModel),
+		ollama.WithServerURL(url),
+	)
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	// This is a natural language inference (NLI) prompt. The chunks are the
+	// premise and the sentence is the hypothesis. The judge only has to pick
+	// a label, which small models do far more reliably than explaining why.
+	prompt := `You are checking an answer for claims that are not supported by
+the source text. Decide if the source text supports the claim.
+
+Reply with a single word:
+SUPPORTED if the source text states or directly implies the claim.
+CONTRADICTED if the source text says the opposite of the claim.
+UNSUPPORTED if the source text doesn't mention the claim.
+
+Source text: %s
+
+Claim: %s
+`
+
+	var supported, checked int
+
+	for _, sentence := range splitSentences(answer) {
+
+		// Headings and list markers have no claim to check.
+		if len(strings.Fields(sentence)) < 4 {
+			fmt.Println(sentence)
+			continue
+		}
+
+		verdict, err := llm.Call(
+			ctx,
+			fmt.Sprintf(prompt, chunks, sentence),
+			llms.WithTemperature(0),
+			llms.WithMaxTokens(10))
+		if err != nil {
+			return fmt.Errorf("call: %w", err)
+		}
+
+		checked++
+		verdict = strings.ToUpper(strings.TrimSpace(verdict))
+
+		switch {
+		case strings.HasPrefix(verdict, "SUPPORTED"):
+			supported++
+			fmt.Printf("\u001b[92m[SUPPORTED]\u001b[0m %s\n", sentence)
+
+		case strings.HasPrefix(verdict, "CONTRADICTED"):
+			fmt.Printf("\u001b[91m[CONTRADICTED]\u001b[0m %s\n", sentence)
+
+		default:
+			fmt.Printf("\u001b[93m[UNSUPPORTED]\u001b[0m %s\n", sentence)
+		}
 	}
 
+	fmt.Printf("\n%d of %d claims are supported by the retrieved chunks\n", supported, checked)
+
 	return nil
 }
+
+// splitSentences splits the answer into sentences. Lines are split first so
+// list items and code stay separate, then each line is split after the
+// punctuation that ends a sentence.
+func splitSentences(text string) []string {
+	var sentences []string
+
+	for line := range strings.SplitSeq(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		start := 0
+		for i := 0; i < len(line)-1; i++ {
+			switch line[i] {
+			case '.', '!', '?':
+				if line[i+1] == ' ' {
+					sentences = append(sentences, strings.TrimSpace(line[start:i+1]))
+					start = i + 1
+				}
+			}
+		}
+
+		if rest := strings.TrimSpace(line[start:]); rest != "" {
+			sentences = append(sentences, rest)
+		}
+	}
+
+	return sentences
+}
@@ -5,6 +5,10 @@
 //
 //	$ make example9-step1
 //
+// # Describing an image from a URL, downloads are cached:
+//
+//	$ go run cmd/examples/example09/step1/main.go -image https://example.com/screenshot.png
+//
 // # This requires running the following commands:
 //
 //	$ make ollama-up  // This starts the Ollama service.
@@ -12,11 +16,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"os"
 
+	"github.com/ardanlabs/ai-training/foundation/client"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/ollama"
 )
@@ -36,6 +40,9 @@ func main() {
 func run() error {
 	ctx := context.Background()
 
+	image := flag.String("image", imagePath, "path or http(s) URL of the image to describe")
+	flag.Parse()
+
 	// -------------------------------------------------------------------------
 
 	llm, err := ollama.New(
@@ -48,7 +55,7 @@ func run() error {
 
 	// -------------------------------------------------------------------------
 
-	data, mimeType, err := readImage(imagePath)
+	data, mimeType, err := client.ReadImage(ctx, *image)
 	if err != nil {
 		return fmt.Errorf("read image: %w", err)
 	}
@@ -104,17 +111,3 @@ func run() error {
 	fmt.Print("DONE\n")
 	return nil
 }
-
-func readImage(fileName string) ([]byte, string, error) {
-	data, err := os.ReadFile(fileName)
-	if err != nil {
-		return nil, "", fmt.Errorf("read file: %w", err)
-	}
-
-	switch mimeType := http.DetectContentType(data); mimeType {
-	case "image/jpeg", "image/png":
-		return data, mimeType, nil
-	default:
-		return nil, "", fmt.Errorf("unsupported file type: %s: filename: %s", mimeType, fileName)
-	}
-}
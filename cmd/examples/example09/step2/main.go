@@ -12,11 +12,11 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"os"
 
+	"github.com/ardanlabs/ai-training/foundation/client"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/ollama"
 )
@@ -37,6 +37,9 @@ func main() {
 func run() error {
 	ctx := context.Background()
 
+	image := flag.String("image", imagePath, "path or http(s) URL of the image to describe")
+	flag.Parse()
+
 	// -------------------------------------------------------------------------
 
 	llm, err := ollama.New(
@@ -57,7 +60,7 @@ func run() error {
 
 	// -------------------------------------------------------------------------
 
-	data, mimeType, err := readImage(imagePath)
+	data, mimeType, err := client.ReadImage(ctx, *image)
 	if err != nil {
 		return fmt.Errorf("read image: %w", err)
 	}
@@ -124,17 +127,3 @@ func run() error {
 	fmt.Println("DONE")
 	return nil
 }
-
-func readImage(fileName string) ([]byte, string, error) {
-	data, err := os.ReadFile(fileName)
-	if err != nil {
-		return nil, "", fmt.Errorf("read file: %w", err)
-	}
-
-	switch mimeType := http.DetectContentType(data); mimeType {
-	case "image/jpeg", "image/png":
-		return data, mimeType, nil
-	default:
-		return nil, "", fmt.Errorf("unsupported file type:%s: filename: %s", mimeType, fileName)
-	}
-}
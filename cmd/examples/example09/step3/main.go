@@ -13,12 +13,12 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
-	"net/http"
-	"os"
 	"time"
 
+	"github.com/ardanlabs/ai-training/foundation/client"
 	"github.com/ardanlabs/ai-training/foundation/mongodb"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/ollama"
@@ -53,6 +53,9 @@ func main() {
 func run() error {
 	ctx := context.Background()
 
+	image := flag.String("image", imagePath, "path or http(s) URL of the image to describe")
+	flag.Parse()
+
 	// -------------------------------------------------------------------------
 
 	llm, err := ollama.New(
@@ -82,10 +85,10 @@ func run() error {
 
 	// -------------------------------------------------------------------------
 
-	findRes := col.FindOne(ctx, bson.D{{Key: "file_name", Value: imagePath}})
+	findRes := col.FindOne(ctx, bson.D{{Key: "file_name", Value: *image}})
 	if findRes.Err() == nil {
 		fmt.Println("Delete existing image from database")
-		_, err := col.DeleteOne(ctx, bson.D{{Key: "file_name", Value: imagePath}})
+		_, err := col.DeleteOne(ctx, bson.D{{Key: "file_name", Value: *image}})
 		if err != nil {
 			return fmt.Errorf("delete image: %w", err)
 		}
@@ -93,7 +96,7 @@ func run() error {
 
 	// -------------------------------------------------------------------------
 
-	data, mimeType, err := readImage(imagePath)
+	data, mimeType, err := client.ReadImage(ctx, *image)
 	if err != nil {
 		return fmt.Errorf("read image: %w", err)
 	}
@@ -162,7 +165,7 @@ func run() error {
 	fmt.Print("Inserting image description into the database:\n\n")
 
 	d1 := document{
-		FileName:    imagePath,
+		FileName:    *image,
 		Description: cr.Choices[0].Content,
 		Embedding:   vectors[0],
 	}
@@ -237,17 +240,3 @@ func initDatabase(dbName string, collectionName string) (*mongo.Client, error) {
 
 	return client, nil
 }
-
-func readImage(fileName string) ([]byte, string, error) {
-	data, err := os.ReadFile(fileName)
-	if err != nil {
-		return nil, "", fmt.Errorf("read file: %w", err)
-	}
-
-	switch mimeType := http.DetectContentType(data); mimeType {
-	case "image/jpeg", "image/png":
-		return data, mimeType, nil
-	default:
-		return nil, "", fmt.Errorf("unsupported file type: %s: filename: %s", mimeType, fileName)
-	}
-}
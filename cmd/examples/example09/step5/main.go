@@ -1,5 +1,8 @@
 // This example takes step4 and shows you how to process a set of images
-// from a location on disk and provide search capabilities.
+// from a location on disk and provide search capabilities. The EXIF metadata
+// of each image, like when and where it was taken, is stored alongside the
+// embedding so questions like "photos from 2023 with a dog" only search the
+// images taken that year.
 //
 // # Running the example:
 //
@@ -16,11 +19,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"time"
 
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/exif"
 	"github.com/ardanlabs/ai-training/foundation/mongodb"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/ollama"
@@ -34,21 +40,33 @@ const (
 	model          = "qwen2.5vl:latest"
 	embedModel     = "bge-m3:latest"
 	dbName         = "example9"
-	collectionName = "images-5"
+	collectionName = "images-5-exif"
 	gallaryPath    = "cmd/samples/gallery/"
 )
 
 type document struct {
-	FileName    string    `bson:"file_name"`
-	Description string    `bson:"description"`
-	Embedding   []float32 `bson:"embedding"`
+	FileName    string     `bson:"file_name"`
+	Description string     `bson:"description"`
+	Embedding   []float32  `bson:"embedding"`
+	Taken       *time.Time `bson:"taken,omitempty"`
+	Year        int        `bson:"year,omitempty"`
+	Camera      string     `bson:"camera,omitempty"`
+	Location    *location  `bson:"location,omitempty"`
+}
+
+type location struct {
+	Latitude  float64 `bson:"latitude" json:"latitude"`
+	Longitude float64 `bson:"longitude" json:"longitude"`
 }
 
 type searchResult struct {
-	FileName    string    `bson:"file_name" json:"file_name"`
-	Description string    `bson:"description" json:"image_description"`
-	Embedding   []float32 `bson:"embedding" json:"-"`
-	Score       float64   `bson:"score" json:"-"`
+	FileName    string     `bson:"file_name" json:"file_name"`
+	Description string     `bson:"description" json:"image_description"`
+	Embedding   []float32  `bson:"embedding" json:"-"`
+	Taken       *time.Time `bson:"taken" json:"-"`
+	Camera      string     `bson:"camera" json:"-"`
+	Location    *location  `bson:"location" json:"-"`
+	Score       float64    `bson:"score" json:"-"`
 }
 
 // =============================================================================
@@ -123,11 +141,20 @@ func run() error {
 			continue
 		}
 
-		data, mimeType, err := readImage(fileName)
+		data, mimeType, err := client.ReadImage(ctx, fileName)
 		if err != nil {
 			return fmt.Errorf("read image: %w", err)
 		}
 
+		// -------------------------------------------------------------------------
+
+		fmt.Println("  - Extracting the EXIF metadata")
+
+		md, err := exif.Read(data)
+		if err != nil {
+			fmt.Printf("  - No EXIF metadata: %s\n", err)
+		}
+
 		fmt.Println("  - Generating image description")
 
 		messages := []llms.MessageContent{
@@ -172,6 +199,19 @@ func run() error {
 			FileName:    fileName,
 			Description: cr.Choices[0].Content,
 			Embedding:   vectors[0],
+			Camera:      md.Camera(),
+		}
+
+		if !md.Taken.IsZero() {
+			d1.Taken = &md.Taken
+			d1.Year = md.Taken.Year()
+		}
+
+		if md.GPS != nil {
+			d1.Location = &location{
+				Latitude:  md.GPS.Latitude,
+				Longitude: md.GPS.Longitude,
+			}
 		}
 
 		res, err := col.InsertOne(ctx, d1)
@@ -253,6 +293,7 @@ func initDatabase(dbName string, collectionName string) (*mongo.Client, error) {
 		NumDimensions: 1024,
 		Path:          "embedding",
 		Similarity:    "cosine",
+		FilterPaths:   []string{"year", "camera"},
 	}
 
 	if err := mongodb.CreateVectorIndex(ctx, col, indexName, settings); err != nil {
@@ -297,20 +338,6 @@ func getFilesFromDirectory(directoryPath string) ([]string, error) {
 	return files, nil
 }
 
-func readImage(fileName string) ([]byte, string, error) {
-	data, err := os.ReadFile(fileName)
-	if err != nil {
-		return nil, "", fmt.Errorf("read file: %w", err)
-	}
-
-	switch mimeType := http.DetectContentType(data); mimeType {
-	case "image/jpeg", "image/png":
-		return data, mimeType, nil
-	default:
-		return nil, "", fmt.Errorf("unsupported file type: %s: filename: %s", mimeType, fileName)
-	}
-}
-
 func vectorSearch(ctx context.Context, llm *ollama.LLM, col *mongo.Collection, question string) ([]searchResult, error) {
 
 	// -------------------------------------------------------------------------
@@ -323,24 +350,36 @@ func vectorSearch(ctx context.Context, llm *ollama.LLM, col *mongo.Collection, q
 
 	// -------------------------------------------------------------------------
 	// We want to find the nearest neighbors from the question vector embedding.
+	// If the question mentions a year, only the images taken that year are
+	// searched.
+
+	search := bson.M{
+		"index":       "vector_index",
+		"exact":       true,
+		"path":        "embedding",
+		"queryVector": embedding[0],
+		"limit":       5,
+	}
+
+	if year, ok := questionYear(question); ok {
+		fmt.Printf("Filtering images taken in %d\n\n", year)
+		search["filter"] = bson.M{"year": bson.M{"$eq": year}}
+	}
 
 	pipeline := mongo.Pipeline{
 		{{
-			Key: "$vectorSearch",
-			Value: bson.M{
-				"index":       "vector_index",
-				"exact":       true,
-				"path":        "embedding",
-				"queryVector": embedding[0],
-				"limit":       5,
-			}},
-		},
+			Key:   "$vectorSearch",
+			Value: search,
+		}},
 		{{
 			Key: "$project",
 			Value: bson.M{
 				"file_name":   1,
 				"description": 1,
 				"embedding":   1,
+				"taken":       1,
+				"camera":      1,
+				"location":    1,
 				"score": bson.M{
 					"$meta": "vectorSearchScore",
 				},
@@ -365,10 +404,31 @@ func vectorSearch(ctx context.Context, llm *ollama.LLM, col *mongo.Collection, q
 	return results, nil
 }
 
+// yearPattern matches a year in a question, like "photos from 2023".
+var yearPattern = regexp.MustCompile(`\b(19|20)\d{2}\b`)
+
+// questionYear returns the year mentioned in the question.
+func questionYear(question string) (int, bool) {
+	m := yearPattern.FindString(question)
+	if m == "" {
+		return 0, false
+	}
+
+	year, err := strconv.Atoi(m)
+	if err != nil {
+		return 0, false
+	}
+
+	return year, true
+}
+
 func questionResponse(ctx context.Context, llm *ollama.LLM, question string, results []searchResult) error {
 	type searchResult struct {
-		FileName    string `json:"file_name"`
-		Description string `json:"image_description"`
+		FileName    string    `json:"file_name"`
+		Description string    `json:"image_description"`
+		Taken       string    `json:"taken,omitempty"`
+		Camera      string    `json:"camera,omitempty"`
+		Location    *location `json:"location,omitempty"`
 	}
 
 	var finalResults []searchResult
@@ -377,10 +437,16 @@ func questionResponse(ctx context.Context, llm *ollama.LLM, question string, res
 	for _, result := range results {
 		if result.Score >= 0.75 {
 			fmt.Printf("FileName[%s] Score[%.2f]\n", result.FileName, result.Score)
-			finalResults = append(finalResults, searchResult{
+			sr := searchResult{
 				FileName:    result.FileName,
 				Description: result.Description,
-			})
+				Camera:      result.Camera,
+				Location:    result.Location,
+			}
+			if result.Taken != nil {
+				sr.Taken = result.Taken.Format("2006-01-02 15:04")
+			}
+			finalResults = append(finalResults, sr)
 		}
 	}
 
@@ -401,7 +467,10 @@ func questionResponse(ctx context.Context, llm *ollama.LLM, question string, res
 	[
 		{
 			"file_name":string,
-			"image_description":string
+			"image_description":string,
+			"taken":string,
+			"camera":string,
+			"location":{"latitude":number,"longitude":number}
 		},
 		{
 			"file_name":string,
@@ -409,6 +478,10 @@ func questionResponse(ctx context.Context, llm *ollama.LLM, question string, res
 		}
 	]
 
+	- The taken, camera and location fields come from the photo's metadata
+	and are missing when the photo doesn't have it. Use them to answer
+	questions about when, where or with what camera a photo was taken.
+
 	- The response should be in a JSON array with the following fields:
 	
 	[
@@ -164,7 +164,7 @@ func (a *Agent) Run(ctx context.Context) error {
 
 			conversation = append(conversation, client.D{
 				"role":    "assistant",
-				"content": strings.Join(chunks, " "),
+				"content": strings.Join(chunks, ""),
 			})
 		}
 	}
@@ -218,14 +218,14 @@ func (a *Agent) Run(ctx context.Context) error {
 
 			// REMOVING <think> TAGS FROM THE CONTENT WILL LEAVE EXTRA CRLF
 			// CHARACTERS WE NEED TO REMOVE.
-			content := strings.Join(chunks, " ")
+			content := strings.Join(chunks, "")
 			content = strings.TrimLeft(content, "\n")
 
 			// WE NEED TO CHECK IF THE CONTENT IS EMPTY AFTER REMOVING CRLF.
 			if content != "" {
 				conversation = append(conversation, client.D{
 					"role":    "assistant",
-					"content": strings.Join(chunks, " "),
+					"content": strings.Join(chunks, ""),
 				})
 			}
 		}
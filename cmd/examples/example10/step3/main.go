@@ -113,7 +113,7 @@ func weatherQuestion(ctx context.Context) error {
 				},
 			},
 		},
-		"tool_selection": "auto",
+		"tool_choice": "auto",
 	}
 
 	ch := make(chan client.ChatSSE, 100)
@@ -185,8 +185,8 @@ func (a *Agent) Run(ctx context.Context) error {
 			"stream":      true,
 
 			// ADDING TOOL CALLING TO THE REQUEST.
-			"tools":          a.toolDocuments,
-			"tool_selection": "auto",
+			"tools":       a.toolDocuments,
+			"tool_choice": "auto",
 		}
 
 		fmt.Printf("\u001b[93m\n%s\u001b[0m: ", model)
@@ -282,13 +282,13 @@ func (a *Agent) Run(ctx context.Context) error {
 		if !inToolCall && len(chunks) > 0 {
 			fmt.Print("\n")
 
-			content := strings.Join(chunks, " ")
+			content := strings.Join(chunks, "")
 			content = strings.TrimLeft(content, "\n")
 
 			if content != "" {
 				conversation = append(conversation, client.D{
 					"role":    "assistant",
-					"content": strings.Join(chunks, " "),
+					"content": strings.Join(chunks, ""),
 				})
 			}
 		}
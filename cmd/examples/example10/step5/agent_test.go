@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/mockserver"
+)
+
+func TestTurnWithToolCall(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const goMod = "module example.com/hello\n\ngo 1.25\n"
+	if err := os.WriteFile("go.mod", []byte(goMod), 0644); err != nil {
+		t.Fatalf("write go.mod: %s", err)
+	}
+
+	srv := mockserver.New(
+		mockserver.Response{ToolCalls: []mockserver.ToolCall{{ID: "call-1", Name: "tool_read_file", Arguments: client.D{"path": "go.mod"}}}},
+		mockserver.Response{Content: "The module is example.com/hello."},
+	)
+	defer srv.Close()
+
+	saved := url
+	url = srv.Start()
+	defer func() { url = saved }()
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	if err := agent.Turn(context.Background(), "What is the name of the module?"); err != nil {
+		t.Fatalf("turn: %s", err)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 2 {
+		t.Fatalf("got %d model calls, want 2", len(reqs))
+	}
+
+	// The second call carries the result of the tool the model asked for.
+	messages, _ := reqs[1]["messages"].([]any)
+
+	var result string
+	for _, m := range messages {
+		msg, _ := m.(map[string]any)
+		if msg["role"] == "tool" && msg["tool_call_id"] == "call-1" {
+			result, _ = msg["content"].(string)
+		}
+	}
+
+	if !strings.Contains(result, "example.com/hello") {
+		t.Errorf("the second call doesn't carry the go.mod contents, got tool result %q", result)
+	}
+
+	if answer := agent.LastAnswer(); answer != "The module is example.com/hello." {
+		t.Errorf("got answer %q, want the scripted answer", answer)
+	}
+}
+
+func TestCallToolRequestID(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if err := os.WriteFile("go.mod", []byte("module example.com/hello\n"), 0644); err != nil {
+		t.Fatalf("write go.mod: %s", err)
+	}
+
+	var got []string
+	hooks := Hooks{
+		AfterToolCall: func(ctx context.Context, toolCall client.ToolCall, result client.D, latency time.Duration) {
+			got = append(got, client.RequestID(ctx))
+		},
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}), WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	agent.CallTool(client.WithRequestID(context.Background(), "req-1"), "tool_read_file", map[string]any{"path": "go.mod"})
+	agent.CallTool(context.Background(), "tool_read_file", map[string]any{"path": "go.mod"})
+
+	if len(got) != 2 {
+		t.Fatalf("got %d tool calls, want 2", len(got))
+	}
+
+	if got[0] != "req-1" {
+		t.Errorf("got request id %q, want the caller's req-1", got[0])
+	}
+
+	if got[1] == "" {
+		t.Error("a call without a request id wasn't given one")
+	}
+}
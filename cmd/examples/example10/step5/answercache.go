@@ -0,0 +1,272 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/semcache"
+)
+
+// The semantic cache answers a question from a previous answer when the
+// question is similar enough to one asked before, without calling the model.
+// It's turned on with the AGENT_SEMANTIC_CACHE environment variable. The
+// questions are embedded with AGENT_EMBED_MODEL through the embeddings
+// endpoint next to AGENT_URL, which AGENT_EMBED_URL overrides. How similar a
+// question must be and how long an answer is served are set with
+// AGENT_SEMANTIC_CACHE_THRESHOLD and AGENT_SEMANTIC_CACHE_TTL. Answers are
+// only served to the session that asked, AGENT_SEMANTIC_CACHE_SCOPE=global
+// shares them between the sessions of a daemon.
+var (
+	cacheThreshold float32 = 0.95
+	cacheTTL               = time.Hour
+	cacheScope             = "session"
+	embedModel             = "bge-m3:latest"
+	embedURL       string
+)
+
+// The cache is shared by the agents of a daemon so the global scope works,
+// it's nil when the cache is turned off.
+var answerCache *semcache.Cache
+
+// Limits of the semantic cache. Short questions like "why?" depend on the
+// conversation more than on their words, so they are never cached.
+const (
+	cacheMaxEntries = 1000
+	cacheMinWords   = 3
+)
+
+func init() {
+	var enabled bool
+	if v := os.Getenv("AGENT_SEMANTIC_CACHE"); v != "" {
+		var err error
+		enabled, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_SEMANTIC_CACHE_THRESHOLD"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 32)
+		if err != nil {
+			log.Fatal(err)
+		}
+		cacheThreshold = float32(threshold)
+	}
+
+	if v := os.Getenv("AGENT_SEMANTIC_CACHE_TTL"); v != "" {
+		var err error
+		cacheTTL, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_SEMANTIC_CACHE_SCOPE"); v != "" {
+		if v != "session" && v != "global" {
+			log.Fatalf("unknown semantic cache scope %q, use session or global", v)
+		}
+		cacheScope = v
+	}
+
+	if v := os.Getenv("AGENT_EMBED_MODEL"); v != "" {
+		embedModel = v
+	}
+
+	embedURL = os.Getenv("AGENT_EMBED_URL")
+
+	if enabled {
+		answerCache = semcache.New(semcache.Config{
+			Threshold:  cacheThreshold,
+			TTL:        cacheTTL,
+			MaxEntries: cacheMaxEntries,
+		})
+	}
+}
+
+// =============================================================================
+
+// answerFromCache answers the user's input from the semantic cache. It
+// returns the embedding of the input so the answer of the model can be cached
+// at the end of the turn, and reports true if the input was answered.
+func (a *Agent) answerFromCache(ctx context.Context, userInput string) ([]float32, bool) {
+	if answerCache == nil || len(strings.Fields(userInput)) < cacheMinWords {
+		return nil, false
+	}
+
+	embedding, err := a.embedInput(ctx, userInput)
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("semantic cache: %w", err))
+		return nil, false
+	}
+
+	hit, found := answerCache.Lookup(a.cacheScope(), embedding)
+	if !found {
+		return embedding, false
+	}
+
+	now := time.Now().UTC()
+	a.conversation = append(a.conversation,
+		withMeta(client.User(userInput), MessageMeta{
+			Time:   now,
+			Tokens: a.tke.TokenCount(userInput),
+		}),
+		withMeta(client.Assistant(hit.Answer), MessageMeta{
+			Time:   now,
+			Tokens: a.tke.TokenCount(hit.Answer),
+			Cached: true,
+		}),
+	)
+
+	a.mu.Lock()
+	a.turn.Cached = true
+	a.mu.Unlock()
+
+	a.renderer.Info(fmt.Sprintf("cached answer to %q from %s ago (%.0f%% similar), the model was not called", hit.Question, time.Since(hit.Created).Round(time.Second), hit.Similarity*100))
+	a.renderer.Content(hit.Answer)
+	a.renderer.Done()
+
+	a.translateAnswer(ctx)
+
+	return nil, true
+}
+
+// cacheAnswer saves the answer of the turn for the input. Turns that changed
+// files or had other side effects aren't cached, answering them from the
+// cache would skip the changes.
+func (a *Agent) cacheAnswer(userInput string, embedding []float32) {
+	if answerCache == nil || embedding == nil {
+		return
+	}
+
+	answer := a.LastAnswer()
+	if answer == "" {
+		return
+	}
+
+	a.mu.Lock()
+	events := a.turn.ToolCalls
+	truncated := a.turn.Truncated
+	a.mu.Unlock()
+
+	if truncated {
+		return
+	}
+
+	for _, evt := range events {
+		tool, exists := a.tools[evt.Name]
+		if !exists {
+			continue
+		}
+
+		toolCall := client.ToolCall{
+			ID: evt.ID,
+			Function: client.Function{
+				Name:      evt.Name,
+				Arguments: evt.Arguments,
+			},
+		}
+
+		if isMutation(tool, toolCall) {
+			return
+		}
+	}
+
+	answerCache.Store(a.cacheScope(), userInput, answer, embedding)
+}
+
+// cacheScope returns the scope of the cached answers of the agent.
+func (a *Agent) cacheScope() string {
+	if cacheScope == "global" {
+		return ""
+	}
+
+	return a.sessionID
+}
+
+// embedText returns the embedding of the text from the embedding model.
+func embedText(ctx context.Context, text string) ([]float32, error) {
+	embeddings, err := embedTexts(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+
+	return embeddings[0], nil
+}
+
+// embedTexts returns the embeddings of the texts from the embedding model in
+// a single request.
+func embedTexts(ctx context.Context, texts []string) ([][]float32, error) {
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, httpOptions...)
+
+	d := client.D{
+		"model": embedModel,
+		"input": texts,
+	}
+
+	var resp struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+
+	// The url is only final once every init function has run.
+	endpoint := cmp.Or(embedURL, strings.Replace(url, "/chat/completions", "/embeddings", 1))
+
+	if err := cln.Do(ctx, http.MethodPost, endpoint, d, &resp); err != nil {
+		return nil, fmt.Errorf("embed: %w", err)
+	}
+
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("embed: %d embeddings returned by %s for %d texts", len(resp.Data), embedModel, len(texts))
+	}
+
+	embeddings := make([][]float32, len(texts))
+	for _, data := range resp.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("embed: embedding index %d out of range", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return embeddings, nil
+}
+
+// =============================================================================
+
+func (a *Agent) cmdCache(ctx context.Context, args []string) {
+	if answerCache == nil {
+		a.renderer.Info("the semantic cache is turned off, set AGENT_SEMANTIC_CACHE=true to turn it on")
+		return
+	}
+
+	if len(args) > 0 {
+		if args[0] != "clear" {
+			a.renderer.Error(fmt.Errorf("cache: unknown action %q, use clear", args[0]))
+			return
+		}
+
+		answerCache.Clear(a.cacheScope())
+		a.renderer.Info("cleared the cached answers")
+		return
+	}
+
+	entries := answerCache.Entries(a.cacheScope())
+	if len(entries) == 0 {
+		a.renderer.Info("no answers cached yet")
+		return
+	}
+
+	for _, e := range entries {
+		a.renderer.Info(fmt.Sprintf("%-8s hits[%d] %s", time.Since(e.Created).Round(time.Second), e.Hits, e.Question))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// =============================================================================
+// AskUser Tool
+
+// AskUser represents a tool that can be used by the model to stop in the
+// middle of a task and ask the user for clarification. Asking which of two
+// files to change is cheaper than changing the wrong one and rolling back.
+type AskUser struct {
+	name string
+	ask  func(question string, choices []string) (string, bool)
+}
+
+// RegisterAskUser creates a new instance of the AskUser tool and loads it
+// into the provided tools map. The ask function shows the question to the
+// user and returns their answer.
+func RegisterAskUser(tools map[string]Tool, ask func(question string, choices []string) (string, bool)) client.D {
+	au := AskUser{
+		name: "tool_ask_user",
+		ask:  ask,
+	}
+	tools[au.name] = &au
+
+	return au.toolDocument()
+}
+
+// askUserParams represents the parameters for the AskUser tool.
+type askUserParams struct {
+	Question string   `json:"question" description:"The question for the user, with enough context to answer it without reading the conversation."`
+	Choices  []string `json:"choices,omitempty" description:"Optional list of answers for the user to pick from."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (au *AskUser) toolDocument() client.D {
+	description := "Ask the user a question and wait for the answer. Use it when the request is ambiguous or a decision is needed before continuing, like which file to change or which of two approaches to take. Don't use it for things you can find out with the other tools."
+
+	return client.ToolDocument(au.name, description, askUserParams{})
+}
+
+// Call is the function that is called by the agent to ask the user a
+// question when the model requests the tool with the specified parameters.
+func (au *AskUser) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, au.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params askUserParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, au.name, err)
+	}
+
+	if strings.TrimSpace(params.Question) == "" {
+		return toolErrorResponse(toolCall.ID, au.name, fmt.Errorf("question is required"))
+	}
+
+	answer, ok := au.ask(params.Question, params.Choices)
+	if !ok {
+		return toolErrorResponse(toolCall.ID, au.name, fmt.Errorf("the user is gone, continue with your best judgement and say what you assumed"))
+	}
+
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return toolSuccessResponse(toolCall.ID, au.name, ToolData{"answer": "", "note": "the user didn't answer, continue with your best judgement and say what you assumed"})
+	}
+
+	// A number picks one of the choices.
+	if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(params.Choices) {
+		answer = params.Choices[n-1]
+	}
+
+	return toolSuccessResponse(toolCall.ID, au.name, ToolData{"answer": answer})
+}
+
+// =============================================================================
+
+// terminalAsk returns a function that asks the user the model's question on
+// the terminal, reading the answer with the provided function.
+func terminalAsk(getUserMessage func() (string, bool)) func(question string, choices []string) (string, bool) {
+	return func(question string, choices []string) (string, bool) {
+		fmt.Printf("\n%s: %s\n", paint(theme.Question, "The agent asks"), question)
+		for i, choice := range choices {
+			fmt.Printf("  %d. %s\n", i+1, choice)
+		}
+		fmt.Printf("%s: ", paint(theme.User, "You"))
+
+		return getUserMessage()
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// fileModifier is implemented by tools that change files on disk. The agent
+// uses it to snapshot the affected files before the tool is called.
+type fileModifier interface {
+	modifiedPaths(toolCall client.ToolCall) []string
+}
+
+// =============================================================================
+
+// fileSnapshot represents the state of a file before it was modified.
+type fileSnapshot struct {
+	existed bool
+	dir     bool // A directory that didn't exist and is created by the edit.
+	content []byte
+	mode    os.FileMode
+}
+
+// checkpoint represents the snapshots taken during a single agent turn.
+type checkpoint map[string]fileSnapshot
+
+// Checkpoints keeps a stack of workspace snapshots, one per agent turn, so the
+// user can rollback the changes made by the model.
+type Checkpoints struct {
+	stack []checkpoint
+}
+
+// Begin starts a new checkpoint for the next agent turn. An empty checkpoint
+// from a turn that made no changes is replaced.
+func (cp *Checkpoints) Begin() {
+	if n := len(cp.stack); n > 0 && len(cp.stack[n-1]) == 0 {
+		return
+	}
+
+	cp.stack = append(cp.stack, checkpoint{})
+}
+
+// Snapshot captures the current state of the specified files into the current
+// checkpoint. A file is only captured the first time it's seen in a turn so
+// the checkpoint represents the state before the turn started.
+func (cp *Checkpoints) Snapshot(paths ...string) error {
+	if len(cp.stack) == 0 {
+		cp.Begin()
+	}
+
+	current := cp.stack[len(cp.stack)-1]
+
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("abs: %w", err)
+		}
+
+		if _, exists := current[abs]; exists {
+			continue
+		}
+
+		info, err := os.Stat(abs)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			current[abs] = fileSnapshot{existed: false}
+
+			// The tools create the missing parent directories, they are
+			// removed again on rollback.
+			for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+				if _, exists := current[dir]; exists {
+					break
+				}
+				if _, err := os.Stat(dir); !errors.Is(err, os.ErrNotExist) {
+					break
+				}
+				current[dir] = fileSnapshot{existed: false, dir: true}
+			}
+			continue
+
+		case err != nil:
+			return fmt.Errorf("stat: %w", err)
+
+		case info.IsDir():
+			continue
+		}
+
+		content, err := os.ReadFile(abs)
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+
+		current[abs] = fileSnapshot{
+			existed: true,
+			content: content,
+			mode:    info.Mode().Perm(),
+		}
+	}
+
+	return nil
+}
+
+// Rollback restores the workspace to the state before the last turn that
+// modified files. It returns the list of files that were restored.
+func (cp *Checkpoints) Rollback() ([]string, error) {
+	for len(cp.stack) > 0 && len(cp.stack[len(cp.stack)-1]) == 0 {
+		cp.stack = cp.stack[:len(cp.stack)-1]
+	}
+
+	if len(cp.stack) == 0 {
+		return nil, errors.New("no checkpoints to rollback")
+	}
+
+	last := cp.stack[len(cp.stack)-1]
+	cp.stack = cp.stack[:len(cp.stack)-1]
+
+	var restored []string
+	var dirs []string
+	for path, snap := range last {
+		if snap.dir {
+			dirs = append(dirs, path)
+			continue
+		}
+
+		switch snap.existed {
+		case true:
+			if err := os.WriteFile(path, snap.content, snap.mode); err != nil {
+				return restored, fmt.Errorf("restore %s: %w", path, err)
+			}
+
+		case false:
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return restored, fmt.Errorf("remove %s: %w", path, err)
+			}
+		}
+
+		restored = append(restored, path)
+	}
+
+	// The directories are removed once their files are gone, the deepest
+	// first. A directory the user has put other files in is kept.
+	slices.SortFunc(dirs, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	for _, dir := range dirs {
+		if err := os.Remove(dir); err == nil {
+			restored = append(restored, dir)
+		}
+	}
+
+	slices.Sort(restored)
+
+	return restored, nil
+}
+
+// =============================================================================
+
+// FileState represents a file snapshot in a form that can be saved with the
+// session so checkpoints survive a restart.
+type FileState struct {
+	Path    string      `json:"path"`
+	Existed bool        `json:"existed"`
+	Dir     bool        `json:"dir,omitempty"`
+	Content []byte      `json:"content,omitempty"`
+	Mode    os.FileMode `json:"mode,omitempty"`
+}
+
+// State returns the snapshots of every checkpoint, oldest first.
+func (cp *Checkpoints) State() [][]FileState {
+	state := make([][]FileState, 0, len(cp.stack))
+
+	for _, c := range cp.stack {
+		files := make([]FileState, 0, len(c))
+		for path, snap := range c {
+			files = append(files, FileState{
+				Path:    path,
+				Existed: snap.existed,
+				Dir:     snap.dir,
+				Content: snap.content,
+				Mode:    snap.mode,
+			})
+		}
+
+		slices.SortFunc(files, func(a, b FileState) int {
+			return strings.Compare(a.Path, b.Path)
+		})
+
+		state = append(state, files)
+	}
+
+	return state
+}
+
+// Restore replaces the checkpoints with the specified state.
+func (cp *Checkpoints) Restore(state [][]FileState) {
+	cp.stack = make([]checkpoint, 0, len(state))
+
+	for _, files := range state {
+		c := checkpoint{}
+		for _, f := range files {
+			c[f.Path] = fileSnapshot{
+				existed: f.Existed,
+				dir:     f.Dir,
+				content: f.Content,
+				mode:    f.Mode,
+			}
+		}
+
+		cp.stack = append(cp.stack, c)
+	}
+}
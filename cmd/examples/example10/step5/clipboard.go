@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// codeBlocks extracts the contents of the fenced code blocks from a markdown
+// document.
+func codeBlocks(content string) []string {
+	var blocks []string
+	var b strings.Builder
+	var inCode bool
+
+	for line := range strings.Lines(content) {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			if inCode {
+				blocks = append(blocks, b.String())
+				b.Reset()
+			}
+			inCode = !inCode
+			continue
+		}
+
+		if inCode {
+			b.WriteString(line)
+		}
+	}
+
+	// The model could have been cut off in the middle of a code block.
+	if inCode && b.Len() > 0 {
+		blocks = append(blocks, b.String())
+	}
+
+	return blocks
+}
+
+// copyToClipboard places the text on the system clipboard using the backend
+// available for the current operating system.
+func copyToClipboard(text string) error {
+	var candidates [][]string
+
+	switch runtime.GOOS {
+	case "darwin":
+		candidates = [][]string{{"pbcopy"}}
+
+	case "windows":
+		candidates = [][]string{{"clip.exe"}}
+
+	default:
+		candidates = [][]string{
+			{"wl-copy"},
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+			{"clip.exe"}, // WSL
+		}
+	}
+
+	for _, args := range candidates {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			continue
+		}
+
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %w: %s", args[0], err, out)
+		}
+
+		return nil
+	}
+
+	return errors.New("no clipboard backend found, install pbcopy, wl-copy, xclip, or xsel")
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/javascript"
+	"github.com/smacker/go-tree-sitter/python"
+	"github.com/smacker/go-tree-sitter/sql"
+	"github.com/smacker/go-tree-sitter/typescript/tsx"
+	"github.com/smacker/go-tree-sitter/typescript/typescript"
+)
+
+// The tree-sitter grammars used to validate edits, by file extension.
+var codeGrammars = map[string]struct {
+	language string
+	grammar  func() *sitter.Language
+}{
+	".py":  {"python", python.GetLanguage},
+	".js":  {"javascript", javascript.GetLanguage},
+	".mjs": {"javascript", javascript.GetLanguage},
+	".cjs": {"javascript", javascript.GetLanguage},
+	".jsx": {"javascript", javascript.GetLanguage},
+	".ts":  {"typescript", typescript.GetLanguage},
+	".tsx": {"tsx", tsx.GetLanguage},
+	".sql": {"sql", sql.GetLanguage},
+}
+
+// =============================================================================
+// CodeEditor Tool
+
+// CodeEditor represents a tool that can be used to edit source code files in
+// any language. Edits to Go, Python, JavaScript, TypeScript and SQL files are
+// parsed before the file is written, other files are edited as plain text.
+type CodeEditor struct {
+	name string
+}
+
+// RegisterCodeEditor creates a new instance of the CodeEditor tool and loads
+// it into the provided tools map.
+func RegisterCodeEditor(tools map[string]Tool) client.D {
+	ce := CodeEditor{
+		name: "tool_code_editor",
+	}
+	tools[ce.name] = &ce
+
+	return ce.toolDocument()
+}
+
+// codeEditorParams represents the parameters for the CodeEditor tool.
+type codeEditorParams struct {
+	Path       string `json:"path" description:"Relative path and name of the file"`
+	LineNumber int    `json:"line_number" description:"The line number for the code change"`
+	TypeChange string `json:"type_change" description:"The type of change to make: add, replace, delete" enum:"add,replace,delete"`
+	LineChange string `json:"line_change" description:"The text to add, replace, delete including its indentation"`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (ce *CodeEditor) toolDocument() client.D {
+	return client.ToolDocument(ce.name, "Edit source code files in any language including adding, replacing, and deleting lines. Edits that leave Go, Python, JavaScript, TypeScript or SQL files with syntax errors are rejected.", codeEditorParams{})
+}
+
+// modifiedPaths returns the file the tool call will edit.
+func (ce *CodeEditor) modifiedPaths(toolCall client.ToolCall) []string {
+	path, _ := toolCall.Function.Arguments["path"].(string)
+	return []string{path}
+}
+
+// Call is the function that is called by the agent to edit a file when the model
+// requests the tool with the specified parameters.
+func (ce *CodeEditor) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, ce.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params codeEditorParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, ce.name, err)
+	}
+
+	// Indentation is significant in languages like Python so only the line
+	// endings are trimmed.
+	path := params.Path
+	lineNumber := params.LineNumber
+	typeChange := strings.TrimSpace(params.TypeChange)
+	lineChange := strings.TrimRight(params.LineChange, "\r\n")
+
+	file, err := resolvePath(ctx, path)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, ce.name, err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, ce.name, err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+
+	if lineNumber < 1 || lineNumber > len(lines) {
+		return toolErrorResponse(toolCall.ID, ce.name, fmt.Errorf("line number %d is out of range (1-%d)", lineNumber, len(lines)))
+	}
+
+	lines, err = editLines(lines, lineNumber, typeChange, lineChange)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, ce.name, err)
+	}
+
+	modifiedContent, language, err := validateSource(ctx, path, content, []byte(strings.Join(lines, "\n")))
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, ce.name, fmt.Errorf("syntax error after modification: %s, please inform the user", err))
+	}
+
+	if err := os.WriteFile(file, modifiedContent, 0644); err != nil {
+		return toolErrorResponse(toolCall.ID, ce.name, fmt.Errorf("write file: %s", err))
+	}
+
+	// The model gets a compact diff so it can verify its own change, the
+	// renderer shows the same diff to the user.
+	diff := unifiedDiff(path, string(content), string(modifiedContent))
+
+	return toolSuccessResponse(toolCall.ID, ce.name, ToolData{"message": editAction(lineNumber, typeChange), "language": language, "diff": compactDiff(diff)})
+}
+
+// =============================================================================
+
+// validateSource checks the syntax of the content based on the file
+// extension and returns the content to write with the language that was
+// validated. Go files are also formatted. Files in unknown languages are
+// returned as is with a plain text language. The content before the edit is
+// used for SQL, see below.
+func validateSource(ctx context.Context, path string, before []byte, content []byte) ([]byte, string, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	switch ext {
+	case ".go":
+		fset := token.NewFileSet()
+		if _, err := parser.ParseFile(fset, path, content, parser.ParseComments); err != nil {
+			return nil, "go", err
+		}
+
+		formatted, err := format.Source(content)
+		if err != nil {
+			formatted = content
+		}
+		return formatted, "go", nil
+	}
+
+	g, exists := codeGrammars[ext]
+	if !exists {
+		return content, "text", nil
+	}
+
+	root, err := sitter.ParseCtx(ctx, content, g.grammar())
+	if err != nil {
+		return nil, g.language, fmt.Errorf("parse: %w", err)
+	}
+
+	if root.HasError() {
+		// The SQL grammar doesn't know every dialect, like the ON CONFLICT
+		// clause of Postgres and SQLite, so a file it already rejected is
+		// only refused when the errors grow by more than the edit added.
+		if g.language == "sql" {
+			prev, err := sitter.ParseCtx(ctx, before, g.grammar())
+			if err == nil && prev.HasError() && errorBytes(root) <= errorBytes(prev)+max(0, len(content)-len(before)) {
+				return content, g.language, nil
+			}
+		}
+
+		return nil, g.language, syntaxError(root, content)
+	}
+
+	return content, g.language, nil
+}
+
+// errorBytes returns the number of bytes covered by the error nodes of the
+// tree, a missing node counts as one.
+func errorBytes(n *sitter.Node) int {
+	switch {
+	case !n.HasError() && !n.IsMissing():
+		return 0
+	case n.IsMissing():
+		return 1
+	case n.IsError():
+		return int(n.EndByte() - n.StartByte())
+	}
+
+	var count int
+	for i := range int(n.ChildCount()) {
+		count += errorBytes(n.Child(i))
+	}
+
+	return count
+}
+
+// syntaxError describes the first error or missing node in the tree.
+func syntaxError(root *sitter.Node, content []byte) error {
+	var found *sitter.Node
+
+	var walk func(n *sitter.Node)
+	walk = func(n *sitter.Node) {
+		if found != nil || !n.HasError() && !n.IsMissing() {
+			return
+		}
+
+		if n.IsError() || n.IsMissing() {
+			found = n
+			return
+		}
+
+		for i := range int(n.ChildCount()) {
+			walk(n.Child(i))
+		}
+	}
+	walk(root)
+
+	if found == nil {
+		return errors.New("invalid syntax")
+	}
+
+	pos := found.StartPoint()
+	line, col := pos.Row+1, pos.Column+1
+
+	if found.IsMissing() {
+		return fmt.Errorf("line %d:%d: missing %q", line, col, found.Type())
+	}
+
+	text := found.Content(content)
+	text, _, _ = strings.Cut(text, "\n")
+	if len(text) > 40 {
+		text = text[:40] + "..."
+	}
+
+	return fmt.Errorf("line %d:%d: unexpected %q", line, col, text)
+}
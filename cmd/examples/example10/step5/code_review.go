@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/checker"
+	"golang.org/x/tools/go/analysis/passes/bools"
+	"golang.org/x/tools/go/analysis/passes/copylock"
+	"golang.org/x/tools/go/analysis/passes/defers"
+	"golang.org/x/tools/go/analysis/passes/errorsas"
+	"golang.org/x/tools/go/analysis/passes/httpresponse"
+	"golang.org/x/tools/go/analysis/passes/lostcancel"
+	"golang.org/x/tools/go/analysis/passes/nilness"
+	"golang.org/x/tools/go/analysis/passes/printf"
+	"golang.org/x/tools/go/analysis/passes/shadow"
+	"golang.org/x/tools/go/analysis/passes/sortslice"
+	"golang.org/x/tools/go/analysis/passes/stringintconv"
+	"golang.org/x/tools/go/analysis/passes/unusedresult"
+	"golang.org/x/tools/go/analysis/passes/unusedwrite"
+	"golang.org/x/tools/go/packages"
+)
+
+// Limits applied to a review so a large package can't flood the context
+// window or hang the agent.
+const (
+	codeReviewTimeout     = 3 * time.Minute
+	codeReviewMaxFindings = 100
+)
+
+// reviewAnalyzers are the go/analysis passes run by a review. They find
+// bugs, not style issues, so every finding is worth the model's attention.
+var reviewAnalyzers = []*analysis.Analyzer{
+	shadow.Analyzer,
+	copylock.Analyzer,
+	unusedresult.Analyzer,
+	nilness.Analyzer,
+	unusedwrite.Analyzer,
+	lostcancel.Analyzer,
+	errorsas.Analyzer,
+	printf.Analyzer,
+	defers.Analyzer,
+	bools.Analyzer,
+	stringintconv.Analyzer,
+	sortslice.Analyzer,
+	httpresponse.Analyzer,
+}
+
+// staticcheckChecks is the subset of the staticcheck checks run when it's
+// installed: the ones that find bugs, its style checks are left out.
+const staticcheckChecks = "SA1*,SA2*,SA4*,SA5*,SA6*,SA9*"
+
+// =============================================================================
+// CodeReview Tool
+
+// CodeReview represents a tool that runs a curated set of analysis passes
+// over Go packages of the workspace and returns what they find, so the agent
+// can review code and not just edit it.
+type CodeReview struct {
+	name string
+}
+
+// RegisterCodeReview creates a new instance of the CodeReview tool and loads
+// it into the provided tools map.
+func RegisterCodeReview(tools map[string]Tool) client.D {
+	cr := CodeReview{
+		name: "tool_code_review",
+	}
+	tools[cr.name] = &cr
+
+	return cr.toolDocument()
+}
+
+// codeReviewParams represents the parameters for the CodeReview tool.
+type codeReviewParams struct {
+	Packages []string `json:"packages,omitempty" description:"The packages to review, like ./foundation/vector or ./..., all packages by default."`
+	Checks   []string `json:"checks,omitempty" description:"The checks to run, all by default: shadow, copylocks, unusedresult, nilness, unusedwrite, lostcancel, errorsas, printf, defers, bools, stringintconv, sortslice, httpresponse and staticcheck."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (cr *CodeReview) toolDocument() client.D {
+	return client.ToolDocument(cr.name, "Review Go packages of the workspace with static analysis checks that find bugs like shadowed variables, copied locks, ignored results, nil dereferences and leaked contexts. Returns the findings with their file and line.", codeReviewParams{})
+}
+
+// Call is the function that is called by the agent to review packages when
+// the model requests the tool with the specified parameters.
+func (cr *CodeReview) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, cr.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params codeReviewParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, cr.name, err)
+	}
+
+	patterns := params.Packages
+	if len(patterns) == 0 {
+		patterns = []string{"./..."}
+	}
+
+	// Don't let the model sneak flags into the staticcheck command.
+	for _, p := range patterns {
+		if p == "" || strings.HasPrefix(p, "-") || strings.ContainsAny(p, " \t\n") {
+			return toolErrorResponse(toolCall.ID, cr.name, fmt.Errorf("invalid package %q", p))
+		}
+	}
+
+	analyzers, runStaticcheck, err := selectChecks(params.Checks)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, cr.name, err)
+	}
+
+	if err := checkPackages(ctx, patterns); err != nil {
+		return toolErrorResponse(toolCall.ID, cr.name, err)
+	}
+
+	root, err := workingDir(ctx)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, cr.name, fmt.Errorf("getwd: %w", err))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, codeReviewTimeout)
+	defer cancel()
+
+	var findings []reviewFinding
+	var skipped []string
+
+	if len(analyzers) > 0 {
+		f, err := analyze(ctx, root, patterns, analyzers)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, cr.name, err)
+		}
+		findings = append(findings, f...)
+	}
+
+	if runStaticcheck {
+		f, err := staticcheck(ctx, root, patterns)
+		switch {
+		case errors.Is(err, exec.ErrNotFound):
+			skipped = append(skipped, "staticcheck is not installed, install it with go install honnef.co/go/tools/cmd/staticcheck@latest")
+		case err != nil:
+			return toolErrorResponse(toolCall.ID, cr.name, err)
+		}
+		findings = append(findings, f...)
+	}
+
+	slices.SortFunc(findings, func(a, b reviewFinding) int {
+		if c := strings.Compare(a.File, b.File); c != 0 {
+			return c
+		}
+		return a.Line - b.Line
+	})
+	findings = slices.Compact(findings)
+
+	truncated := len(findings) > codeReviewMaxFindings
+	count := len(findings)
+	if truncated {
+		findings = findings[:codeReviewMaxFindings]
+	}
+
+	data := ToolData{
+		"packages":  patterns,
+		"findings":  findings,
+		"count":     count,
+		"truncated": truncated,
+	}
+	if len(skipped) > 0 {
+		data["skipped"] = skipped
+	}
+
+	return toolSuccessResponse(toolCall.ID, cr.name, data)
+}
+
+// =============================================================================
+
+// reviewFinding represents a problem found by a check.
+type reviewFinding struct {
+	Check   string `json:"check"`
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// selectChecks returns the analyzers for the names of the checks and if
+// staticcheck runs. No names selects all the checks.
+func selectChecks(names []string) ([]*analysis.Analyzer, bool, error) {
+	if len(names) == 0 {
+		return reviewAnalyzers, true, nil
+	}
+
+	var analyzers []*analysis.Analyzer
+	var runStaticcheck bool
+
+	for _, name := range names {
+		if name == "staticcheck" {
+			runStaticcheck = true
+			continue
+		}
+
+		i := slices.IndexFunc(reviewAnalyzers, func(a *analysis.Analyzer) bool {
+			return a.Name == name
+		})
+		if i == -1 {
+			return nil, false, fmt.Errorf("unknown check %q", name)
+		}
+
+		analyzers = append(analyzers, reviewAnalyzers[i])
+	}
+
+	return analyzers, runStaticcheck, nil
+}
+
+// analyze loads the packages and runs the analyzers on them. A package that
+// doesn't compile is reported with its errors since the analyzers can't
+// check it.
+func analyze(ctx context.Context, root string, patterns []string, analyzers []*analysis.Analyzer) ([]reviewFinding, error) {
+	cfg := packages.Config{
+		Context: ctx,
+		Dir:     root,
+		Mode:    packages.LoadAllSyntax,
+	}
+
+	pkgs, err := packages.Load(&cfg, patterns...)
+	if err != nil {
+		return nil, fmt.Errorf("load packages: %w", err)
+	}
+
+	if len(pkgs) == 0 {
+		return nil, fmt.Errorf("no packages match %s", strings.Join(patterns, " "))
+	}
+
+	var findings []reviewFinding
+
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			f := reviewFinding{Check: "compile", Message: pkgErr.Msg}
+			f.File, f.Line, f.Column = splitPosition(root, pkgErr.Pos)
+			findings = append(findings, f)
+		}
+	}
+
+	graph, err := checker.Analyze(analyzers, pkgs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("analyze: %w", err)
+	}
+
+	for _, act := range graph.Roots {
+		for _, diag := range act.Diagnostics {
+			pos := act.Package.Fset.Position(diag.Pos)
+
+			file := pos.Filename
+			if rel, err := filepath.Rel(root, file); err == nil {
+				file = rel
+			}
+
+			findings = append(findings, reviewFinding{
+				Check:   act.Analyzer.Name,
+				File:    file,
+				Line:    pos.Line,
+				Column:  pos.Column,
+				Message: diag.Message,
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// staticcheck runs the bug finding subset of the staticcheck checks. It
+// returns exec.ErrNotFound when staticcheck isn't installed.
+func staticcheck(ctx context.Context, root string, patterns []string) ([]reviewFinding, error) {
+	if _, err := exec.LookPath("staticcheck"); err != nil {
+		return nil, exec.ErrNotFound
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	args := append([]string{"-f", "json", "-checks", staticcheckChecks}, patterns...)
+	cmd := exec.CommandContext(ctx, "staticcheck", args...)
+	cmd.Dir = root
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Staticcheck exits with 1 when it finds problems.
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || ctx.Err() != nil || stdout.Len() == 0 {
+			return nil, fmt.Errorf("staticcheck: %w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	var findings []reviewFinding
+
+	scanner := bufio.NewScanner(&stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var problem struct {
+			Code     string `json:"code"`
+			Message  string `json:"message"`
+			Location struct {
+				File   string `json:"file"`
+				Line   int    `json:"line"`
+				Column int    `json:"column"`
+			} `json:"location"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &problem); err != nil {
+			continue
+		}
+
+		file := problem.Location.File
+		if rel, err := filepath.Rel(root, file); err == nil {
+			file = rel
+		}
+
+		findings = append(findings, reviewFinding{
+			Check:   "staticcheck " + problem.Code,
+			File:    file,
+			Line:    problem.Location.Line,
+			Column:  problem.Location.Column,
+			Message: problem.Message,
+		})
+	}
+
+	return findings, nil
+}
+
+// splitPosition splits a position of a package error, like file.go:12:5,
+// into the file relative to the root, the line and the column.
+func splitPosition(root string, pos string) (string, int, int) {
+	var line, column int
+
+	file := pos
+	parts := strings.Split(pos, ":")
+	if len(parts) >= 3 {
+		file = strings.Join(parts[:len(parts)-2], ":")
+		fmt.Sscan(parts[len(parts)-2], &line)
+		fmt.Sscan(parts[len(parts)-1], &column)
+	}
+
+	if rel, err := filepath.Rel(root, file); err == nil && filepath.IsAbs(file) {
+		file = rel
+	}
+
+	return file, line, column
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"gopkg.in/yaml.v3"
+)
+
+// Simple tools can be declared in a YAML file, set with the AGENT_TOOLS_FILE
+// environment variable, instead of being written in Go. A tool has a name, a
+// description, its parameters and a shell command template that is executed
+// with the arguments of the call, every value shell quoted. This is how
+// workshop attendees add their own tools. See zarf/tools/tools.yaml for an
+// example.
+var commandToolDefs []CommandToolDef
+
+func init() {
+	if v := os.Getenv("AGENT_TOOLS_FILE"); v != "" {
+		var err error
+		commandToolDefs, err = loadCommandTools(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Limits applied to the commands of the tools that don't set a timeout.
+const (
+	commandToolTimeout   = 2 * time.Minute
+	commandToolMaxOutput = 16 * 1024
+)
+
+// CommandToolDef represents the declaration of a tool in the tools file.
+type CommandToolDef struct {
+	Name        string             `yaml:"name"`
+	Description string             `yaml:"description"`
+	Parameters  []CommandToolParam `yaml:"parameters"`
+	Command     string             `yaml:"command"`      // A text/template, like "wc -l {{.path}}".
+	Timeout     string             `yaml:"timeout"`      // Like 30s, 2m when empty.
+	SideEffects bool               `yaml:"side_effects"` // The user approves the calls and dry-run skips them.
+}
+
+// CommandToolParam represents a parameter of a declared tool.
+type CommandToolParam struct {
+	Name        string   `yaml:"name"`
+	Type        string   `yaml:"type"` // string, integer, number, boolean or array, string when empty.
+	Description string   `yaml:"description"`
+	Required    bool     `yaml:"required"`
+	Enum        []string `yaml:"enum"`
+}
+
+// The parameter types a declared tool supports.
+var commandToolTypes = []string{"string", "integer", "number", "boolean", "array"}
+
+// loadCommandTools reads and validates the tools file.
+func loadCommandTools(path string) ([]CommandToolDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("tools file: %w", err)
+	}
+
+	var file struct {
+		Tools []CommandToolDef `yaml:"tools"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("tools file: %s: %w", path, err)
+	}
+
+	for i, def := range file.Tools {
+		if err := def.validate(); err != nil {
+			return nil, fmt.Errorf("tools file: %s: tool %d: %w", path, i+1, err)
+		}
+	}
+
+	return file.Tools, nil
+}
+
+// validate checks the declaration is complete and the command template
+// parses.
+func (def *CommandToolDef) validate() error {
+	if def.Name == "" || def.Description == "" || def.Command == "" {
+		return errors.New("name, description and command are required")
+	}
+
+	if def.Timeout != "" {
+		if _, err := time.ParseDuration(def.Timeout); err != nil {
+			return fmt.Errorf("%s: timeout: %w", def.Name, err)
+		}
+	}
+
+	for i, p := range def.Parameters {
+		if p.Name == "" {
+			return fmt.Errorf("%s: parameter %d has no name", def.Name, i+1)
+		}
+
+		if p.Type == "" {
+			def.Parameters[i].Type = "string"
+			continue
+		}
+
+		if !slices.Contains(commandToolTypes, p.Type) {
+			return fmt.Errorf("%s: parameter %s: unsupported type %q, use one of %s", def.Name, p.Name, p.Type, strings.Join(commandToolTypes, ", "))
+		}
+	}
+
+	if _, err := template.New(def.Name).Parse(def.Command); err != nil {
+		return fmt.Errorf("%s: command: %w", def.Name, err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+// Command Tool
+
+// CommandTool represents a tool declared in the tools file that runs a shell
+// command.
+type CommandTool struct {
+	def     CommandToolDef
+	tmpl    *template.Template
+	timeout time.Duration
+}
+
+// RegisterCommandTools creates the declared tools and loads them into the
+// provided tools map. A tool can't replace one that is already registered.
+func RegisterCommandTools(tools map[string]Tool, defs []CommandToolDef) ([]client.D, error) {
+	var docs []client.D
+
+	for _, def := range defs {
+		if _, exists := tools[def.Name]; exists {
+			return nil, fmt.Errorf("tools file: tool %q is already registered", def.Name)
+		}
+
+		tmpl, err := template.New(def.Name).Option("missingkey=zero").Parse(def.Command)
+		if err != nil {
+			return nil, fmt.Errorf("tools file: %s: command: %w", def.Name, err)
+		}
+
+		timeout := commandToolTimeout
+		if def.Timeout != "" {
+			timeout, _ = time.ParseDuration(def.Timeout)
+		}
+
+		ct := CommandTool{
+			def:     def,
+			tmpl:    tmpl,
+			timeout: timeout,
+		}
+		tools[def.Name] = &ct
+
+		docs = append(docs, ct.toolDocument())
+	}
+
+	return docs, nil
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (ct *CommandTool) toolDocument() client.D {
+	properties := make(map[string]any, len(ct.def.Parameters))
+	required := []string{}
+
+	for _, p := range ct.def.Parameters {
+		prop := map[string]any{
+			"type":        p.Type,
+			"description": p.Description,
+		}
+		if p.Type == "array" {
+			prop["items"] = map[string]any{"type": "string"}
+		}
+		if len(p.Enum) > 0 {
+			prop["enum"] = p.Enum
+		}
+		properties[p.Name] = prop
+
+		if p.Required {
+			required = append(required, p.Name)
+		}
+	}
+
+	return client.D{
+		"type": "function",
+		"function": client.D{
+			"name":        ct.def.Name,
+			"description": ct.def.Description,
+			"parameters": map[string]any{
+				"type":       "object",
+				"properties": properties,
+				"required":   required,
+			},
+		},
+	}
+}
+
+// command renders the command template with the arguments of the call. The
+// values are shell quoted so the model can't inject commands, the arguments
+// that aren't set render as an empty string.
+func (ct *CommandTool) command(toolCall client.ToolCall) (string, error) {
+	values := make(map[string]string, len(ct.def.Parameters))
+
+	for _, p := range ct.def.Parameters {
+		arg, exists := toolCall.Function.Arguments[p.Name]
+		if !exists || arg == nil {
+			if p.Required {
+				return "", fmt.Errorf("%s is required", p.Name)
+			}
+			continue
+		}
+
+		value, err := shellValue(p, arg)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", p.Name, err)
+		}
+		values[p.Name] = value
+	}
+
+	var b strings.Builder
+	if err := ct.tmpl.Execute(&b, values); err != nil {
+		return "", err
+	}
+
+	return b.String(), nil
+}
+
+// commandLine returns the command the call runs.
+func (ct *CommandTool) commandLine(toolCall client.ToolCall) (string, bool) {
+	cmd, err := ct.command(toolCall)
+	if err != nil {
+		return "", false
+	}
+
+	return cmd, true
+}
+
+// confirmation describes the command the user has to approve when the tool
+// is declared with side effects.
+func (ct *CommandTool) confirmation(toolCall client.ToolCall) (string, bool) {
+	if !ct.def.SideEffects {
+		return "", false
+	}
+
+	cmd, ok := ct.commandLine(toolCall)
+	if !ok {
+		return "", false
+	}
+
+	return "run " + cmd, true
+}
+
+// mutation describes the command that would have side effects.
+func (ct *CommandTool) mutation(toolCall client.ToolCall) (string, bool) {
+	cmd, ok := ct.confirmation(toolCall)
+	if !ok {
+		return "", false
+	}
+
+	return "would have " + cmd, true
+}
+
+// Call is the function that is called by the agent to run the command of the
+// tool when the model requests the tool with the specified parameters.
+func (ct *CommandTool) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, ct.def.Name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	command, err := ct.command(toolCall)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, ct.def.Name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ct.timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = workspaceDir(ctx)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	// A command that fails is reported with its output so the model can
+	// correct the call, only a command that couldn't run is an error.
+	exitCode := 0
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || ctx.Err() != nil {
+			return toolErrorResponse(toolCall.ID, ct.def.Name, fmt.Errorf("%s: %w", command, err))
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	b := out.Bytes()
+	if len(b) > commandToolMaxOutput {
+		b = append(b[:commandToolMaxOutput:commandToolMaxOutput], "\n... output truncated"...)
+	}
+
+	return toolSuccessResponse(toolCall.ID, ct.def.Name, ToolData{"command": command, "exit_code": exitCode, "output": string(b)})
+}
+
+// =============================================================================
+
+// shellValue converts an argument to its shell quoted form for the type of
+// the parameter. The values of an array are quoted one by one and a false
+// boolean is empty, so flags can be added with {{if .verbose}}-v{{end}}.
+func shellValue(p CommandToolParam, arg any) (string, error) {
+	switch p.Type {
+	case "array":
+		items, ok := arg.([]any)
+		if !ok {
+			return "", fmt.Errorf("expected an array, got %T", arg)
+		}
+
+		quoted := make([]string, len(items))
+		for i, item := range items {
+			quoted[i] = shellQuote(fmt.Sprint(item))
+		}
+		return strings.Join(quoted, " "), nil
+
+	case "boolean":
+		b, ok := arg.(bool)
+		if !ok {
+			return "", fmt.Errorf("expected a boolean, got %T", arg)
+		}
+		if !b {
+			return "", nil
+		}
+		return "true", nil
+
+	case "integer", "number":
+		n, ok := arg.(float64)
+		if !ok {
+			return "", fmt.Errorf("expected a number, got %T", arg)
+		}
+		if p.Type == "integer" && n != float64(int64(n)) {
+			return "", fmt.Errorf("expected an integer, got %v", n)
+		}
+		return strconv.FormatFloat(n, 'f', -1, 64), nil
+	}
+
+	s := fmt.Sprint(arg)
+	if len(p.Enum) > 0 && !slices.Contains(p.Enum, s) {
+		return "", fmt.Errorf("must be one of %s, got %q", strings.Join(p.Enum, ", "), s)
+	}
+
+	return shellQuote(s), nil
+}
+
+// shellQuote quotes the value for sh, single quotes can't be escaped inside
+// single quotes so they are closed and reopened around one.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// command represents a command the user can run from the chat prompt.
+type command struct {
+	usage       string
+	description string
+	run         func(a *Agent, ctx context.Context, args []string)
+}
+
+// commands is the set of supported commands keyed by name.
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"/help": {
+			usage:       "/help",
+			description: "Show the list of commands",
+			run:         (*Agent).cmdHelp,
+		},
+		"/cache": {
+			usage:       "/cache [clear]",
+			description: "Show the answers in the semantic cache or clear them",
+			run:         (*Agent).cmdCache,
+		},
+		"/context": {
+			usage:       "/context",
+			description: "Show how much of the context window each message uses",
+			run:         (*Agent).cmdContext,
+		},
+		"/copy": {
+			usage:       "/copy [n]",
+			description: "Copy the nth code block (default 1) of the last answer to the clipboard",
+			run:         (*Agent).cmdCopy,
+		},
+		"/history": {
+			usage:       "/history",
+			description: "Show when each conversation entry happened and what it cost",
+			run:         (*Agent).cmdHistory,
+		},
+		"/save": {
+			usage:       "/save [file]",
+			description: "Save the session as JSON (default session-<time>.json)",
+			run:         (*Agent).cmdSave,
+		},
+		"/pin": {
+			usage:       "/pin n",
+			description: "Keep the message with the number /context shows when the conversation is trimmed",
+			run:         (*Agent).cmdPin,
+		},
+		"/unpin": {
+			usage:       "/unpin n",
+			description: "Let the pinned message be trimmed again",
+			run:         (*Agent).cmdUnpin,
+		},
+		"/persona": {
+			usage:       "/persona [name]",
+			description: "Show the personas or switch to a different one",
+			run:         (*Agent).cmdPersona,
+		},
+		"/preferences": {
+			usage:       "/preferences [clear [key]]",
+			description: "Show the preferences remembered across sessions or forget them",
+			run:         (*Agent).cmdPreferences,
+		},
+		"/prefetch": {
+			usage:       "/prefetch",
+			description: "Show how many file reads were served by prefetching",
+			run:         (*Agent).cmdPrefetch,
+		},
+		"/set": {
+			usage:       "/set [temperature=0.7] [top_p=0.9] [top_k=40] [seed=42] | reset",
+			description: "Show the sampling settings or override the ones of the persona for the session",
+			run:         (*Agent).cmdSet,
+		},
+		"/skills": {
+			usage:       "/skills",
+			description: "Show the skill packs and which ones are loaded",
+			run:         (*Agent).cmdSkills,
+		},
+		"/status": {
+			usage:       "/status",
+			description: "Show the models loaded by the server, its queue and the GPUs, to find out why generations are slow",
+			run:         (*Agent).cmdStatus,
+		},
+		"/summary": {
+			usage:       "/summary",
+			description: "Show the rolling summary of the session",
+			run:         (*Agent).cmdSummary,
+		},
+		"/theme": {
+			usage:       "/theme [name]",
+			description: "Show the themes or switch to a different one, a JSON file can be used",
+			run:         (*Agent).cmdTheme,
+		},
+		"/tool": {
+			usage:       "/tool [name]",
+			description: "Force the model to call the tool first on the next request",
+			run:         (*Agent).cmdTool,
+		},
+		"/rollback": {
+			usage:       "/rollback",
+			description: "Restore the files changed during the last agent turn",
+			run:         (*Agent).cmdRollback,
+		},
+	}
+}
+
+// runCommand parses the user input and runs the requested command.
+func (a *Agent) runCommand(ctx context.Context, input string) {
+	fields := strings.Fields(input)
+
+	cmd, exists := commands[fields[0]]
+	if !exists {
+		a.renderer.Error(fmt.Errorf("unknown command %q, use /help to list the commands", fields[0]))
+		return
+	}
+
+	cmd.run(a, ctx, fields[1:])
+}
+
+// =============================================================================
+
+func (a *Agent) cmdHelp(ctx context.Context, args []string) {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		a.renderer.Info(fmt.Sprintf("%-20s %s", commands[name].usage, commands[name].description))
+	}
+
+}
+
+func (a *Agent) cmdRollback(ctx context.Context, args []string) {
+	restored, err := a.checkpoints.Rollback()
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("rollback: %w", err))
+		return
+	}
+
+	for _, path := range restored {
+		a.renderer.Info(fmt.Sprintf("restored: %s", path))
+	}
+
+	a.expireFiles(restored)
+
+	// Let the model know its previous changes no longer exist so it doesn't
+	// reason about stale file contents.
+	a.conversation = append(a.conversation, client.User(fmt.Sprintf("I rolled back the file changes you made in your last turn. These files were restored to their previous state: %s", strings.Join(restored, ", "))))
+}
+
+func (a *Agent) cmdPrefetch(ctx context.Context, args []string) {
+	pf, ok := a.tools["tool_read_file"].(*Prefetch)
+	if !ok {
+		a.renderer.Info("prefetch is turned off")
+		return
+	}
+
+	files, hits := pf.stats()
+	a.renderer.Info(fmt.Sprintf("prefetch: cached files[%d] reads served from the cache[%d]", files, hits))
+}
+
+func (a *Agent) cmdPin(ctx context.Context, args []string) {
+	a.setPinned(args, true)
+}
+
+func (a *Agent) cmdUnpin(ctx context.Context, args []string) {
+	a.setPinned(args, false)
+}
+
+// setPinned pins or unpins the message with the number /context shows. Only
+// the messages of the user and the answers can be pinned, a tool result
+// without its request means nothing to the model.
+func (a *Agent) setPinned(args []string, pinned bool) {
+	var n int
+	if len(args) > 0 {
+		n, _ = strconv.Atoi(args[0])
+	}
+
+	if n < 1 || n >= len(a.conversation) {
+		a.renderer.Error(fmt.Errorf("pin: use a message number between 1 and %d from /context", len(a.conversation)-1))
+		return
+	}
+
+	msg := a.conversation[n]
+	content, _ := msg["content"].(string)
+	if msg["role"] != "user" && (msg["role"] != "assistant" || strings.HasPrefix(content, "Tool call ")) {
+		a.renderer.Error(fmt.Errorf("pin: message %d is part of a tool call, pin a message of the user or an answer", n))
+		return
+	}
+
+	meta, _ := messageMeta(msg)
+	meta.Pinned = pinned
+	withMeta(msg, meta)
+
+	if pinned {
+		a.renderer.Info(fmt.Sprintf("message %d is kept when the conversation is trimmed", n))
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("message %d can be trimmed again", n))
+}
+
+func (a *Agent) cmdCopy(ctx context.Context, args []string) {
+	n := 1
+	if len(args) > 0 {
+		v, err := strconv.Atoi(args[0])
+		if err != nil || v < 1 {
+			a.renderer.Error(fmt.Errorf("copy: invalid code block number %q", args[0]))
+			return
+		}
+		n = v
+	}
+
+	blocks := codeBlocks(a.LastAnswer())
+	if n > len(blocks) {
+		a.renderer.Error(fmt.Errorf("copy: the last answer has %d code block(s)", len(blocks)))
+		return
+	}
+
+	if err := copyToClipboard(blocks[n-1]); err != nil {
+		a.renderer.Error(fmt.Errorf("copy: %w", err))
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("copied code block %d (%d lines) to the clipboard", n, strings.Count(blocks[n-1], "\n")))
+
+}
+
+func (a *Agent) cmdHistory(ctx context.Context, args []string) {
+	for i, msg := range a.conversation {
+		meta, ok := messageMeta(msg)
+		if !ok {
+			a.renderer.Info(fmt.Sprintf("%3d %-9s", i, msg["role"]))
+			continue
+		}
+
+		line := fmt.Sprintf("%3d %-9s %s tokens[%d]", i, msg["role"], meta.Time.Local().Format(time.TimeOnly), meta.Tokens)
+		if meta.Latency > 0 {
+			line += fmt.Sprintf(" latency[%s]", meta.Latency.Round(time.Millisecond))
+		}
+		if meta.Model != "" {
+			line += fmt.Sprintf(" model[%s]", meta.Model)
+		}
+
+		a.renderer.Info(line)
+	}
+}
+
+func (a *Agent) cmdSave(ctx context.Context, args []string) {
+	path := fmt.Sprintf("session-%s.json", time.Now().Format("20060102-150405"))
+	if len(args) > 0 {
+		path = args[0]
+	}
+
+	if err := a.Save(path); err != nil {
+		a.renderer.Error(fmt.Errorf("save: %w", err))
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("saved session to %s", path))
+}
+
+func (a *Agent) cmdContext(ctx context.Context, args []string) {
+	const barWidth = 30
+
+	type usage struct {
+		label   string
+		tokens  int
+		preview string
+	}
+
+	// The tool definitions are sent with every request so they use part of
+	// the window as well.
+	toolDocuments := a.activeToolDocuments()
+	docs, _ := json.Marshal(toolDocuments)
+
+	usages := []usage{
+		{label: "tools", tokens: a.tke.TokenCount(string(docs)), preview: fmt.Sprintf("%d tool definitions", len(toolDocuments))},
+	}
+
+	for i, msg := range a.conversation {
+		content, _ := msg["content"].(string)
+
+		preview := strings.Join(strings.Fields(content), " ")
+		if len(preview) > 40 {
+			n := 37
+			for n > 0 && !utf8.RuneStart(preview[n]) {
+				n--
+			}
+			preview = preview[:n] + "..."
+		}
+
+		usages = append(usages, usage{
+			label:   fmt.Sprintf("%3d %s", i, msg["role"]),
+			tokens:  a.tke.TokenCount(content),
+			preview: preview,
+		})
+	}
+
+	var total, largest int
+	for _, u := range usages {
+		total += u.tokens
+		largest = max(largest, u.tokens)
+	}
+
+	for _, u := range usages {
+		percentage := float64(u.tokens) / float64(contextWindow) * 100
+
+		// Bars are scaled to the largest message so small conversations are
+		// still readable, the color shows the share of the whole window.
+		width := 0
+		if largest > 0 {
+			width = max(u.tokens*barWidth/largest, 1)
+		}
+
+		color := theme.Low
+		switch {
+		case percentage >= 20:
+			color = theme.High
+		case percentage >= 5:
+			color = theme.Medium
+		}
+
+		bar := paint(color, strings.Repeat("█", width)) + strings.Repeat(" ", barWidth-width)
+
+		a.renderer.Info(fmt.Sprintf("%-14s %6d %5.1f%% %s %s", u.label, u.tokens, percentage, bar, paint(theme.Stats, u.preview)))
+	}
+
+	a.renderer.Info(fmt.Sprintf("Window[%d] (%.0f%% of %.0fK) Free[%d]", total, float64(total)/float64(contextWindow)*100, float64(contextWindow)/1024, max(contextWindow-total, 0)))
+}
+
+func (a *Agent) cmdPersona(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		var names []string
+		for name := range personas {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		for _, name := range names {
+			marker := " "
+			if name == a.persona.Name {
+				marker = "*"
+			}
+			a.renderer.Info(fmt.Sprintf("%s %-10s %s", marker, name, personas[name].Description))
+		}
+		return
+	}
+
+	p, err := lookupPersona(args[0])
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("persona: %w", err))
+		return
+	}
+
+	a.setPersona(p)
+
+	a.renderer.Info(fmt.Sprintf("switched to the %s persona: temperature[%.1f] top_p[%.1f] top_k[%d] tools[%d]", p.Name, p.Temperature, p.TopP, p.TopK, len(a.activeToolDocuments())))
+}
+
+func (a *Agent) cmdTool(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		if a.forcedTool == "" {
+			a.renderer.Info("no tool is forced, the model decides which tools to call")
+			return
+		}
+		a.renderer.Info(fmt.Sprintf("the model will call %s first on the next request", a.forcedTool))
+		return
+	}
+
+	if err := a.ForceTool(args[0]); err != nil {
+		a.renderer.Error(fmt.Errorf("tool: %w", err))
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("the model will call %s first on the next request", args[0]))
+}
+
+func (a *Agent) cmdSummary(ctx context.Context, args []string) {
+	summary := a.summaryText()
+	if summary == "" {
+		a.renderer.Info(fmt.Sprintf("there is no summary yet, the session is summarized every %d turns", summaryTurns))
+		return
+	}
+
+	a.renderer.Content(summary)
+	a.renderer.Done()
+}
+
+func (a *Agent) cmdTheme(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		for _, name := range slices.Sorted(maps.Keys(themes)) {
+			a.renderer.Info(name)
+		}
+		return
+	}
+
+	t, err := loadTheme(args[0])
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("theme: %w", err))
+		return
+	}
+
+	theme = t
+
+	a.renderer.Info(fmt.Sprintf("switched to the %s theme", args[0]))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// confirmer is implemented by tools that run commands the user has to
+// approve first. It describes the command and reports false if the call
+// doesn't need approval.
+type confirmer interface {
+	confirmation(toolCall client.ToolCall) (string, bool)
+}
+
+// approval represents the answer of the user when asked to approve a call.
+type approval int
+
+// The answers the user can give. A call approved always isn't asked about
+// again for the rest of the session.
+const (
+	approvalDeclined approval = iota
+	approvalOnce
+	approvalAlways
+)
+
+// WithConfirm sets the function used to ask the user to approve a tool call.
+// Without one there is no user to ask, like in daemon mode, so the calls that
+// need approval are declined.
+func WithConfirm(confirm func(prompt string) approval) func(a *Agent) {
+	return func(a *Agent) {
+		a.confirm = confirm
+	}
+}
+
+// confirmed reports whether the tool call can be executed, asking the user
+// when the tool or the policy needs approval.
+func (a *Agent) confirmed(tool Tool, toolCall client.ToolCall) error {
+	var prompt string
+	var ok bool
+
+	if c, isConfirmer := tool.(confirmer); isConfirmer {
+		prompt, ok = c.confirmation(toolCall)
+	}
+
+	if !ok && policy != nil && policy.requiresApproval(toolCall.Function.Name) {
+		prompt, ok = approvalPrompt(toolCall), true
+	}
+
+	if !ok || a.approvals[prompt] {
+		return nil
+	}
+
+	if a.confirm == nil {
+		return fmt.Errorf("there is no user to approve the request to %s", prompt)
+	}
+
+	switch a.confirm(prompt) {
+	case approvalDeclined:
+		return fmt.Errorf("the user declined to %s", prompt)
+
+	case approvalAlways:
+		if a.approvals == nil {
+			a.approvals = make(map[string]bool)
+		}
+		a.approvals[prompt] = true
+	}
+
+	return nil
+}
+
+// terminalConfirm returns a function that asks the user to approve a tool
+// call on the terminal, reading the answer with the provided function.
+func terminalConfirm(getUserMessage func() (string, bool)) func(prompt string) approval {
+	return func(prompt string) approval {
+		fmt.Printf("\n%s: ", paint(theme.Question, fmt.Sprintf("Allow the agent to %s? [y/N/a(lways)]", prompt)))
+
+		answer, ok := getUserMessage()
+		if !ok {
+			return approvalDeclined
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return approvalOnce
+		case "a", "always":
+			return approvalAlways
+		}
+
+		return approvalDeclined
+	}
+}
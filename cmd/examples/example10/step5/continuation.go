@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The length of an answer. A model call stops at maxTokens, the context
+// window when it's 0, and an answer that was cut off is continued up to
+// maxContinuations times and stitched together. These can be changed with the
+// AGENT_MAX_TOKENS and AGENT_MAX_CONTINUATIONS environment variables, 0
+// continuations leaves a cut off answer as it is.
+var (
+	maxTokens        int
+	maxContinuations = 3
+)
+
+func init() {
+	if v := os.Getenv("AGENT_MAX_TOKENS"); v != "" {
+		var err error
+		maxTokens, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_MAX_CONTINUATIONS"); v != "" {
+		var err error
+		maxContinuations, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// modelResponse represents how the last model call ended.
+type modelResponse struct {
+	content      string // Before post-processing.
+	finishReason string
+}
+
+// continuePrompt asks the model to pick up an answer that was cut off.
+const continuePrompt = "Your answer was cut off because it reached the token limit. Continue exactly where you stopped, without repeating anything and without an introduction."
+
+// continueAnswer asks the model to continue an answer that was cut off at the
+// token limit. The parts are stitched into a single answer so the
+// conversation reads as if the answer was never cut off.
+func (a *Agent) continueAnswer(ctx context.Context) error {
+	for n := 1; a.lastResponse.finishReason == client.FinishLength; n++ {
+		if n > maxContinuations {
+			a.renderer.Info(fmt.Sprintf("the answer is still cut off after %d continuations, ask the model to continue or raise AGENT_MAX_TOKENS", maxContinuations))
+
+			a.mu.Lock()
+			a.turn.Truncated = true
+			a.mu.Unlock()
+
+			return nil
+		}
+
+		a.renderer.Info(fmt.Sprintf("the answer was cut off at the token limit, asking the model to continue (%d of %d)", n, maxContinuations))
+
+		// The partial answer isn't in the conversation if it was empty after
+		// post-processing.
+		partial := a.lastResponse.content
+		hasPartial := a.conversation[len(a.conversation)-1]["role"] == "assistant"
+
+		a.conversation = append(a.conversation, withMeta(client.User(continuePrompt), MessageMeta{
+			Time:   time.Now().UTC(),
+			Tokens: a.tke.TokenCount(continuePrompt),
+		}))
+
+		if _, err := a.callModel(ctx, false); err != nil {
+			return err
+		}
+
+		// Remove the partial answer, the prompt and the continuation from the
+		// end of the conversation and replace them with the whole answer.
+		// They are counted from the end since the conversation could have
+		// been trimmed.
+		end := len(a.conversation)
+		if a.conversation[end-1]["role"] == "assistant" {
+			end--
+		}
+		cut := end - 1
+		if hasPartial {
+			cut--
+		}
+
+		a.lastResponse.content = partial + a.lastResponse.content
+		content := postProcess(a.lastResponse.content)
+
+		a.conversation = append(a.conversation[:cut], withMeta(client.Assistant(content), MessageMeta{
+			Time:   time.Now().UTC(),
+			Model:  model,
+			Tokens: a.tke.TokenCount(content),
+		}))
+	}
+
+	return nil
+}
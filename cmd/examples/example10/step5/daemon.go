@@ -0,0 +1,527 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// daemonListenAndServe runs the agent as a long running service exposing a
+// REST API for programmatic chat.
+//
+//	POST   /v1/sessions                    create a new chat session
+//	POST   /v1/sessions/{id}/messages      post a message, the reply is streamed as SSE
+//	GET    /v1/sessions/{id}/events        list the tool calls made in the session
+//	GET    /v1/sessions/{id}/tools         list the definitions of the tools
+//	POST   /v1/sessions/{id}/tools/{name}  call a tool with the arguments in the body
+//	DELETE /v1/sessions/{id}               close the session
+//	GET    /v1/scheduler                   show the model queue, with AGENT_MODEL_SLOTS
+//
+// The output format sets how replies are returned. The default streams SSE
+// events, json returns a single result document when the turn is done and
+// jsonl streams the events as JSON lines. A request can override the format
+// with the output query parameter. A message can set the tool field to force
+// the model to call that tool before answering, and the sampling field, like
+// {"temperature": 0.7}, to override the sampling for its turn only.
+//
+// In multi-user mode every request needs the API token of a user in the
+// Authorization header, like "Authorization: Bearer <token>". A user only
+// sees their own sessions, the tools work in their workspace and requests
+// over their limits are refused with a 429.
+func daemonListenAndServe(host string, output string) error {
+	d := daemon{
+		sessions: make(map[string]*session),
+		output:   output,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/sessions", d.createSession)
+	mux.HandleFunc("POST /v1/sessions/{id}/messages", d.postMessage)
+	mux.HandleFunc("GET /v1/sessions/{id}/events", d.listToolEvents)
+	mux.HandleFunc("GET /v1/sessions/{id}/tools", d.listTools)
+	mux.HandleFunc("POST /v1/sessions/{id}/tools/{name}", d.callTool)
+	mux.HandleFunc("DELETE /v1/sessions/{id}", d.closeSession)
+	mux.HandleFunc("GET /v1/scheduler", d.schedulerStats)
+
+	srv := http.Server{
+		Addr:              host,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("daemon: serving the agent API at %s", host)
+
+	return srv.ListenAndServe()
+}
+
+// =============================================================================
+
+// session represents a chat session with its own agent and conversation.
+// In multi-user mode the session belongs to a user.
+type session struct {
+	mu       sync.Mutex
+	agent    *Agent
+	renderer *eventRenderer
+	user     *userState
+}
+
+type daemon struct {
+	mu       sync.RWMutex
+	sessions map[string]*session
+	output   string
+}
+
+func (d *daemon) createSession(w http.ResponseWriter, r *http.Request) {
+	usr, ok := d.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	renderer := eventRenderer{}
+
+	id := rand.Text()
+
+	options := []func(a *Agent){WithRenderer(&renderer), WithSessionID(id)}
+
+	// In multi-user mode the agent works in the user's workspace and its
+	// tools can't reach outside of it.
+	if usr != nil {
+		if err := usr.openSession(); err != nil {
+			writeJSON(w, limitStatus(err), client.D{"error": err.Error()})
+			return
+		}
+
+		workspace, err := users.workspace(usr)
+		if err != nil {
+			usr.closeSession()
+			writeJSON(w, http.StatusInternalServerError, client.D{"error": err.Error()})
+			return
+		}
+
+		options = append(options, WithWorkspace(workspace), WithPriority(usr.priority))
+	}
+
+	agent, err := NewAgent(nil, options...)
+	if err != nil {
+		if usr != nil {
+			usr.closeSession()
+		}
+		writeJSON(w, http.StatusInternalServerError, client.D{"error": err.Error()})
+		return
+	}
+
+	d.mu.Lock()
+	d.sessions[id] = &session{
+		agent:    agent,
+		renderer: &renderer,
+		user:     usr,
+	}
+	d.mu.Unlock()
+
+	writeJSON(w, http.StatusCreated, client.D{"id": id})
+}
+
+func (d *daemon) postMessage(w http.ResponseWriter, r *http.Request) {
+	sess, ok := d.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	var msg struct {
+		Content  string   `json:"content"`
+		Tool     string   `json:"tool"`
+		Sampling Sampling `json:"sampling"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil || msg.Content == "" {
+		writeJSON(w, http.StatusBadRequest, client.D{"error": "body must be a JSON document with a content field"})
+		return
+	}
+
+	output := d.output
+	if v := r.URL.Query().Get("output"); v != "" {
+		output = v
+	}
+
+	if err := validateOutput(output); err != nil {
+		writeJSON(w, http.StatusBadRequest, client.D{"error": err.Error()})
+		return
+	}
+
+	if !d.allow(w, sess) {
+		return
+	}
+
+	// A session can only process one message at a time since the messages
+	// share the same conversation.
+	if !sess.mu.TryLock() {
+		writeJSON(w, http.StatusConflict, client.D{"error": "session is busy with another message"})
+		return
+	}
+	defer sess.mu.Unlock()
+
+	// The tokens of the turn count against the user's quota.
+	defer d.countTokens(sess)
+
+	// The message can force the model to call a tool before answering.
+	if err := sess.agent.ForceTool(msg.Tool); err != nil {
+		writeJSON(w, http.StatusBadRequest, client.D{"error": err.Error()})
+		return
+	}
+
+	// The message can override the sampling of the session for its turn.
+	if err := sess.agent.OverrideTurn(msg.Sampling); err != nil {
+		writeJSON(w, http.StatusBadRequest, client.D{"error": err.Error()})
+		return
+	}
+
+	// The json output doesn't stream, the result is returned once the turn
+	// is done.
+	if output == outputJSON {
+		if err := sess.agent.Turn(r.Context(), msg.Content); err != nil {
+			writeJSON(w, http.StatusInternalServerError, client.D{"error": err.Error(), "result": sess.agent.LastTurn()})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, sess.agent.LastTurn())
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, client.D{"error": "streaming not supported"})
+		return
+	}
+
+	jsonl := output == outputJSONL
+
+	if jsonl {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Connection", "keep-alive")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	sess.renderer.attach(w, flusher, jsonl)
+	defer sess.renderer.detach()
+
+	if err := sess.agent.Turn(r.Context(), msg.Content); err != nil {
+		sess.renderer.Error(err)
+	}
+
+	sess.renderer.event("result", sess.agent.LastTurn())
+	sess.renderer.event("done", client.D{})
+}
+
+func (d *daemon) listToolEvents(w http.ResponseWriter, r *http.Request) {
+	sess, ok := d.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sess.agent.ToolEvents())
+}
+
+func (d *daemon) listTools(w http.ResponseWriter, r *http.Request) {
+	sess, ok := d.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sess.agent.ToolDocuments())
+}
+
+func (d *daemon) callTool(w http.ResponseWriter, r *http.Request) {
+	sess, ok := d.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	var arguments map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&arguments); err != nil {
+		writeJSON(w, http.StatusBadRequest, client.D{"error": "body must be a JSON document with the arguments of the tool"})
+		return
+	}
+
+	if !d.allow(w, sess) {
+		return
+	}
+
+	if !sess.mu.TryLock() {
+		writeJSON(w, http.StatusConflict, client.D{"error": "session is busy with another message"})
+		return
+	}
+	defer sess.mu.Unlock()
+
+	// The caller's request id is kept so the tool event can be matched with
+	// the caller's logs.
+	ctx := r.Context()
+	if requestID := r.Header.Get(client.RequestIDHeader); requestID != "" {
+		ctx = client.WithRequestID(ctx, requestID)
+	}
+
+	// The tool message is returned as is, the content is the response
+	// envelope the model would have seen.
+	writeJSON(w, http.StatusOK, sess.agent.CallTool(ctx, r.PathValue("name"), arguments))
+}
+
+func (d *daemon) closeSession(w http.ResponseWriter, r *http.Request) {
+	sess, ok := d.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	_, exists := d.sessions[r.PathValue("id")]
+	delete(d.sessions, r.PathValue("id"))
+	d.mu.Unlock()
+
+	// The session was closed by a concurrent request.
+	if !exists {
+		writeJSON(w, http.StatusNotFound, client.D{"error": "session not found"})
+		return
+	}
+
+	sess.agent.Close()
+
+	if sess.user != nil {
+		sess.user.closeSession()
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (d *daemon) schedulerStats(w http.ResponseWriter, r *http.Request) {
+	if _, ok := d.authenticate(w, r); !ok {
+		return
+	}
+
+	if modelQueue == nil {
+		writeJSON(w, http.StatusNotFound, client.D{"error": "the model queue is turned off, set AGENT_MODEL_SLOTS"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, modelQueue.Stats())
+}
+
+// lookup returns the session of the request. In multi-user mode the
+// sessions of other users are reported as not found.
+func (d *daemon) lookup(w http.ResponseWriter, r *http.Request) (*session, bool) {
+	usr, ok := d.authenticate(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	d.mu.RLock()
+	sess, exists := d.sessions[r.PathValue("id")]
+	d.mu.RUnlock()
+
+	if !exists || sess.user != usr {
+		writeJSON(w, http.StatusNotFound, client.D{"error": "session not found"})
+		return nil, false
+	}
+
+	return sess, true
+}
+
+// authenticate returns the user of the request in multi-user mode, nil
+// otherwise.
+func (d *daemon) authenticate(w http.ResponseWriter, r *http.Request) (*userState, bool) {
+	if users == nil {
+		return nil, true
+	}
+
+	usr, ok := users.authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, client.D{"error": "a valid API token is required in the Authorization header"})
+		return nil, false
+	}
+
+	return usr, true
+}
+
+// allow reports whether the user of the session is within their limits for
+// one more request.
+func (d *daemon) allow(w http.ResponseWriter, sess *session) bool {
+	if sess.user == nil {
+		return true
+	}
+
+	if err := sess.user.allow(time.Now()); err != nil {
+		if errors.Is(err, errRateLimited) {
+			w.Header().Set("Retry-After", "60")
+		}
+		writeJSON(w, limitStatus(err), client.D{"error": err.Error()})
+		return false
+	}
+
+	return true
+}
+
+// countTokens adds the tokens of the last turn of the session to its user.
+func (d *daemon) countTokens(sess *session) {
+	if sess.user == nil {
+		return
+	}
+
+	usage := sess.agent.LastTurn().Usage
+	sess.user.addTokens(usage.InputTokens + usage.OutputTokens)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("daemon: write response: %s", err)
+	}
+}
+
+// =============================================================================
+
+// requestRenderer is implemented by renderers that report the id of every
+// request the agent makes to the model.
+type requestRenderer interface {
+	ModelRequest(requestID string)
+}
+
+// eventRenderer streams the agent's activity to an API client as server sent
+// events or as JSON lines with the event name in the type field. The tool
+// events carry the id of the model request that asked for them.
+type eventRenderer struct {
+	mu        sync.Mutex
+	w         io.Writer
+	flusher   http.Flusher
+	jsonl     bool
+	requestID string
+}
+
+// attach starts streaming events to the writer. The flusher is optional and
+// is called after every event.
+func (er *eventRenderer) attach(w io.Writer, flusher http.Flusher, jsonl bool) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	er.w = w
+	er.flusher = flusher
+	er.jsonl = jsonl
+}
+
+func (er *eventRenderer) detach() {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	er.w = nil
+	er.flusher = nil
+}
+
+func (er *eventRenderer) event(name string, data any) {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	if er.w == nil {
+		return
+	}
+
+	if er.jsonl {
+		b, err := json.Marshal(client.D{"type": name, "data": data})
+		if err != nil {
+			b = fmt.Appendf(nil, `{"type": "error", "data": {"error": %q}}`, err.Error())
+		}
+		fmt.Fprintf(er.w, "%s\n", b)
+	} else {
+		b, err := json.Marshal(data)
+		if err != nil {
+			b = fmt.Appendf(nil, `{"error": %q}`, err.Error())
+		}
+		fmt.Fprintf(er.w, "event: %s\ndata: %s\n\n", name, b)
+	}
+
+	if er.flusher != nil {
+		er.flusher.Flush()
+	}
+}
+
+// Waiting is ignored since API clients can track latency themselves.
+func (er *eventRenderer) Waiting(model string, elapsed time.Duration) {}
+
+// ModelRequest streams the id of a request to the model, the server logs it
+// with the request.
+func (er *eventRenderer) ModelRequest(requestID string) {
+	er.mu.Lock()
+	er.requestID = requestID
+	er.mu.Unlock()
+
+	er.event("model_request", client.D{"request_id": requestID, "model": model})
+}
+
+// currentRequest returns the id of the last request to the model.
+func (er *eventRenderer) currentRequest() string {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	return er.requestID
+}
+
+// Reasoning streams the reasoning of the model.
+func (er *eventRenderer) Reasoning(text string) {
+	er.event("reasoning", client.D{"text": text})
+}
+
+// Content streams the answer from the model.
+func (er *eventRenderer) Content(text string) {
+	er.event("content", client.D{"text": text})
+}
+
+// ToolCall streams the tool the model asked to call.
+func (er *eventRenderer) ToolCall(toolCall client.ToolCall) {
+	er.event("tool_call", client.D{
+		"request_id": er.currentRequest(),
+		"id":         toolCall.ID,
+		"name":       toolCall.Function.Name,
+		"arguments":  toolCall.Function.Arguments,
+	})
+}
+
+// ToolResult streams the result of a tool call.
+func (er *eventRenderer) ToolResult(toolCall client.ToolCall, result client.D) {
+	er.event("tool_result", client.D{
+		"request_id": er.currentRequest(),
+		"id":         toolCall.ID,
+		"name":       toolCall.Function.Name,
+		"result":     result["content"],
+	})
+}
+
+// Info streams status information like token usage.
+func (er *eventRenderer) Info(msg string) {
+	er.event("info", client.D{"message": msg})
+}
+
+// Warning streams something the user should look at.
+func (er *eventRenderer) Warning(msg string) {
+	er.event("warning", client.D{"message": msg})
+}
+
+// Error streams an error.
+func (er *eventRenderer) Error(err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	er.event("error", client.D{"error": err.Error()})
+}
+
+// Done is ignored since the end of a message is reported by the handler.
+func (er *eventRenderer) Done() {}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// The database the model can query. The tool is only registered when this is
+// set with the AGENT_DATABASE_URL environment variable, using a postgres://
+// url or sqlite:<path> for a SQLite file.
+var databaseURL = os.Getenv("AGENT_DATABASE_URL")
+
+// Limits applied to every query the model runs so a bad query can't flood
+// the context window or hang the agent.
+const (
+	dbMaxRows        = 100
+	dbMaxResultBytes = 32 * 1024
+	dbTimeout        = 10 * time.Second
+)
+
+// openDatabase opens the database at the url in read only mode where the
+// driver supports it.
+func openDatabase(dbURL string) (*sql.DB, string, error) {
+	switch {
+	case strings.HasPrefix(dbURL, "postgres://"), strings.HasPrefix(dbURL, "postgresql://"):
+		db, err := sql.Open("pgx", dbURL)
+		if err != nil {
+			return nil, "", fmt.Errorf("open postgres: %w", err)
+		}
+		return db, "postgres", nil
+
+	case strings.HasPrefix(dbURL, "sqlite:"):
+		path := strings.TrimPrefix(dbURL, "sqlite:")
+		db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro", path))
+		if err != nil {
+			return nil, "", fmt.Errorf("open sqlite: %w", err)
+		}
+		return db, "sqlite", nil
+	}
+
+	return nil, "", fmt.Errorf("unsupported database url %q, use postgres:// or sqlite:<path>", dbURL)
+}
+
+// =============================================================================
+// QueryDatabase Tool
+
+// QueryDatabase represents a tool that can be used to learn the schema of a
+// database and run read only queries against it.
+type QueryDatabase struct {
+	name    string
+	db      *sql.DB
+	dialect string
+}
+
+// RegisterQueryDatabase creates a new instance of the QueryDatabase tool and
+// loads it into the provided tools map.
+func RegisterQueryDatabase(tools map[string]Tool, db *sql.DB, dialect string) client.D {
+	qd := QueryDatabase{
+		name:    "tool_query_database",
+		db:      db,
+		dialect: dialect,
+	}
+	tools[qd.name] = &qd
+
+	return qd.toolDocument()
+}
+
+// queryDatabaseParams represents the parameters for the QueryDatabase tool.
+type queryDatabaseParams struct {
+	Action string `json:"action" description:"list_tables to list the tables, describe_table to list the columns of a table, or query to run a SELECT statement." enum:"list_tables,describe_table,query"`
+	Table  string `json:"table,omitempty" description:"The table to describe, required for describe_table."`
+	SQL    string `json:"sql,omitempty" description:"A single read only SELECT statement, required for query."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (qd *QueryDatabase) toolDocument() client.D {
+	description := fmt.Sprintf("Query the %s database. List the tables and describe them before writing a query. Only SELECT statements are allowed and at most %d rows are returned.", qd.dialect, dbMaxRows)
+
+	return client.ToolDocument(qd.name, description, queryDatabaseParams{})
+}
+
+// Call is the function that is called by the agent to query the database
+// when the model requests the tool with the specified parameters.
+func (qd *QueryDatabase) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, qd.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params queryDatabaseParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, qd.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dbTimeout)
+	defer cancel()
+
+	var query string
+	var args []any
+
+	switch params.Action {
+	case "list_tables":
+		query = qd.listTablesQuery()
+
+	case "describe_table":
+		if params.Table == "" {
+			return toolErrorResponse(toolCall.ID, qd.name, errors.New("table is required to describe a table"))
+		}
+		query, args = qd.describeTableQuery(params.Table)
+
+	case "query":
+		stmt, err := readOnlyStatement(params.SQL)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, qd.name, err)
+		}
+		query = fmt.Sprintf("SELECT * FROM (%s) AS q LIMIT %d", stmt, dbMaxRows+1)
+
+	default:
+		return toolErrorResponse(toolCall.ID, qd.name, fmt.Errorf("unknown action %q", params.Action))
+	}
+
+	rows, truncated, err := qd.query(ctx, query, args...)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, qd.name, err)
+	}
+
+	return toolSuccessResponse(toolCall.ID, qd.name, ToolData{"rows": rows, "row_count": len(rows), "truncated": truncated})
+}
+
+func (qd *QueryDatabase) listTablesQuery() string {
+	if qd.dialect == "sqlite" {
+		return `SELECT name, type FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite_%' ORDER BY name`
+	}
+
+	return `SELECT table_schema, table_name, table_type FROM information_schema.tables WHERE table_schema NOT IN ('pg_catalog', 'information_schema') ORDER BY table_schema, table_name`
+}
+
+func (qd *QueryDatabase) describeTableQuery(table string) (string, []any) {
+	if qd.dialect == "sqlite" {
+		return `SELECT name, type, "notnull", pk FROM pragma_table_info(?)`, []any{table}
+	}
+
+	schema := "public"
+	if before, after, found := strings.Cut(table, "."); found {
+		schema, table = before, after
+	}
+
+	return `SELECT column_name, data_type, is_nullable, column_default FROM information_schema.columns WHERE table_schema = $1 AND table_name = $2 ORDER BY ordinal_position`, []any{schema, table}
+}
+
+// query runs the query in a read only transaction and returns the rows as
+// maps, stopping at the row and size limits.
+func (qd *QueryDatabase) query(ctx context.Context, query string, args ...any) ([]map[string]any, bool, error) {
+	tx, err := qd.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, false, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, false, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, false, fmt.Errorf("columns: %w", err)
+	}
+
+	var result []map[string]any
+	var size int
+
+	for rows.Next() {
+		if len(result) == dbMaxRows {
+			return result, true, nil
+		}
+
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, false, fmt.Errorf("scan: %w", err)
+		}
+
+		row := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+
+		data, _ := json.Marshal(row)
+		size += len(data)
+		if size > dbMaxResultBytes {
+			return result, true, nil
+		}
+
+		result = append(result, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("rows: %w", err)
+	}
+
+	return result, false, nil
+}
+
+// readOnlyStatement validates the model provided a single SELECT statement.
+// The read only transaction is the real protection, this gives the model a
+// clear error to correct itself with.
+func readOnlyStatement(stmt string) (string, error) {
+	stmt = strings.TrimSpace(stmt)
+	stmt = strings.TrimSpace(strings.TrimSuffix(stmt, ";"))
+
+	if stmt == "" {
+		return "", errors.New("sql is required to run a query")
+	}
+
+	if strings.Contains(stmt, ";") {
+		return "", errors.New("only a single statement is allowed")
+	}
+
+	first := strings.ToUpper(strings.Fields(stmt)[0])
+	if first != "SELECT" && first != "WITH" {
+		return "", fmt.Errorf("only SELECT statements are allowed, got %s", first)
+	}
+
+	return stmt, nil
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Settings for producing diffs of file changes.
+const (
+	diffContextLines = 3
+	diffMaxCompact   = 2048
+	diffMaxLCSCells  = 4_000_000
+)
+
+// diffOp represents a single line level operation in a diff.
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	text string
+}
+
+// unifiedDiff produces a unified diff between the old and new content of the
+// specified file. An empty string is returned if nothing changed.
+func unifiedDiff(path string, oldContent string, newContent string) string {
+	if oldContent == newContent {
+		return ""
+	}
+
+	ops := diffLines(strings.Split(oldContent, "\n"), strings.Split(newContent, "\n"))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- a/%s\n+++ b/%s\n", path, path)
+
+	// Walk the operations and group changes into hunks with the configured
+	// number of context lines around them.
+	oldLine, newLine := 1, 1
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			oldLine++
+			newLine++
+			i++
+			continue
+		}
+
+		start := max(i-diffContextLines, 0)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+
+			// Find the length of this run of unchanged lines. If it's short
+			// enough, the next change belongs to the same hunk.
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > diffContextLines*2 {
+				end = min(end+diffContextLines, len(ops))
+				break
+			}
+			end = run
+		}
+
+		hunkOld, hunkNew := oldLine-(i-start), newLine-(i-start)
+		var oldCount, newCount int
+		var body strings.Builder
+		for _, op := range ops[start:end] {
+			switch op.kind {
+			case ' ':
+				oldCount++
+				newCount++
+			case '-':
+				oldCount++
+			case '+':
+				newCount++
+			}
+			fmt.Fprintf(&body, "%c%s\n", op.kind, op.text)
+		}
+
+		fmt.Fprintf(&b, "@@ -%d,%d +%d,%d @@\n%s", hunkOld, oldCount, hunkNew, newCount, body.String())
+
+		for _, op := range ops[i:end] {
+			switch op.kind {
+			case ' ':
+				oldLine++
+				newLine++
+			case '-':
+				oldLine++
+			case '+':
+				newLine++
+			}
+		}
+		i = end
+	}
+
+	return b.String()
+}
+
+// diffLines calculates the line operations to turn old into new. The common
+// prefix and suffix are removed first since edits tend to be small, and the
+// remaining lines are compared using a longest common subsequence table.
+func diffLines(old []string, new []string) []diffOp {
+	var prefix int
+	for prefix < len(old) && prefix < len(new) && old[prefix] == new[prefix] {
+		prefix++
+	}
+
+	var suffix int
+	for suffix < len(old)-prefix && suffix < len(new)-prefix && old[len(old)-1-suffix] == new[len(new)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(old)+len(new))
+	for _, line := range old[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	a := old[prefix : len(old)-suffix]
+	b := new[prefix : len(new)-suffix]
+
+	switch {
+	case len(a)*len(b) > diffMaxLCSCells:
+
+		// The change is too large to compare line by line so treat it as a
+		// replacement of the entire block.
+		for _, line := range a {
+			ops = append(ops, diffOp{'-', line})
+		}
+		for _, line := range b {
+			ops = append(ops, diffOp{'+', line})
+		}
+
+	default:
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				switch {
+				case a[i] == b[j]:
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				default:
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+
+		i, j := 0, 0
+		for i < len(a) || j < len(b) {
+			switch {
+			case i < len(a) && j < len(b) && a[i] == b[j]:
+				ops = append(ops, diffOp{' ', a[i]})
+				i++
+				j++
+			case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+				ops = append(ops, diffOp{'-', a[i]})
+				i++
+			default:
+				ops = append(ops, diffOp{'+', b[j]})
+				j++
+			}
+		}
+	}
+
+	for _, line := range old[len(old)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+
+	return ops
+}
+
+// colorDiff adds terminal colors to a unified diff for display.
+func colorDiff(diff string) string {
+	var b strings.Builder
+
+	for line := range strings.Lines(diff) {
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+			fmt.Fprintf(&b, "%s\n", paint(theme.DiffHeader, line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Fprintf(&b, "%s\n", paint(theme.DiffHunk, line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Fprintf(&b, "%s\n", paint(theme.DiffRemoved, line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Fprintf(&b, "%s\n", paint(theme.DiffAdded, line))
+		default:
+			fmt.Fprintf(&b, "%s\n", line)
+		}
+	}
+
+	return b.String()
+}
+
+// compactDiff limits the size of a diff so it can be returned to the model
+// without using too much of the context window.
+func compactDiff(diff string) string {
+	if len(diff) <= diffMaxCompact {
+		return diff
+	}
+
+	return diff[:diffMaxCompact] + "\n... diff truncated ..."
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The resources a container started by the agent can use at most, the model
+// can ask for less. These can be changed with the AGENT_DOCKER_CPUS and
+// AGENT_DOCKER_MEMORY environment variables, like 2 and 1g.
+var (
+	dockerMaxCPUs   = 1.0
+	dockerMaxMemory = "512m"
+)
+
+func init() {
+	if v := os.Getenv("AGENT_DOCKER_CPUS"); v != "" {
+		var err error
+		dockerMaxCPUs, err = strconv.ParseFloat(v, 64)
+		if err != nil || dockerMaxCPUs <= 0 {
+			log.Fatalf("docker cpus: %q must be a positive number", v)
+		}
+	}
+
+	if v := os.Getenv("AGENT_DOCKER_MEMORY"); v != "" {
+		if _, err := parseDockerMemory(v); err != nil {
+			log.Fatal(err)
+		}
+		dockerMaxMemory = v
+	}
+}
+
+// Limits applied to the docker commands so a build can't hang the agent and
+// the logs can't flood the context window.
+const (
+	dockerBuildTimeout   = 10 * time.Minute
+	dockerTimeout        = time.Minute
+	dockerMaxFollow      = 30 * time.Second
+	dockerMaxOutput      = 16 * 1024
+	dockerPidsLimit      = "256"
+	dockerContainerLabel = "ai-training.agent=true"
+)
+
+// Patterns of the values passed to docker. A value can't start with a dash
+// so the model can't sneak flags into the command.
+var (
+	dockerNameRE  = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	dockerImageRE = regexp.MustCompile(`^[a-z0-9][a-z0-9_./:@-]*$`)
+	dockerPortRE  = regexp.MustCompile(`^([0-9.]+:)?[0-9]+:[0-9]+(?:/(?:tcp|udp))?$`)
+	dockerEnvRE   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+)
+
+// =============================================================================
+// Docker Tool
+
+// Docker represents a tool that builds images and runs containers so the
+// agent can containerize an app or debug a running service. The containers
+// run with capped CPU and memory and are labeled, only the containers the
+// agent started can be inspected or stopped. Building, running and stopping
+// need the user's approval.
+type Docker struct {
+	name string
+}
+
+// RegisterDocker creates a new instance of the Docker tool and loads it into
+// the provided tools map. The tool is only useful when docker is installed,
+// which is reported by the second return value.
+func RegisterDocker(tools map[string]Tool) (client.D, bool) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return nil, false
+	}
+
+	dk := Docker{
+		name: "tool_docker",
+	}
+	tools[dk.name] = &dk
+
+	return dk.toolDocument(), true
+}
+
+// dockerParams represents the parameters for the Docker tool.
+type dockerParams struct {
+	Action     string   `json:"action" description:"build to build an image, run to start a container, logs to read the output of a container, stop to stop and remove a container, ps to list the containers the agent started." enum:"build,run,logs,stop,ps"`
+	Image      string   `json:"image,omitempty" description:"The image to build, like myapp:dev, or to run."`
+	Context    string   `json:"context,omitempty" description:"The directory of the build in the workspace, the workspace root by default."`
+	Dockerfile string   `json:"dockerfile,omitempty" description:"The Dockerfile of the build, relative to the workspace, Dockerfile in the build directory by default."`
+	Container  string   `json:"container,omitempty" description:"The name of the container to run, read the logs of or stop."`
+	Ports      []string `json:"ports,omitempty" description:"The ports to publish when running, like 8080:8080. They are published on 127.0.0.1 unless an address is given, like 0.0.0.0:8080:8080."`
+	Env        []string `json:"env,omitempty" description:"The environment variables of the container, like PORT=8080."`
+	Command    []string `json:"command,omitempty" description:"The command to run in the container instead of the image's default."`
+	CPUs       float64  `json:"cpus,omitempty" description:"The CPUs the container can use, capped by the agent's limit."`
+	Memory     string   `json:"memory,omitempty" description:"The memory the container can use, like 256m, capped by the agent's limit."`
+	Tail       int      `json:"tail,omitempty" description:"The number of log lines to read from the end, 100 by default."`
+	Follow     int      `json:"follow,omitempty" description:"Seconds to keep reading new log lines, up to 30, useful right after starting a service."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (dk *Docker) toolDocument() client.D {
+	description := fmt.Sprintf("Build Docker images and run containers from the workspace, read the logs of a running container and stop it. Containers run detached with at most %g CPUs and %s of memory. The user is asked to confirm build, run and stop.", dockerMaxCPUs, dockerMaxMemory)
+
+	return client.ToolDocument(dk.name, description, dockerParams{})
+}
+
+// command returns the arguments of the docker commands for the call. Stop
+// runs two commands, the others one.
+func (dk *Docker) command(toolCall client.ToolCall) ([][]string, error) {
+	var params dockerParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	switch params.Action {
+	case "build":
+		return dk.build(params)
+
+	case "run":
+		return dk.run(toolCall.ID, params)
+
+	case "logs":
+		if !dockerNameRE.MatchString(params.Container) {
+			return nil, fmt.Errorf("invalid container %q", params.Container)
+		}
+
+		tail := params.Tail
+		if tail <= 0 {
+			tail = 100
+		}
+
+		args := []string{"logs", "--tail", strconv.Itoa(tail), "--timestamps"}
+		if params.Follow > 0 {
+			args = append(args, "--follow")
+		}
+		return [][]string{append(args, params.Container)}, nil
+
+	case "stop":
+		if !dockerNameRE.MatchString(params.Container) {
+			return nil, fmt.Errorf("invalid container %q", params.Container)
+		}
+		return [][]string{{"stop", params.Container}, {"rm", params.Container}}, nil
+
+	case "ps":
+		return [][]string{{"ps", "--all", "--filter", "label=" + dockerContainerLabel, "--format", "{{.Names}}\t{{.Image}}\t{{.Status}}\t{{.Ports}}"}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported action %q, use build, run, logs, stop or ps", params.Action)
+}
+
+// build returns the docker build command. The build directory and the
+// Dockerfile must be in the workspace.
+func (dk *Docker) build(params dockerParams) ([][]string, error) {
+	if !dockerImageRE.MatchString(params.Image) {
+		return nil, fmt.Errorf("invalid image %q, name it like myapp:dev", params.Image)
+	}
+
+	dir := cmp.Or(params.Context, ".")
+	if !filepath.IsLocal(dir) {
+		return nil, fmt.Errorf("build directory %q must be in the workspace", dir)
+	}
+
+	args := []string{"build", "--tag", params.Image}
+	if params.Dockerfile != "" {
+		if !filepath.IsLocal(params.Dockerfile) {
+			return nil, fmt.Errorf("dockerfile %q must be in the workspace", params.Dockerfile)
+		}
+		args = append(args, "--file", params.Dockerfile)
+	}
+
+	return [][]string{append(args, dir)}, nil
+}
+
+// run returns the docker run command. The container runs detached, labeled
+// as started by the agent, with the resources capped. Without a name the
+// container is named after the tool call, so the command the user approves
+// is the one that runs.
+func (dk *Docker) run(id string, params dockerParams) ([][]string, error) {
+	if !dockerImageRE.MatchString(params.Image) {
+		return nil, fmt.Errorf("invalid image %q", params.Image)
+	}
+
+	if params.Container != "" && !dockerNameRE.MatchString(params.Container) {
+		return nil, fmt.Errorf("invalid container %q", params.Container)
+	}
+
+	cpus := dockerMaxCPUs
+	if params.CPUs > 0 {
+		cpus = min(params.CPUs, dockerMaxCPUs)
+	}
+
+	memory := dockerMaxMemory
+	if params.Memory != "" {
+		want, err := parseDockerMemory(params.Memory)
+		if err != nil {
+			return nil, err
+		}
+		limit, _ := parseDockerMemory(dockerMaxMemory)
+		if want < limit {
+			memory = params.Memory
+		}
+	}
+
+	args := []string{"run", "--detach",
+		"--label", dockerContainerLabel,
+		"--cpus", strconv.FormatFloat(cpus, 'f', -1, 64),
+		"--memory", memory,
+		"--pids-limit", dockerPidsLimit,
+	}
+
+	name := params.Container
+	if name == "" {
+		name = dockerContainerName(id)
+	}
+	args = append(args, "--name", name)
+
+	// The ports are only reachable from this machine unless the model asks
+	// for an address.
+	for _, p := range params.Ports {
+		m := dockerPortRE.FindStringSubmatch(p)
+		if m == nil {
+			return nil, fmt.Errorf("invalid port %q, publish it like 8080:8080", p)
+		}
+		if m[1] == "" {
+			p = "127.0.0.1:" + p
+		}
+		args = append(args, "--publish", p)
+	}
+
+	for _, e := range params.Env {
+		if !dockerEnvRE.MatchString(e) {
+			return nil, fmt.Errorf("invalid environment variable %q, set it like PORT=8080", e)
+		}
+		args = append(args, "--env", e)
+	}
+
+	args = append(args, params.Image)
+
+	return [][]string{append(args, params.Command...)}, nil
+}
+
+// commandLine returns the docker commands the call runs.
+func (dk *Docker) commandLine(toolCall client.ToolCall) (string, bool) {
+	cmds, err := dk.command(toolCall)
+	if err != nil {
+		return "", false
+	}
+
+	lines := make([]string, len(cmds))
+	for i, args := range cmds {
+		lines[i] = "docker " + strings.Join(args, " ")
+	}
+
+	return strings.Join(lines, " && "), true
+}
+
+// confirmation describes the docker commands the user has to approve.
+// Reading the logs and listing the containers don't change anything.
+func (dk *Docker) confirmation(toolCall client.ToolCall) (string, bool) {
+	cmds, err := dk.command(toolCall)
+	if err != nil || cmds[0][0] == "logs" || cmds[0][0] == "ps" {
+		return "", false
+	}
+
+	cmd, _ := dk.commandLine(toolCall)
+	return "run " + cmd, true
+}
+
+// mutation describes the docker commands that would have side effects.
+func (dk *Docker) mutation(toolCall client.ToolCall) (string, bool) {
+	cmd, ok := dk.confirmation(toolCall)
+	if !ok {
+		return "", false
+	}
+
+	return "would have " + cmd, true
+}
+
+// network reports that building and running can pull images from a
+// registry.
+func (dk *Docker) network(toolCall client.ToolCall) (string, bool) {
+	cmds, err := dk.command(toolCall)
+	if err != nil || (cmds[0][0] != "build" && cmds[0][0] != "run") {
+		return "", false
+	}
+
+	return "docker registry", true
+}
+
+// Call is the function that is called by the agent to run the docker
+// commands when the model requests the tool with the specified parameters.
+func (dk *Docker) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, dk.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	cmds, err := dk.command(toolCall)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, dk.name, err)
+	}
+
+	action := cmds[0][0]
+
+	// The build directory and the Dockerfile can't leave the workspace
+	// through a symlink either.
+	if action == "build" {
+		var params dockerParams
+		toolCall.Function.Decode(&params)
+
+		for _, path := range []string{cmp.Or(params.Context, "."), params.Dockerfile} {
+			if _, err := resolvePath(ctx, path); path != "" && err != nil {
+				return toolErrorResponse(toolCall.ID, dk.name, err)
+			}
+		}
+	}
+
+	// Only the containers the agent started can be inspected or stopped.
+	if action == "logs" || action == "stop" {
+		if err := dk.owned(ctx, cmds[0][len(cmds[0])-1]); err != nil {
+			return toolErrorResponse(toolCall.ID, dk.name, err)
+		}
+	}
+
+	timeout := dockerTimeout
+	switch action {
+	case "build":
+		timeout = dockerBuildTimeout
+	case "logs":
+		var params dockerParams
+		toolCall.Function.Decode(&params)
+		if params.Follow > 0 {
+			timeout = min(time.Duration(params.Follow)*time.Second, dockerMaxFollow)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output []byte
+	exitCode := 0
+
+	for _, args := range cmds {
+		out, code, err := runDocker(ctx, args)
+
+		// Following the logs ends with the timeout, what was read is the
+		// result.
+		if err != nil && !(action == "logs" && errors.Is(ctx.Err(), context.DeadlineExceeded)) {
+			return toolErrorResponse(toolCall.ID, dk.name, fmt.Errorf("docker %s: %w", strings.Join(args, " "), err))
+		}
+
+		output = append(output, out...)
+		if exitCode = code; code != 0 {
+			break
+		}
+	}
+
+	if len(output) > dockerMaxOutput {
+		output = append(output[len(output)-dockerMaxOutput:len(output):len(output)], "\n... earlier output truncated"...)
+	}
+
+	lines := make([]string, len(cmds))
+	for i, args := range cmds {
+		lines[i] = "docker " + strings.Join(args, " ")
+	}
+
+	data := ToolData{"command": strings.Join(lines, " && "), "exit_code": exitCode, "output": string(output)}
+	if action == "run" && exitCode == 0 {
+		data["container"] = cmds[0][slices.Index(cmds[0], "--name")+1]
+	}
+
+	return toolSuccessResponse(toolCall.ID, dk.name, data)
+}
+
+// owned checks the container was started by the agent.
+func (dk *Docker) owned(ctx context.Context, container string) error {
+	ctx, cancel := context.WithTimeout(ctx, dockerTimeout)
+	defer cancel()
+
+	out, code, err := runDocker(ctx, []string{"inspect", "--format", `{{index .Config.Labels "ai-training.agent"}}`, container})
+	if err != nil {
+		return err
+	}
+
+	if code != 0 {
+		return fmt.Errorf("container %q doesn't exist", container)
+	}
+
+	if strings.TrimSpace(string(out)) != "true" {
+		return fmt.Errorf("container %q wasn't started by the agent, only those can be inspected or stopped", container)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// runDocker runs a docker command and returns its combined output and exit
+// code. A command that fails is reported with its output so the model can
+// correct the call, only a command that couldn't run is an error.
+func runDocker(ctx context.Context, args []string) ([]byte, int, error) {
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Dir = workspaceDir(ctx)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || ctx.Err() != nil {
+			return out.Bytes(), -1, err
+		}
+		return out.Bytes(), exitErr.ExitCode(), nil
+	}
+
+	return out.Bytes(), 0, nil
+}
+
+// parseDockerMemory returns the bytes of a docker memory size, like 512m or
+// 1g.
+func parseDockerMemory(s string) (int64, error) {
+	units := map[byte]int64{'b': 1, 'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}
+
+	lower := strings.ToLower(s)
+	mult := int64(1)
+	if n := len(lower); n > 0 {
+		if u, exists := units[lower[n-1]]; exists {
+			mult = u
+			lower = lower[:n-1]
+		}
+	}
+
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("memory %q must be a size like 512m or 1g", s)
+	}
+
+	return n * mult, nil
+}
+
+// dockerContainerName returns the name of a container the model didn't name,
+// derived from the tool call so every look at the command sees the same
+// name.
+func dockerContainerName(id string) string {
+	if id == "" {
+		return "agent-" + strings.ToLower(rand.Text()[:8])
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return "agent-" + hex.EncodeToString(sum[:4])
+}
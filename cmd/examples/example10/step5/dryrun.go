@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// In dry-run mode the tools that change files or call out with side effects
+// are not executed, the model is told what the call would have done instead.
+// This makes it safe to demo the agent against a production-like repo. This
+// can be turned on with the -dry-run flag or the AGENT_DRY_RUN environment
+// variable.
+var dryRun bool
+
+func init() {
+	if v := os.Getenv("AGENT_DRY_RUN"); v != "" {
+		var err error
+		dryRun, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// mutator is implemented by tools whose calls can have side effects other
+// than changing files. It describes what the call would do and reports false
+// if the call has no side effects.
+type mutator interface {
+	mutation(toolCall client.ToolCall) (string, bool)
+}
+
+// dryRunAction describes what the tool call would change. It reports false
+// if the call has no side effects and is safe to execute.
+func dryRunAction(tool Tool, toolCall client.ToolCall) (string, bool) {
+	switch t := tool.(type) {
+	case mutator:
+		return t.mutation(toolCall)
+
+	case fileModifier:
+		return "would have written " + strings.Join(t.modifiedPaths(toolCall), ", "), true
+	}
+
+	return "", false
+}
+
+// dryRunResponse returns the response for a tool call that was not executed
+// because of the dry-run mode.
+func dryRunResponse(tool Tool, toolCall client.ToolCall) client.D {
+	action, _ := dryRunAction(tool, toolCall)
+
+	return toolSuccessResponse(toolCall.ID, toolCall.Function.Name, ToolData{"result": "dry-run: " + action})
+}
+
+// isMutation reports whether the tool call has side effects.
+func isMutation(tool Tool, toolCall client.ToolCall) bool {
+	_, mutates := dryRunAction(tool, toolCall)
+	return mutates
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// expiringTools are the tools whose results are copies of a file, keyed by
+// the argument that holds the path. The result expires once the file is
+// changed.
+var expiringTools = map[string]string{
+	"tool_read_file":   "path",
+	"tool_file_chunks": "path",
+}
+
+// readPaths returns the files the result of the tool call is a copy of,
+// relative to the directory the tools work in.
+func readPaths(ctx context.Context, toolCall client.ToolCall) []string {
+	arg, exists := expiringTools[toolCall.Function.Name]
+	if !exists {
+		return nil
+	}
+
+	path, _ := toolCall.Function.Arguments[arg].(string)
+	if path == "" {
+		return nil
+	}
+
+	full, err := resolvePath(ctx, path)
+	if err != nil {
+		return nil
+	}
+
+	root, err := workingDir(ctx)
+	if err != nil {
+		return []string{filepath.Clean(full)}
+	}
+
+	return []string{relativePath(root, full)}
+}
+
+// succeeded reports whether the tool message holds a successful result.
+func succeeded(resp client.D) bool {
+	content, _ := resp["content"].(string)
+
+	tr, err := parseToolResponse(content)
+	if err != nil {
+		return false
+	}
+
+	return !tr.Failed()
+}
+
+// =============================================================================
+
+// expireReads marks the results in the messages that are copies of the
+// changed files as stale. Their content is flagged so the model reads the
+// file again instead of editing from the old contents. It returns the number
+// of results that expired. The changed paths are relative to the root or
+// absolute.
+func expireReads(messages []client.D, root string, changed []string) int {
+	paths := make([]string, len(changed))
+	for i, path := range changed {
+		paths[i] = relativePath(root, path)
+	}
+
+	var expired int
+
+	for _, msg := range messages {
+		meta, ok := messageMeta(msg)
+		if !ok || meta.Stale || len(meta.Reads) == 0 {
+			continue
+		}
+
+		i := slices.IndexFunc(meta.Reads, func(path string) bool {
+			return slices.Contains(paths, path)
+		})
+		if i == -1 {
+			continue
+		}
+
+		content, _ := msg["content"].(string)
+		msg["content"] = fmt.Sprintf("STALE: %s was changed after this result was returned, read it again before relying on these contents.\n%s", meta.Reads[i], content)
+
+		meta.Stale = true
+		withMeta(msg, meta)
+
+		expired++
+	}
+
+	return expired
+}
+
+// expireFiles marks the results in the conversation that are copies of the
+// changed files as stale and drops the files from the prefetch cache, so the
+// next read returns what is on disk.
+func (a *Agent) expireFiles(changed []string) {
+	if len(changed) == 0 {
+		return
+	}
+
+	expireReads(a.conversation, a.root(), changed)
+
+	if pf, ok := a.tools["tool_read_file"].(*Prefetch); ok {
+		pf.forget(changed...)
+	}
+}
+
+// root returns the absolute path of the directory the agent's tools work in,
+// the paths of the reads are relative to it.
+func (a *Agent) root() string {
+	root, err := filepath.Abs(a.workspace)
+	if err != nil {
+		return a.workspace
+	}
+
+	return root
+}
+
+// dropStale removes the stale results, the oldest first, until the
+// conversation fits in the window. They are removed before the trim policy
+// runs since the model has to read the files again anyway. The tool call
+// request goes with its last result.
+func dropStale(conversation []client.D, window int, tokens func(client.D) int) ([]client.D, int) {
+	var dropped int
+
+	for i := 1; i < len(conversation) && conversationTokens(conversation, tokens) > window; {
+		meta, ok := messageMeta(conversation[i])
+		if !ok || !meta.Stale {
+			i++
+			continue
+		}
+
+		id, _ := conversation[i]["tool_call_id"].(string)
+		conversation = slices.Delete(conversation, i, i+1)
+		dropped++
+
+		// The request is recorded right before the results of the call.
+		request, _ := conversation[i-1]["content"].(string)
+		orphaned := i == len(conversation) || conversation[i]["role"] != "tool"
+		if conversation[i-1]["role"] == "assistant" && strings.HasPrefix(request, "Tool call "+id+":") && orphaned {
+			conversation = slices.Delete(conversation, i-1, i)
+			i--
+		}
+	}
+
+	return conversation, dropped
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/tiktoken"
+)
+
+// Limits for the chunks returned by the FileChunks tool. Each chunk repeats
+// the last lines of the previous chunk so context isn't lost at the boundary.
+const (
+	fileChunkTokens        = 2000
+	fileChunkMaxTokens     = 8000
+	fileChunkOverlapTokens = 200
+	fileChunkCachedFiles   = 16
+)
+
+// fileChunk represents a token bounded window of a file.
+type fileChunk struct {
+	Index     int
+	StartLine int
+	EndLine   int
+	Start     int // Byte offset of the chunk in the content.
+	End       int
+	Tokens    int
+	Content   string
+}
+
+// fileChunks splits the content into windows of at most maxTokens tokens,
+// breaking on line boundaries. Lines that are larger than a window on their
+// own are split into pieces.
+func fileChunks(content string, maxTokens int, overlapTokens int, count func(string) int) iter.Seq[fileChunk] {
+	type line struct {
+		number int
+		offset int
+		text   string
+		tokens int
+	}
+
+	return func(yield func(fileChunk) bool) {
+		var lines []line
+		var number, offset int
+
+		for text := range strings.Lines(content) {
+			number++
+
+			tokens := count(text)
+			if tokens <= maxTokens {
+				lines = append(lines, line{number, offset, text, tokens})
+				offset += len(text)
+				continue
+			}
+
+			runes := []rune(text)
+			size := max(len(runes)*maxTokens/tokens, 1)
+			for start := 0; start < len(runes); start += size {
+				piece := string(runes[start:min(start+size, len(runes))])
+				lines = append(lines, line{number, offset, piece, count(piece)})
+				offset += len(piece)
+			}
+		}
+
+		var index int
+		for start := 0; start < len(lines); {
+			end := start
+			var tokens int
+			for end < len(lines) && (end == start || tokens+lines[end].tokens <= maxTokens) {
+				tokens += lines[end].tokens
+				end++
+			}
+
+			var b strings.Builder
+			for _, l := range lines[start:end] {
+				b.WriteString(l.text)
+			}
+
+			last := lines[end-1]
+
+			chunk := fileChunk{
+				Index:     index,
+				StartLine: lines[start].number,
+				EndLine:   last.number,
+				Start:     lines[start].offset,
+				End:       last.offset + len(last.text),
+				Tokens:    tokens,
+				Content:   b.String(),
+			}
+
+			if !yield(chunk) {
+				return
+			}
+
+			if end == len(lines) {
+				return
+			}
+
+			// Back up to include the overlap, always moving forward.
+			next := end
+			for overlap := 0; next-1 > start && overlap+lines[next-1].tokens <= overlapTokens; next-- {
+				overlap += lines[next-1].tokens
+			}
+
+			start = next
+			index++
+		}
+	}
+}
+
+// =============================================================================
+// FileChunks Tool
+
+// FileChunks represents a tool that can be used to read a large file one
+// token bounded chunk at a time. The chunk boundaries are kept per file so
+// paging through a file only tokenizes it once.
+type FileChunks struct {
+	name string
+	tke  *tiktoken.Tiktoken
+
+	mu     sync.Mutex
+	chunks map[fileChunksKey]fileChunksEntry
+}
+
+// fileChunksKey identifies the chunks of a file for a chunk size.
+type fileChunksKey struct {
+	path      string
+	maxTokens int
+}
+
+// fileChunksEntry represents the chunk boundaries of a file. The size and
+// modification time are checked before the entry is used so edits are never
+// hidden.
+type fileChunksEntry struct {
+	size    int64
+	modTime time.Time
+	chunks  []fileChunk // Without the content, it's sliced from the file.
+}
+
+// RegisterFileChunks creates a new instance of the FileChunks tool and loads
+// it into the provided tools map.
+func RegisterFileChunks(tools map[string]Tool, tke *tiktoken.Tiktoken) client.D {
+	fc := FileChunks{
+		name:   "tool_file_chunks",
+		tke:    tke,
+		chunks: make(map[fileChunksKey]fileChunksEntry),
+	}
+	tools[fc.name] = &fc
+
+	return fc.toolDocument()
+}
+
+// fileChunksParams represents the parameters for the FileChunks tool.
+type fileChunksParams struct {
+	Path      string `json:"path" description:"The relative path of the file to read."`
+	Cursor    int    `json:"cursor,omitempty" description:"The chunk to read, use the next_cursor value from the previous call. Starts at 0."`
+	MaxTokens int    `json:"max_tokens,omitempty" description:"The maximum number of tokens in a chunk. Defaults to 2000."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (fc *FileChunks) toolDocument() client.D {
+	return client.ToolDocument(fc.name, "Read a large file, like a log or data file, one chunk at a time. Each chunk overlaps the previous one by a few lines. Call again with next_cursor until has_more is false, summarizing as you go.", fileChunksParams{})
+}
+
+// Call is the function that is called by the agent to read a chunk of a file
+// when the model requests the tool with the specified parameters.
+func (fc *FileChunks) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, fc.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params fileChunksParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, fc.name, err)
+	}
+
+	maxTokens := fileChunkTokens
+	if params.MaxTokens > 0 {
+		maxTokens = min(params.MaxTokens, fileChunkMaxTokens)
+	}
+
+	if params.Cursor < 0 {
+		return toolErrorResponse(toolCall.ID, fc.name, fmt.Errorf("cursor must be 0 or greater"))
+	}
+
+	path, err := resolvePath(ctx, params.Path)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, fc.name, err)
+	}
+
+	chunks, content, err := fc.load(path, maxTokens)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, fc.name, err)
+	}
+
+	if params.Cursor >= len(chunks) {
+		return toolErrorResponse(toolCall.ID, fc.name, fmt.Errorf("cursor %d is past the end of the file", params.Cursor))
+	}
+
+	chunk := chunks[params.Cursor]
+	chunk.Content = string(content[chunk.Start:chunk.End])
+
+	hasMore := params.Cursor < len(chunks)-1
+
+	nextCursor := -1
+	if hasMore {
+		nextCursor = chunk.Index + 1
+	}
+
+	return toolSuccessResponse(toolCall.ID, fc.name, ToolData{
+		"chunk":       chunk.Content,
+		"cursor":      chunk.Index,
+		"next_cursor": nextCursor,
+		"has_more":    hasMore,
+		"start_line":  chunk.StartLine,
+		"end_line":    chunk.EndLine,
+	})
+}
+
+// load reads the file and returns its chunk boundaries, from the cache when
+// the file hasn't changed since it was split.
+func (fc *FileChunks) load(path string, maxTokens int) ([]fileChunk, []byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := fileChunksKey{path: path, maxTokens: maxTokens}
+
+	fc.mu.Lock()
+	entry, exists := fc.chunks[key]
+	fc.mu.Unlock()
+
+	if exists && entry.size == info.Size() && entry.modTime.Equal(info.ModTime()) && entry.size == int64(len(content)) {
+		return entry.chunks, content, nil
+	}
+
+	var chunks []fileChunk
+	for c := range fileChunks(string(content), maxTokens, fileChunkOverlapTokens, fc.tke.TokenCount) {
+		c.Content = ""
+		chunks = append(chunks, c)
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	// The cache is small, an arbitrary file makes room for the new one.
+	if len(fc.chunks) >= fileChunkCachedFiles {
+		for k := range fc.chunks {
+			delete(fc.chunks, k)
+			break
+		}
+	}
+
+	fc.chunks[key] = fileChunksEntry{
+		size:    info.Size(),
+		modTime: info.ModTime(),
+		chunks:  chunks,
+	}
+
+	return chunks, content, nil
+}
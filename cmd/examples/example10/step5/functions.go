@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"go/format"
@@ -18,51 +17,6 @@ import (
 	"github.com/ardanlabs/ai-training/foundation/client"
 )
 
-// toolSuccessResponse returns a successful structured tool response.
-func toolSuccessResponse(toolID string, toolName string, keyValues ...any) client.D {
-	data := make(map[string]any)
-	for i := 0; i < len(keyValues); i = i + 2 {
-		data[keyValues[i].(string)] = keyValues[i+1]
-	}
-
-	return toolResponse(toolID, toolName, data, "SUCCESS")
-}
-
-// toolErrorResponse returns a failed structured tool response.
-func toolErrorResponse(toolID string, toolName string, err error) client.D {
-	data := map[string]any{"error": err.Error()}
-
-	return toolResponse(toolID, toolName, data, "FAILED")
-}
-
-// toolResponse creates a structured tool response.
-func toolResponse(toolID string, toolName string, data map[string]any, status string) client.D {
-	info := struct {
-		Status string         `json:"status"`
-		Data   map[string]any `json:"data"`
-	}{
-		Status: status,
-		Data:   data,
-	}
-
-	content, err := json.Marshal(info)
-	if err != nil {
-		return client.D{
-			"role":         "tool",
-			"tool_call_id": toolID,
-			"tool_name":    toolName,
-			"content":      `{"status": "FAILED", "data": "error marshaling tool response"}`,
-		}
-	}
-
-	return client.D{
-		"role":         "tool",
-		"tool_call_id": toolID,
-		"tool_name":    toolName,
-		"content":      string(content),
-	}
-}
-
 // =============================================================================
 // ReadFile Tool
 
@@ -82,25 +36,14 @@ func RegisterReadFile(tools map[string]Tool) client.D {
 	return rf.toolDocument()
 }
 
-// ToolDocument defines the metadata for the tool that is provied to the model.
+// readFileParams represents the parameters for the ReadFile tool.
+type readFileParams struct {
+	Path string `json:"path" description:"The relative path of a file in the working directory. If pattern is provided, this can be a directory path to search in."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
 func (rf *ReadFile) toolDocument() client.D {
-	return client.D{
-		"type": "function",
-		"function": client.D{
-			"name":        rf.name,
-			"description": "Read the contents of a given file path or search for files containing a pattern. When searching file contents, returns line numbers where the pattern is found.",
-			"parameters": client.D{
-				"type": "object",
-				"properties": client.D{
-					"path": client.D{
-						"type":        "string",
-						"description": "The relative path of a file in the working directory. If pattern is provided, this can be a directory path to search in.",
-					},
-				},
-				"required": []string{"path"},
-			},
-		},
-	}
+	return client.ToolDocument(rf.name, "Read the contents of a given file path or search for files containing a pattern. When searching file contents, returns line numbers where the pattern is found.", readFileParams{})
 }
 
 // Call is the function that is called by the agent to read the contents of a
@@ -112,9 +55,19 @@ func (rf *ReadFile) Call(ctx context.Context, toolCall client.ToolCall) (resp cl
 		}
 	}()
 
+	var params readFileParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, rf.name, err)
+	}
+
 	dir := "."
-	if toolCall.Function.Arguments["path"] != "" {
-		dir = toolCall.Function.Arguments["path"].(string)
+	if params.Path != "" {
+		dir = params.Path
+	}
+
+	dir, err := resolvePath(ctx, dir)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, rf.name, err)
 	}
 
 	content, err := os.ReadFile(dir)
@@ -122,7 +75,7 @@ func (rf *ReadFile) Call(ctx context.Context, toolCall client.ToolCall) (resp cl
 		return toolErrorResponse(toolCall.ID, rf.name, err)
 	}
 
-	return toolSuccessResponse(toolCall.ID, rf.name, "file_contents", string(content))
+	return toolSuccessResponse(toolCall.ID, rf.name, ToolData{"file_contents": string(content)})
 }
 
 // =============================================================================
@@ -144,33 +97,16 @@ func RegisterSearchFiles(tools map[string]Tool) client.D {
 	return sf.toolDocument()
 }
 
+// searchFilesParams represents the parameters for the SearchFiles tool.
+type searchFilesParams struct {
+	Path     string `json:"path" description:"Relative path to search files from. Defaults to current directory if not provided."`
+	Filter   string `json:"filter,omitempty" description:"The filter to apply to the file names. It supports golang regex syntax. If not provided, will filtering with take place. If provided, only return files that match the filter."`
+	Contains string `json:"contains,omitempty" description:"A string to search for inside files. It supports golang regex syntax. If not provided, no search will be performed. If provided, only return files that contain the string."`
+}
+
 // toolDocument defines the metadata for the tool that is provied to the model.
 func (sf *SearchFiles) toolDocument() client.D {
-	return client.D{
-		"type": "function",
-		"function": client.D{
-			"name":        sf.name,
-			"description": "Search a directory at a given path for files that match a given file name or contain a given string. If no path is provided, search files will look in the current directory.",
-			"parameters": client.D{
-				"type": "object",
-				"properties": client.D{
-					"path": client.D{
-						"type":        "string",
-						"description": "Relative path to search files from. Defaults to current directory if not provided.",
-					},
-					"filter": client.D{
-						"type":        "string",
-						"description": "The filter to apply to the file names. It supports golang regex syntax. If not provided, will filtering with take place. If provided, only return files that match the filter.",
-					},
-					"contains": client.D{
-						"type":        "string",
-						"description": "A string to search for inside files. It supports golang regex syntax. If not provided, no search will be performed. If provided, only return files that contain the string.",
-					},
-				},
-				"required": []string{"path"},
-			},
-		},
-	}
+	return client.ToolDocument(sf.name, "Search a directory at a given path for files that match a given file name or contain a given string. If no path is provided, search files will look in the current directory. Files ignored by the .gitignore and .agentignore files are skipped.", searchFilesParams{})
 }
 
 // Call is the function that is called by the agent to list files when the model
@@ -182,23 +118,37 @@ func (sf *SearchFiles) Call(ctx context.Context, toolCall client.ToolCall) (resp
 		}
 	}()
 
+	var params searchFilesParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, sf.name, err)
+	}
+
 	dir := "."
-	if v, exists := toolCall.Function.Arguments["path"]; exists && v != "" {
-		dir = v.(string)
+	if params.Path != "" {
+		dir = params.Path
 	}
 
-	filter := ""
-	if v, exists := toolCall.Function.Arguments["filter"]; exists {
-		filter = v.(string)
+	full, err := resolvePath(ctx, dir)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, sf.name, err)
 	}
 
-	contains := ""
-	if v, exists := toolCall.Function.Arguments["contains"]; exists {
-		contains = v.(string)
+	// The ignore rules match the paths relative to the workspace.
+	root := workspaceDir(ctx)
+	if root != "" {
+		if dir, err = filepath.Rel(root, full); err != nil {
+			return toolErrorResponse(toolCall.ID, sf.name, err)
+		}
 	}
 
+	filter := params.Filter
+	contains := params.Contains
+
+	// The project's .gitignore and .agentignore files decide what is hidden.
+	ignore := newIgnoreRules(root, dir)
+
 	var files []string
-	err := filepath.WalkDir(dir, func(path string, info fs.DirEntry, err error) error {
+	err = filepath.WalkDir(full, func(path string, info fs.DirEntry, err error) error {
 		if err != nil {
 			if errors.Is(err, filepath.SkipDir) {
 				return nil
@@ -206,26 +156,24 @@ func (sf *SearchFiles) Call(ctx context.Context, toolCall client.ToolCall) (resp
 			return err
 		}
 
-		relPath, err := filepath.Rel(dir, path)
+		relPath, err := filepath.Rel(full, path)
 		if err != nil {
 			return err
 		}
 
-		if strings.Contains(relPath, "zarf") ||
-			strings.Contains(relPath, "vendor") ||
-			strings.Contains(relPath, ".venv") ||
-			strings.Contains(relPath, ".idea") ||
-			strings.Contains(relPath, ".vscode") ||
-			strings.Contains(relPath, "libw2v") ||
-			strings.Contains(relPath, ".git") {
+		if relPath == "." {
+			return nil
+		}
+
+		if ignore.ignored(filepath.Join(dir, relPath), info.IsDir()) {
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		if relPath == "." {
-			return nil
+		if info.IsDir() {
+			ignore.load(filepath.Join(dir, relPath))
 		}
 
 		if filter != "" {
@@ -235,7 +183,7 @@ func (sf *SearchFiles) Call(ctx context.Context, toolCall client.ToolCall) (resp
 		}
 
 		if contains != "" {
-			content, err := os.ReadFile(relPath)
+			content, err := os.ReadFile(path)
 			if err != nil {
 				return nil
 			}
@@ -260,7 +208,7 @@ func (sf *SearchFiles) Call(ctx context.Context, toolCall client.ToolCall) (resp
 		return toolErrorResponse(toolCall.ID, sf.name, err)
 	}
 
-	return toolSuccessResponse(toolCall.ID, sf.name, "files", files)
+	return toolSuccessResponse(toolCall.ID, sf.name, ToolData{"files": files})
 }
 
 // =============================================================================
@@ -282,25 +230,20 @@ func RegisterCreateFile(tools map[string]Tool) client.D {
 	return cf.toolDocument()
 }
 
+// createFileParams represents the parameters for the CreateFile tool.
+type createFileParams struct {
+	Path string `json:"path" description:"Relative path and name of the file to create."`
+}
+
 // toolDocument defines the metadata for the tool that is provied to the model.
 func (cf *CreateFile) toolDocument() client.D {
-	return client.D{
-		"type": "function",
-		"function": client.D{
-			"name":        cf.name,
-			"description": "Creates a new file",
-			"parameters": client.D{
-				"type": "object",
-				"properties": client.D{
-					"path": client.D{
-						"type":        "string",
-						"description": "Relative path and name of the file to create.",
-					},
-				},
-				"required": []string{"path"},
-			},
-		},
-	}
+	return client.ToolDocument(cf.name, "Creates a new file", createFileParams{})
+}
+
+// modifiedPaths returns the file the tool call will create.
+func (cf *CreateFile) modifiedPaths(toolCall client.ToolCall) []string {
+	path, _ := toolCall.Function.Arguments["path"].(string)
+	return []string{path}
 }
 
 // Call is the function that is called by the agent to create a file when the model
@@ -312,7 +255,15 @@ func (cf *CreateFile) Call(ctx context.Context, toolCall client.ToolCall) (resp
 		}
 	}()
 
-	filePath := toolCall.Function.Arguments["path"].(string)
+	var params createFileParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, cf.name, err)
+	}
+
+	filePath, err := resolvePath(ctx, params.Path)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, cf.name, err)
+	}
 
 	if _, err := os.Stat(filePath); !os.IsNotExist(err) {
 		return toolErrorResponse(toolCall.ID, cf.name, errors.New("file already exists"))
@@ -329,7 +280,7 @@ func (cf *CreateFile) Call(ctx context.Context, toolCall client.ToolCall) (resp
 	}
 	f.Close()
 
-	return toolSuccessResponse(toolCall.ID, cf.name, "status", "SUCCESS")
+	return toolSuccessResponse(toolCall.ID, cf.name, ToolData{"status": "SUCCESS"})
 }
 
 // =============================================================================
@@ -351,37 +302,23 @@ func RegisterGoCodeEditor(tools map[string]Tool) client.D {
 	return gce.toolDocument()
 }
 
+// goCodeEditorParams represents the parameters for the GoCodeEditor tool.
+type goCodeEditorParams struct {
+	Path       string `json:"path" description:"Relative path and name of the Golang file"`
+	LineNumber int    `json:"line_number" description:"The line number for the code change"`
+	TypeChange string `json:"type_change" description:"The type of change to make: add, replace, delete" enum:"add,replace,delete"`
+	LineChange string `json:"line_change" description:"The text to add, replace, delete"`
+}
+
 // toolDocument defines the metadata for the tool that is provied to the model.
 func (gce *GoCodeEditor) toolDocument() client.D {
-	return client.D{
-		"type": "function",
-		"function": client.D{
-			"name":        gce.name,
-			"description": "Edit Golang source code files including adding, replacing, and deleting lines.",
-			"parameters": client.D{
-				"type": "object",
-				"properties": client.D{
-					"path": client.D{
-						"type":        "string",
-						"description": "Relative path and name of the Golang file",
-					},
-					"line_number": client.D{
-						"type":        "integer",
-						"description": "The line number for the code change",
-					},
-					"type_change": client.D{
-						"type":        "string",
-						"description": "The type of change to make: add, replace, delete",
-					},
-					"line_change": client.D{
-						"type":        "string",
-						"description": "The text to add, replace, delete",
-					},
-				},
-				"required": []string{"path", "line_number", "type_change", "line_change"},
-			},
-		},
-	}
+	return client.ToolDocument(gce.name, "Edit Golang source code files including adding, replacing, and deleting lines.", goCodeEditorParams{})
+}
+
+// modifiedPaths returns the file the tool call will edit.
+func (gce *GoCodeEditor) modifiedPaths(toolCall client.ToolCall) []string {
+	path, _ := toolCall.Function.Arguments["path"].(string)
+	return []string{path}
 }
 
 // Call is the function that is called by the agent to edit a file when the model
@@ -393,12 +330,22 @@ func (gce *GoCodeEditor) Call(ctx context.Context, toolCall client.ToolCall) (re
 		}
 	}()
 
-	path := toolCall.Function.Arguments["path"].(string)
-	lineNumber := int(toolCall.Function.Arguments["line_number"].(float64))
-	typeChange := strings.TrimSpace(toolCall.Function.Arguments["type_change"].(string))
-	lineChange := strings.TrimSpace(toolCall.Function.Arguments["line_change"].(string))
+	var params goCodeEditorParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, gce.name, err)
+	}
+
+	path := params.Path
+	lineNumber := params.LineNumber
+	typeChange := strings.TrimSpace(params.TypeChange)
+	lineChange := strings.TrimSpace(params.LineChange)
+
+	file, err := resolvePath(ctx, path)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gce.name, err)
+	}
 
-	content, err := os.ReadFile(path)
+	content, err := os.ReadFile(file)
 	if err != nil {
 		return toolErrorResponse(toolCall.ID, gce.name, err)
 	}
@@ -410,26 +357,9 @@ func (gce *GoCodeEditor) Call(ctx context.Context, toolCall client.ToolCall) (re
 		return toolErrorResponse(toolCall.ID, gce.name, fmt.Errorf("line number %d is out of range (1-%d)", lineNumber, len(lines)))
 	}
 
-	switch typeChange {
-	case "add":
-		newLines := make([]string, 0, len(lines)+1)
-		newLines = append(newLines, lines[:lineNumber-1]...)
-		newLines = append(newLines, lineChange)
-		newLines = append(newLines, lines[lineNumber-1:]...)
-		lines = newLines
-
-	case "replace":
-		lines[lineNumber-1] = lineChange
-
-	case "delete":
-		if len(lines) == 1 {
-			lines = []string{""}
-		} else {
-			lines = append(lines[:lineNumber-1], lines[lineNumber:]...)
-		}
-
-	default:
-		return toolErrorResponse(toolCall.ID, gce.name, fmt.Errorf("unsupported change type: %s, please inform the user", typeChange))
+	lines, err = editLines(lines, lineNumber, typeChange, lineChange)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gce.name, err)
 	}
 
 	modifiedContent := strings.Join(lines, "\n")
@@ -444,20 +374,50 @@ func (gce *GoCodeEditor) Call(ctx context.Context, toolCall client.ToolCall) (re
 		formattedContent = []byte(modifiedContent)
 	}
 
-	err = os.WriteFile(path, formattedContent, 0644)
+	err = os.WriteFile(file, formattedContent, 0644)
 	if err != nil {
 		return toolErrorResponse(toolCall.ID, gce.name, fmt.Errorf("write file: %s", err))
 	}
 
-	var action string
+	// The model gets a compact diff so it can verify its own change, the
+	// renderer shows the same diff to the user.
+	diff := unifiedDiff(path, string(content), string(formattedContent))
+
+	return toolSuccessResponse(toolCall.ID, gce.name, ToolData{"message": editAction(lineNumber, typeChange), "diff": compactDiff(diff)})
+}
+
+// editLines applies a single line change to the lines of a file.
+func editLines(lines []string, lineNumber int, typeChange string, lineChange string) ([]string, error) {
 	switch typeChange {
 	case "add":
-		action = fmt.Sprintf("Added line at position %d", lineNumber)
+		newLines := make([]string, 0, len(lines)+1)
+		newLines = append(newLines, lines[:lineNumber-1]...)
+		newLines = append(newLines, lineChange)
+		newLines = append(newLines, lines[lineNumber-1:]...)
+		return newLines, nil
+
 	case "replace":
-		action = fmt.Sprintf("Replaced line %d", lineNumber)
+		lines[lineNumber-1] = lineChange
+		return lines, nil
+
 	case "delete":
-		action = fmt.Sprintf("Deleted line %d", lineNumber)
+		if len(lines) == 1 {
+			return []string{""}, nil
+		}
+		return append(lines[:lineNumber-1], lines[lineNumber:]...), nil
+	}
+
+	return nil, fmt.Errorf("unsupported change type: %s, please inform the user", typeChange)
+}
+
+// editAction describes the line change for the model.
+func editAction(lineNumber int, typeChange string) string {
+	switch typeChange {
+	case "add":
+		return fmt.Sprintf("Added line at position %d", lineNumber)
+	case "replace":
+		return fmt.Sprintf("Replaced line %d", lineNumber)
 	}
 
-	return toolSuccessResponse(toolCall.ID, gce.name, "message", action)
+	return fmt.Sprintf("Deleted line %d", lineNumber)
 }
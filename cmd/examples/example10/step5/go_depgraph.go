@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"golang.org/x/tools/go/packages"
+)
+
+// Limits applied to the graph so a large workspace can't flood the context
+// window.
+const goDepGraphMaxEdges = 500
+
+// =============================================================================
+// GoDepGraph Tool
+
+// GoDepGraph represents a tool that reports how the Go packages of the
+// workspace import each other. Architecture questions, like what depends on a
+// package, are answered without reading every file.
+type GoDepGraph struct {
+	name string
+}
+
+// RegisterGoDepGraph creates a new instance of the GoDepGraph tool and loads
+// it into the provided tools map.
+func RegisterGoDepGraph(tools map[string]Tool) client.D {
+	dg := GoDepGraph{
+		name: "tool_go_depgraph",
+	}
+	tools[dg.name] = &dg
+
+	return dg.toolDocument()
+}
+
+// goDepGraphParams represents the parameters for the GoDepGraph tool.
+type goDepGraphParams struct {
+	Action     string `json:"action" description:"imports for the packages a package uses, importers for the packages that use a package, graph for every import between the packages of the workspace." enum:"imports,importers,graph"`
+	Package    string `json:"package,omitempty" description:"The package for imports and importers, by import path or path in the workspace like foundation/client."`
+	Transitive bool   `json:"transitive,omitempty" description:"Follow the imports through other packages instead of reporting the direct ones only."`
+	External   bool   `json:"external,omitempty" description:"Include the packages from outside the workspace, like the standard library."`
+	Format     string `json:"format,omitempty" description:"list for a list of edges, dot to also render the graph in the Graphviz DOT language." enum:"list,dot"`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (dg *GoDepGraph) toolDocument() client.D {
+	return client.ToolDocument(dg.name, "Report the import relationships of the Go packages in the workspace: what a package imports, what depends on it, or the whole graph, optionally rendered as Graphviz DOT.", goDepGraphParams{})
+}
+
+// Call is the function that is called by the agent to report the imports
+// when the model requests the tool with the specified parameters.
+func (dg *GoDepGraph) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, dg.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params goDepGraphParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, dg.name, err)
+	}
+
+	if params.Format != "" && params.Format != "list" && params.Format != "dot" {
+		return toolErrorResponse(toolCall.ID, dg.name, fmt.Errorf("unsupported format %q, use list or dot", params.Format))
+	}
+
+	graph, err := loadDepGraph(ctx, params.External)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, dg.name, err)
+	}
+
+	var edges [][2]string
+	data := ToolData{"action": params.Action}
+
+	switch params.Action {
+	case "imports", "importers":
+		if params.Package == "" {
+			return toolErrorResponse(toolCall.ID, dg.name, fmt.Errorf("package is required for %s", params.Action))
+		}
+
+		pkg, err := graph.resolve(params.Package)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, dg.name, err)
+		}
+
+		next := graph.imports
+		if params.Action == "importers" {
+			next = graph.importers
+		}
+
+		var related []string
+		related, edges = graph.walk(pkg, next, params.Transitive)
+
+		// The edges of the importers point to the package.
+		if params.Action == "importers" {
+			for i, e := range edges {
+				edges[i] = [2]string{e[1], e[0]}
+			}
+		}
+
+		data["package"] = pkg
+		data["transitive"] = params.Transitive
+		data[params.Action] = related
+		data["count"] = len(related)
+
+	case "graph":
+		for _, from := range graph.packages {
+			for _, to := range graph.imports[from] {
+				edges = append(edges, [2]string{from, to})
+			}
+		}
+		data["module"] = graph.module
+		data["packages"] = len(graph.packages)
+
+	default:
+		return toolErrorResponse(toolCall.ID, dg.name, fmt.Errorf("unsupported action %q, use imports, importers or graph", params.Action))
+	}
+
+	truncated := len(edges) > goDepGraphMaxEdges
+	if truncated {
+		edges = edges[:goDepGraphMaxEdges]
+	}
+
+	list := make([]map[string]string, len(edges))
+	for i, e := range edges {
+		list[i] = map[string]string{"from": graph.short(e[0]), "to": graph.short(e[1])}
+	}
+	data["edges"] = list
+	data["truncated"] = truncated
+
+	if params.Format == "dot" {
+		data["dot"] = graph.dot(edges)
+	}
+
+	return toolSuccessResponse(toolCall.ID, dg.name, data)
+}
+
+// =============================================================================
+
+// depGraph represents the imports between the packages of the workspace.
+type depGraph struct {
+	module    string
+	packages  []string // Packages of the workspace, sorted.
+	imports   map[string][]string
+	importers map[string][]string
+}
+
+// loadDepGraph loads the packages of the workspace and their imports. Only
+// the names and imports are loaded, which is fast. The packages from outside
+// the workspace are only included when external is set.
+func loadDepGraph(ctx context.Context, external bool) (*depGraph, error) {
+	root, err := workingDir(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getwd: %w", err)
+	}
+
+	cfg := packages.Config{
+		Context: ctx,
+		Dir:     root,
+		Mode:    packages.NeedName | packages.NeedImports | packages.NeedModule,
+	}
+
+	pkgs, err := packages.Load(&cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("load packages: %w", err)
+	}
+
+	g := depGraph{
+		imports:   make(map[string][]string),
+		importers: make(map[string][]string),
+	}
+
+	workspace := make(map[string]bool, len(pkgs))
+	for _, pkg := range pkgs {
+		workspace[pkg.PkgPath] = true
+		if pkg.Module != nil && g.module == "" {
+			g.module = pkg.Module.Path
+		}
+	}
+
+	for _, pkg := range pkgs {
+		g.packages = append(g.packages, pkg.PkgPath)
+
+		for path := range pkg.Imports {
+			if !workspace[path] && !external {
+				continue
+			}
+			g.imports[pkg.PkgPath] = append(g.imports[pkg.PkgPath], path)
+			g.importers[path] = append(g.importers[path], pkg.PkgPath)
+		}
+	}
+
+	slices.Sort(g.packages)
+	for _, m := range []map[string][]string{g.imports, g.importers} {
+		for _, paths := range m {
+			slices.Sort(paths)
+		}
+	}
+
+	return &g, nil
+}
+
+// resolve returns the import path of the package of the workspace the model
+// named, by import path or by its path in the workspace.
+func (g *depGraph) resolve(name string) (string, error) {
+	name = strings.Trim(strings.TrimPrefix(name, "./"), "/")
+
+	var matches []string
+	for _, path := range g.packages {
+		switch {
+		case path == name:
+			return path, nil
+		case strings.HasSuffix(path, "/"+name):
+			matches = append(matches, path)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("package %q is not in the workspace", name)
+	case 1:
+		return matches[0], nil
+	}
+
+	return "", fmt.Errorf("package %q matches %s, use the import path", name, strings.Join(matches, ", "))
+}
+
+// walk returns the packages reached from the package by following next, one
+// step or all of them when transitive, and the edges that were followed.
+func (g *depGraph) walk(pkg string, next map[string][]string, transitive bool) ([]string, [][2]string) {
+	related := []string{}
+	var edges [][2]string
+
+	seen := map[string]bool{pkg: true}
+	queue := []string{pkg}
+
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+
+		for _, to := range next[from] {
+			edges = append(edges, [2]string{from, to})
+			if seen[to] {
+				continue
+			}
+			seen[to] = true
+			related = append(related, to)
+
+			if transitive {
+				queue = append(queue, to)
+			}
+		}
+	}
+
+	slices.Sort(related)
+
+	return related, edges
+}
+
+// short returns the import path without the module so the paths of the
+// workspace read like its directories.
+func (g *depGraph) short(path string) string {
+	if g.module == "" {
+		return path
+	}
+
+	if rest, found := strings.CutPrefix(path, g.module+"/"); found {
+		return rest
+	}
+
+	return path
+}
+
+// dot renders the edges in the Graphviz DOT language.
+func (g *depGraph) dot(edges [][2]string) string {
+	var b strings.Builder
+
+	b.WriteString("digraph deps {\n\trankdir=LR;\n\tnode [shape=box];\n")
+	for _, e := range edges {
+		fmt.Fprintf(&b, "\t%q -> %q;\n", g.short(e[0]), g.short(e[1]))
+	}
+	b.WriteString("}\n")
+
+	return b.String()
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Limits applied to every go command the model runs so a slow proxy can't
+// hang the agent and a noisy command can't flood the context window.
+const (
+	goModTimeout   = 2 * time.Minute
+	goModMaxOutput = 16 * 1024
+)
+
+// =============================================================================
+// GoMod Tool
+
+// GoMod represents a tool that can be used to manage the dependencies of the
+// Go module in the workspace. Adding and tidying dependencies is left to the
+// go command, since go.mod and go.sum are protected from the file tools, and
+// needs the user's confirmation.
+type GoMod struct {
+	name string
+}
+
+// RegisterGoMod creates a new instance of the GoMod tool and loads it into
+// the provided tools map.
+func RegisterGoMod(tools map[string]Tool) client.D {
+	gm := GoMod{
+		name: "tool_go_mod",
+	}
+	tools[gm.name] = &gm
+
+	return gm.toolDocument()
+}
+
+// goModParams represents the parameters for the GoMod tool.
+type goModParams struct {
+	Action  string   `json:"action" description:"list to list the requirements in go.mod, get to add or upgrade modules with go get, tidy to run go mod tidy." enum:"list,get,tidy"`
+	Modules []string `json:"modules,omitempty" description:"The modules for get, like github.com/google/uuid or github.com/google/uuid@v1.6.0."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (gm *GoMod) toolDocument() client.D {
+	return client.ToolDocument(gm.name, "Manage the dependencies of the Go module in the workspace. Use get to add the modules imported by new code so it compiles, tidy to clean up go.mod and go.sum, and list to see the current requirements. The user is asked to confirm get and tidy.", goModParams{})
+}
+
+// command returns the go command for the action. Listing the requirements
+// doesn't change anything so it has no confirmation.
+func (gm *GoMod) command(toolCall client.ToolCall) ([]string, error) {
+	var params goModParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	switch params.Action {
+	case "list":
+		return []string{"mod", "edit", "-json"}, nil
+
+	case "get":
+		if len(params.Modules) == 0 {
+			return nil, fmt.Errorf("modules is required for get")
+		}
+
+		// Don't let the model sneak flags into the command.
+		for _, m := range params.Modules {
+			if m == "" || strings.HasPrefix(m, "-") || strings.ContainsAny(m, " \t\n") {
+				return nil, fmt.Errorf("invalid module %q", m)
+			}
+		}
+
+		return append([]string{"get"}, params.Modules...), nil
+
+	case "tidy":
+		return []string{"mod", "tidy"}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported action %q, use list, get or tidy", params.Action)
+}
+
+// confirmation describes the command the user has to approve.
+func (gm *GoMod) confirmation(toolCall client.ToolCall) (string, bool) {
+	args, err := gm.command(toolCall)
+	if err != nil || args[0] == "mod" && args[1] == "edit" {
+		return "", false
+	}
+
+	return "run go " + strings.Join(args, " "), true
+}
+
+// mutation describes the command that would change go.mod and go.sum.
+func (gm *GoMod) mutation(toolCall client.ToolCall) (string, bool) {
+	cmd, ok := gm.confirmation(toolCall)
+	if !ok {
+		return "", false
+	}
+
+	return "would have " + cmd, true
+}
+
+// commandLine returns the go command the call runs.
+func (gm *GoMod) commandLine(toolCall client.ToolCall) (string, bool) {
+	args, err := gm.command(toolCall)
+	if err != nil {
+		return "", false
+	}
+
+	return "go " + strings.Join(args, " "), true
+}
+
+// Call is the function that is called by the agent to manage the module's
+// dependencies when the model requests the tool with the specified
+// parameters.
+func (gm *GoMod) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, gm.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	args, err := gm.command(toolCall)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gm.name, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(workspaceDir(ctx), "go.mod")); err != nil {
+		return toolErrorResponse(toolCall.ID, gm.name, fmt.Errorf("no go.mod in the workspace"))
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, goModTimeout)
+	defer cancel()
+
+	out, err := runGo(ctx, args...)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gm.name, err)
+	}
+
+	if args[0] == "mod" && args[1] == "edit" {
+		return gm.list(toolCall, out)
+	}
+
+	// A vendored module doesn't build until the vendor directory matches
+	// the new requirements.
+	if _, err := os.Stat(filepath.Join(workspaceDir(ctx), "vendor", "modules.txt")); err == nil {
+		vout, err := runGo(ctx, "mod", "vendor")
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, gm.name, err)
+		}
+		out = append(out, vout...)
+	}
+
+	return toolSuccessResponse(toolCall.ID, gm.name, ToolData{"command": "go " + strings.Join(args, " "), "output": string(out)})
+}
+
+func (gm *GoMod) list(toolCall client.ToolCall, out []byte) client.D {
+	var mod struct {
+		Module struct {
+			Path string
+		}
+		Go      string
+		Require []struct {
+			Path     string
+			Version  string
+			Indirect bool
+		}
+	}
+
+	if err := json.Unmarshal(out, &mod); err != nil {
+		return toolErrorResponse(toolCall.ID, gm.name, fmt.Errorf("parse go.mod: %w", err))
+	}
+
+	var direct, indirect []string
+	for _, r := range mod.Require {
+		if r.Indirect {
+			indirect = append(indirect, r.Path+" "+r.Version)
+			continue
+		}
+		direct = append(direct, r.Path+" "+r.Version)
+	}
+
+	return toolSuccessResponse(toolCall.ID, gm.name, ToolData{"module": mod.Module.Path, "go": mod.Go, "require": direct, "indirect": indirect})
+}
+
+// runGo runs the go command in the workspace and returns its output. The
+// output is returned in the error when the command fails so the model can
+// see why.
+func runGo(ctx context.Context, args ...string) ([]byte, error) {
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = workspaceDir(ctx)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+
+	b := out.Bytes()
+	if len(b) > goModMaxOutput {
+		b = append(b[:goModMaxOutput:goModMaxOutput], "\n... output truncated"...)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("go %s: %w: %s", strings.Join(args, " "), err, bytes.TrimSpace(b))
+	}
+
+	return b, nil
+}
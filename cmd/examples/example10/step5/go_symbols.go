@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"golang.org/x/tools/go/packages"
+)
+
+// Limits applied to the symbol lookups so a common name can't flood the
+// context window.
+const goSymbolsMaxResults = 100
+
+// =============================================================================
+// GoSymbols Tool
+
+// GoSymbols represents a tool that indexes the Go packages in the workspace
+// and answers where a symbol is defined and where it's used. This is far
+// cheaper in tokens than having the model search and read files.
+type GoSymbols struct {
+	name string
+
+	mu       sync.Mutex
+	root     string
+	pkgs     []*packages.Package
+	loadedAt time.Time
+}
+
+// RegisterGoSymbols creates a new instance of the GoSymbols tool and loads it
+// into the provided tools map.
+func RegisterGoSymbols(tools map[string]Tool) client.D {
+	gs := GoSymbols{
+		name: "tool_go_symbols",
+	}
+	tools[gs.name] = &gs
+
+	return gs.toolDocument()
+}
+
+// goSymbolsParams represents the parameters for the GoSymbols tool.
+type goSymbolsParams struct {
+	Action string `json:"action" description:"definition to find where the symbol is declared, references to find where it's used and which functions use it." enum:"definition,references"`
+	Symbol string `json:"symbol" description:"The symbol to look up: Name, Type.Method, pkg.Name or pkg.Type.Method."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (gs *GoSymbols) toolDocument() client.D {
+	return client.ToolDocument(gs.name, "Finds where a Go function, type, method, variable or constant is defined and who uses or calls it in the workspace, returning file and line results.", goSymbolsParams{})
+}
+
+// Call is the function that is called by the agent to look up a symbol when
+// the model requests the tool with the specified parameters.
+func (gs *GoSymbols) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, gs.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params goSymbolsParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, gs.name, err)
+	}
+
+	if params.Symbol == "" {
+		return toolErrorResponse(toolCall.ID, gs.name, fmt.Errorf("symbol is required"))
+	}
+
+	pkgs, err := gs.packages(ctx)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gs.name, err)
+	}
+
+	defs := gs.definitions(pkgs, params.Symbol)
+	if len(defs) == 0 {
+		return toolErrorResponse(toolCall.ID, gs.name, fmt.Errorf("symbol %q is not defined in the workspace", params.Symbol))
+	}
+
+	switch params.Action {
+	case "definition":
+		var results []map[string]any
+		for _, def := range defs {
+			results = append(results, map[string]any{
+				"symbol":      def.key,
+				"kind":        objectKind(def.obj),
+				"declaration": types.ObjectString(def.obj, types.RelativeTo(def.obj.Pkg())),
+				"file":        def.pos.file,
+				"line":        def.pos.line,
+			})
+		}
+		return toolSuccessResponse(toolCall.ID, gs.name, ToolData{"definitions": results})
+
+	case "references":
+		keys := make(map[string]bool)
+		for _, def := range defs {
+			keys[def.key] = true
+		}
+
+		refs, truncated := gs.references(pkgs, keys)
+		return toolSuccessResponse(toolCall.ID, gs.name, ToolData{"references": refs, "count": len(refs), "truncated": truncated})
+	}
+
+	return toolErrorResponse(toolCall.ID, gs.name, fmt.Errorf("unsupported action %q, use definition or references", params.Action))
+}
+
+// =============================================================================
+
+// packages returns the type checked packages of the workspace. The first
+// call type checks the workspace and its dependencies which takes a few
+// seconds. The packages are loaded again when a Go file changed since they
+// were loaded.
+func (gs *GoSymbols) packages(ctx context.Context) ([]*packages.Package, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	root, err := workingDir(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getwd: %w", err)
+	}
+
+	if gs.pkgs != nil && gs.root == root && !goFilesChangedSince(root, gs.loadedAt) {
+		return gs.pkgs, nil
+	}
+
+	cfg := packages.Config{
+		Context: ctx,
+		Dir:     root,
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo,
+	}
+
+	loadedAt := time.Now()
+
+	pkgs, err := packages.Load(&cfg, "./...")
+	if err != nil {
+		return nil, fmt.Errorf("load packages: %w", err)
+	}
+
+	gs.root = root
+	gs.pkgs = pkgs
+	gs.loadedAt = loadedAt
+
+	return pkgs, nil
+}
+
+// goFilesChangedSince reports whether a Go file in the tree was modified after
+// the specified time.
+func goFilesChangedSince(root string, since time.Time) bool {
+	changed := false
+
+	filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		switch {
+		case changed:
+			return filepath.SkipAll
+		case err != nil:
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != root && slices.Contains(watchSkipDirs, d.Name()) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if filepath.Ext(path) != ".go" {
+			return nil
+		}
+
+		if info, err := d.Info(); err == nil && info.ModTime().After(since) {
+			changed = true
+		}
+
+		return nil
+	})
+
+	return changed
+}
+
+// symbolPos represents a position in a workspace file.
+type symbolPos struct {
+	file string
+	line int
+}
+
+// symbolDef represents a symbol definition that matched a lookup.
+type symbolDef struct {
+	key string
+	obj types.Object
+	pos symbolPos
+}
+
+// definitions returns the package level objects and methods matching the
+// symbol.
+func (gs *GoSymbols) definitions(pkgs []*packages.Package, symbol string) []symbolDef {
+	parts := strings.Split(symbol, ".")
+
+	var defs []symbolDef
+	seen := make(map[string]bool)
+
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+
+		for ident, obj := range pkg.TypesInfo.Defs {
+			if obj == nil || obj.Name() != parts[len(parts)-1] {
+				continue
+			}
+
+			key, ok := objectKey(obj)
+			if !ok || seen[key] || !matchSymbol(key, pkg, parts) {
+				continue
+			}
+			seen[key] = true
+
+			defs = append(defs, symbolDef{
+				key: key,
+				obj: obj,
+				pos: gs.position(pkg.Fset, ident.Pos()),
+			})
+		}
+	}
+
+	slices.SortFunc(defs, func(a, b symbolDef) int {
+		return strings.Compare(a.key, b.key)
+	})
+
+	return defs
+}
+
+// references returns the uses of the symbols with the function each use is
+// in.
+func (gs *GoSymbols) references(pkgs []*packages.Package, keys map[string]bool) ([]map[string]any, bool) {
+	var refs []map[string]any
+
+	for _, pkg := range pkgs {
+		if pkg.TypesInfo == nil {
+			continue
+		}
+
+		for _, file := range pkg.Syntax {
+			ast.Inspect(file, func(n ast.Node) bool {
+				ident, ok := n.(*ast.Ident)
+				if !ok {
+					return true
+				}
+
+				obj := pkg.TypesInfo.Uses[ident]
+				if obj == nil {
+					return true
+				}
+
+				key, ok := objectKey(obj)
+				if !ok || !keys[key] {
+					return true
+				}
+
+				pos := gs.position(pkg.Fset, ident.Pos())
+				refs = append(refs, map[string]any{
+					"symbol": key,
+					"file":   pos.file,
+					"line":   pos.line,
+					"in":     enclosingFunc(file, ident.Pos()),
+				})
+
+				return true
+			})
+		}
+	}
+
+	slices.SortFunc(refs, func(a, b map[string]any) int {
+		if c := strings.Compare(a["file"].(string), b["file"].(string)); c != 0 {
+			return c
+		}
+		return a["line"].(int) - b["line"].(int)
+	})
+
+	if len(refs) > goSymbolsMaxResults {
+		return refs[:goSymbolsMaxResults], true
+	}
+
+	return refs, false
+}
+
+// position returns the position relative to the workspace root.
+func (gs *GoSymbols) position(fset *token.FileSet, pos token.Pos) symbolPos {
+	p := fset.Position(pos)
+
+	file := p.Filename
+	if rel, err := filepath.Rel(gs.root, file); err == nil {
+		file = rel
+	}
+
+	return symbolPos{file: file, line: p.Line}
+}
+
+// =============================================================================
+
+// objectKey returns a unique name for package level objects and methods,
+// like path/to/pkg.Type.Method. It reports false for local objects.
+func objectKey(obj types.Object) (string, bool) {
+	if obj.Pkg() == nil {
+		return "", false
+	}
+
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Signature().Recv(); recv != nil {
+			t := recv.Type()
+			if ptr, ok := t.(*types.Pointer); ok {
+				t = ptr.Elem()
+			}
+			if named, ok := t.(*types.Named); ok {
+				return obj.Pkg().Path() + "." + named.Obj().Name() + "." + obj.Name(), true
+			}
+			return "", false
+		}
+	}
+
+	if obj.Parent() != obj.Pkg().Scope() {
+		return "", false
+	}
+
+	return obj.Pkg().Path() + "." + obj.Name(), true
+}
+
+// matchSymbol reports whether the object key matches the parts of the symbol
+// the model asked for. The package can be given by name or path.
+func matchSymbol(key string, pkg *packages.Package, parts []string) bool {
+	rest := strings.TrimPrefix(key, pkg.PkgPath+".")
+	names := strings.Split(rest, ".")
+
+	switch {
+	case len(parts) <= len(names):
+		return slices.Equal(names[len(names)-len(parts):], parts)
+
+	case len(parts) == len(names)+1:
+		p := parts[0]
+		return (p == pkg.Name || p == pkg.PkgPath || strings.HasSuffix(pkg.PkgPath, "/"+p)) && slices.Equal(names, parts[1:])
+	}
+
+	return false
+}
+
+// objectKind describes the kind of object.
+func objectKind(obj types.Object) string {
+	switch o := obj.(type) {
+	case *types.Func:
+		if o.Signature().Recv() != nil {
+			return "method"
+		}
+		return "func"
+	case *types.TypeName:
+		return "type"
+	case *types.Const:
+		return "const"
+	case *types.Var:
+		return "var"
+	}
+
+	return "symbol"
+}
+
+// enclosingFunc returns the name of the function declaration containing the
+// position, like Type.Method, or an empty string for package level code.
+func enclosingFunc(file *ast.File, pos token.Pos) string {
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || pos < fn.Pos() || pos > fn.End() {
+			continue
+		}
+
+		if fn.Recv == nil || len(fn.Recv.List) == 0 {
+			return fn.Name.Name
+		}
+
+		t := fn.Recv.List[0].Type
+		if star, ok := t.(*ast.StarExpr); ok {
+			t = star.X
+		}
+		if idx, ok := t.(*ast.IndexExpr); ok {
+			t = idx.X
+		}
+		if ident, ok := t.(*ast.Ident); ok {
+			return ident.Name + "." + fn.Name.Name
+		}
+
+		return fn.Name.Name
+	}
+
+	return ""
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/lsp"
+)
+
+// Limits applied to the calls made to gopls. The first call starts gopls
+// and waits for it to load the workspace.
+const (
+	goplsTimeout = 60 * time.Second
+	goplsSettle  = 500 * time.Millisecond
+)
+
+// =============================================================================
+// Gopls Tool
+
+// Gopls represents a tool that gives the model IDE-grade information about
+// the workspace through the gopls language server: the diagnostics of a file,
+// the documentation of the symbol at a position and rename refactoring.
+type Gopls struct {
+	name string
+	root string
+
+	mu      sync.Mutex
+	lsp     *lsp.Client
+	renames map[string]map[string][]lsp.TextEdit
+}
+
+// RegisterGopls creates a new instance of the Gopls tool and loads it into the
+// provided tools map. Gopls works in the root, the workspace of the agent. The
+// tool is only useful when gopls is installed, which is reported by the
+// second return value.
+func RegisterGopls(tools map[string]Tool, root string) (client.D, bool) {
+	if _, err := exec.LookPath("gopls"); err != nil {
+		return nil, false
+	}
+
+	gp := Gopls{
+		name:    "tool_gopls",
+		root:    root,
+		renames: make(map[string]map[string][]lsp.TextEdit),
+	}
+	tools[gp.name] = &gp
+
+	return gp.toolDocument(), true
+}
+
+// goplsParams represents the parameters for the Gopls tool.
+type goplsParams struct {
+	Action  string `json:"action" description:"diagnostics to list the compile errors and vet warnings of a file, hover to get the type and documentation of the symbol at a position, rename to rename the symbol at a position everywhere it's used." enum:"diagnostics,hover,rename"`
+	Path    string `json:"path" description:"Relative path and name of the Go file."`
+	Line    int    `json:"line,omitempty" description:"The line of the symbol for hover and rename, starting at 1."`
+	Column  int    `json:"column,omitempty" description:"The column of the symbol for hover and rename, starting at 1."`
+	NewName string `json:"new_name,omitempty" description:"The new name of the symbol for rename."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (gp *Gopls) toolDocument() client.D {
+	return client.ToolDocument(gp.name, "Uses the gopls language server to get the diagnostics of a Go file, the documentation of the symbol at a position, or to rename a symbol across the workspace.", goplsParams{})
+}
+
+// mutation describes the files a rename will change. The other actions only
+// read the workspace.
+func (gp *Gopls) mutation(toolCall client.ToolCall) (string, bool) {
+	action, _ := toolCall.Function.Arguments["action"].(string)
+	if action != "rename" {
+		return "", false
+	}
+
+	paths := gp.modifiedPaths(toolCall)
+	if len(paths) == 0 {
+		return "would have renamed the symbol", true
+	}
+
+	return "would have renamed the symbol in " + strings.Join(paths, ", "), true
+}
+
+// modifiedPaths returns the files a rename will change. The edits are
+// computed by gopls and kept until the call applies them.
+func (gp *Gopls) modifiedPaths(toolCall client.ToolCall) []string {
+	var params goplsParams
+	if err := toolCall.Function.Decode(&params); err != nil || params.Action != "rename" {
+		return nil
+	}
+
+	path, err := resolveIn(gp.root, params.Path)
+	if err != nil {
+		return nil
+	}
+	params.Path = path
+
+	edits, err := gp.renameEdits(toolCall.ID, params)
+	if err != nil {
+		return nil
+	}
+
+	return slices.Sorted(maps.Keys(edits))
+}
+
+// Call is the function that is called by the agent to use gopls when the
+// model requests the tool with the specified parameters.
+func (gp *Gopls) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, gp.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params goplsParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	path, err := resolveIn(gp.root, params.Path)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+	params.Path = path
+
+	ctx, cancel := context.WithTimeout(ctx, goplsTimeout)
+	defer cancel()
+
+	switch params.Action {
+	case "diagnostics":
+		return gp.diagnostics(ctx, toolCall, params)
+
+	case "hover":
+		return gp.hover(ctx, toolCall, params)
+
+	case "rename":
+		return gp.rename(toolCall, params)
+	}
+
+	return toolErrorResponse(toolCall.ID, gp.name, fmt.Errorf("unsupported action %q, use diagnostics, hover or rename", params.Action))
+}
+
+// Close shuts gopls down.
+func (gp *Gopls) Close() error {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+
+	if gp.lsp == nil {
+		return nil
+	}
+
+	err := gp.lsp.Close()
+	gp.lsp = nil
+
+	return err
+}
+
+// =============================================================================
+
+func (gp *Gopls) diagnostics(ctx context.Context, toolCall client.ToolCall, params goplsParams) client.D {
+	cln, err := gp.client(ctx)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	diags, err := cln.Diagnostics(ctx, params.Path, goplsSettle)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	results := make([]map[string]any, len(diags))
+	for i, d := range diags {
+		results[i] = map[string]any{
+			"line":     d.Range.Start.Line + 1,
+			"column":   d.Range.Start.Character + 1,
+			"severity": d.SeverityName(),
+			"source":   d.Source,
+			"message":  d.Message,
+		}
+	}
+
+	return toolSuccessResponse(toolCall.ID, gp.name, ToolData{"diagnostics": results, "count": len(results)})
+}
+
+func (gp *Gopls) hover(ctx context.Context, toolCall client.ToolCall, params goplsParams) client.D {
+	cln, err := gp.client(ctx)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	if _, err := cln.SyncOpened(""); err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	if _, err := cln.Sync(params.Path); err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	var hover struct {
+		Contents struct {
+			Value string `json:"value"`
+		} `json:"contents"`
+	}
+
+	if err := cln.Call(ctx, "textDocument/hover", positionParams(params), &hover); err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	if hover.Contents.Value == "" {
+		return toolErrorResponse(toolCall.ID, gp.name, fmt.Errorf("no symbol at %s:%d:%d", params.Path, params.Line, params.Column))
+	}
+
+	return toolSuccessResponse(toolCall.ID, gp.name, ToolData{"hover": hover.Contents.Value})
+}
+
+func (gp *Gopls) rename(toolCall client.ToolCall, params goplsParams) client.D {
+	edits, err := gp.renameEdits(toolCall.ID, params)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gp.name, err)
+	}
+
+	var changed []string
+	for _, path := range slices.Sorted(maps.Keys(edits)) {
+		file, err := resolveIn(gp.root, path)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, gp.name, err)
+		}
+
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, gp.name, err)
+		}
+
+		if err := os.WriteFile(file, []byte(lsp.ApplyEdits(string(content), edits[path])), 0644); err != nil {
+			return toolErrorResponse(toolCall.ID, gp.name, fmt.Errorf("write file: %s", err))
+		}
+
+		changed = append(changed, path)
+	}
+
+	return toolSuccessResponse(toolCall.ID, gp.name, ToolData{"message": fmt.Sprintf("Renamed to %s", params.NewName), "files": changed})
+}
+
+// renameEdits asks gopls for the edits of a rename. The edits of the last
+// rename are cached by tool call since the agent asks for the modified paths
+// before and after the call.
+func (gp *Gopls) renameEdits(id string, params goplsParams) (map[string][]lsp.TextEdit, error) {
+	gp.mu.Lock()
+	edits, exists := gp.renames[id]
+	gp.mu.Unlock()
+
+	if exists {
+		return edits, nil
+	}
+
+	if params.NewName == "" {
+		return nil, fmt.Errorf("new_name is required for rename")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), goplsTimeout)
+	defer cancel()
+
+	cln, err := gp.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := cln.SyncOpened(""); err != nil {
+		return nil, err
+	}
+
+	if _, err := cln.Sync(params.Path); err != nil {
+		return nil, err
+	}
+
+	p := positionParams(params)
+	p["newName"] = params.NewName
+
+	var we lsp.WorkspaceEdit
+	if err := cln.Call(ctx, "textDocument/rename", p, &we); err != nil {
+		return nil, err
+	}
+
+	// Keep the paths relative to the workspace like the other tools.
+	edits = make(map[string][]lsp.TextEdit)
+	for path, e := range we.Edits() {
+		if rel, err := filepath.Rel(gp.root, path); err == nil {
+			path = rel
+		}
+		edits[path] = e
+	}
+
+	gp.mu.Lock()
+	gp.renames = map[string]map[string][]lsp.TextEdit{id: edits}
+	gp.mu.Unlock()
+
+	return edits, nil
+}
+
+// client returns the connection to gopls, starting it the first time.
+func (gp *Gopls) client(ctx context.Context) (*lsp.Client, error) {
+	gp.mu.Lock()
+	defer gp.mu.Unlock()
+
+	if gp.lsp != nil {
+		return gp.lsp, nil
+	}
+
+	cln, err := lsp.Start(ctx, gp.root, "gopls")
+	if err != nil {
+		return nil, fmt.Errorf("start gopls: %w", err)
+	}
+	gp.lsp = cln
+
+	return cln, nil
+}
+
+// positionParams returns the LSP parameters for the position in the file.
+func positionParams(params goplsParams) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": lsp.PathToURI(params.Path)},
+		"position":     lsp.Position{Line: params.Line - 1, Character: params.Column - 1},
+	}
+}
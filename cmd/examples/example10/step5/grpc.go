@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	agentv1 "github.com/ardanlabs/ai-training/api/agent/v1"
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcListenAndServe runs the agent as a gRPC service using the definitions
+// from api/agent/v1.
+func grpcListenAndServe(host string) error {
+	lis, err := net.Listen("tcp", host)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+
+	srv := grpc.NewServer()
+	agentv1.RegisterAgentServiceServer(srv, &grpcServer{
+		sessions: make(map[string]*grpcSession),
+	})
+
+	log.Printf("grpc: serving the agent API at %s", host)
+
+	return srv.Serve(lis)
+}
+
+// =============================================================================
+
+// grpcSession represents a chat session with its own agent and conversation.
+type grpcSession struct {
+	mu       sync.Mutex
+	agent    *Agent
+	renderer *grpcRenderer
+}
+
+type grpcServer struct {
+	agentv1.UnimplementedAgentServiceServer
+
+	mu       sync.RWMutex
+	sessions map[string]*grpcSession
+}
+
+func (gs *grpcServer) CreateSession(ctx context.Context, req *agentv1.CreateSessionRequest) (*agentv1.CreateSessionResponse, error) {
+	renderer := grpcRenderer{
+		closed: make(chan struct{}),
+	}
+
+	id := rand.Text()
+
+	agent, err := NewAgent(nil, WithRenderer(&renderer), WithSessionID(id))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "create agent: %s", err)
+	}
+
+	gs.mu.Lock()
+	gs.sessions[id] = &grpcSession{
+		agent:    agent,
+		renderer: &renderer,
+	}
+	gs.mu.Unlock()
+
+	return &agentv1.CreateSessionResponse{SessionId: id}, nil
+}
+
+func (gs *grpcServer) CloseSession(ctx context.Context, req *agentv1.CloseSessionRequest) (*agentv1.CloseSessionResponse, error) {
+	gs.mu.Lock()
+	sess, exists := gs.sessions[req.GetSessionId()]
+	delete(gs.sessions, req.GetSessionId())
+	gs.mu.Unlock()
+
+	if !exists {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	close(sess.renderer.closed)
+	sess.agent.Close()
+
+	return &agentv1.CloseSessionResponse{}, nil
+}
+
+func (gs *grpcServer) Chat(req *agentv1.ChatRequest, stream grpc.ServerStreamingServer[agentv1.ChatEvent]) error {
+	sess, err := gs.session(req.GetSessionId())
+	if err != nil {
+		return err
+	}
+
+	if req.GetContent() == "" {
+		return status.Error(codes.InvalidArgument, "content is required")
+	}
+
+	// A session can only process one message at a time since the messages
+	// share the same conversation.
+	if !sess.mu.TryLock() {
+		return status.Error(codes.FailedPrecondition, "session is busy with another message")
+	}
+	defer sess.mu.Unlock()
+
+	sess.renderer.attach(stream)
+	defer sess.renderer.detach()
+
+	if err := sess.agent.Turn(stream.Context(), req.GetContent()); err != nil {
+		sess.renderer.Error(err)
+	}
+
+	return stream.Send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_Done{Done: true}})
+}
+
+func (gs *grpcServer) StreamToolEvents(req *agentv1.StreamToolEventsRequest, stream grpc.ServerStreamingServer[agentv1.ToolEvent]) error {
+	sess, err := gs.session(req.GetSessionId())
+	if err != nil {
+		return err
+	}
+
+	// The calls that already happened are taken in the same step as the
+	// subscription, so a call is neither missed nor sent twice.
+	var ch <-chan *agentv1.ToolEvent
+	var unsubscribe func()
+	events := sess.agent.watchToolEvents(func() {
+		ch, unsubscribe = sess.renderer.subscribe()
+	})
+	defer unsubscribe()
+
+	// Send the tool calls that already happened before following new ones.
+	for _, evt := range events {
+		if err := stream.Send(toToolEventProto(evt)); err != nil {
+			return err
+		}
+	}
+
+	for {
+		select {
+		case evt := <-ch:
+			if err := stream.Send(evt); err != nil {
+				return err
+			}
+
+		case <-sess.renderer.closed:
+			return nil
+
+		case <-stream.Context().Done():
+			return nil
+		}
+	}
+}
+
+func (gs *grpcServer) session(id string) (*grpcSession, error) {
+	gs.mu.RLock()
+	defer gs.mu.RUnlock()
+
+	sess, exists := gs.sessions[id]
+	if !exists {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+
+	return sess, nil
+}
+
+func toToolEventProto(evt ToolEvent) *agentv1.ToolEvent {
+	args, _ := json.Marshal(evt.Arguments)
+
+	return &agentv1.ToolEvent{
+		TimeUnixMs: evt.Time.UnixMilli(),
+		Id:         evt.ID,
+		Name:       evt.Name,
+		Arguments:  string(args),
+		Result:     evt.Result,
+		RequestId:  evt.RequestID,
+	}
+}
+
+// =============================================================================
+
+// grpcRenderer streams the agent's activity to a gRPC client and publishes
+// tool events to any subscribers.
+type grpcRenderer struct {
+	mu          sync.Mutex
+	stream      grpc.ServerStreamingServer[agentv1.ChatEvent]
+	subscribers []chan *agentv1.ToolEvent
+	closed      chan struct{}
+	requestID   string
+}
+
+func (gr *grpcRenderer) attach(stream grpc.ServerStreamingServer[agentv1.ChatEvent]) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	gr.stream = stream
+}
+
+func (gr *grpcRenderer) detach() {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	gr.stream = nil
+}
+
+func (gr *grpcRenderer) subscribe() (<-chan *agentv1.ToolEvent, func()) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	ch := make(chan *agentv1.ToolEvent, 100)
+	gr.subscribers = append(gr.subscribers, ch)
+
+	unsubscribe := func() {
+		gr.mu.Lock()
+		defer gr.mu.Unlock()
+
+		gr.subscribers = slices.DeleteFunc(gr.subscribers, func(sub chan *agentv1.ToolEvent) bool {
+			return sub == ch
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+func (gr *grpcRenderer) send(evt *agentv1.ChatEvent) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	if gr.stream == nil {
+		return
+	}
+
+	if err := gr.stream.Send(evt); err != nil {
+		log.Printf("grpc: send: %s", err)
+	}
+}
+
+// Waiting is ignored since gRPC clients can track latency themselves.
+func (gr *grpcRenderer) Waiting(model string, elapsed time.Duration) {}
+
+// Reasoning streams the reasoning of the model.
+func (gr *grpcRenderer) Reasoning(text string) {
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_Reasoning{Reasoning: text}})
+}
+
+// Content streams the answer from the model.
+func (gr *grpcRenderer) Content(text string) {
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_Content{Content: text}})
+}
+
+// ToolCall streams the tool the model asked to call.
+func (gr *grpcRenderer) ToolCall(toolCall client.ToolCall) {
+	args, _ := json.Marshal(toolCall.Function.Arguments)
+
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_ToolCall{ToolCall: &agentv1.ToolCall{
+		Id:        toolCall.ID,
+		Name:      toolCall.Function.Name,
+		Arguments: string(args),
+	}}})
+}
+
+// ModelRequest keeps the id of the request to the model, the tool results
+// carry it.
+func (gr *grpcRenderer) ModelRequest(requestID string) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	gr.requestID = requestID
+}
+
+// ToolResult streams the result of a tool call.
+func (gr *grpcRenderer) ToolResult(toolCall client.ToolCall, result client.D) {
+	content, _ := result["content"].(string)
+
+	gr.mu.Lock()
+	requestID := gr.requestID
+	gr.mu.Unlock()
+
+	evt := toToolEventProto(ToolEvent{
+		Time:      time.Now().UTC(),
+		RequestID: requestID,
+		ID:        toolCall.ID,
+		Name:      toolCall.Function.Name,
+		Arguments: toolCall.Function.Arguments,
+		Result:    content,
+	})
+
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_ToolResult{ToolResult: evt}})
+}
+
+// publishToolEvent publishes the tool call the agent recorded to the tool
+// event subscribers.
+func (gr *grpcRenderer) publishToolEvent(toolEvent ToolEvent) {
+	evt := toToolEventProto(toolEvent)
+
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	for _, sub := range gr.subscribers {
+		select {
+		case sub <- evt:
+		default:
+			log.Printf("grpc: tool event subscriber is too slow, dropping event %s", evt.Id)
+		}
+	}
+}
+
+// Info streams status information like token usage.
+func (gr *grpcRenderer) Info(msg string) {
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_Info{Info: msg}})
+}
+
+// Warning streams something the user should look at as information, the
+// API has no warning event.
+func (gr *grpcRenderer) Warning(msg string) {
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_Info{Info: "warning: " + msg}})
+}
+
+// Error streams an error.
+func (gr *grpcRenderer) Error(err error) {
+	gr.send(&agentv1.ChatEvent{Event: &agentv1.ChatEvent_Error{Error: err.Error()}})
+}
+
+// Done is ignored since the end of a message is reported by the handler.
+func (gr *grpcRenderer) Done() {}
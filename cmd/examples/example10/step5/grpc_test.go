@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	agentv1 "github.com/ardanlabs/ai-training/api/agent/v1"
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestGRPCToolEvents(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	renderer := grpcRenderer{
+		closed: make(chan struct{}),
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(&renderer))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	agent.tools["tool_context"] = contextTool{}
+
+	toolCall := func(id string) client.ToolCall {
+		return client.ToolCall{
+			ID: id,
+			Function: client.Function{
+				Name:      "tool_context",
+				Arguments: map[string]any{},
+			},
+		}
+	}
+
+	ctx := client.WithRequestID(context.Background(), "request-1")
+	agent.callTools(ctx, []client.ToolCall{toolCall("call-1")})
+
+	// The call made before the subscription is in the snapshot and isn't
+	// published again.
+	var ch <-chan *agentv1.ToolEvent
+	var unsubscribe func()
+	events := agent.watchToolEvents(func() {
+		ch, unsubscribe = renderer.subscribe()
+	})
+	defer unsubscribe()
+
+	if len(events) != 1 || events[0].ID != "call-1" || events[0].RequestID != "request-1" {
+		t.Fatalf("got events %+v, want call-1 of request-1", events)
+	}
+
+	agent.callTools(ctx, []client.ToolCall{toolCall("call-2")})
+
+	select {
+	case evt := <-ch:
+		if evt.GetId() != "call-2" || evt.GetRequestId() != "request-1" {
+			t.Errorf("got event %s of %s, want call-2 of request-1", evt.GetId(), evt.GetRequestId())
+		}
+	default:
+		t.Fatal("the call made after the subscription wasn't published")
+	}
+
+	select {
+	case evt := <-ch:
+		t.Errorf("got the extra event %s", evt.GetId())
+	default:
+	}
+}
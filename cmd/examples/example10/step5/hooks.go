@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// ModelCall represents the outcome of a call to the model.
+type ModelCall struct {
+	RequestID string
+	Latency   time.Duration
+	Content   string
+	ToolCalls bool
+	Err       error
+}
+
+// Hooks represents a set of functions that are called at points in the
+// agent's lifecycle. This lets users inject behavior like modifying the
+// request, vetoing tool calls, or recording telemetry without editing the
+// core loop. Any of the functions can be nil.
+//
+//	agent, err := NewAgent(getUserMessage, WithHooks(Hooks{
+//		AfterToolCall: func(ctx context.Context, toolCall client.ToolCall, result client.D, latency time.Duration) {
+//			log.Printf("%s took %s", toolCall.Function.Name, latency)
+//		},
+//	}))
+type Hooks struct {
+	// BeforeModelCall can modify the request document before it's sent to
+	// the model. Returning an error aborts the call.
+	BeforeModelCall func(ctx context.Context, d client.D) error
+
+	// AfterModelCall is called once the model has finished responding.
+	AfterModelCall func(ctx context.Context, call ModelCall)
+
+	// BeforeToolCall can veto a tool call by returning an error. The error is
+	// returned to the model as the result of the tool call.
+	BeforeToolCall func(ctx context.Context, toolCall client.ToolCall, tool Tool) error
+
+	// AfterToolCall is called with the result of every tool call.
+	AfterToolCall func(ctx context.Context, toolCall client.ToolCall, result client.D, latency time.Duration)
+}
+
+// WithHooks adds a set of hooks to the agent. Hooks are called in the order
+// they are added, after the ones every agent has: logging and protecting
+// go.mod and go.sum.
+func WithHooks(hooks Hooks) func(a *Agent) {
+	return func(a *Agent) {
+		a.hooks = append(a.hooks, hooks)
+	}
+}
+
+func (a *Agent) beforeModelCall(ctx context.Context, d client.D) error {
+	for _, h := range a.hooks {
+		if h.BeforeModelCall == nil {
+			continue
+		}
+
+		if err := h.BeforeModelCall(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Agent) afterModelCall(ctx context.Context, call ModelCall) {
+	for _, h := range a.hooks {
+		if h.AfterModelCall != nil {
+			h.AfterModelCall(ctx, call)
+		}
+	}
+}
+
+func (a *Agent) beforeToolCall(ctx context.Context, toolCall client.ToolCall, tool Tool) error {
+
+	// The hooks check the tool behind a layer like the prefetch cache, so
+	// the checks based on the kind of tool apply to cache hits too.
+	if w, ok := tool.(interface{ wrapped() Tool }); ok {
+		tool = w.wrapped()
+	}
+
+	for _, h := range a.hooks {
+		if h.BeforeToolCall == nil {
+			continue
+		}
+
+		if err := h.BeforeToolCall(ctx, toolCall, tool); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Agent) afterToolCall(ctx context.Context, toolCall client.ToolCall, result client.D, latency time.Duration) {
+	for _, h := range a.hooks {
+		if h.AfterToolCall != nil {
+			h.AfterToolCall(ctx, toolCall, result, latency)
+		}
+	}
+}
+
+// =============================================================================
+
+// protectFiles returns hooks that block any tool call that would modify a
+// file with one of the specified names, like go.mod, which should only be
+// changed by the go tooling.
+func protectFiles(names ...string) Hooks {
+	return Hooks{
+		BeforeToolCall: func(ctx context.Context, toolCall client.ToolCall, tool Tool) error {
+			fm, ok := tool.(fileModifier)
+			if !ok {
+				return nil
+			}
+
+			for _, path := range fm.modifiedPaths(toolCall) {
+				if slices.Contains(names, filepath.Base(path)) {
+					return fmt.Errorf("%s is protected and can't be modified, ask the user to make the change", path)
+				}
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestProtectFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const goMod = "module example\n\ngo 1.25\n"
+	if err := os.WriteFile("go.mod", []byte(goMod), 0644); err != nil {
+		t.Fatalf("write go.mod: %s", err)
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	toolCall := client.ToolCall{
+		ID: "call-1",
+		Function: client.Function{
+			Name: "tool_code_editor",
+			Arguments: map[string]any{
+				"path":        "go.mod",
+				"line_number": 3,
+				"type_change": "replace",
+				"line_change": "go 1.20",
+			},
+		},
+	}
+
+	resps := agent.callTools(context.Background(), []client.ToolCall{toolCall})
+	if len(resps) != 1 {
+		t.Fatalf("got %d results, want 1", len(resps))
+	}
+
+	content, _ := resps[0]["content"].(string)
+
+	tr, err := parseToolResponse(content)
+	if err != nil {
+		t.Fatalf("parse result: %s", err)
+	}
+
+	if !tr.Failed() {
+		t.Fatalf("the edit of go.mod wasn't vetoed: %s", content)
+	}
+
+	if msg, _ := tr.Data["error"].(string); !strings.Contains(msg, "go.mod is protected") {
+		t.Errorf("got error %q, want the protected file error", msg)
+	}
+
+	b, err := os.ReadFile("go.mod")
+	if err != nil {
+		t.Fatalf("read go.mod: %s", err)
+	}
+
+	if string(b) != goMod {
+		t.Errorf("go.mod was changed:\n%s", b)
+	}
+}
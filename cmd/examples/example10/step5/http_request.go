@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The set of domains the model is allowed to call. A request to a subdomain of
+// an allowed domain is also allowed. This can be overridden with the
+// AGENT_HTTP_ALLOWLIST environment variable using a comma separated list.
+var httpAllowlist = []string{
+	"api.github.com",
+	"pkg.go.dev",
+	"proxy.golang.org",
+	"httpbin.org",
+}
+
+// Limits applied to every request the model makes so a bad call can't flood
+// the context window or hang the agent.
+const (
+	httpMaxRequestBody  = 64 * 1024
+	httpMaxResponseBody = 32 * 1024
+	httpTimeout         = 30 * time.Second
+)
+
+func init() {
+	if v := os.Getenv("AGENT_HTTP_ALLOWLIST"); v != "" {
+		httpAllowlist = nil
+		for domain := range strings.SplitSeq(v, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				httpAllowlist = append(httpAllowlist, strings.ToLower(domain))
+			}
+		}
+	}
+}
+
+// =============================================================================
+// HTTPRequest Tool
+
+// HTTPRequest represents a tool that can be used to make GET and POST calls
+// to an allowlisted set of domains.
+type HTTPRequest struct {
+	name      string
+	http      *http.Client
+	allowlist []string
+}
+
+// RegisterHTTPRequest creates a new instance of the HTTPRequest tool and loads
+// it into the provided tools map.
+func RegisterHTTPRequest(tools map[string]Tool) client.D {
+	hr := HTTPRequest{
+		name: "tool_http_request",
+		http: &http.Client{
+			Timeout: httpTimeout,
+		},
+		allowlist: httpAllowlist,
+	}
+	tools[hr.name] = &hr
+
+	return hr.toolDocument()
+}
+
+// httpRequestParams represents the parameters for the HTTPRequest tool.
+type httpRequestParams struct {
+	URL     string            `json:"url" description:"The full http or https URL to call."`
+	Method  string            `json:"method,omitempty" description:"The HTTP method to use. Defaults to GET." enum:"GET,POST"`
+	Headers map[string]string `json:"headers,omitempty" description:"Optional set of request headers as key/value strings."`
+	Body    string            `json:"body,omitempty" description:"Optional request body for POST requests."`
+}
+
+// mutation describes the request if it can change state on the server. Only
+// GET requests are considered safe.
+func (hr *HTTPRequest) mutation(toolCall client.ToolCall) (string, bool) {
+	method, _ := toolCall.Function.Arguments["method"].(string)
+	method = strings.ToUpper(method)
+	if method == "" || method == http.MethodGet {
+		return "", false
+	}
+
+	url, _ := toolCall.Function.Arguments["url"].(string)
+
+	return fmt.Sprintf("would have sent %s %s", method, url), true
+}
+
+// network describes the call, every request reaches the network.
+func (hr *HTTPRequest) network(toolCall client.ToolCall) (string, bool) {
+	url, _ := toolCall.Function.Arguments["url"].(string)
+
+	return "a request to " + url, true
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (hr *HTTPRequest) toolDocument() client.D {
+	description := fmt.Sprintf("Make an HTTP GET or POST request to an API. Only these domains are allowed: %s. Responses larger than %d bytes are truncated.", strings.Join(hr.allowlist, ", "), httpMaxResponseBody)
+
+	return client.ToolDocument(hr.name, description, httpRequestParams{})
+}
+
+// Call is the function that is called by the agent to make an HTTP request
+// when the model requests the tool with the specified parameters.
+func (hr *HTTPRequest) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params httpRequestParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, hr.name, err)
+	}
+
+	method := http.MethodGet
+	if params.Method != "" {
+		method = strings.ToUpper(params.Method)
+	}
+
+	rawURL := params.URL
+	body := params.Body
+	headers := params.Headers
+
+	if method != http.MethodGet && method != http.MethodPost {
+		return toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("unsupported method: %s, only GET and POST are allowed", method))
+	}
+
+	if len(body) > httpMaxRequestBody {
+		return toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("request body of %d bytes exceeds the %d byte limit", len(body), httpMaxRequestBody))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, strings.NewReader(body))
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("create request: %w", err))
+	}
+
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("unsupported scheme: %q", req.URL.Scheme))
+	}
+
+	if !hr.allowed(req.URL.Hostname()) {
+		return toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("domain %q is not in the allowlist, please inform the user", req.URL.Hostname()))
+	}
+
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// Redirects could take the request outside of the allowlist so we need
+	// to check every hop.
+	cln := *hr.http
+	cln.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("stopped after 5 redirects")
+		}
+		if !hr.allowed(req.URL.Hostname()) {
+			return fmt.Errorf("redirect to domain %q is not in the allowlist", req.URL.Hostname())
+		}
+		return nil
+	}
+
+	r, err := cln.Do(req)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, hr.name, err)
+	}
+	defer r.Body.Close()
+
+	var b bytes.Buffer
+	n, err := io.Copy(&b, io.LimitReader(r.Body, httpMaxResponseBody+1))
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, hr.name, fmt.Errorf("read response: %w", err))
+	}
+
+	truncated := n > httpMaxResponseBody
+	if truncated {
+		b.Truncate(httpMaxResponseBody)
+	}
+
+	return toolSuccessResponse(toolCall.ID, hr.name, ToolData{
+		"status_code":  r.StatusCode,
+		"content_type": r.Header.Get("Content-Type"),
+		"body":         b.String(),
+		"truncated":    truncated,
+	})
+}
+
+// allowed checks if the host matches, or is a subdomain of, an entry in the
+// allowlist.
+func (hr *HTTPRequest) allowed(host string) bool {
+	return allowedHost(hr.allowlist, host)
+}
+
+// allowedHost checks if the host matches, or is a subdomain of, an entry in
+// the allowlist. Every tool that downloads what the model asks for checks the
+// host with it.
+func allowedHost(allowlist []string, host string) bool {
+	host = strings.ToLower(host)
+
+	for _, domain := range allowlist {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// The files with the ignore rules of a project. The .agentignore file uses
+// the same syntax as .gitignore and hides files from the agent that are
+// still tracked by git, like a vendor directory.
+var ignoreFiles = []string{".gitignore", ".agentignore"}
+
+// ignoreRule represents a single pattern from an ignore file.
+type ignoreRule struct {
+	base    string // Directory of the ignore file, "" for the root.
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreRules represents the rules of the ignore files found in a directory
+// tree. Like git, the rules of a directory apply to everything below it and
+// the last matching rule decides.
+type ignoreRules struct {
+	root   string // Directory the paths are relative to, "" for the working directory.
+	rules  []ignoreRule
+	loaded map[string]bool
+}
+
+// newIgnoreRules loads the ignore files of the root and of the directories
+// leading to dir, so a walk can start below the root. The paths are relative
+// to the root, the working directory when empty.
+func newIgnoreRules(root string, dir string) *ignoreRules {
+	ir := ignoreRules{
+		root:   root,
+		loaded: make(map[string]bool),
+	}
+
+	ir.load(".")
+
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if dir == "." || strings.HasPrefix(dir, "../") || filepath.IsAbs(dir) {
+		return &ir
+	}
+
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		ir.load(strings.Join(parts[:i+1], "/"))
+	}
+
+	return &ir
+}
+
+// load adds the rules of the ignore files in the directory. Directories are
+// only loaded once.
+func (ir *ignoreRules) load(dir string) {
+	dir = filepath.ToSlash(filepath.Clean(dir))
+	if ir.loaded[dir] {
+		return
+	}
+	ir.loaded[dir] = true
+
+	base := dir
+	if base == "." {
+		base = ""
+	}
+
+	for _, name := range ignoreFiles {
+		f, err := os.Open(filepath.Join(ir.root, dir, name))
+		if err != nil {
+			continue
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreRule(base, scanner.Text()); ok {
+				ir.rules = append(ir.rules, rule)
+			}
+		}
+		f.Close()
+	}
+}
+
+// ignored reports whether the path, relative to the root, is ignored. The .git directory is always ignored.
+func (ir *ignoreRules) ignored(p string, isDir bool) bool {
+	p = filepath.ToSlash(filepath.Clean(p))
+	if path.Base(p) == ".git" {
+		return true
+	}
+
+	var ignored bool
+	for _, rule := range ir.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		rel := p
+		if rule.base != "" {
+			var ok bool
+			if rel, ok = strings.CutPrefix(p, rule.base+"/"); !ok {
+				continue
+			}
+		}
+
+		if rule.re.MatchString(rel) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// parseIgnoreRule parses a line of an ignore file. It reports false for
+// blank lines and comments.
+func parseIgnoreRule(base string, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{
+		base: base,
+	}
+
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, `\`)
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// A pattern with a slash is relative to the directory of the ignore
+	// file, otherwise it matches a name at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	if line == "" {
+		return ignoreRule{}, false
+	}
+
+	expr := globToRegexp(line)
+	if !anchored {
+		expr = "(.*/)?" + expr
+	}
+
+	re, err := regexp.Compile("^" + expr + "$")
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+
+	return rule, true
+}
+
+// globToRegexp converts the gitignore glob syntax to a regular expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+
+		case c == '*':
+			b.WriteString("[^/]*")
+
+		case c == '?':
+			b.WriteString("[^/]")
+
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+
+		case c == '\\' && i+1 < len(glob):
+			b.WriteString(regexp.QuoteMeta(glob[i+1 : i+2]))
+			i++
+
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// How long Ollama keeps the model in memory after a request, the server's
+// default of 5 minutes when it's not set. This can be changed with the
+// AGENT_KEEP_ALIVE environment variable, like 30m, or -1s to keep the model
+// loaded until the server stops.
+var (
+	keepAlive    time.Duration
+	keepAliveSet bool
+)
+
+// Workshop machines often run several models on one GPU, a chat that ends
+// should give its VRAM back right away. This is turned on with the
+// AGENT_UNLOAD_ON_EXIT environment variable.
+var unloadOnExit bool
+
+func init() {
+	if v := os.Getenv("AGENT_KEEP_ALIVE"); v != "" {
+		var err error
+		keepAlive, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keepAliveSet = true
+	}
+
+	if v := os.Getenv("AGENT_UNLOAD_ON_EXIT"); v != "" {
+		var err error
+		unloadOnExit, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// The time the server gets to unload the model.
+const unloadTimeout = 30 * time.Second
+
+// withKeepAlive adds the keep alive to a request to the model when it's set.
+// Only Ollama knows the field, the other transports don't get it.
+func withKeepAlive(d client.D) {
+	if keepAliveSet && transport == client.TransportSSE {
+		client.WithKeepAlive(keepAlive)(d)
+	}
+}
+
+// WithUnloadOnExit makes the agent unload the model from the server when
+// it's closed. Agents that share the model, like the sessions of a daemon,
+// shouldn't use it.
+func WithUnloadOnExit() func(a *Agent) {
+	return func(a *Agent) {
+		a.unloadOnExit = true
+	}
+}
+
+// unloadModel asks Ollama to unload the model from memory, which it does
+// for a generate request without a prompt and a keep alive of zero.
+func (a *Agent) unloadModel() {
+	if transport != client.TransportSSE {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), unloadTimeout)
+	defer cancel()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, httpOptions...)
+
+	d := client.D{
+		"model": model,
+	}
+	client.WithKeepAlive(0)(d)
+
+	var resp struct {
+		DoneReason string `json:"done_reason"`
+	}
+
+	if err := cln.Do(ctx, http.MethodPost, serverBaseURL(url)+"/api/generate", d, &resp); err != nil {
+		a.renderer.Error(fmt.Errorf("unload %s: %w", model, err))
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("%s is unloaded", model))
+}
@@ -0,0 +1,604 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Limits applied to the cluster queries so a large cluster can't flood the
+// context window or hang the agent.
+const (
+	kubectlTimeout   = 30 * time.Second
+	kubectlMaxItems  = 200
+	kubectlMaxEvents = 20
+	kubectlMaxLogs   = 16 * 1024
+)
+
+// The kubectl tool is only registered for the personas that list it, like
+// ops. This can be changed with the AGENT_KUBECTL environment variable to
+// make it available to every persona.
+var kubectlEnabled bool
+
+func init() {
+	if v := os.Getenv("AGENT_KUBECTL"); v != "" {
+		var err error
+		kubectlEnabled, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// The kinds of resources the tool can list and describe. Secrets and config
+// maps are left out since they hold credentials.
+var kubectlKinds = []string{"pods", "deployments", "statefulsets", "daemonsets", "replicasets", "jobs", "services", "ingresses", "nodes", "namespaces", "events"}
+
+// kubectlObjectKinds maps the kinds that can be described to the kind the
+// events name in their involved object, since a name alone can match several
+// resources like a deployment and its service.
+var kubectlObjectKinds = map[string]string{
+	"pods":         "Pod",
+	"deployments":  "Deployment",
+	"statefulsets": "StatefulSet",
+	"daemonsets":   "DaemonSet",
+	"replicasets":  "ReplicaSet",
+	"jobs":         "Job",
+	"services":     "Service",
+	"ingresses":    "Ingress",
+	"nodes":        "Node",
+	"namespaces":   "Namespace",
+}
+
+// =============================================================================
+// KubectlGet Tool
+
+// KubectlGet represents a read-only tool that answers questions about the
+// Kubernetes cluster of the current kubecontext: it lists resources,
+// describes one and reads the logs of a pod. It never changes the cluster,
+// which is what the ops assistant of the training needs without granting it
+// write access.
+type KubectlGet struct {
+	name      string
+	context   string
+	namespace string
+	server    string
+	clientset kubernetes.Interface
+}
+
+// RegisterKubectlGet creates a new instance of the KubectlGet tool and loads
+// it into the provided tools map. The tool is only useful when there is a
+// kubeconfig with a current context, which is reported by the second return
+// value.
+func RegisterKubectlGet(tools map[string]Tool) (client.D, bool) {
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), &clientcmd.ConfigOverrides{})
+
+	raw, err := loader.RawConfig()
+	if err != nil || raw.CurrentContext == "" {
+		return nil, false
+	}
+
+	cfg, err := loader.ClientConfig()
+	if err != nil {
+		return nil, false
+	}
+
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, false
+	}
+
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, false
+	}
+
+	kg := KubectlGet{
+		name:      "tool_kubectl_get",
+		context:   raw.CurrentContext,
+		namespace: namespace,
+		server:    cfg.Host,
+		clientset: clientset,
+	}
+	tools[kg.name] = &kg
+
+	return kg.toolDocument(), true
+}
+
+// kubectlGetParams represents the parameters for the KubectlGet tool.
+type kubectlGetParams struct {
+	Action        string `json:"action" description:"get to list resources of a kind, describe to show one resource with its recent events, logs to read the logs of a pod." enum:"get,describe,logs"`
+	Kind          string `json:"kind,omitempty" description:"The kind of resource for get and describe." enum:"pods,deployments,statefulsets,daemonsets,replicasets,jobs,services,ingresses,nodes,namespaces,events"`
+	Name          string `json:"name,omitempty" description:"The name of the resource to describe or of the pod to read the logs of."`
+	Namespace     string `json:"namespace,omitempty" description:"The namespace, the one of the current context by default."`
+	AllNamespaces bool   `json:"all_namespaces,omitempty" description:"List the resources of every namespace."`
+	Selector      string `json:"selector,omitempty" description:"A label selector to filter the resources, like app=web."`
+	Container     string `json:"container,omitempty" description:"The container of the pod to read the logs of, when it has more than one."`
+	Tail          int    `json:"tail,omitempty" description:"The number of log lines to read from the end, 100 by default."`
+	Previous      bool   `json:"previous,omitempty" description:"Read the logs of the previous run of the container, to see why it crashed."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (kg *KubectlGet) toolDocument() client.D {
+	description := fmt.Sprintf("Read-only access to the Kubernetes cluster of the %s context: list pods, deployments, services, nodes and other resources, describe one with its recent events, or read the logs of a pod. It can't change the cluster.", kg.context)
+
+	return client.ToolDocument(kg.name, description, kubectlGetParams{})
+}
+
+// network reports the cluster's API server the calls reach, unless it's one
+// of the hosts allowed in offline mode.
+func (kg *KubectlGet) network(toolCall client.ToolCall) (string, bool) {
+	if slices.Contains(offlineHosts, serverHostname(kg.server)) {
+		return "", false
+	}
+
+	return "the Kubernetes API at " + kg.server, true
+}
+
+// Call is the function that is called by the agent to query the cluster
+// when the model requests the tool with the specified parameters.
+func (kg *KubectlGet) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, kg.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params kubectlGetParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, kg.name, err)
+	}
+
+	namespace := params.Namespace
+	switch {
+	case params.AllNamespaces:
+		namespace = metav1.NamespaceAll
+	case namespace == "":
+		namespace = kg.namespace
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kubectlTimeout)
+	defer cancel()
+
+	var data ToolData
+	var err error
+
+	switch params.Action {
+	case "get":
+		data, err = kg.get(ctx, params.Kind, namespace, params.Selector)
+
+	case "describe":
+		data, err = kg.describe(ctx, params.Kind, namespace, params.Name)
+
+	case "logs":
+		data, err = kg.logs(ctx, namespace, params)
+
+	default:
+		err = fmt.Errorf("unsupported action %q, use get, describe or logs", params.Action)
+	}
+
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, kg.name, err)
+	}
+
+	data["context"] = kg.context
+
+	return toolSuccessResponse(toolCall.ID, kg.name, data)
+}
+
+// =============================================================================
+
+// get lists the resources of the kind as rows with the columns kubectl get
+// shows.
+func (kg *KubectlGet) get(ctx context.Context, kind string, namespace string, selector string) (ToolData, error) {
+	if !slices.Contains(kubectlKinds, kind) {
+		return nil, fmt.Errorf("unsupported kind %q, use one of %s", kind, strings.Join(kubectlKinds, ", "))
+	}
+
+	opts := metav1.ListOptions{LabelSelector: selector, Limit: kubectlMaxItems + 1}
+	cs := kg.clientset
+
+	var rows []map[string]any
+	var err error
+
+	switch kind {
+	case "pods":
+		var list *corev1.PodList
+		if list, err = cs.CoreV1().Pods(namespace).List(ctx, opts); err == nil {
+			for _, p := range list.Items {
+				rows = append(rows, podRow(p))
+			}
+		}
+
+	case "deployments":
+		list, e := cs.AppsV1().Deployments(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, d := range list.Items {
+				rows = append(rows, map[string]any{"namespace": d.Namespace, "name": d.Name, "ready": fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, replicas(d.Spec.Replicas)), "up_to_date": d.Status.UpdatedReplicas, "available": d.Status.AvailableReplicas, "age": age(d.CreationTimestamp)})
+			}
+		}
+
+	case "statefulsets":
+		list, e := cs.AppsV1().StatefulSets(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, s := range list.Items {
+				rows = append(rows, map[string]any{"namespace": s.Namespace, "name": s.Name, "ready": fmt.Sprintf("%d/%d", s.Status.ReadyReplicas, replicas(s.Spec.Replicas)), "age": age(s.CreationTimestamp)})
+			}
+		}
+
+	case "daemonsets":
+		list, e := cs.AppsV1().DaemonSets(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, d := range list.Items {
+				rows = append(rows, map[string]any{"namespace": d.Namespace, "name": d.Name, "desired": d.Status.DesiredNumberScheduled, "ready": d.Status.NumberReady, "available": d.Status.NumberAvailable, "age": age(d.CreationTimestamp)})
+			}
+		}
+
+	case "replicasets":
+		list, e := cs.AppsV1().ReplicaSets(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, r := range list.Items {
+				rows = append(rows, map[string]any{"namespace": r.Namespace, "name": r.Name, "desired": replicas(r.Spec.Replicas), "ready": r.Status.ReadyReplicas, "age": age(r.CreationTimestamp)})
+			}
+		}
+
+	case "jobs":
+		list, e := cs.BatchV1().Jobs(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, j := range list.Items {
+				rows = append(rows, map[string]any{"namespace": j.Namespace, "name": j.Name, "succeeded": j.Status.Succeeded, "failed": j.Status.Failed, "active": j.Status.Active, "age": age(j.CreationTimestamp)})
+			}
+		}
+
+	case "services":
+		list, e := cs.CoreV1().Services(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, s := range list.Items {
+				var ports []string
+				for _, p := range s.Spec.Ports {
+					ports = append(ports, fmt.Sprintf("%d/%s", p.Port, p.Protocol))
+				}
+				rows = append(rows, map[string]any{"namespace": s.Namespace, "name": s.Name, "type": s.Spec.Type, "cluster_ip": s.Spec.ClusterIP, "ports": strings.Join(ports, ","), "age": age(s.CreationTimestamp)})
+			}
+		}
+
+	case "ingresses":
+		list, e := cs.NetworkingV1().Ingresses(namespace).List(ctx, opts)
+		if err = e; err == nil {
+			for _, i := range list.Items {
+				var hosts []string
+				for _, r := range i.Spec.Rules {
+					hosts = append(hosts, r.Host)
+				}
+				rows = append(rows, map[string]any{"namespace": i.Namespace, "name": i.Name, "hosts": strings.Join(hosts, ","), "age": age(i.CreationTimestamp)})
+			}
+		}
+
+	case "nodes":
+		list, e := cs.CoreV1().Nodes().List(ctx, opts)
+		if err = e; err == nil {
+			for _, n := range list.Items {
+				rows = append(rows, map[string]any{"name": n.Name, "status": nodeStatus(n), "version": n.Status.NodeInfo.KubeletVersion, "age": age(n.CreationTimestamp)})
+			}
+		}
+
+	case "namespaces":
+		list, e := cs.CoreV1().Namespaces().List(ctx, opts)
+		if err = e; err == nil {
+			for _, n := range list.Items {
+				rows = append(rows, map[string]any{"name": n.Name, "status": n.Status.Phase, "age": age(n.CreationTimestamp)})
+			}
+		}
+
+	case "events":
+		// The events come back ordered by name, the whole list is read so
+		// the latest ones are kept.
+		all := opts
+		all.Limit = 0
+
+		list, e := cs.CoreV1().Events(namespace).List(ctx, all)
+		if err = e; err == nil {
+			slices.SortFunc(list.Items, func(a, b corev1.Event) int {
+				return eventTime(b).Compare(eventTime(a))
+			})
+			for _, ev := range list.Items {
+				rows = append(rows, eventRow(ev))
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("list %s: %w", kind, err)
+	}
+
+	// The count is the number of resources, including the ones left out.
+	count := len(rows)
+	truncated := count > kubectlMaxItems
+	if truncated {
+		rows = rows[:kubectlMaxItems]
+	}
+
+	return ToolData{"kind": kind, "items": rows, "count": count, "truncated": truncated}, nil
+}
+
+// describe returns the resource without the fields only the cluster needs,
+// and its recent events.
+func (kg *KubectlGet) describe(ctx context.Context, kind string, namespace string, name string) (ToolData, error) {
+	if name == "" {
+		return nil, errors.New("name is required for describe")
+	}
+
+	if namespace == metav1.NamespaceAll {
+		namespace = kg.namespace
+	}
+
+	cs := kg.clientset
+	opts := metav1.GetOptions{}
+
+	var obj metav1.Object
+	var v any
+	var err error
+
+	switch kind {
+	case "pods":
+		o, e := cs.CoreV1().Pods(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "deployments":
+		o, e := cs.AppsV1().Deployments(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "statefulsets":
+		o, e := cs.AppsV1().StatefulSets(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "daemonsets":
+		o, e := cs.AppsV1().DaemonSets(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "replicasets":
+		o, e := cs.AppsV1().ReplicaSets(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "jobs":
+		o, e := cs.BatchV1().Jobs(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "services":
+		o, e := cs.CoreV1().Services(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "ingresses":
+		o, e := cs.NetworkingV1().Ingresses(namespace).Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "nodes":
+		o, e := cs.CoreV1().Nodes().Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	case "namespaces":
+		o, e := cs.CoreV1().Namespaces().Get(ctx, name, opts)
+		obj, v, err = o, o, e
+	default:
+		return nil, fmt.Errorf("unsupported kind %q for describe, use one of %s", kind, strings.Join(slices.DeleteFunc(slices.Clone(kubectlKinds), func(k string) bool { return k == "events" }), ", "))
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("get %s %s: %w", kind, name, err)
+	}
+
+	// The values of the environment variables often hold credentials, only
+	// their names are shown.
+	switch o := v.(type) {
+	case *corev1.Pod:
+		redactEnv(&o.Spec)
+	case *appsv1.Deployment:
+		redactEnv(&o.Spec.Template.Spec)
+	case *appsv1.StatefulSet:
+		redactEnv(&o.Spec.Template.Spec)
+	case *appsv1.DaemonSet:
+		redactEnv(&o.Spec.Template.Spec)
+	case *appsv1.ReplicaSet:
+		redactEnv(&o.Spec.Template.Spec)
+	case *batchv1.Job:
+		redactEnv(&o.Spec.Template.Spec)
+	}
+
+	// The managed fields and the last applied configuration repeat the
+	// resource and take a lot of tokens.
+	obj.SetManagedFields(nil)
+	annotations := obj.GetAnnotations()
+	delete(annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	obj.SetAnnotations(annotations)
+
+	selector := fields.AndSelectors(
+		fields.OneTermEqualSelector("involvedObject.kind", kubectlObjectKinds[kind]),
+		fields.OneTermEqualSelector("involvedObject.name", name),
+	).String()
+	events, err := cs.CoreV1().Events(obj.GetNamespace()).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("list events: %w", err)
+	}
+
+	slices.SortFunc(events.Items, func(a, b corev1.Event) int {
+		return eventTime(b).Compare(eventTime(a))
+	})
+
+	rows := []map[string]any{}
+	for _, ev := range events.Items[:min(len(events.Items), kubectlMaxEvents)] {
+		rows = append(rows, eventRow(ev))
+	}
+
+	return ToolData{"kind": kind, "resource": v, "events": rows}, nil
+}
+
+// logs returns the end of the logs of a container of the pod.
+func (kg *KubectlGet) logs(ctx context.Context, namespace string, params kubectlGetParams) (ToolData, error) {
+	if params.Name == "" {
+		return nil, errors.New("name of the pod is required for logs")
+	}
+
+	if namespace == metav1.NamespaceAll {
+		namespace = kg.namespace
+	}
+
+	tail := int64(params.Tail)
+	if tail <= 0 {
+		tail = 100
+	}
+
+	opts := corev1.PodLogOptions{
+		Container:  params.Container,
+		TailLines:  &tail,
+		Previous:   params.Previous,
+		Timestamps: true,
+	}
+
+	stream, err := kg.clientset.CoreV1().Pods(namespace).GetLogs(params.Name, &opts).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("logs of %s: %w", params.Name, err)
+	}
+	defer stream.Close()
+
+	b, err := io.ReadAll(io.LimitReader(stream, kubectlMaxLogs+1))
+	if err != nil {
+		return nil, fmt.Errorf("logs of %s: %w", params.Name, err)
+	}
+
+	truncated := len(b) > kubectlMaxLogs
+	if truncated {
+		b = b[:kubectlMaxLogs]
+	}
+
+	return ToolData{"pod": params.Name, "namespace": namespace, "container": params.Container, "logs": string(b), "truncated": truncated}, nil
+}
+
+// =============================================================================
+
+// podRow returns the columns kubectl get pods shows.
+func podRow(p corev1.Pod) map[string]any {
+	var ready, restarts int
+	status := string(p.Status.Phase)
+
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Ready {
+			ready++
+		}
+		restarts += int(cs.RestartCount)
+
+		// The reason a container is waiting, like CrashLoopBackOff, is what
+		// the user needs to see.
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason != "" {
+			status = cs.State.Waiting.Reason
+		}
+	}
+
+	if p.DeletionTimestamp != nil {
+		status = "Terminating"
+	}
+
+	return map[string]any{
+		"namespace": p.Namespace,
+		"name":      p.Name,
+		"ready":     fmt.Sprintf("%d/%d", ready, len(p.Spec.Containers)),
+		"status":    status,
+		"restarts":  restarts,
+		"node":      p.Spec.NodeName,
+		"age":       age(p.CreationTimestamp),
+	}
+}
+
+// redactEnv replaces the values of the environment variables of the
+// containers of the pod spec.
+func redactEnv(spec *corev1.PodSpec) {
+	redact := func(env []corev1.EnvVar) {
+		for i := range env {
+			if env[i].Value != "" {
+				env[i].Value = "REDACTED"
+			}
+		}
+	}
+
+	for i := range spec.InitContainers {
+		redact(spec.InitContainers[i].Env)
+	}
+	for i := range spec.Containers {
+		redact(spec.Containers[i].Env)
+	}
+	for i := range spec.EphemeralContainers {
+		redact(spec.EphemeralContainers[i].Env)
+	}
+}
+
+// eventRow returns the columns kubectl get events shows.
+func eventRow(ev corev1.Event) map[string]any {
+	return map[string]any{
+		"type":    ev.Type,
+		"reason":  ev.Reason,
+		"object":  strings.ToLower(ev.InvolvedObject.Kind) + "/" + ev.InvolvedObject.Name,
+		"message": ev.Message,
+		"count":   ev.Count,
+		"age":     age(metav1.NewTime(eventTime(ev))),
+	}
+}
+
+// eventTime returns when the event last happened.
+func eventTime(ev corev1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	}
+
+	return ev.CreationTimestamp.Time
+}
+
+// nodeStatus returns Ready or NotReady, and SchedulingDisabled for a
+// cordoned node.
+func nodeStatus(n corev1.Node) string {
+	status := "NotReady"
+	for _, c := range n.Status.Conditions {
+		if c.Type == corev1.NodeReady && c.Status == corev1.ConditionTrue {
+			status = "Ready"
+		}
+	}
+
+	if n.Spec.Unschedulable {
+		status += ",SchedulingDisabled"
+	}
+
+	return status
+}
+
+// replicas returns the desired replicas, which default to one.
+func replicas(n *int32) int32 {
+	if n == nil {
+		return 1
+	}
+
+	return *n
+}
+
+// age returns how long ago the time was, rounded like kubectl does.
+func age(t metav1.Time) string {
+	d := time.Since(t.Time)
+
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
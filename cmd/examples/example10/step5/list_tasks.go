@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"gopkg.in/yaml.v3"
+)
+
+// Limits applied to the tasks so a large makefile can't flood the context
+// window.
+const (
+	listTasksMaxTasks    = 200
+	listTasksMaxCommands = 10
+)
+
+// The files the tasks are read from, in the order they are looked for.
+var (
+	makefileNames = []string{"GNUmakefile", "makefile", "Makefile"}
+	taskfileNames = []string{"Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml"}
+)
+
+// =============================================================================
+// ListTasks Tool
+
+// ListTasks represents a tool that lists the targets of the makefile and the
+// tasks of the Taskfile in the workspace with their commands, so the agent
+// builds and tests the project the same way a human would.
+type ListTasks struct {
+	name string
+}
+
+// RegisterListTasks creates a new instance of the ListTasks tool and loads it
+// into the provided tools map.
+func RegisterListTasks(tools map[string]Tool) client.D {
+	lt := ListTasks{
+		name: "tool_list_tasks",
+	}
+	tools[lt.name] = &lt
+
+	return lt.toolDocument()
+}
+
+// listTasksParams represents the parameters for the ListTasks tool.
+type listTasksParams struct {
+	Filter string `json:"filter,omitempty" description:"Only list the tasks with this text in their name, like test or lint."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (lt *ListTasks) toolDocument() client.D {
+	return client.ToolDocument(lt.name, "List the targets of the Makefile and the tasks of the Taskfile.yml in the workspace with their description and commands, to discover how the project is built, tested and run.", listTasksParams{})
+}
+
+// Call is the function that is called by the agent to list the tasks when
+// the model requests the tool with the specified parameters.
+func (lt *ListTasks) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, lt.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params listTasksParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, lt.name, err)
+	}
+
+	var tasks []task
+	var files []string
+
+	if name, data, found := readFirst(workspaceDir(ctx), makefileNames); found {
+		tasks = append(tasks, parseMakefile(name, data)...)
+		files = append(files, name)
+	}
+
+	if name, data, found := readFirst(workspaceDir(ctx), taskfileNames); found {
+		t, err := parseTaskfile(name, data)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, lt.name, err)
+		}
+		tasks = append(tasks, t...)
+		files = append(files, name)
+	}
+
+	if len(files) == 0 {
+		return toolErrorResponse(toolCall.ID, lt.name, errors.New("there is no Makefile or Taskfile.yml in the workspace"))
+	}
+
+	if params.Filter != "" {
+		tasks = slices.DeleteFunc(tasks, func(t task) bool {
+			return !strings.Contains(t.Name, params.Filter)
+		})
+	}
+
+	count := len(tasks)
+
+	truncated := count > listTasksMaxTasks
+	if truncated {
+		tasks = tasks[:listTasksMaxTasks]
+	}
+
+	return toolSuccessResponse(toolCall.ID, lt.name, ToolData{"files": files, "tasks": tasks, "count": count, "truncated": truncated})
+}
+
+// =============================================================================
+
+// task represents a target of a makefile or a task of a Taskfile.
+type task struct {
+	Name        string   `json:"name"`
+	Run         string   `json:"run"`
+	Description string   `json:"description,omitempty"`
+	Examples    []string `json:"examples,omitempty"`
+	Deps        []string `json:"deps,omitempty"`
+	Commands    []string `json:"commands"`
+	File        string   `json:"file"`
+	Line        int      `json:"line"`
+}
+
+// readFirst reads the first of the files that exists in the directory.
+func readFirst(dir string, names []string) (string, []byte, bool) {
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err == nil {
+			return name, data, true
+		}
+	}
+
+	return "", nil, false
+}
+
+// makeTargetRE matches a rule, like "build: deps".
+var makeTargetRE = regexp.MustCompile(`^([A-Za-z0-9_./%-][A-Za-z0-9_./% -]*?)\s*::?(?:\s+(.*))?$`)
+
+// parseMakefile returns the targets of the makefile. The comments right
+// above a target describe it and the ones that start with "make" are
+// examples of running it. Special targets like .PHONY and pattern rules are
+// left out.
+func parseMakefile(file string, data []byte) []task {
+	var tasks []task
+	var comments []string
+
+	// The indexes of the tasks of the current rule, a rule can have several
+	// targets that share the commands.
+	var current []int
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			for _, i := range current {
+				if len(tasks[i].Commands) < listTasksMaxCommands {
+					tasks[i].Commands = append(tasks[i].Commands, strings.TrimSpace(text))
+				}
+			}
+			continue
+
+		case strings.HasPrefix(text, "#"):
+			comment := strings.TrimSpace(strings.TrimLeft(text, "#"))
+			if strings.Trim(comment, "=-") == "" {
+				comments = nil
+				continue
+			}
+			comments = append(comments, comment)
+			continue
+
+		case strings.TrimSpace(text) == "":
+			// A blank line between the comments and the target is allowed.
+			current = nil
+			continue
+		}
+
+		current = nil
+
+		m := makeTargetRE.FindStringSubmatch(text)
+		if m == nil || isMakeAssignment(text) {
+			comments = nil
+			continue
+		}
+
+		deps := strings.Fields(m[2])
+		for _, name := range strings.Fields(m[1]) {
+			if strings.HasPrefix(name, ".") || strings.Contains(name, "%") {
+				continue
+			}
+
+			t := task{
+				Name:     name,
+				Run:      "make " + name,
+				Deps:     deps,
+				Commands: []string{},
+				File:     file,
+				Line:     line,
+			}
+
+			for _, c := range comments {
+				if strings.HasPrefix(c, "make ") {
+					t.Examples = append(t.Examples, c)
+					continue
+				}
+				t.Description = strings.TrimSpace(t.Description + " " + c)
+			}
+
+			current = append(current, len(tasks))
+			tasks = append(tasks, t)
+		}
+
+		comments = nil
+	}
+
+	return tasks
+}
+
+// isMakeAssignment reports whether the line sets a variable, like
+// "X = 1" or "X := $(Y)", instead of being a rule.
+func isMakeAssignment(line string) bool {
+	if strings.Contains(line, ":=") {
+		return true
+	}
+
+	eq := strings.Index(line, "=")
+	colon := strings.Index(line, ":")
+
+	return eq != -1 && (colon == -1 || eq < colon)
+}
+
+// parseTaskfile returns the tasks of a Taskfile. A task can be a command, a
+// list of commands or a document with desc, deps and cmds.
+func parseTaskfile(file string, data []byte) ([]task, error) {
+	var doc struct {
+		Tasks yaml.Node `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	if doc.Tasks.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+
+	var tasks []task
+
+	content := doc.Tasks.Content
+	for i := 0; i+1 < len(content); i += 2 {
+		name, value := content[i].Value, content[i+1]
+
+		t := task{
+			Name:     name,
+			Run:      "task " + name,
+			Commands: []string{},
+			File:     file,
+			Line:     content[i].Line,
+		}
+
+		var def struct {
+			Desc    string      `yaml:"desc"`
+			Summary string      `yaml:"summary"`
+			Deps    []yaml.Node `yaml:"deps"`
+			Cmds    []yaml.Node `yaml:"cmds"`
+			Cmd     string      `yaml:"cmd"`
+		}
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			def.Cmd = value.Value
+		case yaml.SequenceNode:
+			for _, n := range value.Content {
+				def.Cmds = append(def.Cmds, *n)
+			}
+		case yaml.MappingNode:
+			if err := value.Decode(&def); err != nil {
+				return nil, fmt.Errorf("%s: task %s: %w", file, name, err)
+			}
+		}
+
+		t.Description = cmp.Or(def.Desc, strings.TrimSpace(def.Summary))
+
+		for _, n := range def.Deps {
+			if dep := taskfileValue(n, "task"); dep != "" {
+				t.Deps = append(t.Deps, dep)
+			}
+		}
+
+		if def.Cmd != "" {
+			t.Commands = append(t.Commands, def.Cmd)
+		}
+		for _, n := range def.Cmds {
+			if len(t.Commands) == listTasksMaxCommands {
+				break
+			}
+			if cmd := taskfileValue(n, "cmd"); cmd != "" {
+				t.Commands = append(t.Commands, cmd)
+			} else if dep := taskfileValue(n, "task"); dep != "" {
+				t.Commands = append(t.Commands, "task "+dep)
+			}
+		}
+
+		tasks = append(tasks, t)
+	}
+
+	return tasks, nil
+}
+
+// taskfileValue returns the value of a scalar node or of the key of a
+// mapping node, like {cmd: go test ./...}.
+func taskfileValue(n yaml.Node, key string) string {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return n.Value
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if n.Content[i].Value == key {
+				return n.Content[i+1].Value
+			}
+		}
+	}
+
+	return ""
+}
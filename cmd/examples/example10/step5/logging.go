@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/logger"
+)
+
+// Where the logs are written. The console gets the same messages as always,
+// the log file also gets every model and tool call and is rotated when it
+// reaches logMaxSize megabytes or is older than logMaxAge. These can be
+// changed with the AGENT_LOG_FILE, AGENT_LOG_MAX_SIZE, AGENT_LOG_MAX_AGE,
+// AGENT_LOG_BACKUPS and AGENT_LOG_CONSOLE environment variables,
+// AGENT_LOG_CONSOLE=false keeps long sessions quiet when there is a log file.
+var (
+	logFile    string
+	logMaxSize = 10
+	logMaxAge  = 24 * time.Hour
+	logBackups = 5
+	logConsole = true
+)
+
+func init() {
+	logFile = os.Getenv("AGENT_LOG_FILE")
+
+	if v := os.Getenv("AGENT_LOG_MAX_SIZE"); v != "" {
+		var err error
+		logMaxSize, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_LOG_MAX_AGE"); v != "" {
+		var err error
+		logMaxAge, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_LOG_BACKUPS"); v != "" {
+		var err error
+		logBackups, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_LOG_CONSOLE"); v != "" {
+		var err error
+		logConsole, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// setupLogging makes the configured logger the default, the log package is
+// sent through it as well. The returned function closes the log file and
+// sends the log package back to the console so a fatal error is always seen.
+func setupLogging() (func(), error) {
+	cfg := logger.Config{
+		ConsoleLevel: slog.LevelInfo,
+		FileLevel:    slog.LevelDebug,
+	}
+
+	if logConsole {
+		cfg.Console = os.Stderr
+	}
+
+	var rf *logger.RotatingFile
+	if logFile != "" {
+		var err error
+		rf, err = logger.NewRotatingFile(logFile, int64(logMaxSize)<<20, logMaxAge, logBackups)
+		if err != nil {
+			return nil, err
+		}
+		cfg.File = rf
+	}
+
+	if cfg.Console == nil && cfg.File == nil {
+		return nil, errors.New("AGENT_LOG_CONSOLE=false needs AGENT_LOG_FILE, the logs would go nowhere")
+	}
+
+	slog.SetDefault(logger.New(cfg))
+
+	teardown := func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+
+		if rf != nil {
+			rf.Close()
+		}
+	}
+
+	return teardown, nil
+}
+
+// logContext returns a context that carries the session and the turn, so
+// every line logged during the turn can be traced back to it.
+func (a *Agent) logContext(ctx context.Context) context.Context {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return logger.WithTurn(logger.WithSession(ctx, a.sessionID), a.turnNumber)
+}
+
+// WithSessionID sets the id the agent's logs are tagged with. By default a
+// random id is used.
+func WithSessionID(id string) func(a *Agent) {
+	return func(a *Agent) {
+		a.sessionID = id
+	}
+}
+
+// logHooks writes every model and tool call to the log. They are logged at
+// the debug level so they only go to the log file.
+func logHooks() Hooks {
+	return Hooks{
+		AfterModelCall: func(ctx context.Context, call ModelCall) {
+			if call.Err != nil {
+				slog.WarnContext(ctx, "model call failed", "model", model, "latency", call.Latency, "error", call.Err)
+				return
+			}
+
+			slog.DebugContext(ctx, "model call", "model", model, "latency", call.Latency, "tool_calls", call.ToolCalls, "content", call.Content)
+		},
+
+		AfterToolCall: func(ctx context.Context, toolCall client.ToolCall, result client.D, latency time.Duration) {
+			slog.DebugContext(ctx, "tool call", "tool", toolCall.Function.Name, "id", toolCall.ID, "arguments", toolCall.Function.Arguments, "latency", latency, "result", result["content"])
+		},
+	}
+}
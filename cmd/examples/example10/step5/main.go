@@ -8,6 +8,156 @@
 //
 //	$ make example10-step5
 //
+// # Running a single prompt for scripting:
+//
+//	$ go run cmd/examples/example10/step5/*.go -p "List the Go files in foundation/vector"
+//	$ echo "Explain foundation/vector/vector.go" | go run cmd/examples/example10/step5/*.go -p -
+//	$ go run cmd/examples/example10/step5/*.go -p "List the Go files in foundation/vector" -output json
+//	$ go run cmd/examples/example10/step5/*.go -p "List the Go files in foundation/vector" -output jsonl
+//	$ go run cmd/examples/example10/step5/*.go -p "What does this project do?" -tool tool_search_files
+//
+// # Benchmarking the agent on coding scenarios and reporting the pass rate:
+//
+//	$ go run cmd/examples/example10/step5/*.go -scenarios zarf/scenarios/scenarios.jsonl
+//	$ go run cmd/examples/example10/step5/*.go -scenarios zarf/scenarios/scenarios.jsonl -output json
+//
+// # Running without writing files, safe for demos against real repos:
+//
+//	$ go run cmd/examples/example10/step5/*.go -dry-run
+//
+// # Resuming a chat session after a crash or restart:
+//
+//	$ go run cmd/examples/example10/step5/*.go -resume session.json
+//
+// # Running the agent as a daemon with a REST API:
+//
+//	$ go run cmd/examples/example10/step5/*.go -daemon localhost:8090
+//
+// # Running the daemon for a classroom, every user has a token and a workspace:
+//
+//	$ AGENT_USERS_FILE=zarf/users/users.yaml go run cmd/examples/example10/step5/*.go -daemon localhost:8090
+//
+// # Sharing one GPU between the sessions of the daemon, two requests at a time:
+//
+//	$ AGENT_MODEL_SLOTS=2 go run cmd/examples/example10/step5/*.go -daemon localhost:8090
+//
+// # Running the agent as a daemon with a gRPC API:
+//
+//	$ go run cmd/examples/example10/step5/*.go -grpc localhost:9090
+//	$ go run cmd/tools/agentctl/main.go -host localhost:9090
+//
+// # Running a workshop in another language, the model still works in English:
+//
+//	$ AGENT_LANGUAGE=Spanish go run cmd/examples/example10/step5/*.go
+//
+// # Running with a theme for projectors, or without colors:
+//
+//	$ AGENT_THEME=high-contrast go run cmd/examples/example10/step5/*.go
+//	$ AGENT_THEME=no-color go run cmd/examples/example10/step5/*.go
+//	$ AGENT_THEME=zarf/themes/presenter.json go run cmd/examples/example10/step5/*.go
+//
+// The theme can also be kept in theme.json in the ardanlabs-agent directory
+// of the user's config directory, like ~/.config/ardanlabs-agent/theme.json.
+//
+// # Keeping a rotated log of every model and tool call for long sessions:
+//
+//	$ AGENT_LOG_FILE=logs/agent.log AGENT_LOG_CONSOLE=false go run cmd/examples/example10/step5/*.go
+//
+// # Connecting to a llama.cpp server listening on a unix socket:
+//
+//	$ llama-server -m model.gguf --host /tmp/llama.sock
+//	$ AGENT_UNIX_SOCKET=/tmp/llama.sock AGENT_URL=http://localhost/v1/chat/completions go run cmd/examples/example10/step5/*.go
+//
+// # Running against an approved model on AWS Bedrock or Google Vertex AI:
+//
+//	$ AGENT_TRANSPORT=bedrock AWS_REGION=us-east-1 BEDROCK_MODEL_ID=us.anthropic.claude-sonnet-4-20250514-v1:0 go run cmd/examples/example10/step5/*.go
+//	$ AGENT_TRANSPORT=vertex GOOGLE_CLOUD_PROJECT=my-project VERTEX_MODEL=gemini-2.5-flash go run cmd/examples/example10/step5/*.go
+//
+// # Answering repeated questions from a semantic cache instead of the model:
+//
+//	$ AGENT_SEMANTIC_CACHE=true AGENT_SEMANTIC_CACHE_TTL=30m go run cmd/examples/example10/step5/*.go
+//
+// # Keeping large search results out of the context, only their summary is added:
+//
+//	$ AGENT_SUBCONTEXT_TOOLS=tool_search_files,tool_http_request go run cmd/examples/example10/step5/*.go
+//
+// # Loading skill packs that add prompts, tools and defaults for a kind of work:
+//
+//	$ AGENT_SKILLS=go-backend go run cmd/examples/example10/step5/*.go
+//
+// # Adding tools written in another language that run as plugin processes:
+//
+//	$ AGENT_TOOL_PLUGINS="python3 zarf/plugins/textstats.py" go run cmd/examples/example10/step5/*.go
+//
+// # Keeping the model loaded for a long session, or unloading it when the chat ends:
+//
+//	$ AGENT_KEEP_ALIVE=2h go run cmd/examples/example10/step5/*.go
+//	$ AGENT_UNLOAD_ON_EXIT=true go run cmd/examples/example10/step5/*.go
+//
+// # Reproducing a demo run exactly, the seed of every response is saved with the session:
+//
+//	$ AGENT_SEED=42 go run cmd/examples/example10/step5/*.go
+//
+// # Letting the agent run containers with more resources, when docker is installed:
+//
+//	$ AGENT_DOCKER_CPUS=2 AGENT_DOCKER_MEMORY=1g go run cmd/examples/example10/step5/*.go
+//
+// # Inspecting the Kubernetes cluster of the current kubecontext, read only:
+//
+//	$ AGENT_PERSONA=ops go run cmd/examples/example10/step5/*.go
+//
+// # Letting every persona inspect the cluster, not only ops:
+//
+//	$ AGENT_KUBECTL=true go run cmd/examples/example10/step5/*.go
+//
+// # Setting the model parameters only Ollama knows:
+//
+//	$ AGENT_OLLAMA_OPTIONS='{"num_ctx": 32768, "num_gpu": 99, "num_thread": 8}' go run cmd/examples/example10/step5/*.go
+//
+// # Showing the values of the workspace's .env files, which are masked by default:
+//
+//	$ AGENT_SECRET_GUARD=false go run cmd/examples/example10/step5/*.go
+//
+// # Running in an air-gapped training, nothing but the model server is reached:
+//
+//	$ AGENT_OFFLINE=true go run cmd/examples/example10/step5/*.go
+//	$ AGENT_OFFLINE=true AGENT_OFFLINE_HOSTS=embed.lab.local go run cmd/examples/example10/step5/*.go
+//
+// # Sending only the tools relevant to each request, to keep the requests small:
+//
+//	$ AGENT_TOOL_TOP_K=6 AGENT_TOOL_PINNED=tool_read_file go run cmd/examples/example10/step5/*.go
+//
+// # Adding tools that run shell commands, declared in a YAML file:
+//
+//	$ AGENT_TOOLS_FILE=zarf/tools/tools.yaml go run cmd/examples/example10/step5/*.go
+//
+// # Restricting the tools, paths and commands with a policy file:
+//
+//	$ AGENT_POLICY=zarf/policy/policy.yaml go run cmd/examples/example10/step5/*.go
+//
+// # Enabling the gopls tool for diagnostics, hover and rename:
+//
+//	$ go install golang.org/x/tools/gopls@latest
+//
+// # Talking to the agent, this needs a Whisper server and arecord, sox or ffmpeg:
+//
+//	$ whisper-server -m models/ggml-base.en.bin --port 8081 --inference-path /v1/audio/transcriptions
+//	$ go run cmd/examples/example10/step5/*.go -voice
+//
+// # Reading screenshots with Tesseract instead of a vision model:
+//
+//	$ AGENT_OCR=tesseract go run cmd/examples/example10/step5/*.go
+//
+// # Chatting with a database using the sql persona:
+//
+//	$ make example10-step5-db
+//	$ make example10-step5-db DATABASE_URL=sqlite:data.db
+//
+// # Running the agent against a llama.cpp server:
+//
+//	$ make llamacpp-up
+//	$ make example10-step5-llamacpp
+//
 // # This requires running the following commands:
 //
 //	$ make ollama-up  // This starts the Ollama service.
@@ -15,11 +165,20 @@ package main
 
 import (
 	"bufio"
+	"cmp"
 	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"maps"
 	"net/http"
 	"os"
+	"path/filepath"
 	"slices"
 	"strconv"
 	"strings"
@@ -27,12 +186,47 @@ import (
 	"time"
 
 	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/logger"
+	"github.com/ardanlabs/ai-training/foundation/scheduler"
+	"github.com/ardanlabs/ai-training/foundation/stream"
 	"github.com/ardanlabs/ai-training/foundation/tiktoken"
 )
 
-const (
-	url   = "http://localhost:11434/v1/chat/completions"
-	model = "gpt-oss:latest"
+const model = "gpt-oss:latest"
+
+// The url of the model server. This can be changed with the AGENT_URL
+// environment variable to run against a different server.
+var url = "http://localhost:11434/v1/chat/completions"
+
+// The transport used to stream responses from the model. This can be changed
+// with the AGENT_TRANSPORT environment variable to "ws" for gateways that
+// expose chat over WebSocket, "llamacpp" for llama.cpp's native API, or
+// "bedrock" and "vertex" for models on AWS Bedrock and Google Vertex AI,
+// which are configured with the environment variables of their SDKs.
+var transport = client.TransportSSE
+
+// The schema the requests to the model are validated against before they are
+// sent, so a misspelled field fails loudly instead of being ignored by the
+// server. This is turned on with the AGENT_STRICT environment variable set to
+// openai, ollama or llamacpp.
+var strictSchema string
+
+// How much the model should reason before answering and how the setting is
+// passed to the model. These can be changed with the AGENT_REASONING_EFFORT
+// and AGENT_REASONING_PROVIDER environment variables. Models served by
+// Ollama follow the setting in the system prompt.
+var (
+	reasoningEffort   = client.EffortHigh
+	reasoningProvider = client.ProviderPrompt
+)
+
+// The price of the model in dollars per million tokens, used to compute the
+// cost of a turn from the usage reported by the server. These can be changed
+// with the AGENT_PRICE_INPUT and AGENT_PRICE_OUTPUT environment variables.
+// Local models are free.
+var (
+	priceInput  float64
+	priceOutput float64
 )
 
 // The context window represents the maximum number of tokens that can be sent
@@ -48,6 +242,40 @@ func init() {
 			log.Fatal(err)
 		}
 	}
+
+	if v := os.Getenv("AGENT_URL"); v != "" {
+		url = v
+	}
+
+	if v := os.Getenv("AGENT_REASONING_EFFORT"); v != "" {
+		reasoningEffort = v
+	}
+
+	if v := os.Getenv("AGENT_REASONING_PROVIDER"); v != "" {
+		reasoningProvider = v
+	}
+
+	if v := os.Getenv("AGENT_TRANSPORT"); v != "" {
+		transport = v
+	}
+
+	strictSchema = os.Getenv("AGENT_STRICT")
+
+	if v := os.Getenv("AGENT_PRICE_INPUT"); v != "" {
+		var err error
+		priceInput, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_PRICE_OUTPUT"); v != "" {
+		var err error
+		priceOutput, err = strconv.ParseFloat(v, 64)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 // =============================================================================
@@ -59,6 +287,47 @@ func main() {
 }
 
 func run() error {
+	daemon := flag.String("daemon", "", "run as a daemon exposing a REST API on the specified host:port")
+	grpcHost := flag.String("grpc", "", "run as a daemon exposing a gRPC API on the specified host:port")
+	prompt := flag.String("p", "", "run a single prompt to completion and print the answer, use - to read the prompt from stdin")
+	resume := flag.String("resume", "", "resume the chat session saved in the specified file, the session is saved back after every turn")
+	flag.BoolVar(&dryRun, "dry-run", dryRun, "don't execute tools that write files or have side effects, report what they would have done")
+	output := flag.String("output", outputPlain, "output format for one-shot, daemon and scenario modes: plain, json or jsonl")
+	tool := flag.String("tool", "", "force the model to call the specified tool first in one-shot mode")
+	voice := flag.Bool("voice", false, "talk to the agent, press Enter to record from the microphone and Enter again to send")
+	scenarios := flag.String("scenarios", "", "benchmark the agent on the coding scenarios in the specified JSONL file and report the pass rate")
+	flag.Parse()
+
+	teardown, err := setupLogging()
+	if err != nil {
+		return err
+	}
+	defer teardown()
+
+	// -------------------------------------------------------------------------
+	// In daemon mode, sessions are created through the API and each one gets
+	// its own agent.
+
+	switch {
+	case *daemon != "":
+		if err := validateOutput(*output); err != nil {
+			return err
+		}
+		return daemonListenAndServe(*daemon, *output)
+
+	case *grpcHost != "":
+		if users != nil {
+			return errors.New("multi-user mode is only supported by the REST daemon, unset AGENT_USERS_FILE")
+		}
+		return grpcListenAndServe(*grpcHost)
+
+	case *prompt != "":
+		return runOneShot(context.Background(), *prompt, *output, *tool)
+
+	case *scenarios != "":
+		return runScenarios(context.Background(), *scenarios, *output)
+	}
+
 	// -------------------------------------------------------------------------
 	// Declare a function that can accept user input which the agent will use
 	// when it's the users turn.
@@ -72,12 +341,33 @@ func run() error {
 	}
 
 	// -------------------------------------------------------------------------
-	// Construct the agent and get it started.
+	// Construct the agent and get it started. Approvals are always typed, in
+	// voice mode the messages and answers to the agent's questions can be
+	// spoken.
 
-	agent, err := NewAgent(getUserMessage)
+	options := []func(a *Agent){
+		WithConfirm(terminalConfirm(getUserMessage)),
+	}
+	if *resume != "" {
+		options = append(options, WithSessionFile(*resume))
+	}
+	if unloadOnExit {
+		options = append(options, WithUnloadOnExit())
+	}
+
+	if *voice {
+		var err error
+		getUserMessage, err = voiceInput(getUserMessage)
+		if err != nil {
+			return err
+		}
+	}
+
+	agent, err := NewAgent(getUserMessage, options...)
 	if err != nil {
 		return fmt.Errorf("failed to create agent: %w", err)
 	}
+	defer agent.Close()
 
 	return agent.Run(context.TODO())
 }
@@ -89,31 +379,95 @@ type Tool interface {
 	Call(ctx context.Context, toolCall client.ToolCall) client.D
 }
 
+// ToolEvent represents a tool call made by the agent and its result.
+type ToolEvent struct {
+	Time      time.Time      `json:"time"`
+	RequestID string         `json:"request_id,omitempty"`
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+	Result    string         `json:"result"`
+	Injection []string       `json:"injection,omitempty"`
+}
+
 // =============================================================================
 
 // Agent represents the chat agent that can use tools to perform tasks.
 type Agent struct {
-	sseClient      *client.SSEClient[client.ChatSSE]
+	streamer       client.Streamer[stream.Event]
 	getUserMessage func() (string, bool)
+	renderer       Renderer
 	tke            *tiktoken.Tiktoken
 	tools          map[string]Tool
+	hooks          []Hooks
+	confirm        func(prompt string) approval
+	approvals      map[string]bool // Prompts the user approved for the session.
+	quotaUsed      map[string]int  // Calls of the tools with a quota in the policy.
+	translator     *translator
+	trimPolicy     TrimPolicy
+	persona        Persona
+	sampling       Sampling
+	turnSampling   Sampling
+	toolSelection  toolSelection
+	skills         []SkillPack
+	skillTools     map[string]bool
+	routedTools    map[string]bool // Tools with large results summarized in a sub-conversation.
+	summary        sessionSummary
+	subResults     subResults
+	preferences    Preferences
+	forcedTool     string
+	lastResponse   modelResponse
+	lastProblems   []client.ConversationProblem
+	sessionID      string
+	turnNumber     int
+	watcher        *workspaceWatcher
+	workspace      string
+	priority       scheduler.Priority
+	secrets        *secretSet
+	db             *sql.DB
 	toolDocuments  []client.D
+	checkpoints    Checkpoints
+	conversation   []client.D
+	mu             sync.Mutex
+	toolEvents     []ToolEvent
+	turn           TurnResult
+	sessionPath    string
+	unloadOnExit   bool
+}
+
+// WithRenderer sets the renderer used to display the agent's activity. The
+// default renderer writes to the terminal.
+func WithRenderer(renderer Renderer) func(a *Agent) {
+	return func(a *Agent) {
+		a.renderer = renderer
+	}
 }
 
 // NewAgent creates a new instance of Agent.
-func NewAgent(getUserMessage func() (string, bool)) (*Agent, error) {
+func NewAgent(getUserMessage func() (string, bool), options ...func(a *Agent)) (*Agent, error) {
+	if err := checkOffline(); err != nil {
+		return nil, err
+	}
 
 	// -------------------------------------------------------------------------
-	// Construct the SSE client to make model calls.
+	// Construct the streaming client to make model calls.
 
 	logger := func(ctx context.Context, msg string, v ...any) {
-		s := fmt.Sprintf("msg: %s", msg)
-		for i := 0; i < len(v); i = i + 2 {
-			s = s + fmt.Sprintf(", %s: %v", v[i], v[i+1])
-		}
-		log.Println(s)
+		slog.InfoContext(ctx, msg, v...)
+	}
+
+	clientOptions := slices.Clone(httpOptions)
+	if strictSchema != "" {
+		clientOptions = append(clientOptions, client.WithStrict(strictSchema))
 	}
 
+	chatStreamer, err := client.NewStreamer[client.ChatSSE](chatTransport(), logger, clientOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create streamer: %w", err)
+	}
+
+	streamer := stream.New(chatStreamer)
+
 	// -------------------------------------------------------------------------
 	// Construct the tokenizer.
 
@@ -128,299 +482,852 @@ func NewAgent(getUserMessage func() (string, bool)) (*Agent, error) {
 	tools := map[string]Tool{}
 
 	agent := Agent{
-		sseClient:      client.NewSSE[client.ChatSSE](logger),
+		streamer:       streamer,
 		getUserMessage: getUserMessage,
+		renderer:       newTerminalRenderer(),
 		tke:            tke,
 		tools:          tools,
+		translator:     newTranslator(),
 		toolDocuments: []client.D{
 
 			// WE NEED TO REGISTER THE NEW TOOLS WE HAVE CREATED.
 			RegisterReadFile(tools),
+			RegisterFileChunks(tools, tke),
 			RegisterSearchFiles(tools),
 			RegisterCreateFile(tools),
 			RegisterGoCodeEditor(tools),
+			RegisterCodeEditor(tools),
+			RegisterGoSymbols(tools),
+			RegisterCodeReview(tools),
+			RegisterGoDepGraph(tools),
+			RegisterListTasks(tools),
+			RegisterGoMod(tools),
+			RegisterScratchpad(tools),
+			RegisterOCRImage(tools),
+			RegisterHTTPRequest(tools),
+			RegisterServerStatus(tools),
+		},
+		conversation: []client.D{
+			client.System(""),
 		},
+		priority:    scheduler.Normal,
+		sessionID:   rand.Text(),
+		hooks:       []Hooks{logHooks(), protectFiles("go.mod", "go.sum")},
+		routedTools: maps.Clone(subcontextTools),
+	}
+
+	// Reads of the files the model is likely to ask for next are served from
+	// memory.
+	heuristics := []prefetchHeuristic{mentionedPaths{}}
+	if gi := newGoImports(); gi != nil {
+		heuristics = append(heuristics, gi)
+	}
+	withPrefetch(tools, "tool_read_file", heuristics...)
+
+	agent.trimPolicy, err = newTrimPolicy(trimPolicyName, &agent)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := agent.loadSkills(skillNames()); err != nil {
+		return nil, err
+	}
+
+	persona, err := lookupPersona(cmp.Or(defaultPersona, agent.skillsPersona(), "coder"))
+	if err != nil {
+		return nil, err
+	}
+	agent.setPersona(persona)
+
+	// The model can only ask for clarification when there is a user at the
+	// terminal to answer.
+	if getUserMessage != nil {
+		agent.toolDocuments = append(agent.toolDocuments, RegisterAskUser(tools, terminalAsk(getUserMessage)))
+	}
+
+	// Summarized tool results can only be read back when some tools are
+	// routed to a sub-conversation.
+	if len(agent.routedTools) > 0 {
+		agent.toolDocuments = append(agent.toolDocuments, RegisterRawResult(tools, &agent))
+	}
+
+	// The docker tool is only available when docker is installed.
+	if doc, ok := RegisterDocker(tools); ok {
+		agent.toolDocuments = append(agent.toolDocuments, doc)
+	}
+
+	// Tools written in other languages run in plugin processes.
+	if len(toolPlugins) > 0 {
+		docs, err := RegisterToolPlugins(tools, toolPlugins)
+		if err != nil {
+			return nil, err
+		}
+		agent.toolDocuments = append(agent.toolDocuments, docs...)
+	}
+
+	// From here on the plugin processes are stopped if the agent can't be
+	// created.
+	fail := func(err error) (*Agent, error) {
+		agent.Close()
+		return nil, err
+	}
+
+	// Tools declared in the tools file run shell commands.
+	if len(commandToolDefs) > 0 {
+		docs, err := RegisterCommandTools(tools, commandToolDefs)
+		if err != nil {
+			return fail(err)
+		}
+		agent.toolDocuments = append(agent.toolDocuments, docs...)
+	}
+
+	// The database tool is only available when a database is configured.
+	if databaseURL != "" {
+		db, dialect, err := openDatabase(databaseURL)
+		if err != nil {
+			return fail(err)
+		}
+
+		agent.db = db
+		agent.toolDocuments = append(agent.toolDocuments, RegisterQueryDatabase(tools, db, dialect))
+	}
+
+	for _, option := range options {
+		option(&agent)
+	}
+
+	// -------------------------------------------------------------------------
+	// Load what comes from the workspace, the current directory unless the
+	// options set one, and watch it for changes made outside of the agent.
+
+	root, err := filepath.Abs(agent.workspace)
+	if err != nil {
+		return fail(fmt.Errorf("failed to get working directory: %w", err))
+	}
+
+	// The secrets of the workspace are masked in what the agent shows and
+	// keeps in the conversation.
+	if secretGuard {
+		agent.secrets, err = loadSecrets(root)
+		if err != nil {
+			return fail(fmt.Errorf("failed to load secrets: %w", err))
+		}
+	}
+
+	// Watching can fail, like when the inotify limits are reached, the agent
+	// works without reporting the user's changes then.
+	watcher, err := newWorkspaceWatcher(root)
+	switch {
+	case err != nil:
+		agent.renderer.Warning(fmt.Sprintf("the changes made to the workspace are not reported to the model: %s", err))
+
+	default:
+		agent.watcher = watcher
+		agent.toolDocuments = append(agent.toolDocuments, RegisterWorkspaceChanges(tools, watcher))
+	}
+
+	// The gopls tool is only available when gopls is installed.
+	if doc, ok := RegisterGopls(tools, root); ok {
+		agent.toolDocuments = append(agent.toolDocuments, doc)
+	}
+
+	// The kubectl tool reaches the cluster, it is only available to the
+	// personas that list it unless it is enabled for every persona, and when
+	// there is a kubecontext.
+	if kubectlEnabled || slices.Contains(agent.persona.Tools, "tool_kubectl_get") {
+		if doc, ok := RegisterKubectlGet(tools); ok {
+			agent.toolDocuments = append(agent.toolDocuments, doc)
+		}
+	}
+
+	// What the model learns about the user is only kept when there is a
+	// preferences file.
+	agent.preferences = Preferences{path: userPreferencesFile(root)}
+	if agent.preferences.path != "" {
+		agent.toolDocuments = append(agent.toolDocuments, RegisterRememberPreference(tools, agent.preferences))
+	}
+	agent.refreshSystemPrompt()
+
+	if agent.sessionPath != "" {
+		switch _, err := os.Stat(agent.sessionPath); {
+		case err == nil:
+			if err := agent.Resume(agent.sessionPath); err != nil {
+				return fail(fmt.Errorf("failed to resume session: %w", err))
+			}
+
+		case !errors.Is(err, os.ErrNotExist):
+			return fail(fmt.Errorf("failed to resume session: %w", err))
+		}
 	}
 
 	return &agent, nil
 }
 
-// The system prompt for the model so it behaves as expected.
-var systemPrompt = `You are a helpful coding assistant that has tools to assist
-you in coding.
+// Close releases the resources held by the agent and its tools.
+func (a *Agent) Close() error {
+	a.stopSummary()
+
+	if a.unloadOnExit {
+		a.unloadModel()
+	}
+
+	if a.db != nil {
+		a.db.Close()
+	}
+
+	for _, tool := range a.tools {
+		if c, ok := tool.(io.Closer); ok {
+			c.Close()
+		}
+	}
 
-After you request a tool call, you will receive a JSON document with two fields,
-"status" and "data". Always check the "status" field to know if the call "SUCCEED"
-or "FAILED". The information you need to respond will be provided under the "data"
+	return a.watcher.Close()
+}
+
+// The instructions for using tools that are added to the system prompt of
+// every persona.
+const toolPrompt = `After you request a tool call, you will receive a JSON document with the fields
+"version", "status" and "data". Always check the "status" field to know if the call
+"SUCCESS" or "FAILED". The information you need to respond will be provided under the "data"
 field. If the called "FAILED", just inform the user and don't try using the tool
 again for the current response.
 
-When reading Go source code always start counting lines of code from the top of
-the source code file.
-
 If you get back results from a tool call, do not verify the results.
 
-Reasoning: high
+A result that starts with STALE is a copy of a file that changed since, read the
+file again before using its contents.
 `
 
 // Run starts the agent and runs the chat loop.
 func (a *Agent) Run(ctx context.Context) error {
-	var conversation []client.D // History of the conversation
-	var reasonContent []string  // Reasoning content per model call
-	var inToolCall bool         // Need to know we are inside a tool call request
+	fmt.Printf("\nChat with %s (use 'ctrl-c' to quit, '/help' for commands)\n", model)
 
-	conversation = append(conversation, client.D{
-		"role":    "system",
-		"content": systemPrompt,
-	})
+	if dryRun {
+		a.renderer.Info("dry-run mode: files will not be written and requests with side effects will not be sent")
+	}
 
-	fmt.Printf("\nChat with %s (use 'ctrl-c' to quit)\n", model)
+	if a.translator != nil {
+		a.renderer.Info(fmt.Sprintf("translating between %s and English with %s", a.translator.language, a.translator.model))
+	}
 
-	timeForResult := time.NewTicker(100 * time.Millisecond)
+	if a.sessionPath != "" && len(a.conversation) > 1 {
+		a.renderer.Info(fmt.Sprintf("resumed session %s with %d messages", a.sessionPath, len(a.conversation)-1))
+	}
+
+	a.warmUp(ctx)
 
 	for {
 		// ---------------------------------------------------------------------
-		// If we are not in a tool call then we can ask the user
-		// to provide their next question or request.
+		// Ask the user to provide their next question or request.
+
+		fmt.Printf("\n%s: ", paint(theme.User, "You"))
+		userInput, ok := a.getUserMessage()
+		if !ok {
+			break
+		}
+
+		// Commands are handled by the agent and never sent to the model.
+		if strings.HasPrefix(userInput, "/") {
+			a.runCommand(ctx, userInput)
+			continue
+		}
+
+		if err := a.Turn(ctx, userInput); err != nil {
+			a.renderer.Error(err)
+		}
+	}
+
+	return nil
+}
+
+// Turn processes a single user request. The model is called until it stops
+// asking for tool calls and provides an answer.
+func (a *Agent) Turn(ctx context.Context, userInput string) error {
+
+	// Every user request starts a new agent turn so we need a new checkpoint
+	// to capture any files the model changes.
+	a.checkpoints.Begin()
+
+	// The session is saved even if the turn fails so it can be resumed.
+	defer a.autosave()
+
+	a.beginTurn()
+	defer a.endTurn()
+
+	// A sampling override for the turn is only used once.
+	defer a.OverrideTurn(Sampling{})
+
+	// Every line logged during the turn is tagged with the session and turn.
+	ctx = a.logContext(ctx)
+
+	// Pick up the latest session summary if it's part of the system prompt.
+	a.refreshSystemPrompt()
+	defer a.scheduleSummary()
+
+	userInput = a.translateInput(ctx, userInput)
+
+	// Only the tools relevant to the request are sent when there are many.
+	a.selectTools(ctx, userInput)
+
+	// A question similar enough to one answered before is answered from the
+	// semantic cache without calling the model.
+	embedding, cached := a.answerFromCache(ctx, userInput)
+	if cached {
+		return nil
+	}
+
+	a.conversation = append(a.conversation, withMeta(client.User(userInput), MessageMeta{
+		Time:   time.Now().UTC(),
+		Tokens: a.tke.TokenCount(userInput),
+	}))
+
+	start := time.Now()
+
+	for iterations := 1; ; iterations++ {
+		inToolCall, err := a.callModel(ctx, true)
+		if err != nil {
+			return err
+		}
 
 		if !inToolCall {
-			fmt.Print("\u001b[94m\nYou\u001b[0m: ")
-			userInput, ok := a.getUserMessage()
-			if !ok {
-				break
+			if err := a.continueAnswer(ctx); err != nil {
+				return err
 			}
 
-			conversation = append(conversation, client.D{
-				"role":    "user",
-				"content": userInput,
-			})
+			a.cacheAnswer(userInput, embedding)
+			a.translateAnswer(ctx)
+			a.reportUsage()
+			return nil
+		}
+
+		if limit := turnLimit(iterations, time.Since(start)); limit != "" {
+			return a.stopTurn(ctx, limit)
 		}
 
-		inToolCall = false
+		// What the tools returned can call for other tools.
+		a.selectTools(ctx, a.roundText(userInput))
+	}
+}
 
-		// ---------------------------------------------------------------------
-		// Let's show how long we are waiting for the model response.
+// callModel makes a single call to the model with the current conversation.
+// It returns true if the model requested tool calls and needs to be called
+// again with the results. The tools are left out of the request when the
+// model must answer without them.
+func (a *Agent) callModel(ctx context.Context, withTools bool) (bool, error) {
+	var reasonContent []string // Reasoning content per model call
+	var inToolCall bool        // Need to know we are inside a tool call request
+
+	// Every model call gets its own request id. It's sent to the server in
+	// the X-Request-ID header, added to the lines logged during the call and
+	// attached to the tool calls the model asks for, so a call can be
+	// followed through the server's logs and ours.
+	requestID := rand.Text()
+	ctx = logger.WithRequestID(client.WithRequestID(ctx, requestID), requestID)
+
+	if rr, ok := a.renderer.(requestRenderer); ok {
+		rr.ModelRequest(requestID)
+	}
 
-		wctx, cancelTimer := context.WithCancel(ctx)
-		timeForResult.Reset(100 * time.Millisecond)
-		start := time.Now()
+	// The files the user changed since the last call are out of date in
+	// the conversation.
+	a.expireFiles(a.watcher.changedFiles())
 
-		var wg sync.WaitGroup
-		wg.Go(func() {
-			for {
-				select {
-				case <-timeForResult.C:
-					m := time.Since(start).Milliseconds()
-					fmt.Printf("\r\u001b[93m%s %d.%03d\u001b[0m: ", model, m/1000, m%1000)
-
-				case <-wctx.Done():
-					fmt.Print("\n")
-					timeForResult.Stop()
-					cancelTimer()
-					return
-				}
+	// -------------------------------------------------------------------------
+	// Let's show how long we are waiting for the model response.
+
+	wctx, cancelTimer := context.WithCancel(ctx)
+	timeForResult := time.NewTicker(100 * time.Millisecond)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for {
+			select {
+			case <-timeForResult.C:
+				a.renderer.Waiting(model, time.Since(start))
+
+			case <-wctx.Done():
+				timeForResult.Stop()
+				return
 			}
-		})
+		}
+	})
 
-		// ---------------------------------------------------------------------
-		// Now we will make a call to the model, we could be responding to a
-		// tool call or providing a user request.
-
-		d := client.D{
-			"model":          model,
-			"messages":       conversation,
-			"max_tokens":     contextWindow,
-			"temperature":    0.0,
-			"top_p":          0.1,
-			"top_k":          1,
-			"stream":         true,
-			"tools":          a.toolDocuments,
-			"tool_selection": "auto",
-		}
-
-		fmt.Printf("\u001b[93m\n%s\u001b[0m: 0.000", model)
-
-		ch := make(chan client.ChatSSE, 100)
-		ctx, cancelDoCall := context.WithTimeout(ctx, time.Minute*5)
-
-		if err := a.sseClient.Do(ctx, http.MethodPost, url, d, ch); err != nil {
-			fmt.Printf("\n\n\u001b[91mERROR:%s\u001b[0m\n\n", err)
-			inToolCall = false
-			cancelDoCall()
-			continue
+	stopTimer := sync.OnceFunc(func() {
+		cancelTimer()
+		wg.Wait()
+	})
+	defer stopTimer()
+
+	// -------------------------------------------------------------------------
+	// Now we will make a call to the model, we could be responding to a
+	// tool call or providing a user request.
+
+	// Patterns providers reject, like two user messages in a row after a
+	// rollback, are repaired in the copy that is sent. The same problems are
+	// only reported once.
+	messages, problems := client.RepairConversation(wireMessages(a.conversation))
+	if !slices.Equal(problems, a.lastProblems) {
+		for _, problem := range problems {
+			a.renderer.Info(fmt.Sprintf("repaired conversation: %s", problem))
 		}
+		a.lastProblems = problems
+	}
 
-		// ---------------------------------------------------------------------
-		// Now we will make a call to the model.
+	temperature, topP, topK := a.currentSampling()
+
+	d := client.ChatRequest(model, messages,
+		client.WithMaxTokens(cmp.Or(maxTokens, contextWindow)),
+		client.WithTemperature(temperature),
+		client.WithTopP(topP),
+		withTopK(topK),
+		client.WithStream(true),
+		client.WithStreamUsage(),
+		client.WithReasoningEffort(reasoningProvider, reasoningEffort),
+		withKeepAlive,
+		withOllamaOptions,
+		a.withSeed,
+	)
+
+	if withTools {
+		client.WithTools(a.activeToolDocuments())(d)
+		client.WithToolChoice(a.toolChoice())(d)
+	}
 
-		var chunks []string      // Store the response chunks since we are streaming.
-		reasonThinking := false  // GPT models provide a Reasoning field.
-		contentThinking := false // Other reasoning models use <think> tags.
-		reasonContent = nil      // Reset the reasoning content for this next call.
+	if err := a.beforeModelCall(ctx, d); err != nil {
+		return false, fmt.Errorf("before model call: %w", err)
+	}
 
-		// ---------------------------------------------------------------------
-		// Process the response which comes in as chunks. So we need to process
-		// and save each chunk.
+	a.renderer.Waiting(model, 0)
 
-		waitingForResponse := true
+	inputTokens := conversationTokens(a.conversation, a.messageTokens)
 
-		for resp := range ch {
-			if len(resp.Choices) == 0 {
-				continue
+	// When sessions share the model server, the request waits for its turn.
+	// The slot is held until the stream is read, the tools run without it.
+	slotCtx, release, err := a.acquireModel(ctx, a.priority)
+	if err != nil {
+		a.afterModelCall(ctx, ModelCall{RequestID: requestID, Latency: time.Since(start), Err: err})
+		return false, err
+	}
+	defer release()
+
+	ch := make(chan stream.Event, 100)
+	streamCtx, cancelDoCall := context.WithTimeout(slotCtx, time.Minute*5)
+	defer cancelDoCall()
+
+	if err := a.streamer.Do(streamCtx, http.MethodPost, url, d, ch); err != nil {
+		a.afterModelCall(ctx, ModelCall{RequestID: requestID, Latency: time.Since(start), Err: err})
+		return false, err
+	}
+
+	// -------------------------------------------------------------------------
+	// Process the response which comes in as events. So we need to process
+	// and save each event.
+
+	var chunks []string             // Store the response chunks since we are streaming.
+	var toolCalls []client.ToolCall // Tool calls to run once the stream is read.
+	var usage *client.Usage         // Usage reported by the server, if any.
+	var finishReason string         // Why the model stopped, "length" if it was cut off.
+	var streamErr error             // Error the server sent in the stream, if any.
+
+	contentSecrets := secretStream{secrets: a.secrets}
+	reasonSecrets := secretStream{secrets: a.secrets}
+
+	for evt := range ch {
+
+		// Check if this is the first response. If it is, we will shutdown
+		// the G displaying the latency.
+		stopTimer()
+
+		switch evt.Kind {
+
+		// Did the model ask us to execute a tool call? The call waits for
+		// the end of the stream.
+		case stream.ToolCallDelta:
+			toolCalls = append(toolCalls, evt.ToolCalls...)
+
+		// The secrets of the workspace are masked before they are shown,
+		// the end of a chunk that could start a secret is held back until
+		// the next one.
+		case stream.ContentDelta:
+			if text := contentSecrets.write(evt.Text); text != "" {
+				a.renderer.Content(text)
+				chunks = append(chunks, text)
 			}
 
-			// Check if this is the first response. If it is, we will shutdown
-			// the G displaying the latency.
-			if waitingForResponse {
-				waitingForResponse = false
-				cancelTimer()
-				wg.Wait()
+		// Reasoning is displayed in a different color. The stream package
+		// handles models that use <think> tags in the content.
+		case stream.ReasoningDelta:
+			if text := reasonSecrets.write(evt.Text); text != "" {
+				reasonContent = append(reasonContent, text)
+				a.renderer.Reasoning(text)
 			}
 
-			switch {
+		// Some servers report the tokens used in a final chunk.
+		case stream.UsageUpdate:
+			usage = &evt.Usage
+
+		case stream.Done:
+			finishReason = evt.FinishReason
+
+		// The server can fail halfway through a response, like when the
+		// model is overloaded. What was streamed so far is kept.
+		case stream.Error:
+			streamErr = evt.Err
+			a.renderer.Error(evt.Err)
+		}
+	}
+
+	if text := reasonSecrets.flush(); text != "" {
+		reasonContent = append(reasonContent, text)
+		a.renderer.Reasoning(text)
+	}
 
-			// Did the model ask us to execute a tool call?
-			case len(resp.Choices[0].Delta.ToolCalls) > 0:
-				fmt.Print("\n\n")
+	if text := contentSecrets.flush(); text != "" {
+		a.renderer.Content(text)
+		chunks = append(chunks, text)
+	}
 
-				toolCall := resp.Choices[0].Delta.ToolCalls[0]
+	a.renderer.Done()
 
-				conversation = a.addToConversation(reasonContent, conversation, client.D{
-					"role": "assistant",
-					"content": fmt.Sprintf("Tool call %s: %s(%v)",
-						toolCall.ID,
-						toolCall.Function.Name,
-						toolCall.Function.Arguments),
-				})
+	// The response is read, the other sessions can use the model while the
+	// tools run.
+	release()
 
-				results := a.callTools(ctx, resp.Choices[0].Delta.ToolCalls)
-				if len(results) > 0 {
-					conversation = a.addToConversation(reasonContent, conversation, results...)
-					inToolCall = true
-				}
+	content := strings.Join(chunks, "")
+	content = strings.TrimLeft(content, "\n")
 
-			// Did we get content? With some models a <think> tag could exist to
-			// indicate reasoning. We need to filter that out and display it as
-			// a different color.
-			case resp.Choices[0].Delta.Content != "":
-				if reasonThinking {
-					reasonThinking = false
-					fmt.Print("\n\n")
-				}
+	a.recordModelCall(
+		inputTokens,
+		a.tke.TokenCount(content),
+		a.tke.TokenCount(strings.Join(reasonContent, "")),
+		usage,
+		time.Since(start))
 
-				switch resp.Choices[0].Delta.Content {
-				case "<think>":
-					contentThinking = true
-					continue
-				case "</think>":
-					contentThinking = false
-					continue
-				}
+	a.afterModelCall(ctx, ModelCall{
+		RequestID: requestID,
+		Latency:   time.Since(start),
+		Content:   content,
+		ToolCalls: len(toolCalls) > 0,
+		Err:       cmp.Or(streamCtx.Err(), streamErr),
+	})
 
-				switch {
-				case !contentThinking:
-					fmt.Print(resp.Choices[0].Delta.Content)
-					chunks = append(chunks, resp.Choices[0].Delta.Content)
+	if streamCtx.Err() != nil {
+		return false, streamCtx.Err()
+	}
 
-				case contentThinking:
-					reasonContent = append(reasonContent, resp.Choices[0].Delta.Content)
-					fmt.Printf("\u001b[91m%s\u001b[0m", resp.Choices[0].Delta.Content)
-				}
+	// -------------------------------------------------------------------------
+	// Execute the tool calls the model asked for, each result follows its
+	// request in the conversation.
 
-			// Did we get reasoning content? ChatGPT models provide reasoning in
-			// the Delta.Reasoning field. Display it as a different color.
-			case resp.Choices[0].Delta.Reasoning != "":
-				reasonThinking = true
+	for _, toolCall := range toolCalls {
+		content := a.secrets.mask(fmt.Sprintf("Tool call %s: %s(%v)",
+			toolCall.ID,
+			toolCall.Function.Name,
+			toolCall.Function.Arguments))
 
-				if len(reasonContent) == 0 {
-					fmt.Print("\n")
-				}
+		a.addToConversation(ctx, reasonContent, withMeta(client.Assistant(content), a.modelMeta(start, content)))
 
-				reasonContent = append(reasonContent, resp.Choices[0].Delta.Reasoning)
-				fmt.Printf("\u001b[91m%s\u001b[0m", resp.Choices[0].Delta.Reasoning)
-			}
+		results := a.callTools(ctx, []client.ToolCall{toolCall})
+		if len(results) > 0 {
+			a.addToConversation(ctx, reasonContent, results...)
+			inToolCall = true
 		}
+	}
 
-		cancelDoCall()
-
-		// ---------------------------------------------------------------------
-		// We processed all the chunks from the response so we need to add
-		// this to the conversation history.
+	if finishReason == client.FinishContentFilter {
+		a.renderer.Info("the answer was stopped by the server's content filter, try rephrasing the request")
+	}
 
-		if !inToolCall && len(chunks) > 0 {
-			fmt.Print("\n")
+	// -------------------------------------------------------------------------
+	// We processed all the chunks from the response so we need to add
+	// this to the conversation history. The content is cleaned up first so
+	// filler doesn't cost tokens on every call that follows. The raw content
+	// is kept to stitch an answer that was cut off with its continuation.
+
+	a.lastResponse = modelResponse{
+		content:      content,
+		finishReason: finishReason,
+	}
 
-			content := strings.Join(chunks, " ")
-			content = strings.TrimLeft(content, "\n")
+	content = postProcess(content)
 
-			if content != "" {
-				conversation = a.addToConversation(reasonContent, conversation, client.D{
-					"role":    "assistant",
-					"content": content,
-				})
-			}
+	if !inToolCall && len(chunks) > 0 {
+		if content != "" {
+			a.addToConversation(ctx, reasonContent, withMeta(client.Assistant(content), a.modelMeta(start, content)))
 		}
 	}
 
-	return nil
+	return inToolCall, nil
+}
+
+// modelMeta constructs the metadata for a message produced by the model.
+func (a *Agent) modelMeta(start time.Time, content string) MessageMeta {
+	return MessageMeta{
+		Time:    time.Now().UTC(),
+		Latency: time.Since(start),
+		Model:   model,
+		Tokens:  a.tke.TokenCount(content),
+		Seed:    a.currentSeed(),
+	}
 }
 
 // addToConversation will add new messages to the conversation history and
 // calculate the different tokens used in the conversation and display it to the
 // user. It will also check the amount of input tokens currently in history
-// and remove the oldest messages if we are over.
-func (a *Agent) addToConversation(reasoning []string, conversation []client.D, newMessages ...client.D) []client.D {
-	conversation = append(conversation, newMessages...)
+// and trim the conversation using the trim policy if we are over.
+func (a *Agent) addToConversation(ctx context.Context, reasoning []string, newMessages ...client.D) {
+	a.conversation = append(a.conversation, newMessages...)
 
-	fmt.Print("\n")
-
-	for {
-		var currentWindow int
-		for _, msg := range conversation {
-			currentWindow += a.tke.TokenCount(msg["content"].(string))
-		}
-
-		r := strings.Join(reasoning, " ")
-		reasonTokens := a.tke.TokenCount(r)
+	r := strings.Join(reasoning, "")
+	reasonTokens := a.tke.TokenCount(r)
 
+	info := func(currentWindow int) {
 		totalTokens := currentWindow + reasonTokens
 		percentage := (float64(currentWindow) / float64(contextWindow)) * 100
 		of := float32(contextWindow) / float32(1024)
 
-		fmt.Printf("\u001b[90mTokens Total[%d] Reason[%d] Window[%d] (%.0f%% of %.0fK)\u001b[0m\n", totalTokens, reasonTokens, currentWindow, percentage, of)
+		temperature, topP, topK := a.currentSampling()
 
-		// ---------------------------------------------------------------------
-		// Check if we have too many input tokens and start removing messages.
+		a.renderer.Info(fmt.Sprintf("Tokens Total[%d] Reason[%d] Window[%d] (%.0f%% of %.0fK) Temp[%.2g] TopP[%.2g] TopK[%d]", totalTokens, reasonTokens, currentWindow, percentage, of, temperature, topP, topK))
+	}
 
-		if currentWindow > contextWindow {
-			fmt.Print("\u001b[90mRemoving conversation history\u001b[0m\n")
-			conversation = slices.Delete(conversation, 1, 2)
-			continue
+	currentWindow := conversationTokens(a.conversation, a.messageTokens)
+	info(currentWindow)
+
+	// -------------------------------------------------------------------------
+	// Check if we have too many input tokens and trim the conversation.
+
+	if currentWindow > contextWindow {
+		a.renderer.Info(fmt.Sprintf("Trimming conversation history using the %q policy", trimPolicyName))
+		a.injectSummary()
+
+		// Stale tool results go first, the model has to read those files
+		// again anyway.
+		var dropped int
+		a.conversation, dropped = dropStale(a.conversation, contextWindow, a.messageTokens)
+		if dropped > 0 {
+			a.renderer.Info(fmt.Sprintf("Removed %d stale tool results", dropped))
 		}
 
-		break
+		if conversationTokens(a.conversation, a.messageTokens) > contextWindow {
+			a.conversation = trimPinned(ctx, a.trimPolicy, a.conversation, contextWindow, a.messageTokens)
+		}
+		info(conversationTokens(a.conversation, a.messageTokens))
 	}
+}
 
-	return conversation
+// messageTokens returns the number of tokens in the content of the message.
+func (a *Agent) messageTokens(msg client.D) int {
+	content, _ := msg["content"].(string)
+	return a.tke.TokenCount(content)
 }
 
 // callTools will lookup a requested tool by name and call it.
 func (a *Agent) callTools(ctx context.Context, toolCalls []client.ToolCall) []client.D {
 	var resps []client.D
 
+	// In multi-user mode the tools work in the user's workspace.
+	ctx = withWorkspace(ctx, a.workspace)
+
 	for _, toolCall := range toolCalls {
+		a.renderer.ToolCall(toolCall)
+
+		start := time.Now()
+
 		tool, exists := a.tools[toolCall.Function.Name]
-		if !exists {
-			continue
+		if !a.allowsTool(toolCall.Function.Name) {
+			exists = false
+		}
+
+		var resp client.D
+		switch {
+		case !exists:
+			// Tell the model which tools exist so it can correct itself
+			// instead of waiting on a result that will never come.
+			resp = a.unknownToolResponse(toolCall)
+
+		case policy != nil && a.deniedByPolicy(tool, toolCall, &resp):
+			// The policy file doesn't allow the call, the model is told
+			// which rule denied it.
+
+		case offline && usesNetwork(tool, toolCall):
+			// Offline mode only reaches the model server, the model is
+			// told to answer without the tool.
+			resp = offlineResponse(toolCall)
+
+		case a.persona.ReadOnly && changesFiles(tool, toolCall):
+			// A read-only persona can still have tools that write files for
+			// some of their actions, like a gopls rename.
+			resp = toolErrorResponse(toolCall.ID, toolCall.Function.Name, fmt.Errorf("the %s persona can't change files", a.persona.Name))
+
+		case dryRun && isMutation(tool, toolCall):
+			// The call would have changed something, tell the model what
+			// instead of executing it.
+			resp = dryRunResponse(tool, toolCall)
+
+		default:
+			// A hook can veto the call, let the model know why.
+			if err := a.beforeToolCall(ctx, toolCall, tool); err != nil {
+				resp = toolErrorResponse(toolCall.ID, toolCall.Function.Name, fmt.Errorf("tool call blocked: %w", err))
+				break
+			}
+
+			// Commands like go get only run once the user approves them.
+			if err := a.confirmed(tool, toolCall); err != nil {
+				resp = toolErrorResponse(toolCall.ID, toolCall.Function.Name, err)
+				break
+			}
+
+			// The model only saw the secrets masked, their values are put
+			// back so an edit doesn't replace a secret with its placeholder.
+			call := toolCall
+			fm, ok := tool.(fileModifier)
+			if ok {
+				var err error
+				if call, err = a.secrets.restoreArguments(toolCall); err != nil {
+					resp = toolErrorResponse(toolCall.ID, toolCall.Function.Name, err)
+					break
+				}
+			}
+
+			// Capture the files this tool will change so the user can rollback
+			// and the watcher doesn't report the agent's own edits.
+			if ok {
+				if err := a.checkpoints.Snapshot(workspacePaths(ctx, fm.modifiedPaths(toolCall))...); err != nil {
+					a.renderer.Error(fmt.Errorf("checkpoint: %w", err))
+				}
+				a.watcher.ownEdit(workspacePaths(ctx, fm.modifiedPaths(toolCall))...)
+			}
+
+			// The call is limited through the context, so a hung tool is
+			// cut off instead of holding the turn. A timeout of zero turns
+			// the limit off.
+			callCtx, cancel := ctx, context.CancelFunc(func() {})
+			if toolTimeout > 0 {
+				callCtx, cancel = context.WithTimeout(ctx, toolTimeout)
+			}
+			resp = tool.Call(callCtx, call)
+			cancel()
+
+			if ok {
+				a.watcher.ownEdit(workspacePaths(ctx, fm.modifiedPaths(toolCall))...)
+
+				// The files the model read before the edit are out of date,
+				// including the ones read earlier in this batch.
+				if succeeded(resp) {
+					a.expireFiles(fm.modifiedPaths(toolCall))
+					expireReads(resps, a.root(), fm.modifiedPaths(toolCall))
+				}
+			}
 		}
 
-		fmt.Printf("\n\u001b[92m%s(%v)\u001b[0m:\n\n", toolCall.Function.Name, toolCall.Function.Arguments)
+		latency := time.Since(start)
+
+		// Whether the call worked is decided before the result is masked,
+		// summarized or framed, those rewrite the content.
+		success := succeeded(resp)
+
+		// A tool that read a secret doesn't show it to the model or the
+		// user.
+		a.secrets.maskResult(resp)
+
+		// Large results of the selected tools only enter the conversation
+		// as a summary. The summarizer reads the raw result.
+		raw, _ := resp["content"].(string)
+		a.routeToolResult(ctx, toolCall, resp)
+
+		// Results that try to instruct the model are framed as data before
+		// the model sees them, a summary too when the raw result had the
+		// instructions.
+		findings := guardToolResult(toolCall, resp, raw)
+		for _, f := range findings {
+			a.renderer.Warning(fmt.Sprintf("possible prompt injection in the result of %s: %s", toolCall.Function.Name, f))
+		}
 
-		resp := tool.Call(ctx, toolCall)
-		resps = append(resps, resp)
+		a.afterToolCall(ctx, toolCall, resp, latency)
 
-		fmt.Printf("%#v\n", resps)
+		content, _ := resp["content"].(string)
+		meta := MessageMeta{
+			Time:    time.Now().UTC(),
+			Latency: latency,
+			Tokens:  a.tke.TokenCount(content),
+		}
+		if success {
+			meta.Reads = readPaths(ctx, toolCall)
+		}
+		resps = append(resps, withMeta(resp, meta))
+
+		a.renderer.ToolResult(toolCall, resp)
+
+		evt := ToolEvent{
+			Time:      time.Now().UTC(),
+			RequestID: client.RequestID(ctx),
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+			Result:    content,
+			Injection: injectionNames(findings),
+		}
+
+		a.mu.Lock()
+		a.toolEvents = append(a.toolEvents, evt)
+		a.turn.ToolCalls = append(a.turn.ToolCalls, evt)
+		a.turn.Timing.ToolsMS += latency.Milliseconds()
+		if tp, ok := a.renderer.(toolEventPublisher); ok {
+			tp.publishToolEvent(evt)
+		}
+		a.mu.Unlock()
 	}
 
 	return resps
 }
+
+// unknownToolResponse returns an error for a tool the model made up, listing
+// the tools that are available with the first line of their description.
+func (a *Agent) unknownToolResponse(toolCall client.ToolCall) client.D {
+	var available []string
+	for _, doc := range a.activeToolDocuments() {
+		fn, _ := doc["function"].(client.D)
+		name, _ := fn["name"].(string)
+		description, _ := fn["description"].(string)
+
+		description, _, _ = strings.Cut(description, "\n")
+		if before, _, found := strings.Cut(description, ". "); found {
+			description = before + "."
+		}
+
+		available = append(available, fmt.Sprintf("%s: %s", name, description))
+	}
+
+	err := fmt.Errorf("tool %q does not exist, call one of the available tools instead", toolCall.Function.Name)
+
+	return ToolError(err).With("available_tools", available).Message(toolCall.ID, toolCall.Function.Name)
+}
+
+// ToolEvents returns a copy of the tool calls made during the session.
+func (a *Agent) ToolEvents() []ToolEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return slices.Clone(a.toolEvents)
+}
+
+// toolEventPublisher is implemented by renderers that publish the tool calls
+// to subscribers. The calls are published under the same lock they are
+// recorded under.
+type toolEventPublisher interface {
+	publishToolEvent(evt ToolEvent)
+}
+
+// watchToolEvents returns a copy of the tool calls made during the session
+// and calls subscribe before a new call can be recorded, so a subscriber
+// gets every call exactly once.
+func (a *Agent) watchToolEvents(subscribe func()) []ToolEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	subscribe()
+
+	return slices.Clone(a.toolEvents)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+var (
+	mdInlineCode = regexp.MustCompile("`([^`]+)`")
+	mdBoldText   = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	mdItalicText = regexp.MustCompile(`(^|[^*])\*([^*\s][^*]*)\*`)
+	mdListItem   = regexp.MustCompile(`^(\s*)([-*+]|\d+\.)\s`)
+	mdCodeToken  = regexp.MustCompile("(//.*$|#.*$|\"(?:[^\"\\\\]|\\\\.)*\"|'(?:[^'\\\\]|\\\\.)*'|`[^`]*`|\\b[A-Za-z_]+\\b)")
+)
+
+// keywords are highlighted inside fenced code blocks. The set covers Go and
+// the most common keywords from other languages the model tends to output.
+var keywords = map[string]bool{
+	"break": true, "case": true, "chan": true, "const": true, "continue": true,
+	"default": true, "defer": true, "else": true, "fallthrough": true, "for": true,
+	"func": true, "go": true, "goto": true, "if": true, "import": true,
+	"interface": true, "map": true, "package": true, "range": true, "return": true,
+	"select": true, "struct": true, "switch": true, "type": true, "var": true,
+	"def": true, "class": true, "from": true, "while": true, "function": true,
+	"let": true, "SELECT": true, "FROM": true, "WHERE": true, "nil": true,
+	"true": true, "false": true, "None": true, "null": true,
+}
+
+// markdownWriter renders streamed markdown to the terminal. Content is
+// buffered until a full line is available since most markdown constructs
+// can't be styled until the line is complete.
+type markdownWriter struct {
+	w      io.Writer
+	buf    strings.Builder
+	inCode bool
+	lang   string
+}
+
+// newMarkdownWriter constructs a writer that renders to the specified writer.
+func newMarkdownWriter(w io.Writer) *markdownWriter {
+	return &markdownWriter{
+		w: w,
+	}
+}
+
+// Write accepts the next chunk of streamed content and renders any complete
+// lines.
+func (md *markdownWriter) Write(chunk string) {
+	md.buf.WriteString(chunk)
+
+	data := md.buf.String()
+	idx := strings.LastIndexByte(data, '\n')
+	if idx == -1 {
+		return
+	}
+
+	for line := range strings.Lines(data[:idx+1]) {
+		md.renderLine(strings.TrimSuffix(line, "\n"))
+		fmt.Fprint(md.w, "\n")
+	}
+
+	md.buf.Reset()
+	md.buf.WriteString(data[idx+1:])
+}
+
+// Flush renders any remaining partial line and resets the code block state
+// for the next response.
+func (md *markdownWriter) Flush() {
+	if md.buf.Len() > 0 {
+		md.renderLine(md.buf.String())
+		md.buf.Reset()
+	}
+
+	md.inCode = false
+	md.lang = ""
+}
+
+func (md *markdownWriter) renderLine(line string) {
+	trimmed := strings.TrimSpace(line)
+
+	// Fenced code blocks toggle the code state and display the language.
+	if strings.HasPrefix(trimmed, "```") {
+		md.inCode = !md.inCode
+		md.lang = strings.TrimPrefix(trimmed, "```")
+
+		switch {
+		case md.inCode && md.lang != "":
+			fmt.Fprint(md.w, paint(theme.Fence, "┌─ "+md.lang))
+		case md.inCode:
+			fmt.Fprint(md.w, paint(theme.Fence, "┌─"))
+		default:
+			fmt.Fprint(md.w, paint(theme.Fence, "└─"))
+		}
+		return
+	}
+
+	if md.inCode {
+		fmt.Fprintf(md.w, "%s %s", paint(theme.Fence, "│"), highlightCode(line))
+		return
+	}
+
+	// Headings are rendered in a single style without the leading hashes.
+	if strings.HasPrefix(trimmed, "#") {
+		heading := strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		fmt.Fprint(md.w, paint(theme.Heading, heading))
+		return
+	}
+
+	if m := mdListItem.FindStringSubmatch(line); m != nil {
+		bullet := m[2]
+		if bullet == "-" || bullet == "*" || bullet == "+" {
+			bullet = "•"
+		}
+		fmt.Fprintf(md.w, "%s%s %s", m[1], paint(theme.Bullet, bullet), renderInline(line[len(m[0]):]))
+		return
+	}
+
+	fmt.Fprint(md.w, renderInline(line))
+}
+
+// renderInline styles inline code, bold, and italic text.
+func renderInline(line string) string {
+	line = mdInlineCode.ReplaceAllString(line, paint(theme.Code, "$1"))
+	line = mdBoldText.ReplaceAllString(line, paint(theme.Bold, "$1"))
+	line = mdItalicText.ReplaceAllString(line, "$1"+paint(theme.Italic, "$2"))
+
+	return line
+}
+
+// highlightCode applies basic syntax highlighting to a line of code.
+func highlightCode(line string) string {
+	return mdCodeToken.ReplaceAllStringFunc(line, func(token string) string {
+		switch {
+		case strings.HasPrefix(token, "//"), strings.HasPrefix(token, "#"):
+			return paint(theme.Comment, token)
+		case strings.HasPrefix(token, `"`), strings.HasPrefix(token, "'"), strings.HasPrefix(token, "`"):
+			return paint(theme.String, token)
+		case keywords[token]:
+			return paint(theme.Keyword, token)
+		}
+		return token
+	})
+}
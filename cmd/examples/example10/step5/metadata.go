@@ -0,0 +1,57 @@
+package main
+
+import (
+	"maps"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// metaKey is the key used to store metadata in a conversation entry. It's
+// removed before the conversation is sent to the model.
+const metaKey = "_meta"
+
+// MessageMeta represents information about a conversation entry that is kept
+// for exports, audits, and display but never sent to the model.
+type MessageMeta struct {
+	Time    time.Time     `json:"time"`
+	Latency time.Duration `json:"latency,omitempty"`
+	Model   string        `json:"model,omitempty"`
+	Tokens  int           `json:"tokens"`
+	Cached  bool          `json:"cached,omitempty"`
+	Seed    *int          `json:"seed,omitempty"`
+	Reads   []string      `json:"reads,omitempty"`  // Files a tool result is a copy of.
+	Stale   bool          `json:"stale,omitempty"`  // One of the files changed since.
+	Pinned  bool          `json:"pinned,omitempty"` // Kept when the conversation is trimmed.
+}
+
+// withMeta attaches the metadata to the conversation entry.
+func withMeta(msg client.D, meta MessageMeta) client.D {
+	msg[metaKey] = meta
+	return msg
+}
+
+// messageMeta returns the metadata attached to the conversation entry.
+func messageMeta(msg client.D) (MessageMeta, bool) {
+	meta, ok := msg[metaKey].(MessageMeta)
+	return meta, ok
+}
+
+// wireMessages returns a copy of the conversation with the metadata removed
+// so it can be sent to the model.
+func wireMessages(conversation []client.D) []client.D {
+	messages := make([]client.D, len(conversation))
+
+	for i, msg := range conversation {
+		if _, exists := msg[metaKey]; !exists {
+			messages[i] = msg
+			continue
+		}
+
+		m := maps.Clone(msg)
+		delete(m, metaKey)
+		messages[i] = m
+	}
+
+	return messages
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/scheduler"
+)
+
+// When several sessions share one local GPU, AGENT_MODEL_SLOTS limits how
+// many requests are sent to the model server at once. The other requests
+// wait in a queue, the sessions take turns and the requests with a higher
+// priority go first. The side calls, like summaries, have a low priority.
+var modelQueue *scheduler.Scheduler
+
+func init() {
+	if v := os.Getenv("AGENT_MODEL_SLOTS"); v != "" {
+		slots, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if slots > 0 {
+			modelQueue = scheduler.New(slots)
+		}
+	}
+}
+
+// queueNoticeAfter is how long a request waits in the queue before the user
+// is told why the answer is late.
+const queueNoticeAfter = time.Second
+
+// WithPriority sets the priority of the agent's requests in the model queue.
+func WithPriority(priority scheduler.Priority) func(a *Agent) {
+	return func(a *Agent) {
+		a.priority = priority
+	}
+}
+
+type modelSlotKey struct{}
+
+// acquireModel waits for the turn of the agent to send a request to the
+// model. The returned context marks the slot as held, a call made with it,
+// like a summary the trim policy asks for while the response is read, uses
+// the same slot instead of waiting for a second one. The returned function
+// must be called once the response is read, calling it again does nothing.
+func (a *Agent) acquireModel(ctx context.Context, priority scheduler.Priority) (context.Context, func(), error) {
+	if modelQueue == nil || ctx.Value(modelSlotKey{}) != nil {
+		return ctx, func() {}, nil
+	}
+
+	release, wait, err := modelQueue.Acquire(ctx, a.sessionID, priority)
+	if err != nil {
+		return nil, nil, fmt.Errorf("model queue: waited %s: %w", wait.Round(time.Millisecond), err)
+	}
+
+	if wait >= queueNoticeAfter {
+		st := modelQueue.Stats()
+		a.renderer.Info(fmt.Sprintf("Queued[%s] Running[%d of %d] Waiting[%d]", wait.Round(100*time.Millisecond), st.Running, st.Slots, st.Queued))
+	}
+
+	return context.WithValue(ctx, modelSlotKey{}, true), sync.OnceFunc(release), nil
+}
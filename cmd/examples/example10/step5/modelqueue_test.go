@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/mockserver"
+	"github.com/ardanlabs/ai-training/foundation/scheduler"
+)
+
+func TestModelSlotReleasedForTools(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	if err := os.WriteFile("go.mod", []byte("module example.com/hello\n"), 0644); err != nil {
+		t.Fatalf("write go.mod: %s", err)
+	}
+
+	srv := mockserver.New(
+		mockserver.Response{ToolCalls: []mockserver.ToolCall{{ID: "call-1", Name: "tool_read_file", Arguments: client.D{"path": "go.mod"}}}},
+		mockserver.Response{Content: "The module is example.com/hello."},
+	)
+	defer srv.Close()
+
+	saved := url
+	url = srv.Start()
+	defer func() { url = saved }()
+
+	savedQueue := modelQueue
+	modelQueue = scheduler.New(1)
+	defer func() { modelQueue = savedQueue }()
+
+	var running int
+	hooks := Hooks{
+		BeforeToolCall: func(ctx context.Context, toolCall client.ToolCall, tool Tool) error {
+			running = modelQueue.Stats().Running
+			return nil
+		},
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}), WithHooks(hooks))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	if err := agent.Turn(context.Background(), "What is the name of the module?"); err != nil {
+		t.Fatalf("turn: %s", err)
+	}
+
+	if running != 0 {
+		t.Errorf("got %d model slots held while the tool ran, want 0", running)
+	}
+
+	if st := modelQueue.Stats(); st.Running != 0 {
+		t.Errorf("got %d model slots held after the turn, want 0", st.Running)
+	}
+}
+
+func TestModelSlotNested(t *testing.T) {
+	savedQueue := modelQueue
+	modelQueue = scheduler.New(1)
+	defer func() { modelQueue = savedQueue }()
+
+	agent := Agent{renderer: &stderrRenderer{w: io.Discard}, sessionID: "session"}
+
+	ctx, release, err := agent.acquireModel(context.Background(), scheduler.Normal)
+	if err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+
+	// The only slot is held, a nested call that waited for another one
+	// would never get it.
+	nestedCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+
+	_, nestedRelease, err := agent.acquireModel(nestedCtx, scheduler.Low)
+	if err != nil {
+		t.Fatalf("nested acquire: %s", err)
+	}
+	nestedRelease()
+
+	if st := modelQueue.Stats(); st.Running != 1 {
+		t.Errorf("got %d slots held after the nested call, want 1", st.Running)
+	}
+
+	release()
+	release()
+
+	if st := modelQueue.Stats(); st.Running != 0 {
+		t.Errorf("got %d slots held after the release, want 0", st.Running)
+	}
+}
@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/scheduler"
+	"gopkg.in/yaml.v3"
+)
+
+// In multi-user mode, set with the AGENT_USERS_FILE environment variable, the
+// daemon serves a whole classroom. Every request carries the API token of a
+// user in the Authorization header, the sessions of a user are only visible
+// to them and every user works in their own workspace, a directory under the
+// workspaces root. The number of sessions, the messages per minute and the
+// tokens per day of a user are limited. See zarf/users/users.yaml for an
+// example.
+var users *Users
+
+func init() {
+	if v := os.Getenv("AGENT_USERS_FILE"); v != "" {
+		var err error
+		users, err = loadUsers(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// Prefetching reads files in the background, outside of the user's
+		// workspace.
+		prefetchEnabled = false
+	}
+}
+
+// Users represents the users of the multi-user mode and their limits.
+type Users struct {
+	Workspaces string     `yaml:"workspaces"` // Root of the workspaces, one directory per user.
+	Template   string     `yaml:"template"`   // Copied into a new workspace, empty when not set.
+	Defaults   UserLimits `yaml:"defaults"`
+	Users      []User     `yaml:"users"`
+
+	byToken map[string]*userState
+}
+
+// User represents a user of the multi-user mode. The limits that aren't set
+// use the defaults.
+type User struct {
+	Name     string     `yaml:"name"`
+	Token    string     `yaml:"token"`
+	Priority string     `yaml:"priority"` // low, normal or high in the model queue, normal when empty.
+	Limits   UserLimits `yaml:"limits"`
+}
+
+// UserLimits represents the quotas and rate limit of a user, zero is no
+// limit.
+type UserLimits struct {
+	MaxSessions       int `yaml:"max_sessions"`
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	TokensPerDay      int `yaml:"tokens_per_day"`
+}
+
+// userNameRE matches the names that can be used as a directory name.
+var userNameRE = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// loadUsers reads and validates the users file.
+func loadUsers(path string) (*Users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("users file: %w", err)
+	}
+
+	var u Users
+	if err := yaml.Unmarshal(data, &u); err != nil {
+		return nil, fmt.Errorf("users file: %s: %w", path, err)
+	}
+
+	if u.Workspaces == "" {
+		return nil, fmt.Errorf("users file: %s: workspaces is required", path)
+	}
+
+	// The workspaces must not depend on the directory the daemon runs in.
+	if u.Workspaces, err = filepath.Abs(u.Workspaces); err != nil {
+		return nil, fmt.Errorf("users file: %s: %w", path, err)
+	}
+
+	if u.Template != "" {
+		if u.Template, err = filepath.Abs(u.Template); err != nil {
+			return nil, fmt.Errorf("users file: %s: %w", path, err)
+		}
+	}
+
+	u.byToken = make(map[string]*userState, len(u.Users))
+	for _, usr := range u.Users {
+		if !userNameRE.MatchString(usr.Name) || usr.Name == "." || usr.Name == ".." {
+			return nil, fmt.Errorf("users file: %s: invalid user name %q", path, usr.Name)
+		}
+
+		if usr.Token == "" {
+			return nil, fmt.Errorf("users file: %s: %s: token is required", path, usr.Name)
+		}
+
+		if _, exists := u.byToken[usr.Token]; exists {
+			return nil, fmt.Errorf("users file: %s: %s: the token is used by another user", path, usr.Name)
+		}
+
+		priority, ok := scheduler.ParsePriority(usr.Priority)
+		if !ok {
+			return nil, fmt.Errorf("users file: %s: %s: priority must be low, normal or high, not %q", path, usr.Name, usr.Priority)
+		}
+
+		u.byToken[usr.Token] = &userState{
+			name:     usr.Name,
+			priority: priority,
+			limits:   usr.Limits.or(u.Defaults),
+		}
+	}
+
+	if len(u.byToken) == 0 {
+		return nil, fmt.Errorf("users file: %s: no users", path)
+	}
+
+	return &u, nil
+}
+
+// or returns the limits with the ones that aren't set taken from the
+// defaults.
+func (ul UserLimits) or(defaults UserLimits) UserLimits {
+	if ul.MaxSessions == 0 {
+		ul.MaxSessions = defaults.MaxSessions
+	}
+	if ul.RequestsPerMinute == 0 {
+		ul.RequestsPerMinute = defaults.RequestsPerMinute
+	}
+	if ul.TokensPerDay == 0 {
+		ul.TokensPerDay = defaults.TokensPerDay
+	}
+
+	return ul
+}
+
+// authenticate returns the user of the bearer token of the request.
+func (u *Users) authenticate(r *http.Request) (*userState, bool) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return nil, false
+	}
+
+	usr, exists := u.byToken[token]
+	return usr, exists
+}
+
+// workspace returns the workspace of the user, creating it from the template
+// the first time.
+func (u *Users) workspace(usr *userState) (string, error) {
+	dir := filepath.Join(u.Workspaces, usr.name)
+
+	usr.mu.Lock()
+	defer usr.mu.Unlock()
+
+	if _, err := os.Stat(dir); err == nil {
+		return dir, nil
+	}
+
+	if u.Template == "" {
+		return dir, os.MkdirAll(dir, 0o755)
+	}
+
+	if err := os.MkdirAll(u.Workspaces, 0o755); err != nil {
+		return "", err
+	}
+
+	if err := os.CopyFS(dir, os.DirFS(u.Template)); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("copy template: %w", err)
+	}
+
+	return dir, nil
+}
+
+// =============================================================================
+
+// userState represents the usage of a user since the daemon started.
+type userState struct {
+	name     string
+	priority scheduler.Priority
+	limits   UserLimits
+
+	mu       sync.Mutex
+	sessions int
+	requests []time.Time // Requests in the last minute.
+	day      string      // Day the tokens are counted for, in UTC.
+	tokens   int
+}
+
+// Errors returned when a user is over one of their limits.
+var (
+	errTooManySessions = errors.New("too many sessions, close one first")
+	errRateLimited     = errors.New("too many requests, try again in a minute")
+	errQuotaExceeded   = errors.New("the tokens of the day are used up, try again tomorrow")
+)
+
+// openSession counts a new session of the user.
+func (us *userState) openSession() error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if us.limits.MaxSessions > 0 && us.sessions >= us.limits.MaxSessions {
+		return errTooManySessions
+	}
+	us.sessions++
+
+	return nil
+}
+
+// closeSession counts a closed session of the user.
+func (us *userState) closeSession() {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.sessions--
+}
+
+// allow counts a request of the user that is within their limits.
+func (us *userState) allow(now time.Time) error {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	if day := now.UTC().Format(time.DateOnly); day != us.day {
+		us.day = day
+		us.tokens = 0
+	}
+
+	if us.limits.TokensPerDay > 0 && us.tokens >= us.limits.TokensPerDay {
+		return errQuotaExceeded
+	}
+
+	if us.limits.RequestsPerMinute > 0 {
+		recent := us.requests[:0]
+		for _, t := range us.requests {
+			if now.Sub(t) < time.Minute {
+				recent = append(recent, t)
+			}
+		}
+		us.requests = recent
+
+		if len(us.requests) >= us.limits.RequestsPerMinute {
+			return errRateLimited
+		}
+	}
+
+	us.requests = append(us.requests, now)
+
+	return nil
+}
+
+// addTokens counts the tokens a turn of the user used.
+func (us *userState) addTokens(tokens int) {
+	us.mu.Lock()
+	defer us.mu.Unlock()
+
+	us.tokens += tokens
+}
+
+// limitStatus returns the status code for an error of the limits.
+func limitStatus(err error) int {
+	if errors.Is(err, errTooManySessions) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusTooManyRequests
+}
+
+// userPreferencesFile returns the preferences file of the agent created in
+// the workspace. In multi-user mode every user has their own, kept in their
+// workspace. Otherwise the file is keyed by the path of the workspace unless
+// a single file was set.
+func userPreferencesFile(workspace string) string {
+	switch {
+	case preferencesFile == "" && preferencesDir == "":
+		return ""
+
+	case users != nil:
+		return filepath.Join(workspace, ".agent", "preferences.json")
+
+	case preferencesFile != "":
+		return preferencesFile
+	}
+
+	sum := sha256.Sum256([]byte(workspace))
+
+	return filepath.Join(preferencesDir, fmt.Sprintf("%s-%x.json", filepath.Base(workspace), sum[:6]))
+}
+
+// =============================================================================
+
+// WithWorkspace sets the directory the tools of the agent work in. The paths
+// the model passes to the tools are relative to it and can't leave it, so
+// the users of the daemon can't reach each other's files. The current
+// directory is used when not set.
+func WithWorkspace(dir string) func(a *Agent) {
+	return func(a *Agent) {
+		a.workspace = dir
+	}
+}
+
+type workspaceKey struct{}
+
+// withWorkspace returns a context that carries the workspace the tools work
+// in. Nothing is added for an empty directory.
+func withWorkspace(ctx context.Context, dir string) context.Context {
+	if dir == "" {
+		return ctx
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		dir = abs
+	}
+
+	return context.WithValue(ctx, workspaceKey{}, dir)
+}
+
+// workspaceDir returns the absolute path of the workspace the context
+// carries, empty for the current directory. It's also the directory the
+// commands of the tools run in, which is the current directory when empty.
+func workspaceDir(ctx context.Context) string {
+	dir, _ := ctx.Value(workspaceKey{}).(string)
+	return dir
+}
+
+// workingDir returns the absolute path of the directory the tools work in.
+func workingDir(ctx context.Context) (string, error) {
+	if dir := workspaceDir(ctx); dir != "" {
+		return dir, nil
+	}
+
+	return os.Getwd()
+}
+
+// resolvePath returns the path a tool uses for a path argument of the model.
+// In a workspace the path is relative to the workspace and is refused when it
+// leaves it, through .. or an absolute path or a symlink. Without a workspace
+// the path is used as is.
+func resolvePath(ctx context.Context, path string) (string, error) {
+	root := workspaceDir(ctx)
+	if root == "" {
+		return path, nil
+	}
+
+	return resolveIn(root, path)
+}
+
+// resolveIn returns the absolute path of the path relative to the root. The
+// path is refused when it leaves the root.
+func resolveIn(root string, path string) (string, error) {
+	full := path
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(root, path)
+	}
+
+	if err := insideDir(root, full); err != nil {
+		return "", fmt.Errorf("%s is outside the workspace", path)
+	}
+
+	return full, nil
+}
+
+// relativePath returns the path relative to the root, the form the paths are
+// compared in. A relative path is already relative to the root, an absolute
+// path outside of the root is kept as is.
+func relativePath(root string, path string) string {
+	if !filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return path
+	}
+
+	return rel
+}
+
+// workspacePaths returns the paths of the path arguments in the workspace,
+// the ones outside of it are left out.
+func workspacePaths(ctx context.Context, paths []string) []string {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if full, err := resolvePath(ctx, path); err == nil {
+			resolved = append(resolved, full)
+		}
+	}
+
+	return resolved
+}
+
+// checkPackages returns an error when one of the package patterns of a go
+// command is a directory outside the workspace. Import paths are resolved by
+// the go command and are left alone.
+func checkPackages(ctx context.Context, patterns []string) error {
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, ".") && !filepath.IsAbs(p) {
+			continue
+		}
+
+		if _, err := resolvePath(ctx, strings.TrimSuffix(p, "/...")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insideDir returns an error when the absolute path isn't inside the
+// directory once the symlinks of both are followed. A path that doesn't
+// exist yet, like a file about to be created, is checked through the part
+// of it that does.
+func insideDir(dir string, path string) error {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	real, err := evalExisting(filepath.Clean(path))
+	if err != nil {
+		return err
+	}
+
+	if rel, err := filepath.Rel(dir, real); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is outside of %s", path, dir)
+	}
+
+	return nil
+}
+
+// evalExisting follows the symlinks of the part of the path that exists and
+// appends the rest.
+func evalExisting(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return real, err
+	}
+
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+
+	real, err = evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(real, filepath.Base(path)), nil
+}
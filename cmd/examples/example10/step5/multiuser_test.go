@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestWorkspaceReadOutside(t *testing.T) {
+	root := t.TempDir()
+	t.Chdir(root)
+
+	for _, user := range []string{"alice", "bob"} {
+		if err := os.Mkdir(user, 0755); err != nil {
+			t.Fatalf("mkdir: %s", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join("alice", "notes.txt"), []byte("alice's notes"), 0644); err != nil {
+		t.Fatalf("write notes: %s", err)
+	}
+
+	if err := os.WriteFile(filepath.Join("bob", "secret.txt"), []byte("bob's secret"), 0644); err != nil {
+		t.Fatalf("write secret: %s", err)
+	}
+
+	if err := os.Symlink(filepath.Join(root, "bob"), filepath.Join("alice", "bob")); err != nil {
+		t.Fatalf("symlink: %s", err)
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}), WithWorkspace(filepath.Join(root, "alice")))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	tests := []struct {
+		path    string
+		refused bool
+	}{
+		{path: "notes.txt"},
+		{path: "../bob/secret.txt", refused: true},
+		{path: filepath.Join(root, "bob", "secret.txt"), refused: true},
+		{path: "bob/secret.txt", refused: true},
+	}
+
+	for _, tt := range tests {
+		toolCall := client.ToolCall{
+			ID: "call-1",
+			Function: client.Function{
+				Name:      "tool_read_file",
+				Arguments: map[string]any{"path": tt.path},
+			},
+		}
+
+		content, _ := agent.callTools(context.Background(), []client.ToolCall{toolCall})[0]["content"].(string)
+
+		tr, err := parseToolResponse(content)
+		if err != nil {
+			t.Fatalf("%s: parse result: %s", tt.path, err)
+		}
+
+		switch {
+		case tt.refused && !tr.Failed():
+			t.Errorf("%s: the read outside the workspace wasn't refused: %s", tt.path, content)
+
+		case tt.refused && strings.Contains(content, "bob's secret"):
+			t.Errorf("%s: the result holds the file of another user: %s", tt.path, content)
+
+		case !tt.refused && !strings.Contains(content, "alice's notes"):
+			t.Errorf("%s: the read in the workspace failed: %s", tt.path, content)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// How the agent connects to the model server, for servers behind a proxy,
+// with a certificate from a private CA, or listening on a unix socket. These
+// can be changed with the AGENT_PROXY, AGENT_CA_BUNDLE,
+// AGENT_INSECURE_SKIP_VERIFY and AGENT_UNIX_SOCKET environment variables.
+// Skipping the certificate check is only meant for lab setups with
+// self-signed certificates.
+var transportConfig client.TransportConfig
+
+// httpOptions are the options every client the agent constructs is given so
+// they all connect the same way.
+var httpOptions []func(cln *client.Client)
+
+func init() {
+	transportConfig = client.TransportConfig{
+		Proxy:      os.Getenv("AGENT_PROXY"),
+		CABundle:   os.Getenv("AGENT_CA_BUNDLE"),
+		UnixSocket: os.Getenv("AGENT_UNIX_SOCKET"),
+	}
+
+	if v := os.Getenv("AGENT_INSECURE_SKIP_VERIFY"); v != "" {
+		var err error
+		transportConfig.InsecureSkipVerify, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if transportConfig == (client.TransportConfig{}) {
+		return
+	}
+
+	transport, err := client.NewTransport(transportConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	httpOptions = append(httpOptions, client.WithTransport(transport))
+}
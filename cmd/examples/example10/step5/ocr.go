@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The engine used to read the text in images. The default engine asks a
+// vision model to transcribe the image, tesseract runs the Tesseract OCR
+// program which is faster and works offline but struggles with screenshots of
+// dark themes. These can be changed with the AGENT_OCR and AGENT_OCR_MODEL
+// environment variables.
+var (
+	ocrEngine = "vision"
+	ocrModel  = "qwen2.5vl:latest"
+)
+
+const ocrTimeout = 2 * time.Minute
+
+func init() {
+	if v := os.Getenv("AGENT_OCR"); v != "" {
+		ocrEngine = v
+	}
+
+	if v := os.Getenv("AGENT_OCR_MODEL"); v != "" {
+		ocrModel = v
+	}
+}
+
+// ocrPrompt asks the vision model for a transcription with the layout blocks
+// separated by blank lines.
+const ocrPrompt = `Transcribe all the text in the image exactly as it appears,
+including code, error messages and line numbers. Don't describe the image,
+don't fix typos and don't translate anything. Keep the reading order and put
+a blank line between separate blocks of text like paragraphs, panels, dialogs
+or columns. If there is no text in the image reply with NO TEXT.`
+
+// =============================================================================
+// OCRImage Tool
+
+// OCRImage represents a tool that can be used to extract the text from an
+// image, like a screenshot of an error message or a scanned document.
+type OCRImage struct {
+	name      string
+	client    *client.Client
+	http      *http.Client
+	allowlist []string
+}
+
+// RegisterOCRImage creates a new instance of the OCRImage tool and loads it
+// into the provided tools map.
+func RegisterOCRImage(tools map[string]Tool) client.D {
+	logger := func(ctx context.Context, msg string, v ...any) {}
+
+	oi := OCRImage{
+		name:      "tool_ocr_image",
+		client:    client.New(logger, httpOptions...),
+		allowlist: httpAllowlist,
+	}
+
+	// Images are only downloaded from the domains the http_request tool can
+	// call, redirects included.
+	oi.http = &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+			if !allowedHost(oi.allowlist, req.URL.Hostname()) {
+				return fmt.Errorf("redirect to domain %q is not in the allowlist", req.URL.Hostname())
+			}
+			return nil
+		},
+	}
+
+	tools[oi.name] = &oi
+
+	return oi.toolDocument()
+}
+
+// ocrImageParams represents the parameters for the OCRImage tool.
+type ocrImageParams struct {
+	Path string `json:"path" description:"The relative path of an image in the working directory or an http(s) URL of an image. JPEG, PNG, GIF and WebP images are supported."`
+}
+
+// network describes the call if it downloads the image.
+func (oi *OCRImage) network(toolCall client.ToolCall) (string, bool) {
+	path, _ := toolCall.Function.Arguments["path"].(string)
+	if !isURL(path) {
+		return "", false
+	}
+
+	host := path
+	if u, err := neturl.Parse(path); err == nil {
+		host = u.Hostname()
+	}
+
+	return "downloading an image from " + host, true
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (oi *OCRImage) toolDocument() client.D {
+	description := fmt.Sprintf("Extract the text from an image, like a screenshot of an error message or a scanned document. Returns the full text and the text split into layout blocks in reading order. Images can only be downloaded from these domains: %s.", strings.Join(oi.allowlist, ", "))
+
+	return client.ToolDocument(oi.name, description, ocrImageParams{})
+}
+
+// Call is the function that is called by the agent to extract the text from
+// an image when the model requests the tool with the specified parameters.
+func (oi *OCRImage) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, oi.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params ocrImageParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, oi.name, err)
+	}
+
+	if params.Path == "" {
+		return toolErrorResponse(toolCall.ID, oi.name, fmt.Errorf("path is required"))
+	}
+
+	source, err := oi.checkSource(ctx, params.Path)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, oi.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ocrTimeout)
+	defer cancel()
+
+	data, mimeType, err := client.ReadImageClient(ctx, oi.http, source)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, oi.name, err)
+	}
+
+	var text string
+	switch ocrEngine {
+	case "tesseract":
+		text, err = oi.tesseract(ctx, data)
+
+	case "vision":
+		text, err = oi.vision(ctx, data, mimeType)
+
+	default:
+		err = fmt.Errorf("unsupported ocr engine %q, use vision or tesseract", ocrEngine)
+	}
+
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, oi.name, err)
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" || text == "NO TEXT" {
+		return toolSuccessResponse(toolCall.ID, oi.name, ToolData{"path": params.Path, "text": "", "blocks": []string{}, "note": "the image has no text"})
+	}
+
+	return toolSuccessResponse(toolCall.ID, oi.name, ToolData{"path": params.Path, "engine": ocrEngine, "text": text, "blocks": layoutBlocks(text)})
+}
+
+// checkSource makes sure a URL is in the allowlist and a local image is
+// inside the working directory, symlinks included, since the model picks the
+// path. It returns the source to read the image from.
+func (oi *OCRImage) checkSource(ctx context.Context, path string) (string, error) {
+	if isURL(path) {
+		u, err := neturl.Parse(path)
+		if err != nil {
+			return "", fmt.Errorf("parse url: %w", err)
+		}
+
+		if !allowedHost(oi.allowlist, u.Hostname()) {
+			return "", fmt.Errorf("domain %q is not in the allowlist, please inform the user", u.Hostname())
+		}
+
+		return path, nil
+	}
+
+	wd, err := workingDir(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return resolveIn(wd, path)
+}
+
+// isURL reports whether the path is an http or https URL.
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// vision asks the vision model to transcribe the image.
+func (oi *OCRImage) vision(ctx context.Context, data []byte, mimeType string) (string, error) {
+	d := client.ChatRequest(ocrModel, []client.D{
+		client.UserParts(
+			client.ImageContent(data, mimeType),
+			client.TextContent(ocrPrompt),
+		),
+	},
+		client.WithTemperature(0),
+		client.WithStream(false),
+	)
+
+	var chat client.Chat
+	if err := oi.client.Do(ctx, http.MethodPost, url, d, &chat); err != nil {
+		return "", fmt.Errorf("vision: %w", err)
+	}
+
+	if len(chat.Choices) == 0 {
+		return "", fmt.Errorf("vision: no choices in the response")
+	}
+
+	return chat.Choices[0].Message.Content, nil
+}
+
+// tesseract runs the Tesseract OCR program on the image.
+func (oi *OCRImage) tesseract(ctx context.Context, data []byte) (string, error) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return "", fmt.Errorf("tesseract is not installed, install it or set AGENT_OCR=vision")
+	}
+
+	// Tesseract reads the image from stdin and writes the text to stdout.
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "tesseract", "stdin", "stdout")
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("tesseract: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// layoutBlocks splits the text into the blocks separated by blank lines.
+func layoutBlocks(text string) []string {
+	blocks := []string{}
+
+	var block []string
+	for line := range strings.Lines(text + "\n") {
+		line = strings.TrimRight(line, " \t\r\n")
+		if strings.TrimSpace(line) != "" {
+			block = append(block, line)
+			continue
+		}
+
+		if len(block) > 0 {
+			blocks = append(blocks, strings.Join(block, "\n"))
+			block = nil
+		}
+	}
+
+	if len(block) > 0 {
+		blocks = append(blocks, strings.Join(block, "\n"))
+	}
+
+	return blocks
+}
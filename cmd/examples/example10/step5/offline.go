@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	neturl "net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Offline mode guarantees the agent doesn't reach anything but the model
+// server, for air-gapped trainings. Every client the agent constructs is
+// limited to the host of the model server, the tools that reach the network
+// are refused, and the go command isn't allowed to download modules. This is
+// turned on with the AGENT_OFFLINE environment variable. Other local servers,
+// like the embedding and Whisper servers, can be allowed with the
+// AGENT_OFFLINE_HOSTS environment variable using a comma separated list.
+var (
+	offline      bool
+	offlineHosts []string
+)
+
+// The init functions run in file name order, url is set by now.
+func init() {
+	if v := os.Getenv("AGENT_OFFLINE"); v != "" {
+		var err error
+		offline, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if !offline {
+		return
+	}
+
+	offlineHosts = []string{serverHostname(url)}
+	if v := os.Getenv("AGENT_OFFLINE_HOSTS"); v != "" {
+		for host := range strings.SplitSeq(v, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				offlineHosts = append(offlineHosts, strings.ToLower(host))
+			}
+		}
+	}
+
+	httpOptions = append(httpOptions, client.WithAllowedHosts(offlineHosts...))
+
+	// The tools that run the go command would otherwise download modules
+	// and toolchains.
+	os.Setenv("GOPROXY", "off")
+	os.Setenv("GOTOOLCHAIN", "local")
+}
+
+// checkOffline returns an error if the configuration of the agent needs the
+// network while in offline mode.
+func checkOffline() error {
+	if !offline {
+		return nil
+	}
+
+	if transport == client.TransportBedrock || transport == client.TransportVertex {
+		return fmt.Errorf("offline mode: the %s transport is a cloud provider", transport)
+	}
+
+	// The clients send the requests to Azure when it's configured.
+	if az, ok := client.AzureFromEnv(); ok {
+		if host := serverHostname(az.Endpoint); !slices.Contains(offlineHosts, host) {
+			return fmt.Errorf("offline mode: AZURE_OPENAI_ENDPOINT sends the requests to %s, unset it", host)
+		}
+	}
+
+	if len(toolPlugins) > 0 {
+		return errors.New("offline mode: tool plugins are programs that could reach the network, unset AGENT_TOOL_PLUGINS")
+	}
+
+	if len(commandToolDefs) > 0 {
+		return errors.New("offline mode: the tools of the tools file run commands that could reach the network, unset AGENT_TOOLS_FILE")
+	}
+
+	if strings.HasPrefix(databaseURL, "postgres://") || strings.HasPrefix(databaseURL, "postgresql://") {
+		if host := serverHostname(databaseURL); !slices.Contains(offlineHosts, host) {
+			return fmt.Errorf("offline mode: the database host %s isn't allowed, add it to AGENT_OFFLINE_HOSTS", host)
+		}
+	}
+
+	return nil
+}
+
+// serverHostname returns the host name of the endpoint without the port.
+func serverHostname(endpoint string) string {
+	u, err := neturl.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Hostname())
+}
+
+// =============================================================================
+
+// networker is implemented by tools whose calls can reach the network.
+type networker interface {
+	network(toolCall client.ToolCall) (string, bool)
+}
+
+// usesNetwork reports if the tool call would reach the network.
+func usesNetwork(tool Tool, toolCall client.ToolCall) bool {
+	nt, ok := tool.(networker)
+	if !ok {
+		return false
+	}
+
+	_, uses := nt.network(toolCall)
+	return uses
+}
+
+// offlineResponse refuses a tool call that would reach the network.
+func offlineResponse(toolCall client.ToolCall) client.D {
+	err := fmt.Errorf("offline mode: %s can't reach the network, answer without it", toolCall.Function.Name)
+
+	return toolErrorResponse(toolCall.ID, toolCall.Function.Name, err)
+}
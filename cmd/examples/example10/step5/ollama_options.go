@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The model parameters only Ollama knows, like the context window or the
+// layers offloaded to the GPU. These can be set with the AGENT_OLLAMA_OPTIONS
+// environment variable as a JSON object, like {"num_ctx": 32768, "seed": 42}.
+// Ollama only applies them on its native chat endpoint, the chat requests are
+// sent there instead of the OpenAI compatible one when they are set.
+var ollamaOptions client.OllamaOptions
+
+func init() {
+	if v := os.Getenv("AGENT_OLLAMA_OPTIONS"); v != "" {
+		var err error
+		ollamaOptions, err = parseOllamaOptions(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The agent trims the conversation to the window the model gets,
+		// OLLAMA_CONTEXT_LENGTH wins when both are set. The options are only
+		// sent with the default transport, the window of the other servers
+		// doesn't change.
+		if ollamaOptions.NumCtx != nil && transport == client.TransportSSE && os.Getenv("OLLAMA_CONTEXT_LENGTH") == "" {
+			contextWindow = *ollamaOptions.NumCtx
+		}
+	}
+}
+
+// parseOllamaOptions decodes and validates the options. An unknown option is
+// an error so a typo doesn't go unnoticed.
+func parseOllamaOptions(v string) (client.OllamaOptions, error) {
+	var o client.OllamaOptions
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(v)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&o); err != nil {
+		return client.OllamaOptions{}, fmt.Errorf("ollama options: %w", err)
+	}
+
+	if err := o.Validate(); err != nil {
+		return client.OllamaOptions{}, fmt.Errorf("ollama options: %w", err)
+	}
+
+	return o, nil
+}
+
+// withOllamaOptions adds the Ollama options to a request to the model when
+// they are set. Only Ollama knows the field, the other transports don't get
+// it.
+func withOllamaOptions(d client.D) {
+	if transport == client.TransportSSE {
+		client.WithOllamaOptions(ollamaOptions)(d)
+	}
+}
+
+// chatTransport returns the transport of the chat requests. The OpenAI
+// compatible endpoint of Ollama ignores the options object, the requests go
+// to the native chat endpoint when options are set.
+func chatTransport() string {
+	if transport == client.TransportSSE && !ollamaOptions.IsZero() {
+		return client.TransportOllama
+	}
+
+	return transport
+}
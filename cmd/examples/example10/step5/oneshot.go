@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// runOneShot runs a single request to completion and prints the final answer
+// to stdout so the agent can be used from scripts and makefiles. Tool calls
+// and errors are reported on stderr. If the prompt is "-" it's read from
+// stdin.
+//
+// With the json output the answer, tool calls, usage and timing are printed
+// as a single JSON document when the turn is done. With the jsonl output the
+// agent's activity is streamed to stdout as JSON lines, ending with a result
+// event.
+//
+// If a tool is specified, the model is forced to call it before answering.
+func runOneShot(ctx context.Context, prompt string, output string, tool string) error {
+	if err := validateOutput(output); err != nil {
+		return err
+	}
+
+	if prompt == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read prompt: %w", err)
+		}
+		prompt = string(data)
+	}
+
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return fmt.Errorf("the prompt is empty")
+	}
+
+	var renderer Renderer = &stderrRenderer{
+		w: os.Stderr,
+	}
+
+	events := eventRenderer{}
+	if output == outputJSONL {
+		events.attach(os.Stdout, nil, true)
+		renderer = &events
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(renderer))
+	if err != nil {
+		return fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer agent.Close()
+
+	if err := agent.ForceTool(tool); err != nil {
+		return err
+	}
+
+	turnErr := agent.Turn(ctx, prompt)
+
+	switch output {
+	case outputJSON:
+		result := struct {
+			TurnResult
+			Error string `json:"error,omitempty"`
+		}{
+			TurnResult: agent.LastTurn(),
+		}
+		if turnErr != nil {
+			result.Error = turnErr.Error()
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("encode result: %w", err)
+		}
+
+	case outputJSONL:
+		if turnErr != nil {
+			events.Error(turnErr)
+		}
+		events.event("result", agent.LastTurn())
+		events.event("done", client.D{})
+
+	default:
+		if turnErr != nil {
+			return turnErr
+		}
+		answer := agent.LastAnswer()
+		if translation := agent.LastTurn().Translation; translation != "" {
+			answer = translation
+		}
+		fmt.Println(answer)
+	}
+
+	return turnErr
+}
+
+// LastAnswer returns the content of the last answer from the model. The
+// requests for tool calls and empty messages aren't answers.
+func (a *Agent) LastAnswer() string {
+	for _, msg := range slices.Backward(a.conversation) {
+		if msg["role"] != "assistant" {
+			continue
+		}
+
+		if _, exists := msg["tool_calls"]; exists {
+			continue
+		}
+
+		content, _ := msg["content"].(string)
+		if strings.TrimSpace(content) == "" || strings.HasPrefix(content, "Tool call ") {
+			continue
+		}
+
+		return content
+	}
+
+	return ""
+}
+
+// =============================================================================
+
+// stderrRenderer reports the tool calls and errors on stderr so stdout only
+// contains the final answer.
+type stderrRenderer struct {
+	w io.Writer
+}
+
+// Waiting is ignored in one-shot mode.
+func (sr *stderrRenderer) Waiting(model string, elapsed time.Duration) {}
+
+// Reasoning is ignored in one-shot mode.
+func (sr *stderrRenderer) Reasoning(text string) {}
+
+// Content is ignored since the final answer is printed when the turn is done.
+func (sr *stderrRenderer) Content(text string) {}
+
+// ToolCall reports the tool the model asked to call.
+func (sr *stderrRenderer) ToolCall(toolCall client.ToolCall) {
+	fmt.Fprintf(sr.w, "tool: %s(%v)\n", toolCall.Function.Name, toolCall.Function.Arguments)
+}
+
+// ToolResult is ignored in one-shot mode.
+func (sr *stderrRenderer) ToolResult(toolCall client.ToolCall, result client.D) {}
+
+// Info is ignored in one-shot mode.
+func (sr *stderrRenderer) Info(msg string) {}
+
+// Warning reports something the user should look at.
+func (sr *stderrRenderer) Warning(msg string) {
+	fmt.Fprintf(sr.w, "warning: %s\n", msg)
+}
+
+// Error reports an error.
+func (sr *stderrRenderer) Error(err error) {
+	fmt.Fprintf(sr.w, "error: %s\n", err)
+}
+
+// Done is ignored in one-shot mode.
+func (sr *stderrRenderer) Done() {}
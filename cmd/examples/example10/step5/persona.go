@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Persona represents a task preset for the agent. It bundles the system
+// prompt, the tools the model can use, and the sampling parameters.
+type Persona struct {
+	Name        string
+	Description string
+	Prompt      string
+	Tools       []string // An empty list allows every tool.
+	Temperature float64
+	TopP        float64
+	TopK        int
+	ReadOnly    bool // The persona's tool calls can't change files.
+}
+
+// The persona used when the agent starts, coder unless a loaded skill pack
+// picks another. This can be changed with the AGENT_PERSONA environment
+// variable or the /persona command.
+var defaultPersona string
+
+func init() {
+	if v := os.Getenv("AGENT_PERSONA"); v != "" {
+		defaultPersona = v
+	}
+}
+
+// personas is the catalog of presets keyed by name.
+var personas = map[string]Persona{
+	"coder": {
+		Name:        "coder",
+		Description: "Coding assistant that reads, creates, and edits files",
+		Prompt: `You are a helpful coding assistant that has tools to assist
+you in coding.
+
+When reading Go source code always start counting lines of code from the top of
+the source code file.`,
+		Temperature: 0.0,
+		TopP:        0.1,
+		TopK:        1,
+	},
+	"reviewer": {
+		Name:        "reviewer",
+		Description: "Code reviewer that reads code and never changes it",
+		Prompt: `You are an experienced code reviewer. Read the code the user
+points you to and report bugs, race conditions, missing error handling, and
+readability problems. Start a review of Go code with the code review tool. Order
+the findings by severity and reference the file and line number for each one.
+Never change any files.`,
+		Tools:       []string{"tool_read_file", "tool_file_chunks", "tool_search_files", "tool_go_symbols", "tool_go_depgraph", "tool_code_review", "tool_gopls", "tool_workspace_changes", "tool_ocr_image", "tool_scratchpad", "tool_ask_user", "tool_remember_preference", "tool_raw_result"},
+		Temperature: 0.2,
+		TopP:        0.5,
+		TopK:        20,
+		ReadOnly:    true,
+	},
+	"ops": {
+		Name:        "ops",
+		Description: "Operations assistant that inspects a Kubernetes cluster without changing it",
+		Prompt: `You are an operations assistant. Help the user understand the
+state of their Kubernetes cluster and troubleshoot failing workloads. Use the
+kubectl tool to list the resources, describe the ones that look unhealthy and
+read their logs and events before drawing a conclusion. You can't change the
+cluster, so when a fix is needed show the user the kubectl command to run.`,
+		Tools:       []string{"tool_kubectl_get", "tool_read_file", "tool_file_chunks", "tool_search_files", "tool_scratchpad", "tool_ask_user", "tool_remember_preference", "tool_raw_result"},
+		Temperature: 0.2,
+		TopP:        0.5,
+		TopK:        20,
+		ReadOnly:    true,
+	},
+	"sql": {
+		Name:        "sql",
+		Description: "SQL analyst that writes and explains queries",
+		Prompt: `You are a SQL analyst. Help the user write, explain, and
+optimize SQL queries. Use the database tool, or the schema and migration files,
+to learn the tables before writing a query. Always explain what a query returns
+and point out queries that could scan large tables.`,
+		Tools:       []string{"tool_read_file", "tool_file_chunks", "tool_search_files", "tool_query_database", "tool_scratchpad", "tool_ask_user", "tool_remember_preference", "tool_raw_result"},
+		Temperature: 0.0,
+		TopP:        0.1,
+		TopK:        1,
+	},
+	"writer": {
+		Name:        "writer",
+		Description: "Documentation writer for READMEs and doc comments",
+		Prompt: `You are a technical writer. Read the code and write clear,
+concise documentation for it like READMEs, package docs, and doc comments. Write
+for a reader who has never seen the code. Prefer short sentences and examples
+over long explanations.`,
+		Tools:       []string{"tool_read_file", "tool_file_chunks", "tool_search_files", "tool_create_file", "tool_code_editor", "tool_scratchpad", "tool_ask_user", "tool_remember_preference", "tool_raw_result"},
+		Temperature: 0.7,
+		TopP:        0.9,
+		TopK:        40,
+	},
+}
+
+// lookupPersona returns the persona with the specified name.
+func lookupPersona(name string) (Persona, error) {
+	p, exists := personas[name]
+	if !exists {
+		var names []string
+		for name := range personas {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return Persona{}, fmt.Errorf("unknown persona %q, choose one of %v", name, names)
+	}
+
+	return p, nil
+}
+
+// systemPrompt returns the system prompt for the persona, which includes the
+// instructions for using tools.
+func (p Persona) systemPrompt() string {
+	return p.Prompt + "\n\n" + toolPrompt
+}
+
+// allowsTool reports whether the persona can use the specified tool.
+func (p Persona) allowsTool(name string) bool {
+	return len(p.Tools) == 0 || slices.Contains(p.Tools, name)
+}
+
+// changesFiles reports whether the tool call writes files, which a read-only
+// persona isn't allowed to do.
+func changesFiles(tool Tool, toolCall client.ToolCall) bool {
+	if _, ok := tool.(fileModifier); !ok {
+		return false
+	}
+
+	return isMutation(tool, toolCall)
+}
+
+// =============================================================================
+
+// WithPersona sets the persona the agent starts with.
+func WithPersona(p Persona) func(a *Agent) {
+	return func(a *Agent) {
+		a.setPersona(p)
+	}
+}
+
+// setPersona switches the agent to the persona. The conversation is kept but
+// the system prompt is replaced.
+func (a *Agent) setPersona(p Persona) {
+	a.persona = p
+	a.refreshSystemPrompt()
+}
+
+// activeToolDocuments returns the tool documents for the tools the current
+// persona and the loaded skill packs allow, limited to the tools selected for
+// the turn when there is a selection.
+func (a *Agent) activeToolDocuments() []client.D {
+	selected := a.toolSelection.selected
+
+	var docs []client.D
+	for _, doc := range a.toolDocuments {
+		fn, _ := doc["function"].(client.D)
+		name, _ := fn["name"].(string)
+
+		if a.allowsTool(name) && (selected == nil || selected[name]) {
+			docs = append(docs, doc)
+		}
+	}
+
+	return docs
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestReadOnlyPersona(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	persona := Persona{Name: "auditor", ReadOnly: true}
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}), WithPersona(persona))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	toolCall := client.ToolCall{
+		ID: "call-1",
+		Function: client.Function{
+			Name:      "tool_create_file",
+			Arguments: map[string]any{"path": "notes.txt"},
+		},
+	}
+
+	resps := agent.callTools(context.Background(), []client.ToolCall{toolCall})
+	if len(resps) != 1 {
+		t.Fatalf("got %d results, want 1", len(resps))
+	}
+
+	if content, _ := resps[0]["content"].(string); !strings.Contains(content, "can't change files") {
+		t.Errorf("the call wasn't refused: %s", content)
+	}
+
+	if _, err := os.Stat("notes.txt"); err == nil {
+		t.Error("notes.txt was created by a read-only persona")
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/toolplugin"
+)
+
+// Tools can be written in any language as plugins, programs that speak the
+// small JSON-RPC protocol of the toolplugin package over stdin and stdout.
+// The AGENT_TOOL_PLUGINS environment variable is a comma separated list of
+// the commands that start them, like "python3 zarf/plugins/textstats.py".
+// Every tool a plugin lists is registered with the agent.
+var toolPlugins []string
+
+func init() {
+	if v := os.Getenv("AGENT_TOOL_PLUGINS"); v != "" {
+		for command := range strings.SplitSeq(v, ",") {
+			if command = strings.TrimSpace(command); command != "" {
+				toolPlugins = append(toolPlugins, command)
+			}
+		}
+	}
+}
+
+// Limits applied to the plugins. A plugin must list its tools quickly, a
+// call gets as long as a slow tool of our own.
+const (
+	pluginListTimeout = 10 * time.Second
+	pluginCallTimeout = 2 * time.Minute
+)
+
+// =============================================================================
+// Plugin Tool
+
+// PluginTool represents a tool that is implemented by a plugin process.
+type PluginTool struct {
+	name        string
+	description string
+	parameters  map[string]any
+	sideEffects bool
+	plugin      *toolplugin.Client
+}
+
+// RegisterToolPlugins starts the plugin commands and loads the tools they
+// provide into the provided tools map. A tool can't replace one that is
+// already registered.
+func RegisterToolPlugins(tools map[string]Tool, commands []string) (docs []client.D, err error) {
+	var plugins []*toolplugin.Client
+	var names []string
+
+	// A plugin that can't be registered doesn't leave processes or tools
+	// behind, including the ones of the plugins started before it.
+	defer func() {
+		if err != nil {
+			for _, plugin := range plugins {
+				plugin.Close()
+			}
+			for _, name := range names {
+				delete(tools, name)
+			}
+		}
+	}()
+
+	for _, command := range commands {
+		args := strings.Fields(command)
+
+		plugin, err := toolplugin.Start(args[0], args[1:]...)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", command, err)
+		}
+		plugins = append(plugins, plugin)
+
+		ctx, cancel := context.WithTimeout(context.Background(), pluginListTimeout)
+		list, err := plugin.Tools(ctx)
+		cancel()
+
+		if err != nil {
+			return nil, fmt.Errorf("plugin %q: %w", command, err)
+		}
+
+		for _, t := range list {
+			if _, exists := tools[t.Name]; exists {
+				return nil, fmt.Errorf("plugin %q: tool %q is already registered", command, t.Name)
+			}
+
+			pt := PluginTool{
+				name:        t.Name,
+				description: t.Description,
+				parameters:  t.Parameters,
+				sideEffects: t.SideEffects,
+				plugin:      plugin,
+			}
+			tools[pt.name] = &pt
+			names = append(names, pt.name)
+
+			docs = append(docs, pt.toolDocument())
+		}
+	}
+
+	return docs, nil
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (pt *PluginTool) toolDocument() client.D {
+	parameters := pt.parameters
+	if parameters == nil {
+		parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+
+	return client.D{
+		"type": "function",
+		"function": client.D{
+			"name":        pt.name,
+			"description": pt.description,
+			"parameters":  parameters,
+		},
+	}
+}
+
+// confirmation describes the call the user has to approve when the plugin
+// says the tool has side effects.
+func (pt *PluginTool) confirmation(toolCall client.ToolCall) (string, bool) {
+	if !pt.sideEffects {
+		return "", false
+	}
+
+	args, err := json.Marshal(toolCall.Function.Arguments)
+	if err != nil {
+		args = []byte("{}")
+	}
+
+	return fmt.Sprintf("run the plugin tool %s with %s", pt.name, args), true
+}
+
+// mutation describes the call that would have side effects.
+func (pt *PluginTool) mutation(toolCall client.ToolCall) (string, bool) {
+	cmd, ok := pt.confirmation(toolCall)
+	if !ok {
+		return "", false
+	}
+
+	return "would have " + cmd, true
+}
+
+// Close stops the plugin process. The tools of a plugin share the process,
+// so it's stopped by the first one closed.
+func (pt *PluginTool) Close() error {
+	return pt.plugin.Close()
+}
+
+// Call is the function that is called by the agent to run the tool in the
+// plugin when the model requests the tool with the specified parameters.
+func (pt *PluginTool) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, pt.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, pluginCallTimeout)
+	defer cancel()
+
+	result, err := pt.plugin.CallTool(ctx, pt.name, toolCall.Function.Arguments)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, pt.name, err)
+	}
+
+	return toolSuccessResponse(toolCall.ID, pt.name, ToolData{"result": result})
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"gopkg.in/yaml.v3"
+)
+
+// The policy file, set with the AGENT_POLICY environment variable, decides
+// which tools the agent may call, the paths they may touch, the commands
+// they may run and the calls the user has to approve. It's enforced every
+// time a tool is called, whatever the persona or the model asks for, and a
+// denied call is reported to the model as a tool error saying which rule
+// denied it. See zarf/policy/policy.yaml for an example.
+var policy *Policy
+
+func init() {
+	if v := os.Getenv("AGENT_POLICY"); v != "" {
+		var err error
+		policy, err = loadPolicy(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// The values of the default field of the policy.
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+)
+
+// Policy represents the rules the tool calls have to follow.
+type Policy struct {
+	Default   string                `yaml:"default"`    // allow or deny the tools that aren't listed, allow when empty.
+	DenyPaths []string              `yaml:"deny_paths"` // Paths no tool may touch, like .env or .git/**.
+	Tools     map[string]ToolPolicy `yaml:"tools"`
+
+	denyPaths []*regexp.Regexp
+	rules     map[string]toolRule
+}
+
+// ToolPolicy represents the rules of a single tool. Empty paths or commands
+// don't restrict the tool.
+type ToolPolicy struct {
+	Allow    *bool    `yaml:"allow"`     // Set to false to deny the tool, listed tools are allowed by default.
+	Paths    []string `yaml:"paths"`     // Globs of the paths the tool may touch, like internal/** or *.go.
+	Commands []string `yaml:"commands"`  // Globs of the commands the tool may run, like "go test *".
+	Approval bool     `yaml:"approval"`  // The user has to approve every call.
+	MaxCalls int      `yaml:"max_calls"` // The calls allowed in a session, no limit when zero.
+}
+
+// toolRule represents the compiled rules of a tool.
+type toolRule struct {
+	allow    bool
+	paths    []*regexp.Regexp
+	commands []*regexp.Regexp
+	approval bool
+	maxCalls int
+}
+
+// loadPolicy reads and compiles the policy file.
+func loadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("policy: %w", err)
+	}
+
+	var p Policy
+	if err := yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("policy: %s: %w", path, err)
+	}
+
+	switch p.Default {
+	case "":
+		p.Default = policyAllow
+	case policyAllow, policyDeny:
+	default:
+		return nil, fmt.Errorf("policy: %s: default must be %s or %s, not %q", path, policyAllow, policyDeny, p.Default)
+	}
+
+	if p.denyPaths, err = compileGlobs(p.DenyPaths, pathGlob); err != nil {
+		return nil, fmt.Errorf("policy: %s: deny_paths: %w", path, err)
+	}
+
+	p.rules = make(map[string]toolRule, len(p.Tools))
+	for name, tp := range p.Tools {
+		rule := toolRule{
+			allow:    tp.Allow == nil || *tp.Allow,
+			approval: tp.Approval,
+			maxCalls: tp.MaxCalls,
+		}
+
+		if rule.paths, err = compileGlobs(tp.Paths, pathGlob); err != nil {
+			return nil, fmt.Errorf("policy: %s: %s: paths: %w", path, name, err)
+		}
+
+		if rule.commands, err = compileGlobs(tp.Commands, commandGlob); err != nil {
+			return nil, fmt.Errorf("policy: %s: %s: commands: %w", path, name, err)
+		}
+
+		p.rules[name] = rule
+	}
+
+	return &p, nil
+}
+
+// =============================================================================
+
+// policyDenial represents the rule of the policy that denied a tool call.
+type policyDenial struct {
+	rule  string // tool, path or command.
+	value string // The tool, path or command that was denied.
+}
+
+// response returns the tool error for the denied call. The rule and value
+// let the model correct the call instead of retrying it.
+func (pd policyDenial) response(toolCall client.ToolCall) client.D {
+	var err error
+	switch pd.rule {
+	case "tool":
+		err = fmt.Errorf("the policy doesn't allow calling %s", pd.value)
+	case "path":
+		err = fmt.Errorf("the policy doesn't allow %s to touch %s", toolCall.Function.Name, pd.value)
+	case "command":
+		err = fmt.Errorf("the policy doesn't allow %s to run %q", toolCall.Function.Name, pd.value)
+	case "quota":
+		err = fmt.Errorf("the policy allows %s calls of %s in a session and they are used up", pd.value, toolCall.Function.Name)
+	}
+
+	return ToolError(err).With("policy", ToolData{"rule": pd.rule, "value": pd.value}).Message(toolCall.ID, toolCall.Function.Name)
+}
+
+// check reports the rule denying the tool call, if any. The paths are
+// matched relative to the workspace, the working directory when empty.
+func (p *Policy) check(tool Tool, toolCall client.ToolCall, workspace string) (policyDenial, bool) {
+	name := toolCall.Function.Name
+
+	rule, listed := p.rules[name]
+	if !listed && p.Default == policyDeny || listed && !rule.allow {
+		return policyDenial{rule: "tool", value: name}, true
+	}
+
+	for _, path := range policyPaths(tool, toolCall, workspace) {
+		if matchesAny(p.denyPaths, path) || len(rule.paths) > 0 && !matchesAny(rule.paths, path) {
+			return policyDenial{rule: "path", value: path}, true
+		}
+	}
+
+	if c, ok := tool.(commander); ok && len(rule.commands) > 0 {
+		if cmd, ok := c.commandLine(toolCall); ok && !matchesAny(rule.commands, cmd) {
+			return policyDenial{rule: "command", value: cmd}, true
+		}
+	}
+
+	return policyDenial{}, false
+}
+
+// deniedByPolicy reports whether the policy denies the tool call, setting
+// the response to the tool error for the model.
+func (a *Agent) deniedByPolicy(tool Tool, toolCall client.ToolCall, resp *client.D) bool {
+	denial, denied := policy.check(tool, toolCall, a.workspace)
+
+	// The quota counts the calls the rest of the policy allows. The calls
+	// used are saved with the session so a restart doesn't reset them.
+	if maxCalls := policy.rules[toolCall.Function.Name].maxCalls; !denied && maxCalls > 0 {
+		if a.quotaUsed == nil {
+			a.quotaUsed = make(map[string]int)
+		}
+
+		if a.quotaUsed[toolCall.Function.Name] >= maxCalls {
+			denial, denied = policyDenial{rule: "quota", value: strconv.Itoa(maxCalls)}, true
+		} else {
+			a.quotaUsed[toolCall.Function.Name]++
+		}
+	}
+
+	if !denied {
+		return false
+	}
+
+	a.renderer.Warning(fmt.Sprintf("policy denied %s: %s %s", toolCall.Function.Name, denial.rule, denial.value))
+	*resp = denial.response(toolCall)
+
+	return true
+}
+
+// requiresApproval reports whether the user has to approve every call of the
+// tool.
+func (p *Policy) requiresApproval(name string) bool {
+	return p.rules[name].approval
+}
+
+// approvalPrompt describes a call the policy wants the user to approve.
+func approvalPrompt(toolCall client.ToolCall) string {
+	args, err := json.Marshal(toolCall.Function.Arguments)
+	if err != nil {
+		args = []byte("{}")
+	}
+
+	return fmt.Sprintf("call %s with %s", toolCall.Function.Name, args)
+}
+
+// =============================================================================
+
+// commander is implemented by tools that run commands. It returns the
+// command line of the call and reports false if the call runs no command.
+type commander interface {
+	commandLine(toolCall client.ToolCall) (string, bool)
+}
+
+// policyPaths returns the paths the tool call touches, relative to the
+// workspace: the ones the tool changes and the path argument most tools
+// take.
+func policyPaths(tool Tool, toolCall client.ToolCall, workspace string) []string {
+	var paths []string
+	if fm, ok := tool.(fileModifier); ok {
+		paths = append(paths, fm.modifiedPaths(toolCall)...)
+	}
+
+	if path, ok := toolCall.Function.Arguments["path"].(string); ok && path != "" {
+		paths = append(paths, path)
+	}
+
+	wd := workspace
+	if wd == "" {
+		wd, _ = os.Getwd()
+	}
+
+	rel := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if filepath.IsAbs(path) && wd != "" {
+			if r, err := filepath.Rel(wd, path); err == nil {
+				path = r
+			}
+		}
+
+		rel = append(rel, filepath.ToSlash(filepath.Clean(path)))
+	}
+
+	slices.Sort(rel)
+
+	return slices.Compact(rel)
+}
+
+// =============================================================================
+
+// pathGlob converts a path glob to a regular expression with the gitignore
+// syntax: a glob without a slash matches a name at any depth.
+func pathGlob(glob string) string {
+	if strings.Contains(glob, "/") {
+		return globToRegexp(strings.TrimPrefix(glob, "/"))
+	}
+
+	return "(.*/)?" + globToRegexp(glob)
+}
+
+// commandGlob converts a command glob to a regular expression, a star
+// matches anything, spaces and slashes included.
+func commandGlob(glob string) string {
+	return strings.ReplaceAll(regexp.QuoteMeta(glob), `\*`, ".*")
+}
+
+// compileGlobs compiles the globs to anchored regular expressions.
+func compileGlobs(globs []string, convert func(string) string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(globs))
+	for _, glob := range globs {
+		re, err := regexp.Compile("^" + convert(glob) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", glob, err)
+		}
+		res = append(res, re)
+	}
+
+	return res, nil
+}
+
+// matchesAny reports whether any of the expressions matches the value.
+func matchesAny(res []*regexp.Regexp, value string) bool {
+	for _, re := range res {
+		if re.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// The steps applied to the model's answer before it's stored in the
+// conversation, in order. What the user sees streamed is not changed. This
+// can be changed with the AGENT_POSTPROCESS environment variable using a
+// comma separated list of the steps in postProcessors, or "none".
+var postProcessSteps = []string{"trim", "whitespace"}
+
+func init() {
+	if v := os.Getenv("AGENT_POSTPROCESS"); v != "" {
+		postProcessSteps = nil
+		for name := range strings.SplitSeq(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || name == "none" {
+				continue
+			}
+
+			if _, exists := postProcessors[name]; !exists {
+				log.Fatal(fmt.Errorf("unknown post-processing step %q", name))
+			}
+			postProcessSteps = append(postProcessSteps, name)
+		}
+	}
+}
+
+// postProcessor transforms the content of an answer.
+type postProcessor func(content string) string
+
+// postProcessors is the set of supported post-processing steps keyed by
+// name.
+var postProcessors = map[string]postProcessor{
+	"trim":        strings.TrimSpace,
+	"whitespace":  normalizeWhitespace,
+	"boilerplate": stripBoilerplate,
+}
+
+// postProcess runs the content through the configured steps.
+func postProcess(content string) string {
+	for _, name := range postProcessSteps {
+		content = postProcessors[name](content)
+	}
+
+	return content
+}
+
+// =============================================================================
+
+var (
+	trailingSpacePattern = regexp.MustCompile(`[ \t]+\n`)
+	blankLinesPattern    = regexp.MustCompile(`\n{3,}`)
+)
+
+// normalizeWhitespace removes trailing spaces and collapses runs of blank
+// lines into one. Code blocks are left alone since whitespace can matter
+// there.
+func normalizeWhitespace(content string) string {
+	return outsideCode(content, func(prose string) string {
+		prose = strings.ReplaceAll(prose, "\r\n", "\n")
+		prose = trailingSpacePattern.ReplaceAllString(prose, "\n")
+		return blankLinesPattern.ReplaceAllString(prose, "\n\n")
+	})
+}
+
+var (
+	boilerplateStartPattern = regexp.MustCompile(`(?i)^(sure|certainly|of course|great question|absolutely)[!,.]\s*`)
+	boilerplateEndPattern   = regexp.MustCompile(`(?i)\n*(i hope (this|that) helps|let me know if you (have|need)|feel free to (ask|reach out)|happy coding)[^\n]*$`)
+)
+
+// stripBoilerplate removes the filler the model adds to the start and end of
+// an answer. It only costs tokens when the conversation is sent back.
+func stripBoilerplate(content string) string {
+	content = boilerplateStartPattern.ReplaceAllString(content, "")
+	content = boilerplateEndPattern.ReplaceAllString(content, "")
+
+	return strings.TrimSpace(content)
+}
+
+// outsideCode applies the function to the text between the fenced code
+// blocks.
+func outsideCode(content string, fn func(string) string) string {
+	var b strings.Builder
+
+	last := 0
+	for _, loc := range fencedCodePattern.FindAllStringIndex(content, -1) {
+		b.WriteString(fn(content[last:loc[0]]))
+		b.WriteString(content[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	b.WriteString(fn(content[last:]))
+
+	return b.String()
+}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Limits that keep the preferences block in the system prompt compact.
+const (
+	preferencesMax      = 20
+	preferenceMaxLength = 200
+)
+
+// Where the preferences the model learns about the user are kept, so they
+// carry over to future sessions. Every workspace has its own file in the
+// user's config directory so the preferences learned in one project, or from
+// one user of a daemon, don't show up in another. The AGENT_PREFERENCES
+// environment variable sets a single file instead, AGENT_PREFERENCES=off
+// doesn't remember anything.
+var (
+	preferencesDir  string
+	preferencesFile string
+)
+
+func init() {
+	switch v := os.Getenv("AGENT_PREFERENCES"); v {
+	case "off":
+
+	case "":
+		if dir, err := os.UserConfigDir(); err == nil {
+			preferencesDir = filepath.Join(dir, "ardanlabs-agent", "preferences")
+		}
+
+	default:
+		preferencesFile = v
+	}
+}
+
+// preferencesMu serializes the changes to the preferences files, the agents
+// of a daemon in the same workspace share one.
+var preferencesMu sync.Mutex
+
+// Preference represents something the user prefers, like the language the
+// answers are written in.
+type Preference struct {
+	Value   string    `json:"value"`
+	Updated time.Time `json:"updated"`
+}
+
+// Preferences represents the profile file with the user's preferences. The
+// file is read every time so the agents of a daemon see the changes the
+// others make.
+type Preferences struct {
+	path string
+}
+
+// Load returns the preferences in the file, there are none when the file
+// doesn't exist yet.
+func (p Preferences) Load() (map[string]Preference, error) {
+	prefs := make(map[string]Preference)
+
+	if p.path == "" {
+		return prefs, nil
+	}
+
+	data, err := os.ReadFile(p.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return prefs, nil
+
+	case err != nil:
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", p.path, err)
+	}
+
+	return prefs, nil
+}
+
+// Set saves the preference, an empty value removes it.
+func (p Preferences) Set(key string, value string) error {
+	if p.path == "" {
+		return errors.New("preferences are turned off")
+	}
+
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	prefs, err := p.Load()
+	if err != nil {
+		return err
+	}
+
+	if value == "" {
+		delete(prefs, key)
+		return p.save(prefs)
+	}
+
+	if _, exists := prefs[key]; !exists && len(prefs) >= preferencesMax {
+		return fmt.Errorf("there are already %d preferences, replace or remove one of %v", preferencesMax, slices.Sorted(maps.Keys(prefs)))
+	}
+
+	prefs[key] = Preference{
+		Value:   value,
+		Updated: time.Now().UTC(),
+	}
+
+	return p.save(prefs)
+}
+
+// Clear removes the preference with the key, or all of them when the key is
+// empty.
+func (p Preferences) Clear(key string) error {
+	if key != "" {
+		return p.Set(key, "")
+	}
+
+	preferencesMu.Lock()
+	defer preferencesMu.Unlock()
+
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove: %w", err)
+	}
+
+	return nil
+}
+
+func (p Preferences) save(prefs map[string]Preference) error {
+	data, err := json.MarshalIndent(prefs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p.path), 0755); err != nil {
+		return fmt.Errorf("create dir: %w", err)
+	}
+
+	return writeFileAtomic(p.path, data)
+}
+
+// prompt returns the block added to the system prompt, it's empty when there
+// are no preferences.
+func (p Preferences) prompt() string {
+	prefs, err := p.Load()
+	if err != nil || len(prefs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("\nThe user told you about these preferences in earlier sessions, follow them unless they ask for something else:\n\n")
+	for _, key := range slices.Sorted(maps.Keys(prefs)) {
+		fmt.Fprintf(&b, "- %s: %s\n", key, prefs[key].Value)
+	}
+
+	return b.String()
+}
+
+// normalizePreferenceKey turns keys like "Code Style" into code_style so the
+// model doesn't save the same preference twice.
+func normalizePreferenceKey(key string) string {
+	return strings.Join(strings.Fields(strings.ToLower(strings.ReplaceAll(key, "-", " "))), "_")
+}
+
+// =============================================================================
+// RememberPreference Tool
+
+// RememberPreference represents a tool the model uses to save what it learns
+// about how the user likes to work, so future sessions start with it.
+type RememberPreference struct {
+	name        string
+	preferences Preferences
+}
+
+// RegisterRememberPreference creates a new instance of the RememberPreference
+// tool and loads it into the provided tools map.
+func RegisterRememberPreference(tools map[string]Tool, preferences Preferences) client.D {
+	rp := RememberPreference{
+		name:        "tool_remember_preference",
+		preferences: preferences,
+	}
+	tools[rp.name] = &rp
+
+	return rp.toolDocument()
+}
+
+// rememberPreferenceParams represents the parameters for the
+// RememberPreference tool.
+type rememberPreferenceParams struct {
+	Key   string `json:"key" description:"Short name of the preference like language, code_style or verbosity."`
+	Value string `json:"value" description:"The preference in a few words, like 'Spanish' or 'short answers without explanations'. Empty to forget the preference."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (rp *RememberPreference) toolDocument() client.D {
+	description := "Remember a lasting preference the user states about how they like to work, like the language to answer in, their code style or how detailed answers should be, so future sessions follow it. Only save preferences the user states for the long run, not instructions for the current task."
+
+	return client.ToolDocument(rp.name, description, rememberPreferenceParams{})
+}
+
+// Call is the function that is called by the agent to save the preference
+// when the model requests the tool with the specified parameters.
+func (rp *RememberPreference) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, rp.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params rememberPreferenceParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, rp.name, err)
+	}
+
+	key := normalizePreferenceKey(params.Key)
+	if key == "" {
+		return toolErrorResponse(toolCall.ID, rp.name, errors.New("key is required"))
+	}
+
+	value := strings.TrimSpace(params.Value)
+	if len(value) > preferenceMaxLength {
+		return toolErrorResponse(toolCall.ID, rp.name, fmt.Errorf("the value is %d bytes, keep it under %d", len(value), preferenceMaxLength))
+	}
+
+	if err := rp.preferences.Set(key, value); err != nil {
+		return toolErrorResponse(toolCall.ID, rp.name, err)
+	}
+
+	if value == "" {
+		return toolSuccessResponse(toolCall.ID, rp.name, ToolData{"forgot": key})
+	}
+
+	return toolSuccessResponse(toolCall.ID, rp.name, ToolData{"remembered": key, "value": value})
+}
+
+// =============================================================================
+
+func (a *Agent) cmdPreferences(ctx context.Context, args []string) {
+	if a.preferences.path == "" {
+		a.renderer.Info("preferences are turned off")
+		return
+	}
+
+	if len(args) > 0 {
+		if args[0] != "clear" {
+			a.renderer.Error(fmt.Errorf("preferences: unknown action %q, use clear", args[0]))
+			return
+		}
+
+		var key string
+		if len(args) > 1 {
+			key = normalizePreferenceKey(strings.Join(args[1:], " "))
+		}
+
+		if err := a.preferences.Clear(key); err != nil {
+			a.renderer.Error(fmt.Errorf("preferences: %w", err))
+			return
+		}
+
+		a.refreshSystemPrompt()
+
+		if key != "" {
+			a.renderer.Info(fmt.Sprintf("forgot the %s preference", key))
+			return
+		}
+		a.renderer.Info("forgot all preferences")
+		return
+	}
+
+	prefs, err := a.preferences.Load()
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("preferences: %w", err))
+		return
+	}
+
+	if len(prefs) == 0 {
+		a.renderer.Info(fmt.Sprintf("no preferences saved in %s yet", a.preferences.path))
+		return
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(prefs)) {
+		a.renderer.Info(fmt.Sprintf("%-15s %s (%s)", key, prefs[key].Value, prefs[key].Updated.Local().Format(time.DateOnly)))
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// When the model reads a file it often reads the files that one depends on
+// next. Prefetching guesses those files and reads them in the background so
+// the next read is served from memory. This can be turned off with the
+// AGENT_PREFETCH environment variable.
+var prefetchEnabled = true
+
+// Limits on the prefetch cache so guessing can't use up the memory.
+const (
+	prefetchMaxFiles    = 64
+	prefetchMaxFileSize = 256 * 1024
+)
+
+func init() {
+	if v := os.Getenv("AGENT_PREFETCH"); v != "" {
+		var err error
+		prefetchEnabled, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// prefetchHeuristic is implemented by the rules that guess which files the
+// model will read after reading a file.
+type prefetchHeuristic interface {
+	candidates(path string, content []byte) []string
+}
+
+// =============================================================================
+
+// Prefetch represents a layer around a file tool that serves reads from a
+// cache and fills the cache with the files the heuristics guess the model
+// will ask for next. The wrapped tool must take the file in a path parameter
+// and return it in file_contents, and it must be read-only since a cache hit
+// doesn't call it.
+type Prefetch struct {
+	tool       Tool
+	heuristics []prefetchHeuristic
+	mu         sync.Mutex
+	cache      map[string]prefetchEntry
+	hits       int
+}
+
+// prefetchEntry represents a prefetched file. The size and modification time
+// are checked before the entry is used so edits are never hidden.
+type prefetchEntry struct {
+	content []byte
+	size    int64
+	modTime time.Time
+	added   time.Time
+}
+
+// withPrefetch wraps the named tool with a prefetch layer using the specified
+// heuristics. Tools that change something, ask for approval or reach the
+// network are left as they are, serving them from a cache would skip those
+// checks.
+func withPrefetch(tools map[string]Tool, name string, heuristics ...prefetchHeuristic) {
+	if !prefetchEnabled || !readOnly(tools[name]) {
+		return
+	}
+
+	tools[name] = &Prefetch{
+		tool:       tools[name],
+		heuristics: heuristics,
+		cache:      make(map[string]prefetchEntry),
+	}
+}
+
+// Call serves the read from the cache when the file was prefetched and
+// hasn't changed, otherwise the wrapped tool is called. Either way the
+// heuristics are run on the file to prefetch the next ones. The agent runs
+// its hooks around Call, so a cache hit goes through them like a read.
+func (pf *Prefetch) Call(ctx context.Context, toolCall client.ToolCall) client.D {
+	// The cache and the heuristics work in the current directory, the reads
+	// in a user's workspace go to the wrapped tool.
+	if workspaceDir(ctx) != "" {
+		return pf.tool.Call(ctx, toolCall)
+	}
+
+	path, _ := toolCall.Function.Arguments["path"].(string)
+	path = filepath.Clean(path)
+
+	if content, ok := pf.lookup(path); ok {
+		go pf.prefetch(path, content)
+		return toolSuccessResponse(toolCall.ID, toolCall.Function.Name, ToolData{"file_contents": string(content)})
+	}
+
+	resp := pf.tool.Call(ctx, toolCall)
+
+	if content, err := os.ReadFile(path); err == nil {
+		go pf.prefetch(path, content)
+	}
+
+	return resp
+}
+
+// wrapped returns the tool the layer serves the reads of, so the hooks can
+// check the tool itself.
+func (pf *Prefetch) wrapped() Tool {
+	return pf.tool
+}
+
+// lookup returns the prefetched content of the file if it's still current.
+func (pf *Prefetch) lookup(path string) ([]byte, bool) {
+	pf.mu.Lock()
+	entry, exists := pf.cache[path]
+	pf.mu.Unlock()
+
+	if !exists {
+		return nil, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != entry.size || !info.ModTime().Equal(entry.modTime) {
+		pf.mu.Lock()
+		delete(pf.cache, path)
+		pf.mu.Unlock()
+		return nil, false
+	}
+
+	pf.mu.Lock()
+	pf.hits++
+	pf.mu.Unlock()
+
+	return entry.content, true
+}
+
+// prefetch reads the files the heuristics pick for the file into the cache.
+func (pf *Prefetch) prefetch(path string, content []byte) {
+	for _, h := range pf.heuristics {
+		for _, candidate := range h.candidates(path, content) {
+			candidate = filepath.Clean(candidate)
+
+			pf.mu.Lock()
+			_, exists := pf.cache[candidate]
+			pf.mu.Unlock()
+
+			if exists || candidate == path {
+				continue
+			}
+
+			info, err := os.Stat(candidate)
+			if err != nil || info.IsDir() || info.Size() > prefetchMaxFileSize {
+				continue
+			}
+
+			data, err := os.ReadFile(candidate)
+			if err != nil {
+				continue
+			}
+
+			pf.add(candidate, prefetchEntry{
+				content: data,
+				size:    info.Size(),
+				modTime: info.ModTime(),
+				added:   time.Now(),
+			})
+		}
+	}
+}
+
+// add stores the entry, evicting the oldest entry when the cache is full.
+func (pf *Prefetch) add(path string, entry prefetchEntry) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	if len(pf.cache) >= prefetchMaxFiles {
+		var oldest string
+		for p, e := range pf.cache {
+			if oldest == "" || e.added.Before(pf.cache[oldest].added) {
+				oldest = p
+			}
+		}
+		delete(pf.cache, oldest)
+	}
+
+	pf.cache[path] = entry
+}
+
+// forget drops the files from the cache, the next reads of them call the
+// wrapped tool.
+func (pf *Prefetch) forget(paths ...string) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	for _, path := range paths {
+		delete(pf.cache, filepath.Clean(path))
+	}
+}
+
+// stats returns the number of cached files and reads served from the cache.
+func (pf *Prefetch) stats() (int, int) {
+	pf.mu.Lock()
+	defer pf.mu.Unlock()
+
+	return len(pf.cache), pf.hits
+}
+
+// readOnly reports whether the tool only reads, it implements none of the
+// interfaces of the tools that change something, ask for approval or reach
+// the network.
+func readOnly(tool Tool) bool {
+	switch tool.(type) {
+	case nil, fileModifier, mutator, confirmer, commander, networker:
+		return false
+	}
+
+	return true
+}
+
+// =============================================================================
+
+// goImports guesses that after reading a Go file the model reads the
+// packages it imports from the same module.
+type goImports struct {
+	module string
+}
+
+// newGoImports constructs the heuristic for the module in the working
+// directory. It returns nil if there is no go.mod.
+func newGoImports() *goImports {
+	data, err := os.ReadFile("go.mod")
+	if err != nil {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if module, ok := strings.CutPrefix(strings.TrimSpace(scanner.Text()), "module "); ok {
+			return &goImports{
+				module: strings.Trim(strings.TrimSpace(module), `"`),
+			}
+		}
+	}
+
+	return nil
+}
+
+func (gi *goImports) candidates(path string, content []byte) []string {
+	if filepath.Ext(path) != ".go" {
+		return nil
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), path, content, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+
+	var paths []string
+	for _, imp := range file.Imports {
+		importPath, _ := strconv.Unquote(imp.Path.Value)
+
+		dir, ok := strings.CutPrefix(importPath, gi.module+"/")
+		if !ok {
+			continue
+		}
+
+		files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+		for _, f := range files {
+			if !strings.HasSuffix(f, "_test.go") {
+				paths = append(paths, f)
+			}
+		}
+	}
+
+	return paths
+}
+
+// =============================================================================
+
+// mentionedPathPattern matches relative file paths like foundation/client/client.go.
+var mentionedPathPattern = regexp.MustCompile(`[\w.-]+(?:/[\w.-]+)*\.[A-Za-z]{1,5}\b`)
+
+// mentionedPaths guesses that the model reads the files that are mentioned
+// by path in the file it read, like the files listed in a README or loaded
+// by a makefile.
+type mentionedPaths struct{}
+
+func (mentionedPaths) candidates(path string, content []byte) []string {
+	var paths []string
+	seen := make(map[string]bool)
+
+	for _, match := range mentionedPathPattern.FindAll(content, 100) {
+		p := string(match)
+		if seen[p] || strings.Contains(p, "..") {
+			continue
+		}
+		seen[p] = true
+
+		if info, err := os.Stat(p); err == nil && !info.IsDir() {
+			paths = append(paths, p)
+		}
+	}
+
+	return paths
+}
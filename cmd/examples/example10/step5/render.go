@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Renderer describes the behavior required to display the agent's activity
+// to the user. This allows the same agent to be used from the terminal or
+// behind an API.
+type Renderer interface {
+	Waiting(model string, elapsed time.Duration)
+	Reasoning(text string)
+	Content(text string)
+	ToolCall(toolCall client.ToolCall)
+	ToolResult(toolCall client.ToolCall, result client.D)
+	Info(msg string)
+	Warning(msg string)
+	Error(err error)
+	Done()
+}
+
+// =============================================================================
+
+// terminalRenderer displays the agent's activity in a terminal using ANSI
+// colors and markdown rendering.
+type terminalRenderer struct {
+	w         io.Writer
+	md        *markdownWriter
+	reasoning bool
+
+	// The latency line is written from the timer goroutine.
+	mu      sync.Mutex
+	waiting bool
+}
+
+// newTerminalRenderer constructs a renderer for the terminal.
+func newTerminalRenderer() *terminalRenderer {
+	return &terminalRenderer{
+		w:  os.Stdout,
+		md: newMarkdownWriter(os.Stdout),
+	}
+}
+
+// Waiting shows how long we have been waiting for the model to respond.
+func (tr *terminalRenderer) Waiting(model string, elapsed time.Duration) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if !tr.waiting {
+		tr.waiting = true
+		fmt.Fprint(tr.w, "\n")
+	}
+
+	m := elapsed.Milliseconds()
+	fmt.Fprintf(tr.w, "\r%s: ", paint(theme.Waiting, fmt.Sprintf("%s %d.%03d", model, m/1000, m%1000)))
+}
+
+// Reasoning displays the reasoning of the model in a different color.
+func (tr *terminalRenderer) Reasoning(text string) {
+	tr.endWaiting()
+
+	if !tr.reasoning {
+		tr.reasoning = true
+		fmt.Fprint(tr.w, "\n")
+	}
+
+	fmt.Fprint(tr.w, paint(theme.Reasoning, text))
+}
+
+// Content displays the answer from the model as markdown.
+func (tr *terminalRenderer) Content(text string) {
+	tr.endWaiting()
+
+	if tr.reasoning {
+		tr.reasoning = false
+		fmt.Fprint(tr.w, "\n\n")
+	}
+
+	tr.md.Write(text)
+}
+
+// ToolCall displays the tool the model asked to call.
+func (tr *terminalRenderer) ToolCall(toolCall client.ToolCall) {
+	tr.endWaiting()
+
+	fmt.Fprintf(tr.w, "\n%s:\n\n", paint(theme.Tool, fmt.Sprintf("%s(%v)", toolCall.Function.Name, toolCall.Function.Arguments)))
+}
+
+// ToolResult displays the result of a tool call. File edits are displayed as
+// a colored diff.
+func (tr *terminalRenderer) ToolResult(toolCall client.ToolCall, result client.D) {
+	tr.endWaiting()
+
+	var resp struct {
+		Data struct {
+			Diff string `json:"diff"`
+		} `json:"data"`
+	}
+
+	if content, ok := result["content"].(string); ok {
+		if err := json.Unmarshal([]byte(content), &resp); err == nil && resp.Data.Diff != "" {
+			fmt.Fprint(tr.w, colorDiff(resp.Data.Diff))
+			return
+		}
+	}
+
+	fmt.Fprintf(tr.w, "%#v\n", result)
+}
+
+// Info displays status information like token usage.
+func (tr *terminalRenderer) Info(msg string) {
+	tr.endWaiting()
+
+	fmt.Fprintf(tr.w, "%s\n", paint(theme.Stats, msg))
+}
+
+// Warning displays something the user should look at, like a tool result
+// that tries to instruct the model.
+func (tr *terminalRenderer) Warning(msg string) {
+	tr.endWaiting()
+
+	fmt.Fprintf(tr.w, "%s\n", paint(theme.Question, "WARNING: "+msg))
+}
+
+// Error displays an error.
+func (tr *terminalRenderer) Error(err error) {
+	tr.endWaiting()
+
+	fmt.Fprintf(tr.w, "\n\n%s\n\n", paint(theme.Error, fmt.Sprintf("ERROR:%s", err)))
+}
+
+// Done is called when the model has finished responding.
+func (tr *terminalRenderer) Done() {
+	tr.endWaiting()
+
+	tr.md.Flush()
+	tr.reasoning = false
+	fmt.Fprint(tr.w, "\n")
+}
+
+// endWaiting moves past the latency line once the model starts responding.
+func (tr *terminalRenderer) endWaiting() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	if tr.waiting {
+		tr.waiting = false
+		fmt.Fprint(tr.w, "\n")
+	}
+}
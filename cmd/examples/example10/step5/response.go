@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// toolResponseVersion is the version of the envelope the tool results are
+// sent to the model in. It changes when the shape of the envelope does, so
+// the results in saved sessions and logs can be told apart.
+const toolResponseVersion = 1
+
+// The statuses of a tool response.
+const (
+	toolStatusSuccess = "SUCCESS"
+	toolStatusFailed  = "FAILED"
+)
+
+// ToolData represents the values a tool returns to the model.
+type ToolData map[string]any
+
+// ToolResponse represents the envelope every tool result is sent to the
+// model in.
+type ToolResponse struct {
+	Version int      `json:"version"`
+	Status  string   `json:"status"`
+	Data    ToolData `json:"data"`
+}
+
+// ToolSuccess constructs a successful response with the data.
+func ToolSuccess(data ToolData) ToolResponse {
+	if data == nil {
+		data = ToolData{}
+	}
+
+	return ToolResponse{
+		Version: toolResponseVersion,
+		Status:  toolStatusSuccess,
+		Data:    data,
+	}
+}
+
+// ToolError constructs a failed response for the error.
+func ToolError(err error) ToolResponse {
+	return ToolResponse{
+		Version: toolResponseVersion,
+		Status:  toolStatusFailed,
+		Data:    ToolData{"error": err.Error()},
+	}
+}
+
+// With returns a copy of the response with the value added to the data.
+func (tr ToolResponse) With(key string, value any) ToolResponse {
+	data := make(ToolData, len(tr.Data)+1)
+	for k, v := range tr.Data {
+		data[k] = v
+	}
+	data[key] = value
+
+	tr.Data = data
+
+	return tr
+}
+
+// Failed reports whether the tool call failed.
+func (tr ToolResponse) Failed() bool {
+	return tr.Status == toolStatusFailed
+}
+
+// Message returns the tool message for the model with the response as its
+// content. This is the only place the envelope is marshaled, a value that
+// can't be marshaled turns the response into a failed one.
+func (tr ToolResponse) Message(toolID string, toolName string) client.D {
+	content, err := json.Marshal(tr)
+	if err != nil {
+		content, _ = json.Marshal(ToolError(fmt.Errorf("marshal tool response: %w", err)))
+	}
+
+	return client.ToolResult(toolID, toolName, string(content))
+}
+
+// parseToolResponse decodes the content of a tool message. Results saved
+// before the envelope had a version decode with version zero.
+func parseToolResponse(content string) (ToolResponse, error) {
+	var tr ToolResponse
+	if err := json.Unmarshal([]byte(content), &tr); err != nil {
+		return ToolResponse{}, err
+	}
+
+	if tr.Status != toolStatusSuccess && tr.Status != toolStatusFailed {
+		return ToolResponse{}, fmt.Errorf("unknown tool response status %q", tr.Status)
+	}
+
+	return tr, nil
+}
+
+// =============================================================================
+
+// toolSuccessResponse returns the tool message for a successful call.
+func toolSuccessResponse(toolID string, toolName string, data ToolData) client.D {
+	return ToolSuccess(data).Message(toolID, toolName)
+}
+
+// toolErrorResponse returns the tool message for a failed call.
+func toolErrorResponse(toolID string, toolName string, err error) client.D {
+	return ToolError(err).Message(toolID, toolName)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// TurnResult represents the structured outcome of an agent turn so
+// downstream tooling can consume agent runs programmatically.
+type TurnResult struct {
+	Answer      string      `json:"answer"`
+	ToolCalls   []ToolEvent `json:"tool_calls"`
+	Usage       TurnUsage   `json:"usage"`
+	Timing      TurnTiming  `json:"timing"`
+	Limit       string      `json:"limit,omitempty"`
+	Truncated   bool        `json:"truncated,omitempty"`
+	Translation string      `json:"translation,omitempty"`
+	Cached      bool        `json:"cached,omitempty"`
+}
+
+// TurnUsage represents the tokens used during a turn. Input tokens are
+// counted for every model call since the conversation is sent each time.
+// The counts are estimated with the tokenizer, the server reported usage and
+// its cost are included when the server sends them.
+type TurnUsage struct {
+	ModelCalls      int           `json:"model_calls"`
+	InputTokens     int           `json:"input_tokens"`
+	OutputTokens    int           `json:"output_tokens"`
+	ReasoningTokens int           `json:"reasoning_tokens"`
+	Reported        *client.Usage `json:"reported,omitempty"`
+	Cost            float64       `json:"cost_usd,omitempty"`
+}
+
+// TurnTiming represents where the time was spent during a turn.
+type TurnTiming struct {
+	Start      time.Time `json:"start"`
+	DurationMS int64     `json:"duration_ms"`
+	ModelMS    int64     `json:"model_ms"`
+	ToolsMS    int64     `json:"tools_ms"`
+}
+
+// LastTurn returns the result of the most recent turn.
+func (a *Agent) LastTurn() TurnResult {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := a.turn
+	result.Answer = a.LastAnswer()
+	result.ToolCalls = slices.Clone(a.turn.ToolCalls)
+	if result.ToolCalls == nil {
+		result.ToolCalls = []ToolEvent{}
+	}
+
+	return result
+}
+
+// beginTurn resets the turn result for a new user request.
+func (a *Agent) beginTurn() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.turnNumber++
+	a.turn = TurnResult{
+		Timing: TurnTiming{
+			Start: time.Now().UTC(),
+		},
+	}
+}
+
+// endTurn records how long the turn took.
+func (a *Agent) endTurn() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.turn.Timing.DurationMS = time.Since(a.turn.Timing.Start).Milliseconds()
+}
+
+// recordModelCall adds the usage of a single model call to the turn. The
+// reported usage is nil if the server didn't send it.
+func (a *Agent) recordModelCall(inputTokens int, outputTokens int, reasoningTokens int, reported *client.Usage, latency time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.turn.Usage.ModelCalls++
+	a.turn.Usage.InputTokens += inputTokens
+	a.turn.Usage.OutputTokens += outputTokens
+	a.turn.Usage.ReasoningTokens += reasoningTokens
+	a.turn.Timing.ModelMS += latency.Milliseconds()
+
+	if reported != nil {
+		if a.turn.Usage.Reported == nil {
+			a.turn.Usage.Reported = &client.Usage{}
+		}
+
+		a.turn.Usage.Reported.PromptTokens += reported.PromptTokens
+		a.turn.Usage.Reported.CompletionTokens += reported.CompletionTokens
+		a.turn.Usage.Reported.TotalTokens += reported.TotalTokens
+		a.turn.Usage.Cost = usageCost(*a.turn.Usage.Reported)
+	}
+}
+
+// reportUsage displays the usage reported by the server for the turn and
+// what it cost.
+func (a *Agent) reportUsage() {
+	a.mu.Lock()
+	reported := a.turn.Usage.Reported
+	cost := a.turn.Usage.Cost
+	a.mu.Unlock()
+
+	if reported == nil {
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("Server Tokens Prompt[%d] Completion[%d] Total[%d] Cost[$%.4f]", reported.PromptTokens, reported.CompletionTokens, reported.TotalTokens, cost))
+}
+
+// usageCost returns the cost in dollars of the usage.
+func usageCost(usage client.Usage) float64 {
+	return (float64(usage.PromptTokens)*priceInput + float64(usage.CompletionTokens)*priceOutput) / 1_000_000
+}
+
+// =============================================================================
+
+// The output formats for one-shot and daemon modes.
+const (
+	outputPlain = "plain"
+	outputJSON  = "json"
+	outputJSONL = "jsonl"
+)
+
+// validateOutput checks the output format is supported.
+func validateOutput(output string) error {
+	switch output {
+	case outputPlain, outputJSON, outputJSONL:
+		return nil
+	}
+
+	return fmt.Errorf("unknown output format %q, use %s, %s or %s", output, outputPlain, outputJSON, outputJSONL)
+}
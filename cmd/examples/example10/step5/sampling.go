@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The seed of the sampling for every session, none by default so the
+// responses vary. This can be set with the AGENT_SEED environment variable
+// so a demo run can be reproduced exactly on the same model and server
+// version. The seed of every model call is recorded in the metadata of the
+// conversation.
+var defaultSeed *int
+
+func init() {
+	if v := os.Getenv("AGENT_SEED"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(fmt.Errorf("seed: %w", err))
+		}
+		defaultSeed = &n
+	}
+}
+
+// Sampling represents settings that override the sampling of the persona.
+// Only the settings that are set override the persona, so the user can
+// experiment with one of them at a time.
+type Sampling struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
+	Seed        *int     `json:"seed,omitempty"`
+}
+
+// over returns the settings with the ones that are not set taken from base.
+func (s Sampling) over(base Sampling) Sampling {
+	if s.Temperature != nil {
+		base.Temperature = s.Temperature
+	}
+	if s.TopP != nil {
+		base.TopP = s.TopP
+	}
+	if s.TopK != nil {
+		base.TopK = s.TopK
+	}
+	if s.Seed != nil {
+		base.Seed = s.Seed
+	}
+
+	return base
+}
+
+// isZero reports if none of the settings are set.
+func (s Sampling) isZero() bool {
+	return s.Temperature == nil && s.TopP == nil && s.TopK == nil && s.Seed == nil
+}
+
+// validate checks the settings are in the range the servers accept.
+func (s Sampling) validate() error {
+	if s.Temperature != nil && (*s.Temperature < 0 || *s.Temperature > 2) {
+		return fmt.Errorf("temperature %v must be between 0 and 2", *s.Temperature)
+	}
+
+	if s.TopP != nil && (*s.TopP < 0 || *s.TopP > 1) {
+		return fmt.Errorf("top_p %v must be between 0 and 1", *s.TopP)
+	}
+
+	if s.TopK != nil && *s.TopK < 0 {
+		return fmt.Errorf("top_k %d can't be negative", *s.TopK)
+	}
+
+	return nil
+}
+
+// parseSampling parses settings written as key=value, like temperature=0.7.
+func parseSampling(args []string) (Sampling, error) {
+	var s Sampling
+
+	for _, arg := range args {
+		key, value, found := strings.Cut(arg, "=")
+		if !found {
+			return Sampling{}, fmt.Errorf("%q must be written as key=value", arg)
+		}
+
+		switch key {
+		case "temperature":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Sampling{}, fmt.Errorf("temperature: %w", err)
+			}
+			s.Temperature = &f
+
+		case "top_p":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Sampling{}, fmt.Errorf("top_p: %w", err)
+			}
+			s.TopP = &f
+
+		case "top_k":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Sampling{}, fmt.Errorf("top_k: %w", err)
+			}
+			s.TopK = &n
+
+		case "seed":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return Sampling{}, fmt.Errorf("seed: %w", err)
+			}
+			s.Seed = &n
+
+		default:
+			return Sampling{}, fmt.Errorf("unknown setting %q, use temperature, top_p, top_k or seed", key)
+		}
+	}
+
+	return s, s.validate()
+}
+
+// =============================================================================
+
+// SetSampling overrides the sampling of the persona for the rest of the
+// session. The settings are added to the ones already overridden, an empty
+// Sampling goes back to the settings of the persona.
+func (a *Agent) SetSampling(s Sampling) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	if s.isZero() {
+		a.sampling = Sampling{}
+		return nil
+	}
+
+	a.sampling = s.over(a.sampling)
+
+	return nil
+}
+
+// OverrideTurn overrides the sampling for the next turn only, on top of the
+// settings of the session. This lets a client of the daemon try a setting
+// on a single message.
+func (a *Agent) OverrideTurn(s Sampling) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+
+	a.turnSampling = s
+
+	return nil
+}
+
+// currentSampling returns the settings for the next model call, the persona
+// overridden by the session and then by the turn.
+func (a *Agent) currentSampling() (temperature float64, topP float64, topK int) {
+	p := a.persona
+
+	s := a.turnSampling.over(a.sampling.over(Sampling{
+		Temperature: &p.Temperature,
+		TopP:        &p.TopP,
+		TopK:        &p.TopK,
+	}))
+
+	return *s.Temperature, *s.TopP, *s.TopK
+}
+
+// currentSeed returns the seed for the next model call, the one of the turn,
+// then of the session and then AGENT_SEED. It's nil when none is set.
+func (a *Agent) currentSeed() *int {
+	return a.turnSampling.over(a.sampling.over(Sampling{Seed: defaultSeed})).Seed
+}
+
+// withSeed adds the seed to a request to the model when one is set.
+func (a *Agent) withSeed(d client.D) {
+	if seed := a.currentSeed(); seed != nil {
+		client.WithSeed(*seed)(d)
+	}
+}
+
+// withTopK adds top_k to a request to the model. OpenAI doesn't support it,
+// so it's left out when the requests are validated against the OpenAI
+// schema.
+func withTopK(topK int) func(d client.D) {
+	return func(d client.D) {
+		if strictSchema != client.SchemaOpenAI {
+			client.WithTopK(topK)(d)
+		}
+	}
+}
+
+// =============================================================================
+
+func (a *Agent) cmdSet(ctx context.Context, args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "reset":
+		a.SetSampling(Sampling{})
+
+	case len(args) > 0:
+		s, err := parseSampling(args)
+		if err != nil {
+			a.renderer.Error(fmt.Errorf("set: %w", err))
+			return
+		}
+		a.SetSampling(s)
+	}
+
+	temperature, topP, topK := a.currentSampling()
+
+	source := "the " + a.persona.Name + " persona"
+	if !a.sampling.isZero() {
+		source = "overridden for the session"
+	}
+
+	seed := "none"
+	if s := a.currentSeed(); s != nil {
+		seed = strconv.Itoa(*s)
+	}
+
+	a.renderer.Info(fmt.Sprintf("sampling: temperature[%.2g] top_p[%.2g] top_k[%d] seed[%s] %s", temperature, topP, topK, seed, source))
+}
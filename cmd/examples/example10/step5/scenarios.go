@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Limits applied to a scenario when it doesn't set its own.
+const (
+	scenarioTimeout   = 10 * time.Minute
+	verifyTimeout     = 5 * time.Minute
+	verifyMaxOutput   = 4 * 1024
+	scenarioVerifyDir = "verify"
+)
+
+// Scenario represents a coding task the agent is benchmarked on, in the
+// style of SWE-bench. The agent works on a copy of the repo snapshot, then
+// the verify files are copied into the verify directory of the workspace,
+// so the agent never sees them, and the verify command decides if the task
+// was solved by exiting with zero. Paths are relative to the scenario file.
+type Scenario struct {
+	ID          string `json:"id"`
+	Repo        string `json:"repo"`
+	Task        string `json:"task"`
+	VerifyFiles string `json:"verify_files,omitempty"`
+	Verify      string `json:"verify"`
+	Timeout     string `json:"timeout,omitempty"`
+}
+
+// ScenarioResult represents how the agent did on a scenario.
+type ScenarioResult struct {
+	ID           string `json:"id"`
+	Passed       bool   `json:"passed"`
+	DurationMS   int64  `json:"duration_ms"`
+	ModelCalls   int    `json:"model_calls"`
+	ToolCalls    int    `json:"tool_calls"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+	Limit        string `json:"limit,omitempty"`
+	Error        string `json:"error,omitempty"`
+	VerifyOutput string `json:"verify_output,omitempty"`
+	Workspace    string `json:"workspace,omitempty"`
+}
+
+// ScenarioReport represents the results of a run over a set of scenarios.
+type ScenarioReport struct {
+	Model    string           `json:"model"`
+	Passed   int              `json:"passed"`
+	Total    int              `json:"total"`
+	PassRate float64          `json:"pass_rate"`
+	Results  []ScenarioResult `json:"results"`
+}
+
+// loadScenarios reads the scenarios from a JSON Lines file.
+func loadScenarios(path string) ([]Scenario, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The agent changes directory, the paths must not depend on it.
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var scenarios []Scenario
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var s Scenario
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+
+		if s.ID == "" || s.Repo == "" || s.Task == "" || s.Verify == "" {
+			return nil, fmt.Errorf("%s:%d: id, repo, task and verify are required", path, line)
+		}
+
+		if s.Timeout != "" {
+			if _, err := time.ParseDuration(s.Timeout); err != nil {
+				return nil, fmt.Errorf("%s:%d: timeout: %w", path, line, err)
+			}
+		}
+
+		s.Repo = filepath.Join(dir, s.Repo)
+		if s.VerifyFiles != "" {
+			s.VerifyFiles = filepath.Join(dir, s.VerifyFiles)
+		}
+
+		scenarios = append(scenarios, s)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(scenarios) == 0 {
+		return nil, fmt.Errorf("%s: no scenarios", path)
+	}
+
+	return scenarios, nil
+}
+
+// runScenarios lets the agent attempt every scenario in the file, one at a
+// time since the agent works in the current directory, and reports the pass
+// rate. The workspaces of the failed scenarios are kept to look at what the
+// agent did.
+func runScenarios(ctx context.Context, path string, output string) error {
+	if output != outputPlain && output != outputJSON {
+		return fmt.Errorf("scenarios support the plain and json outputs, not %q", output)
+	}
+
+	scenarios, err := loadScenarios(path)
+	if err != nil {
+		return fmt.Errorf("load scenarios: %w", err)
+	}
+
+	report := ScenarioReport{
+		Model: model,
+		Total: len(scenarios),
+	}
+
+	for i, s := range scenarios {
+		fmt.Fprintf(os.Stderr, "scenario %d/%d: %s\n", i+1, len(scenarios), s.ID)
+
+		result := runScenario(ctx, s)
+		if result.Passed {
+			report.Passed++
+		}
+		report.Results = append(report.Results, result)
+
+		if output == outputPlain {
+			printScenarioResult(os.Stdout, result)
+		}
+	}
+
+	report.PassRate = float64(report.Passed) / float64(report.Total)
+
+	if output == outputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Printf("\n%s passed %d of %d scenarios (%.0f%%)\n", model, report.Passed, report.Total, 100*report.PassRate)
+
+	return nil
+}
+
+// runScenario runs a single scenario in a fresh copy of its repo snapshot.
+func runScenario(ctx context.Context, s Scenario) (result ScenarioResult) {
+	result.ID = s.ID
+
+	start := time.Now()
+	defer func() {
+		result.DurationMS = time.Since(start).Milliseconds()
+	}()
+
+	workspace, err := os.MkdirTemp("", "scenario-"+s.ID+"-")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Only the workspaces of the scenarios that failed are kept.
+	defer func() {
+		if result.Passed {
+			os.RemoveAll(workspace)
+			return
+		}
+		result.Workspace = workspace
+	}()
+
+	if err := os.CopyFS(workspace, os.DirFS(s.Repo)); err != nil {
+		result.Error = fmt.Sprintf("copy repo: %s", err)
+		return result
+	}
+
+	// -------------------------------------------------------------------------
+	// Let the agent attempt the task.
+
+	turn, err := attemptScenario(ctx, s, workspace)
+	result.ModelCalls = turn.Usage.ModelCalls
+	result.ToolCalls = len(turn.ToolCalls)
+	result.InputTokens = turn.Usage.InputTokens
+	result.OutputTokens = turn.Usage.OutputTokens
+	result.Limit = turn.Limit
+
+	// A turn that failed can still have solved the task, the verifier runs
+	// either way.
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	// -------------------------------------------------------------------------
+	// Check the work.
+
+	if s.VerifyFiles != "" {
+		dst := filepath.Join(workspace, scenarioVerifyDir)
+		if err := os.RemoveAll(dst); err != nil {
+			result.Error = fmt.Sprintf("remove verify directory: %s", err)
+			return result
+		}
+
+		if err := os.CopyFS(dst, os.DirFS(s.VerifyFiles)); err != nil {
+			result.Error = fmt.Sprintf("copy verify files: %s", err)
+			return result
+		}
+	}
+
+	result.Passed, result.VerifyOutput = verifyScenario(ctx, s, workspace)
+
+	return result
+}
+
+// attemptScenario has a new agent attempt the task from the workspace. Calls
+// that need approval are refused since there is nobody to ask.
+func attemptScenario(ctx context.Context, s Scenario, workspace string) (TurnResult, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return TurnResult{}, err
+	}
+
+	if err := os.Chdir(workspace); err != nil {
+		return TurnResult{}, err
+	}
+	defer os.Chdir(wd)
+
+	timeout := scenarioTimeout
+	if s.Timeout != "" {
+		timeout, _ = time.ParseDuration(s.Timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: os.Stderr}))
+	if err != nil {
+		return TurnResult{}, fmt.Errorf("failed to create agent: %w", err)
+	}
+	defer agent.Close()
+
+	err = agent.Turn(ctx, s.Task)
+
+	return agent.LastTurn(), err
+}
+
+// verifyScenario runs the verify command in the workspace. It returns the
+// end of the output, which is where test failures are reported.
+func verifyScenario(ctx context.Context, s Scenario, workspace string) (bool, string) {
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.Verify)
+	cmd.Dir = workspace
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+
+	b := out.Bytes()
+	if len(b) > verifyMaxOutput {
+		b = b[len(b)-verifyMaxOutput:]
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return false, fmt.Sprintf("run %q: %s\n%s", s.Verify, err, b)
+	}
+
+	return err == nil, string(b)
+}
+
+// printScenarioResult writes a line for the result, with the end of the
+// verify output when the scenario failed.
+func printScenarioResult(w io.Writer, r ScenarioResult) {
+	status := "PASS"
+	if !r.Passed {
+		status = "FAIL"
+	}
+
+	fmt.Fprintf(w, "%s %-24s %6.1fs calls[%d] tools[%d] tokens[%d/%d]\n", status, r.ID, float64(r.DurationMS)/1000, r.ModelCalls, r.ToolCalls, r.InputTokens, r.OutputTokens)
+
+	if r.Passed {
+		return
+	}
+
+	if r.Limit != "" {
+		fmt.Fprintf(w, "     limit: %s\n", r.Limit)
+	}
+
+	if r.Error != "" {
+		fmt.Fprintf(w, "     error: %s\n", r.Error)
+	}
+
+	for line := range strings.Lines(strings.TrimSpace(r.VerifyOutput)) {
+		fmt.Fprintf(w, "     | %s\n", strings.TrimRight(line, "\n"))
+	}
+
+	fmt.Fprintf(w, "     workspace: %s\n", r.Workspace)
+}
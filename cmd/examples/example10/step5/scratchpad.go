@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The total size of the notes the model can keep in the scratchpad. Notes are
+// meant to hold intermediate results, not to store files.
+const scratchpadMaxBytes = 64 * 1024
+
+// =============================================================================
+// Scratchpad Tool
+
+// Scratchpad represents a tool that can be used by the model to keep named
+// notes outside of the conversation. Long intermediate results can be stashed
+// and read back when needed instead of taking up the context window.
+type Scratchpad struct {
+	name  string
+	mu    sync.Mutex
+	notes map[string]string
+}
+
+// RegisterScratchpad creates a new instance of the Scratchpad tool and loads
+// it into the provided tools map.
+func RegisterScratchpad(tools map[string]Tool) client.D {
+	sp := Scratchpad{
+		name:  "tool_scratchpad",
+		notes: make(map[string]string),
+	}
+	tools[sp.name] = &sp
+
+	return sp.toolDocument()
+}
+
+// scratchpadParams represents the parameters for the Scratchpad tool.
+type scratchpadParams struct {
+	Action  string `json:"action" description:"write to replace a note, append to add to the end of a note, read to get a note back, list to list the notes." enum:"write,append,read,list"`
+	Note    string `json:"note,omitempty" description:"The name of the note for write, append and read."`
+	Content string `json:"content,omitempty" description:"The text to write or append."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (sp *Scratchpad) toolDocument() client.D {
+	description := fmt.Sprintf("Keep named notes outside of the conversation. Use it to stash long intermediate results, like a list of findings, and read them back when needed. The notes can hold %d bytes in total.", scratchpadMaxBytes)
+
+	return client.ToolDocument(sp.name, description, scratchpadParams{})
+}
+
+// Call is the function that is called by the agent to work with the notes
+// when the model requests the tool with the specified parameters.
+func (sp *Scratchpad) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, sp.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params scratchpadParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, sp.name, err)
+	}
+
+	if params.Action != "list" && params.Note == "" {
+		return toolErrorResponse(toolCall.ID, sp.name, fmt.Errorf("note is required for %s", params.Action))
+	}
+
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	switch params.Action {
+	case "write", "append":
+		content := params.Content
+		if params.Action == "append" {
+			content = sp.notes[params.Note] + content
+		}
+
+		if size := sp.size() - len(sp.notes[params.Note]) + len(content); size > scratchpadMaxBytes {
+			return toolErrorResponse(toolCall.ID, sp.name, fmt.Errorf("the scratchpad would hold %d bytes which exceeds the %d byte limit, rewrite or shorten a note", size, scratchpadMaxBytes))
+		}
+
+		sp.notes[params.Note] = content
+
+		return toolSuccessResponse(toolCall.ID, sp.name, ToolData{"note": params.Note, "bytes": len(content), "free": scratchpadMaxBytes - sp.size()})
+
+	case "read":
+		content, exists := sp.notes[params.Note]
+		if !exists {
+			return toolErrorResponse(toolCall.ID, sp.name, fmt.Errorf("note %q doesn't exist, the notes are: %v", params.Note, slices.Sorted(maps.Keys(sp.notes))))
+		}
+
+		return toolSuccessResponse(toolCall.ID, sp.name, ToolData{"note": params.Note, "content": content})
+
+	case "list":
+		notes := make([]map[string]any, 0, len(sp.notes))
+		for _, name := range slices.Sorted(maps.Keys(sp.notes)) {
+			notes = append(notes, map[string]any{"note": name, "bytes": len(sp.notes[name])})
+		}
+
+		return toolSuccessResponse(toolCall.ID, sp.name, ToolData{"notes": notes, "free": scratchpadMaxBytes - sp.size()})
+	}
+
+	return toolErrorResponse(toolCall.ID, sp.name, fmt.Errorf("unsupported action %q, use write, append, read or list", params.Action))
+}
+
+// size returns the total size of the notes. The caller must hold the lock.
+func (sp *Scratchpad) size() int {
+	var n int
+	for _, content := range sp.notes {
+		n += len(content)
+	}
+
+	return n
+}
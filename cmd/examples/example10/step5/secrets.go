@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The values of the .env files in the workspace are masked in tool results
+// and in the answers of the model, so a secret the model read doesn't end up
+// on a projector or in a saved session. This can be turned off with the
+// AGENT_SECRET_GUARD environment variable.
+var secretGuard = true
+
+func init() {
+	if v := os.Getenv("AGENT_SECRET_GUARD"); v != "" {
+		var err error
+		secretGuard, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Values shorter than this, like ports and flags, are too common to be
+// secrets and masking them would garble the answers.
+const secretMinLength = 8
+
+// secretSet represents the secrets loaded from the workspace and masks them
+// in text. A nil secretSet masks nothing.
+type secretSet struct {
+	values    []string
+	replacer  *strings.Replacer
+	restorer  *strings.Replacer
+	ambiguous []string
+}
+
+// loadSecrets reads the values of the .env files in the root of the
+// workspace, like .env and .env.local. It returns nil when there are none.
+func loadSecrets(root string) (*secretSet, error) {
+	files, err := filepath.Glob(filepath.Join(root, ".env*"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string)
+	for _, file := range files {
+
+		// Examples hold placeholders, not secrets.
+		switch filepath.Ext(file) {
+		case ".example", ".sample", ".template":
+			continue
+		}
+
+		if err := readEnvFile(file, names); err != nil {
+			return nil, fmt.Errorf("read %s: %w", file, err)
+		}
+	}
+
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	ss := secretSet{}
+	for value := range names {
+		ss.values = append(ss.values, value)
+	}
+
+	// The replacer tries the values in order, so a secret that contains
+	// another one is masked as a whole.
+	slices.SortFunc(ss.values, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+
+	var oldnew []string
+	byName := make(map[string][]string)
+	for _, value := range ss.values {
+		oldnew = append(oldnew, value, secretPlaceholder(names[value]))
+		byName[names[value]] = append(byName[names[value]], value)
+	}
+	ss.replacer = strings.NewReplacer(oldnew...)
+
+	// A variable set to different values in two files, like .env and
+	// .env.local, has a placeholder that can't be restored.
+	var restore []string
+	for name, values := range byName {
+		if len(values) > 1 {
+			ss.ambiguous = append(ss.ambiguous, secretPlaceholder(name))
+			continue
+		}
+		restore = append(restore, secretPlaceholder(name), values[0])
+	}
+	ss.restorer = strings.NewReplacer(restore...)
+
+	return &ss, nil
+}
+
+// secretPlaceholder returns the text a secret of the variable is masked
+// with.
+func secretPlaceholder(name string) string {
+	return "[REDACTED:" + name + "]"
+}
+
+// readEnvFile adds the values of the file that are long enough to be
+// secrets, keyed by value with the name of the variable.
+func readEnvFile(file string, names map[string]string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		line = strings.TrimPrefix(line, "export ")
+
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+
+		if len(value) >= secretMinLength {
+			names[value] = strings.TrimSpace(name)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// mask replaces the secrets in the text.
+func (ss *secretSet) mask(text string) string {
+	if ss == nil {
+		return text
+	}
+
+	return ss.replacer.Replace(text)
+}
+
+// maskResult replaces the secrets in the content of a tool result.
+func (ss *secretSet) maskResult(resp client.D) {
+	if content, ok := resp["content"].(string); ok {
+		resp["content"] = ss.mask(content)
+	}
+}
+
+// restoreArguments returns the tool call with the placeholders in its
+// arguments replaced by the secrets, for the tools that write files. The
+// model rewrites a file it read with the placeholders in it, writing them
+// would lose the secrets. A placeholder that stands for more than one value
+// is refused.
+func (ss *secretSet) restoreArguments(toolCall client.ToolCall) (client.ToolCall, error) {
+	if ss == nil {
+		return toolCall, nil
+	}
+
+	var err error
+
+	var restore func(v any) any
+	restore = func(v any) any {
+		switch v := v.(type) {
+		case string:
+			for _, placeholder := range ss.ambiguous {
+				if strings.Contains(v, placeholder) {
+					err = fmt.Errorf("%s stands for different values in the .env files, it can't be written back", placeholder)
+				}
+			}
+			return ss.restorer.Replace(v)
+
+		case map[string]any:
+			m := make(map[string]any, len(v))
+			for key, value := range v {
+				m[key] = restore(value)
+			}
+			return m
+
+		case []any:
+			s := make([]any, len(v))
+			for i, value := range v {
+				s[i] = restore(value)
+			}
+			return s
+		}
+
+		return v
+	}
+
+	arguments, _ := restore(toolCall.Function.Arguments).(map[string]any)
+	if err != nil {
+		return client.ToolCall{}, err
+	}
+
+	toolCall.Function.Arguments = arguments
+
+	return toolCall, nil
+}
+
+// held returns the length of the longest end of the text that could be the
+// start of a secret, that part can't be shown until more text arrives.
+func (ss *secretSet) held(text string) int {
+	if ss == nil {
+		return 0
+	}
+
+	var held int
+	for _, value := range ss.values {
+		for n := min(len(value)-1, len(text)); n > held; n-- {
+			if strings.HasSuffix(text, value[:n]) {
+				held = n
+				break
+			}
+		}
+	}
+
+	return held
+}
+
+// =============================================================================
+
+// secretStream masks the secrets in text that is streamed in chunks, where
+// a secret can be split between two chunks.
+type secretStream struct {
+	secrets *secretSet
+	pending string
+}
+
+// write returns the part of the chunk that is safe to show.
+func (st *secretStream) write(chunk string) string {
+	if st.secrets == nil {
+		return chunk
+	}
+
+	text := st.secrets.mask(st.pending + chunk)
+
+	held := st.secrets.held(text)
+	st.pending = text[len(text)-held:]
+
+	return text[:len(text)-held]
+}
+
+// flush returns the text held back once the stream is done.
+func (st *secretStream) flush() string {
+	text := st.pending
+	st.pending = ""
+
+	return text
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestSecretsRestoredOnWrite(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	const secret = "supersecretvalue"
+
+	if err := os.WriteFile(".env", []byte("API_KEY="+secret+"\n"), 0600); err != nil {
+		t.Fatalf("write .env: %s", err)
+	}
+	if err := os.WriteFile("config.txt", []byte("key: "+secret+"\nname: demo\n"), 0644); err != nil {
+		t.Fatalf("write config.txt: %s", err)
+	}
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	read := client.ToolCall{
+		ID: "call-1",
+		Function: client.Function{
+			Name:      "tool_read_file",
+			Arguments: map[string]any{"path": "config.txt"},
+		},
+	}
+
+	resps := agent.callTools(context.Background(), []client.ToolCall{read})
+	if content, _ := resps[0]["content"].(string); strings.Contains(content, secret) || !strings.Contains(content, "[REDACTED:API_KEY]") {
+		t.Fatalf("the secret wasn't masked: %s", content)
+	}
+
+	// The model rewrites the line it read, placeholder included.
+	edit := client.ToolCall{
+		ID: "call-2",
+		Function: client.Function{
+			Name: "tool_code_editor",
+			Arguments: map[string]any{
+				"path":        "config.txt",
+				"line_number": 1,
+				"type_change": "replace",
+				"line_change": "key: [REDACTED:API_KEY] # rotated monthly",
+			},
+		},
+	}
+
+	resps = agent.callTools(context.Background(), []client.ToolCall{edit})
+	if content, _ := resps[0]["content"].(string); strings.Contains(content, secret) {
+		t.Errorf("the secret is in the result of the edit: %s", content)
+	}
+
+	b, err := os.ReadFile("config.txt")
+	if err != nil {
+		t.Fatalf("read config.txt: %s", err)
+	}
+
+	if want := "key: " + secret + " # rotated monthly\nname: demo\n"; string(b) != want {
+		t.Errorf("got config.txt:\n%s\nwant:\n%s", b, want)
+	}
+
+	// The arguments the model sent are left masked.
+	if got := edit.Function.Arguments["line_change"]; got != "key: [REDACTED:API_KEY] # rotated monthly" {
+		t.Errorf("the arguments of the call were changed: %v", got)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The time the requests that check the status of the server get.
+const serverStatusTimeout = 5 * time.Second
+
+// loadedModel represents a model loaded in the memory of the inference
+// server.
+type loadedModel struct {
+	Name          string    `json:"name"`
+	Parameters    string    `json:"parameters,omitempty"`
+	Quantization  string    `json:"quantization,omitempty"`
+	ContextLength int       `json:"context_length,omitempty"`
+	SizeMB        int64     `json:"size_mb,omitempty"`
+	VRAMMB        int64     `json:"vram_mb,omitempty"`
+	GPUPercent    int       `json:"gpu_percent"` // -1 when the server doesn't report it.
+	Unloads       time.Time `json:"unloads,omitzero"`
+}
+
+// gpuStatus represents a GPU of the host as reported by nvidia-smi.
+type gpuStatus struct {
+	Name           string `json:"name"`
+	UtilizationPct int    `json:"utilization_percent"`
+	MemoryUsedMB   int    `json:"memory_used_mb"`
+	MemoryTotalMB  int    `json:"memory_total_mb"`
+}
+
+// serverStatus represents what the inference server is doing and the
+// resources of the host.
+type serverStatus struct {
+	Server      string        `json:"server"`
+	URL         string        `json:"url"`
+	Models      []loadedModel `json:"models"`
+	Processing  *int          `json:"requests_processing,omitempty"`
+	Queued      *int          `json:"requests_queued,omitempty"`
+	GPUs        []gpuStatus   `json:"gpus,omitempty"`
+	CPUs        int           `json:"cpus"`
+	LoadAverage string        `json:"load_average,omitempty"`
+	Notes       []string      `json:"notes,omitempty"`
+}
+
+// collectServerStatus asks the inference server which models are loaded and
+// how busy it is. Ollama reports the loaded models on /api/ps, llama.cpp
+// reports its queue on /metrics when it runs with --metrics. The GPUs and the
+// load are those of the host the agent runs on, which is the server's host
+// in the workshop setup.
+func collectServerStatus(ctx context.Context) serverStatus {
+	ctx, cancel := context.WithTimeout(ctx, serverStatusTimeout)
+	defer cancel()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, httpOptions...)
+
+	base := serverBaseURL(url)
+
+	st := serverStatus{
+		Server: "unknown",
+		URL:    base,
+		CPUs:   runtime.NumCPU(),
+	}
+
+	// -------------------------------------------------------------------------
+	// Ask the server, Ollama first since it's the default.
+
+	var ps struct {
+		Models []struct {
+			Name          string    `json:"name"`
+			Size          int64     `json:"size"`
+			SizeVRAM      int64     `json:"size_vram"`
+			ExpiresAt     time.Time `json:"expires_at"`
+			ContextLength int       `json:"context_length"`
+			Details       struct {
+				ParameterSize     string `json:"parameter_size"`
+				QuantizationLevel string `json:"quantization_level"`
+			} `json:"details"`
+		} `json:"models"`
+	}
+
+	switch err := cln.Do(ctx, http.MethodGet, base+"/api/ps", nil, &ps); {
+	case err == nil:
+		st.Server = "ollama"
+
+		for _, m := range ps.Models {
+			lm := loadedModel{
+				Name:          m.Name,
+				Parameters:    m.Details.ParameterSize,
+				Quantization:  m.Details.QuantizationLevel,
+				ContextLength: m.ContextLength,
+				SizeMB:        m.Size >> 20,
+				VRAMMB:        m.SizeVRAM >> 20,
+				Unloads:       m.ExpiresAt,
+			}
+			if m.Size > 0 {
+				lm.GPUPercent = int(100 * m.SizeVRAM / m.Size)
+			}
+			st.Models = append(st.Models, lm)
+		}
+
+		st.Notes = append(st.Notes, "Ollama doesn't report its queue, it runs OLLAMA_NUM_PARALLEL requests per model at once and the others wait")
+
+	default:
+		var metrics string
+		if err := cln.Do(ctx, http.MethodGet, base+"/metrics", nil, &metrics); err != nil {
+			st.Notes = append(st.Notes, fmt.Sprintf("the server doesn't answer Ollama's /api/ps or llama.cpp's /metrics, start llama-server with --metrics to see its queue: %s", err))
+			break
+		}
+
+		st.Server = "llama.cpp"
+		st.Processing = promGauge(metrics, "llamacpp:requests_processing")
+		st.Queued = promGauge(metrics, "llamacpp:requests_deferred")
+
+		var models struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := cln.Do(ctx, http.MethodGet, base+"/v1/models", nil, &models); err == nil {
+			for _, m := range models.Data {
+				st.Models = append(st.Models, loadedModel{Name: m.ID, GPUPercent: -1})
+			}
+		}
+	}
+
+	if len(st.Models) == 0 && st.Server != "unknown" {
+		st.Notes = append(st.Notes, "no model is loaded, the next request waits for the model to load")
+	}
+
+	// -------------------------------------------------------------------------
+	// Look at the host.
+
+	gpus, err := nvidiaSMI(ctx)
+	switch {
+	case err == nil:
+		st.GPUs = gpus
+
+	case !os.IsNotExist(err):
+		st.Notes = append(st.Notes, fmt.Sprintf("nvidia-smi: %s", err))
+	}
+
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		st.LoadAverage = strings.Join(strings.Fields(string(data))[:3], " ")
+	}
+
+	return st
+}
+
+// serverBaseURL returns the scheme and host of the endpoint.
+func serverBaseURL(endpoint string) string {
+	scheme, rest, found := strings.Cut(endpoint, "://")
+	if !found {
+		return endpoint
+	}
+
+	host, _, _ := strings.Cut(rest, "/")
+
+	return scheme + "://" + host
+}
+
+// promGauge returns the value of the metric in the Prometheus text format.
+func promGauge(metrics string, name string) *int {
+	for line := range strings.Lines(metrics) {
+		value, found := strings.CutPrefix(line, name+" ")
+		if !found {
+			continue
+		}
+
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil
+		}
+
+		n := int(f)
+		return &n
+	}
+
+	return nil
+}
+
+// nvidiaSMI returns the GPUs of the host. It returns an error that satisfies
+// os.IsNotExist when nvidia-smi isn't installed.
+func nvidiaSMI(ctx context.Context) ([]gpuStatus, error) {
+	path, err := exec.LookPath("nvidia-smi")
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, path, "--query-gpu=name,utilization.gpu,memory.used,memory.total", "--format=csv,noheader,nounits")
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(&out)
+	r.TrimLeadingSpace = true
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var gpus []gpuStatus
+	for _, rec := range records {
+		if len(rec) != 4 {
+			continue
+		}
+
+		gpu := gpuStatus{Name: rec[0]}
+		gpu.UtilizationPct, _ = strconv.Atoi(rec[1])
+		gpu.MemoryUsedMB, _ = strconv.Atoi(rec[2])
+		gpu.MemoryTotalMB, _ = strconv.Atoi(rec[3])
+
+		gpus = append(gpus, gpu)
+	}
+
+	return gpus, nil
+}
+
+// =============================================================================
+// ServerStatus Tool
+
+// ServerStatus represents a tool the model uses to find out why generations
+// are slow, like a model that doesn't fit in VRAM or a long queue.
+type ServerStatus struct {
+	name string
+}
+
+// RegisterServerStatus creates a new instance of the ServerStatus tool and
+// loads it into the provided tools map.
+func RegisterServerStatus(tools map[string]Tool) client.D {
+	ss := ServerStatus{
+		name: "tool_server_status",
+	}
+	tools[ss.name] = &ss
+
+	return ss.toolDocument()
+}
+
+// serverStatusParams represents the parameters for the ServerStatus tool.
+type serverStatusParams struct{}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (ss *ServerStatus) toolDocument() client.D {
+	return client.ToolDocument(ss.name, "Report the status of the inference server the agent runs on: the loaded models and how much of them is in VRAM, the requests it's processing and queuing, and the GPUs and load of the host. Use it when the user asks why generations are slow.", serverStatusParams{})
+}
+
+// Call is the function that is called by the agent to check the server when
+// the model requests the tool with the specified parameters.
+func (ss *ServerStatus) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, ss.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	return toolSuccessResponse(toolCall.ID, ss.name, ToolData{"status": collectServerStatus(ctx)})
+}
+
+// =============================================================================
+
+func (a *Agent) cmdStatus(ctx context.Context, args []string) {
+	st := collectServerStatus(ctx)
+
+	a.renderer.Info(fmt.Sprintf("server: %s at %s", st.Server, st.URL))
+
+	for _, m := range st.Models {
+		line := fmt.Sprintf("model: %s", m.Name)
+		if m.Parameters != "" {
+			line += fmt.Sprintf(" %s %s", m.Parameters, m.Quantization)
+		}
+		if m.GPUPercent >= 0 {
+			line += fmt.Sprintf(" size[%dMB] vram[%dMB] gpu[%d%%]", m.SizeMB, m.VRAMMB, m.GPUPercent)
+		}
+		if m.ContextLength > 0 {
+			line += fmt.Sprintf(" context[%d]", m.ContextLength)
+		}
+		// Models kept loaded forever expire in hundreds of years.
+		if until := time.Until(m.Unloads); until > 0 && until < 24*time.Hour {
+			line += fmt.Sprintf(" unloads in %s", until.Round(time.Second))
+		}
+		a.renderer.Info(line)
+
+		if m.GPUPercent >= 0 && m.GPUPercent < 100 {
+			a.renderer.Warning(fmt.Sprintf("%s only has %d%% of its weights in VRAM, the rest runs on the CPU and is much slower", m.Name, m.GPUPercent))
+		}
+	}
+
+	if st.Processing != nil && st.Queued != nil {
+		a.renderer.Info(fmt.Sprintf("requests: processing[%d] queued[%d]", *st.Processing, *st.Queued))
+	}
+
+	if modelQueue != nil {
+		qs := modelQueue.Stats()
+		a.renderer.Info(fmt.Sprintf("agent queue: running[%d of %d] queued[%d] sessions[%d] wait avg[%s] max[%s]", qs.Running, qs.Slots, qs.Queued, qs.Sessions, qs.AvgWait.Round(time.Millisecond), qs.MaxWait.Round(time.Millisecond)))
+	}
+
+	for _, gpu := range st.GPUs {
+		a.renderer.Info(fmt.Sprintf("gpu: %s utilization[%d%%] memory[%d/%dMB]", gpu.Name, gpu.UtilizationPct, gpu.MemoryUsedMB, gpu.MemoryTotalMB))
+	}
+
+	host := fmt.Sprintf("host: cpus[%d]", st.CPUs)
+	if st.LoadAverage != "" {
+		host += fmt.Sprintf(" load[%s]", st.LoadAverage)
+	}
+	a.renderer.Info(host)
+
+	for _, note := range st.Notes {
+		a.renderer.Info("note: " + note)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Session represents a saved chat session. Sessions are saved as JSON so they
+// can be compared with tools like cmd/tools/convdiff. Besides the messages,
+// the session holds the agent state needed to resume it after a restart.
+type Session struct {
+	Model        string         `json:"model"`
+	Saved        time.Time      `json:"saved"`
+	Persona      string         `json:"persona,omitempty"`
+	Conversation []client.D     `json:"conversation"`
+	ToolEvents   []ToolEvent    `json:"tool_events"`
+	Checkpoints  [][]FileState  `json:"checkpoints,omitempty"`
+	Summary      string         `json:"summary,omitempty"`
+	Approvals    []string       `json:"approvals,omitempty"`  // Calls the user approved for the session.
+	QuotaUsed    map[string]int `json:"quota_used,omitempty"` // Calls made of the tools with a quota.
+}
+
+// WithSessionFile resumes the session saved in the specified file, if it
+// exists, and saves the session back to the file after every turn so it can
+// be resumed after a crash or restart.
+func WithSessionFile(path string) func(a *Agent) {
+	return func(a *Agent) {
+		a.sessionPath = path
+	}
+}
+
+// Save writes the conversation, tool calls and agent state of the session to
+// the specified file. The file is replaced atomically so a crash while saving
+// never leaves a corrupted session behind.
+func (a *Agent) Save(path string) error {
+	sess := Session{
+		Model:        model,
+		Saved:        time.Now().UTC(),
+		Persona:      a.persona.Name,
+		Conversation: a.conversation,
+		ToolEvents:   a.ToolEvents(),
+		Checkpoints:  a.checkpoints.State(),
+		Summary:      a.summaryText(),
+		Approvals:    slices.Sorted(maps.Keys(a.approvals)),
+		QuotaUsed:    a.quotaUsed,
+	}
+
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	return writeFileAtomic(path, data)
+}
+
+// Resume restores the agent to the state saved in the specified file.
+func (a *Agent) Resume(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+
+	var sess Session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return fmt.Errorf("unmarshal: %w", err)
+	}
+
+	if len(sess.Conversation) == 0 {
+		return fmt.Errorf("session %s has no conversation", path)
+	}
+
+	persona := a.persona
+	if sess.Persona != "" {
+		persona, err = lookupPersona(sess.Persona)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The metadata is decoded as a generic document so it needs to be
+	// converted back.
+	for _, msg := range sess.Conversation {
+		raw, exists := msg[metaKey]
+		if !exists {
+			continue
+		}
+
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("marshal meta: %w", err)
+		}
+
+		var meta MessageMeta
+		if err := json.Unmarshal(b, &meta); err != nil {
+			return fmt.Errorf("unmarshal meta: %w", err)
+		}
+		msg[metaKey] = meta
+	}
+
+	a.conversation = sess.Conversation
+	a.restoreSummary(sess.Summary)
+	a.setPersona(persona)
+	a.checkpoints.Restore(sess.Checkpoints)
+	a.quotaUsed = sess.QuotaUsed
+
+	a.approvals = make(map[string]bool, len(sess.Approvals))
+	for _, prompt := range sess.Approvals {
+		a.approvals[prompt] = true
+	}
+
+	a.mu.Lock()
+	a.toolEvents = sess.ToolEvents
+	a.mu.Unlock()
+
+	return nil
+}
+
+// autosave saves the session to the session file if one is configured.
+func (a *Agent) autosave() {
+	if a.sessionPath == "" {
+		return
+	}
+
+	if err := a.Save(a.sessionPath); err != nil {
+		a.renderer.Error(fmt.Errorf("autosave: %w", err))
+	}
+}
+
+// writeFileAtomic replaces the file with the data. The data is written to a
+// temporary file that is renamed over the file, so a crash while writing
+// never leaves a partial file behind.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("chmod: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename: %w", err)
+	}
+
+	return nil
+}
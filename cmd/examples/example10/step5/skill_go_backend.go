@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The go-backend skill pack teaches the agent the conventions of Go backend
+// services and lets it run the tests and vet of the module to check its work.
+// The test output is long, so it's summarized in a sub-conversation by
+// default.
+var _ = RegisterSkillPack(SkillPack{
+	Name:        "go-backend",
+	Description: "Go backend development with the tests and vet of the module",
+	Prompt: `You are also an experienced Go backend developer. Follow the
+conventions of the code you are working in. Handle every error, wrap it with
+context using fmt.Errorf and %w, and pass a context.Context as the first
+parameter of functions that do I/O. Keep handlers thin and put the business
+logic in packages that don't know about HTTP. After you change Go code, call
+tool_go_test to run vet and the tests of the packages you changed and fix what
+fails before you answer.`,
+	Tools: func(tools map[string]Tool, a *Agent) []client.D {
+		return []client.D{RegisterGoTest(tools)}
+	},
+	Persona:         "coder",
+	SubcontextTools: []string{"tool_go_test"},
+})
+
+// The time the tests of the packages get to run.
+const goTestTimeout = 5 * time.Minute
+
+// =============================================================================
+// GoTest Tool
+
+// GoTest represents a tool that can be used to run go vet and go test on
+// packages of the module in the workspace.
+type GoTest struct {
+	name string
+}
+
+// RegisterGoTest creates a new instance of the GoTest tool and loads it into
+// the provided tools map.
+func RegisterGoTest(tools map[string]Tool) client.D {
+	gt := GoTest{
+		name: "tool_go_test",
+	}
+	tools[gt.name] = &gt
+
+	return gt.toolDocument()
+}
+
+// goTestParams represents the parameters for the GoTest tool.
+type goTestParams struct {
+	Action   string   `json:"action" description:"test to run go test, vet to run go vet." enum:"test,vet"`
+	Packages []string `json:"packages,omitempty" description:"The packages to check, like ./foundation/vector or ./..., all packages by default."`
+	Run      string   `json:"run,omitempty" description:"A regular expression selecting the tests to run, like TestSearch."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (gt *GoTest) toolDocument() client.D {
+	return client.ToolDocument(gt.name, "Run go vet or go test on packages of the Go module in the workspace. Failing tests and vet findings are reported with their output, fix them and call the tool again.", goTestParams{})
+}
+
+// command returns the arguments of the go command for the call.
+func (gt *GoTest) command(toolCall client.ToolCall) ([]string, error) {
+	var params goTestParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	if params.Action != "test" && params.Action != "vet" {
+		return nil, fmt.Errorf("unsupported action %q, use test or vet", params.Action)
+	}
+
+	packages := params.Packages
+	if len(packages) == 0 {
+		packages = []string{"./..."}
+	}
+
+	// Don't let the model sneak flags into the command.
+	for _, p := range packages {
+		if p == "" || strings.HasPrefix(p, "-") || strings.ContainsAny(p, " \t\n") {
+			return nil, fmt.Errorf("invalid package %q", p)
+		}
+	}
+
+	args := []string{params.Action}
+	if params.Action == "test" && params.Run != "" {
+		args = append(args, "-run", params.Run)
+	}
+
+	return append(args, packages...), nil
+}
+
+// confirmation asks the user before the tests run, they run code of the
+// module that can do anything. go vet only reads the code.
+func (gt *GoTest) confirmation(toolCall client.ToolCall) (string, bool) {
+	args, err := gt.command(toolCall)
+	if err != nil || args[0] != "test" {
+		return "", false
+	}
+
+	return "run go " + strings.Join(args, " "), true
+}
+
+// mutation describes the tests that would have run, they can change files or
+// reach the network.
+func (gt *GoTest) mutation(toolCall client.ToolCall) (string, bool) {
+	cmd, ok := gt.confirmation(toolCall)
+	if !ok {
+		return "", false
+	}
+
+	return "would have " + cmd, true
+}
+
+// commandLine returns the go command the call runs.
+func (gt *GoTest) commandLine(toolCall client.ToolCall) (string, bool) {
+	args, err := gt.command(toolCall)
+	if err != nil {
+		return "", false
+	}
+
+	return "go " + strings.Join(args, " "), true
+}
+
+// Call is the function that is called by the agent to run the checks when
+// the model requests the tool with the specified parameters.
+func (gt *GoTest) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, gt.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	args, err := gt.command(toolCall)
+	if err != nil {
+		return toolErrorResponse(toolCall.ID, gt.name, err)
+	}
+
+	// The packages follow the action and the -run flag.
+	packages := args[1:]
+	if len(packages) > 1 && packages[0] == "-run" {
+		packages = packages[2:]
+	}
+
+	if err := checkPackages(ctx, packages); err != nil {
+		return toolErrorResponse(toolCall.ID, gt.name, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, goTestTimeout)
+	defer cancel()
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Dir = workspaceDir(ctx)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	// Failing checks are what the model asked about, only a command that
+	// couldn't run is an error.
+	passed := true
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || ctx.Err() != nil {
+			return toolErrorResponse(toolCall.ID, gt.name, fmt.Errorf("go %s: %w", strings.Join(args, " "), err))
+		}
+		passed = false
+	}
+
+	b := out.Bytes()
+	if len(b) > goModMaxOutput {
+		b = append(b[:goModMaxOutput:goModMaxOutput], "\n... output truncated"...)
+	}
+
+	return toolSuccessResponse(toolCall.ID, gt.name, ToolData{"command": "go " + strings.Join(args, " "), "passed": passed, "output": string(b)})
+}
@@ -0,0 +1,16 @@
+package main
+
+// The sql-analyst skill pack teaches the agent how to work with a database it
+// doesn't know yet. It uses the database tool that is registered when
+// AGENT_DATABASE_URL is set, so it has no tools of its own.
+var _ = RegisterSkillPack(SkillPack{
+	Name:        "sql-analyst",
+	Description: "Data analysis with careful, explained SQL queries",
+	Prompt: `You are also a careful data analyst. Before you query a table,
+look up its columns and a few rows so you don't guess names. Select only the
+columns you need, always add a LIMIT while exploring, and never run statements
+that change data. When you answer, show the query you ran, explain what the
+result means in plain words, and call out assumptions like how NULLs and
+duplicates were treated.`,
+	Persona: "sql",
+})
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// SkillPack represents a skill the agent can be taught, like Go backend
+// development. It bundles a fragment of the system prompt, the tools the
+// skill needs and the settings the skill works best with, so a course module
+// can ship a skill in a single file. The packs listed in the AGENT_SKILLS
+// environment variable are loaded when the agent starts.
+type SkillPack struct {
+	Name        string
+	Description string
+	Prompt      string                                           // Added to the system prompt of every persona.
+	Tools       func(tools map[string]Tool, a *Agent) []client.D // Registers the tools of the skill, can be nil.
+
+	// The settings are used by NewAgent unless the environment sets them,
+	// the first loaded pack with a setting wins.
+	Persona         string   // The persona the agent starts with, unless AGENT_PERSONA is set.
+	SubcontextTools []string // Tools with summarized results, unless AGENT_SUBCONTEXT_TOOLS is set.
+}
+
+// skillPacks is the catalog of registered packs keyed by name.
+var skillPacks = map[string]SkillPack{}
+
+// RegisterSkillPack adds the pack to the catalog. Packs are registered when
+// the package variables are initialized:
+//
+//	var _ = RegisterSkillPack(SkillPack{Name: "my-skill", ...})
+func RegisterSkillPack(p SkillPack) bool {
+	if _, exists := skillPacks[p.Name]; exists {
+		panic(fmt.Sprintf("skill pack %q registered twice", p.Name))
+	}
+	skillPacks[p.Name] = p
+
+	return true
+}
+
+// skillNames returns the names of the packs to load from the AGENT_SKILLS
+// environment variable.
+func skillNames() []string {
+	var names []string
+	for name := range strings.SplitSeq(os.Getenv("AGENT_SKILLS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// lookupSkillPack returns the pack with the specified name.
+func lookupSkillPack(name string) (SkillPack, error) {
+	p, exists := skillPacks[name]
+	if !exists {
+		var names []string
+		for name := range skillPacks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		return SkillPack{}, fmt.Errorf("unknown skill pack %q, choose from %v", name, names)
+	}
+
+	return p, nil
+}
+
+// =============================================================================
+
+// loadSkills registers the tools of the packs with the agent and adds their
+// prompts to the system prompt. The tools of a pack are available to every
+// persona since the skill is useless without them.
+func (a *Agent) loadSkills(names []string) error {
+	for _, name := range names {
+		p, err := lookupSkillPack(name)
+		if err != nil {
+			return err
+		}
+
+		if slices.ContainsFunc(a.skills, func(s SkillPack) bool { return s.Name == name }) {
+			continue
+		}
+
+		if p.Tools != nil {
+			for _, doc := range p.Tools(a.tools, a) {
+				fn, _ := doc["function"].(client.D)
+				toolName, _ := fn["name"].(string)
+
+				if a.skillTools == nil {
+					a.skillTools = make(map[string]bool)
+				}
+				a.skillTools[toolName] = true
+
+				a.toolDocuments = append(a.toolDocuments, doc)
+			}
+		}
+
+		// The pack picks the tools that are summarized unless the
+		// environment did.
+		if len(subcontextTools) == 0 {
+			for _, name := range p.SubcontextTools {
+				a.routedTools[name] = true
+			}
+		}
+
+		a.skills = append(a.skills, p)
+	}
+
+	a.refreshSystemPrompt()
+
+	return nil
+}
+
+// skillsPersona returns the persona of the first loaded pack that has one.
+func (a *Agent) skillsPersona() string {
+	for _, p := range a.skills {
+		if p.Persona != "" {
+			return p.Persona
+		}
+	}
+
+	return ""
+}
+
+// skillsPrompt returns the prompts of the loaded packs for the system prompt.
+func (a *Agent) skillsPrompt() string {
+	var b strings.Builder
+	for _, p := range a.skills {
+		if p.Prompt != "" {
+			fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(p.Prompt))
+		}
+	}
+
+	return b.String()
+}
+
+// allowsTool reports whether the model can use the specified tool with the
+// current persona and the loaded skill packs.
+func (a *Agent) allowsTool(name string) bool {
+	return a.persona.allowsTool(name) || a.skillTools[name]
+}
+
+// =============================================================================
+
+func (a *Agent) cmdSkills(ctx context.Context, args []string) {
+	if len(skillPacks) == 0 {
+		a.renderer.Info("no skill packs are registered")
+		return
+	}
+
+	var names []string
+	for name := range skillPacks {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		marker := " "
+		if slices.ContainsFunc(a.skills, func(s SkillPack) bool { return s.Name == name }) {
+			marker = "*"
+		}
+		a.renderer.Info(fmt.Sprintf("%s %-12s %s", marker, name, skillPacks[name].Description))
+	}
+
+	if len(a.skills) == 0 {
+		a.renderer.Info("no skill packs loaded, set AGENT_SKILLS to a comma separated list of names to load them")
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Large results of some tools, like search results and logs, fill the
+// context window with text the model only needs a few lines of. The results
+// of the tools listed in the AGENT_SUBCONTEXT_TOOLS environment variable that
+// are larger than AGENT_SUBCONTEXT_TOKENS are given to a summarizer in a
+// sub-conversation of their own, and only the summary enters the
+// conversation. The model can read the raw result or ask the summarizer
+// about it with the tool_raw_result tool. The summarizer is the agent's model
+// unless AGENT_SUBCONTEXT_MODEL names a smaller one.
+var (
+	subcontextTools  = map[string]bool{}
+	subcontextTokens = 1000
+	subcontextModel  = model
+)
+
+// The number of raw results kept for the model to read, older ones are
+// dropped.
+const subcontextMaxResults = 20
+
+func init() {
+	if v := os.Getenv("AGENT_SUBCONTEXT_TOOLS"); v != "" {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				subcontextTools[name] = true
+			}
+		}
+	}
+
+	if v := os.Getenv("AGENT_SUBCONTEXT_TOKENS"); v != "" {
+		var err error
+		subcontextTokens, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_SUBCONTEXT_MODEL"); v != "" {
+		subcontextModel = v
+	}
+}
+
+// subcontextPrompt is the system prompt of the summarizer.
+const subcontextPrompt = `You read the output of a tool call for a coding agent and report what the agent needs from it.
+
+The agent is working on this request from the user:
+%s
+
+The agent called %s with these arguments:
+%s
+
+Summarize the output for the agent. Keep the facts, names, paths, line numbers, errors and numbers that matter for the request and leave out the rest. When you are asked questions about the output later, answer them from the output only. Answer with the summary only.`
+
+// subConversation represents the scoped conversation about the result of a
+// single tool call.
+type subConversation struct {
+	id       string
+	tool     string
+	raw      string
+	messages []client.D
+	mu       sync.Mutex
+}
+
+// subResults holds the sub-conversations of the session.
+type subResults struct {
+	mu    sync.Mutex
+	next  int
+	order []string
+	byID  map[string]*subConversation
+}
+
+// add stores the sub-conversation and returns its id. The oldest
+// sub-conversation is dropped when there are too many.
+func (sr *subResults) add(sc *subConversation) string {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.byID == nil {
+		sr.byID = make(map[string]*subConversation)
+	}
+
+	sr.next++
+	sc.id = fmt.Sprintf("result-%d", sr.next)
+
+	sr.byID[sc.id] = sc
+	sr.order = append(sr.order, sc.id)
+
+	if len(sr.order) > subcontextMaxResults {
+		delete(sr.byID, sr.order[0])
+		sr.order = slices.Delete(sr.order, 0, 1)
+	}
+
+	return sc.id
+}
+
+// get returns the sub-conversation with the id.
+func (sr *subResults) get(id string) (*subConversation, bool) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	sc, exists := sr.byID[id]
+	return sc, exists
+}
+
+// =============================================================================
+
+// routeToolResult replaces a large result of a selected tool with its
+// summary. The raw result stays in a sub-conversation the model can come back
+// to. The result is left alone when the summarizer fails.
+func (a *Agent) routeToolResult(ctx context.Context, toolCall client.ToolCall, resp client.D) {
+	if !a.routedTools[toolCall.Function.Name] {
+		return
+	}
+
+	content, _ := resp["content"].(string)
+
+	tokens := a.tke.TokenCount(content)
+	if tokens < subcontextTokens {
+		return
+	}
+
+	raw := rawResultText(content)
+
+	args, err := json.Marshal(toolCall.Function.Arguments)
+	if err != nil {
+		args = []byte("{}")
+	}
+
+	sc := subConversation{
+		tool: toolCall.Function.Name,
+		raw:  raw,
+		messages: []client.D{
+			client.System(fmt.Sprintf(subcontextPrompt, a.lastUserInput(), toolCall.Function.Name, args)),
+			client.User(raw),
+		},
+	}
+
+	summary, err := a.complete(ctx, subcontextModel, sc.messages)
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("summarize %s result: %w", toolCall.Function.Name, err))
+		return
+	}
+	sc.messages = append(sc.messages, client.Assistant(summary))
+
+	id := a.subResults.add(&sc)
+
+	resp["content"] = toolSuccessResponse(toolCall.ID, toolCall.Function.Name, ToolData{
+		"summary":       summary,
+		"raw_result_id": id,
+		"raw_lines":     strings.Count(raw, "\n") + 1,
+		"note":          "This is a summary of a large result. Call tool_raw_result with the raw_result_id to read lines of the raw result or to ask a question about it.",
+	})["content"]
+
+	a.renderer.Info(fmt.Sprintf("summarized %d tokens from %s into %d tokens, the raw result is %s", tokens, toolCall.Function.Name, a.tke.TokenCount(summary), id))
+}
+
+// lastUserInput returns the latest request from the user.
+func (a *Agent) lastUserInput() string {
+	for _, msg := range slices.Backward(a.conversation) {
+		if msg["role"] == "user" {
+			content, _ := msg["content"].(string)
+			return content
+		}
+	}
+
+	return ""
+}
+
+// rawResultText returns the tool result as text with a line per line of its
+// values, so the model can read it a range of lines at a time. Results that
+// aren't JSON documents are returned as they are.
+func rawResultText(content string) string {
+	doc, err := parseToolResponse(content)
+	if err != nil || doc.Data == nil {
+		return content
+	}
+
+	var b strings.Builder
+	for _, key := range slices.Sorted(maps.Keys(doc.Data)) {
+		switch v := doc.Data[key].(type) {
+		case string:
+			fmt.Fprintf(&b, "%s:\n%s\n", key, v)
+
+		default:
+			data, _ := json.MarshalIndent(v, "", "  ")
+			fmt.Fprintf(&b, "%s:\n%s\n", key, data)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// =============================================================================
+// RawResult Tool
+
+// RawResult represents a tool the model uses to get back to a tool result
+// that was summarized, reading its lines or asking the summarizer about it.
+type RawResult struct {
+	name  string
+	agent *Agent
+}
+
+// RegisterRawResult creates a new instance of the RawResult tool and loads it
+// into the provided tools map.
+func RegisterRawResult(tools map[string]Tool, agent *Agent) client.D {
+	rr := RawResult{
+		name:  "tool_raw_result",
+		agent: agent,
+	}
+	tools[rr.name] = &rr
+
+	return rr.toolDocument()
+}
+
+// rawResultParams represents the parameters for the RawResult tool.
+type rawResultParams struct {
+	ID        string `json:"id" description:"The raw_result_id of the summarized result."`
+	Question  string `json:"question,omitempty" description:"A question to answer from the raw result. Leave it empty to read lines instead."`
+	StartLine int    `json:"start_line,omitempty" description:"The first line to read, starting at 1."`
+	MaxLines  int    `json:"max_lines,omitempty" description:"The number of lines to read, 200 by default."`
+}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (rr *RawResult) toolDocument() client.D {
+	description := "Get back to a large tool result that was summarized. Ask a question about the raw result, or read a range of its lines when you need the exact text."
+
+	return client.ToolDocument(rr.name, description, rawResultParams{})
+}
+
+// Call is the function that is called by the agent to read the raw result
+// when the model requests the tool with the specified parameters.
+func (rr *RawResult) Call(ctx context.Context, toolCall client.ToolCall) (resp client.D) {
+	defer func() {
+		if r := recover(); r != nil {
+			resp = toolErrorResponse(toolCall.ID, rr.name, fmt.Errorf("%s", r))
+		}
+	}()
+
+	var params rawResultParams
+	if err := toolCall.Function.Decode(&params); err != nil {
+		return toolErrorResponse(toolCall.ID, rr.name, err)
+	}
+
+	sc, exists := rr.agent.subResults.get(params.ID)
+	if !exists {
+		return toolErrorResponse(toolCall.ID, rr.name, fmt.Errorf("raw result %q doesn't exist or is no longer kept, call the tool again", params.ID))
+	}
+
+	// -------------------------------------------------------------------------
+	// A question continues the sub-conversation with the summarizer.
+
+	if question := strings.TrimSpace(params.Question); question != "" {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+
+		messages := append(slices.Clone(sc.messages), client.User(question))
+
+		answer, err := rr.agent.complete(ctx, subcontextModel, messages)
+		if err != nil {
+			return toolErrorResponse(toolCall.ID, rr.name, err)
+		}
+		sc.messages = append(messages, client.Assistant(answer))
+
+		return toolSuccessResponse(toolCall.ID, rr.name, ToolData{"answer": answer})
+	}
+
+	// -------------------------------------------------------------------------
+	// Otherwise return the requested lines.
+
+	lines := strings.Split(sc.raw, "\n")
+
+	start := max(params.StartLine, 1)
+	if start > len(lines) {
+		return toolErrorResponse(toolCall.ID, rr.name, errors.New("start_line is past the end of the result"))
+	}
+
+	maxLines := params.MaxLines
+	if maxLines <= 0 {
+		maxLines = 200
+	}
+	end := min(start-1+maxLines, len(lines))
+
+	return toolSuccessResponse(toolCall.ID, rr.name, ToolData{
+		"tool":        sc.tool,
+		"start_line":  start,
+		"end_line":    end,
+		"total_lines": len(lines),
+		"content":     strings.Join(lines[start-1:end], "\n"),
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The number of turns between session summaries. Every summaryTurns turns the
+// model summarizes the session in the background. The summary is saved with
+// the session and added to the system prompt once the conversation is trimmed
+// or the session is resumed, so the model doesn't lose track of the task. This
+// can be changed with the AGENT_SUMMARY_TURNS environment variable, 0 turns
+// it off.
+var summaryTurns = 5
+
+func init() {
+	if v := os.Getenv("AGENT_SUMMARY_TURNS"); v != "" {
+		var err error
+		summaryTurns, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// sessionSummary represents the rolling summary of the session.
+type sessionSummary struct {
+	mu       sync.Mutex
+	text     string
+	turns    int  // Turns since the last summary was started.
+	running  bool // A summary is being created in the background.
+	injected bool // The summary is part of the system prompt.
+	wg       sync.WaitGroup
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+// scheduleSummary counts the turn and starts a new summary in the background
+// when enough turns have passed since the last one.
+func (a *Agent) scheduleSummary() {
+	if summaryTurns <= 0 {
+		return
+	}
+
+	s := &a.summary
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.turns++
+	if s.turns < summaryTurns || s.running {
+		return
+	}
+
+	s.turns = 0
+	s.running = true
+
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+	}
+
+	// The previous summary goes first so the new one covers the messages
+	// that were already trimmed away.
+	var messages []client.D
+	if s.text != "" {
+		messages = append(messages, client.User("Summary of the session so far:\n\n"+s.text))
+	}
+	for _, msg := range wireMessages(a.conversation[1:]) {
+		messages = append(messages, maps.Clone(msg))
+	}
+
+	s.wg.Go(func() {
+		text, err := a.summarize(s.ctx, messages)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.running = false
+
+		if err != nil {
+			log.Printf("session summary: %s", err)
+			return
+		}
+
+		s.text = text
+	})
+}
+
+// injectSummary adds the session summary to the system prompt. It's called
+// when messages are about to be lost, from then on the system prompt always
+// carries the latest summary.
+func (a *Agent) injectSummary() {
+	a.summary.mu.Lock()
+	a.summary.injected = a.summary.text != ""
+	a.summary.mu.Unlock()
+
+	a.refreshSystemPrompt()
+}
+
+// refreshSystemPrompt sets the system prompt from the persona, the skill
+// packs, the user's preferences and the session summary.
+func (a *Agent) refreshSystemPrompt() {
+	if len(a.conversation) == 0 || a.conversation[0]["role"] != "system" {
+		return
+	}
+
+	prompt := a.persona.systemPrompt() + a.skillsPrompt() + a.preferences.prompt()
+
+	a.summary.mu.Lock()
+	if a.summary.injected {
+		prompt += "\nHere is a summary of the session so far, the earlier messages are no longer in the conversation:\n\n" + a.summary.text + "\n"
+	}
+	a.summary.mu.Unlock()
+
+	a.conversation[0]["content"] = prompt
+}
+
+// summaryText returns the latest session summary.
+func (a *Agent) summaryText() string {
+	a.summary.mu.Lock()
+	defer a.summary.mu.Unlock()
+
+	return a.summary.text
+}
+
+// restoreSummary restores the summary of a resumed session. The messages
+// before the resume are part of the saved conversation but the summary is
+// injected so the model picks up the task where it left off.
+func (a *Agent) restoreSummary(text string) {
+	a.summary.mu.Lock()
+	a.summary.text = text
+	a.summary.injected = text != ""
+	a.summary.mu.Unlock()
+}
+
+// stopSummary cancels a summary in progress and waits for it to finish.
+func (a *Agent) stopSummary() {
+	a.summary.mu.Lock()
+	if a.summary.cancel != nil {
+		a.summary.cancel()
+	}
+	a.summary.mu.Unlock()
+
+	a.summary.wg.Wait()
+}
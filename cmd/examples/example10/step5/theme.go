@@ -0,0 +1,186 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Theme represents the colors used to display the agent in the terminal. Each
+// field is an ANSI SGR parameter like "91" for red or "1;95" for bold
+// magenta. An empty field leaves the text unstyled.
+type Theme struct {
+	User      string `json:"user"`      // The "You" prompt
+	Waiting   string `json:"waiting"`   // The model name and timer while waiting
+	Reasoning string `json:"reasoning"` // The reasoning of the model
+	Tool      string `json:"tool"`      // The tool calls
+	Stats     string `json:"stats"`     // Token usage and other information
+	Error     string `json:"error"`     // Errors
+	Question  string `json:"question"`  // Approvals and questions for the user
+
+	Heading string `json:"heading"`
+	Bold    string `json:"bold"`
+	Italic  string `json:"italic"`
+	Code    string `json:"code"`
+	Fence   string `json:"fence"`
+	Keyword string `json:"keyword"`
+	String  string `json:"string"`
+	Comment string `json:"comment"`
+	Bullet  string `json:"bullet"`
+
+	DiffHeader  string `json:"diff_header"`
+	DiffHunk    string `json:"diff_hunk"`
+	DiffRemoved string `json:"diff_removed"`
+	DiffAdded   string `json:"diff_added"`
+
+	Low    string `json:"low"`    // Small share of the context window
+	Medium string `json:"medium"` // Medium share of the context window
+	High   string `json:"high"`   // Large share of the context window
+}
+
+// themes is the set of built-in themes keyed by name.
+var themes = map[string]Theme{
+	"default": {
+		User:        "94",
+		Waiting:     "93",
+		Reasoning:   "91",
+		Tool:        "92",
+		Stats:       "90",
+		Error:       "91",
+		Question:    "93",
+		Heading:     "1;95",
+		Bold:        "1",
+		Italic:      "3",
+		Code:        "36",
+		Fence:       "90",
+		Keyword:     "94",
+		String:      "33",
+		Comment:     "90",
+		Bullet:      "96",
+		DiffHeader:  "1",
+		DiffHunk:    "96",
+		DiffRemoved: "91",
+		DiffAdded:   "92",
+		Low:         "92",
+		Medium:      "93",
+		High:        "91",
+	},
+
+	// The dim grays of the default theme are hard to read on a projector,
+	// this theme only uses bold and bright colors.
+	"high-contrast": {
+		User:        "1;94",
+		Waiting:     "1;93",
+		Reasoning:   "1;95",
+		Tool:        "1;92",
+		Stats:       "97",
+		Error:       "1;97;41",
+		Question:    "1;93",
+		Heading:     "1;4;97",
+		Bold:        "1",
+		Italic:      "4",
+		Code:        "1;96",
+		Fence:       "97",
+		Keyword:     "1;94",
+		String:      "1;93",
+		Comment:     "37",
+		Bullet:      "1;96",
+		DiffHeader:  "1;97",
+		DiffHunk:    "1;96",
+		DiffRemoved: "1;91",
+		DiffAdded:   "1;92",
+		Low:         "1;92",
+		Medium:      "1;93",
+		High:        "1;91",
+	},
+
+	// No escape codes at all, for terminals without colors and for logs.
+	"no-color": {},
+}
+
+// The theme used by the terminal renderer. This can be changed with the
+// AGENT_THEME environment variable set to the name of a built-in theme or to
+// a JSON theme file. Without AGENT_THEME the theme file in the user's config
+// directory is used when it exists, and the NO_COLOR convention is honored
+// when there is none.
+var theme = themes["default"]
+
+func init() {
+	v := os.Getenv("AGENT_THEME")
+
+	if v == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			file := filepath.Join(dir, "ardanlabs-agent", "theme.json")
+			if _, err := os.Stat(file); err == nil {
+				v = file
+			}
+		}
+	}
+
+	if v == "" && os.Getenv("NO_COLOR") != "" {
+		v = "no-color"
+	}
+
+	if v != "" {
+		var err error
+		theme, err = loadTheme(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// loadTheme returns the built-in theme with the specified name or reads the
+// theme from a JSON file. The file holds the fields to change from the
+// built-in theme named in its theme field, the default theme when it has
+// none, like:
+//
+//	{"theme": "high-contrast", "reasoning": "96", "stats": "37"}
+func loadTheme(name string) (Theme, error) {
+	if t, exists := themes[name]; exists {
+		return t, nil
+	}
+
+	if !strings.HasSuffix(name, ".json") {
+		return Theme{}, fmt.Errorf("unknown theme %q, choose one of %v or a JSON file", name, slices.Sorted(maps.Keys(themes)))
+	}
+
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return Theme{}, fmt.Errorf("read theme: %w", err)
+	}
+
+	var base struct {
+		Theme string `json:"theme"`
+	}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return Theme{}, fmt.Errorf("parse theme %s: %w", name, err)
+	}
+
+	t, exists := themes[cmp.Or(base.Theme, "default")]
+	if !exists {
+		return Theme{}, fmt.Errorf("theme %s: unknown theme %q, choose one of %v", name, base.Theme, slices.Sorted(maps.Keys(themes)))
+	}
+
+	// Fields that are not in the file keep the color of the base theme.
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Theme{}, fmt.Errorf("parse theme %s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// paint wraps the text in the escape codes of the style.
+func paint(style string, text string) string {
+	if style == "" {
+		return text
+	}
+
+	return "\u001b[" + style + "m" + text + "\u001b[0m"
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/logger"
+)
+
+// ForceTool makes the model call the named tool at the start of the next
+// turn instead of deciding on its own. This makes exercises like "always list
+// the files first" deterministic and is how structured data is extracted with
+// a function call. Only the first model call of the turn is forced, otherwise
+// the model could never answer. An empty name clears the forced tool.
+func (a *Agent) ForceTool(name string) error {
+	if name == "" {
+		a.forcedTool = ""
+		return nil
+	}
+
+	if _, exists := a.tools[name]; !exists {
+		return fmt.Errorf("unknown tool %q", name)
+	}
+
+	if !a.allowsTool(name) {
+		return fmt.Errorf("tool %q is not available to the %s persona", name, a.persona.Name)
+	}
+
+	a.forcedTool = name
+
+	return nil
+}
+
+// toolChoice returns the tool choice for the next model call. A forced tool
+// is used once.
+func (a *Agent) toolChoice() string {
+	choice := a.forcedTool
+	if choice == "" {
+		return client.ToolChoiceAuto
+	}
+
+	a.forcedTool = ""
+
+	return choice
+}
+
+// =============================================================================
+
+// ToolDocuments returns the definitions of the tools the persona can use, the
+// ones the model is sent.
+func (a *Agent) ToolDocuments() []client.D {
+	return a.activeToolDocuments()
+}
+
+// CallTool calls a tool with the arguments without asking the model, like
+// the toolspec program does to debug a tool. The call goes through the same
+// checks as the calls of the model, the policy, dry-run and approvals, and
+// is recorded with the tool events. The call is tagged with the request id
+// the context carries, or a new one, like the calls the model asks for. It
+// returns the tool message.
+func (a *Agent) CallTool(ctx context.Context, name string, arguments map[string]any) client.D {
+	requestID := client.RequestID(ctx)
+	if requestID == "" {
+		requestID = rand.Text()
+	}
+	ctx = logger.WithRequestID(client.WithRequestID(ctx, requestID), requestID)
+
+	var toolCall client.ToolCall
+	toolCall.ID = "call_" + rand.Text()
+	toolCall.Type = "function"
+	toolCall.Function.Name = name
+	toolCall.Function.Arguments = arguments
+
+	return a.callTools(ctx, []client.ToolCall{toolCall})[0]
+}
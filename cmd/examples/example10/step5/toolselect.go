@@ -0,0 +1,214 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+// With many tools registered the tool definitions alone take thousands of
+// tokens of every request. When AGENT_TOOL_TOP_K is set, only that many tools
+// are sent each turn, the ones whose description is closest to the user's
+// request, embedded with the model of the semantic cache. The tools listed in
+// AGENT_TOOL_PINNED, a comma separated list, are always sent on top of them.
+var (
+	toolTopK   int
+	toolPinned []string
+)
+
+func init() {
+	if v := os.Getenv("AGENT_TOOL_TOP_K"); v != "" {
+		var err error
+		toolTopK, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_TOOL_PINNED"); v != "" {
+		for name := range strings.SplitSeq(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				toolPinned = append(toolPinned, name)
+			}
+		}
+	}
+}
+
+// toolSelection represents the tools selected for the current step of the
+// turn. The embeddings of the tool descriptions are computed once per agent
+// and the embedding of the last text is kept, so the user's input is
+// embedded once per turn for the tool selection and the semantic cache.
+type toolSelection struct {
+	embeddings map[string][]float32
+	selected   map[string]bool
+	text       string
+	embedding  []float32
+}
+
+// selectTools picks the tools that are the most relevant to the text, the
+// user's input at the start of the turn and what the tools returned after
+// every round of tool calls. The tools the model already called in the turn
+// stay selected. All the tools are sent when the embedding model can't be
+// reached.
+func (a *Agent) selectTools(ctx context.Context, text string) {
+	a.toolSelection.selected = nil
+
+	if toolTopK <= 0 {
+		return
+	}
+
+	// Only the tools the persona allows are candidates.
+	candidates := a.activeToolDocuments()
+
+	var names, texts []string
+	for _, doc := range candidates {
+		fn, _ := doc["function"].(client.D)
+		name, _ := fn["name"].(string)
+		description, _ := fn["description"].(string)
+
+		names = append(names, name)
+		texts = append(texts, name+": "+description)
+	}
+
+	if len(names) <= toolTopK {
+		return
+	}
+
+	if err := a.embedTools(ctx, names, texts); err != nil {
+		a.renderer.Error(fmt.Errorf("tool selection, sending every tool: %w", err))
+		return
+	}
+
+	embedding, err := a.embedInput(ctx, text)
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("tool selection, sending every tool: %w", err))
+		return
+	}
+
+	// -------------------------------------------------------------------------
+	// Keep the closest tools, the pinned ones and the one that is forced.
+
+	scores := make(map[string]float32)
+	for _, name := range names {
+		scores[name] = vector.CosineSimilarity(embedding, a.toolSelection.embeddings[name])
+	}
+
+	slices.SortStableFunc(names, func(x, y string) int {
+		return cmp.Compare(scores[y], scores[x])
+	})
+
+	selected := make(map[string]bool)
+	for _, name := range names[:toolTopK] {
+		selected[name] = true
+	}
+
+	for _, name := range toolPinned {
+		selected[name] = true
+	}
+
+	if a.forcedTool != "" {
+		selected[a.forcedTool] = true
+	}
+
+	a.mu.Lock()
+	for _, evt := range a.turn.ToolCalls {
+		selected[evt.Name] = true
+	}
+	a.mu.Unlock()
+
+	a.toolSelection.selected = selected
+
+	docs := a.activeToolDocuments()
+	all, _ := json.Marshal(candidates)
+	sent, _ := json.Marshal(docs)
+
+	a.renderer.Info(fmt.Sprintf("Tools Selected[%d of %d] Tokens[%d of %d]", len(docs), len(candidates), a.tke.TokenCount(string(sent)), a.tke.TokenCount(string(all))))
+}
+
+// embedInput returns the embedding of the text, reusing the last one when
+// the text is the same.
+func (a *Agent) embedInput(ctx context.Context, text string) ([]float32, error) {
+	if a.toolSelection.embedding != nil && a.toolSelection.text == text {
+		return a.toolSelection.embedding, nil
+	}
+
+	embedding, err := embedText(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	a.toolSelection.text = text
+	a.toolSelection.embedding = embedding
+
+	return embedding, nil
+}
+
+// roundText returns the text the tools are selected with after a round of
+// tool calls: the user's input followed by the start of the requests and
+// results of the round.
+func (a *Agent) roundText(userInput string) string {
+	const maxBytes = 500
+
+	var parts []string
+	for _, msg := range slices.Backward(a.conversation) {
+		content, _ := msg["content"].(string)
+
+		if msg["role"] != "tool" && !(msg["role"] == "assistant" && strings.HasPrefix(content, "Tool call ")) {
+			break
+		}
+
+		if len(content) > maxBytes {
+			cut := maxBytes
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			content = content[:cut]
+		}
+		parts = append(parts, content)
+	}
+
+	slices.Reverse(parts)
+
+	return strings.Join(append([]string{userInput}, parts...), "\n")
+}
+
+// embedTools computes the embeddings of the tools that don't have one yet,
+// like the tools of a skill pack loaded during the session.
+func (a *Agent) embedTools(ctx context.Context, names []string, texts []string) error {
+	if a.toolSelection.embeddings == nil {
+		a.toolSelection.embeddings = make(map[string][]float32)
+	}
+
+	var missingNames, missingTexts []string
+	for i, name := range names {
+		if _, exists := a.toolSelection.embeddings[name]; !exists {
+			missingNames = append(missingNames, name)
+			missingTexts = append(missingTexts, texts[i])
+		}
+	}
+
+	if len(missingNames) == 0 {
+		return nil
+	}
+
+	embeddings, err := embedTexts(ctx, missingTexts)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range missingNames {
+		a.toolSelection.embeddings[name] = embeddings[i]
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The language of the user when the course is run in a language other than
+// English. When it's set, a small local model translates the user's input to
+// English before it reaches the agent, and translates the answers back. The
+// conversation stays in English since that's what the model and the tools
+// work best with. This is set with the AGENT_LANGUAGE environment variable,
+// and the model doing the translation with AGENT_TRANSLATE_MODEL.
+var (
+	translateLanguage string
+	translateModel    = "qwen2.5:3b"
+)
+
+const translateTimeout = 2 * time.Minute
+
+func init() {
+	translateLanguage = os.Getenv("AGENT_LANGUAGE")
+
+	if v := os.Getenv("AGENT_TRANSLATE_MODEL"); v != "" {
+		translateModel = v
+	}
+}
+
+// Code must never be translated. Fenced code blocks are kept out of the text
+// sent to the model and inline code is replaced by placeholders.
+var (
+	fencedCodePattern = regexp.MustCompile("(?s)```.*?```")
+	inlineCodePattern = regexp.MustCompile("`[^`\n]+`")
+)
+
+// =============================================================================
+
+// translator translates the conversation between the user's language and
+// English.
+type translator struct {
+	client   *client.Client
+	language string
+	model    string
+}
+
+// newTranslator constructs a translator for the configured language. It
+// returns nil when translation is turned off.
+func newTranslator() *translator {
+	if translateLanguage == "" || strings.EqualFold(translateLanguage, "english") {
+		return nil
+	}
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+
+	return &translator{
+		client:   client.New(logger, httpOptions...),
+		language: translateLanguage,
+		model:    translateModel,
+	}
+}
+
+// toEnglish translates the user's input to English.
+func (t *translator) toEnglish(ctx context.Context, text string) (string, error) {
+	return t.translate(ctx, text, t.language, "English")
+}
+
+// fromEnglish translates an answer to the user's language.
+func (t *translator) fromEnglish(ctx context.Context, text string) (string, error) {
+	return t.translate(ctx, text, "English", t.language)
+}
+
+// translate translates the prose of the text a segment at a time, leaving
+// the fenced code blocks untouched.
+func (t *translator) translate(ctx context.Context, text string, from string, to string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, translateTimeout)
+	defer cancel()
+
+	var b strings.Builder
+
+	last := 0
+	for _, loc := range fencedCodePattern.FindAllStringIndex(text, -1) {
+		prose, err := t.translateProse(ctx, text[last:loc[0]], from, to)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(prose)
+		b.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+
+	prose, err := t.translateProse(ctx, text[last:], from, to)
+	if err != nil {
+		return "", err
+	}
+	b.WriteString(prose)
+
+	return b.String(), nil
+}
+
+// translateProse translates text without code blocks. Inline code is swapped
+// for numbered placeholders, if the model loses one of them the text is
+// returned untranslated rather than with broken code.
+func (t *translator) translateProse(ctx context.Context, text string, from string, to string) (string, error) {
+	if strings.TrimSpace(text) == "" {
+		return text, nil
+	}
+
+	var codes []string
+	masked := inlineCodePattern.ReplaceAllStringFunc(text, func(code string) string {
+		codes = append(codes, code)
+		return fmt.Sprintf("[[%d]]", len(codes)-1)
+	})
+
+	prompt := fmt.Sprintf(`Translate the following text from %s to %s. Keep the
+markdown formatting and keep every placeholder like [[0]] exactly as it is.
+Reply with the translation only.
+
+%s`, from, to, masked)
+
+	d := client.ChatRequest(t.model, []client.D{client.User(prompt)},
+		client.WithTemperature(0),
+		client.WithStream(false),
+	)
+
+	var chat client.Chat
+	if err := t.client.Do(ctx, http.MethodPost, url, d, &chat); err != nil {
+		return "", fmt.Errorf("translate: %w", err)
+	}
+
+	if len(chat.Choices) == 0 {
+		return "", fmt.Errorf("translate: no choices in the response")
+	}
+
+	translated := chat.Choices[0].Message.Content
+	for i, code := range codes {
+		placeholder := fmt.Sprintf("[[%d]]", i)
+		if !strings.Contains(translated, placeholder) {
+			return text, nil
+		}
+		translated = strings.Replace(translated, placeholder, code, 1)
+	}
+
+	// Keep the whitespace around the segment so it joins the code blocks
+	// the same way the original did.
+	lead := text[:len(text)-len(strings.TrimLeft(text, " \t\n"))]
+	trail := text[len(strings.TrimRight(text, " \t\n")):]
+
+	return lead + strings.TrimSpace(translated) + trail, nil
+}
+
+// =============================================================================
+
+// translateInput translates the user's input to English. The input is used
+// as is if the translation fails.
+func (a *Agent) translateInput(ctx context.Context, input string) string {
+	if a.translator == nil {
+		return input
+	}
+
+	translated, err := a.translator.toEnglish(ctx, input)
+	if err != nil {
+		a.renderer.Error(err)
+		return input
+	}
+
+	a.renderer.Info("translated: " + translated)
+
+	return translated
+}
+
+// translateAnswer translates the answer of the turn to the user's language
+// and displays it after the English answer.
+func (a *Agent) translateAnswer(ctx context.Context) {
+	if a.translator == nil {
+		return
+	}
+
+	answer := a.LastAnswer()
+	if answer == "" {
+		return
+	}
+
+	translated, err := a.translator.fromEnglish(ctx, answer)
+	if err != nil {
+		a.renderer.Error(err)
+		return
+	}
+
+	a.mu.Lock()
+	a.turn.Translation = translated
+	a.mu.Unlock()
+
+	a.renderer.Info(fmt.Sprintf("%s:", a.translator.language))
+	a.renderer.Content(translated)
+	a.renderer.Done()
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/scheduler"
+	"github.com/ardanlabs/ai-training/foundation/stream"
+)
+
+// The policy used to trim the conversation when it no longer fits in the
+// context window and the number of turns the turn based policies keep. These
+// can be changed with the AGENT_TRIM_POLICY and AGENT_TRIM_TURNS environment
+// variables.
+var (
+	trimPolicyName = "oldest"
+	trimTurns      = 4
+)
+
+func init() {
+	if v := os.Getenv("AGENT_TRIM_POLICY"); v != "" {
+		trimPolicyName = v
+	}
+
+	if v := os.Getenv("AGENT_TRIM_TURNS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			trimTurns = n
+		}
+	}
+}
+
+// TrimPolicy describes the behavior required to reduce the conversation so it
+// fits in the context window. The system prompt is always kept.
+type TrimPolicy interface {
+	Trim(ctx context.Context, conversation []client.D, window int, tokens func(client.D) int) []client.D
+}
+
+// newTrimPolicy constructs the policy with the specified name. The summarize
+// policy uses the agent to summarize the messages it drops.
+func newTrimPolicy(name string, a *Agent) (TrimPolicy, error) {
+	switch name {
+	case "oldest":
+		return dropOldest{}, nil
+
+	case "last-turns":
+		return keepLastTurns{turns: trimTurns}, nil
+
+	case "importance":
+		return importanceWeighted{}, nil
+
+	case "summarize":
+		return summarizeThenDrop{turns: trimTurns, summarize: a.summarize}, nil
+	}
+
+	return nil, fmt.Errorf("unknown trim policy %q, choose one of [oldest last-turns importance summarize]", name)
+}
+
+// trimPinned trims the conversation with the policy, keeping the messages the
+// user pinned. They are set aside while the policy runs and put back right
+// after the system prompt. The messages of the current turn are never set
+// aside so the turn stays in order.
+func trimPinned(ctx context.Context, policy TrimPolicy, conversation []client.D, window int, tokens func(client.D) int) []client.D {
+	current := len(conversation)
+	if starts := turnStarts(conversation); len(starts) > 0 {
+		current = starts[len(starts)-1]
+	}
+
+	var pinned []client.D
+	rest := []client.D{conversation[0]}
+
+	for i, msg := range conversation[1:] {
+		if meta, ok := messageMeta(msg); ok && meta.Pinned && i+1 < current {
+			pinned = append(pinned, msg)
+			continue
+		}
+		rest = append(rest, msg)
+	}
+
+	if len(pinned) == 0 {
+		return policy.Trim(ctx, conversation, window, tokens)
+	}
+
+	rest = policy.Trim(ctx, rest, window-conversationTokens(pinned, tokens), tokens)
+
+	trimmed := append([]client.D{rest[0]}, pinned...)
+
+	return append(trimmed, rest[1:]...)
+}
+
+// conversationTokens returns the number of tokens used by the messages.
+func conversationTokens(conversation []client.D, tokens func(client.D) int) int {
+	var total int
+	for _, msg := range conversation {
+		total += tokens(msg)
+	}
+
+	return total
+}
+
+// turnStarts returns the index of every user message, which starts a turn.
+func turnStarts(conversation []client.D) []int {
+	var starts []int
+	for i, msg := range conversation {
+		if msg["role"] == "user" {
+			starts = append(starts, i)
+		}
+	}
+
+	return starts
+}
+
+// =============================================================================
+
+// dropOldest removes the oldest messages after the system prompt until the
+// conversation fits.
+type dropOldest struct{}
+
+// Trim implements the TrimPolicy interface.
+func (dropOldest) Trim(ctx context.Context, conversation []client.D, window int, tokens func(client.D) int) []client.D {
+	for len(conversation) > 1 && conversationTokens(conversation, tokens) > window {
+		conversation = slices.Delete(conversation, 1, 2)
+	}
+
+	return conversation
+}
+
+// =============================================================================
+
+// keepLastTurns keeps the system prompt and the last N turns. Whole turns are
+// removed so tool calls are never separated from their results. If the last
+// turns still don't fit, the oldest messages are removed.
+type keepLastTurns struct {
+	turns int
+}
+
+// Trim implements the TrimPolicy interface.
+func (p keepLastTurns) Trim(ctx context.Context, conversation []client.D, window int, tokens func(client.D) int) []client.D {
+	if starts := turnStarts(conversation); len(starts) > p.turns {
+		conversation = slices.Delete(conversation, 1, starts[len(starts)-p.turns])
+	}
+
+	return dropOldest{}.Trim(ctx, conversation, window, tokens)
+}
+
+// =============================================================================
+
+// toolCallPath finds the path argument of a tool call recorded in the
+// conversation.
+var toolCallPath = regexp.MustCompile(`path:([^\s\]]+)`)
+
+// recentMessages is the number of messages that count as recent when deciding
+// if a tool result is still being referenced.
+const recentMessages = 6
+
+// importanceWeighted removes the least important messages first. Messages in
+// the current turn are never removed and tool calls for files that are
+// mentioned in the recent messages are removed last. Within the same
+// importance the oldest messages are removed first. A tool call request and
+// its results are always removed together. If only the current turn is left
+// it's kept whole, even when it doesn't fit.
+type importanceWeighted struct{}
+
+// Trim implements the TrimPolicy interface.
+func (importanceWeighted) Trim(ctx context.Context, conversation []client.D, window int, tokens func(client.D) int) []client.D {
+	for len(conversation) > 1 && conversationTokens(conversation, tokens) > window {
+		start, end := leastImportant(conversation)
+		if start == -1 {
+			return conversation
+		}
+
+		conversation = slices.Delete(conversation, start, end)
+	}
+
+	return conversation
+}
+
+// leastImportant returns the range of the messages to remove next or -1 if
+// only the current turn is left. The range covers a tool call request with
+// all of its results.
+func leastImportant(conversation []client.D) (int, int) {
+	last := len(conversation)
+	if starts := turnStarts(conversation); len(starts) > 0 {
+		last = starts[len(starts)-1]
+	}
+
+	var recent strings.Builder
+	for _, msg := range conversation[max(len(conversation)-recentMessages, 1):] {
+		content, _ := msg["content"].(string)
+		recent.WriteString(content)
+	}
+
+	// A tool call request is recorded right before its results.
+	unit := func(i int) int {
+		end := i + 1
+		content, _ := conversation[i]["content"].(string)
+		if conversation[i]["role"] == "tool" || (conversation[i]["role"] == "assistant" && strings.HasPrefix(content, "Tool call ")) {
+			for end < last && conversation[end]["role"] == "tool" {
+				end++
+			}
+		}
+
+		return end
+	}
+
+	referenced := func(i int) bool {
+		call, _ := conversation[i]["content"].(string)
+		for _, m := range toolCallPath.FindAllStringSubmatch(call, -1) {
+			if strings.Contains(recent.String(), m[1]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	candidate, candidateEnd := -1, -1
+	for i := 1; i < last; i = unit(i) {
+		if !referenced(i) {
+			return i, unit(i)
+		}
+		if candidate == -1 {
+			candidate, candidateEnd = i, unit(i)
+		}
+	}
+
+	return candidate, candidateEnd
+}
+
+// =============================================================================
+
+// summarizeThenDrop asks the model to summarize the turns that are removed
+// and keeps the summary along with the last N turns. If the summary can't be
+// created it falls back to keeping the last N turns.
+type summarizeThenDrop struct {
+	turns     int
+	summarize func(ctx context.Context, messages []client.D) (string, error)
+}
+
+// Trim implements the TrimPolicy interface.
+func (p summarizeThenDrop) Trim(ctx context.Context, conversation []client.D, window int, tokens func(client.D) int) []client.D {
+	starts := turnStarts(conversation)
+	if len(starts) <= p.turns {
+		return dropOldest{}.Trim(ctx, conversation, window, tokens)
+	}
+
+	cut := starts[len(starts)-p.turns]
+
+	summary, err := p.summarize(ctx, conversation[1:cut])
+	if err != nil {
+		return keepLastTurns{turns: p.turns}.Trim(ctx, conversation, window, tokens)
+	}
+
+	trimmed := []client.D{
+		conversation[0],
+		withMeta(client.User("Here is a summary of our earlier conversation:\n\n"+summary), MessageMeta{Time: time.Now().UTC()}),
+	}
+	trimmed = append(trimmed, conversation[cut:]...)
+
+	return dropOldest{}.Trim(ctx, trimmed, window, tokens)
+}
+
+// summarize asks the model for a short summary of the messages.
+func (a *Agent) summarize(ctx context.Context, messages []client.D) (string, error) {
+	var transcript strings.Builder
+	for _, msg := range messages {
+		content, _ := msg["content"].(string)
+		fmt.Fprintf(&transcript, "%s: %s\n\n", msg["role"], content)
+	}
+
+	summary, err := a.complete(ctx, model, []client.D{
+		client.System("Summarize the conversation between a user and a coding assistant. Keep the decisions made, the files that were read or changed, and any open questions. Answer with the summary only."),
+		client.User(transcript.String()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("summarize: %w", err)
+	}
+
+	return summary, nil
+}
+
+// complete sends the messages to the model without tools and returns the
+// answer. It's used for the side calls that aren't part of the conversation.
+func (a *Agent) complete(ctx context.Context, model string, messages []client.D) (string, error) {
+	d := client.ChatRequest(model, messages,
+		client.WithTemperature(0.0),
+		client.WithStream(true),
+	)
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	// The side calls give way to the conversations.
+	ctx, release, err := a.acquireModel(ctx, scheduler.Low)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	ch := make(chan stream.Event, 100)
+	if err := a.streamer.Do(ctx, http.MethodPost, url, d, ch); err != nil {
+		return "", err
+	}
+
+	var answer strings.Builder
+	for evt := range ch {
+		switch evt.Kind {
+		case stream.ContentDelta:
+			answer.WriteString(evt.Text)
+		case stream.Error:
+			return "", evt.Err
+		}
+	}
+
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	if answer.Len() == 0 {
+		return "", fmt.Errorf("the model returned an empty answer")
+	}
+
+	return answer.String(), nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The limits of a single user request. A model that keeps calling tools
+// could run forever, so once the model has made maxToolIterations rounds of
+// tool calls or the turn has run for turnTimeout, the model is asked to
+// summarize what it did and the user decides whether to continue. These can
+// be changed with the AGENT_MAX_ITERATIONS and AGENT_TURN_TIMEOUT environment
+// variables. A single tool call is cut off after toolTimeout, which can be
+// changed with AGENT_TOOL_TIMEOUT, so a hung tool can't hold the turn. A
+// limit of zero turns it off.
+var (
+	maxToolIterations = 25
+	turnTimeout       = 10 * time.Minute
+	toolTimeout       = 10 * time.Minute
+)
+
+func init() {
+	if v := os.Getenv("AGENT_MAX_ITERATIONS"); v != "" {
+		var err error
+		maxToolIterations, err = strconv.Atoi(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_TURN_TIMEOUT"); v != "" {
+		var err error
+		turnTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if v := os.Getenv("AGENT_TOOL_TIMEOUT"); v != "" {
+		var err error
+		toolTimeout, err = time.ParseDuration(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// turnLimit describes the limit the turn has reached after the specified
+// number of tool iterations. It returns an empty string if the turn can keep
+// going.
+func turnLimit(iterations int, elapsed time.Duration) string {
+	switch {
+	case maxToolIterations > 0 && iterations >= maxToolIterations:
+		return fmt.Sprintf("the turn reached the limit of %d tool iterations", maxToolIterations)
+
+	case turnTimeout > 0 && elapsed >= turnTimeout:
+		return fmt.Sprintf("the turn reached the time limit of %s", turnTimeout)
+	}
+
+	return ""
+}
+
+// stopTurn ends a turn that reached a limit. The model is called one last
+// time without tools to summarize what it did, so the user can decide
+// whether to continue.
+func (a *Agent) stopTurn(ctx context.Context, limit string) error {
+	a.renderer.Info(limit + ", asking the model for a summary")
+
+	a.mu.Lock()
+	a.turn.Limit = limit
+	a.mu.Unlock()
+
+	prompt := fmt.Sprintf("Stop here, %s. Don't call any more tools. Summarize what you have done so far and what is left to do, then ask me whether you should continue.", limit)
+
+	a.conversation = append(a.conversation, withMeta(client.User(prompt), MessageMeta{
+		Time:   time.Now().UTC(),
+		Tokens: a.tke.TokenCount(prompt),
+	}))
+
+	if _, err := a.callModel(ctx, false); err != nil {
+		return err
+	}
+
+	a.translateAnswer(ctx)
+	a.reportUsage()
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// contextTool fails the call when its context is already done.
+type contextTool struct{}
+
+func (contextTool) Call(ctx context.Context, toolCall client.ToolCall) client.D {
+	if err := ctx.Err(); err != nil {
+		return toolErrorResponse(toolCall.ID, toolCall.Function.Name, err)
+	}
+
+	return toolSuccessResponse(toolCall.ID, toolCall.Function.Name, ToolData{"result": "done"})
+}
+
+func TestToolTimeoutOff(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	defer func(d time.Duration) { toolTimeout = d }(toolTimeout)
+	toolTimeout = 0
+
+	agent, err := NewAgent(nil, WithRenderer(&stderrRenderer{w: io.Discard}))
+	if err != nil {
+		t.Fatalf("new agent: %s", err)
+	}
+	defer agent.Close()
+
+	agent.tools["tool_context"] = contextTool{}
+
+	toolCall := client.ToolCall{
+		ID: "call-1",
+		Function: client.Function{
+			Name:      "tool_context",
+			Arguments: map[string]any{},
+		},
+	}
+
+	// A timeout of zero turns the limit off instead of cutting off every
+	// call.
+	resps := agent.callTools(context.Background(), []client.ToolCall{toolCall})
+	if len(resps) != 1 {
+		t.Fatalf("got %d results, want 1", len(resps))
+	}
+
+	if !succeeded(resps[0]) {
+		t.Errorf("the call failed without a timeout: %v", resps[0]["content"])
+	}
+}
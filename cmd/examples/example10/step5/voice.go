@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// The transcription server used in voice mode and the Whisper model it runs.
+// Any server with the OpenAI transcription API works, like whisper.cpp's
+// server started with --inference-path /v1/audio/transcriptions. These can be
+// changed with the AGENT_WHISPER_URL, AGENT_WHISPER_MODEL and
+// AGENT_WHISPER_LANGUAGE environment variables.
+var (
+	whisperURL      = "http://localhost:8081/v1/audio/transcriptions"
+	whisperModel    = "whisper-1"
+	whisperLanguage string
+)
+
+const transcribeTimeout = 2 * time.Minute
+
+func init() {
+	if v := os.Getenv("AGENT_WHISPER_URL"); v != "" {
+		whisperURL = v
+	}
+
+	if v := os.Getenv("AGENT_WHISPER_MODEL"); v != "" {
+		whisperModel = v
+	}
+
+	whisperLanguage = os.Getenv("AGENT_WHISPER_LANGUAGE")
+}
+
+// recorders are the programs that can record 16kHz mono audio from the
+// default microphone into a WAV file, in order of preference. All of them
+// finish the file cleanly when they are interrupted.
+var recorders = [][]string{
+	{"arecord", "-q", "-f", "S16_LE", "-r", "16000", "-c", "1"},
+	{"rec", "-q", "-r", "16000", "-c", "1", "-b", "16"},
+	{"ffmpeg", "-loglevel", "error", "-f", ffmpegInput(), "-i", ffmpegDevice(), "-ar", "16000", "-ac", "1"},
+}
+
+func ffmpegInput() string {
+	if runtime.GOOS == "darwin" {
+		return "avfoundation"
+	}
+	return "pulse"
+}
+
+func ffmpegDevice() string {
+	if runtime.GOOS == "darwin" {
+		return ":0"
+	}
+	return "default"
+}
+
+// =============================================================================
+
+// voiceInput wraps the function that reads the user's messages with push to
+// talk. Pressing Enter on an empty line starts recording, pressing Enter
+// again stops it and the transcription is used as the message. Typed messages
+// are passed through.
+func voiceInput(getUserMessage func() (string, bool)) (func() (string, bool), error) {
+	recorder, err := findRecorder()
+	if err != nil {
+		return nil, err
+	}
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+	cln := client.New(logger, httpOptions...)
+
+	fmt.Printf("Voice mode: press Enter to talk and Enter again to send, using %s and %s\n", recorder[0], whisperURL)
+
+	return func() (string, bool) {
+		for {
+			input, ok := getUserMessage()
+			if !ok || input != "" {
+				return input, ok
+			}
+
+			text, err := recordAndTranscribe(cln, recorder, getUserMessage)
+			if err != nil {
+				fmt.Printf("%s\n", paint(theme.Error, fmt.Sprintf("voice: %s", err)))
+				fmt.Printf("%s: ", paint(theme.User, "You"))
+				continue
+			}
+
+			if text == "" {
+				fmt.Printf("%s\n", paint(theme.Stats, "nothing was heard, try again"))
+				fmt.Printf("%s: ", paint(theme.User, "You"))
+				continue
+			}
+
+			fmt.Printf("%s %s\n", paint(theme.Stats, "heard:"), text)
+
+			return text, true
+		}
+	}, nil
+}
+
+// findRecorder returns the first recorder that is installed.
+func findRecorder() ([]string, error) {
+	for _, recorder := range recorders {
+		if _, err := exec.LookPath(recorder[0]); err == nil {
+			return recorder, nil
+		}
+	}
+
+	return nil, errors.New("voice mode needs arecord, sox or ffmpeg to record from the microphone")
+}
+
+// recordAndTranscribe records until the user presses Enter and returns the
+// transcription of the recording.
+func recordAndTranscribe(cln *client.Client, recorder []string, getUserMessage func() (string, bool)) (string, error) {
+	dir, err := os.MkdirTemp("", "agent-voice-")
+	if err != nil {
+		return "", fmt.Errorf("create temp dir: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "recording.wav")
+
+	args := append(slices.Clone(recorder[1:]), path)
+	cmd := exec.Command(recorder[0], args...)
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("start %s: %w", recorder[0], err)
+	}
+
+	fmt.Print(paint(theme.Question, "● recording, press Enter to stop"))
+	start := time.Now()
+
+	getUserMessage()
+
+	// The recorders write the WAV header when they are interrupted.
+	cmd.Process.Signal(os.Interrupt)
+	cmd.Wait()
+
+	fmt.Printf("%s\n", paint(theme.Stats, fmt.Sprintf("recorded %.1fs, transcribing", time.Since(start).Seconds())))
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open recording: %w", err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcribeTimeout)
+	defer cancel()
+
+	t, err := cln.Transcribe(ctx, whisperURL, whisperModel, whisperLanguage, "recording.wav", f)
+	if err != nil {
+		return "", fmt.Errorf("transcribe: %w", err)
+	}
+
+	return t.Text, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/stream"
+)
+
+// The model is loaded into memory when the chat starts, before the first
+// prompt, so the first answer isn't held up by a long silent load. This can
+// be turned off with the AGENT_WARMUP environment variable.
+var warmup = true
+
+func init() {
+	if v := os.Getenv("AGENT_WARMUP"); v != "" {
+		var err error
+		warmup, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// The time a large model gets to load from a slow disk.
+const warmupTimeout = 5 * time.Minute
+
+// warmUp loads the model while showing how long it's taking. Ollama loads a
+// model when it's sent a generate request without a prompt, other servers
+// are sent a chat request for a single token.
+func (a *Agent) warmUp(ctx context.Context) {
+	// Models in the cloud are always loaded.
+	if !warmup || transport == client.TransportBedrock || transport == client.TransportVertex {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, warmupTimeout)
+	defer cancel()
+
+	// -------------------------------------------------------------------------
+	// Show how long the model is taking to load.
+
+	label := "loading " + model
+	start := time.Now()
+
+	wctx, cancelTimer := context.WithCancel(ctx)
+	ticker := time.NewTicker(100 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for {
+			select {
+			case <-ticker.C:
+				a.renderer.Waiting(label, time.Since(start))
+
+			case <-wctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	})
+
+	a.renderer.Waiting(label, 0)
+
+	err := loadModel(ctx, a.streamer)
+
+	cancelTimer()
+	wg.Wait()
+
+	if err != nil {
+		a.renderer.Error(fmt.Errorf("warm up %s, the first answer can take a while: %w", model, err))
+		return
+	}
+
+	a.renderer.Info(fmt.Sprintf("%s is ready, loaded in %s", model, time.Since(start).Round(100*time.Millisecond)))
+}
+
+// loadModel asks the server to load the model into memory.
+func loadModel(ctx context.Context, streamer client.Streamer[stream.Event]) error {
+	if transport == client.TransportSSE {
+		logger := func(ctx context.Context, msg string, v ...any) {}
+		cln := client.New(logger, httpOptions...)
+
+		d := client.D{
+			"model": model,
+		}
+		withKeepAlive(d)
+
+		// Ollama reloads the model when the context window changes, it's
+		// loaded with the one the requests use.
+		withOllamaOptions(d)
+
+		var resp struct {
+			DoneReason string `json:"done_reason"`
+		}
+
+		if err := cln.Do(ctx, http.MethodPost, serverBaseURL(url)+"/api/generate", d, &resp); err == nil {
+			return nil
+		}
+	}
+
+	d := client.ChatRequest(model, []client.D{client.User("Hi")},
+		client.WithMaxTokens(1),
+		client.WithStream(true),
+		withKeepAlive,
+		withOllamaOptions,
+	)
+
+	ch := make(chan stream.Event, 100)
+	if err := streamer.Do(ctx, http.MethodPost, url, d, ch); err != nil {
+		return err
+	}
+
+	var err error
+	for evt := range ch {
+		if evt.Kind == stream.Error {
+			err = evt.Err
+		}
+	}
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	return err
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Directories that are never watched since they are large or change for
+// reasons the model doesn't care about.
+var watchSkipDirs = []string{".git", "vendor", "node_modules", ".venv", ".idea", ".vscode", "zarf", "libw2v"}
+
+// How long after the agent edits a file that events for that file are
+// considered to be caused by the agent.
+const watchOwnEditWindow = 2 * time.Second
+
+// workspaceChange represents a change made to a file in the workspace.
+type workspaceChange struct {
+	Time time.Time `json:"time"`
+	Path string    `json:"path"`
+	Op   string    `json:"op"`
+}
+
+// workspaceWatcher records the file changes made in the workspace during the
+// session that were not made by the agent's own tools. The agents working in
+// the same directory share one recursive watch, every agent keeps its own
+// changes.
+type workspaceWatcher struct {
+	root string
+	tree *treeWatcher
+
+	mu       sync.Mutex
+	changes  []workspaceChange
+	changed  []string
+	ownEdits map[string]time.Time
+}
+
+// newWorkspaceWatcher starts watching the directory tree under root, or joins
+// the watch another agent already started for it.
+func newWorkspaceWatcher(root string) (*workspaceWatcher, error) {
+	tree, err := acquireTreeWatcher(root)
+	if err != nil {
+		return nil, err
+	}
+
+	ww := workspaceWatcher{
+		root:     root,
+		tree:     tree,
+		ownEdits: make(map[string]time.Time),
+	}
+	tree.subscribe(&ww)
+
+	return &ww, nil
+}
+
+// Close stops watching the workspace. The watch is only stopped once no other
+// agent uses it. A nil watcher, when watching failed, does nothing.
+func (ww *workspaceWatcher) Close() error {
+	if ww == nil {
+		return nil
+	}
+
+	return ww.tree.unsubscribe(ww)
+}
+
+// ownEdit marks the paths as being changed by the agent so the changes are
+// not reported back to the model. The paths are relative to the root or
+// absolute.
+func (ww *workspaceWatcher) ownEdit(paths ...string) {
+	if ww == nil {
+		return
+	}
+
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	for _, path := range paths {
+		ww.ownEdits[relativePath(ww.root, path)] = time.Now()
+	}
+}
+
+// changedFiles returns the paths changed since the last call, so the copies
+// of the files the model read can be expired. The changes stay recorded for
+// the workspace changes tool. A nil watcher, when watching failed, reports
+// nothing.
+func (ww *workspaceWatcher) changedFiles() []string {
+	if ww == nil {
+		return nil
+	}
+
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	changed := ww.changed
+	ww.changed = nil
+
+	return changed
+}
+
+// drain returns the changes recorded since the last call.
+func (ww *workspaceWatcher) drain() []workspaceChange {
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	changes := ww.changes
+	ww.changes = nil
+
+	return changes
+}
+
+func (ww *workspaceWatcher) record(event fsnotify.Event) {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	path := relativePath(ww.root, event.Name)
+
+	ww.mu.Lock()
+	defer ww.mu.Unlock()
+
+	if t, exists := ww.ownEdits[path]; exists && time.Since(t) < watchOwnEditWindow {
+		return
+	}
+
+	if !slices.Contains(ww.changed, path) {
+		ww.changed = append(ww.changed, path)
+	}
+
+	var op string
+	switch {
+	case event.Has(fsnotify.Create):
+		op = "created"
+	case event.Has(fsnotify.Write):
+		op = "modified"
+	case event.Has(fsnotify.Remove):
+		op = "removed"
+	case event.Has(fsnotify.Rename):
+		op = "renamed"
+	}
+
+	// A new file is written right after it's created, the model only needs
+	// to know the file is new.
+	if op == "modified" && slices.ContainsFunc(ww.changes, func(c workspaceChange) bool {
+		return c.Path == path && c.Op == "created"
+	}) {
+		return
+	}
+
+	// Editors write a file several times when saving, so only keep the
+	// latest change for a path.
+	ww.changes = slices.DeleteFunc(ww.changes, func(c workspaceChange) bool {
+		return c.Path == path && c.Op == op
+	})
+
+	ww.changes = append(ww.changes, workspaceChange{
+		Time: time.Now().UTC(),
+		Path: path,
+		Op:   op,
+	})
+}
+
+// =============================================================================
+
+// treeWatchers holds the recursive watches by root. Every watch uses an
+// inotify instance and a watch per directory, which run out quickly when each
+// daemon session starts its own.
+var treeWatchers = struct {
+	mu    sync.Mutex
+	roots map[string]*treeWatcher
+}{
+	roots: make(map[string]*treeWatcher),
+}
+
+// treeWatcher watches a directory tree and passes the events to the agents
+// that subscribed to it.
+type treeWatcher struct {
+	root    string
+	watcher *fsnotify.Watcher
+
+	mu          sync.Mutex
+	subscribers []*workspaceWatcher
+}
+
+// acquireTreeWatcher returns the watch for the root, starting it if no agent
+// watches the root yet.
+func acquireTreeWatcher(root string) (*treeWatcher, error) {
+	treeWatchers.mu.Lock()
+	defer treeWatchers.mu.Unlock()
+
+	if tw, exists := treeWatchers.roots[root]; exists {
+		return tw, nil
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("new watcher: %w", err)
+	}
+
+	tw := treeWatcher{
+		root:    root,
+		watcher: watcher,
+	}
+
+	if err := tw.addTree(root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go tw.run()
+
+	treeWatchers.roots[root] = &tw
+
+	return &tw, nil
+}
+
+// subscribe starts passing the events to the agent's watcher.
+func (tw *treeWatcher) subscribe(ww *workspaceWatcher) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+
+	tw.subscribers = append(tw.subscribers, ww)
+}
+
+// unsubscribe stops passing the events to the agent's watcher and stops the
+// watch when it was the last one.
+func (tw *treeWatcher) unsubscribe(ww *workspaceWatcher) error {
+	treeWatchers.mu.Lock()
+	defer treeWatchers.mu.Unlock()
+
+	tw.mu.Lock()
+	tw.subscribers = slices.DeleteFunc(tw.subscribers, func(s *workspaceWatcher) bool {
+		return s == ww
+	})
+	last := len(tw.subscribers) == 0
+	tw.mu.Unlock()
+
+	if !last {
+		return nil
+	}
+
+	delete(treeWatchers.roots, tw.root)
+
+	return tw.watcher.Close()
+}
+
+// addTree watches the directory and all of its subdirectories. The fsnotify
+// package doesn't support recursive watches.
+func (tw *treeWatcher) addTree(root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+
+		if path != root && slices.Contains(watchSkipDirs, d.Name()) {
+			return filepath.SkipDir
+		}
+
+		if err := tw.watcher.Add(path); err != nil {
+			return fmt.Errorf("watch %s: %w", path, err)
+		}
+
+		return nil
+	})
+}
+
+func (tw *treeWatcher) run() {
+	for {
+		select {
+		case event, ok := <-tw.watcher.Events:
+			if !ok {
+				return
+			}
+
+			// New directories need to be watched as well.
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := tw.addTree(event.Name); err != nil {
+						log.Printf("watcher: %s", err)
+					}
+				}
+			}
+
+			tw.mu.Lock()
+			subscribers := slices.Clone(tw.subscribers)
+			tw.mu.Unlock()
+
+			for _, ww := range subscribers {
+				ww.record(event)
+			}
+
+		case err, ok := <-tw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("watcher: %s", err)
+		}
+	}
+}
+
+// =============================================================================
+// WorkspaceChanges Tool
+
+// WorkspaceChanges represents a tool that can be used to learn which files
+// were changed outside of the agent's own edits.
+type WorkspaceChanges struct {
+	name    string
+	watcher *workspaceWatcher
+}
+
+// RegisterWorkspaceChanges creates a new instance of the WorkspaceChanges tool
+// and loads it into the provided tools map.
+func RegisterWorkspaceChanges(tools map[string]Tool, watcher *workspaceWatcher) client.D {
+	wc := WorkspaceChanges{
+		name:    "tool_workspace_changes",
+		watcher: watcher,
+	}
+	tools[wc.name] = &wc
+
+	return wc.toolDocument()
+}
+
+// workspaceChangesParams represents the parameters for the WorkspaceChanges
+// tool, which doesn't take any.
+type workspaceChangesParams struct{}
+
+// toolDocument defines the metadata for the tool that is provied to the model.
+func (wc *WorkspaceChanges) toolDocument() client.D {
+	return client.ToolDocument(wc.name, "List the files the user changed, created, or removed since the last time this tool was called. Call this before editing a file you read earlier so you don't work with stale contents.", workspaceChangesParams{})
+}
+
+// Call is the function that is called by the agent to report the workspace
+// changes when the model requests the tool.
+func (wc *WorkspaceChanges) Call(ctx context.Context, toolCall client.ToolCall) client.D {
+	changes := wc.watcher.drain()
+
+	var b strings.Builder
+	for _, c := range changes {
+		fmt.Fprintf(&b, "%s %s\n", c.Op, c.Path)
+	}
+
+	if len(changes) == 0 {
+		return toolSuccessResponse(toolCall.ID, wc.name, ToolData{"message": "no files changed outside of your edits"})
+	}
+
+	return toolSuccessResponse(toolCall.ID, wc.name, ToolData{"changes": changes, "summary": b.String()})
+}
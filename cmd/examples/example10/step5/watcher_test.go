@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+func TestWatcherOwnEdit(t *testing.T) {
+	root := t.TempDir()
+
+	ww := workspaceWatcher{
+		root:     root,
+		ownEdits: make(map[string]time.Time),
+	}
+
+	// The agent's edits are matched whatever form the model used for the
+	// path.
+	ww.ownEdit(filepath.Join(root, "main.go"), "./cmd/other.go")
+
+	ww.record(fsnotify.Event{Name: filepath.Join(root, "main.go"), Op: fsnotify.Write})
+	ww.record(fsnotify.Event{Name: filepath.Join(root, "cmd", "other.go"), Op: fsnotify.Write})
+
+	if changed := ww.changedFiles(); len(changed) != 0 {
+		t.Errorf("got changed files %v, want the agent's edits left out", changed)
+	}
+
+	// A file the agent didn't edit is reported relative to the root.
+	ww.record(fsnotify.Event{Name: filepath.Join(root, "README.md"), Op: fsnotify.Write})
+
+	if changed := ww.changedFiles(); len(changed) != 1 || changed[0] != "README.md" {
+		t.Errorf("got changed files %v, want README.md", changed)
+	}
+}
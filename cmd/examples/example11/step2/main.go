@@ -221,15 +221,15 @@ func (a *Agent) Run(ctx context.Context) error {
 		// tool call or providing a user request.
 
 		d := client.D{
-			"model":          model,
-			"messages":       conversation,
-			"max_tokens":     contextWindow,
-			"temperature":    0.0,
-			"top_p":          0.1,
-			"top_k":          1,
-			"stream":         true,
-			"tools":          a.toolDocuments,
-			"tool_selection": "auto",
+			"model":       model,
+			"messages":    conversation,
+			"max_tokens":  contextWindow,
+			"temperature": 0.0,
+			"top_p":       0.1,
+			"top_k":       1,
+			"stream":      true,
+			"tools":       a.toolDocuments,
+			"tool_choice": "auto",
 		}
 
 		fmt.Printf("\u001b[93m\n%s\u001b[0m: ", model)
@@ -340,7 +340,7 @@ func (a *Agent) Run(ctx context.Context) error {
 		if !inToolCall && len(chunks) > 0 {
 			fmt.Print("\n")
 
-			content := strings.Join(chunks, " ")
+			content := strings.Join(chunks, "")
 			content = strings.TrimLeft(content, "\n")
 
 			if content != "" {
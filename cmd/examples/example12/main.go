@@ -0,0 +1,110 @@
+// This example shows you how to use stop sequences to constrain what the model
+// generates. A stop sequence ends the generation as soon as the model produces
+// it, which is a cheap way to limit the size and shape of a response without
+// relying on the model following instructions.
+//
+// # Running the example:
+//
+//	$ make example12
+//
+// # This requires running the following commands:
+//
+//	$ make ollama-up  // This starts the Ollama service.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+const (
+	url   = "http://localhost:11434/v1/chat/completions"
+	model = "gpt-oss:latest"
+)
+
+// =============================================================================
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	logger := func(ctx context.Context, msg string, v ...any) {
+		s := fmt.Sprintf("msg: %s", msg)
+		for i := 0; i < len(v); i = i + 2 {
+			s = s + fmt.Sprintf(", %s: %v", v[i], v[i+1])
+		}
+		log.Println(s)
+	}
+
+	sseClient := client.NewSSE[client.ChatSSE](logger)
+
+	// -------------------------------------------------------------------------
+	// Ask for a long numbered list but stop the generation when the model
+	// starts the 4th item. We only pay for the first 3 items.
+
+	question := "List 10 Go proverbs as a numbered list, one per line, with no introduction."
+
+	if err := ask(ctx, sseClient, question, []string{"\n4."}); err != nil {
+		return err
+	}
+
+	// -------------------------------------------------------------------------
+	// Ask for code and stop at the closing fence so the model can't add a
+	// long explanation after the code.
+
+	question = "Write a Go function that reverses a string. Answer with a single fenced go code block and then explain it."
+
+	if err := ask(ctx, sseClient, question, []string{"```\n\n", "```\nThis"}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func ask(ctx context.Context, sseClient *client.SSEClient[client.ChatSSE], question string, stop []string) error {
+	fmt.Printf("\n\u001b[94mQuestion\u001b[0m: %s\n\u001b[90mStop: %q\u001b[0m\n\n", question, stop)
+
+	conversation := []client.D{
+		client.User(question),
+	}
+
+	d := client.ChatRequest(model, conversation,
+		client.WithStream(true),
+		client.WithTemperature(0.1),
+		client.WithStop(stop...),
+	)
+
+	ch := make(chan client.ChatSSE, 100)
+	if err := sseClient.Do(ctx, http.MethodPost, url, d, ch); err != nil {
+		return fmt.Errorf("do: %w", err)
+	}
+
+	var b strings.Builder
+	for resp := range ch {
+		if len(resp.Choices) == 0 {
+			continue
+		}
+
+		b.WriteString(resp.Choices[0].Delta.Content)
+	}
+
+	// Some providers include the stop sequence in the response so we need to
+	// remove it ourselves.
+	content := client.TrimStop(b.String(), stop)
+
+	fmt.Printf("%s\n\n\u001b[90m(%d characters)\u001b[0m\n", strings.TrimSpace(content), len(content))
+
+	return nil
+}
@@ -0,0 +1,384 @@
+// This example shows you how to build a text-to-SQL pipeline that combines
+// RAG with tool execution. The table and column descriptions are embedded so
+// only the schema relevant to the question is given to the model. The model
+// generates the SQL, the SQL is executed in a read only transaction, and then
+// the model verifies the result answers the question. If it doesn't, the
+// model gets the feedback and tries again.
+//
+// # Running the example:
+//
+//	$ make example13
+//
+// # This requires running the following commands:
+//
+//	$ make compose-up // This starts Postgres and OpenWebUI in docker compose.
+//	$ make ollama-up  // This starts the Ollama service.
+//	$ make example08  // This creates and loads the garage sale database.
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/sqldb"
+	"github.com/ardanlabs/ai-training/foundation/vector"
+	"github.com/jmoiron/sqlx"
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+const (
+	url         = "http://localhost:11434/v1/chat/completions"
+	ollamaURL   = "http://localhost:11434"
+	model       = "gpt-oss:latest"
+	embedModel  = "bge-m3:latest"
+	topTables   = 2
+	maxAttempts = 3
+)
+
+// schemaDoc describes a table in plain language so it can be embedded and
+// retrieved for a question.
+type schemaDoc struct {
+	Table       string
+	Description string
+	DDL         string
+	Embedding   []float32
+}
+
+// Vector implements the vector.Data interface.
+func (sd schemaDoc) Vector() []float32 {
+	return sd.Embedding
+}
+
+// question represents the question being asked so it can be compared with
+// the schema documents.
+type question struct {
+	Embedding []float32
+}
+
+// Vector implements the vector.Data interface.
+func (q question) Vector() []float32 {
+	return q.Embedding
+}
+
+var schemaDocs = []schemaDoc{
+	{
+		Table:       "users",
+		Description: "People who use the garage sale system. Each user has a name, an email, roles like admin or user, an optional department, and can be enabled or disabled. Users own products and homes.",
+		DDL: `CREATE TABLE users (
+	user_id       UUID        NOT NULL, -- primary key
+	name          TEXT        NOT NULL, -- full name of the person
+	email         TEXT UNIQUE NOT NULL,
+	roles         TEXT[]      NOT NULL, -- admin, user
+	password_hash TEXT        NOT NULL,
+	department    TEXT        NULL,
+	enabled       BOOLEAN     NOT NULL,
+	date_created  TIMESTAMP   NOT NULL,
+	date_updated  TIMESTAMP   NOT NULL
+);`,
+	},
+	{
+		Table:       "products",
+		Description: "Items that users are selling at their garage sale. Each product has a name, a cost or price, and a quantity in stock. Products belong to the user selling them.",
+		DDL: `CREATE TABLE products (
+	product_id   UUID           NOT NULL, -- primary key
+	user_id      UUID           NOT NULL, -- joins with users.user_id, the seller
+	name         TEXT           NOT NULL,
+	cost         NUMERIC(10, 2) NOT NULL, -- price of a single item
+	quantity     INT            NOT NULL, -- number of items in stock
+	date_created TIMESTAMP      NOT NULL,
+	date_updated TIMESTAMP      NOT NULL
+);`,
+	},
+	{
+		Table:       "homes",
+		Description: "Addresses of the homes where users hold their garage sales, including the type of home, street address, city, state, zip code, and country.",
+		DDL: `CREATE TABLE homes (
+	home_id      UUID      NOT NULL, -- primary key
+	type         TEXT      NOT NULL, -- single or condo
+	user_id      UUID      NOT NULL, -- joins with users.user_id, the owner
+	address_1    TEXT      NOT NULL,
+	address_2    TEXT      NULL,
+	zip_code     TEXT      NOT NULL,
+	city         TEXT      NOT NULL,
+	state        TEXT      NOT NULL,
+	country      TEXT      NOT NULL,
+	date_created TIMESTAMP NOT NULL,
+	date_updated TIMESTAMP NOT NULL
+);`,
+	},
+}
+
+// =============================================================================
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	db, err := sqldb.Open(sqldb.Config{
+		User:       "postgres",
+		Password:   "postgres",
+		Host:       "localhost:5432",
+		Name:       "postgres",
+		DisableTLS: true,
+	})
+	if err != nil {
+		return fmt.Errorf("connecting to db: %w", err)
+	}
+	defer db.Close()
+
+	if err := sqldb.StatusCheck(ctx, db); err != nil {
+		return fmt.Errorf("status check database: %w", err)
+	}
+
+	llmEmbed, err := ollama.New(
+		ollama.WithModel(embedModel),
+		ollama.WithServerURL(ollamaURL),
+	)
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	cln := client.New(func(ctx context.Context, msg string, v ...any) {
+		log.Println(msg, v)
+	})
+
+	// -------------------------------------------------------------------------
+	// Embed the schema descriptions.
+
+	fmt.Println("\nEmbedding the schema descriptions")
+
+	var texts []string
+	for _, doc := range schemaDocs {
+		texts = append(texts, fmt.Sprintf("Table %s: %s", doc.Table, doc.Description))
+	}
+
+	vectors, err := llmEmbed.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("create embedding: %w", err)
+	}
+
+	for i := range schemaDocs {
+		schemaDocs[i].Embedding = vectors[i]
+	}
+
+	// -------------------------------------------------------------------------
+	// Ask the question.
+
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Print("\nAsk a question about the garage sale system: ")
+
+	input, _ := reader.ReadString('\n')
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil
+	}
+
+	// -------------------------------------------------------------------------
+	// Retrieve the schema relevant to the question.
+
+	vectors, err = llmEmbed.CreateEmbedding(ctx, []string{input})
+	if err != nil {
+		return fmt.Errorf("create embedding: %w", err)
+	}
+
+	docs := retrieveSchema(question{Embedding: vectors[0]})
+
+	fmt.Println("\nSCHEMA:")
+	fmt.Print("-----------------------------------------------\n\n")
+	for _, doc := range docs {
+		fmt.Println(doc.Table)
+	}
+
+	// -------------------------------------------------------------------------
+	// Generate, execute, and verify the SQL until the result answers the
+	// question or we run out of attempts.
+
+	var feedback string
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		query, err := generateSQL(ctx, cln, input, docs, feedback)
+		if err != nil {
+			return fmt.Errorf("generateSQL: %w", err)
+		}
+
+		fmt.Printf("\nQUERY (attempt %d):\n", attempt)
+		fmt.Print("-----------------------------------------------\n\n")
+		fmt.Println(query)
+
+		data, err := execQuery(ctx, db, query)
+		if err != nil {
+			fmt.Printf("\n\u001b[91mERROR: %s\u001b[0m\n", err)
+			feedback = fmt.Sprintf("The previous query:\n%s\nfailed with this error: %s", query, err)
+			continue
+		}
+
+		fmt.Printf("\nROWS: %d\n", len(data))
+
+		v, err := verify(ctx, cln, input, query, data)
+		if err != nil {
+			return fmt.Errorf("verify: %w", err)
+		}
+
+		if !v.Answers {
+			fmt.Printf("\n\u001b[93mNOT VERIFIED: %s\u001b[0m\n", v.Reason)
+			feedback = fmt.Sprintf("The previous query:\n%s\ndid not answer the question: %s", query, v.Reason)
+			continue
+		}
+
+		fmt.Println("\nANSWER:")
+		fmt.Print("-----------------------------------------------\n\n")
+		fmt.Println(v.Answer)
+		fmt.Print("\n")
+
+		return nil
+	}
+
+	return fmt.Errorf("no verified answer after %d attempts", maxAttempts)
+}
+
+// retrieveSchema returns the schema documents most similar to the question.
+func retrieveSchema(q question) []schemaDoc {
+	var data []vector.Data
+	for _, doc := range schemaDocs {
+		data = append(data, doc)
+	}
+
+	results := vector.Similarity(q, data...)
+	slices.SortFunc(results, func(a, b vector.SimilarityResult) int {
+		switch {
+		case a.Similarity > b.Similarity:
+			return -1
+		case a.Similarity < b.Similarity:
+			return 1
+		}
+		return 0
+	})
+
+	var docs []schemaDoc
+	for _, r := range results[:min(topTables, len(results))] {
+		docs = append(docs, r.DataPoint.(schemaDoc))
+	}
+
+	return docs
+}
+
+// generateSQL asks the model to write a query using only the retrieved
+// schema. Feedback from a previous attempt is included when it exists.
+func generateSQL(ctx context.Context, cln *client.Client, input string, docs []schemaDoc, feedback string) (string, error) {
+	var schema strings.Builder
+	for _, doc := range docs {
+		fmt.Fprintf(&schema, "-- %s\n%s\n\n", doc.Description, doc.DDL)
+	}
+
+	prompt := fmt.Sprintf(`Convert the question into a single Postgres SELECT statement
+using only this schema:
+
+%s
+Use table names to prevent ambiguity. Answer with the SQL only, no explanation.
+
+%s
+
+Question: %s`, schema.String(), feedback, input)
+
+	return chat(ctx, cln, prompt)
+}
+
+// execQuery runs the query in a read only transaction.
+func execQuery(ctx context.Context, db *sqlx.DB, query string) ([]map[string]any, error) {
+	tx, err := db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	data := []map[string]any{}
+	if err := sqldb.QueryMap(ctx, tx, query, &data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// verification represents the model's judgement of a query result.
+type verification struct {
+	Answers bool   `json:"answers_question"`
+	Reason  string `json:"reason"`
+	Answer  string `json:"answer"`
+}
+
+// verify asks the model if the result answers the question.
+func verify(ctx context.Context, cln *client.Client, input string, query string, data []map[string]any) (verification, error) {
+	rows, err := json.Marshal(data)
+	if err != nil {
+		return verification{}, fmt.Errorf("marshal: %w", err)
+	}
+
+	prompt := fmt.Sprintf(`A SQL query was run to answer a question. Decide if the
+result answers the question.
+
+Question: %s
+
+Query:
+%s
+
+Result as JSON:
+%s
+
+Respond with a JSON document only, with these fields:
+{"answers_question": true or false, "reason": "why or why not", "answer": "the answer to the question in plain English"}`, input, query, rows)
+
+	content, err := chat(ctx, cln, prompt)
+	if err != nil {
+		return verification{}, err
+	}
+
+	var v verification
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return verification{}, fmt.Errorf("decode verification %q: %w", content, err)
+	}
+
+	return v, nil
+}
+
+// chat sends a single prompt to the model and returns the answer with any
+// markdown code fences removed.
+func chat(ctx context.Context, cln *client.Client, prompt string) (string, error) {
+	d := client.ChatRequest(model, []client.D{
+		client.User(prompt),
+	},
+		client.WithTemperature(0.0),
+		client.WithStream(false),
+	)
+
+	var resp client.Chat
+	if err := cln.Do(ctx, http.MethodPost, url, d, &resp); err != nil {
+		return "", fmt.Errorf("do: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from the model")
+	}
+
+	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+	content = strings.TrimPrefix(content, "```sql")
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	return strings.TrimSpace(content), nil
+}
@@ -0,0 +1,411 @@
+// This example shows you how to combine a knowledge graph with RAG to answer
+// questions that need several hops, like "who do I escalate to when the
+// database behind checkout's transactions goes down?". The model extracts
+// the entities and relations from the documents into a graph. For a question
+// the graph is walked from the entities it mentions, and the facts that are
+// found are given to the model with the most similar chunks of the documents
+// those facts came from.
+//
+// The graph is kept in memory and saved to zarf/data so the extraction only
+// runs once, delete the file to extract it again. Set NEO4J_URL, NEO4J_USER
+// and NEO4J_PASSWORD to store the graph in Neo4j instead.
+//
+// # Running the example:
+//
+//	$ make example14
+//
+// # This requires running the following commands:
+//
+//	$ make ollama-up  // This starts the Ollama service.
+//
+// # Questions to try:
+//
+//	Who should be paged when the database the ledger uses fails?
+//	Which teams were affected by INC-42 and who leads them?
+//	What does checkout depend on, directly or not?
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/graph"
+	"github.com/ardanlabs/ai-training/foundation/vector"
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+const (
+	url        = "http://localhost:11434/v1/chat/completions"
+	ollamaURL  = "http://localhost:11434"
+	model      = "gpt-oss:latest"
+	embedModel = "bge-m3:latest"
+	graphFile  = "zarf/data/example14.graph.json"
+	topSeeds   = 3
+	hops       = 2
+	topChunks  = 3
+)
+
+//go:embed docs/*.md
+var docs embed.FS
+
+// chunk represents a paragraph of a document.
+type chunk struct {
+	Source    string
+	Text      string
+	Embedding []float32
+}
+
+// Vector implements the vector.Data interface.
+func (c chunk) Vector() []float32 {
+	return c.Embedding
+}
+
+// question represents the question being asked so it can be compared with
+// the entities and chunks.
+type question struct {
+	Embedding []float32
+}
+
+// Vector implements the vector.Data interface.
+func (q question) Vector() []float32 {
+	return q.Embedding
+}
+
+// =============================================================================
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	llmEmbed, err := ollama.New(
+		ollama.WithModel(embedModel),
+		ollama.WithServerURL(ollamaURL),
+	)
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	cln := client.New(func(ctx context.Context, msg string, v ...any) {
+		log.Println(msg, v)
+	})
+
+	// -------------------------------------------------------------------------
+	// Read the documents and embed their paragraphs.
+
+	fmt.Println("\nEmbedding the documents")
+
+	files, err := fs.Glob(docs, "docs/*.md")
+	if err != nil {
+		return fmt.Errorf("glob: %w", err)
+	}
+
+	documents := make(map[string]string)
+	var chunks []chunk
+
+	for _, file := range files {
+		data, err := docs.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+
+		source := path.Base(file)
+		documents[source] = string(data)
+
+		for paragraph := range strings.SplitSeq(string(data), "\n\n") {
+			paragraph = strings.TrimSpace(paragraph)
+			if paragraph == "" || strings.HasPrefix(paragraph, "#") {
+				continue
+			}
+			chunks = append(chunks, chunk{Source: source, Text: paragraph})
+		}
+	}
+
+	var texts []string
+	for _, c := range chunks {
+		texts = append(texts, c.Text)
+	}
+
+	vectors, err := llmEmbed.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return fmt.Errorf("create embedding: %w", err)
+	}
+
+	for i := range chunks {
+		chunks[i].Embedding = vectors[i]
+	}
+
+	// -------------------------------------------------------------------------
+	// Build the knowledge graph.
+
+	store, err := buildGraph(ctx, cln, llmEmbed, documents)
+	if err != nil {
+		return fmt.Errorf("build graph: %w", err)
+	}
+
+	entities, err := store.Entities(ctx)
+	if err != nil {
+		return fmt.Errorf("entities: %w", err)
+	}
+
+	fmt.Printf("\nThe graph has %d entities\n", len(entities))
+
+	// -------------------------------------------------------------------------
+	// Answer the questions.
+
+	reader := bufio.NewReader(os.Stdin)
+
+	for {
+		fmt.Print("\nAsk a question about the company (empty to quit): ")
+
+		input, _ := reader.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input == "" {
+			return nil
+		}
+
+		vectors, err := llmEmbed.CreateEmbedding(ctx, []string{input})
+		if err != nil {
+			return fmt.Errorf("create embedding: %w", err)
+		}
+		q := question{Embedding: vectors[0]}
+
+		// ---------------------------------------------------------------------
+		// Walk the graph from the entities the question is about.
+
+		seeds := graph.Seeds(entities, input, q, topSeeds)
+
+		sg, err := store.Traverse(ctx, seeds, hops)
+		if err != nil {
+			return fmt.Errorf("traverse: %w", err)
+		}
+
+		fmt.Println("\nSEEDS:", strings.Join(seeds, ", "))
+		fmt.Println("\nFACTS:")
+		fmt.Print("-----------------------------------------------\n\n")
+		for _, r := range sg.Relations {
+			fmt.Println(r)
+		}
+
+		// ---------------------------------------------------------------------
+		// Retrieve the chunks from the documents the facts came from.
+
+		passages := retrieveChunks(q, chunks, sg.Sources())
+
+		fmt.Println("\nCHUNKS:")
+		fmt.Print("-----------------------------------------------\n\n")
+		for _, c := range passages {
+			fmt.Printf("[%s] %s\n\n", c.Source, firstLine(c.Text))
+		}
+
+		// ---------------------------------------------------------------------
+		// Answer with the facts and the chunks.
+
+		answer, err := answerQuestion(ctx, cln, input, sg, passages)
+		if err != nil {
+			return fmt.Errorf("answer: %w", err)
+		}
+
+		fmt.Println("ANSWER:")
+		fmt.Print("-----------------------------------------------\n\n")
+		fmt.Println(answer)
+	}
+}
+
+// buildGraph returns the graph store with the entities and relations of the
+// documents. The graph saved by a previous run is used when there is one.
+func buildGraph(ctx context.Context, cln *client.Client, llmEmbed *ollama.LLM, documents map[string]string) (graph.Store, error) {
+	var store graph.Store
+	var memory *graph.Memory
+
+	switch neo4jURL := os.Getenv("NEO4J_URL"); neo4jURL {
+	case "":
+		m, err := graph.LoadMemory(graphFile)
+		switch {
+		case err == nil:
+			fmt.Println("\nUsing the graph saved in", graphFile)
+			return m, nil
+
+		case !errors.Is(err, os.ErrNotExist):
+			return nil, fmt.Errorf("load: %w", err)
+		}
+
+		memory = graph.NewMemory()
+		store = memory
+
+	default:
+		db := cmp.Or(os.Getenv("NEO4J_DATABASE"), "neo4j")
+		neo := graph.NewNeo4j(neo4jURL, db, os.Getenv("NEO4J_USER"), os.Getenv("NEO4J_PASSWORD"))
+
+		entities, err := neo.Entities(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("neo4j: %w", err)
+		}
+
+		if len(entities) > 0 {
+			fmt.Println("\nUsing the graph stored in Neo4j")
+			return neo, nil
+		}
+
+		store = neo
+	}
+
+	// -------------------------------------------------------------------------
+	// Extract the entities and relations from every document.
+
+	extractor := graph.NewExtractor(cln, url, model)
+
+	var entities []graph.Entity
+	var relations []graph.Relation
+
+	for _, source := range slices.Sorted(maps.Keys(documents)) {
+		fmt.Println("\nExtracting the graph from", source)
+
+		e, r, err := extractor.Extract(ctx, source, documents[source])
+		if err != nil {
+			return nil, fmt.Errorf("extract %s: %w", source, err)
+		}
+
+		for _, relation := range r {
+			fmt.Println(relation)
+		}
+
+		entities = append(entities, e...)
+		relations = append(relations, r...)
+	}
+
+	// -------------------------------------------------------------------------
+	// Embed the entities so questions that don't name them still find them.
+
+	var texts []string
+	for _, e := range entities {
+		texts = append(texts, fmt.Sprintf("%s (%s): %s", e.Name, e.Type, e.Description))
+	}
+
+	vectors, err := llmEmbed.CreateEmbedding(ctx, texts)
+	if err != nil {
+		return nil, fmt.Errorf("create embedding: %w", err)
+	}
+
+	for i := range entities {
+		entities[i].Embedding = vectors[i]
+	}
+
+	if err := store.Add(ctx, entities, relations); err != nil {
+		return nil, fmt.Errorf("add: %w", err)
+	}
+
+	if memory != nil {
+		if err := memory.Save(graphFile); err != nil {
+			return nil, fmt.Errorf("save: %w", err)
+		}
+	}
+
+	return store, nil
+}
+
+// retrieveChunks returns the chunks most similar to the question. The chunks
+// of the documents the graph facts came from are preferred, the others are
+// only used when the traversal found nothing.
+func retrieveChunks(q question, chunks []chunk, sources []string) []chunk {
+	var data []vector.Data
+	for _, c := range chunks {
+		if len(sources) == 0 || slices.Contains(sources, c.Source) {
+			data = append(data, c)
+		}
+	}
+
+	results := vector.Similarity(q, data...)
+	slices.SortFunc(results, func(a, b vector.SimilarityResult) int {
+		switch {
+		case a.Similarity > b.Similarity:
+			return -1
+		case a.Similarity < b.Similarity:
+			return 1
+		}
+		return 0
+	})
+
+	var found []chunk
+	for _, r := range results[:min(topChunks, len(results))] {
+		found = append(found, r.DataPoint.(chunk))
+	}
+
+	return found
+}
+
+// answerQuestion asks the model to answer the question using the facts from
+// the graph and the chunks of the documents.
+func answerQuestion(ctx context.Context, cln *client.Client, input string, sg graph.Subgraph, chunks []chunk) (string, error) {
+	var passages strings.Builder
+	for _, c := range chunks {
+		fmt.Fprintf(&passages, "[%s]\n%s\n\n", c.Source, c.Text)
+	}
+
+	prompt := fmt.Sprintf(`Answer the question using only the facts from the knowledge
+graph and the passages from the documents below. Follow the relations from
+one entity to the next when the answer needs several steps, and explain the
+steps you followed. If the answer isn't there, say you don't know.
+
+Knowledge graph facts:
+
+%s
+Passages:
+
+%s
+Question: %s`, sg.Facts(), passages.String(), input)
+
+	return chat(ctx, cln, prompt)
+}
+
+// chat sends a single prompt to the model and returns the answer with any
+// markdown code fences removed.
+func chat(ctx context.Context, cln *client.Client, prompt string) (string, error) {
+	d := client.ChatRequest(model, []client.D{
+		client.User(prompt),
+	},
+		client.WithTemperature(0.0),
+		client.WithStream(false),
+	)
+
+	var resp client.Chat
+	if err := cln.Do(ctx, http.MethodPost, url, d, &resp); err != nil {
+		return "", fmt.Errorf("do: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no response from the model")
+	}
+
+	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	return strings.TrimSpace(content), nil
+}
+
+// firstLine returns the first line of the text so the chunks can be listed
+// compactly.
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line + " ..."
+}
@@ -0,0 +1,132 @@
+// This program is a small CLI client for the agent's gRPC API. It creates a
+// session and lets you chat with the agent from the terminal. Use the events
+// flag to follow the tool calls of an existing session instead.
+//
+// # Running the example:
+//
+//	$ go run cmd/examples/example10/step5/*.go -grpc localhost:9090
+//	$ go run cmd/tools/agentctl/main.go -host localhost:9090
+//	$ go run cmd/tools/agentctl/main.go -host localhost:9090 -events <session_id>
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	agentv1 "github.com/ardanlabs/ai-training/api/agent/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	host := flag.String("host", "localhost:9090", "host:port of the agent gRPC service")
+	events := flag.String("events", "", "follow the tool events of the specified session")
+	flag.Parse()
+
+	conn, err := grpc.NewClient(*host, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer conn.Close()
+
+	cln := agentv1.NewAgentServiceClient(conn)
+	ctx := context.Background()
+
+	if *events != "" {
+		return followToolEvents(ctx, cln, *events)
+	}
+
+	// -------------------------------------------------------------------------
+	// Create a session and chat with the agent until the user quits.
+
+	sess, err := cln.CreateSession(ctx, &agentv1.CreateSessionRequest{})
+	if err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	defer cln.CloseSession(ctx, &agentv1.CloseSessionRequest{SessionId: sess.GetSessionId()})
+
+	fmt.Printf("\nSession %s (use 'ctrl-d' to quit)\n", sess.GetSessionId())
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("\u001b[94m\nYou\u001b[0m: ")
+		if !scanner.Scan() {
+			return nil
+		}
+
+		if err := chat(ctx, cln, sess.GetSessionId(), scanner.Text()); err != nil {
+			fmt.Printf("\n\u001b[91mERROR:%s\u001b[0m\n", err)
+		}
+	}
+}
+
+func chat(ctx context.Context, cln agentv1.AgentServiceClient, sessionID string, content string) error {
+	stream, err := cln.Chat(ctx, &agentv1.ChatRequest{
+		SessionId: sessionID,
+		Content:   content,
+	})
+	if err != nil {
+		return err
+	}
+
+	for {
+		evt, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		switch e := evt.GetEvent().(type) {
+		case *agentv1.ChatEvent_Reasoning:
+			fmt.Printf("\u001b[91m%s\u001b[0m", e.Reasoning)
+
+		case *agentv1.ChatEvent_Content:
+			fmt.Print(e.Content)
+
+		case *agentv1.ChatEvent_ToolCall:
+			fmt.Printf("\n\u001b[92m%s(%s)\u001b[0m\n", e.ToolCall.GetName(), e.ToolCall.GetArguments())
+
+		case *agentv1.ChatEvent_Info:
+			fmt.Printf("\n\u001b[90m%s\u001b[0m", e.Info)
+
+		case *agentv1.ChatEvent_Error:
+			fmt.Printf("\n\u001b[91mERROR:%s\u001b[0m", e.Error)
+
+		case *agentv1.ChatEvent_Done:
+			fmt.Print("\n")
+		}
+	}
+}
+
+func followToolEvents(ctx context.Context, cln agentv1.AgentServiceClient, sessionID string) error {
+	stream, err := cln.StreamToolEvents(ctx, &agentv1.StreamToolEventsRequest{SessionId: sessionID})
+	if err != nil {
+		return err
+	}
+
+	for {
+		evt, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		fmt.Printf("\u001b[92m%s(%s)\u001b[0m\n%s\n\n", evt.GetName(), evt.GetArguments(), evt.GetResult())
+	}
+}
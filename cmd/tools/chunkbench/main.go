@@ -0,0 +1,473 @@
+// This program compares chunking strategies for RAG. The corpus is chunked
+// with every strategy, the chunks are embedded, and the questions of an eval
+// set are run against each index. A retrieved chunk is relevant when it holds
+// most of the passage that answers the question, which gives the recall and
+// precision of the top k for every strategy.
+//
+// The strategies are:
+//
+//	fixed:    chunks of a fixed number of bytes that overlap, cut at spaces.
+//	sentence: whole sentences packed into chunks up to the size.
+//	semantic: sentences grouped until the meaning changes, which is detected
+//	          by a drop in the similarity of the embeddings of neighboring
+//	          sentences.
+//
+// The semantic strategy embeds every sentence of the corpus, which takes a
+// few minutes for the book in zarf/data.
+//
+// # Running the example:
+//
+//	$ make chunkbench
+//	$ go run cmd/tools/chunkbench/main.go -size 500 -overlap 100 -k 3
+//	$ go run cmd/tools/chunkbench/main.go -corpus notes.txt -eval notes.json -strategies fixed,sentence
+//
+// # This requires running the following commands:
+//
+//	$ make ollama-up  // This starts the Ollama service.
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/ardanlabs/ai-training/foundation/vector"
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+const (
+	ollamaURL  = "http://localhost:11434"
+	embedModel = "bge-m3:latest"
+	batchSize  = 64
+)
+
+// defaultEval holds questions about the book in zarf/data.
+//
+//go:embed eval.json
+var defaultEval []byte
+
+// evalCase represents a question and the passage of the corpus that answers
+// it.
+type evalCase struct {
+	Question string `json:"question"`
+	Evidence string `json:"evidence"`
+}
+
+// chunk represents a piece of the corpus, start and end are the byte offsets
+// of the text in the corpus.
+type chunk struct {
+	start     int
+	end       int
+	text      string
+	embedding []float32
+}
+
+// Vector implements the vector.Data interface.
+func (c chunk) Vector() []float32 {
+	return c.embedding
+}
+
+// question represents a question so it can be compared with the chunks.
+type question struct {
+	embedding []float32
+}
+
+// Vector implements the vector.Data interface.
+func (q question) Vector() []float32 {
+	return q.embedding
+}
+
+// =============================================================================
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	corpusFile := flag.String("corpus", "zarf/data/book.txt", "text file to chunk")
+	evalFile := flag.String("eval", "", "JSON file with the questions and evidence, the default asks about the book")
+	strategies := flag.String("strategies", "fixed,sentence,semantic", "comma separated list of strategies to compare")
+	size := flag.Int("size", 1000, "maximum size of a chunk in bytes")
+	overlap := flag.Int("overlap", 200, "bytes shared by neighboring fixed size chunks")
+	percentile := flag.Float64("percentile", 90, "semantic chunks break where the distance between sentences is above this percentile")
+	k := flag.Int("k", 5, "number of chunks retrieved for a question")
+	flag.Parse()
+
+	if *size < 1 || *k < 1 || *overlap < 0 || *overlap >= *size {
+		return fmt.Errorf("size and k must be positive and overlap must be less than size")
+	}
+
+	if *percentile <= 0 || *percentile >= 100 {
+		return fmt.Errorf("percentile must be between 0 and 100")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+
+	llmEmbed, err := ollama.New(
+		ollama.WithModel(embedModel),
+		ollama.WithServerURL(ollamaURL),
+	)
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// Load the corpus and the eval set. The whitespace is normalized so the
+	// evidence is found regardless of how the corpus wraps its lines.
+
+	data, err := os.ReadFile(*corpusFile)
+	if err != nil {
+		return fmt.Errorf("read corpus: %w", err)
+	}
+	corpus := normalize(string(data))
+
+	evalData := defaultEval
+	if *evalFile != "" {
+		if evalData, err = os.ReadFile(*evalFile); err != nil {
+			return fmt.Errorf("read eval: %w", err)
+		}
+	}
+
+	var cases []evalCase
+	if err := json.Unmarshal(evalData, &cases); err != nil {
+		return fmt.Errorf("unmarshal eval: %w", err)
+	}
+
+	if len(cases) == 0 {
+		return fmt.Errorf("the eval set has no questions")
+	}
+
+	spans := make([][2]int, len(cases))
+	for i, c := range cases {
+		evidence := normalize(c.Evidence)
+
+		start := strings.Index(corpus, evidence)
+		if evidence == "" || start == -1 {
+			return fmt.Errorf("the evidence for %q is not in the corpus", c.Question)
+		}
+		spans[i] = [2]int{start, start + len(evidence)}
+	}
+
+	texts := make([]string, len(cases))
+	for i, c := range cases {
+		texts[i] = c.Question
+	}
+
+	vectors, err := embed(ctx, llmEmbed, texts)
+	if err != nil {
+		return fmt.Errorf("embed questions: %w", err)
+	}
+
+	questions := make([]question, len(cases))
+	for i := range cases {
+		questions[i] = question{embedding: vectors[i]}
+	}
+
+	fmt.Printf("corpus: %d bytes, questions: %d, size=%d, overlap=%d, k=%d\n", len(corpus), len(cases), *size, *overlap, *k)
+
+	// -------------------------------------------------------------------------
+	// Chunk, embed and evaluate every strategy.
+
+	type result struct {
+		name      string
+		chunks    int
+		avgSize   int
+		recall    float64
+		precision float64
+		mrr       float64
+		took      time.Duration
+	}
+
+	var results []result
+
+	for name := range strings.SplitSeq(*strategies, ",") {
+		name = strings.TrimSpace(name)
+		start := time.Now()
+
+		fmt.Printf("\nchunking with the %s strategy\n", name)
+
+		var chunks []chunk
+		switch name {
+		case "fixed":
+			chunks = fixedChunks(corpus, *size, *overlap)
+
+		case "sentence":
+			chunks = sentenceChunks(corpus, sentences(corpus), *size)
+
+		case "semantic":
+			chunks, err = semanticChunks(ctx, llmEmbed, corpus, *size, *percentile)
+			if err != nil {
+				return fmt.Errorf("semantic: %w", err)
+			}
+
+		default:
+			return fmt.Errorf("unknown strategy %q, use fixed, sentence or semantic", name)
+		}
+
+		fmt.Printf("embedding %d chunks\n", len(chunks))
+
+		texts := make([]string, len(chunks))
+		for i, c := range chunks {
+			texts[i] = c.text
+		}
+
+		vectors, err := embed(ctx, llmEmbed, texts)
+		if err != nil {
+			return fmt.Errorf("embed %s chunks: %w", name, err)
+		}
+
+		dataPoints := make([]vector.Data, len(chunks))
+		for i := range chunks {
+			chunks[i].embedding = vectors[i]
+			dataPoints[i] = chunks[i]
+		}
+
+		// ---------------------------------------------------------------------
+		// Recall is the share of questions with a relevant chunk in the top
+		// k, precision the share of the top k that is relevant and MRR the
+		// mean of 1/rank of the first relevant chunk.
+
+		r := result{
+			name:   name,
+			chunks: len(chunks),
+		}
+
+		for i, q := range questions {
+			found := vector.SearchParallel(q, dataPoints, *k, 0)
+
+			var relevant int
+			for rank, sr := range found {
+				if !isRelevant(sr.DataPoint.(chunk), spans[i]) {
+					continue
+				}
+
+				if relevant == 0 {
+					r.mrr += 1 / float64(rank+1)
+				}
+				relevant++
+			}
+
+			if relevant > 0 {
+				r.recall++
+			}
+			r.precision += float64(relevant) / float64(*k)
+		}
+
+		var total int
+		for _, c := range chunks {
+			total += len(c.text)
+		}
+
+		r.avgSize = total / max(len(chunks), 1)
+		r.recall /= float64(len(cases))
+		r.precision /= float64(len(cases))
+		r.mrr /= float64(len(cases))
+		r.took = time.Since(start)
+
+		results = append(results, r)
+	}
+
+	// -------------------------------------------------------------------------
+	// Report the results.
+
+	fmt.Printf("\n%-10s %8s %8s %10s %10s %8s %10s\n", "strategy", "chunks", "avg", "recall@k", "prec@k", "mrr", "took")
+	for _, r := range results {
+		fmt.Printf("%-10s %8d %8d %10.2f %10.2f %8.2f %10s\n", r.name, r.chunks, r.avgSize, r.recall, r.precision, r.mrr, r.took.Round(time.Second))
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// fixedChunks cuts the text into chunks of up to size bytes, every chunk
+// starts overlap bytes before the end of the previous one. Cuts are moved
+// back to a space so words aren't split.
+func fixedChunks(text string, size int, overlap int) []chunk {
+	var chunks []chunk
+
+	for start := 0; start < len(text); {
+		end := min(start+size, len(text))
+		if end < len(text) {
+			if i := strings.LastIndexByte(text[start:end], ' '); i > 0 {
+				end = start + i
+			}
+		}
+
+		chunks = append(chunks, newChunk(text, start, end))
+		if end == len(text) {
+			break
+		}
+
+		// Start the next chunk at a word that is inside the overlap, making
+		// sure to always move forward.
+		next := max(end-overlap, start+1)
+		if i := strings.IndexByte(text[next:end], ' '); i >= 0 && overlap > 0 {
+			next += i + 1
+		} else {
+			next = end
+		}
+		start = next
+
+		for start < len(text) && text[start] == ' ' {
+			start++
+		}
+	}
+
+	return chunks
+}
+
+// sentenceChunks packs whole sentences into chunks of up to size bytes. A
+// sentence longer than the size becomes a chunk of its own.
+func sentenceChunks(text string, sentences [][2]int, size int) []chunk {
+	var chunks []chunk
+
+	start := -1
+	var end int
+	for _, s := range sentences {
+		if start != -1 && s[1]-start > size {
+			chunks = append(chunks, newChunk(text, start, end))
+			start = -1
+		}
+
+		if start == -1 {
+			start = s[0]
+		}
+		end = s[1]
+	}
+
+	if start != -1 {
+		chunks = append(chunks, newChunk(text, start, end))
+	}
+
+	return chunks
+}
+
+// semanticChunks groups sentences until the topic changes. Every sentence is
+// embedded and a chunk ends where the distance between a sentence and the
+// next is above the percentile of all the distances, or when the chunk would
+// grow past the size.
+func semanticChunks(ctx context.Context, llmEmbed *ollama.LLM, text string, size int, percentile float64) ([]chunk, error) {
+	spans := sentences(text)
+
+	texts := make([]string, len(spans))
+	for i, s := range spans {
+		texts[i] = text[s[0]:s[1]]
+	}
+
+	fmt.Printf("embedding %d sentences\n", len(texts))
+
+	vectors, err := embed(ctx, llmEmbed, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	distances := make([]float32, max(len(spans)-1, 0))
+	for i := range distances {
+		distances[i] = 1 - vector.CosineSimilarity(vectors[i], vectors[i+1])
+	}
+
+	var threshold float32
+	if len(distances) > 0 {
+		sorted := slices.Sorted(slices.Values(distances))
+		threshold = sorted[min(int(float64(len(sorted))*percentile/100), len(sorted)-1)]
+	}
+
+	var chunks []chunk
+
+	start := -1
+	for i, s := range spans {
+		if start == -1 {
+			start = s[0]
+		}
+
+		last := i == len(spans)-1
+		if last || distances[i] > threshold || spans[i+1][1]-start > size {
+			chunks = append(chunks, newChunk(text, start, s[1]))
+			start = -1
+		}
+	}
+
+	return chunks, nil
+}
+
+// sentences returns the spans of the sentences in the text. A sentence ends
+// at a period, question mark or exclamation mark followed by a space and an
+// uppercase letter, a digit or an opening quote.
+func sentences(text string) [][2]int {
+	var spans [][2]int
+
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '.', '?', '!':
+		default:
+			continue
+		}
+
+		if i+2 >= len(text) || text[i+1] != ' ' {
+			continue
+		}
+
+		next, _ := utf8.DecodeRuneInString(text[i+2:])
+		if !unicode.IsUpper(next) && !unicode.IsDigit(next) && next != '"' && next != '“' {
+			continue
+		}
+
+		spans = append(spans, [2]int{start, i + 1})
+		start = i + 2
+	}
+
+	if start < len(text) {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+
+	return spans
+}
+
+// isRelevant reports if the chunk holds at least half of the evidence.
+func isRelevant(c chunk, evidence [2]int) bool {
+	overlap := min(c.end, evidence[1]) - max(c.start, evidence[0])
+	return overlap*2 >= evidence[1]-evidence[0]
+}
+
+func newChunk(text string, start int, end int) chunk {
+	return chunk{
+		start: start,
+		end:   end,
+		text:  text[start:end],
+	}
+}
+
+// normalize collapses all the whitespace in the text into single spaces.
+func normalize(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// embed embeds the texts in batches so large corpora don't end up in a
+// single request.
+func embed(ctx context.Context, llmEmbed *ollama.LLM, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(texts))
+
+	for batch := range slices.Chunk(texts, batchSize) {
+		v, err := llmEmbed.CreateEmbedding(ctx, batch)
+		if err != nil {
+			return nil, fmt.Errorf("create embedding: %w", err)
+		}
+		vectors = append(vectors, v...)
+	}
+
+	return vectors, nil
+}
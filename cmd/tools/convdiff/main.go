@@ -0,0 +1,250 @@
+// This program compares two saved agent sessions, like a student's run of an
+// exercise against the reference run, and shows where the tool calls and
+// answers diverge. Sessions are saved from the agent with the /save command.
+//
+// # Running the example:
+//
+//	$ go run cmd/tools/convdiff/main.go reference.json student.json
+//	$ go run cmd/tools/convdiff/main.go -full reference.json student.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	full := flag.Bool("full", false, "show the full answers instead of a preview")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: convdiff [-full] <reference.json> <student.json>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ref, err := loadTurns(flag.Arg(0))
+	if err != nil {
+		return fmt.Errorf("reference: %w", err)
+	}
+
+	stu, err := loadTurns(flag.Arg(1))
+	if err != nil {
+		return fmt.Errorf("student: %w", err)
+	}
+
+	var divergentTools, divergentAnswers int
+
+	for i := range max(len(ref), len(stu)) {
+		var r, s turn
+		if i < len(ref) {
+			r = ref[i]
+		}
+		if i < len(stu) {
+			s = stu[i]
+		}
+
+		fmt.Printf("\n\u001b[94m=== Turn %d ===\u001b[0m\n", i+1)
+
+		switch {
+		case r.Prompt == s.Prompt:
+			fmt.Printf("prompt: %s\n", preview(r.Prompt, *full))
+		default:
+			fmt.Printf("\u001b[91m- prompt: %s\u001b[0m\n", preview(r.Prompt, *full))
+			fmt.Printf("\u001b[92m+ prompt: %s\u001b[0m\n", preview(s.Prompt, *full))
+		}
+
+		fmt.Println("tools:")
+		for _, e := range diff(r.Tools, s.Tools) {
+			switch e.op {
+			case '-':
+				divergentTools++
+				fmt.Printf("\u001b[91m  - %s\u001b[0m\n", e.text)
+			case '+':
+				divergentTools++
+				fmt.Printf("\u001b[92m  + %s\u001b[0m\n", e.text)
+			default:
+				fmt.Printf("    %s\n", e.text)
+			}
+		}
+
+		switch {
+		case normalize(r.Answer) == normalize(s.Answer):
+			fmt.Printf("answer: %s\n", preview(r.Answer, *full))
+		default:
+			divergentAnswers++
+			fmt.Printf("\u001b[91m- answer: %s\u001b[0m\n", preview(r.Answer, *full))
+			fmt.Printf("\u001b[92m+ answer: %s\u001b[0m\n", preview(s.Answer, *full))
+		}
+	}
+
+	fmt.Printf("\n\u001b[90mTurns[%d/%d] Divergent Tool Calls[%d] Divergent Answers[%d]\u001b[0m\n",
+		len(ref), len(stu), divergentTools, divergentAnswers)
+
+	return nil
+}
+
+// =============================================================================
+
+// session represents the parts of a saved agent session that are compared.
+type session struct {
+	Conversation []struct {
+		Role       string `json:"role"`
+		Content    string `json:"content"`
+		ToolCallID string `json:"tool_call_id"`
+		ToolName   string `json:"tool_name"`
+	} `json:"conversation"`
+	ToolEvents []struct {
+		ID        string         `json:"id"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"tool_events"`
+}
+
+// turn represents a user prompt and everything the agent did to answer it.
+type turn struct {
+	Prompt string
+	Tools  []string
+	Answer string
+}
+
+// loadTurns reads a saved session and groups the conversation into turns.
+func loadTurns(path string) ([]turn, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sess session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	args := make(map[string]string)
+	for _, evt := range sess.ToolEvents {
+		b, _ := json.Marshal(evt.Arguments)
+		args[evt.ID] = string(b)
+	}
+
+	var turns []turn
+
+	for _, msg := range sess.Conversation {
+		if msg.Role == "user" {
+			turns = append(turns, turn{Prompt: msg.Content})
+			continue
+		}
+
+		// Ignore the system prompt and anything before the first prompt.
+		if len(turns) == 0 {
+			continue
+		}
+
+		t := &turns[len(turns)-1]
+
+		switch msg.Role {
+		case "tool":
+			t.Tools = append(t.Tools, fmt.Sprintf("%s(%s)", msg.ToolName, args[msg.ToolCallID]))
+
+		case "assistant":
+			// The agent records the tool call requests as assistant messages
+			// which are already covered by the tool results.
+			if strings.HasPrefix(msg.Content, "Tool call ") {
+				continue
+			}
+			t.Answer = msg.Content
+		}
+	}
+
+	return turns, nil
+}
+
+// =============================================================================
+
+// edit represents a line in the comparison of two lists of tool calls.
+type edit struct {
+	op   byte
+	text string
+}
+
+// diff compares the tool calls using the longest common subsequence so calls
+// made by both runs line up.
+func diff(a, b []string) []edit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			default:
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var edits []edit
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{'-', a[i]})
+			i++
+		default:
+			edits = append(edits, edit{'+', b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		edits = append(edits, edit{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		edits = append(edits, edit{'+', b[j]})
+	}
+
+	return edits
+}
+
+// normalize ignores differences in whitespace when comparing answers.
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// preview returns the first line of the text unless the full text was asked
+// for.
+func preview(s string, full bool) string {
+	if full {
+		return s
+	}
+
+	s = strings.TrimSpace(s)
+	if line, _, found := strings.Cut(s, "\n"); found {
+		s = line + " ..."
+	}
+
+	if len(s) > 120 {
+		s = s[:117] + "..."
+	}
+
+	return s
+}
@@ -0,0 +1,281 @@
+// This program runs an evaluation set against a model in a batch. Every case
+// of the set is a prompt with the words the answer must contain. The prompts
+// are sent through a local queue with concurrency control and retries, or
+// through the OpenAI Batch API, which is cheaper for large sets but can take
+// hours. The results are saved by case ID as they arrive, so running the
+// program again only sends the cases that haven't succeeded yet, then the
+// answers are scored.
+//
+// The cases are JSON Lines, one case per line:
+//
+//	{"id": "go-zero-value-int", "prompt": "What is the zero value of an int?", "expect": ["0"]}
+//
+// A case can have a system prompt and use "messages" instead of "prompt" for a
+// conversation. An answer passes when it contains every expected string,
+// ignoring case.
+//
+// # Running the example:
+//
+//	$ make evalbatch
+//	$ go run cmd/tools/evalbatch/main.go -c 8 -retries 3
+//	$ go run cmd/tools/evalbatch/main.go -cases my_cases.jsonl -out zarf/data/my_results.jsonl
+//	$ OPENAI_API_KEY=sk-... go run cmd/tools/evalbatch/main.go -mode openai -model gpt-4o-mini
+//
+// # This requires running the following commands:
+//
+//	$ make ollama-up  // This starts the Ollama service.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ardanlabs/ai-training/foundation/batch"
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// defaultCases holds questions about Go.
+//
+//go:embed cases.jsonl
+var defaultCases []byte
+
+// evalCase represents a prompt and the strings the answer must contain.
+type evalCase struct {
+	ID       string     `json:"id"`
+	System   string     `json:"system"`
+	Prompt   string     `json:"prompt"`
+	Messages []client.D `json:"messages"`
+	Expect   []string   `json:"expect"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	casesFile := flag.String("cases", "", "JSON Lines file with the cases, the default asks about Go")
+	out := flag.String("out", "zarf/data/evalbatch.jsonl", "JSON Lines file the results are saved to and resumed from")
+	mode := flag.String("mode", "local", "local to send the requests from a queue, openai to use the OpenAI Batch API")
+	url := flag.String("url", "http://localhost:11434/v1/chat/completions", "chat completions endpoint for the local mode")
+	model := flag.String("model", "gpt-oss:latest", "model to ask")
+	concurrency := flag.Int("c", 4, "requests in flight at once in the local mode")
+	retries := flag.Int("retries", 2, "retries of a failed request in the local mode")
+	timeout := flag.Duration("timeout", 2*time.Minute, "timeout of a single request in the local mode")
+	poll := flag.Duration("poll", 30*time.Second, "how often the status of the batch is checked in the openai mode")
+	temperature := flag.Float64("temperature", 0, "sampling temperature")
+	maxTokens := flag.Int("max-tokens", 1024, "maximum number of tokens to generate per request")
+	flag.Parse()
+
+	data := defaultCases
+	if *casesFile != "" {
+		var err error
+		data, err = os.ReadFile(*casesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	cases, err := parseCases(data)
+	if err != nil {
+		return err
+	}
+
+	// -------------------------------------------------------------------------
+	// Build a request for every case.
+
+	var requests []batch.Request
+	for _, c := range cases {
+		messages := c.Messages
+		if len(messages) == 0 {
+			messages = []client.D{client.User(c.Prompt)}
+		}
+		if c.System != "" {
+			messages = append([]client.D{client.System(c.System)}, messages...)
+		}
+
+		requests = append(requests, batch.Request{
+			ID: c.ID,
+			Body: client.ChatRequest(*model, messages,
+				client.WithTemperature(*temperature),
+				client.WithMaxTokens(*maxTokens),
+			),
+		})
+	}
+
+	var runner batch.Runner
+	switch *mode {
+	case "local":
+		logger := func(context.Context, string, ...any) {}
+
+		runner = &batch.Local{
+			Client:      client.New(logger),
+			URL:         *url,
+			Concurrency: *concurrency,
+			Retries:     *retries,
+			Timeout:     *timeout,
+		}
+
+	case "openai":
+		apiKey := os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			return fmt.Errorf("set OPENAI_API_KEY to use the OpenAI Batch API")
+		}
+
+		runner = &batch.OpenAI{
+			APIKey:       apiKey,
+			PollInterval: *poll,
+			Logger:       func(msg string) { fmt.Println(msg) },
+		}
+
+	default:
+		return fmt.Errorf("unknown mode %q, use local or openai", *mode)
+	}
+
+	// -------------------------------------------------------------------------
+	// Send the cases that haven't succeeded yet.
+
+	store, err := batch.OpenStore(*out)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	todo := 0
+	for _, req := range requests {
+		if !store.Done(req.ID) {
+			todo++
+		}
+	}
+
+	fmt.Printf("cases: %d, already done: %d, sending: %d with %s\n\n", len(requests), len(requests)-todo, todo, *mode)
+
+	// Interrupting the run keeps the results saved so far.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var completed atomic.Int64
+	progress := func(res batch.Result) {
+		n := completed.Add(1)
+		if res.Status == batch.StatusFailed {
+			fmt.Printf("%d/%d %s failed after %d attempts: %s\n", n, todo, res.ID, res.Attempts, res.Error)
+			return
+		}
+		fmt.Printf("%d/%d %s in %s\n", n, todo, res.ID, time.Duration(res.LatencyMS)*time.Millisecond)
+	}
+
+	if err := runner.Run(ctx, requests, store, progress); err != nil {
+		return err
+	}
+
+	// -------------------------------------------------------------------------
+	// Score the answers.
+
+	var passed, failed, errored int
+
+	fmt.Println()
+	for _, c := range cases {
+		res, exists := store.Result(c.ID)
+
+		switch {
+		case !exists || res.Status != batch.StatusSucceeded:
+			errored++
+			fmt.Printf("ERROR %s\n", c.ID)
+
+		case matches(res.Content, c.Expect):
+			passed++
+
+		default:
+			failed++
+			fmt.Printf("FAIL  %s: expected %q in %q\n", c.ID, c.Expect, truncate(res.Content, 200))
+		}
+	}
+
+	fmt.Printf("\npassed: %d  failed: %d  errors: %d  score: %.1f%%\n", passed, failed, errored, 100*float64(passed)/float64(len(cases)))
+	fmt.Printf("results: %s\n", *out)
+
+	return nil
+}
+
+// parseCases reads the cases from JSON Lines, validating the IDs since the
+// results are keyed by them.
+func parseCases(data []byte) ([]evalCase, error) {
+	var cases []evalCase
+	ids := make(map[string]bool)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var c evalCase
+		if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch {
+		case c.ID == "":
+			return nil, fmt.Errorf("line %d: the case has no id", line)
+
+		case ids[c.ID]:
+			return nil, fmt.Errorf("line %d: duplicate id %q", line, c.ID)
+
+		case c.Prompt == "" && len(c.Messages) == 0:
+			return nil, fmt.Errorf("line %d: case %q has no prompt or messages", line, c.ID)
+		}
+		ids[c.ID] = true
+
+		cases = append(cases, c)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no cases found")
+	}
+
+	return cases, nil
+}
+
+// matches reports whether the answer contains every expected string.
+func matches(answer string, expect []string) bool {
+	answer = strings.ToLower(answer)
+	for _, e := range expect {
+		if !strings.Contains(answer, strings.ToLower(e)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n] + "..."
+}
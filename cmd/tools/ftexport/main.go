@@ -0,0 +1,517 @@
+// This program converts saved agent sessions into fine-tuning datasets so the
+// transcripts collected while using the agent can be used to adapt a small
+// local model. Turns where a tool call failed or the model never answered are
+// filtered out and secrets are redacted. Sessions are saved from the agent
+// with the /save command.
+//
+// With -anonymize the file paths, usernames, hostnames and emails are also
+// replaced with placeholders like [PATH-1] or [USER-1], the same value always
+// getting the same placeholder, so students can share their sessions for
+// debugging without leaking the details of their environment.
+//
+// # Running the example:
+//
+//	$ go run cmd/tools/ftexport/main.go -format openai session-*.json > train.jsonl
+//	$ go run cmd/tools/ftexport/main.go -format sharegpt -out train.jsonl session-*.json
+//	$ go run cmd/tools/ftexport/main.go -anonymize -out shared.jsonl session-*.json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	format := flag.String("format", "openai", "output format: openai or sharegpt")
+	out := flag.String("out", "", "file to write the dataset to, defaults to stdout")
+	anonymize := flag.Bool("anonymize", false, "replace file paths, usernames, hostnames and emails with placeholders")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: ftexport [-format openai|sharegpt] [-out file] [-anonymize] <session.json>...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var convert func(messages []message) any
+	switch *format {
+	case "openai":
+		convert = toOpenAI
+	case "sharegpt":
+		convert = toShareGPT
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fmt.Errorf("create: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+
+	// The placeholders are shared by all the sessions so a value has the same
+	// one in every example.
+	var anon *anonymizer
+	if *anonymize {
+		anon = newAnonymizer()
+	}
+
+	var examples, dropped int
+	for _, path := range flag.Args() {
+		messages, droppedTurns, err := loadSession(path, anon)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		dropped += droppedTurns
+
+		// A session with only the system prompt left has nothing to learn.
+		if len(messages) < 3 {
+			continue
+		}
+
+		if err := enc.Encode(convert(messages)); err != nil {
+			return fmt.Errorf("encode: %w", err)
+		}
+		examples++
+	}
+
+	log.Printf("exported %d examples, dropped %d failed turns", examples, dropped)
+	if anon != nil {
+		log.Printf("anonymized %s", anon)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// message represents a cleaned up conversation entry ready to be exported.
+type message struct {
+	Role       string
+	Content    string
+	ToolCallID string
+	ToolName   string
+	Arguments  string
+}
+
+// session represents the parts of a saved agent session that are exported.
+type session struct {
+	Conversation []struct {
+		Role       string `json:"role"`
+		Content    string `json:"content"`
+		ToolCallID string `json:"tool_call_id"`
+		ToolName   string `json:"tool_name"`
+	} `json:"conversation"`
+	ToolEvents []struct {
+		ID        string         `json:"id"`
+		Name      string         `json:"name"`
+		Arguments map[string]any `json:"arguments"`
+	} `json:"tool_events"`
+}
+
+// toolCallID extracts the id from the assistant message the agent records
+// when the model asks for a tool call.
+var toolCallID = regexp.MustCompile(`^Tool call (\S+):`)
+
+// loadSession reads a saved session and returns the messages of the turns
+// that succeeded along with the number of turns that were dropped. The
+// messages are anonymized when an anonymizer is provided.
+func loadSession(path string, anon *anonymizer) ([]message, int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var sess session
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, 0, fmt.Errorf("decode: %w", err)
+	}
+
+	clean := redact
+	if anon != nil {
+		// The usernames in the home directories are learned first so they
+		// are replaced in the messages that come before the paths.
+		anon.learn(string(data))
+		clean = func(s string) string {
+			return anon.replace(redact(s))
+		}
+	}
+
+	args := make(map[string]string)
+	for _, evt := range sess.ToolEvents {
+		b, _ := json.Marshal(evt.Arguments)
+		args[evt.ID] = clean(string(b))
+	}
+
+	var messages, turn []message
+	var failed bool
+	var dropped int
+
+	endTurn := func() {
+		answered := len(turn) > 0 && turn[len(turn)-1].Role == "assistant" && turn[len(turn)-1].ToolCallID == ""
+
+		switch {
+		case len(turn) == 0:
+		case failed || !answered:
+			dropped++
+		default:
+			messages = append(messages, turn...)
+		}
+
+		turn = nil
+		failed = false
+	}
+
+	for _, msg := range sess.Conversation {
+		content := clean(msg.Content)
+
+		switch msg.Role {
+		case "system":
+			messages = append(messages, message{Role: "system", Content: content})
+
+		case "user":
+			endTurn()
+			turn = append(turn, message{Role: "user", Content: content})
+
+		case "tool":
+			if isFailed(msg.Content) {
+				failed = true
+			}
+			turn = append(turn, message{Role: "tool", Content: content, ToolCallID: msg.ToolCallID, ToolName: msg.ToolName})
+
+		case "assistant":
+			if m := toolCallID.FindStringSubmatch(msg.Content); m != nil {
+				name := strings.TrimSpace(strings.SplitN(strings.TrimPrefix(msg.Content, m[0]), "(", 2)[0])
+				arguments, exists := args[m[1]]
+				if !exists {
+					arguments = "{}"
+				}
+				turn = append(turn, message{Role: "assistant", ToolCallID: m[1], ToolName: name, Arguments: arguments})
+				continue
+			}
+			turn = append(turn, message{Role: "assistant", Content: content})
+		}
+	}
+	endTurn()
+
+	return messages, dropped, nil
+}
+
+// isFailed reports whether a tool result has the FAILED status.
+func isFailed(content string) bool {
+	var resp struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal([]byte(content), &resp); err != nil {
+		return true
+	}
+
+	return resp.Status == "FAILED"
+}
+
+// =============================================================================
+
+// secrets matches the common shapes of credentials that end up in transcripts.
+var secrets = []*regexp.Regexp{
+	regexp.MustCompile(`sk-[A-Za-z0-9_\-]{16,}`),
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{20,}`),
+	regexp.MustCompile(`AKIA[0-9A-Z]{16}`),
+	regexp.MustCompile(`xox[baprs]-[A-Za-z0-9\-]{10,}`),
+	regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9_\-.=]{16,}`),
+	regexp.MustCompile(`(?i)((?:password|passwd|secret|api_key|apikey|token)\s*[:=]\s*)["']?[^\s"',]+`),
+}
+
+// redact replaces anything that looks like a secret.
+func redact(s string) string {
+	for _, re := range secrets {
+		s = re.ReplaceAllStringFunc(s, func(match string) string {
+			if sub := re.FindStringSubmatch(match); len(sub) > 1 {
+				return sub[1] + "[REDACTED]"
+			}
+			return "[REDACTED]"
+		})
+	}
+
+	return s
+}
+
+// =============================================================================
+
+// Patterns of the environment details the anonymizer replaces.
+var (
+	emailRE   = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	urlHostRE = regexp.MustCompile(`((?:https?|wss?|ftp)://)([A-Za-z0-9.\-]+)`)
+	absPathRE = regexp.MustCompile(`(^|[\s"'(=,\[])((?:/[A-Za-z0-9._@+\-]+)+)`)
+	homeRE    = regexp.MustCompile(`/(?:home|Users)/([A-Za-z0-9._\-]+)`)
+)
+
+// privateSuffixes are the domains only reachable inside a network, the
+// public hosts like github.com are kept.
+var privateSuffixes = []string{".local", ".lan", ".internal", ".home", ".corp", ".localdomain"}
+
+// anonymizer replaces the file paths, usernames, hostnames and emails with
+// stable placeholders: the same value always gets the same placeholder.
+type anonymizer struct {
+	placeholders map[string]map[string]string // Kind, value, placeholder.
+	users        []string
+	hosts        []string
+}
+
+// newAnonymizer constructs an anonymizer that knows the user and hostname of
+// the machine it runs on.
+func newAnonymizer() *anonymizer {
+	anon := anonymizer{
+		placeholders: make(map[string]map[string]string),
+	}
+
+	if u, err := user.Current(); err == nil {
+		anon.addUser(u.Username)
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		anon.addHost(host)
+	}
+
+	return &anon
+}
+
+// learn collects the usernames of the home directories and the hosts of the
+// local network found in the text.
+func (anon *anonymizer) learn(s string) {
+	for _, m := range homeRE.FindAllStringSubmatch(s, -1) {
+		anon.addUser(m[1])
+	}
+
+	for _, m := range urlHostRE.FindAllStringSubmatch(s, -1) {
+		if isPrivateHost(m[2]) && net.ParseIP(m[2]) == nil {
+			anon.addHost(m[2])
+		}
+	}
+}
+
+// replace returns the text with the environment details replaced. The
+// directories of the absolute paths are replaced and the file names kept so
+// the transcript still reads.
+func (anon *anonymizer) replace(s string) string {
+	s = emailRE.ReplaceAllStringFunc(s, func(email string) string {
+		return anon.placeholder("EMAIL", email)
+	})
+
+	s = urlHostRE.ReplaceAllStringFunc(s, func(match string) string {
+		m := urlHostRE.FindStringSubmatch(match)
+		if !isPrivateHost(m[2]) {
+			return match
+		}
+		return m[1] + anon.placeholder("HOST", m[2])
+	})
+
+	s = absPathRE.ReplaceAllStringFunc(s, func(match string) string {
+		m := absPathRE.FindStringSubmatch(match)
+		dir, file := path.Split(m[2])
+		if dir == "/" {
+			return match
+		}
+		return m[1] + anon.placeholder("PATH", strings.TrimSuffix(dir, "/")) + "/" + file
+	})
+
+	for _, name := range anon.users {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\b`)
+		s = re.ReplaceAllStringFunc(s, func(name string) string {
+			return anon.placeholder("USER", name)
+		})
+	}
+
+	for _, host := range anon.hosts {
+		re := regexp.MustCompile(`\b` + regexp.QuoteMeta(host) + `\b`)
+		s = re.ReplaceAllStringFunc(s, func(host string) string {
+			return anon.placeholder("HOST", host)
+		})
+	}
+
+	return s
+}
+
+// String returns the number of values replaced of every kind.
+func (anon *anonymizer) String() string {
+	var counts []string
+	for _, kind := range []string{"PATH", "USER", "HOST", "EMAIL"} {
+		counts = append(counts, fmt.Sprintf("%d %s", len(anon.placeholders[kind]), strings.ToLower(kind)))
+	}
+
+	return strings.Join(counts, ", ")
+}
+
+// placeholder returns the placeholder of the value, the first value of a
+// kind is [KIND-1], the second [KIND-2] and so on.
+func (anon *anonymizer) placeholder(kind string, value string) string {
+	values, exists := anon.placeholders[kind]
+	if !exists {
+		values = make(map[string]string)
+		anon.placeholders[kind] = values
+	}
+
+	p, exists := values[value]
+	if !exists {
+		p = fmt.Sprintf("[%s-%d]", kind, len(values)+1)
+		values[value] = p
+	}
+
+	return p
+}
+
+// addUser adds a username to replace. Short names would replace common
+// words, they are only replaced in the paths.
+func (anon *anonymizer) addUser(name string) {
+	if len(name) < 3 || slices.Contains(anon.users, name) {
+		return
+	}
+
+	anon.users = append(anon.users, name)
+}
+
+// addHost adds a hostname and its name without the domain to replace. The
+// names of the loopback interface say nothing about the machine.
+func (anon *anonymizer) addHost(host string) {
+	if len(host) < 3 || host == "localhost" || slices.Contains(anon.hosts, host) {
+		return
+	}
+
+	// The full name goes first so it isn't replaced piece by piece.
+	anon.hosts = append(anon.hosts, host)
+
+	if short, _, found := strings.Cut(host, "."); found {
+		anon.addHost(short)
+	}
+}
+
+// isPrivateHost reports whether the host of a URL belongs to the local
+// network: a name without a domain, a private domain or an address that
+// isn't the loopback.
+func isPrivateHost(host string) bool {
+	if host == "localhost" {
+		return false
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return !ip.IsLoopback()
+	}
+
+	if !strings.Contains(host, ".") {
+		return true
+	}
+
+	for _, suffix := range privateSuffixes {
+		if strings.HasSuffix(host, suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// =============================================================================
+
+// toOpenAI converts the messages to the OpenAI chat fine-tuning format.
+func toOpenAI(messages []message) any {
+	type function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	}
+
+	type toolCall struct {
+		ID       string   `json:"id"`
+		Type     string   `json:"type"`
+		Function function `json:"function"`
+	}
+
+	type chatMessage struct {
+		Role       string     `json:"role"`
+		Content    string     `json:"content,omitempty"`
+		ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+		ToolCallID string     `json:"tool_call_id,omitempty"`
+	}
+
+	var example struct {
+		Messages []chatMessage `json:"messages"`
+	}
+
+	for _, msg := range messages {
+		cm := chatMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+
+		switch {
+		case msg.Role == "assistant" && msg.ToolCallID != "":
+			cm.ToolCalls = []toolCall{{
+				ID:       msg.ToolCallID,
+				Type:     "function",
+				Function: function{Name: msg.ToolName, Arguments: msg.Arguments},
+			}}
+		case msg.Role == "tool":
+			cm.ToolCallID = msg.ToolCallID
+		}
+
+		example.Messages = append(example.Messages, cm)
+	}
+
+	return example
+}
+
+// toShareGPT converts the messages to the ShareGPT format.
+func toShareGPT(messages []message) any {
+	type turn struct {
+		From  string `json:"from"`
+		Value string `json:"value"`
+	}
+
+	var example struct {
+		Conversations []turn `json:"conversations"`
+	}
+
+	from := map[string]string{
+		"system":    "system",
+		"user":      "human",
+		"assistant": "gpt",
+		"tool":      "observation",
+	}
+
+	for _, msg := range messages {
+		value := msg.Content
+		if msg.Role == "assistant" && msg.ToolCallID != "" {
+			value = fmt.Sprintf(`{"name": %q, "arguments": %s}`, msg.ToolName, msg.Arguments)
+			example.Conversations = append(example.Conversations, turn{From: "function_call", Value: value})
+			continue
+		}
+
+		example.Conversations = append(example.Conversations, turn{From: from[msg.Role], Value: value})
+	}
+
+	return example
+}
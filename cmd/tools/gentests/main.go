@@ -0,0 +1,269 @@
+// This program drives the coding agent non-interactively to generate tests
+// for a Go package. The agent reads the code and writes table-driven tests,
+// then the tests are run and any failures are sent back to the agent until
+// the tests compile and pass or the attempts are exhausted. The agent is
+// driven through its REST API so it uses the same tools as the chat.
+//
+// # Running the example:
+//
+//	$ make example10-step5-daemon
+//	$ go run cmd/tools/gentests/main.go ./foundation/vector
+//	$ go run cmd/tools/gentests/main.go -attempts 5 -v ./foundation/vector
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The amount of test output sent back to the agent when the tests fail.
+const maxTestOutput = 4 * 1024
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	agent := flag.String("agent", "http://localhost:8090", "base url of the agent REST API")
+	attempts := flag.Int("attempts", 3, "number of times to run the tests before giving up")
+	verbose := flag.Bool("v", false, "show the agent's answers as they stream")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: gentests [-agent url] [-attempts n] [-v] <package dir>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	pkg := flag.Arg(0)
+	if info, err := os.Stat(pkg); err != nil || !info.IsDir() {
+		return fmt.Errorf("%s is not a package directory", pkg)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	ac := agentClient{
+		host:    strings.TrimSuffix(*agent, "/"),
+		verbose: *verbose,
+	}
+
+	if err := ac.createSession(ctx); err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	defer ac.closeSession()
+
+	// -------------------------------------------------------------------------
+	// Ask the agent to write the tests, then run them and send back any
+	// failures until they pass.
+
+	msg := fmt.Sprintf(`Write table-driven unit tests for the Go package in the directory %s.
+
+1. Read every non-test .go file in the directory to learn the package API.
+2. Create a test file named %s_gen_test.go in the same directory with tool_create_file.
+   If the file already exists, edit it instead.
+3. Add the test code to the file with tool_go_code_editor.
+
+Use the standard testing package only. Test the exported functions, cover the
+edge cases, and use t.Run with a name for each case. Do not change the package
+code. Reply with DONE when the file is written.`, pkg, filepath.Base(filepath.Clean(pkg)))
+
+	for attempt := 1; attempt <= *attempts; attempt++ {
+		log.Printf("attempt %d: asking the agent", attempt)
+
+		if err := ac.send(ctx, msg); err != nil {
+			return fmt.Errorf("send: %w", err)
+		}
+
+		log.Printf("attempt %d: running the tests", attempt)
+
+		out, err := goTest(ctx, pkg)
+		if err == nil {
+			log.Printf("attempt %d: tests pass", attempt)
+			fmt.Print(out)
+			return nil
+		}
+
+		log.Printf("attempt %d: tests failed", attempt)
+
+		if len(out) > maxTestOutput {
+			out = "...\n" + out[len(out)-maxTestOutput:]
+		}
+
+		msg = fmt.Sprintf(`Running "go test" on %s failed with this output:
+
+%s
+
+Fix the test file so the tests compile and pass. If a test fails because the
+expectation was wrong, fix the expectation. Do not change the package code.
+Reply with DONE when the file is fixed.`, pkg, out)
+	}
+
+	return fmt.Errorf("tests still fail after %d attempts", *attempts)
+}
+
+// goTest runs the tests for the package and returns the output.
+func goTest(ctx context.Context, pkg string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+
+	if !strings.HasPrefix(pkg, ".") && !filepath.IsAbs(pkg) {
+		pkg = "./" + pkg
+	}
+
+	cmd := exec.CommandContext(ctx, "go", "test", "-count=1", pkg)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	err := cmd.Run()
+
+	return out.String(), err
+}
+
+// =============================================================================
+
+// agentClient talks to the agent REST API.
+type agentClient struct {
+	host    string
+	id      string
+	verbose bool
+}
+
+func (ac *agentClient) createSession(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ac.host+"/v1/sessions", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("status: %s", resp.Status)
+	}
+
+	var session struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&session); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	ac.id = session.ID
+
+	return nil
+}
+
+func (ac *agentClient) closeSession() {
+	req, err := http.NewRequest(http.MethodDelete, ac.host+"/v1/sessions/"+ac.id, nil)
+	if err != nil {
+		return
+	}
+
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
+
+// send posts a message to the session and follows the events until the agent
+// is done responding.
+func (ac *agentClient) send(ctx context.Context, content string) error {
+	body, err := json.Marshal(map[string]string{"content": content})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ac.host+"/v1/sessions/"+ac.id+"/messages", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status: %s: %s", resp.Status, data)
+	}
+
+	var event string
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if name, found := strings.CutPrefix(line, "event: "); found {
+			event = name
+			continue
+		}
+
+		data, found := strings.CutPrefix(line, "data: ")
+		if !found {
+			continue
+		}
+
+		var evt struct {
+			Text  string         `json:"text"`
+			Name  string         `json:"name"`
+			Args  map[string]any `json:"arguments"`
+			Error string         `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &evt); err != nil {
+			continue
+		}
+
+		switch event {
+		case "content":
+			if ac.verbose {
+				fmt.Print(evt.Text)
+			}
+
+		case "tool_call":
+			log.Printf("tool: %s(%v)", evt.Name, evt.Args)
+
+		case "error":
+			log.Printf("agent: %s", evt.Error)
+
+		case "done":
+			if ac.verbose {
+				fmt.Println()
+			}
+			return nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return errors.New("the agent closed the stream before it was done")
+}
@@ -0,0 +1,318 @@
+// This program load tests an OpenAI-compatible chat completions endpoint.
+// It fires requests from a number of concurrent workers and reports the time
+// to first token (TTFT), the generation speed in tokens per second, the
+// latency and the error rate. Run it against a model server to see how it
+// behaves as the concurrency goes up.
+//
+// In streaming mode the TTFT is the time until the first content or reasoning
+// chunk arrives. Without streaming the whole response arrives at once, so the
+// TTFT is the latency. The token counts come from the usage the server
+// reports, when it doesn't the streamed chunks are counted instead.
+//
+// # Running the example:
+//
+//	$ make loadgen
+//	$ go run cmd/tools/loadgen/main.go -c 8 -n 64
+//	$ go run cmd/tools/loadgen/main.go -c 8 -duration 1m -stream=false
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/stream"
+)
+
+// result represents the measurements of a single request.
+type result struct {
+	ttft     time.Duration
+	latency  time.Duration
+	tokens   int
+	reported bool
+	err      error
+}
+
+// chatResponse represents the parts of a non-streaming response needed to
+// count the tokens.
+type chatResponse struct {
+	Usage *client.Usage `json:"usage"`
+}
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	url := flag.String("url", "http://localhost:11434/v1/chat/completions", "chat completions endpoint to call")
+	model := flag.String("model", "gpt-oss:latest", "model to ask for")
+	prompt := flag.String("prompt", "Write a short paragraph about the Go programming language.", "prompt sent with every request")
+	concurrency := flag.Int("c", 4, "number of concurrent workers")
+	total := flag.Int("n", 20, "number of requests to send, ignored when -duration is set")
+	duration := flag.Duration("duration", 0, "keep sending requests for this long instead of a fixed number")
+	streaming := flag.Bool("stream", true, "stream the responses")
+	maxTokens := flag.Int("max-tokens", 256, "maximum number of tokens to generate per request")
+	timeout := flag.Duration("timeout", 2*time.Minute, "timeout of a single request")
+	flag.Parse()
+
+	if *concurrency < 1 || (*duration <= 0 && *total < 1) {
+		return fmt.Errorf("c and n must be positive")
+	}
+
+	logger := func(context.Context, string, ...any) {}
+
+	sseStreamer, err := client.NewStreamer[client.ChatSSE](client.TransportSSE, logger)
+	if err != nil {
+		return fmt.Errorf("create streamer: %w", err)
+	}
+
+	lg := loadgen{
+		url:       *url,
+		streamer:  stream.New(sseStreamer),
+		client:    client.New(logger),
+		timeout:   *timeout,
+		streaming: *streaming,
+		body: func() client.D {
+			options := []func(client.D){
+				client.WithMaxTokens(*maxTokens),
+				client.WithTemperature(0.7),
+				client.WithStream(*streaming),
+			}
+			if *streaming {
+				options = append(options, client.WithStreamUsage())
+			}
+
+			return client.ChatRequest(*model, []client.D{client.User(*prompt)}, options...)
+		},
+	}
+
+	fmt.Printf("url: %s model: %s workers: %d stream: %t\n\n", *url, *model, *concurrency, *streaming)
+
+	// -------------------------------------------------------------------------
+	// The workers take requests until the count or the duration is reached.
+
+	ctx := context.Background()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	var sent atomic.Int64
+	next := func() bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		return *duration > 0 || sent.Add(1) <= int64(*total)
+	}
+
+	var mu sync.Mutex
+	var results []result
+
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range *concurrency {
+		wg.Go(func() {
+			for next() {
+				res := lg.call(ctx)
+
+				// Requests cut off by the end of the duration aren't failures.
+				if *duration > 0 && errors.Is(res.err, context.DeadlineExceeded) && ctx.Err() != nil {
+					return
+				}
+
+				mu.Lock()
+				results = append(results, res)
+				if n := len(results); n%10 == 0 {
+					fmt.Printf("completed %d requests\n", n)
+				}
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	report(results, time.Since(start))
+
+	return nil
+}
+
+// =============================================================================
+
+type loadgen struct {
+	url       string
+	streamer  *stream.Client
+	client    *client.Client
+	timeout   time.Duration
+	streaming bool
+	body      func() client.D
+}
+
+// call sends a single request and measures it.
+func (lg *loadgen) call(ctx context.Context) result {
+	ctx, cancel := context.WithTimeout(ctx, lg.timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	if !lg.streaming {
+		var resp chatResponse
+		if err := lg.client.Do(ctx, http.MethodPost, lg.url, lg.body(), &resp); err != nil {
+			return result{err: err}
+		}
+
+		res := result{
+			ttft:    time.Since(start),
+			latency: time.Since(start),
+		}
+		if resp.Usage != nil {
+			res.tokens = resp.Usage.CompletionTokens
+			res.reported = true
+		}
+
+		return res
+	}
+
+	ch := make(chan stream.Event, 100)
+	if err := lg.streamer.Do(ctx, http.MethodPost, lg.url, lg.body(), ch); err != nil {
+		return result{err: err}
+	}
+
+	var res result
+	var chunks int
+
+	for event := range ch {
+		switch event.Kind {
+		case stream.ContentDelta, stream.ReasoningDelta:
+			if chunks == 0 {
+				res.ttft = time.Since(start)
+			}
+			chunks++
+
+		case stream.UsageUpdate:
+			res.tokens = event.Usage.CompletionTokens
+			res.reported = true
+
+		case stream.Error:
+			res.err = event.Err
+		}
+	}
+
+	res.latency = time.Since(start)
+	if !res.reported {
+		res.tokens = chunks
+	}
+
+	if res.err == nil && ctx.Err() != nil {
+		res.err = ctx.Err()
+	}
+
+	return res
+}
+
+// =============================================================================
+
+// report prints the summary of the run.
+func report(results []result, elapsed time.Duration) {
+	var ttfts, latencies, speeds []time.Duration
+	var tokens, reported int
+	errs := make(map[string]int)
+
+	for _, res := range results {
+		if res.err != nil {
+			errs[res.err.Error()]++
+			continue
+		}
+
+		ttfts = append(ttfts, res.ttft)
+		latencies = append(latencies, res.latency)
+		tokens += res.tokens
+		if res.reported {
+			reported++
+		}
+
+		// The generation speed is measured after the first token so it
+		// doesn't include the time spent processing the prompt. It's stored
+		// as the time per token so the slow requests sort last like the
+		// latencies.
+		if gen := res.latency - res.ttft; res.tokens > 1 && gen > 0 {
+			speeds = append(speeds, gen/time.Duration(res.tokens-1))
+		}
+	}
+
+	failed := len(results) - len(ttfts)
+
+	fmt.Printf("\nrequests: %d in %s, %.2f req/s\n", len(results), elapsed.Round(time.Millisecond), float64(len(results))/elapsed.Seconds())
+	fmt.Printf("errors:   %d (%.1f%%)\n", failed, percent(failed, len(results)))
+	fmt.Printf("tokens:   %d generated, %.1f tokens/s across all workers, %d of %d counts reported by the server\n", tokens, float64(tokens)/elapsed.Seconds(), reported, len(ttfts))
+
+	if len(ttfts) > 0 {
+		fmt.Println()
+		fmt.Printf("%-10s %10s %10s %10s %10s\n", "", "p50", "p90", "p99", "max")
+		printPercentiles("ttft", ttfts)
+		printPercentiles("latency", latencies)
+	}
+
+	// The slow requests are the ones with the lowest speed, so the speed is
+	// reported with the low percentiles. The percentiles of the time per
+	// token are the same requests.
+	if len(speeds) > 0 {
+		slices.Sort(speeds)
+		fmt.Println()
+		fmt.Printf("%-10s %10s %10s %10s %10s\n", "", "p50", "p10", "p1", "min")
+		fmt.Printf("%-10s %10.1f %10.1f %10.1f %10.1f\n", "tokens/s",
+			tokensPerSec(percentile(speeds, 50)),
+			tokensPerSec(percentile(speeds, 90)),
+			tokensPerSec(percentile(speeds, 99)),
+			tokensPerSec(speeds[len(speeds)-1]))
+	}
+
+	if len(errs) > 0 {
+		fmt.Println("\nerrors:")
+		for _, msg := range slices.Sorted(maps.Keys(errs)) {
+			fmt.Printf("  %4d  %s\n", errs[msg], msg)
+		}
+	}
+}
+
+func printPercentiles(name string, values []time.Duration) {
+	slices.Sort(values)
+
+	fmt.Printf("%-10s %10s %10s %10s %10s\n", name,
+		percentile(values, 50).Round(time.Millisecond),
+		percentile(values, 90).Round(time.Millisecond),
+		percentile(values, 99).Round(time.Millisecond),
+		values[len(values)-1].Round(time.Millisecond))
+}
+
+// percentile returns the nearest rank percentile of the sorted values.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	return sorted[max(i-1, 0)]
+}
+
+// tokensPerSec converts the time per token into tokens per second. The high
+// percentiles of the time per token are the low percentiles of the speed.
+func tokensPerSec(perToken time.Duration) float64 {
+	return float64(time.Second) / float64(perToken)
+}
+
+func percent(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return 100 * float64(n) / float64(total)
+}
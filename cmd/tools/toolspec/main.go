@@ -0,0 +1,498 @@
+// This program is a playground for the tools of the coding agent. It prints
+// the JSON schema of every tool, calls a tool with arguments written by hand
+// and checks the arguments against the schema and the response against the
+// envelope every tool returns. Tools can be debugged this way without a
+// model call. The tools run in the agent daemon so they behave exactly like
+// in a chat, the policy and dry-run included.
+//
+// # Running the example:
+//
+//	$ make example10-step5-daemon
+//	$ go run cmd/tools/toolspec/main.go list
+//	$ go run cmd/tools/toolspec/main.go schema tool_read_file
+//	$ go run cmd/tools/toolspec/main.go call tool_read_file '{"path": "go.mod"}'
+//	$ echo '{"path": "go.mod"}' | go run cmd/tools/toolspec/main.go call tool_read_file -
+//
+// # Running the playground, the same commands are read from the prompt:
+//
+//	$ go run cmd/tools/toolspec/main.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	agent := flag.String("agent", "http://localhost:8090", "base url of the agent REST API")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: toolspec [-agent url] [list | schema <tool> | call <tool> <json args | ->]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx := context.Background()
+
+	ac := agentClient{
+		host: strings.TrimSuffix(*agent, "/"),
+	}
+
+	if err := ac.createSession(ctx); err != nil {
+		return fmt.Errorf("create session: %w", err)
+	}
+	defer ac.closeSession()
+
+	if flag.NArg() > 0 {
+		args := flag.Args()
+
+		// The arguments of a call can be piped in.
+		if len(args) == 3 && args[0] == "call" && args[2] == "-" {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			args[2] = string(data)
+		}
+
+		return execute(ctx, &ac, args)
+	}
+
+	// -------------------------------------------------------------------------
+	// Read commands from the prompt until the user quits.
+
+	fmt.Println("\nCommands: list, schema <tool>, call <tool> <json args> (use 'ctrl-d' to quit)")
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for {
+		fmt.Print("\u001b[94m\ntoolspec\u001b[0m> ")
+		if !scanner.Scan() {
+			fmt.Println()
+			return nil
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		// The arguments are the rest of the line, they can have spaces.
+		args := strings.SplitN(line, " ", 3)
+
+		if err := execute(ctx, &ac, args); err != nil {
+			fmt.Printf("\u001b[91mERROR: %s\u001b[0m\n", err)
+		}
+	}
+}
+
+// execute runs a single command.
+func execute(ctx context.Context, ac *agentClient, args []string) error {
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		return list(ctx, ac)
+
+	case args[0] == "schema" && len(args) == 2:
+		return schema(ctx, ac, args[1])
+
+	case args[0] == "call" && len(args) >= 2:
+		arguments := "{}"
+		if len(args) == 3 {
+			arguments = args[2]
+		}
+		return call(ctx, ac, args[1], arguments)
+	}
+
+	return errors.New("unknown command, use list, schema <tool> or call <tool> <json args>")
+}
+
+// list prints the name and the first line of the description of every tool.
+func list(ctx context.Context, ac *agentClient) error {
+	tools, err := ac.tools(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tools {
+		description, _, _ := strings.Cut(t.Function.Description, "\n")
+		if len(description) > 80 {
+			description = description[:77] + "..."
+		}
+
+		fmt.Printf("%-28s %s\n", t.Function.Name, description)
+	}
+
+	return nil
+}
+
+// schema prints the definition of the tool as the model receives it.
+func schema(ctx context.Context, ac *agentClient, name string) error {
+	t, err := ac.tool(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var doc bytes.Buffer
+	if err := json.Indent(&doc, t.raw, "", "  "); err != nil {
+		return err
+	}
+
+	fmt.Println(doc.String())
+
+	return nil
+}
+
+// call checks the arguments against the schema of the tool, calls it and
+// checks the response. Arguments that don't match the schema are still sent,
+// seeing how the tool handles them is part of debugging it.
+func call(ctx context.Context, ac *agentClient, name string, arguments string) error {
+	t, err := ac.tool(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	var args map[string]any
+	if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+		return fmt.Errorf("arguments must be a JSON object: %w", err)
+	}
+
+	for _, problem := range validateArguments(t.Function.Parameters, args) {
+		fmt.Printf("\u001b[93mARGS: %s\u001b[0m\n", problem)
+	}
+
+	start := time.Now()
+
+	msg, err := ac.call(ctx, name, args)
+	if err != nil {
+		return err
+	}
+
+	latency := time.Since(start)
+
+	problems, envelope := validateResponse(name, msg)
+	for _, problem := range problems {
+		fmt.Printf("\u001b[91mRESPONSE: %s\u001b[0m\n", problem)
+	}
+
+	out, _ := json.MarshalIndent(envelope, "", "  ")
+	fmt.Println(string(out))
+
+	status := "valid"
+	if len(problems) > 0 {
+		status = fmt.Sprintf("%d problems", len(problems))
+	}
+	fmt.Printf("\u001b[90mLatency[%s] Response[%s] Bytes[%d]\u001b[0m\n", latency.Round(time.Millisecond), status, len(msg.Content))
+
+	return nil
+}
+
+// =============================================================================
+
+// toolDocument represents the definition of a tool as the model receives it.
+type toolDocument struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string     `json:"name"`
+		Description string     `json:"description"`
+		Parameters  jsonSchema `json:"parameters"`
+	} `json:"function"`
+
+	raw json.RawMessage
+}
+
+// jsonSchema represents the subset of JSON Schema the tools use for their
+// parameters.
+type jsonSchema struct {
+	Type        string                `json:"type,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Properties  map[string]jsonSchema `json:"properties,omitempty"`
+	Required    []string              `json:"required,omitempty"`
+	Items       *jsonSchema           `json:"items,omitempty"`
+	Enum        []any                 `json:"enum,omitempty"`
+}
+
+// validateArguments returns the ways the arguments don't match the schema.
+func validateArguments(schema jsonSchema, args map[string]any) []string {
+	var problems []string
+
+	for _, name := range schema.Required {
+		if _, exists := args[name]; !exists {
+			problems = append(problems, fmt.Sprintf("%s is required", name))
+		}
+	}
+
+	for name, value := range args {
+		prop, exists := schema.Properties[name]
+		if !exists {
+			problems = append(problems, fmt.Sprintf("%s is not a parameter of the tool", name))
+			continue
+		}
+
+		problems = append(problems, validateValue(name, prop, value)...)
+	}
+
+	slices.Sort(problems)
+
+	return problems
+}
+
+// validateValue returns the ways the value doesn't match the schema of the
+// parameter.
+func validateValue(name string, schema jsonSchema, value any) []string {
+	var ok bool
+
+	switch schema.Type {
+	case "string":
+		_, ok = value.(string)
+	case "integer":
+		var n float64
+		n, ok = value.(float64)
+		ok = ok && n == float64(int64(n))
+	case "number":
+		_, ok = value.(float64)
+	case "boolean":
+		_, ok = value.(bool)
+	case "object":
+		_, ok = value.(map[string]any)
+	case "array":
+		var items []any
+		items, ok = value.([]any)
+		if ok && schema.Items != nil {
+			var problems []string
+			for i, item := range items {
+				problems = append(problems, validateValue(fmt.Sprintf("%s[%d]", name, i), *schema.Items, item)...)
+			}
+			return problems
+		}
+	default:
+		ok = true
+	}
+
+	if !ok {
+		return []string{fmt.Sprintf("%s must be of type %s, got %s", name, schema.Type, jsonType(value))}
+	}
+
+	// Decoded values of different types don't compare, they are matched by
+	// their text.
+	inEnum := slices.ContainsFunc(schema.Enum, func(e any) bool {
+		return fmt.Sprint(e) == fmt.Sprint(value)
+	})
+
+	if len(schema.Enum) > 0 && !inEnum {
+		return []string{fmt.Sprintf("%s must be one of %v, got %v", name, schema.Enum, value)}
+	}
+
+	return nil
+}
+
+// jsonType returns the JSON type of a decoded value.
+func jsonType(value any) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case nil:
+		return "null"
+	}
+
+	return fmt.Sprintf("%T", value)
+}
+
+// =============================================================================
+
+// toolMessage represents the tool message the agent appends to the
+// conversation.
+type toolMessage struct {
+	Role       string `json:"role"`
+	ToolCallID string `json:"tool_call_id"`
+	ToolName   string `json:"tool_name"`
+	Content    string `json:"content"`
+}
+
+// validateResponse returns the ways the tool message doesn't match the
+// envelope the agent sends tool results in, and the envelope to print.
+func validateResponse(name string, msg toolMessage) ([]string, any) {
+	var problems []string
+
+	if msg.Role != "tool" {
+		problems = append(problems, fmt.Sprintf("role is %q, not tool", msg.Role))
+	}
+
+	if msg.ToolCallID == "" {
+		problems = append(problems, "tool_call_id is empty")
+	}
+
+	if msg.ToolName != name {
+		problems = append(problems, fmt.Sprintf("tool_name is %q, not %s", msg.ToolName, name))
+	}
+
+	var envelope struct {
+		Version *int           `json:"version"`
+		Status  string         `json:"status"`
+		Data    map[string]any `json:"data"`
+	}
+
+	dec := json.NewDecoder(strings.NewReader(msg.Content))
+	dec.UseNumber()
+
+	if err := dec.Decode(&envelope); err != nil {
+		return append(problems, fmt.Sprintf("content is not a JSON envelope: %s", err)), msg.Content
+	}
+
+	switch {
+	case envelope.Version == nil:
+		problems = append(problems, "version is missing")
+	case *envelope.Version < 1:
+		problems = append(problems, fmt.Sprintf("version %d is not supported", *envelope.Version))
+	}
+
+	switch envelope.Status {
+	case "SUCCESS":
+	case "FAILED":
+		if e, _ := envelope.Data["error"].(string); e == "" {
+			problems = append(problems, "a FAILED response has no error in its data")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("status is %q, not SUCCESS or FAILED", envelope.Status))
+	}
+
+	if envelope.Data == nil {
+		problems = append(problems, "data is missing")
+	}
+
+	return problems, envelope
+}
+
+// =============================================================================
+
+// agentClient talks to the agent REST API.
+type agentClient struct {
+	host string
+	id   string
+}
+
+func (ac *agentClient) createSession(ctx context.Context) error {
+	var session struct {
+		ID string `json:"id"`
+	}
+	if err := ac.do(ctx, http.MethodPost, "/v1/sessions", nil, http.StatusCreated, &session); err != nil {
+		return err
+	}
+
+	ac.id = session.ID
+
+	return nil
+}
+
+func (ac *agentClient) closeSession() {
+	ac.do(context.Background(), http.MethodDelete, "/v1/sessions/"+ac.id, nil, http.StatusNoContent, nil)
+}
+
+// tools returns the definitions of the tools of the session.
+func (ac *agentClient) tools(ctx context.Context) ([]toolDocument, error) {
+	var docs []json.RawMessage
+	if err := ac.do(ctx, http.MethodGet, "/v1/sessions/"+ac.id+"/tools", nil, http.StatusOK, &docs); err != nil {
+		return nil, err
+	}
+
+	// The raw document is kept to print the schema with every field, not
+	// only the ones that are validated.
+	tools := make([]toolDocument, len(docs))
+	for i, doc := range docs {
+		if err := json.Unmarshal(doc, &tools[i]); err != nil {
+			return nil, fmt.Errorf("decode tool: %w", err)
+		}
+		tools[i].raw = doc
+	}
+
+	return tools, nil
+}
+
+// tool returns the definition of the named tool.
+func (ac *agentClient) tool(ctx context.Context, name string) (toolDocument, error) {
+	tools, err := ac.tools(ctx)
+	if err != nil {
+		return toolDocument{}, err
+	}
+
+	for _, t := range tools {
+		if t.Function.Name == name {
+			return t, nil
+		}
+	}
+
+	return toolDocument{}, fmt.Errorf("tool %q does not exist, use list to see the tools", name)
+}
+
+// call calls the tool in the session and returns its tool message.
+func (ac *agentClient) call(ctx context.Context, name string, args map[string]any) (toolMessage, error) {
+	var msg toolMessage
+	if err := ac.do(ctx, http.MethodPost, "/v1/sessions/"+ac.id+"/tools/"+name, args, http.StatusOK, &msg); err != nil {
+		return toolMessage{}, err
+	}
+
+	return msg, nil
+}
+
+func (ac *agentClient) do(ctx context.Context, method string, path string, body any, status int, v any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ac.host+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != status {
+		data, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("status: %s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+
+	return nil
+}
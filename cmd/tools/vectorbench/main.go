@@ -0,0 +1,205 @@
+// This program benchmarks the brute force similarity search in
+// foundation/vector against a random corpus, comparing a single goroutine
+// with SearchParallel at different worker counts to show how the search
+// scales on multi-core machines. It also measures the memory saved by storing
+// the corpus as float16 and how much that changes the results.
+//
+// # Running the example:
+//
+//	$ make vectorbench
+//	$ go run cmd/tools/vectorbench/main.go -n 200000 -dim 1024 -k 10
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	n := flag.Int("n", 100_000, "number of vectors in the corpus")
+	dim := flag.Int("dim", 1024, "dimensions of every vector")
+	k := flag.Int("k", 10, "number of results to return")
+	rounds := flag.Int("rounds", 10, "number of searches to average")
+	maxWorkers := flag.Int("workers", runtime.NumCPU(), "maximum number of workers to measure, doubling from 1")
+	flag.Parse()
+
+	if *n < 1 || *dim < 1 || *k < 1 || *rounds < 1 {
+		return fmt.Errorf("n, dim, k and rounds must be positive")
+	}
+
+	fmt.Printf("corpus: %d vectors of %d dimensions, k=%d, cpus=%d\n\n", *n, *dim, *k, runtime.NumCPU())
+
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	corpus := make([]vector.Data, *n)
+	for i := range corpus {
+		corpus[i] = randomVector(rnd, i, *dim)
+	}
+	target := randomVector(rnd, -1, *dim)
+
+	// -------------------------------------------------------------------------
+	// The baseline computes every similarity with a single goroutine and
+	// sorts the results.
+
+	var expected []vector.SimilarityResult
+	baseline := measure(*rounds, func() {
+		results := vector.Similarity(target, corpus...)
+		slices.SortFunc(results, func(a, b vector.SimilarityResult) int {
+			switch {
+			case a.Similarity > b.Similarity:
+				return -1
+			case a.Similarity < b.Similarity:
+				return 1
+			}
+			return 0
+		})
+		expected = results[:min(*k, len(results))]
+	})
+
+	fmt.Printf("%-22s %12s %8s\n", "search", "avg", "speedup")
+	fmt.Printf("%-22s %12s %8s\n", "Similarity+sort", baseline.Round(time.Microsecond), "1.00x")
+
+	for workers := 1; workers <= *maxWorkers; workers *= 2 {
+		var results []vector.SimilarityResult
+		avg := measure(*rounds, func() {
+			results = vector.SearchParallel(target, corpus, *k, workers)
+		})
+
+		status := ""
+		if !sameResults(expected, results) {
+			status = "  (results differ from baseline)"
+		}
+
+		fmt.Printf("%-22s %12s %7.2fx%s\n", fmt.Sprintf("SearchParallel(%d)", workers), avg.Round(time.Microsecond), float64(baseline)/float64(avg), status)
+	}
+
+	// -------------------------------------------------------------------------
+	// Store the corpus as float16 and compare the memory used, the time and
+	// the recall of the top k against the float32 results.
+
+	corpus16 := make([]vector.Data, len(corpus))
+	for i, dp := range corpus {
+		corpus16[i] = embedding16{
+			id:     i,
+			vector: vector.EncodeFloat16(dp.Vector()),
+		}
+	}
+
+	var results16 []vector.SimilarityResult
+	avg16 := measure(*rounds, func() {
+		results16 = vector.SearchParallel(target, corpus16, *k, *maxWorkers)
+	})
+
+	var results32 []vector.SimilarityResult
+	avg32 := measure(*rounds, func() {
+		results32 = vector.SearchParallel(target, corpus, *k, *maxWorkers)
+	})
+
+	fmt.Printf("\n%-10s %12s %12s %8s\n", "storage", "memory", "avg", "recall")
+	fmt.Printf("%-10s %10.1fMB %12s %8.2f\n", "float32", megabytes(*n**dim*4), avg32.Round(time.Microsecond), 1.0)
+	fmt.Printf("%-10s %10.1fMB %12s %8.2f\n", "float16", megabytes(*n**dim*2), avg16.Round(time.Microsecond), recall(results32, results16))
+
+	return nil
+}
+
+// =============================================================================
+
+type embedding struct {
+	id     int
+	vector []float32
+}
+
+func (e embedding) Vector() []float32 {
+	return e.vector
+}
+
+// embedding16 stores the embedding as float16, the similarity functions use
+// the Float16 method to avoid decoding the whole vector.
+type embedding16 struct {
+	id     int
+	vector vector.Float16Vector
+}
+
+func (e embedding16) Vector() []float32 {
+	return e.vector.Vector()
+}
+
+func (e embedding16) Float16() vector.Float16Vector {
+	return e.vector
+}
+
+func randomVector(rnd *rand.Rand, id int, dim int) embedding {
+	v := make([]float32, dim)
+	for i := range v {
+		v[i] = rnd.Float32()*2 - 1
+	}
+
+	return embedding{
+		id:     id,
+		vector: v,
+	}
+}
+
+func measure(rounds int, f func()) time.Duration {
+	f() // Warm up.
+
+	start := time.Now()
+	for range rounds {
+		f()
+	}
+
+	return time.Since(start) / time.Duration(rounds)
+}
+
+func megabytes(bytes int) float64 {
+	return float64(bytes) / (1024 * 1024)
+}
+
+// recall returns the fraction of the float32 top k that are also in the
+// float16 top k.
+func recall(results32 []vector.SimilarityResult, results16 []vector.SimilarityResult) float64 {
+	if len(results32) == 0 {
+		return 1
+	}
+
+	found := make(map[int]bool, len(results16))
+	for _, r := range results16 {
+		found[r.DataPoint.(embedding16).id] = true
+	}
+
+	var hits int
+	for _, r := range results32 {
+		if found[r.DataPoint.(embedding).id] {
+			hits++
+		}
+	}
+
+	return float64(hits) / float64(len(results32))
+}
+
+func sameResults(a, b []vector.SimilarityResult) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].Similarity != b[i].Similarity {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,285 @@
+// This program keeps a vector index in sync with a directory. Every file is
+// versioned by the hash of its content, so only new and changed files are
+// chunked and embedded again, replacing their old chunks, and the chunks of
+// deleted files are purged from the index.
+//
+// # Running the example:
+//
+//	$ make vectorsync DIR=docs
+//	$ go run cmd/tools/vectorsync/main.go -db sqlite:index.db -dry-run docs
+//	$ go run cmd/tools/vectorsync/main.go -db mongodb://localhost:27017 docs
+//
+// # This requires running the following commands:
+//
+//	$ make ollama-up  // This starts the Ollama service.
+//	$ make compose-up // This starts MongoDB, only needed for a mongodb index.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/mongodb"
+	"github.com/ardanlabs/ai-training/foundation/vectordb"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/tmc/langchaingo/llms/ollama"
+)
+
+const (
+	ollamaURL  = "http://localhost:11434"
+	embedModel = "bge-m3:latest"
+	dimensions = 1024
+	chunkSize  = 1500
+)
+
+func main() {
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() error {
+	dbURL := flag.String("db", "sqlite:vectors.db", "the index, sqlite:<path> or a mongodb:// url")
+	exts := flag.String("ext", ".md,.txt,.go", "comma separated list of file extensions to index")
+	dryRun := flag.Bool("dry-run", false, "show the changes without updating the index")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: vectorsync [-db url] [-ext list] [-dry-run] <directory>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	store, closeStore, err := openStore(ctx, *dbURL)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	// -------------------------------------------------------------------------
+	// Diff the directory against the index.
+
+	files, err := hashFiles(flag.Arg(0), strings.Split(*exts, ","))
+	if err != nil {
+		return err
+	}
+
+	indexed, err := store.Versions(ctx)
+	if err != nil {
+		return fmt.Errorf("versions: %w", err)
+	}
+
+	var changed []string
+	for _, source := range slices.Sorted(maps.Keys(files)) {
+		version, exists := indexed[source]
+		switch {
+		case !exists:
+			fmt.Printf("+ %s\n", source)
+			changed = append(changed, source)
+
+		case version != files[source]:
+			fmt.Printf("~ %s\n", source)
+			changed = append(changed, source)
+		}
+	}
+
+	var deleted []string
+	for _, source := range slices.Sorted(maps.Keys(indexed)) {
+		if _, exists := files[source]; !exists {
+			fmt.Printf("- %s\n", source)
+			deleted = append(deleted, source)
+		}
+	}
+
+	fmt.Printf("\n%d files: %d to index, %d to purge, %d unchanged\n", len(files), len(changed), len(deleted), len(files)-len(changed))
+
+	if *dryRun || len(changed)+len(deleted) == 0 {
+		return nil
+	}
+
+	// -------------------------------------------------------------------------
+	// Apply the changes.
+
+	llmEmbed, err := ollama.New(
+		ollama.WithModel(embedModel),
+		ollama.WithServerURL(ollamaURL),
+	)
+	if err != nil {
+		return fmt.Errorf("ollama: %w", err)
+	}
+
+	for _, source := range deleted {
+		if err := store.Purge(ctx, source); err != nil {
+			return fmt.Errorf("purge: %w", err)
+		}
+	}
+
+	for _, source := range changed {
+		content, err := os.ReadFile(filepath.Join(flag.Arg(0), source))
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+
+		chunks := chunk(string(content), chunkSize)
+		if len(chunks) == 0 {
+			continue
+		}
+
+		vectors, err := llmEmbed.CreateEmbedding(ctx, chunks)
+		if err != nil {
+			return fmt.Errorf("create embedding %s: %w", source, err)
+		}
+
+		version := files[source]
+		now := time.Now().UTC()
+		tags := []string{strings.TrimPrefix(filepath.Ext(source), ".")}
+
+		docs := make([]vectordb.Document, len(chunks))
+		for i := range chunks {
+			docs[i] = vectordb.Document{
+				ID:        fmt.Sprintf("%s#%s#%d", source, version[:12], i),
+				Tags:      tags,
+				Created:   now,
+				Content:   chunks[i],
+				Embedding: vectors[i],
+			}
+		}
+
+		if err := store.Upsert(ctx, source, version, docs...); err != nil {
+			return fmt.Errorf("upsert: %w", err)
+		}
+
+		fmt.Printf("indexed %s: %d chunks\n", source, len(docs))
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+func openStore(ctx context.Context, dbURL string) (vectordb.Store, func(), error) {
+	switch {
+	case strings.HasPrefix(dbURL, "sqlite:"):
+		db, err := sql.Open("sqlite3", strings.TrimPrefix(dbURL, "sqlite:"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("open: %w", err)
+		}
+
+		store, err := vectordb.NewSQLite(ctx, db)
+		if err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+
+		return store, func() { db.Close() }, nil
+
+	case strings.HasPrefix(dbURL, "mongodb://"):
+		client, err := mongodb.Connect(ctx, dbURL, "ardan", "ardan")
+		if err != nil {
+			return nil, nil, fmt.Errorf("connect: %w", err)
+		}
+
+		col, err := mongodb.CreateCollection(ctx, client.Database("vectordb"), "documents")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		const indexName = "vector_index"
+		if err := mongodb.CreateVectorIndex(ctx, col, indexName, vectordb.MongoIndexSettings(dimensions)); err != nil {
+			return nil, nil, err
+		}
+
+		return vectordb.NewMongo(col, indexName), func() { client.Disconnect(ctx) }, nil
+	}
+
+	return nil, nil, fmt.Errorf("unsupported database %q, use sqlite:<path> or mongodb://", dbURL)
+}
+
+// hashFiles returns the hash of every file with one of the extensions,
+// keyed by the path relative to the directory.
+func hashFiles(dir string, exts []string) (map[string]string, error) {
+	files := make(map[string]string)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if path != dir && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !slices.Contains(exts, filepath.Ext(path)) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(content)
+		files[filepath.ToSlash(rel)] = hex.EncodeToString(sum[:])
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("walk: %w", err)
+	}
+
+	return files, nil
+}
+
+// chunk splits the content on paragraphs into chunks of about size bytes.
+func chunk(content string, size int) []string {
+	var chunks []string
+	var b strings.Builder
+
+	for para := range strings.SplitSeq(content, "\n\n") {
+		if b.Len() > 0 && b.Len()+len(para) > size {
+			chunks = append(chunks, b.String())
+			b.Reset()
+		}
+
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+
+		if b.Len() > 0 {
+			b.WriteString("\n\n")
+		}
+		b.WriteString(para)
+	}
+
+	if b.Len() > 0 {
+		chunks = append(chunks, b.String())
+	}
+
+	return chunks
+}
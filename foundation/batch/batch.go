@@ -0,0 +1,92 @@
+// Package batch provides support for sending hundreds of chat requests for
+// offline work like evaluation runs. Requests are sent through a local queue
+// with a bounded number of concurrent calls and retries, or through the batch
+// API of a provider, which is cheaper and has higher limits but takes longer.
+// Results are persisted by request ID as they arrive, so an interrupted run
+// picks up where it stopped.
+package batch
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Request represents a chat completions request identified by the ID of the
+// test case it belongs to.
+type Request struct {
+	ID   string   `json:"id"`
+	Body client.D `json:"body"`
+}
+
+// The status of a result.
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Result represents the outcome of a request.
+type Result struct {
+	ID        string          `json:"id"`
+	Status    string          `json:"status"`
+	Content   string          `json:"content,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Attempts  int             `json:"attempts"`
+	LatencyMS int64           `json:"latency_ms"`
+	Completed time.Time       `json:"completed"`
+}
+
+// Runner is the interface for the ways requests are sent. The requests
+// already completed in the store are skipped, every new result is saved to
+// the store and reported to the progress function, which can be nil.
+type Runner interface {
+	Run(ctx context.Context, requests []Request, store *Store, progress func(Result)) error
+}
+
+// =============================================================================
+
+// chatResponse represents the parts of a chat completions response needed
+// for the result.
+type chatResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	} `json:"choices"`
+}
+
+// newResult constructs a successful result from the chat response.
+func newResult(id string, response json.RawMessage) (Result, error) {
+	var resp chatResponse
+	if err := json.Unmarshal(response, &resp); err != nil {
+		return Result{}, err
+	}
+
+	res := Result{
+		ID:        id,
+		Status:    StatusSucceeded,
+		Response:  response,
+		Completed: time.Now().UTC(),
+	}
+
+	if len(resp.Choices) > 0 {
+		res.Content = resp.Choices[0].Message.Content
+	}
+
+	return res, nil
+}
+
+// pending returns the requests that aren't completed in the store.
+func pending(requests []Request, store *Store) []Request {
+	var reqs []Request
+	for _, req := range requests {
+		if !store.Done(req.ID) {
+			reqs = append(reqs, req)
+		}
+	}
+
+	return reqs
+}
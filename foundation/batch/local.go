@@ -0,0 +1,144 @@
+package batch
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Local represents a queue that sends the requests to a chat completions
+// endpoint itself, a few at a time. It works with any OpenAI-compatible
+// server, like Ollama or llama.cpp.
+type Local struct {
+	Client      *client.Client
+	URL         string        // The chat completions endpoint.
+	Concurrency int           // Requests in flight at once, 4 when zero.
+	Retries     int           // Attempts after the first one fails.
+	Backoff     time.Duration // Delay before the first retry, doubled every retry, 1s when zero.
+	Timeout     time.Duration // Timeout of a single attempt, none when zero.
+}
+
+// Run implements the Runner interface. It returns the first error saving a
+// result, failed requests are saved as failed results instead.
+func (l *Local) Run(ctx context.Context, requests []Request, store *Store, progress func(Result)) error {
+	queue := make(chan Request)
+
+	var mu sync.Mutex
+	var saveErr error
+
+	var wg sync.WaitGroup
+	for range max(l.Concurrency, 1) {
+		wg.Go(func() {
+			for req := range queue {
+				res := l.send(ctx, req)
+
+				// A request cut off by the caller is sent again by the
+				// next run.
+				if ctx.Err() != nil {
+					continue
+				}
+
+				if err := store.Save(res); err != nil {
+					mu.Lock()
+					saveErr = cmp.Or(saveErr, err)
+					mu.Unlock()
+					continue
+				}
+
+				if progress != nil {
+					progress(res)
+				}
+			}
+		})
+	}
+
+	for _, req := range pending(requests, store) {
+		select {
+		case queue <- req:
+		case <-ctx.Done():
+		}
+	}
+	close(queue)
+
+	wg.Wait()
+
+	if saveErr != nil {
+		return saveErr
+	}
+
+	return ctx.Err()
+}
+
+// send sends the request, retrying it with an exponential backoff.
+func (l *Local) send(ctx context.Context, req Request) Result {
+	backoff := l.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	start := time.Now()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var res Result
+		res, err = l.attempt(ctx, req)
+		if err == nil {
+			res.Attempts = attempt
+			res.LatencyMS = time.Since(start).Milliseconds()
+			return res
+		}
+
+		// Retrying doesn't help when the key is wrong or the caller gave up.
+		if attempt > l.Retries || errors.Is(err, client.ErrAuth) || ctx.Err() != nil {
+			return Result{
+				ID:        req.ID,
+				Status:    StatusFailed,
+				Error:     err.Error(),
+				Attempts:  attempt,
+				LatencyMS: time.Since(start).Milliseconds(),
+				Completed: time.Now().UTC(),
+			}
+		}
+
+		// A rate limited server can say how long to wait.
+		wait := backoff
+		var se *client.StatusError
+		if errors.As(err, &se) {
+			wait = max(wait, se.RetryAfter)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+		backoff *= 2
+	}
+}
+
+// attempt sends the request once.
+func (l *Local) attempt(ctx context.Context, req Request) (Result, error) {
+	if l.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.Timeout)
+		defer cancel()
+	}
+
+	var resp json.RawMessage
+	if err := l.Client.Do(ctx, http.MethodPost, l.URL, req.Body, &resp); err != nil {
+		return Result{}, err
+	}
+
+	res, err := newResult(req.ID, resp)
+	if err != nil {
+		return Result{}, fmt.Errorf("decode response: %w", err)
+	}
+
+	return res, nil
+}
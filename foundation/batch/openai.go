@@ -0,0 +1,305 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAI represents the OpenAI Batch API. The requests are uploaded as a
+// file and processed by OpenAI within a day at a lower price, the results
+// are saved when the batch is done. Requests that fail are saved as failed
+// results, run again to retry them.
+type OpenAI struct {
+	BaseURL      string        // https://api.openai.com/v1 when empty.
+	APIKey       string        // The OPENAI_API_KEY.
+	PollInterval time.Duration // How often the batch status is checked, 30s when zero.
+	HTTP         *http.Client  // http.DefaultClient when nil.
+	Logger       func(msg string)
+}
+
+// The endpoint the requests of a batch are sent to.
+const batchEndpoint = "/v1/chat/completions"
+
+// batchStatus represents the parts of a batch object we use.
+type batchStatus struct {
+	ID            string `json:"id"`
+	Status        string `json:"status"`
+	OutputFileID  string `json:"output_file_id"`
+	ErrorFileID   string `json:"error_file_id"`
+	RequestCounts struct {
+		Total     int `json:"total"`
+		Completed int `json:"completed"`
+		Failed    int `json:"failed"`
+	} `json:"request_counts"`
+}
+
+// batchLine represents a line of the output and error files.
+type batchLine struct {
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Run implements the Runner interface. It blocks until the batch is done,
+// which can take hours. Canceling the context stops waiting but not the
+// batch on OpenAI's side.
+func (o *OpenAI) Run(ctx context.Context, requests []Request, store *Store, progress func(Result)) error {
+	reqs := pending(requests, store)
+	if len(reqs) == 0 {
+		return nil
+	}
+
+	// -------------------------------------------------------------------------
+	// Upload the requests as a JSON Lines file and start the batch.
+
+	var input bytes.Buffer
+	for _, req := range reqs {
+		line := map[string]any{
+			"custom_id": req.ID,
+			"method":    http.MethodPost,
+			"url":       batchEndpoint,
+			"body":      req.Body,
+		}
+
+		data, err := json.Marshal(line)
+		if err != nil {
+			return fmt.Errorf("marshal %s: %w", req.ID, err)
+		}
+		input.Write(append(data, '\n'))
+	}
+
+	fileID, err := o.upload(ctx, input.Bytes())
+	if err != nil {
+		return err
+	}
+
+	create := map[string]any{
+		"input_file_id":     fileID,
+		"endpoint":          batchEndpoint,
+		"completion_window": "24h",
+	}
+
+	var batch batchStatus
+	if err := o.do(ctx, http.MethodPost, "/batches", create, &batch); err != nil {
+		return fmt.Errorf("create batch: %w", err)
+	}
+
+	o.log(fmt.Sprintf("created batch %s with %d requests", batch.ID, len(reqs)))
+
+	// -------------------------------------------------------------------------
+	// Wait for the batch to finish.
+
+	interval := o.PollInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	for !batchDone(batch.Status) {
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return fmt.Errorf("stopped waiting for batch %s: %w", batch.ID, ctx.Err())
+		}
+
+		if err := o.do(ctx, http.MethodGet, "/batches/"+batch.ID, nil, &batch); err != nil {
+			return fmt.Errorf("get batch %s: %w", batch.ID, err)
+		}
+
+		o.log(fmt.Sprintf("batch %s %s: %d of %d completed, %d failed", batch.ID, batch.Status, batch.RequestCounts.Completed, batch.RequestCounts.Total, batch.RequestCounts.Failed))
+	}
+
+	// A batch that expired or was cancelled still has the results of the
+	// requests that finished.
+	if batch.OutputFileID == "" && batch.ErrorFileID == "" {
+		return fmt.Errorf("batch %s %s without results", batch.ID, batch.Status)
+	}
+
+	// -------------------------------------------------------------------------
+	// Save the results from the output and error files.
+
+	for _, id := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if id == "" {
+			continue
+		}
+
+		if err := o.saveResults(ctx, id, store, progress); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveResults reads a result file of the batch into the store.
+func (o *OpenAI) saveResults(ctx context.Context, fileID string, store *Store, progress func(Result)) error {
+	var content string
+	if err := o.do(ctx, http.MethodGet, "/files/"+fileID+"/content", nil, &content); err != nil {
+		return fmt.Errorf("download %s: %w", fileID, err)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for scanner.Scan() {
+		var line batchLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("decode %s: %w", fileID, err)
+		}
+
+		res := Result{
+			ID:        line.CustomID,
+			Status:    StatusFailed,
+			Attempts:  1,
+			Completed: time.Now().UTC(),
+		}
+
+		switch {
+		case line.Error != nil:
+			res.Error = line.Error.Message
+
+		case line.Response == nil:
+			res.Error = "no response"
+
+		case line.Response.StatusCode != http.StatusOK:
+			res.Response = line.Response.Body
+			res.Error = fmt.Sprintf("status %d: %s", line.Response.StatusCode, line.Response.Body)
+
+		default:
+			r, err := newResult(line.CustomID, line.Response.Body)
+			if err != nil {
+				res.Error = fmt.Sprintf("decode response: %s", err)
+				break
+			}
+			r.Attempts = 1
+			res = r
+		}
+
+		if err := store.Save(res); err != nil {
+			return err
+		}
+
+		if progress != nil {
+			progress(res)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// upload uploads the input file of a batch and returns its id.
+func (o *OpenAI) upload(ctx context.Context, data []byte) (string, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	w.WriteField("purpose", "batch")
+
+	part, err := w.CreateFormFile("file", "batch.jsonl")
+	if err != nil {
+		return "", fmt.Errorf("upload: %w", err)
+	}
+	part.Write(data)
+
+	if err := w.Close(); err != nil {
+		return "", fmt.Errorf("upload: %w", err)
+	}
+
+	var file struct {
+		ID string `json:"id"`
+	}
+
+	if err := o.send(ctx, http.MethodPost, "/files", w.FormDataContentType(), &body, &file); err != nil {
+		return "", fmt.Errorf("upload: %w", err)
+	}
+
+	return file.ID, nil
+}
+
+// do sends a JSON request to the API and decodes the response into the
+// value, which can be a *string for the raw response.
+func (o *OpenAI) do(ctx context.Context, method string, path string, body any, v any) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("marshal: %w", err)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	return o.send(ctx, method, path, "application/json", r, v)
+}
+
+// send sends the request to the API and decodes the response.
+func (o *OpenAI) send(ctx context.Context, method string, path string, contentType string, body io.Reader, v any) error {
+	baseURL := o.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.openai.com/v1"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(baseURL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+o.APIKey)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	httpClient := o.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, bytes.TrimSpace(data))
+	}
+
+	if s, ok := v.(*string); ok {
+		*s = string(data)
+		return nil
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+// batchDone reports whether the batch status is final.
+func batchDone(status string) bool {
+	switch status {
+	case "completed", "failed", "expired", "cancelled":
+		return true
+	}
+
+	return false
+}
+
+func (o *OpenAI) log(msg string) {
+	if o.Logger != nil {
+		o.Logger(msg)
+	}
+}
@@ -0,0 +1,125 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// Store represents the results of a run persisted to a JSON Lines file, one
+// result per line. A request that is retried in a later run appends a new
+// line and the latest result of an ID wins. It's safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	file    *os.File
+	results map[string]Result
+	order   []string
+}
+
+// OpenStore opens the results file, creating it if it doesn't exist, and
+// loads the results of earlier runs.
+func OpenStore(path string) (*Store, error) {
+	s := Store{
+		results: make(map[string]Result),
+	}
+
+	f, err := os.Open(path)
+	switch {
+	case err == nil:
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+		for line := 1; scanner.Scan(); line++ {
+			var res Result
+			if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+			}
+			s.add(res)
+		}
+
+		f.Close()
+
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("read %s: %w", path, err)
+		}
+
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	s.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// Close closes the results file.
+func (s *Store) Close() error {
+	return s.file.Close()
+}
+
+// Save appends the result to the file.
+func (s *Store) Save(res Result) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("save %s: %w", res.ID, err)
+	}
+
+	s.add(res)
+
+	return nil
+}
+
+// Done reports whether the request with the ID succeeded. Failed requests
+// are sent again by the next run.
+func (s *Store) Done(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.results[id].Status == StatusSucceeded
+}
+
+// Result returns the latest result of the request with the ID.
+func (s *Store) Result(id string) (Result, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res, exists := s.results[id]
+	return res, exists
+}
+
+// Results returns the latest result of every request in the order they were
+// first completed.
+func (s *Store) Results() []Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	results := make([]Result, 0, len(s.order))
+	for _, id := range s.order {
+		results = append(results, s.results[id])
+	}
+
+	return results
+}
+
+// add records the result. The caller must hold the lock.
+func (s *Store) add(res Result) {
+	if _, exists := s.results[res.ID]; !exists {
+		s.order = append(s.order, res.ID)
+	}
+	s.results[res.ID] = res
+}
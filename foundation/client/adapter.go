@@ -0,0 +1,207 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// chatRequest represents the parts of an OpenAI chat request the provider
+// adapters translate into the native APIs.
+type chatRequest struct {
+	Model       string          `json:"model"`
+	Messages    []chatMessage   `json:"messages"`
+	Tools       []chatTool      `json:"tools"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature *float64        `json:"temperature"`
+	TopP        *float64        `json:"top_p"`
+	TopK        *int            `json:"top_k"`
+	Stop        json.RawMessage `json:"stop"`
+}
+
+// parseChatRequest decodes the body the agent built into a chat request.
+func parseChatRequest(body D) (chatRequest, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return chatRequest{}, fmt.Errorf("encoding: error: %w", err)
+	}
+
+	var req chatRequest
+	if err := json.Unmarshal(b, &req); err != nil {
+		return chatRequest{}, fmt.Errorf("decoding: chat request: %w", err)
+	}
+
+	return req, nil
+}
+
+// stop returns the stop sequences, which can be a string or a list.
+func (req chatRequest) stop() []string {
+	var stop string
+	if json.Unmarshal(req.Stop, &stop) == nil {
+		if stop == "" {
+			return nil
+		}
+		return []string{stop}
+	}
+
+	var stops []string
+	json.Unmarshal(req.Stop, &stops)
+
+	return stops
+}
+
+// system returns the text of the system and developer messages, which the
+// native APIs take separately from the conversation.
+func (req chatRequest) system() []string {
+	var system []string
+	for _, msg := range req.Messages {
+		if msg.Role != RoleSystem && msg.Role != RoleDeveloper {
+			continue
+		}
+
+		if text := msg.text(); text != "" {
+			system = append(system, text)
+		}
+	}
+
+	return system
+}
+
+// =============================================================================
+
+type chatMessage struct {
+	Role       string          `json:"role"`
+	Content    json.RawMessage `json:"content"`
+	ToolCalls  []chatToolCall  `json:"tool_calls"`
+	ToolCallID string          `json:"tool_call_id"`
+	ToolName   string          `json:"tool_name"`
+}
+
+// parts returns the content of the message, a plain string is returned as a
+// single text part.
+func (msg chatMessage) parts() []chatPart {
+	var text string
+	if json.Unmarshal(msg.Content, &text) == nil {
+		if text == "" {
+			return nil
+		}
+		return []chatPart{{Type: "text", Text: text}}
+	}
+
+	var parts []chatPart
+	json.Unmarshal(msg.Content, &parts)
+
+	return parts
+}
+
+// text returns the text parts of the message joined together.
+func (msg chatMessage) text() string {
+	var texts []string
+	for _, part := range msg.parts() {
+		if part.Type == "text" && part.Text != "" {
+			texts = append(texts, part.Text)
+		}
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+// toolCallNames returns the names of the tools the message calls by the id
+// of the call, so the results that follow can be matched to the calls.
+func (msg chatMessage) toolCallNames() map[string]string {
+	names := make(map[string]string, len(msg.ToolCalls))
+	for _, toolCall := range msg.ToolCalls {
+		names[toolCall.ID] = toolCall.Function.Name
+	}
+
+	return names
+}
+
+// unansweredToolResult returns the text a tool result is sent as when the
+// previous message didn't ask for it, like the text tool calls the agent
+// makes with models that don't support tools. The native APIs reject tool
+// results that don't match a tool call.
+func (msg chatMessage) unansweredToolResult() string {
+	return fmt.Sprintf("Result of the %s tool call: %s", msg.ToolName, msg.text())
+}
+
+type chatPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageURL struct {
+		URL string `json:"url"`
+	} `json:"image_url"`
+}
+
+// image returns the mime type and the data of an image sent inline as a
+// base64 data URL. Images the native APIs would have to fetch aren't
+// supported.
+func (part chatPart) image() (string, []byte, error) {
+	header, data, found := strings.Cut(part.ImageURL.URL, ",")
+	if !found || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return "", nil, fmt.Errorf("only images sent as base64 data URLs are supported")
+	}
+
+	mimeType := strings.TrimSuffix(strings.TrimPrefix(header, "data:"), ";base64")
+
+	b, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return "", nil, fmt.Errorf("decoding image: %w", err)
+	}
+
+	return mimeType, b, nil
+}
+
+type chatToolCall struct {
+	ID       string `json:"id"`
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// arguments returns the arguments of the call as an object. They are sent as
+// a JSON string by OpenAI and as an object by some servers.
+func (tc chatToolCall) arguments() map[string]any {
+	raw := []byte(tc.Function.Arguments)
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		raw = []byte(s)
+	}
+
+	arguments := make(map[string]any)
+	json.Unmarshal(raw, &arguments)
+
+	return arguments
+}
+
+type chatTool struct {
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+// =============================================================================
+
+// chatChunk returns a chat chunk with the delta, which is how the adapters
+// send what they decode from the native streams.
+func chatChunk(id string, model string, delta ChatDeltaSSE, finishReason string, usage *Usage) ChatSSE {
+	delta.Role = RoleAssistant
+
+	return ChatSSE{
+		ID:     id,
+		Object: "chat.completion.chunk",
+		Model:  model,
+		Choices: []ChatChoiceSSE{
+			{
+				Delta:        delta,
+				FinishReason: finishReason,
+			},
+		},
+		Usage: usage,
+	}
+}
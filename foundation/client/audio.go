@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// Transcription represents the response of a transcription request.
+type Transcription struct {
+	Text     string `json:"text"`
+	Language string `json:"language"`
+}
+
+// Transcribe sends the audio to an OpenAI-compatible transcription endpoint,
+// like a local Whisper server, and returns the text. The file name tells the
+// server the audio format, for example recording.wav. The language is an
+// ISO-639-1 code and can be left empty for the server to detect it.
+func (cln *Client) Transcribe(ctx context.Context, endpoint string, model string, language string, fileName string, audio io.Reader) (Transcription, error) {
+	if err := cln.checkHost(endpoint); err != nil {
+		return Transcription{}, err
+	}
+
+	var b bytes.Buffer
+	w := multipart.NewWriter(&b)
+
+	fields := map[string]string{
+		"model":           model,
+		"language":        language,
+		"response_format": "json",
+	}
+
+	for name, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := w.WriteField(name, value); err != nil {
+			return Transcription{}, fmt.Errorf("write field: %w", err)
+		}
+	}
+
+	part, err := w.CreateFormFile("file", fileName)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("create form file: %w", err)
+	}
+
+	if _, err := io.Copy(part, audio); err != nil {
+		return Transcription{}, fmt.Errorf("copy audio: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return Transcription{}, fmt.Errorf("close form: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, &b)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("create request error: %w", err)
+	}
+
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("Ardan Labs AI Training Sample Go Client: %s", version))
+
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+
+	if cln.azure != nil {
+		if err := cln.azure.prepare(req); err != nil {
+			return Transcription{}, err
+		}
+	}
+
+	if err := cln.checkURL(req.URL); err != nil {
+		return Transcription{}, err
+	}
+
+	resp, err := cln.http.Do(req)
+	if err != nil {
+		return Transcription{}, transportError(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Transcription{}, fmt.Errorf("readall: error: %w", transportError(err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Transcription{}, statusError(resp, data)
+	}
+
+	var t Transcription
+	if err := json.Unmarshal(data, &t); err != nil {
+		return Transcription{}, fmt.Errorf("decoding: response: %s: %w: %w", string(data), ErrDecode, err)
+	}
+
+	t.Text = strings.TrimSpace(t.Text)
+
+	return t, nil
+}
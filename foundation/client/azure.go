@@ -0,0 +1,112 @@
+package client
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// AzureAPIVersion is the Azure OpenAI API version used when none is set.
+const AzureAPIVersion = "2024-10-21"
+
+// Azure represents an Azure OpenAI deployment. Azure serves each model from a
+// deployment with its own path, needs the API version in the query string,
+// and takes the key in an api-key header instead of a bearer token.
+type Azure struct {
+	Endpoint   string // Resource endpoint like https://my-resource.openai.azure.com.
+	Deployment string // Name of the deployment that serves the model.
+	APIVersion string // Defaults to AzureAPIVersion.
+	APIKey     string
+}
+
+// AzureFromEnv returns the Azure deployment configured with the
+// AZURE_OPENAI_ENDPOINT, AZURE_OPENAI_DEPLOYMENT, AZURE_OPENAI_API_VERSION
+// and AZURE_OPENAI_API_KEY environment variables, the same ones the OpenAI
+// SDKs use. It returns false if AZURE_OPENAI_ENDPOINT isn't set.
+func AzureFromEnv() (Azure, bool) {
+	endpoint := os.Getenv("AZURE_OPENAI_ENDPOINT")
+	if endpoint == "" {
+		return Azure{}, false
+	}
+
+	az := Azure{
+		Endpoint:   endpoint,
+		Deployment: os.Getenv("AZURE_OPENAI_DEPLOYMENT"),
+		APIVersion: os.Getenv("AZURE_OPENAI_API_VERSION"),
+		APIKey:     os.Getenv("AZURE_OPENAI_API_KEY"),
+	}
+
+	return az, true
+}
+
+// WithAzure sends the requests to the Azure OpenAI deployment. The endpoints
+// the client is called with are mapped to the deployment by the part of the
+// path after /v1/, so http://localhost:11434/v1/chat/completions becomes
+// https://my-resource.openai.azure.com/openai/deployments/my-gpt/chat/completions?api-version=2024-10-21
+// and code written for a local server works unchanged.
+//
+// Clients pick up the deployment from the environment on their own, see
+// AzureFromEnv, this option is for configuring it in code.
+func WithAzure(az Azure) func(cln *Client) {
+	return func(cln *Client) {
+		cln.azure = &az
+	}
+}
+
+// validate checks the deployment has what's needed to build the URLs.
+func (az Azure) validate() error {
+	if az.Deployment == "" {
+		return errors.New("azure: the deployment name is required, set AZURE_OPENAI_DEPLOYMENT")
+	}
+
+	if az.APIKey == "" {
+		return errors.New("azure: the api key is required, set AZURE_OPENAI_API_KEY")
+	}
+
+	return nil
+}
+
+// url maps the endpoint to the same operation on the deployment.
+func (az Azure) url(endpoint *url.URL) (*url.URL, error) {
+	if err := az.validate(); err != nil {
+		return nil, err
+	}
+
+	operation := strings.TrimPrefix(endpoint.Path, "/")
+	if _, after, found := strings.Cut(endpoint.Path, "/v1/"); found {
+		operation = after
+	}
+
+	u, err := url.Parse(strings.TrimSuffix(az.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("azure: parse endpoint: %w", err)
+	}
+
+	u.Path = path.Join("/", u.Path, "openai", "deployments", az.Deployment, operation)
+	u.RawPath = ""
+
+	query := endpoint.Query()
+	query.Set("api-version", cmp.Or(az.APIVersion, AzureAPIVersion))
+	u.RawQuery = query.Encode()
+
+	return u, nil
+}
+
+// prepare points the request at the deployment and adds the key.
+func (az Azure) prepare(req *http.Request) error {
+	u, err := az.url(req.URL)
+	if err != nil {
+		return err
+	}
+
+	req.URL = u
+	req.Host = u.Host
+	req.Header.Set("api-key", az.APIKey)
+
+	return nil
+}
@@ -0,0 +1,527 @@
+package client
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransportBedrock streams responses from a model on AWS Bedrock using the
+// Converse API instead of the OpenAI compatible API.
+const TransportBedrock = "bedrock"
+
+// Bedrock represents the AWS account and region the Bedrock models are
+// served from.
+type Bedrock struct {
+	Region      string // AWS region like us-east-1.
+	Endpoint    string // Defaults to the bedrock-runtime endpoint of the region, set for VPC endpoints and gateways.
+	Model       string // Model or inference profile id, the model in the request is used when empty.
+	Credentials AWSCredentials
+	APIKey      string // Bedrock API key, sent as a bearer token instead of signing the request.
+}
+
+// BedrockFromEnv returns the Bedrock configuration in the environment
+// variables the AWS SDKs use: AWS_REGION or AWS_DEFAULT_REGION,
+// AWS_ENDPOINT_URL_BEDROCK_RUNTIME, AWS_BEARER_TOKEN_BEDROCK and the ones
+// read by AWSCredentialsFromEnv. The model is set with BEDROCK_MODEL_ID.
+func BedrockFromEnv() Bedrock {
+	return Bedrock{
+		Region:      cmp.Or(os.Getenv("AWS_REGION"), os.Getenv("AWS_DEFAULT_REGION")),
+		Endpoint:    os.Getenv("AWS_ENDPOINT_URL_BEDROCK_RUNTIME"),
+		Model:       os.Getenv("BEDROCK_MODEL_ID"),
+		Credentials: AWSCredentialsFromEnv(),
+		APIKey:      os.Getenv("AWS_BEARER_TOKEN_BEDROCK"),
+	}
+}
+
+// validate checks there is what's needed to build and sign the requests.
+func (br Bedrock) validate() error {
+	if br.Region == "" {
+		return errors.New("bedrock: the region is required, set AWS_REGION")
+	}
+
+	if br.APIKey == "" && (br.Credentials.AccessKeyID == "" || br.Credentials.SecretAccessKey == "") {
+		return errors.New("bedrock: credentials are required, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or AWS_BEARER_TOKEN_BEDROCK")
+	}
+
+	return nil
+}
+
+// url returns the url of the Converse stream operation for the model. The
+// model id is escaped since ids like anthropic.claude-3-haiku-20240307-v1:0
+// have a colon in them.
+func (br Bedrock) url(model string) (string, error) {
+	if err := br.validate(); err != nil {
+		return "", err
+	}
+
+	model = cmp.Or(br.Model, model)
+	if model == "" {
+		return "", errors.New("bedrock: the model is required, set BEDROCK_MODEL_ID")
+	}
+
+	endpoint := cmp.Or(br.Endpoint, fmt.Sprintf("https://bedrock-runtime.%s.amazonaws.com", br.Region))
+
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return "", fmt.Errorf("bedrock: parse endpoint: %w", err)
+	}
+
+	u.RawPath = u.Path + "/model/" + uriEncode(model) + "/converse-stream"
+	u.Path = u.Path + "/model/" + model + "/converse-stream"
+
+	return u.String(), nil
+}
+
+// sign adds the API key or signs the request with the AWS credentials.
+func (br Bedrock) sign(req *http.Request, body []byte) error {
+	if br.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+br.APIKey)
+		return nil
+	}
+
+	signV4(req, body, br.Credentials, br.Region, "bedrock", time.Now())
+
+	return nil
+}
+
+// =============================================================================
+
+// BedrockClient adapts OpenAI style chat requests to the Bedrock Converse
+// API. The messages, tools and tool calls are converted into the native
+// format and the native event stream is converted back into ChatSSE values,
+// so agent code doesn't need to change.
+type BedrockClient struct {
+	*Client
+	bedrock Bedrock
+}
+
+// NewBedrock constructs a client for the models on Bedrock. The requests are
+// signed with the credentials in the configuration, see BedrockFromEnv.
+func NewBedrock(log Logger, br Bedrock, options ...func(cln *Client)) *BedrockClient {
+	cln := New(log, options...)
+	cln.azure = nil
+	cln.sign = br.sign
+
+	return &BedrockClient{
+		Client:  cln,
+		bedrock: br,
+	}
+}
+
+// Do converts the chat request into a Converse request and streams the
+// response into the channel. The endpoint is ignored since the url is built
+// from the region and the model.
+func (cln *BedrockClient) Do(ctx context.Context, method string, endpoint string, body D, ch chan ChatSSE) error {
+	if cln.schema != "" {
+		if err := ValidateChatRequest(cln.schema, body); err != nil {
+			return err
+		}
+	}
+
+	req, err := parseChatRequest(body)
+	if err != nil {
+		return err
+	}
+
+	converse, err := bedrockRequest(req)
+	if err != nil {
+		return err
+	}
+
+	u, err := cln.bedrock.url(req.Model)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{
+		"Accept": {"application/vnd.amazon.eventstream"},
+	}
+
+	resp, err := do(ctx, cln.Client, http.MethodPost, u, converse, header)
+	if err != nil {
+		return err
+	}
+
+	go func(ctx context.Context) {
+		defer func() {
+			resp.Body.Close()
+			close(ch)
+		}()
+
+		state := bedrockState{
+			model: cmp.Or(cln.bedrock.Model, req.Model),
+			tools: make(map[int]*bedrockToolUse),
+		}
+
+		r := bufio.NewReader(resp.Body)
+
+		for {
+			msg, err := readEventMessage(r)
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					cln.log(ctx, "bedrockclient: rawRequest:", "readEventMessage", err)
+					sendErrorChunk(ctx, ErrorTypeConnectionLost, err.Error(), ch)
+				}
+				return
+			}
+
+			chunks, err := state.chunks(msg)
+			if err != nil {
+				cln.log(ctx, "bedrockclient: rawRequest:", "chunks", err)
+				sendErrorChunk(ctx, ErrorTypeInvalidChunk, fmt.Sprintf("decoding stream: %s", err), ch)
+				return
+			}
+
+			for _, chunk := range chunks {
+				select {
+				case ch <- chunk:
+
+				case <-ctx.Done():
+					cln.log(ctx, "bedrockclient: rawRequest:", "Context", ctx.Err().Error())
+					return
+				}
+
+				if chunk.Error != nil {
+					return
+				}
+			}
+		}
+	}(ctx)
+
+	return nil
+}
+
+// =============================================================================
+
+// bedrockRequest converts the chat request into a Converse request. System
+// messages go into their own field, images are sent as bytes and the tool
+// calls and results become toolUse and toolResult blocks. Bedrock rejects
+// consecutive messages with the same role, so their blocks are merged.
+func bedrockRequest(req chatRequest) (D, error) {
+	var messages []D
+	var toolCalls map[string]string
+
+	add := func(role string, blocks []D) {
+		if len(blocks) == 0 {
+			return
+		}
+
+		if n := len(messages); n > 0 && messages[n-1]["role"] == role {
+			messages[n-1]["content"] = append(messages[n-1]["content"].([]D), blocks...)
+			return
+		}
+
+		messages = append(messages, D{"role": role, "content": blocks})
+	}
+
+	// Bedrock rejects tool blocks in a request without tools, so they are
+	// sent as text when there are none.
+	useTools := len(req.Tools) > 0
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case RoleSystem, RoleDeveloper:
+
+		case RoleUser:
+			blocks, err := bedrockContent(msg.parts())
+			if err != nil {
+				return nil, err
+			}
+			add(RoleUser, blocks)
+
+			toolCalls = nil
+
+		case RoleAssistant:
+			blocks, err := bedrockContent(msg.parts())
+			if err != nil {
+				return nil, err
+			}
+
+			for _, toolCall := range msg.ToolCalls {
+				if !useTools {
+					b, _ := json.Marshal(toolCall.arguments())
+					blocks = append(blocks, D{"text": fmt.Sprintf("Tool call %s(%s)", toolCall.Function.Name, b)})
+					continue
+				}
+
+				blocks = append(blocks, D{
+					"toolUse": D{
+						"toolUseId": toolCall.ID,
+						"name":      toolCall.Function.Name,
+						"input":     toolCall.arguments(),
+					},
+				})
+			}
+			add(RoleAssistant, blocks)
+
+			toolCalls = msg.toolCallNames()
+
+		case RoleTool:
+			_, exists := toolCalls[msg.ToolCallID]
+			if !useTools || !exists {
+				add(RoleUser, []D{{"text": msg.unansweredToolResult()}})
+				continue
+			}
+
+			add(RoleUser, []D{{
+				"toolResult": D{
+					"toolUseId": msg.ToolCallID,
+					"content":   []D{{"text": cmp.Or(msg.text(), "The tool returned no output.")}},
+				},
+			}})
+		}
+	}
+
+	converse := D{
+		"messages": messages,
+	}
+
+	var system []D
+	for _, text := range req.system() {
+		system = append(system, D{"text": text})
+	}
+	if len(system) > 0 {
+		converse["system"] = system
+	}
+
+	inference := D{}
+	if req.MaxTokens > 0 {
+		inference["maxTokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		inference["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		inference["topP"] = *req.TopP
+	}
+	if stop := req.stop(); len(stop) > 0 {
+		inference["stopSequences"] = stop
+	}
+	if len(inference) > 0 {
+		converse["inferenceConfig"] = inference
+	}
+
+	if useTools {
+		tools := make([]D, len(req.Tools))
+		for i, tool := range req.Tools {
+			tools[i] = D{
+				"toolSpec": D{
+					"name":        tool.Function.Name,
+					"description": tool.Function.Description,
+					"inputSchema": D{"json": tool.Function.Parameters},
+				},
+			}
+		}
+		converse["toolConfig"] = D{"tools": tools}
+	}
+
+	return converse, nil
+}
+
+// bedrockContent converts the parts of a message into content blocks. Empty
+// text is dropped since Bedrock rejects blank text blocks.
+func bedrockContent(parts []chatPart) ([]D, error) {
+	var blocks []D
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if strings.TrimSpace(part.Text) != "" {
+				blocks = append(blocks, D{"text": part.Text})
+			}
+
+		case "image_url":
+			mimeType, data, err := part.image()
+			if err != nil {
+				return nil, fmt.Errorf("bedrock: %w", err)
+			}
+
+			blocks = append(blocks, D{
+				"image": D{
+					"format": strings.TrimPrefix(mimeType, "image/"),
+					"source": D{"bytes": data},
+				},
+			})
+		}
+	}
+
+	return blocks, nil
+}
+
+// =============================================================================
+
+// bedrockState tracks the tool calls across the events of the stream, the
+// input of a tool call arrives in pieces until its block stops.
+type bedrockState struct {
+	model     string
+	tools     map[int]*bedrockToolUse
+	toolIndex int
+}
+
+type bedrockToolUse struct {
+	id    string
+	name  string
+	input strings.Builder
+}
+
+// bedrockEvent represents the payload of the Converse stream events, each
+// event only sets the fields it's about.
+type bedrockEvent struct {
+	ContentBlockIndex int `json:"contentBlockIndex"`
+	Start             struct {
+		ToolUse *struct {
+			ToolUseID string `json:"toolUseId"`
+			Name      string `json:"name"`
+		} `json:"toolUse"`
+	} `json:"start"`
+	Delta struct {
+		Text             string `json:"text"`
+		ReasoningContent struct {
+			Text string `json:"text"`
+		} `json:"reasoningContent"`
+		ToolUse struct {
+			Input string `json:"input"`
+		} `json:"toolUse"`
+	} `json:"delta"`
+	StopReason string `json:"stopReason"`
+	Usage      *struct {
+		InputTokens  int `json:"inputTokens"`
+		OutputTokens int `json:"outputTokens"`
+		TotalTokens  int `json:"totalTokens"`
+	} `json:"usage"`
+	Message string `json:"message"`
+}
+
+// chunks converts an event into the chat chunks it stands for, most events
+// don't produce any.
+func (s *bedrockState) chunks(msg eventMessage) ([]ChatSSE, error) {
+	switch msg.Headers[":message-type"] {
+	case "exception":
+		var event bedrockEvent
+		json.Unmarshal(msg.Payload, &event)
+
+		chunk := ChatSSE{
+			Object: "chat.completion.chunk",
+			Model:  s.model,
+			Error: &StreamError{
+				Message: cmp.Or(event.Message, string(msg.Payload)),
+				Type:    msg.Headers[":exception-type"],
+			},
+		}
+		return []ChatSSE{chunk}, nil
+
+	case "error":
+		chunk := ChatSSE{
+			Object: "chat.completion.chunk",
+			Model:  s.model,
+			Error: &StreamError{
+				Message: msg.Headers[":error-message"],
+				Code:    msg.Headers[":error-code"],
+			},
+		}
+		return []ChatSSE{chunk}, nil
+	}
+
+	var event bedrockEvent
+	if err := json.Unmarshal(msg.Payload, &event); err != nil {
+		return nil, err
+	}
+
+	switch msg.Headers[":event-type"] {
+	case "contentBlockStart":
+		if event.Start.ToolUse != nil {
+			s.tools[event.ContentBlockIndex] = &bedrockToolUse{
+				id:   event.Start.ToolUse.ToolUseID,
+				name: event.Start.ToolUse.Name,
+			}
+		}
+
+	case "contentBlockDelta":
+		if tool, exists := s.tools[event.ContentBlockIndex]; exists {
+			tool.input.WriteString(event.Delta.ToolUse.Input)
+			return nil, nil
+		}
+
+		delta := ChatDeltaSSE{
+			Content:   event.Delta.Text,
+			Reasoning: event.Delta.ReasoningContent.Text,
+		}
+		if delta.Content == "" && delta.Reasoning == "" {
+			return nil, nil
+		}
+
+		return []ChatSSE{chatChunk("", s.model, delta, "", nil)}, nil
+
+	case "contentBlockStop":
+		tool, exists := s.tools[event.ContentBlockIndex]
+		if !exists {
+			return nil, nil
+		}
+		delete(s.tools, event.ContentBlockIndex)
+
+		// A tool without parameters has no input.
+		arguments := make(map[string]any)
+		if input := tool.input.String(); input != "" {
+			if err := json.Unmarshal([]byte(input), &arguments); err != nil {
+				return nil, fmt.Errorf("tool input: %w", err)
+			}
+		}
+
+		toolCall := ToolCall{
+			ID:    tool.id,
+			Index: s.toolIndex,
+			Type:  "function",
+			Function: Function{
+				Name:      tool.name,
+				Arguments: arguments,
+			},
+		}
+		s.toolIndex++
+
+		return []ChatSSE{chatChunk("", s.model, ChatDeltaSSE{ToolCalls: []ToolCall{toolCall}}, "", nil)}, nil
+
+	case "messageStop":
+		return []ChatSSE{chatChunk("", s.model, ChatDeltaSSE{}, bedrockFinishReason(event.StopReason), nil)}, nil
+
+	case "metadata":
+		if event.Usage == nil {
+			return nil, nil
+		}
+
+		chunk := ChatSSE{
+			Object: "chat.completion.chunk",
+			Model:  s.model,
+			Usage: &Usage{
+				PromptTokens:     event.Usage.InputTokens,
+				CompletionTokens: event.Usage.OutputTokens,
+				TotalTokens:      event.Usage.TotalTokens,
+			},
+		}
+		return []ChatSSE{chunk}, nil
+	}
+
+	return nil, nil
+}
+
+// bedrockFinishReason maps the reason Bedrock stopped to the OpenAI one.
+func bedrockFinishReason(stopReason string) string {
+	switch stopReason {
+	case "tool_use":
+		return FinishToolCalls
+	case "max_tokens":
+		return FinishLength
+	case "guardrail_intervened", "content_filtered":
+		return FinishContentFilter
+	}
+
+	return FinishStop
+}
@@ -1,4 +1,8 @@
 // Package client provides support to access an OpenAI-compatible API service.
+// Clients send the requests to an Azure OpenAI deployment instead when the
+// AZURE_OPENAI_ENDPOINT environment variable is set, see AzureFromEnv. Models
+// on AWS Bedrock and Google Vertex AI are reached through the streaming
+// adapters, see NewBedrock and NewVertex.
 package client
 
 import (
@@ -9,29 +13,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 const version = "v1.0.0"
 
-var ErrUnauthorized = errors.New("api understands the request but refuses to authorize it")
-
 var defaultClient = http.Client{
-	Transport: &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		DialContext: (&net.Dialer{
-			Timeout:   10 * time.Second,
-			KeepAlive: 15 * time.Second,
-			DualStack: true,
-		}).DialContext,
-		ForceAttemptHTTP2:     true,
-		MaxIdleConns:          100,
-		IdleConnTimeout:       90 * time.Second,
-		TLSHandshakeTimeout:   10 * time.Second,
-		ExpectContinueTimeout: 1 * time.Second,
-	},
+	Transport: newTransport(),
 }
 
 type Logger func(context.Context, string, ...any)
@@ -39,8 +30,12 @@ type Logger func(context.Context, string, ...any)
 // =============================================================================
 
 type Client struct {
-	log  Logger
-	http *http.Client
+	log          Logger
+	http         *http.Client
+	schema       string
+	azure        *Azure
+	sign         func(req *http.Request, body []byte) error
+	allowedHosts []string
 }
 
 func New(log Logger, options ...func(cln *Client)) *Client {
@@ -49,10 +44,22 @@ func New(log Logger, options ...func(cln *Client)) *Client {
 		http: &defaultClient,
 	}
 
+	if az, ok := AzureFromEnv(); ok {
+		cln.azure = &az
+	}
+
 	for _, option := range options {
 		option(&cln)
 	}
 
+	// Redirects are held to the same hosts as the requests. The http client
+	// is copied since it can be shared with other clients.
+	if cln.allowedHosts != nil {
+		h := *cln.http
+		h.CheckRedirect = cln.checkRedirect(h.CheckRedirect)
+		cln.http = &h
+	}
+
 	return &cln
 }
 
@@ -63,7 +70,7 @@ func WithClient(http *http.Client) func(cln *Client) {
 }
 
 func (cln *Client) Do(ctx context.Context, method string, endpoint string, body D, v any) error {
-	resp, err := do(ctx, cln, method, endpoint, body)
+	resp, err := do(ctx, cln, method, endpoint, body, nil)
 	if err != nil {
 		return err
 	}
@@ -75,7 +82,7 @@ func (cln *Client) Do(ctx context.Context, method string, endpoint string, body
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("client: copy error: %w", err)
+		return fmt.Errorf("client: copy error: %w", transportError(err))
 	}
 
 	switch d := v.(type) {
@@ -84,7 +91,7 @@ func (cln *Client) Do(ctx context.Context, method string, endpoint string, body
 
 	default:
 		if err := json.Unmarshal(data, v); err != nil {
-			return fmt.Errorf("client: response: %s, decoding error: %w ", string(data), err)
+			return fmt.Errorf("client: response: %s: %w: %w", string(data), ErrDecode, err)
 		}
 	}
 
@@ -105,37 +112,57 @@ func NewSSE[T any](log Logger, options ...func(cln *Client)) *SSEClient[T] {
 	}
 }
 
+// Reconnect settings for streams that drop before they are complete. The
+// server can change the delay with the retry field.
+const (
+	maxReconnects  = 3
+	reconnectDelay = time.Second
+)
+
+// Do makes the request and streams the chunks into the channel. If the
+// connection drops and the server tagged the events with ids, the request is
+// sent again with the Last-Event-ID header so the server can pick up where it
+// stopped. Otherwise a chunk with a connection_lost error is sent, if the
+// chunk type can carry an error, so the caller can decide what to do.
 func (cln *SSEClient[T]) Do(ctx context.Context, method string, endpoint string, body D, ch chan T) error {
-	resp, err := do(ctx, cln.Client, method, endpoint, body)
+	resp, err := do(ctx, cln.Client, method, endpoint, body, nil)
 	if err != nil {
 		return err
 	}
 
 	go func(ctx context.Context) {
-		defer func() {
-			resp.Body.Close()
-			close(ch)
-		}()
+		defer close(ch)
+
+		state := sseState{
+			retry: reconnectDelay,
+		}
 
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
+		for reconnects := 0; ; reconnects++ {
+			err := cln.read(ctx, resp, &state, ch)
+			resp.Body.Close()
 
-			if line == "" || line == "data: [DONE]" {
-				continue
+			if err == nil || errors.Is(err, errStreamStopped) || ctx.Err() != nil {
+				return
 			}
 
-			var v T
-			if err := json.Unmarshal([]byte(line[6:]), &v); err != nil {
-				cln.log(ctx, "sseclient: rawRequest:", "Unmarshal", err, "line", line[6:])
+			if state.lastID == "" || reconnects == maxReconnects {
+				cln.connectionLost(ctx, err, ch)
 				return
 			}
 
-			select {
-			case ch <- v:
+			cln.log(ctx, "sseclient: rawRequest:", "Reconnect", err, "last-event-id", state.lastID)
 
+			select {
+			case <-time.After(state.retry):
 			case <-ctx.Done():
-				cln.log(ctx, "sseclient: rawRequest:", "Context", ctx.Err().Error())
+				return
+			}
+
+			header := http.Header{"Last-Event-ID": {state.lastID}}
+
+			resp, err = do(ctx, cln.Client, method, endpoint, body, header)
+			if err != nil {
+				cln.connectionLost(ctx, err, ch)
 				return
 			}
 		}
@@ -144,10 +171,147 @@ func (cln *SSEClient[T]) Do(ctx context.Context, method string, endpoint string,
 	return nil
 }
 
+// errStreamStopped is returned by read when the stream ended for a reason
+// that was already handled, so it isn't resumed.
+var errStreamStopped = errors.New("stream stopped")
+
+// sseState represents what the server told the client for reconnecting.
+type sseState struct {
+	lastID string
+	retry  time.Duration
+}
+
+// read sends the chunks from the response into the channel. It returns nil
+// when the server ends the stream and the read error if the connection drops.
+func (cln *SSEClient[T]) read(ctx context.Context, resp *http.Response, state *sseState, ch chan T) error {
+	scanner := bufio.NewScanner(resp.Body)
+
+	var event string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// An empty line ends the event. The space after the colon is
+		// optional.
+		if line == "" {
+			event = ""
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			event = strings.TrimSpace(name)
+			continue
+		}
+
+		if id, ok := strings.CutPrefix(line, "id:"); ok {
+			state.lastID = strings.TrimPrefix(id, " ")
+			continue
+		}
+
+		if retry, ok := strings.CutPrefix(line, "retry:"); ok {
+			if ms, err := strconv.Atoi(strings.TrimSpace(retry)); err == nil {
+				state.retry = time.Duration(ms) * time.Millisecond
+			}
+			continue
+		}
+
+		// Only data lines carry chunks, comments are skipped.
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimPrefix(data, " ")
+
+		if data == "" || data == "[DONE]" {
+			continue
+		}
+
+		// Some servers name the event instead of wrapping the error.
+		if event == "error" && !strings.Contains(data, `"error"`) {
+			data = `{"error":` + data + `}`
+		}
+
+		var v T
+		if err := json.Unmarshal([]byte(data), &v); err != nil {
+			cln.log(ctx, "sseclient: rawRequest:", "Unmarshal", err, "line", data)
+
+			// Let the caller know why the stream ended if the chunk type
+			// can carry an error.
+			const maxData = 200
+			if len(data) > maxData {
+				data = data[:maxData] + "..."
+			}
+
+			sendErrorChunk(ctx, ErrorTypeInvalidChunk, fmt.Sprintf("decoding stream: %s: %s", err, data), ch)
+			return errStreamStopped
+		}
+
+		select {
+		case ch <- v:
+
+		case <-ctx.Done():
+			cln.log(ctx, "sseclient: rawRequest:", "Context", ctx.Err().Error())
+			return errStreamStopped
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (cln *SSEClient[T]) connectionLost(ctx context.Context, err error, ch chan T) {
+	cln.log(ctx, "sseclient: rawRequest:", "ConnectionLost", err)
+
+	sendErrorChunk(ctx, ErrorTypeConnectionLost, fmt.Sprintf("connection lost: %s", err), ch)
+}
+
+// sendErrorChunk sends a chunk with the error into the channel. Nothing is
+// sent if the chunk type has no error field.
+func sendErrorChunk[T any](ctx context.Context, typ string, message string, ch chan T) {
+	v, ok := errorChunk[T](typ, message)
+	if !ok {
+		return
+	}
+
+	select {
+	case ch <- v:
+	case <-ctx.Done():
+	}
+}
+
+// errorChunk builds a chunk that carries the error. It returns false if the
+// chunk type has no error field.
+func errorChunk[T any](typ string, message string) (T, bool) {
+	b, _ := json.Marshal(D{
+		"error": D{
+			"message": message,
+			"type":    typ,
+		},
+	})
+
+	var v T
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, false
+	}
+
+	// Unknown fields are ignored when decoding, so check the error made it
+	// into the chunk.
+	got, err := json.Marshal(v)
+	if err != nil || !bytes.Contains(got, []byte(typ)) {
+		return v, false
+	}
+
+	return v, true
+}
+
 // =============================================================================
 
-func do(ctx context.Context, cln *Client, method string, endpoint string, body any) (*http.Response, error) {
-	var statusCode int
+func do(ctx context.Context, cln *Client, method string, endpoint string, body any, header http.Header) (*http.Response, error) {
+	if err := cln.checkHost(endpoint); err != nil {
+		return nil, err
+	}
+
+	if err := cln.validate(endpoint, body); err != nil {
+		return nil, err
+	}
 
 	var b bytes.Buffer
 	if body != nil {
@@ -166,35 +330,48 @@ func do(ctx context.Context, cln *Client, method string, endpoint string, body a
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", fmt.Sprintf("Ardan Labs AI Training Sample Go Client: %s", version))
 
-	resp, err := cln.http.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("do: error: %w", err)
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(RequestIDHeader, id)
 	}
 
-	// Assign for logging the status code at the end of the function call.
-	statusCode = resp.StatusCode
+	for key, values := range header {
+		req.Header[key] = values
+	}
 
-	switch statusCode {
-	case http.StatusOK, http.StatusNoContent:
-		return resp, nil
+	if cln.azure != nil {
+		if err := cln.azure.prepare(req); err != nil {
+			return nil, err
+		}
+	}
 
-	default:
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("readall: error: %w", err)
+	// Provider adapters sign the request last since the signature covers the
+	// headers and the body.
+	if cln.sign != nil {
+		if err := cln.sign(req, b.Bytes()); err != nil {
+			return nil, fmt.Errorf("sign request: %w", err)
 		}
+	}
 
-		switch statusCode {
-		case http.StatusForbidden:
-			return nil, ErrUnauthorized
+	if err := cln.checkURL(req.URL); err != nil {
+		return nil, err
+	}
 
-		default:
-			var err Error
-			if err := json.Unmarshal(data, &err); err != nil {
-				return nil, fmt.Errorf("decoding: response: %s, error: %w ", string(data), err)
-			}
+	resp, err := cln.http.Do(req)
+	if err != nil {
+		return nil, transportError(err)
+	}
 
-			return nil, fmt.Errorf("error: response: %s", err.Message)
-		}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return resp, nil
 	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("readall: error: %w", transportError(err))
+	}
+
+	return nil, statusError(resp, data)
 }
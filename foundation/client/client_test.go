@@ -0,0 +1,169 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/mockserver"
+)
+
+// chat streams a request with the message to the server and collects the
+// chunks.
+func chat(t *testing.T, url string, message string) ([]client.ChatSSE, error) {
+	t.Helper()
+
+	logger := func(ctx context.Context, msg string, v ...any) {
+		t.Log(append([]any{msg}, v...)...)
+	}
+
+	cln := client.NewSSE[client.ChatSSE](logger)
+
+	body := client.D{
+		"model":          "mock",
+		"messages":       []client.D{client.User(message)},
+		"stream":         true,
+		"stream_options": client.D{"include_usage": true},
+	}
+
+	ch := make(chan client.ChatSSE, 100)
+	if err := cln.Do(context.Background(), "POST", url, body, ch); err != nil {
+		return nil, err
+	}
+
+	var chunks []client.ChatSSE
+	for chunk := range ch {
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// =============================================================================
+
+func TestSSEContent(t *testing.T) {
+	srv := mockserver.New(mockserver.Response{Reasoning: "Say hello.", Content: "Hello there, student."})
+	url := srv.Start()
+	defer srv.Close()
+
+	chunks, err := chat(t, url, "hi")
+	if err != nil {
+		t.Fatalf("chat: %s", err)
+	}
+
+	var reasoning, content strings.Builder
+	var finishReason string
+	var usage *client.Usage
+	for _, chunk := range chunks {
+		if chunk.Error != nil {
+			t.Fatalf("unexpected stream error: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			reasoning.WriteString(choice.Delta.Reasoning)
+			content.WriteString(choice.Delta.Content)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+
+	if got := reasoning.String(); got != "Say hello." {
+		t.Errorf("got reasoning %q, want %q", got, "Say hello.")
+	}
+
+	if got := content.String(); got != "Hello there, student." {
+		t.Errorf("got content %q, want %q", got, "Hello there, student.")
+	}
+
+	if finishReason != client.FinishStop {
+		t.Errorf("got finish reason %q, want %q", finishReason, client.FinishStop)
+	}
+
+	if usage == nil || usage.CompletionTokens == 0 {
+		t.Errorf("got usage %+v, want the estimated usage", usage)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+
+	if model, _ := reqs[0]["model"].(string); model != "mock" {
+		t.Errorf("got model %q in the request, want %q", model, "mock")
+	}
+}
+
+func TestSSEToolCalls(t *testing.T) {
+	srv := mockserver.New(mockserver.Response{
+		ToolCalls: []mockserver.ToolCall{{ID: "call-1", Name: "tool_read_file", Arguments: client.D{"path": "go.mod"}}},
+	})
+	url := srv.Start()
+	defer srv.Close()
+
+	chunks, err := chat(t, url, "read go.mod")
+	if err != nil {
+		t.Fatalf("chat: %s", err)
+	}
+
+	var toolCalls []client.ToolCall
+	var finishReason string
+	for _, chunk := range chunks {
+		for _, choice := range chunk.Choices {
+			toolCalls = append(toolCalls, choice.Delta.ToolCalls...)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+
+	if len(toolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(toolCalls))
+	}
+
+	tc := toolCalls[0]
+	if tc.ID != "call-1" || tc.Function.Name != "tool_read_file" || tc.Function.Arguments["path"] != "go.mod" {
+		t.Errorf("got tool call %+v, want tool_read_file(path: go.mod)", tc)
+	}
+
+	if finishReason != client.FinishToolCalls {
+		t.Errorf("got finish reason %q, want %q", finishReason, client.FinishToolCalls)
+	}
+}
+
+func TestSSEStreamError(t *testing.T) {
+	srv := mockserver.New(mockserver.Response{Content: "Partial", Error: "model overloaded"})
+	url := srv.Start()
+	defer srv.Close()
+
+	chunks, err := chat(t, url, "hi")
+	if err != nil {
+		t.Fatalf("chat: %s", err)
+	}
+
+	last := chunks[len(chunks)-1]
+	if last.Error == nil || last.Error.Message != "model overloaded" {
+		t.Errorf("got last chunk %+v, want the stream error", last)
+	}
+}
+
+func TestSSEStatusError(t *testing.T) {
+	srv := mockserver.New(mockserver.Response{Status: 401, Error: "invalid api key"})
+	url := srv.Start()
+	defer srv.Close()
+
+	_, err := chat(t, url, "hi")
+
+	var se *client.StatusError
+	if !errors.As(err, &se) || se.StatusCode != 401 {
+		t.Fatalf("got error %v, want a 401 status error", err)
+	}
+
+	if !errors.Is(err, client.ErrAuth) {
+		t.Errorf("got error %v, want it to match ErrAuth", err)
+	}
+}
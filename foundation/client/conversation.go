@@ -0,0 +1,215 @@
+package client
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// ConversationProblem represents a pattern in the conversation that providers
+// reject, like a tool result that doesn't answer a tool call.
+type ConversationProblem struct {
+	Index   int    // Index of the message in the conversation that was checked.
+	Problem string // What is wrong with the message.
+	Repair  string // What RepairConversation does about it.
+}
+
+// String implements the fmt.Stringer interface.
+func (cp ConversationProblem) String() string {
+	return fmt.Sprintf("messages[%d] %s, %s", cp.Index, cp.Problem, cp.Repair)
+}
+
+// CheckConversation reports the patterns in the conversation that providers
+// reject without changing it.
+func CheckConversation(messages []D) []ConversationProblem {
+	_, problems := RepairConversation(messages)
+	return problems
+}
+
+// RepairConversation returns a copy of the conversation that providers
+// accept and the problems that were repaired:
+//
+//   - Messages without content are dropped, empty tool results are kept
+//     with a note since the tool call needs an answer.
+//   - Tool results that don't follow an assistant message, or answer a tool
+//     call the assistant didn't make, are turned into user messages so the
+//     model still sees the result.
+//   - Consecutive messages with the same role are merged, since chat
+//     templates that expect the roles to alternate reject them.
+//
+// Fields other than the role and content, like metadata the caller keeps in
+// the messages, are taken from the first message that is merged. The
+// messages that aren't changed are shared with the original conversation.
+func RepairConversation(messages []D) ([]D, []ConversationProblem) {
+	var problems []ConversationProblem
+	problem := func(i int, problem string, repair string) {
+		problems = append(problems, ConversationProblem{Index: i, Problem: problem, Repair: repair})
+	}
+
+	repaired := make([]D, 0, len(messages))
+
+	for i, msg := range messages {
+		role, _ := msg["role"].(string)
+
+		if role == RoleTool && !answersToolCall(repaired, msg) {
+			problem(i, "is a tool result without a tool call before it", "turned into a user message")
+
+			name, _ := msg["tool_name"].(string)
+			content, _ := msg["content"].(string)
+
+			msg = maps.Clone(msg)
+			delete(msg, "tool_call_id")
+			delete(msg, "tool_name")
+			msg["role"] = RoleUser
+			msg["content"] = fmt.Sprintf("Result of the %s tool call: %s", cmp.Or(name, "unknown"), content)
+			role = RoleUser
+		}
+
+		if isEmpty(msg) {
+			if role == RoleTool {
+				problem(i, "is an empty tool result", "replaced with a note")
+				msg = maps.Clone(msg)
+				msg["content"] = "The tool returned no output."
+			} else {
+				problem(i, fmt.Sprintf("is an empty %s message", role), "dropped")
+				continue
+			}
+		}
+
+		if n := len(repaired); n > 0 && mergeable(repaired[n-1], msg) {
+			problem(i, fmt.Sprintf("is a second %s message in a row", role), "merged with the previous message")
+			repaired[n-1] = merge(repaired[n-1], msg)
+			continue
+		}
+
+		repaired = append(repaired, msg)
+	}
+
+	return repaired, problems
+}
+
+// =============================================================================
+
+// answersToolCall checks the tool result follows an assistant message, with
+// only other tool results in between. If the assistant message lists its tool
+// calls the result must answer one of them. Assistant messages that describe
+// the tool call in the content are accepted as is.
+func answersToolCall(conversation []D, msg D) bool {
+	i := len(conversation) - 1
+	for i >= 0 && conversation[i]["role"] == RoleTool {
+		i--
+	}
+
+	if i < 0 || conversation[i]["role"] != RoleAssistant {
+		return false
+	}
+
+	ids := toolCallIDs(conversation[i])
+	if ids == nil {
+		return true
+	}
+
+	id, _ := msg["tool_call_id"].(string)
+
+	return slices.Contains(ids, id)
+}
+
+// toolCallIDs returns the ids of the tool calls listed in the assistant
+// message or nil if it doesn't list any.
+func toolCallIDs(msg D) []string {
+	var ids []string
+
+	switch calls := msg["tool_calls"].(type) {
+	case []D:
+		for _, call := range calls {
+			id, _ := call["id"].(string)
+			ids = append(ids, id)
+		}
+
+	case []any:
+		for _, call := range calls {
+			if call, ok := call.(map[string]any); ok {
+				id, _ := call["id"].(string)
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids
+}
+
+// isEmpty checks if the message has no content and no tool calls.
+func isEmpty(msg D) bool {
+	if toolCallIDs(msg) != nil {
+		return false
+	}
+
+	switch content := msg["content"].(type) {
+	case string:
+		return content == ""
+	case []D:
+		return len(content) == 0
+	case []any:
+		return len(content) == 0
+	case nil:
+		return true
+	}
+
+	return false
+}
+
+// mergeable checks if the two messages have the same role and can be
+// combined. Tool results and tool calls are never merged.
+func mergeable(prev D, msg D) bool {
+	role := msg["role"]
+	if prev["role"] != role {
+		return false
+	}
+
+	if role != RoleSystem && role != RoleUser && role != RoleAssistant {
+		return false
+	}
+
+	return toolCallIDs(prev) == nil && toolCallIDs(msg) == nil
+}
+
+// merge combines the content of the two messages. Text is joined with a
+// blank line, multimodal content is joined into a single list of parts.
+func merge(prev D, msg D) D {
+	merged := maps.Clone(prev)
+
+	prevText, prevOK := prev["content"].(string)
+	text, ok := msg["content"].(string)
+
+	if prevOK && ok {
+		merged["content"] = prevText + "\n\n" + text
+		return merged
+	}
+
+	merged["content"] = append(contentParts(prev["content"]), contentParts(msg["content"])...)
+
+	return merged
+}
+
+// contentParts returns the content as a list of multimodal parts.
+func contentParts(content any) []D {
+	switch content := content.(type) {
+	case string:
+		return []D{TextContent(content)}
+
+	case []D:
+		return slices.Clone(content)
+
+	case []any:
+		parts := make([]D, 0, len(content))
+		for _, part := range content {
+			if part, ok := part.(map[string]any); ok {
+				parts = append(parts, part)
+			}
+		}
+		return parts
+	}
+
+	return nil
+}
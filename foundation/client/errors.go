@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set of errors the client returns, so callers can decide what to do with a
+// failure without looking at the message. They are matched with errors.Is,
+// the HTTP status of a failed request is available with errors.As and a
+// StatusError.
+var (
+	ErrRateLimited = errors.New("rate limited")
+	ErrAuth        = errors.New("api understands the request but refuses to authorize it")
+	ErrServer      = errors.New("server error")
+	ErrDecode      = errors.New("decoding error")
+	ErrCanceled    = errors.New("request canceled")
+	ErrTimeout     = errors.New("request timed out")
+)
+
+// ErrUnauthorized is the error returned when the server refuses the
+// credentials.
+//
+// Deprecated: Use ErrAuth, which also covers a 401 response.
+var ErrUnauthorized = ErrAuth
+
+// StatusError represents a response from the server with a status other than
+// 200 or 204. It matches ErrRateLimited for a 429, ErrAuth for a 401 or 403
+// and ErrServer for a 5xx with errors.Is.
+type StatusError struct {
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, zero when not sent.
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("error: status[%d]: response: %s", err.StatusCode, err.Message)
+}
+
+// Unwrap returns the error the status matches.
+func (err *StatusError) Unwrap() error {
+	switch {
+	case err.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+
+	case err.StatusCode == http.StatusUnauthorized, err.StatusCode == http.StatusForbidden:
+		return ErrAuth
+
+	case err.StatusCode >= http.StatusInternalServerError:
+		return ErrServer
+	}
+
+	return nil
+}
+
+// statusError constructs the error for a response with the status and body.
+// The message is taken from the error document when the body is one.
+func statusError(resp *http.Response, data []byte) *StatusError {
+	err := StatusError{
+		StatusCode: resp.StatusCode,
+		Message:    strings.TrimSpace(string(data)),
+		RetryAfter: retryAfter(resp.Header.Get("Retry-After")),
+	}
+
+	var e Error
+	if json.Unmarshal(data, &e) == nil && e.Message != "" {
+		err.Message = e.Message
+	}
+
+	if err.Message == "" {
+		err.Message = http.StatusText(resp.StatusCode)
+	}
+
+	return &err
+}
+
+// retryAfter parses the Retry-After header, which is a number of seconds or
+// a date.
+func retryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(v); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0)
+	}
+
+	return 0
+}
+
+// streamErrors maps the words in the type and code of the errors servers
+// report in a stream to the errors of the client. OpenAI, Anthropic, Bedrock
+// and Vertex each name them differently.
+var streamErrors = []struct {
+	words []string
+	err   error
+}{
+	{[]string{ErrorTypeInvalidChunk}, ErrDecode},
+	{[]string{"rate_limit", "throttl", "too_many_requests", "resource_exhausted"}, ErrRateLimited},
+	{[]string{"auth", "permission", "api_key", "accessdenied", "access_denied"}, ErrAuth},
+	{[]string{"server_error", "api_error", "overloaded", "internal", "unavailable", "modelstreamerror"}, ErrServer},
+}
+
+// Unwrap returns the error of the client the stream error matches, nil if
+// it matches none.
+func (err *StreamError) Unwrap() error {
+	kind := strings.ToLower(err.Type + " " + err.Code)
+
+	for _, se := range streamErrors {
+		for _, word := range se.words {
+			if strings.Contains(kind, word) {
+				return se.err
+			}
+		}
+	}
+
+	return nil
+}
+
+// transportError wraps an error from sending the request so it matches
+// ErrCanceled or ErrTimeout when that's why it failed.
+func transportError(err error) error {
+	var netErr net.Error
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	return fmt.Errorf("do: error: %w", err)
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// maxEventSize is the largest event stream message that is accepted, the
+// messages AWS sends are far smaller.
+const maxEventSize = 16 << 20
+
+// eventMessage represents a message of the binary event stream format AWS
+// uses to stream responses, application/vnd.amazon.eventstream. Only the
+// string headers are kept, the others aren't used by the services.
+type eventMessage struct {
+	Headers map[string]string
+	Payload []byte
+}
+
+// readEventMessage reads the next message from the stream. Each message is
+// a prelude with the lengths, the headers, the payload and a checksum.
+//
+// https://docs.aws.amazon.com/transcribe/latest/dg/event-stream.html
+func readEventMessage(r io.Reader) (eventMessage, error) {
+	var prelude [12]byte
+	if _, err := io.ReadFull(r, prelude[:]); err != nil {
+		return eventMessage{}, err
+	}
+
+	totalLen := binary.BigEndian.Uint32(prelude[0:4])
+	headersLen := binary.BigEndian.Uint32(prelude[4:8])
+
+	if crc32.ChecksumIEEE(prelude[:8]) != binary.BigEndian.Uint32(prelude[8:12]) {
+		return eventMessage{}, errors.New("event stream: prelude checksum mismatch")
+	}
+
+	if totalLen > maxEventSize || totalLen < 16 || headersLen > totalLen-16 {
+		return eventMessage{}, fmt.Errorf("event stream: invalid message length %d", totalLen)
+	}
+
+	msg := make([]byte, totalLen)
+	copy(msg, prelude[:])
+	if _, err := io.ReadFull(r, msg[12:]); err != nil {
+		return eventMessage{}, fmt.Errorf("event stream: %w", noEOF(err))
+	}
+
+	if crc32.ChecksumIEEE(msg[:totalLen-4]) != binary.BigEndian.Uint32(msg[totalLen-4:]) {
+		return eventMessage{}, errors.New("event stream: message checksum mismatch")
+	}
+
+	headers, err := decodeEventHeaders(msg[12 : 12+headersLen])
+	if err != nil {
+		return eventMessage{}, err
+	}
+
+	em := eventMessage{
+		Headers: headers,
+		Payload: msg[12+headersLen : totalLen-4],
+	}
+
+	return em, nil
+}
+
+// decodeEventHeaders decodes the headers of a message. Each header is the
+// length of the name, the name, the type of the value and the value.
+func decodeEventHeaders(b []byte) (map[string]string, error) {
+	headers := make(map[string]string)
+
+	// Number of bytes the values of the fixed size types take.
+	sizes := map[byte]int{0: 0, 1: 0, 2: 1, 3: 2, 4: 4, 5: 8, 8: 8, 9: 16}
+
+	for len(b) > 0 {
+		nameLen := int(b[0])
+		if len(b) < 1+nameLen+1 {
+			return nil, errors.New("event stream: truncated header")
+		}
+
+		name := string(b[1 : 1+nameLen])
+		typ := b[1+nameLen]
+		b = b[1+nameLen+1:]
+
+		switch typ {
+		case 6, 7:
+			if len(b) < 2 {
+				return nil, errors.New("event stream: truncated header")
+			}
+
+			n := int(binary.BigEndian.Uint16(b))
+			if len(b) < 2+n {
+				return nil, errors.New("event stream: truncated header")
+			}
+
+			// Only the strings are kept.
+			if typ == 7 {
+				headers[name] = string(b[2 : 2+n])
+			}
+			b = b[2+n:]
+
+		default:
+			size, exists := sizes[typ]
+			if !exists || len(b) < size {
+				return nil, fmt.Errorf("event stream: invalid header %q", name)
+			}
+			b = b[size:]
+		}
+	}
+
+	return headers, nil
+}
+
+// noEOF reports a stream that ends in the middle of a message as unexpected.
+func noEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,262 @@
+package client
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	googleScope    = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+// googleCredentials represents the JSON file of a service account key or of
+// the application default credentials gcloud writes.
+type googleCredentials struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// googleTokenSource provides OAuth access tokens for Google Cloud and caches
+// them until shortly before they expire. The token is taken from, in order:
+//
+//   - The access token that was configured.
+//   - The credentials file, a service account key or the file written by
+//     gcloud auth application-default login, which is used when no file is
+//     configured.
+//   - The gcloud auth print-access-token command.
+type googleTokenSource struct {
+	http            *http.Client
+	checkHost       func(endpoint string) error
+	accessToken     string
+	credentialsFile string
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// Token returns a valid access token, fetching a new one when needed.
+func (ts *googleTokenSource) Token(ctx context.Context) (string, error) {
+	if ts.accessToken != "" {
+		return ts.accessToken, nil
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	if ts.token != "" && time.Until(ts.expiry) > time.Minute {
+		return ts.token, nil
+	}
+
+	token, expiresIn, err := ts.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	ts.token = token
+	ts.expiry = time.Now().Add(expiresIn)
+
+	return token, nil
+}
+
+func (ts *googleTokenSource) fetch(ctx context.Context) (string, time.Duration, error) {
+	file := cmp.Or(ts.credentialsFile, defaultCredentialsFile())
+
+	data, err := os.ReadFile(file)
+	switch {
+	case err == nil:
+
+	case ts.credentialsFile == "" && errors.Is(err, os.ErrNotExist):
+		return gcloudToken(ctx)
+
+	default:
+		return "", 0, fmt.Errorf("read credentials: %w", err)
+	}
+
+	var creds googleCredentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return "", 0, fmt.Errorf("decoding credentials %s: %w", file, err)
+	}
+
+	form := url.Values{}
+
+	switch creds.Type {
+	case "service_account":
+		assertion, err := creds.assertion(time.Now())
+		if err != nil {
+			return "", 0, err
+		}
+		form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+		form.Set("assertion", assertion)
+
+	case "authorized_user":
+		form.Set("grant_type", "refresh_token")
+		form.Set("client_id", creds.ClientID)
+		form.Set("client_secret", creds.ClientSecret)
+		form.Set("refresh_token", creds.RefreshToken)
+
+	default:
+		return "", 0, fmt.Errorf("credentials of type %q aren't supported", creds.Type)
+	}
+
+	return ts.exchange(ctx, creds.tokenURI(), form)
+}
+
+// exchange posts the grant to the token endpoint.
+func (ts *googleTokenSource) exchange(ctx context.Context, tokenURL string, form url.Values) (string, time.Duration, error) {
+	if ts.checkHost != nil {
+		if err := ts.checkHost(tokenURL); err != nil {
+			return "", 0, fmt.Errorf("token request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, fmt.Errorf("create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := ts.http.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token request: %w", transportError(err))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("token response: %w", err)
+	}
+
+	var token struct {
+		AccessToken      string `json:"access_token"`
+		ExpiresIn        int    `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", 0, fmt.Errorf("decoding token response: %s: %w: %w", data, ErrDecode, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || token.AccessToken == "" {
+		return "", 0, fmt.Errorf("token request: %w: %s: %s", ErrAuth, token.Error, token.ErrorDescription)
+	}
+
+	return token.AccessToken, time.Duration(token.ExpiresIn) * time.Second, nil
+}
+
+// gcloudToken asks gcloud for a token of the logged in account. The tokens
+// last an hour, but only a few minutes are assumed since gcloud may have
+// handed out a cached token.
+func gcloudToken(ctx context.Context) (string, time.Duration, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "gcloud", "auth", "print-access-token")
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", 0, fmt.Errorf("no google credentials found, set GOOGLE_APPLICATION_CREDENTIALS or run gcloud auth application-default login: gcloud: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(string(out)), 5 * time.Minute, nil
+}
+
+// =============================================================================
+
+// defaultCredentialsFile returns where gcloud auth application-default login
+// writes the credentials.
+func defaultCredentialsFile() string {
+	if dir := os.Getenv("CLOUDSDK_CONFIG"); dir != "" {
+		return filepath.Join(dir, "application_default_credentials.json")
+	}
+
+	dir := os.Getenv("APPDATA")
+	if runtime.GOOS != "windows" {
+		home, _ := os.UserHomeDir()
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "gcloud", "application_default_credentials.json")
+}
+
+func (creds googleCredentials) tokenURI() string {
+	if creds.TokenURI != "" {
+		return creds.TokenURI
+	}
+
+	return googleTokenURL
+}
+
+// assertion returns the JWT a service account exchanges for an access
+// token, signed with the key of the account.
+//
+// https://developers.google.com/identity/protocols/oauth2/service-account#httprest
+func (creds googleCredentials) assertion(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PrivateKey))
+	if block == nil {
+		return "", errors.New("service account: no private key found")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("service account: parse private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("service account: private key isn't an RSA key")
+	}
+
+	header, _ := json.Marshal(D{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": creds.PrivateKeyID,
+	})
+
+	claims, _ := json.Marshal(D{
+		"iss":   creds.ClientEmail,
+		"scope": googleScope,
+		"aud":   creds.tokenURI(),
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", fmt.Errorf("service account: sign: %w", err)
+	}
+
+	return unsigned + "." + enc.EncodeToString(signature), nil
+}
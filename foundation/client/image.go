@@ -0,0 +1,180 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MaxImageSize is the largest image that is read or downloaded. Vision models
+// downscale images anyway and a base64 encoded image grows by a third.
+const MaxImageSize = 20 << 20
+
+// imageTypes is the set of image types vision models accept.
+var imageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp"}
+
+// ImageCacheDir is where downloaded images are kept so the same URL is only
+// downloaded once. It defaults to a directory in the user's cache directory.
+var ImageCacheDir = imageCacheDir()
+
+func imageCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "ai-training", "images")
+}
+
+// ReadImage returns the image and its mime type from a local file or an http
+// or https URL. Downloaded images are cached in ImageCacheDir. An error is
+// returned if the image is larger than MaxImageSize or isn't a JPEG, PNG, GIF
+// or WebP image.
+func ReadImage(ctx context.Context, source string) ([]byte, string, error) {
+	return ReadImageClient(ctx, &defaultClient, source)
+}
+
+// ReadImageClient is like ReadImage but downloads the image with the
+// specified HTTP client, like one that limits the hosts and redirects it
+// follows.
+func ReadImageClient(ctx context.Context, cln *http.Client, source string) ([]byte, string, error) {
+	var data []byte
+	var err error
+
+	switch {
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		data, err = downloadImage(ctx, cln, source)
+
+	default:
+		data, err = readImageFile(source)
+	}
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	mimeType, err := imageType(data)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %s", err, source)
+	}
+
+	return data, mimeType, nil
+}
+
+// ImageContent returns the content part of a multimodal message for the
+// image. The image is sent inline as a base64 data URL since a local model
+// server can't reach most URLs.
+func ImageContent(data []byte, mimeType string) D {
+	return D{
+		"type": "image_url",
+		"image_url": D{
+			"url": "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data),
+		},
+	}
+}
+
+// TextContent returns the content part of a multimodal message for the text.
+func TextContent(text string) D {
+	return D{
+		"type": "text",
+		"text": text,
+	}
+}
+
+// =============================================================================
+
+func readImageFile(fileName string) ([]byte, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+
+	if info.Size() > MaxImageSize {
+		return nil, fmt.Errorf("image is %d bytes, the limit is %d: filename: %s", info.Size(), MaxImageSize, fileName)
+	}
+
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+
+	return data, nil
+}
+
+func downloadImage(ctx context.Context, cln *http.Client, url string) ([]byte, error) {
+	sum := sha256.Sum256([]byte(url))
+	cachePath := filepath.Join(ImageCacheDir, hex.EncodeToString(sum[:]))
+
+	if data, err := os.ReadFile(cachePath); err == nil {
+		return data, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := cln.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download image: status[%d]: url: %s", resp.StatusCode, url)
+	}
+
+	if resp.ContentLength > MaxImageSize {
+		return nil, fmt.Errorf("image is %d bytes, the limit is %d: url: %s", resp.ContentLength, MaxImageSize, url)
+	}
+
+	// Servers don't always send the length so the read is limited as well.
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("download image: %w", err)
+	}
+
+	if len(data) > MaxImageSize {
+		return nil, fmt.Errorf("image is larger than the limit of %d bytes: url: %s", MaxImageSize, url)
+	}
+
+	// Only images are cached, the type is checked before writing.
+	if _, err := imageType(data); err != nil {
+		return nil, fmt.Errorf("%w: url: %s", err, url)
+	}
+
+	// The cache is an optimization, a failure to write it isn't an error.
+	if err := os.MkdirAll(ImageCacheDir, 0755); err == nil {
+		if tmp, err := os.CreateTemp(ImageCacheDir, "download-*"); err == nil {
+			_, werr := tmp.Write(data)
+			cerr := tmp.Close()
+			if werr == nil && cerr == nil {
+				os.Rename(tmp.Name(), cachePath)
+			}
+			os.Remove(tmp.Name())
+		}
+	}
+
+	return data, nil
+}
+
+func imageType(data []byte) (string, error) {
+	mimeType := http.DetectContentType(data)
+	if !slices.Contains(imageTypes, mimeType) {
+		return "", fmt.Errorf("unsupported file type: %s", mimeType)
+	}
+
+	return mimeType, nil
+}
@@ -0,0 +1,356 @@
+package client
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TransportLlamaCPP streams responses from a llama.cpp server using its native
+// /completion endpoint instead of the OpenAI compatible API.
+const TransportLlamaCPP = "llamacpp"
+
+// LlamaCPPClient adapts OpenAI style chat requests to the native llama.cpp
+// server API. The conversation is converted into a prompt using the model's
+// chat template on the server and the native response chunks are converted
+// back into ChatSSE values, so agent code doesn't need to change.
+//
+// When the request has tools, the <tool_call> blocks the Hermes and Qwen chat
+// templates ask the model to write are parsed into tool calls, the rest of
+// the text is returned as content. The example10/step5 agent is the only
+// example that selects this client, with AGENT_TRANSPORT=llamacpp.
+type LlamaCPPClient struct {
+	*Client
+}
+
+// NewLlamaCPP constructs a client for the native llama.cpp server API.
+func NewLlamaCPP(log Logger, options ...func(cln *Client)) *LlamaCPPClient {
+	cln := New(log, options...)
+
+	return &LlamaCPPClient{
+		Client: cln,
+	}
+}
+
+// Do converts the chat request into a native completion request and streams
+// the response into the channel. The endpoint can be the base url of the
+// server or the OpenAI chat completions url, which is useful when switching
+// an existing example over to llama.cpp.
+func (cln *LlamaCPPClient) Do(ctx context.Context, method string, endpoint string, body D, ch chan ChatSSE) error {
+	// The request is validated as a chat request before it's converted since
+	// the native endpoints aren't chat endpoints.
+	if cln.schema != "" {
+		if err := ValidateChatRequest(cln.schema, body); err != nil {
+			return err
+		}
+	}
+
+	base := strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/v1/chat/completions")
+
+	prompt, err := cln.applyTemplate(ctx, base, body)
+	if err != nil {
+		return err
+	}
+
+	model, _ := body["model"].(string)
+
+	resp, err := do(ctx, cln.Client, http.MethodPost, base+"/completion", llamaCPPRequest(prompt, body), nil)
+	if err != nil {
+		return err
+	}
+
+	_, hasTools := body["tools"]
+	tp := llamaCPPToolParser{enabled: hasTools}
+
+	go func(ctx context.Context) {
+		defer func() {
+			resp.Body.Close()
+			close(ch)
+		}()
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			line, found := strings.CutPrefix(scanner.Text(), "data: ")
+			if !found || line == "" {
+				continue
+			}
+
+			var chunk llamaCPPChunk
+			if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+				cln.log(ctx, "llamacppclient: rawRequest:", "Unmarshal", err, "line", line)
+
+				sendErrorChunk(ctx, ErrorTypeInvalidChunk, fmt.Sprintf("decoding stream: %s", err), ch)
+				return
+			}
+
+			if chunk.Error != nil {
+				select {
+				case ch <- ChatSSE{Object: "chat.completion.chunk", Model: model, Error: chunk.Error}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			// The text of a tool call is held back until the call is
+			// complete.
+			content := tp.feed(chunk.Content)
+
+			var toolCalls []ToolCall
+			if chunk.Stop {
+				var rest string
+				rest, toolCalls = tp.finish()
+				content += rest
+			}
+
+			select {
+			case ch <- chunk.toChatSSE(model, content, toolCalls):
+
+			case <-ctx.Done():
+				cln.log(ctx, "llamacppclient: rawRequest:", "Context", ctx.Err().Error())
+				return
+			}
+
+			if chunk.Stop {
+				return
+			}
+		}
+	}(ctx)
+
+	return nil
+}
+
+// applyTemplate asks the server to render the messages into a prompt using
+// the chat template that ships with the model.
+func (cln *LlamaCPPClient) applyTemplate(ctx context.Context, base string, body D) (string, error) {
+	d := D{
+		"messages": body["messages"],
+	}
+
+	if tools, exists := body["tools"]; exists {
+		d["tools"] = tools
+	}
+
+	var resp struct {
+		Prompt string `json:"prompt"`
+	}
+
+	if err := cln.Client.Do(ctx, http.MethodPost, base+"/apply-template", d, &resp); err != nil {
+		return "", fmt.Errorf("apply-template: %w", err)
+	}
+
+	return resp.Prompt, nil
+}
+
+// llamaCPPRequest maps the OpenAI request fields to their native llama.cpp
+// names.
+func llamaCPPRequest(prompt string, body D) D {
+	d := D{
+		"prompt":       prompt,
+		"stream":       true,
+		"cache_prompt": true,
+	}
+
+	fields := map[string]string{
+		"max_tokens":  "n_predict",
+		"temperature": "temperature",
+		"top_p":       "top_p",
+		"top_k":       "top_k",
+		"stop":        "stop",
+		"seed":        "seed",
+	}
+
+	for from, to := range fields {
+		if v, exists := body[from]; exists {
+			d[to] = v
+		}
+	}
+
+	return d
+}
+
+// =============================================================================
+
+// llamaCPPChunk represents a chunk streamed from the native /completion
+// endpoint.
+type llamaCPPChunk struct {
+	Content  string       `json:"content"`
+	Stop     bool         `json:"stop"`
+	StopType string       `json:"stop_type"`
+	Error    *StreamError `json:"error"`
+	Timings  *struct {
+		PromptN    int `json:"prompt_n"`
+		PredictedN int `json:"predicted_n"`
+	} `json:"timings"`
+}
+
+func (c llamaCPPChunk) toChatSSE(model string, content string, toolCalls []ToolCall) ChatSSE {
+	var finishReason string
+	if c.Stop {
+		switch {
+		case c.StopType == "limit":
+			finishReason = FinishLength
+		case len(toolCalls) > 0:
+			finishReason = FinishToolCalls
+		default:
+			finishReason = FinishStop
+		}
+	}
+
+	// The final chunk reports the tokens processed in its timings.
+	var usage *Usage
+	if c.Stop && c.Timings != nil {
+		usage = &Usage{
+			PromptTokens:     c.Timings.PromptN,
+			CompletionTokens: c.Timings.PredictedN,
+			TotalTokens:      c.Timings.PromptN + c.Timings.PredictedN,
+		}
+	}
+
+	return ChatSSE{
+		Object: "chat.completion.chunk",
+		Model:  model,
+		Choices: []ChatChoiceSSE{
+			{
+				Delta: ChatDeltaSSE{
+					Role:      "assistant",
+					Content:   content,
+					ToolCalls: toolCalls,
+				},
+				FinishReason: finishReason,
+			},
+		},
+		Usage: usage,
+	}
+}
+
+// =============================================================================
+
+// The tags the Hermes and Qwen chat templates ask the model to put around a
+// tool call, like <tool_call>{"name": "...", "arguments": {...}}</tool_call>.
+const (
+	llamaCPPToolOpen  = "<tool_call>"
+	llamaCPPToolClose = "</tool_call>"
+)
+
+// llamaCPPToolParser separates the tool calls from the text the model
+// streams. The text before the first tool call is streamed as it comes, the
+// rest is held until the response ends and then parsed.
+type llamaCPPToolParser struct {
+	enabled bool
+	held    string
+	inCalls bool
+	calls   strings.Builder
+}
+
+// feed returns the part of the content that can be streamed now.
+func (tp *llamaCPPToolParser) feed(content string) string {
+	if !tp.enabled {
+		return content
+	}
+
+	if tp.inCalls {
+		tp.calls.WriteString(content)
+		return ""
+	}
+
+	s := tp.held + content
+	tp.held = ""
+
+	if i := strings.Index(s, llamaCPPToolOpen); i != -1 {
+		tp.inCalls = true
+		tp.calls.WriteString(s[i:])
+		return s[:i]
+	}
+
+	// The opening tag can be split across chunks, the end of the text that
+	// could start one is held back.
+	for n := min(len(s), len(llamaCPPToolOpen)-1); n > 0; n-- {
+		if strings.HasPrefix(llamaCPPToolOpen, s[len(s)-n:]) {
+			tp.held = s[len(s)-n:]
+			return s[:len(s)-n]
+		}
+	}
+
+	return s
+}
+
+// finish returns the text that was held back and the tool calls. If the
+// calls can't be parsed their text is returned as content, so nothing the
+// model wrote is lost.
+func (tp *llamaCPPToolParser) finish() (string, []ToolCall) {
+	if !tp.inCalls {
+		return tp.held, nil
+	}
+
+	text := tp.calls.String()
+
+	var toolCalls []ToolCall
+	var rest strings.Builder
+
+	for s := text; ; {
+		start := strings.Index(s, llamaCPPToolOpen)
+		if start == -1 {
+			rest.WriteString(s)
+			break
+		}
+		rest.WriteString(s[:start])
+		s = s[start+len(llamaCPPToolOpen):]
+
+		// The model can stop before closing the last call.
+		block, after, _ := strings.Cut(s, llamaCPPToolClose)
+		s = after
+
+		var call struct {
+			Name       string          `json:"name"`
+			Arguments  json.RawMessage `json:"arguments"`
+			Parameters json.RawMessage `json:"parameters"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(block)), &call); err != nil || call.Name == "" {
+			return text, nil
+		}
+
+		arguments, err := llamaCPPArguments(cmp.Or(string(call.Arguments), string(call.Parameters)))
+		if err != nil {
+			return text, nil
+		}
+
+		toolCalls = append(toolCalls, ToolCall{
+			ID:    "call_" + rand.Text(),
+			Index: len(toolCalls),
+			Type:  "function",
+			Function: Function{
+				Name:      call.Name,
+				Arguments: arguments,
+			},
+		})
+	}
+
+	return strings.TrimSpace(rest.String()), toolCalls
+}
+
+// llamaCPPArguments decodes the arguments of a tool call, which models write
+// as an object or as a string holding one.
+func llamaCPPArguments(raw string) (map[string]any, error) {
+	arguments := make(map[string]any)
+	if raw == "" || raw == "null" {
+		return arguments, nil
+	}
+
+	var s string
+	if err := json.Unmarshal([]byte(raw), &s); err == nil {
+		raw = s
+	}
+
+	if err := json.Unmarshal([]byte(raw), &arguments); err != nil {
+		return nil, err
+	}
+
+	return arguments, nil
+}
@@ -0,0 +1,77 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestLlamaCPPToolCalls(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apply-template":
+			fmt.Fprint(w, `{"prompt":"<|im_start|>user\nread go.mod<|im_end|>"}`)
+
+		case "/completion":
+			// The opening tag is split across chunks like a tokenizer would.
+			for _, content := range []string{"Reading it.", "\n<tool", `_call>{"name": "tool_read_file", `, `"arguments": {"path": "go.mod"}}</tool_call>`} {
+				fmt.Fprintf(w, "data: {\"content\":%q,\"stop\":false}\n\n", content)
+			}
+			fmt.Fprint(w, "data: {\"content\":\"\",\"stop\":true,\"stop_type\":\"eos\",\"timings\":{\"prompt_n\":12,\"predicted_n\":5}}\n\n")
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {
+		t.Log(append([]any{msg}, v...)...)
+	}
+
+	tools := []client.D{client.ToolDocument("tool_read_file", "Read a file.", struct {
+		Path string `json:"path"`
+	}{})}
+
+	body := client.ChatRequest("mock", []client.D{client.User("read go.mod")}, client.WithStream(true), client.WithTools(tools))
+
+	cln := client.NewLlamaCPP(logger)
+
+	ch := make(chan client.ChatSSE, 100)
+	if err := cln.Do(context.Background(), http.MethodPost, srv.URL+"/v1/chat/completions", body, ch); err != nil {
+		t.Fatalf("chat: %s", err)
+	}
+
+	var content strings.Builder
+	var toolCalls []client.ToolCall
+	var finishReason string
+	for chunk := range ch {
+		if chunk.Error != nil {
+			t.Fatalf("unexpected stream error: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			content.WriteString(choice.Delta.Content)
+			toolCalls = append(toolCalls, choice.Delta.ToolCalls...)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+	}
+
+	if got := strings.TrimSpace(content.String()); got != "Reading it." {
+		t.Errorf("got content %q, want the text before the tool call", got)
+	}
+
+	if len(toolCalls) != 1 || toolCalls[0].ID == "" || toolCalls[0].Function.Name != "tool_read_file" || toolCalls[0].Function.Arguments["path"] != "go.mod" {
+		t.Errorf("got tool calls %+v, want tool_read_file(path: go.mod) with an id", toolCalls)
+	}
+
+	if finishReason != client.FinishToolCalls {
+		t.Errorf("got finish reason %q, want %q", finishReason, client.FinishToolCalls)
+	}
+}
@@ -0,0 +1,89 @@
+package client
+
+import "encoding/json"
+
+// Set of roles a message in the conversation can have.
+const (
+	RoleSystem    = "system"
+	RoleDeveloper = "developer"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// System returns a message with the instructions for the model.
+func System(content string) D {
+	return D{
+		"role":    RoleSystem,
+		"content": content,
+	}
+}
+
+// User returns a message from the user.
+func User(content string) D {
+	return D{
+		"role":    RoleUser,
+		"content": content,
+	}
+}
+
+// UserParts returns a multimodal message from the user. The parts are
+// constructed with TextContent and ImageContent.
+//
+//	msg := client.UserParts(
+//		client.ImageContent(data, mimeType),
+//		client.TextContent("What is in this picture?"),
+//	)
+func UserParts(parts ...D) D {
+	return D{
+		"role":    RoleUser,
+		"content": parts,
+	}
+}
+
+// Assistant returns a message from the model.
+func Assistant(content string) D {
+	return D{
+		"role":    RoleAssistant,
+		"content": content,
+	}
+}
+
+// AssistantToolCalls returns a message from the model asking for the tool
+// calls, so the results that follow can be matched to the calls.
+func AssistantToolCalls(toolCalls []ToolCall) D {
+	calls := make([]D, len(toolCalls))
+	for i, toolCall := range toolCalls {
+		// The arguments are sent as a JSON string.
+		arguments, err := json.Marshal(toolCall.Function.Arguments)
+		if err != nil || toolCall.Function.Arguments == nil {
+			arguments = []byte("{}")
+		}
+
+		calls[i] = D{
+			"id":   toolCall.ID,
+			"type": "function",
+			"function": D{
+				"name":      toolCall.Function.Name,
+				"arguments": string(arguments),
+			},
+		}
+	}
+
+	return D{
+		"role":       RoleAssistant,
+		"content":    "",
+		"tool_calls": calls,
+	}
+}
+
+// ToolResult returns the result of a tool call. The content is usually a
+// JSON document the model can read.
+func ToolResult(toolCallID string, toolName string, content string) D {
+	return D{
+		"role":         RoleTool,
+		"tool_call_id": toolCallID,
+		"tool_name":    toolName,
+		"content":      content,
+	}
+}
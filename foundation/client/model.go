@@ -1,7 +1,9 @@
 package client
 
 import (
+	"cmp"
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -19,6 +21,24 @@ func (err *Error) Error() string {
 	return err.Message
 }
 
+// UnmarshalJSON accepts the error as a string or as an object with a message,
+// like the errors OpenAI and Azure return, or as a message at the top level
+// like the errors AWS returns.
+func (err *Error) UnmarshalJSON(b []byte) error {
+	var tmp struct {
+		Error   StreamError `json:"error"`
+		Message string      `json:"message"`
+	}
+
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return err
+	}
+
+	err.Message = cmp.Or(tmp.Error.Message, tmp.Message)
+
+	return nil
+}
+
 // =============================================================================
 
 type Time struct {
@@ -93,19 +113,95 @@ type ChatDeltaSSE struct {
 	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
 }
 
+// Set of reasons a model stops generating that are reported in the
+// finish_reason field.
+const (
+	FinishStop          = "stop"
+	FinishLength        = "length"
+	FinishToolCalls     = "tool_calls"
+	FinishContentFilter = "content_filter"
+)
+
 type ChatChoiceSSE struct {
 	Index        int          `json:"index"`
 	Delta        ChatDeltaSSE `json:"delta"`
 	FinishReason string       `json:"finish_reason"`
 }
 
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
 type ChatSSE struct {
 	ID      string          `json:"id"`
 	Object  string          `json:"object"`
 	Created Time            `json:"created"`
 	Model   string          `json:"model"`
 	Choices []ChatChoiceSSE `json:"choices"`
-	Error   string          `json:"error"`
+	Usage   *Usage          `json:"usage,omitempty"`
+	Error   *StreamError    `json:"error,omitempty"`
+}
+
+// StreamError represents an error the server sends in the stream instead of
+// a chunk, like when the model is overloaded halfway through a response.
+// Servers send either a plain string or an object with a message.
+type StreamError struct {
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+	Code    string `json:"code,omitempty"`
+}
+
+// Set of error types the client reports in the stream itself.
+const (
+	ErrorTypeInvalidChunk   = "invalid_chunk"   // A chunk couldn't be decoded
+	ErrorTypeConnectionLost = "connection_lost" // The connection dropped and couldn't be resumed
+)
+
+func (err *StreamError) Error() string {
+	switch {
+	case err.Type != "" && err.Code != "":
+		return fmt.Sprintf("%s: %s (%s)", err.Type, err.Message, err.Code)
+	case err.Type != "":
+		return fmt.Sprintf("%s: %s", err.Type, err.Message)
+	case err.Code != "":
+		return fmt.Sprintf("%s (%s)", err.Message, err.Code)
+	}
+
+	return err.Message
+}
+
+func (err *StreamError) UnmarshalJSON(b []byte) error {
+	var msg string
+	if json.Unmarshal(b, &msg) == nil {
+		*err = StreamError{Message: msg}
+		return nil
+	}
+
+	// The code is a number on some servers and a string on others.
+	var tmp struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Code    json.RawMessage `json:"code"`
+	}
+
+	if err := json.Unmarshal(b, &tmp); err != nil {
+		return err
+	}
+
+	code := strings.Trim(string(tmp.Code), "\"")
+	if code == "null" {
+		code = ""
+	}
+
+	*err = StreamError{
+		Message: tmp.Message,
+		Type:    tmp.Type,
+		Code:    code,
+	}
+
+	return nil
 }
 
 // =============================================================================
@@ -116,8 +212,9 @@ type ChatMessage struct {
 }
 
 type ChatChoice struct {
-	Index   int         `json:"index"`
-	Message ChatMessage `json:"message"`
+	Index        int         `json:"index"`
+	Message      ChatMessage `json:"message"`
+	FinishReason string      `json:"finish_reason"`
 }
 
 type Chat struct {
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// ErrHostNotAllowed is returned for a request to a host the client isn't
+// allowed to reach.
+var ErrHostNotAllowed = errors.New("host is not allowed")
+
+// WithAllowedHosts limits the client to the hosts, for air-gapped setups
+// that must not reach anything but the local inference server. A request to
+// another host fails with ErrHostNotAllowed before anything is sent, which
+// includes the requests mapped to Azure, the token requests of the cloud
+// providers and the redirects. The hosts are compared by name, without the
+// port.
+func WithAllowedHosts(hosts ...string) func(cln *Client) {
+	return func(cln *Client) {
+		for _, host := range hosts {
+			cln.allowedHosts = append(cln.allowedHosts, strings.ToLower(host))
+		}
+	}
+}
+
+// checkHost returns an error if the client isn't allowed to reach the host
+// of the endpoint.
+func (cln *Client) checkHost(endpoint string) error {
+	if cln.allowedHosts == nil {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("parse endpoint: %w", err)
+	}
+
+	return cln.checkURL(u)
+}
+
+// checkURL returns an error if the client isn't allowed to reach the host of
+// the url. The requests are checked again once they are prepared, since
+// Azure and the provider adapters can change the url.
+func (cln *Client) checkURL(u *url.URL) error {
+	if cln.allowedHosts == nil {
+		return nil
+	}
+
+	if !slices.Contains(cln.allowedHosts, strings.ToLower(u.Hostname())) {
+		return fmt.Errorf("%s: %w", u.Hostname(), ErrHostNotAllowed)
+	}
+
+	return nil
+}
+
+// checkRedirect wraps the redirect policy of the http client so a redirect
+// to a host that isn't allowed is refused. Without a policy the http
+// package's limit of 10 redirects applies.
+func (cln *Client) checkRedirect(next func(req *http.Request, via []*http.Request) error) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if err := cln.checkURL(req.URL); err != nil {
+			return err
+		}
+
+		if next != nil {
+			return next(req, via)
+		}
+
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+
+		return nil
+	}
+}
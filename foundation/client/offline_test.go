@@ -0,0 +1,71 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestAllowedHosts(t *testing.T) {
+	var hits int
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+
+		// localhost is the same server under a name that isn't allowed.
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, strings.Replace("http://"+r.Host, "127.0.0.1", "localhost", 1)+"/v1/models", http.StatusFound)
+			return
+		}
+
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {}
+
+	t.Run("allowed", func(t *testing.T) {
+		cln := client.New(logger, client.WithAllowedHosts("127.0.0.1"))
+
+		var v map[string]any
+		if err := cln.Do(context.Background(), http.MethodGet, srv.URL+"/v1/models", nil, &v); err != nil {
+			t.Fatalf("got error %s, want the request to be sent", err)
+		}
+	})
+
+	t.Run("redirect", func(t *testing.T) {
+		cln := client.New(logger, client.WithAllowedHosts("127.0.0.1"))
+
+		hits = 0
+		var v map[string]any
+		err := cln.Do(context.Background(), http.MethodGet, srv.URL+"/redirect", nil, &v)
+		if !errors.Is(err, client.ErrHostNotAllowed) {
+			t.Fatalf("got error %v, want %v", err, client.ErrHostNotAllowed)
+		}
+
+		if hits != 1 {
+			t.Errorf("got %d requests, want the redirect not to be followed", hits)
+		}
+	})
+
+	t.Run("azure", func(t *testing.T) {
+		az := client.Azure{Endpoint: "https://my-resource.openai.azure.com", Deployment: "gpt", APIKey: "key"}
+		cln := client.New(logger, client.WithAzure(az), client.WithAllowedHosts("127.0.0.1"))
+
+		hits = 0
+		var v map[string]any
+		err := cln.Do(context.Background(), http.MethodPost, srv.URL+"/v1/chat/completions", client.D{"model": "gpt"}, &v)
+		if !errors.Is(err, client.ErrHostNotAllowed) {
+			t.Fatalf("got error %v, want %v", err, client.ErrHostNotAllowed)
+		}
+
+		if hits != 0 {
+			t.Errorf("got %d requests, want none", hits)
+		}
+	})
+}
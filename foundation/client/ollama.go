@@ -0,0 +1,404 @@
+package client
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TransportOllama streams responses from an Ollama server using its native
+// /api/chat endpoint instead of the OpenAI compatible API. The OpenAI
+// compatible endpoint ignores the options object, the native one applies it.
+const TransportOllama = "ollama"
+
+// OllamaOptions represents the model parameters Ollama takes in the options
+// object of a request, instead of at the top level like the OpenAI fields.
+// Only the parameters that are set are sent, the others keep the defaults of
+// the model.
+//
+//	numCtx := 32768
+//	d := client.ChatRequest(model, conversation,
+//		client.WithOllamaOptions(client.OllamaOptions{NumCtx: &numCtx}),
+//	)
+type OllamaOptions struct {
+	NumCtx        *int     `json:"num_ctx,omitempty"`        // Size of the context window in tokens.
+	NumGPU        *int     `json:"num_gpu,omitempty"`        // Layers offloaded to the GPU, 0 runs on the CPU and -1 lets Ollama decide.
+	NumThread     *int     `json:"num_thread,omitempty"`     // Threads used on the CPU, 0 lets Ollama decide.
+	RepeatPenalty *float64 `json:"repeat_penalty,omitempty"` // How strongly repetitions are penalized, 1 is no penalty.
+	Seed          *int     `json:"seed,omitempty"`           // Seed of the sampling, the same seed gives the same output.
+	Mirostat      *int     `json:"mirostat,omitempty"`       // Mirostat sampling: 0 disabled, 1 or 2 for its version.
+	MirostatEta   *float64 `json:"mirostat_eta,omitempty"`   // How fast mirostat reacts to the output.
+	MirostatTau   *float64 `json:"mirostat_tau,omitempty"`   // Balance of mirostat between coherence and diversity.
+}
+
+// Validate checks the parameters are in the range Ollama accepts. Ollama
+// ignores or clamps the values it doesn't understand, which hides mistakes.
+func (o OllamaOptions) Validate() error {
+	if o.NumCtx != nil && *o.NumCtx < 1 {
+		return fmt.Errorf("num_ctx %d must be at least 1", *o.NumCtx)
+	}
+
+	if o.NumGPU != nil && *o.NumGPU < -1 {
+		return fmt.Errorf("num_gpu %d must be -1 or more", *o.NumGPU)
+	}
+
+	if o.NumThread != nil && *o.NumThread < 0 {
+		return fmt.Errorf("num_thread %d can't be negative", *o.NumThread)
+	}
+
+	if o.RepeatPenalty != nil && *o.RepeatPenalty < 0 {
+		return fmt.Errorf("repeat_penalty %v can't be negative", *o.RepeatPenalty)
+	}
+
+	if o.Mirostat != nil && (*o.Mirostat < 0 || *o.Mirostat > 2) {
+		return fmt.Errorf("mirostat %d must be 0, 1 or 2", *o.Mirostat)
+	}
+
+	if o.MirostatEta != nil && *o.MirostatEta <= 0 {
+		return fmt.Errorf("mirostat_eta %v must be positive", *o.MirostatEta)
+	}
+
+	if o.MirostatTau != nil && *o.MirostatTau <= 0 {
+		return fmt.Errorf("mirostat_tau %v must be positive", *o.MirostatTau)
+	}
+
+	return nil
+}
+
+// IsZero reports if none of the parameters are set.
+func (o OllamaOptions) IsZero() bool {
+	return o == OllamaOptions{}
+}
+
+// WithOllamaOptions sets the parameters that are set in the options object
+// of the request. The options already in the request are kept unless they
+// are set again, so the option can be applied more than once. Call Validate
+// first, the values aren't checked here.
+func WithOllamaOptions(o OllamaOptions) func(d D) {
+	return func(d D) {
+		if o.IsZero() {
+			return
+		}
+
+		options, _ := d["options"].(D)
+		if options == nil {
+			options = D{}
+		}
+
+		set := func(name string, value any) {
+			switch v := value.(type) {
+			case *int:
+				if v != nil {
+					options[name] = *v
+				}
+			case *float64:
+				if v != nil {
+					options[name] = *v
+				}
+			}
+		}
+
+		set("num_ctx", o.NumCtx)
+		set("num_gpu", o.NumGPU)
+		set("num_thread", o.NumThread)
+		set("repeat_penalty", o.RepeatPenalty)
+		set("seed", o.Seed)
+		set("mirostat", o.Mirostat)
+		set("mirostat_eta", o.MirostatEta)
+		set("mirostat_tau", o.MirostatTau)
+
+		d["options"] = options
+	}
+}
+
+// =============================================================================
+
+// OllamaClient adapts OpenAI style chat requests to the native Ollama chat
+// API. The messages, tools and tool calls are converted into the native
+// format, the OpenAI sampling fields are sent as options, and the native
+// stream is converted back into ChatSSE values, so agent code doesn't need
+// to change.
+type OllamaClient struct {
+	*Client
+}
+
+// NewOllama constructs a client for the native Ollama chat API.
+func NewOllama(log Logger, options ...func(cln *Client)) *OllamaClient {
+	cln := New(log, options...)
+
+	return &OllamaClient{
+		Client: cln,
+	}
+}
+
+// Do converts the chat request into a native chat request and streams the
+// response into the channel. The endpoint can be the base url of the server
+// or the OpenAI chat completions url, which is useful when switching an
+// existing example over to the native API.
+func (cln *OllamaClient) Do(ctx context.Context, method string, endpoint string, body D, ch chan ChatSSE) error {
+	if cln.schema != "" {
+		if err := ValidateChatRequest(cln.schema, body); err != nil {
+			return err
+		}
+	}
+
+	req, err := parseChatRequest(body)
+	if err != nil {
+		return err
+	}
+
+	chat, err := ollamaRequest(req, body)
+	if err != nil {
+		return err
+	}
+
+	base := strings.TrimSuffix(strings.TrimSuffix(endpoint, "/"), "/v1/chat/completions")
+
+	resp, err := do(ctx, cln.Client, http.MethodPost, base+"/api/chat", chat, nil)
+	if err != nil {
+		return err
+	}
+
+	go func(ctx context.Context) {
+		defer func() {
+			resp.Body.Close()
+			close(ch)
+		}()
+
+		var toolIndex int
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			line := scanner.Text()
+			if line == "" {
+				continue
+			}
+
+			var chunk ollamaChunk
+			if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+				cln.log(ctx, "ollamaclient: rawRequest:", "Unmarshal", err, "line", line)
+
+				sendErrorChunk(ctx, ErrorTypeInvalidChunk, fmt.Sprintf("decoding stream: %s", err), ch)
+				return
+			}
+
+			sse := chunk.toChatSSE(cmp.Or(chunk.Model, req.Model), &toolIndex)
+
+			select {
+			case ch <- sse:
+
+			case <-ctx.Done():
+				cln.log(ctx, "ollamaclient: rawRequest:", "Context", ctx.Err().Error())
+				return
+			}
+
+			if sse.Error != nil || chunk.Done {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			cln.log(ctx, "ollamaclient: rawRequest:", "Scan", err)
+			sendErrorChunk(ctx, ErrorTypeConnectionLost, err.Error(), ch)
+		}
+	}(ctx)
+
+	return nil
+}
+
+// ollamaRequest converts the chat request into a native chat request. Images
+// are sent base64 encoded with their message, tool call arguments are sent
+// as objects and the sampling fields go into the options. The options
+// already in the request win over the OpenAI fields.
+func ollamaRequest(req chatRequest, body D) (D, error) {
+	var toolCalls map[string]string
+
+	messages := make([]D, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		m := D{
+			"role":    msg.Role,
+			"content": msg.text(),
+		}
+
+		var images []string
+		for _, part := range msg.parts() {
+			if part.Type != "image_url" {
+				continue
+			}
+
+			_, data, err := part.image()
+			if err != nil {
+				return nil, fmt.Errorf("ollama: %w", err)
+			}
+			images = append(images, base64.StdEncoding.EncodeToString(data))
+		}
+		if len(images) > 0 {
+			m["images"] = images
+		}
+
+		switch msg.Role {
+		case RoleDeveloper:
+			m["role"] = RoleSystem
+
+		case RoleUser:
+			toolCalls = nil
+
+		case RoleAssistant:
+			if len(msg.ToolCalls) > 0 {
+				calls := make([]D, len(msg.ToolCalls))
+				for i, toolCall := range msg.ToolCalls {
+					calls[i] = D{
+						"function": D{
+							"name":      toolCall.Function.Name,
+							"arguments": toolCall.arguments(),
+						},
+					}
+				}
+				m["tool_calls"] = calls
+			}
+			toolCalls = msg.toolCallNames()
+
+		case RoleTool:
+			if name := cmp.Or(msg.ToolName, toolCalls[msg.ToolCallID]); name != "" {
+				m["tool_name"] = name
+			}
+		}
+
+		messages = append(messages, m)
+	}
+
+	options := D{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		options["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		options["top_p"] = *req.TopP
+	}
+	if req.TopK != nil {
+		options["top_k"] = *req.TopK
+	}
+	if stop := req.stop(); len(stop) > 0 {
+		options["stop"] = stop
+	}
+	if seed, exists := body["seed"]; exists {
+		options["seed"] = seed
+	}
+
+	if o, ok := body["options"].(D); ok {
+		for k, v := range o {
+			options[k] = v
+		}
+	}
+
+	chat := D{
+		"model":    req.Model,
+		"messages": messages,
+		"stream":   true,
+	}
+
+	if len(options) > 0 {
+		chat["options"] = options
+	}
+
+	if tools, exists := body["tools"]; exists {
+		chat["tools"] = tools
+	}
+
+	if keepAlive, exists := body["keep_alive"]; exists {
+		chat["keep_alive"] = keepAlive
+	}
+
+	// Ollama takes the reasoning effort of the models that support it in
+	// the think field.
+	if effort, ok := body["reasoning_effort"].(string); ok && effort != "" {
+		chat["think"] = effort
+	}
+
+	return chat, nil
+}
+
+// =============================================================================
+
+// ollamaChunk represents a line streamed from the native /api/chat endpoint.
+type ollamaChunk struct {
+	Model   string `json:"model"`
+	Message struct {
+		Content   string `json:"content"`
+		Thinking  string `json:"thinking"`
+		ToolCalls []struct {
+			ID       string `json:"id"`
+			Function struct {
+				Name      string         `json:"name"`
+				Arguments map[string]any `json:"arguments"`
+			} `json:"function"`
+		} `json:"tool_calls"`
+	} `json:"message"`
+	Done            bool         `json:"done"`
+	DoneReason      string       `json:"done_reason"`
+	PromptEvalCount int          `json:"prompt_eval_count"`
+	EvalCount       int          `json:"eval_count"`
+	Error           *StreamError `json:"error"`
+}
+
+func (c ollamaChunk) toChatSSE(model string, toolIndex *int) ChatSSE {
+	if c.Error != nil {
+		return ChatSSE{Object: "chat.completion.chunk", Model: model, Error: c.Error}
+	}
+
+	delta := ChatDeltaSSE{
+		Content:   c.Message.Content,
+		Reasoning: c.Message.Thinking,
+	}
+
+	// Ollama sends every tool call whole, older versions without an id.
+	for _, toolCall := range c.Message.ToolCalls {
+		arguments := toolCall.Function.Arguments
+		if arguments == nil {
+			arguments = make(map[string]any)
+		}
+
+		delta.ToolCalls = append(delta.ToolCalls, ToolCall{
+			ID:    cmp.Or(toolCall.ID, "call_"+rand.Text()),
+			Index: *toolIndex,
+			Type:  "function",
+			Function: Function{
+				Name:      toolCall.Function.Name,
+				Arguments: arguments,
+			},
+		})
+		*toolIndex++
+	}
+
+	// The final line reports the tokens.
+	var usage *Usage
+	var finishReason string
+	if c.Done {
+		usage = &Usage{
+			PromptTokens:     c.PromptEvalCount,
+			CompletionTokens: c.EvalCount,
+			TotalTokens:      c.PromptEvalCount + c.EvalCount,
+		}
+
+		switch {
+		case c.DoneReason == "length":
+			finishReason = FinishLength
+		case *toolIndex > 0:
+			finishReason = FinishToolCalls
+		default:
+			finishReason = FinishStop
+		}
+	}
+
+	return chatChunk("", model, delta, finishReason, usage)
+}
@@ -0,0 +1,116 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+func TestOllamaChat(t *testing.T) {
+	var path string
+	var req map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		json.NewDecoder(r.Body).Decode(&req)
+
+		fmt.Fprintln(w, `{"model":"mock","message":{"role":"assistant","content":"","thinking":"Read it."},"done":false}`)
+		fmt.Fprintln(w, `{"model":"mock","message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"tool_read_file","arguments":{"path":"go.mod"}}}]},"done":false}`)
+		fmt.Fprintln(w, `{"model":"mock","message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":12,"eval_count":5}`)
+	}))
+	defer srv.Close()
+
+	logger := func(ctx context.Context, msg string, v ...any) {
+		t.Log(append([]any{msg}, v...)...)
+	}
+
+	numCtx := 32768
+	body := client.ChatRequest("mock", []client.D{
+		client.User("read go.mod"),
+		{"role": "assistant", "tool_calls": []client.D{{"id": "call-1", "type": "function", "function": client.D{"name": "tool_list_files", "arguments": `{"path":"."}`}}}},
+		{"role": "tool", "tool_call_id": "call-1", "content": "go.mod"},
+	},
+		client.WithTemperature(0.2),
+		client.WithStream(true),
+		client.WithOllamaOptions(client.OllamaOptions{NumCtx: &numCtx}),
+	)
+
+	cln := client.NewOllama(logger)
+
+	ch := make(chan client.ChatSSE, 100)
+	if err := cln.Do(context.Background(), http.MethodPost, srv.URL+"/v1/chat/completions", body, ch); err != nil {
+		t.Fatalf("chat: %s", err)
+	}
+
+	var reasoning strings.Builder
+	var toolCalls []client.ToolCall
+	var finishReason string
+	var usage *client.Usage
+	for chunk := range ch {
+		if chunk.Error != nil {
+			t.Fatalf("unexpected stream error: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			reasoning.WriteString(choice.Delta.Reasoning)
+			toolCalls = append(toolCalls, choice.Delta.ToolCalls...)
+			if choice.FinishReason != "" {
+				finishReason = choice.FinishReason
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+
+	// The request goes to the native endpoint with the options applied.
+	if path != "/api/chat" {
+		t.Errorf("got path %q, want /api/chat", path)
+	}
+
+	options, _ := req["options"].(map[string]any)
+	if options["num_ctx"] != float64(numCtx) || options["temperature"] != 0.2 {
+		t.Errorf("got options %v, want num_ctx and temperature", options)
+	}
+
+	messages, _ := req["messages"].([]any)
+	if len(messages) != 3 {
+		t.Fatalf("got %d messages, want 3", len(messages))
+	}
+
+	assistant, _ := messages[1].(map[string]any)
+	calls, _ := assistant["tool_calls"].([]any)
+	if len(calls) != 1 {
+		t.Fatalf("got tool calls %v in the assistant message, want 1", assistant["tool_calls"])
+	}
+	fn, _ := calls[0].(map[string]any)["function"].(map[string]any)
+	if args, ok := fn["arguments"].(map[string]any); !ok || args["path"] != "." {
+		t.Errorf("got arguments %v, want an object with the path", fn["arguments"])
+	}
+
+	if tool, _ := messages[2].(map[string]any); tool["tool_name"] != "tool_list_files" {
+		t.Errorf("got tool name %v in the tool result, want tool_list_files", tool["tool_name"])
+	}
+
+	// The native stream comes back as chat chunks.
+	if got := reasoning.String(); got != "Read it." {
+		t.Errorf("got reasoning %q, want %q", got, "Read it.")
+	}
+
+	if len(toolCalls) != 1 || toolCalls[0].ID == "" || toolCalls[0].Function.Name != "tool_read_file" || toolCalls[0].Function.Arguments["path"] != "go.mod" {
+		t.Errorf("got tool calls %+v, want tool_read_file(path: go.mod) with an id", toolCalls)
+	}
+
+	if finishReason != client.FinishToolCalls {
+		t.Errorf("got finish reason %q, want %q", finishReason, client.FinishToolCalls)
+	}
+
+	if usage == nil || usage.PromptTokens != 12 || usage.CompletionTokens != 5 {
+		t.Errorf("got usage %+v, want 12 prompt and 5 completion tokens", usage)
+	}
+}
@@ -0,0 +1,229 @@
+package client
+
+import (
+	"strings"
+	"time"
+)
+
+// ChatRequest constructs the body for a chat completion request. The options
+// are applied in order so later options override earlier ones.
+//
+//	d := client.ChatRequest(model, conversation,
+//		client.WithStream(true),
+//		client.WithStop("\n\n"),
+//	)
+func ChatRequest(model string, messages []D, options ...func(d D)) D {
+	d := D{
+		"model":    model,
+		"messages": messages,
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	return d
+}
+
+// WithStream sets if the response should be streamed.
+func WithStream(stream bool) func(d D) {
+	return func(d D) {
+		d["stream"] = stream
+	}
+}
+
+// WithStreamUsage asks the server to send the token usage in a final chunk
+// when streaming. Servers that don't support the option ignore it.
+func WithStreamUsage() func(d D) {
+	return func(d D) {
+		d["stream_options"] = D{"include_usage": true}
+	}
+}
+
+// WithMaxTokens sets the maximum number of tokens to generate.
+func WithMaxTokens(maxTokens int) func(d D) {
+	return func(d D) {
+		d["max_tokens"] = maxTokens
+	}
+}
+
+// WithTemperature sets the randomness of the sampling.
+func WithTemperature(temperature float64) func(d D) {
+	return func(d D) {
+		d["temperature"] = temperature
+	}
+}
+
+// WithTopP sets the nucleus sampling threshold.
+func WithTopP(topP float64) func(d D) {
+	return func(d D) {
+		d["top_p"] = topP
+	}
+}
+
+// WithTopK sets the number of tokens considered at each step.
+func WithTopK(topK int) func(d D) {
+	return func(d D) {
+		d["top_k"] = topK
+	}
+}
+
+// WithSeed sets the seed of the sampling. The same seed, with the same
+// settings, model and server version, generates the same response, which
+// makes demos reproducible. Not every server honors it.
+func WithSeed(seed int) func(d D) {
+	return func(d D) {
+		d["seed"] = seed
+	}
+}
+
+// WithKeepAlive sets how long Ollama keeps the model in memory after the
+// request, a negative duration keeps it loaded until the server stops and
+// zero unloads it right away. It's sent in seconds, which Ollama's native
+// endpoints and newer versions of its OpenAI endpoint understand, other
+// servers ignore it.
+func WithKeepAlive(keepAlive time.Duration) func(d D) {
+	return func(d D) {
+		if keepAlive < 0 {
+			d["keep_alive"] = -1
+			return
+		}
+
+		d["keep_alive"] = keepAlive.Seconds()
+	}
+}
+
+// WithTools sets the tools the model is allowed to call.
+func WithTools(tools []D) func(d D) {
+	return func(d D) {
+		d["tools"] = tools
+	}
+}
+
+// Set of tool choices that don't name a specific tool.
+const (
+	ToolChoiceAuto     = "auto"     // The model decides whether to call a tool
+	ToolChoiceNone     = "none"     // The model must answer without tools
+	ToolChoiceRequired = "required" // The model must call at least one tool
+)
+
+// WithToolChoice sets whether the model calls tools. Any value other than
+// auto, none or required is taken as the name of the tool the model is forced
+// to call, which makes the response deterministic and is how structured data
+// is extracted with a function call.
+func WithToolChoice(choice string) func(d D) {
+	return func(d D) {
+		switch choice {
+		case ToolChoiceAuto, ToolChoiceNone, ToolChoiceRequired:
+			d["tool_choice"] = choice
+
+		default:
+			d["tool_choice"] = D{
+				"type": "function",
+				"function": D{
+					"name": choice,
+				},
+			}
+		}
+	}
+}
+
+// WithStop sets the sequences that will stop the generation. Most providers
+// support up to 4 sequences. Use TrimStop on the accumulated content since
+// some providers echo the stop sequence back.
+func WithStop(stop ...string) func(d D) {
+	return func(d D) {
+		d["stop"] = stop
+	}
+}
+
+// =============================================================================
+
+// TrimStop removes any echoed stop sequence, and anything generated after it,
+// from the content.
+func TrimStop(content string, stop []string) string {
+	for _, s := range stop {
+		if s == "" {
+			continue
+		}
+
+		if idx := strings.Index(content, s); idx != -1 {
+			content = content[:idx]
+		}
+	}
+
+	return content
+}
+
+// =============================================================================
+
+// Set of providers that take reasoning controls in different ways.
+const (
+	ProviderOpenAI    = "openai"    // reasoning_effort field
+	ProviderAnthropic = "anthropic" // thinking.budget_tokens field
+	ProviderPrompt    = "prompt"    // "Reasoning: <effort>" line in the system prompt
+)
+
+// Set of reasoning efforts.
+const (
+	EffortLow    = "low"
+	EffortMedium = "medium"
+	EffortHigh   = "high"
+)
+
+// thinkingBudgets maps the reasoning efforts to a token budget for providers
+// that take a budget instead of an effort.
+var thinkingBudgets = map[string]int{
+	EffortLow:    1024,
+	EffortMedium: 4096,
+	EffortHigh:   16384,
+}
+
+// WithReasoningEffort sets how much the model should reason before answering
+// using the field the provider understands. Models like gpt-oss served by
+// Ollama also follow a "Reasoning: high" line in the system prompt, which is
+// used for the prompt provider. Apply this option after the messages are set.
+func WithReasoningEffort(provider string, effort string) func(d D) {
+	return func(d D) {
+		switch provider {
+		case ProviderAnthropic:
+			budget, exists := thinkingBudgets[effort]
+			if !exists {
+				budget = thinkingBudgets[EffortMedium]
+			}
+
+			d["thinking"] = D{
+				"type":          "enabled",
+				"budget_tokens": budget,
+			}
+
+		case ProviderPrompt:
+			d["messages"] = withReasoningPrompt(d["messages"], effort)
+
+		default:
+			d["reasoning_effort"] = effort
+		}
+	}
+}
+
+// withReasoningPrompt adds the reasoning line to the system prompt, adding a
+// system prompt if there isn't one. The messages are copied so the caller's
+// conversation isn't changed.
+func withReasoningPrompt(v any, effort string) []D {
+	messages, _ := v.([]D)
+	line := "Reasoning: " + effort
+
+	if len(messages) > 0 && messages[0]["role"] == "system" {
+		system := make(D, len(messages[0]))
+		for k, v := range messages[0] {
+			system[k] = v
+		}
+
+		content, _ := system["content"].(string)
+		system["content"] = strings.TrimRight(content, "\n") + "\n\n" + line
+
+		return append([]D{system}, messages[1:]...)
+	}
+
+	return append([]D{{"role": "system", "content": line}}, messages...)
+}
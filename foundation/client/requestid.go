@@ -0,0 +1,21 @@
+package client
+
+import "context"
+
+// RequestIDHeader is the header the request id is sent in, so the lines the
+// server logs for a request can be matched with the client's.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context that carries the request id. Every request
+// made with the context sends it in the X-Request-ID header.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id the context carries, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ToolDocument generates the tool document that is provided to the model from
+// a parameter struct. Each exported field becomes a parameter named after its
+// json tag. Use the `description` tag to document the parameter and the `enum`
+// tag for a comma separated list of allowed values. A field is required unless
+// its json tag has the omitempty option.
+//
+//	type params struct {
+//		Path string `json:"path" description:"Relative path of the file"`
+//		Mode string `json:"mode,omitempty" description:"How to open" enum:"read,write"`
+//	}
+func ToolDocument(name string, description string, params any) D {
+	return D{
+		"type": "function",
+		"function": D{
+			"name":        name,
+			"description": description,
+			"parameters":  schemaFor(reflect.TypeOf(params)),
+		},
+	}
+}
+
+// Decode unmarshals the function arguments into the specified parameter
+// struct, validating that all the required parameters are present. The struct
+// should be the same one used to generate the tool document.
+func (f Function) Decode(params any) error {
+	rt := reflect.TypeOf(params)
+	if rt == nil || rt.Kind() != reflect.Pointer || rt.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("decode: params must be a pointer to a struct, got %T", params)
+	}
+
+	for _, field := range schemaFields(rt.Elem()) {
+		if !field.required {
+			continue
+		}
+
+		if v, exists := f.Arguments[field.name]; !exists || v == nil {
+			return fmt.Errorf("missing required parameter %q", field.name)
+		}
+	}
+
+	data, err := json.Marshal(f.Arguments)
+	if err != nil {
+		return fmt.Errorf("decode: marshal: %w", err)
+	}
+
+	if err := json.Unmarshal(data, params); err != nil {
+		return fmt.Errorf("decode: invalid parameters: %w", err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+type schemaField struct {
+	name     string
+	index    int
+	required bool
+}
+
+func schemaFields(rt reflect.Type) []schemaField {
+	var fields []schemaField
+
+	for i := range rt.NumField() {
+		sf := rt.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, schemaField{
+			name:     name,
+			index:    i,
+			required: !strings.Contains(opts, "omitempty"),
+		})
+	}
+
+	return fields
+}
+
+func schemaFor(rt reflect.Type) D {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+
+	switch rt.Kind() {
+	case reflect.String:
+		return D{"type": "string"}
+
+	case reflect.Bool:
+		return D{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return D{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return D{"type": "number"}
+
+	case reflect.Slice, reflect.Array:
+		return D{"type": "array", "items": schemaFor(rt.Elem())}
+
+	case reflect.Map:
+		return D{"type": "object"}
+
+	case reflect.Struct:
+		properties := D{}
+		required := []string{}
+
+		for _, field := range schemaFields(rt) {
+			sf := rt.Field(field.index)
+
+			prop := schemaFor(sf.Type)
+			if v := sf.Tag.Get("description"); v != "" {
+				prop["description"] = v
+			}
+			if v := sf.Tag.Get("enum"); v != "" {
+				prop["enum"] = strings.Split(v, ",")
+			}
+
+			properties[field.name] = prop
+			if field.required {
+				required = append(required, field.name)
+			}
+		}
+
+		return D{
+			"type":       "object",
+			"properties": properties,
+			"required":   required,
+		}
+	}
+
+	return D{}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// TransportConfig represents how the client connects to the server. The zero
+// value connects like the default client. The WebSocket transport only uses
+// the TLS settings.
+type TransportConfig struct {
+	Proxy              string // URL of the proxy, HTTP_PROXY and HTTPS_PROXY are used when empty.
+	CABundle           string // PEM file with CA certificates to trust on top of the system ones.
+	InsecureSkipVerify bool   // Don't verify the server's certificate, for lab setups only.
+	UnixSocket         string // Unix domain socket to connect to instead of the host in the URL.
+}
+
+// NewTransport constructs an HTTP transport with the settings in the config,
+// to be used with WithTransport.
+//
+//	transport, err := client.NewTransport(client.TransportConfig{
+//		UnixSocket: "/run/llama.sock",
+//	})
+//	cln := client.New(logger, client.WithTransport(transport))
+//
+// With a unix socket the host in the request URL is ignored, so any host like
+// http://localhost/v1/chat/completions works.
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	t := newTransport()
+
+	if cfg.Proxy != "" {
+		if cfg.UnixSocket != "" {
+			return nil, errors.New("a proxy can't be used with a unix socket")
+		}
+
+		u, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parse proxy: %w", err)
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	if cfg.UnixSocket != "" {
+		var d net.Dialer
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, _ string, _ string) (net.Conn, error) {
+			return d.DialContext(ctx, "unix", cfg.UnixSocket)
+		}
+	}
+
+	if cfg.CABundle != "" || cfg.InsecureSkipVerify {
+		tlsConfig := tls.Config{
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		}
+
+		if cfg.CABundle != "" {
+			pool, err := certPool(cfg.CABundle)
+			if err != nil {
+				return nil, err
+			}
+			tlsConfig.RootCAs = pool
+		}
+
+		t.TLSClientConfig = &tlsConfig
+	}
+
+	return t, nil
+}
+
+// WithTransport sets the transport used to connect to the server.
+func WithTransport(transport http.RoundTripper) func(cln *Client) {
+	return func(cln *Client) {
+		cln.http = &http.Client{
+			Transport: transport,
+		}
+	}
+}
+
+// =============================================================================
+
+// newTransport constructs a transport with the settings of the default
+// client.
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 15 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// certPool returns the system certificates with the ones in the PEM file
+// added.
+func certPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read ca bundle: %w", err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+
+	return pool, nil
+}
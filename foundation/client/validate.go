@@ -0,0 +1,484 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Set of schemas chat requests can be validated against.
+const (
+	SchemaOpenAI   = "openai"   // OpenAI chat completions
+	SchemaOllama   = "ollama"   // OpenAI plus the fields Ollama adds
+	SchemaLlamaCPP = "llamacpp" // OpenAI plus the llama.cpp sampling fields
+)
+
+// ValidationError represents the problems found in a request. All of them
+// are reported at once so they can be fixed together.
+type ValidationError struct {
+	Schema   string
+	Problems []string
+}
+
+// Error implements the error interface.
+func (ve *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s chat request: %s", ve.Schema, strings.Join(ve.Problems, "; "))
+}
+
+// WithStrict turns on the validation of chat requests against the specified
+// schema. Requests with unknown fields, like tool_selection instead of
+// tool_choice, or values of the wrong type fail before the HTTP call is made
+// instead of being silently ignored by the server.
+func WithStrict(schema string) func(cln *Client) {
+	return func(cln *Client) {
+		cln.schema = schema
+	}
+}
+
+// validate checks the body of requests to a chat completions endpoint when
+// strict mode is turned on.
+func (cln *Client) validate(endpoint string, body any) error {
+	if cln.schema == "" {
+		return nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil || !strings.HasSuffix(u.Path, "/chat/completions") {
+		return nil
+	}
+
+	return ValidateChatRequest(cln.schema, body)
+}
+
+// =============================================================================
+
+// kind represents the JSON type of a field.
+type kind string
+
+const (
+	kindString  kind = "string"
+	kindNumber  kind = "number"
+	kindInteger kind = "integer"
+	kindBool    kind = "boolean"
+	kindArray   kind = "array"
+	kindObject  kind = "object"
+	kindAny     kind = "any"
+)
+
+// fieldSpec describes a field of a request.
+type fieldSpec struct {
+	kinds    []kind
+	enum     []string
+	min, max float64 // Range of a number when max is not zero.
+}
+
+func spec(kinds ...kind) fieldSpec {
+	return fieldSpec{kinds: kinds}
+}
+
+// openAIFields describes the fields of an OpenAI chat completions request.
+var openAIFields = map[string]fieldSpec{
+	"model":                 spec(kindString),
+	"messages":              spec(kindArray),
+	"stream":                spec(kindBool),
+	"stream_options":        spec(kindObject),
+	"max_tokens":            {kinds: []kind{kindInteger}, min: 1, max: 1 << 31},
+	"max_completion_tokens": {kinds: []kind{kindInteger}, min: 1, max: 1 << 31},
+	"temperature":           {kinds: []kind{kindNumber}, min: 0, max: 2},
+	"top_p":                 {kinds: []kind{kindNumber}, min: 0, max: 1},
+	"n":                     {kinds: []kind{kindInteger}, min: 1, max: 128},
+	"stop":                  spec(kindString, kindArray),
+	"presence_penalty":      {kinds: []kind{kindNumber}, min: -2, max: 2},
+	"frequency_penalty":     {kinds: []kind{kindNumber}, min: -2, max: 2},
+	"logit_bias":            spec(kindObject),
+	"logprobs":              spec(kindBool),
+	"top_logprobs":          {kinds: []kind{kindInteger}, min: 0, max: 20},
+	"seed":                  spec(kindInteger),
+	"user":                  spec(kindString),
+	"tools":                 spec(kindArray),
+	"tool_choice":           spec(kindString, kindObject),
+	"parallel_tool_calls":   spec(kindBool),
+	"response_format":       spec(kindObject),
+	"reasoning_effort":      {kinds: []kind{kindString}, enum: []string{"minimal", EffortLow, EffortMedium, EffortHigh}},
+	"metadata":              spec(kindObject),
+	"store":                 spec(kindBool),
+}
+
+// schemas maps the schemas to their fields. The compatible servers accept
+// the OpenAI fields plus their own.
+var schemas = map[string]map[string]fieldSpec{
+	SchemaOpenAI: openAIFields,
+	SchemaOllama: withFields(openAIFields, map[string]fieldSpec{
+		"top_k":      {kinds: []kind{kindInteger}, min: 0, max: 1 << 31},
+		"keep_alive": spec(kindString, kindNumber),
+		"think":      spec(kindBool, kindString),
+		"options":    spec(kindObject),
+	}),
+	SchemaLlamaCPP: withFields(openAIFields, map[string]fieldSpec{
+		"top_k":                {kinds: []kind{kindInteger}, min: 0, max: 1 << 31},
+		"min_p":                {kinds: []kind{kindNumber}, min: 0, max: 1},
+		"repeat_penalty":       spec(kindNumber),
+		"cache_prompt":         spec(kindBool),
+		"chat_template_kwargs": spec(kindObject),
+		"thinking":             spec(kindObject),
+	}),
+}
+
+// commonMistakes maps fields that look right but aren't part of any schema
+// to the field that was meant.
+var commonMistakes = map[string]string{
+	"tool_selection":  "tool_choice",
+	"tools_choice":    "tool_choice",
+	"function_call":   "tool_choice",
+	"functions":       "tools",
+	"max_length":      "max_tokens",
+	"max_new_tokens":  "max_tokens",
+	"num_predict":     "max_tokens",
+	"stop_sequences":  "stop",
+	"system":          "messages with a system role",
+	"prompt":          "messages",
+	"streaming":       "stream",
+	"include_usage":   "stream_options.include_usage",
+	"reasoning":       "reasoning_effort",
+	"response_schema": "response_format",
+	"num_ctx":         "options.num_ctx",
+	"num_gpu":         "options.num_gpu",
+	"num_thread":      "options.num_thread",
+	"mirostat":        "options.mirostat",
+}
+
+// ollamaOptionFields describes the options of an Ollama request that are
+// checked. Ollama has more options, the others aren't reported as unknown.
+var ollamaOptionFields = map[string]fieldSpec{
+	"num_ctx":        {kinds: []kind{kindInteger}, min: 1, max: 1 << 31},
+	"num_gpu":        {kinds: []kind{kindInteger}, min: -1, max: 1 << 31},
+	"num_thread":     {kinds: []kind{kindInteger}, min: 0, max: 1 << 31},
+	"repeat_penalty": {kinds: []kind{kindNumber}, min: 0, max: 1 << 31},
+	"seed":           spec(kindInteger),
+	"mirostat":       {kinds: []kind{kindInteger}, min: 0, max: 2},
+	"mirostat_eta":   spec(kindNumber),
+	"mirostat_tau":   spec(kindNumber),
+}
+
+var messageRoles = []string{RoleSystem, RoleDeveloper, RoleUser, RoleAssistant, RoleTool}
+
+// ValidateChatRequest checks the chat request against the schema. The
+// request can be a D or any value that marshals to a JSON object.
+func ValidateChatRequest(schema string, body any) error {
+	fields, exists := schemas[schema]
+	if !exists {
+		return fmt.Errorf("unknown schema %q", schema)
+	}
+
+	// Round trip the request so the checks only deal with JSON types.
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("marshal request: %w", err)
+	}
+
+	var d map[string]any
+	if err := json.Unmarshal(data, &d); err != nil {
+		return fmt.Errorf("request is not a JSON object: %w", err)
+	}
+
+	ve := ValidationError{Schema: schema}
+	problem := func(format string, args ...any) {
+		ve.Problems = append(ve.Problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, name := range []string{"model", "messages"} {
+		if _, exists := d[name]; !exists {
+			problem("missing required field %q", name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(d)) {
+		value := d[name]
+
+		fs, known := fields[name]
+		if !known {
+			problem("unknown field %q%s", name, suggestion(name, fields))
+			continue
+		}
+
+		// Null is the same as leaving the field out.
+		if value == nil {
+			continue
+		}
+
+		if err := fs.check(value); err != nil {
+			problem("field %q %s", name, err)
+		}
+	}
+
+	if messages, ok := d["messages"].([]any); ok {
+		checkMessages(messages, problem)
+		checkConversation(messages, problem)
+	}
+
+	if tools, ok := d["tools"].([]any); ok {
+		checkTools(tools, problem)
+	}
+
+	if choice, exists := d["tool_choice"]; exists {
+		checkToolChoice(choice, d["tools"], problem)
+	}
+
+	if options, ok := d["options"].(map[string]any); ok && schema == SchemaOllama {
+		checkOllamaOptions(options, problem)
+	}
+
+	if len(ve.Problems) > 0 {
+		return &ve
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+func (fs fieldSpec) check(value any) error {
+	k := kindOf(value)
+
+	ok := slices.Contains(fs.kinds, k) || slices.Contains(fs.kinds, kindAny)
+	if !ok && k == kindInteger {
+		ok = slices.Contains(fs.kinds, kindNumber)
+	}
+	if !ok {
+		return fmt.Errorf("must be %s, got %s", joinKinds(fs.kinds), k)
+	}
+
+	if len(fs.enum) > 0 {
+		if s, _ := value.(string); !slices.Contains(fs.enum, s) {
+			return fmt.Errorf("must be one of %s, got %q", strings.Join(fs.enum, ", "), s)
+		}
+	}
+
+	if n, isNumber := value.(float64); isNumber && fs.max != 0 && (n < fs.min || n > fs.max) {
+		return fmt.Errorf("must be between %g and %g, got %g", fs.min, fs.max, n)
+	}
+
+	return nil
+}
+
+func checkMessages(messages []any, problem func(string, ...any)) {
+	if len(messages) == 0 {
+		problem("messages must not be empty")
+	}
+
+	for i, v := range messages {
+		msg, ok := v.(map[string]any)
+		if !ok {
+			problem("messages[%d] must be an object", i)
+			continue
+		}
+
+		role, _ := msg["role"].(string)
+		if !slices.Contains(messageRoles, role) {
+			problem("messages[%d] role must be one of %s, got %q", i, strings.Join(messageRoles, ", "), role)
+		}
+
+		switch msg["content"].(type) {
+		case string, []any:
+		case nil:
+			if _, hasCalls := msg["tool_calls"]; role != "assistant" || !hasCalls {
+				problem("messages[%d] is missing the content", i)
+			}
+		default:
+			problem("messages[%d] content must be a string or an array of parts", i)
+		}
+
+		if role == "tool" {
+			if id, _ := msg["tool_call_id"].(string); id == "" {
+				problem("messages[%d] with the tool role needs a tool_call_id", i)
+			}
+		}
+	}
+}
+
+// checkConversation reports the order of the messages providers reject. It
+// only runs when every message is an object, the other problems with the
+// messages are reported by checkMessages.
+func checkConversation(messages []any, problem func(string, ...any)) {
+	conversation := make([]D, len(messages))
+	for i, v := range messages {
+		msg, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		conversation[i] = msg
+	}
+
+	for _, cp := range CheckConversation(conversation) {
+		// Missing content is already reported.
+		if conversation[cp.Index]["content"] == nil {
+			continue
+		}
+		problem("messages[%d] %s", cp.Index, cp.Problem)
+	}
+}
+
+func checkTools(tools []any, problem func(string, ...any)) {
+	for i, v := range tools {
+		tool, ok := v.(map[string]any)
+		if !ok {
+			problem("tools[%d] must be an object", i)
+			continue
+		}
+
+		if tool["type"] != "function" {
+			problem("tools[%d] type must be \"function\", got %v", i, tool["type"])
+		}
+
+		fn, ok := tool["function"].(map[string]any)
+		if !ok {
+			problem("tools[%d] is missing the function object", i)
+			continue
+		}
+
+		if name, _ := fn["name"].(string); name == "" {
+			problem("tools[%d] function is missing the name", i)
+		}
+
+		if params, exists := fn["parameters"]; exists {
+			if _, ok := params.(map[string]any); !ok {
+				problem("tools[%d] function parameters must be a JSON schema object", i)
+			}
+		}
+	}
+}
+
+func checkToolChoice(choice any, tools any, problem func(string, ...any)) {
+	switch c := choice.(type) {
+	case string:
+		if !slices.Contains([]string{"none", "auto", "required"}, c) {
+			problem("tool_choice must be none, auto, required or a function object, got %q", c)
+		}
+
+	case map[string]any:
+		fn, _ := c["function"].(map[string]any)
+		name, _ := fn["name"].(string)
+		if c["type"] != "function" || name == "" {
+			problem(`tool_choice object must look like {"type": "function", "function": {"name": "..."}}`)
+			return
+		}
+
+		list, _ := tools.([]any)
+		for _, v := range list {
+			tool, _ := v.(map[string]any)
+			f, _ := tool["function"].(map[string]any)
+			if f["name"] == name {
+				return
+			}
+		}
+		problem("tool_choice names the function %q which isn't in tools", name)
+	}
+}
+
+func checkOllamaOptions(options map[string]any, problem func(string, ...any)) {
+	for _, name := range slices.Sorted(maps.Keys(options)) {
+		fs, known := ollamaOptionFields[name]
+		if !known || options[name] == nil {
+			continue
+		}
+
+		if err := fs.check(options[name]); err != nil {
+			problem("option %q %s", name, err)
+		}
+	}
+}
+
+// =============================================================================
+
+func kindOf(value any) kind {
+	switch v := value.(type) {
+	case string:
+		return kindString
+	case bool:
+		return kindBool
+	case float64:
+		if v == float64(int64(v)) {
+			return kindInteger
+		}
+		return kindNumber
+	case []any:
+		return kindArray
+	case map[string]any:
+		return kindObject
+	}
+
+	return "null"
+}
+
+func joinKinds(kinds []kind) string {
+	names := make([]string, len(kinds))
+	for i, k := range kinds {
+		names[i] = string(k)
+	}
+
+	return strings.Join(names, " or ")
+}
+
+// suggestion names the field that was probably meant.
+func suggestion(name string, fields map[string]fieldSpec) string {
+	if meant, exists := commonMistakes[name]; exists {
+		return fmt.Sprintf(", did you mean %q?", meant)
+	}
+
+	var others []string
+	for _, schema := range slices.Sorted(maps.Keys(schemas)) {
+		if _, exists := schemas[schema][name]; exists {
+			others = append(others, schema)
+		}
+	}
+
+	if len(others) > 0 {
+		return fmt.Sprintf(", it's only supported by %s", strings.Join(others, ", "))
+	}
+
+	best, bestDist := "", 3
+	for _, field := range slices.Sorted(maps.Keys(fields)) {
+		if d := editDistance(name, field); d < bestDist {
+			best, bestDist = field, d
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(", did you mean %q?", best)
+}
+
+// editDistance returns the Levenshtein distance between the strings.
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(b)]
+}
+
+func withFields(base map[string]fieldSpec, extra map[string]fieldSpec) map[string]fieldSpec {
+	fields := maps.Clone(base)
+	maps.Copy(fields, extra)
+
+	return fields
+}
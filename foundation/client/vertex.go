@@ -0,0 +1,491 @@
+package client
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// TransportVertex streams responses from a Gemini model on Google Vertex AI
+// using its native generateContent API instead of the OpenAI compatible API.
+const TransportVertex = "vertex"
+
+// VertexLocation is the Vertex AI region used when none is set.
+const VertexLocation = "us-central1"
+
+// Vertex represents the Google Cloud project and region the Gemini models
+// are served from.
+type Vertex struct {
+	Project         string // Google Cloud project id.
+	Location        string // Defaults to VertexLocation, global is supported too.
+	Endpoint        string // Defaults to the endpoint of the location, set for Private Service Connect and gateways.
+	Model           string // Model like gemini-2.5-flash, the model in the request is used when empty.
+	AccessToken     string // OAuth access token, fetched with the credentials file when empty.
+	CredentialsFile string // Service account key or application default credentials.
+}
+
+// VertexFromEnv returns the Vertex configuration in the environment
+// variables the Google Cloud SDKs use: GOOGLE_CLOUD_PROJECT,
+// GOOGLE_CLOUD_LOCATION, GOOGLE_OAUTH_ACCESS_TOKEN and
+// GOOGLE_APPLICATION_CREDENTIALS. The model is set with VERTEX_MODEL.
+//
+// Without a token or a credentials file, the application default credentials
+// of gcloud auth application-default login are used, then the token of
+// gcloud auth print-access-token.
+func VertexFromEnv() Vertex {
+	return Vertex{
+		Project:         os.Getenv("GOOGLE_CLOUD_PROJECT"),
+		Location:        os.Getenv("GOOGLE_CLOUD_LOCATION"),
+		Model:           os.Getenv("VERTEX_MODEL"),
+		AccessToken:     os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"),
+		CredentialsFile: os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"),
+	}
+}
+
+// url returns the url of the streaming operation for the model.
+func (vx Vertex) url(model string) (string, error) {
+	if vx.Project == "" {
+		return "", errors.New("vertex: the project is required, set GOOGLE_CLOUD_PROJECT")
+	}
+
+	model = cmp.Or(vx.Model, model)
+	if model == "" {
+		return "", errors.New("vertex: the model is required, set VERTEX_MODEL")
+	}
+
+	location := cmp.Or(vx.Location, VertexLocation)
+
+	endpoint := vx.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s-aiplatform.googleapis.com", location)
+		if location == "global" {
+			endpoint = "https://aiplatform.googleapis.com"
+		}
+	}
+
+	u := fmt.Sprintf("%s/v1/projects/%s/locations/%s/publishers/google/models/%s:streamGenerateContent?alt=sse", strings.TrimSuffix(endpoint, "/"), vx.Project, location, model)
+
+	return u, nil
+}
+
+// =============================================================================
+
+// VertexClient adapts OpenAI style chat requests to the Vertex AI Gemini API.
+// The messages, tools and tool calls are converted into the native format
+// and the native stream is converted back into ChatSSE values, so agent code
+// doesn't need to change.
+type VertexClient struct {
+	*Client
+	vertex Vertex
+	tokens *googleTokenSource
+
+	// Gemini returns a signature with the tool calls of thinking models that
+	// must be sent back with the calls, it's kept here by the id the call is
+	// given since the agent only keeps the id.
+	mu         sync.Mutex
+	signatures map[string]string
+}
+
+// NewVertex constructs a client for the Gemini models on Vertex AI. The
+// requests are authorized with an OAuth token for the credentials in the
+// configuration, see VertexFromEnv.
+func NewVertex(log Logger, vx Vertex, options ...func(cln *Client)) *VertexClient {
+	cln := New(log, options...)
+	cln.azure = nil
+
+	vc := VertexClient{
+		Client: cln,
+		vertex: vx,
+		tokens: &googleTokenSource{
+			http:            cln.http,
+			checkHost:       cln.checkHost,
+			accessToken:     vx.AccessToken,
+			credentialsFile: vx.CredentialsFile,
+		},
+		signatures: make(map[string]string),
+	}
+
+	cln.sign = vc.authorize
+
+	return &vc
+}
+
+// authorize adds the access token to the request.
+func (cln *VertexClient) authorize(req *http.Request, body []byte) error {
+	token, err := cln.tokens.Token(req.Context())
+	if err != nil {
+		return fmt.Errorf("vertex: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	return nil
+}
+
+// Do converts the chat request into a generateContent request and streams
+// the response into the channel. The endpoint is ignored since the url is
+// built from the project, the location and the model.
+func (cln *VertexClient) Do(ctx context.Context, method string, endpoint string, body D, ch chan ChatSSE) error {
+	if cln.schema != "" {
+		if err := ValidateChatRequest(cln.schema, body); err != nil {
+			return err
+		}
+	}
+
+	req, err := parseChatRequest(body)
+	if err != nil {
+		return err
+	}
+
+	generate, err := cln.request(req)
+	if err != nil {
+		return err
+	}
+
+	u, err := cln.vertex.url(req.Model)
+	if err != nil {
+		return err
+	}
+
+	resp, err := do(ctx, cln.Client, http.MethodPost, u, generate, nil)
+	if err != nil {
+		return err
+	}
+
+	go func(ctx context.Context) {
+		defer func() {
+			resp.Body.Close()
+			close(ch)
+		}()
+
+		model := cmp.Or(cln.vertex.Model, req.Model)
+
+		var toolIndex int
+
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+		for scanner.Scan() {
+			line, found := strings.CutPrefix(scanner.Text(), "data: ")
+			if !found || line == "" {
+				continue
+			}
+
+			var chunk vertexChunk
+			if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+				cln.log(ctx, "vertexclient: rawRequest:", "Unmarshal", err, "line", line)
+
+				sendErrorChunk(ctx, ErrorTypeInvalidChunk, fmt.Sprintf("decoding stream: %s", err), ch)
+				return
+			}
+
+			sse := cln.toChatSSE(chunk, model, &toolIndex)
+
+			select {
+			case ch <- sse:
+
+			case <-ctx.Done():
+				cln.log(ctx, "vertexclient: rawRequest:", "Context", ctx.Err().Error())
+				return
+			}
+
+			if sse.Error != nil {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			cln.log(ctx, "vertexclient: rawRequest:", "Scan", err)
+			sendErrorChunk(ctx, ErrorTypeConnectionLost, err.Error(), ch)
+		}
+	}(ctx)
+
+	return nil
+}
+
+// =============================================================================
+
+// request converts the chat request into a generateContent request. System
+// messages go into the system instruction, images are sent inline and the
+// tool calls and results become functionCall and functionResponse parts.
+// Consecutive messages with the same role are merged since the roles must
+// alternate.
+func (cln *VertexClient) request(req chatRequest) (D, error) {
+	var contents []D
+	var toolCalls map[string]string
+
+	add := func(role string, parts []D) {
+		if len(parts) == 0 {
+			return
+		}
+
+		if n := len(contents); n > 0 && contents[n-1]["role"] == role {
+			contents[n-1]["parts"] = append(contents[n-1]["parts"].([]D), parts...)
+			return
+		}
+
+		contents = append(contents, D{"role": role, "parts": parts})
+	}
+
+	for _, msg := range req.Messages {
+		switch msg.Role {
+		case RoleSystem, RoleDeveloper:
+
+		case RoleUser:
+			parts, err := vertexParts(msg.parts())
+			if err != nil {
+				return nil, err
+			}
+			add("user", parts)
+
+			toolCalls = nil
+
+		case RoleAssistant:
+			parts, err := vertexParts(msg.parts())
+			if err != nil {
+				return nil, err
+			}
+
+			for _, toolCall := range msg.ToolCalls {
+				part := D{
+					"functionCall": D{
+						"name": toolCall.Function.Name,
+						"args": toolCall.arguments(),
+					},
+				}
+				if signature := cln.signature(toolCall.ID); signature != "" {
+					part["thoughtSignature"] = signature
+				}
+				parts = append(parts, part)
+			}
+			add("model", parts)
+
+			toolCalls = msg.toolCallNames()
+
+		case RoleTool:
+			name, exists := toolCalls[msg.ToolCallID]
+			if !exists {
+				add("user", []D{{"text": msg.unansweredToolResult()}})
+				continue
+			}
+
+			add("user", []D{{
+				"functionResponse": D{
+					"name":     cmp.Or(msg.ToolName, name),
+					"response": D{"content": msg.text()},
+				},
+			}})
+		}
+	}
+
+	generate := D{
+		"contents": contents,
+	}
+
+	var system []D
+	for _, text := range req.system() {
+		system = append(system, D{"text": text})
+	}
+	if len(system) > 0 {
+		generate["systemInstruction"] = D{"parts": system}
+	}
+
+	config := D{}
+	if req.MaxTokens > 0 {
+		config["maxOutputTokens"] = req.MaxTokens
+	}
+	if req.Temperature != nil {
+		config["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		config["topP"] = *req.TopP
+	}
+	if req.TopK != nil {
+		config["topK"] = *req.TopK
+	}
+	if stop := req.stop(); len(stop) > 0 {
+		config["stopSequences"] = stop
+	}
+	if len(config) > 0 {
+		generate["generationConfig"] = config
+	}
+
+	if len(req.Tools) > 0 {
+		declarations := make([]D, len(req.Tools))
+		for i, tool := range req.Tools {
+			declarations[i] = D{
+				"name":                 tool.Function.Name,
+				"description":          tool.Function.Description,
+				"parametersJsonSchema": tool.Function.Parameters,
+			}
+		}
+		generate["tools"] = []D{{"functionDeclarations": declarations}}
+	}
+
+	return generate, nil
+}
+
+// vertexParts converts the parts of a message into Gemini parts.
+func vertexParts(parts []chatPart) ([]D, error) {
+	var converted []D
+	for _, part := range parts {
+		switch part.Type {
+		case "text":
+			if part.Text != "" {
+				converted = append(converted, D{"text": part.Text})
+			}
+
+		case "image_url":
+			mimeType, data, err := part.image()
+			if err != nil {
+				return nil, fmt.Errorf("vertex: %w", err)
+			}
+
+			converted = append(converted, D{
+				"inlineData": D{
+					"mimeType": mimeType,
+					"data":     data,
+				},
+			})
+		}
+	}
+
+	return converted, nil
+}
+
+func (cln *VertexClient) signature(id string) string {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+
+	return cln.signatures[id]
+}
+
+func (cln *VertexClient) keepSignature(id string, signature string) {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+
+	cln.signatures[id] = signature
+}
+
+// =============================================================================
+
+// vertexChunk represents a chunk streamed from streamGenerateContent.
+type vertexChunk struct {
+	ResponseID string `json:"responseId"`
+	Candidates []struct {
+		Content struct {
+			Parts []struct {
+				Text         string `json:"text"`
+				Thought      bool   `json:"thought"`
+				FunctionCall *struct {
+					ID   string         `json:"id"`
+					Name string         `json:"name"`
+					Args map[string]any `json:"args"`
+				} `json:"functionCall"`
+				ThoughtSignature string `json:"thoughtSignature"`
+			} `json:"parts"`
+		} `json:"content"`
+		FinishReason string `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback *struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata *struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	Error *StreamError `json:"error"`
+}
+
+func (cln *VertexClient) toChatSSE(chunk vertexChunk, model string, toolIndex *int) ChatSSE {
+	if chunk.Error != nil {
+		return ChatSSE{Object: "chat.completion.chunk", Model: model, Error: chunk.Error}
+	}
+
+	// The final chunk reports the tokens, the thinking tokens are output
+	// tokens too.
+	var usage *Usage
+	if u := chunk.UsageMetadata; u != nil && u.TotalTokenCount > 0 {
+		usage = &Usage{
+			PromptTokens:     u.PromptTokenCount,
+			CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+			TotalTokens:      u.TotalTokenCount,
+		}
+	}
+
+	// A prompt that is blocked gets no candidates.
+	if len(chunk.Candidates) == 0 {
+		var finishReason string
+		if chunk.PromptFeedback != nil && chunk.PromptFeedback.BlockReason != "" {
+			finishReason = FinishContentFilter
+		}
+		return chatChunk(chunk.ResponseID, model, ChatDeltaSSE{}, finishReason, usage)
+	}
+
+	candidate := chunk.Candidates[0]
+
+	var delta ChatDeltaSSE
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			id := cmp.Or(part.FunctionCall.ID, "call_"+rand.Text())
+			if part.ThoughtSignature != "" {
+				cln.keepSignature(id, part.ThoughtSignature)
+			}
+
+			arguments := part.FunctionCall.Args
+			if arguments == nil {
+				arguments = make(map[string]any)
+			}
+
+			delta.ToolCalls = append(delta.ToolCalls, ToolCall{
+				ID:    id,
+				Index: *toolIndex,
+				Type:  "function",
+				Function: Function{
+					Name:      part.FunctionCall.Name,
+					Arguments: arguments,
+				},
+			})
+			*toolIndex++
+
+		case part.Thought:
+			delta.Reasoning += part.Text
+
+		default:
+			delta.Content += part.Text
+		}
+	}
+
+	return chatChunk(chunk.ResponseID, model, delta, vertexFinishReason(candidate.FinishReason, *toolIndex > 0), usage)
+}
+
+// vertexFinishReason maps the reason Gemini stopped to the OpenAI one.
+// Gemini reports STOP after tool calls.
+func vertexFinishReason(finishReason string, toolCalls bool) string {
+	switch finishReason {
+	case "":
+		return ""
+	case "STOP":
+		if toolCalls {
+			return FinishToolCalls
+		}
+		return FinishStop
+	case "MAX_TOKENS":
+		return FinishLength
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return FinishContentFilter
+	}
+
+	return FinishStop
+}
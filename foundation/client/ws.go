@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+// Set of transports that can be used to stream responses.
+const (
+	TransportSSE = "sse"
+	TransportWS  = "ws"
+)
+
+// Streamer describes the behavior required to stream a response from a
+// chat service into a channel. The channel is closed when the response is
+// complete.
+type Streamer[T any] interface {
+	Do(ctx context.Context, method string, endpoint string, body D, ch chan T) error
+}
+
+// NewStreamer constructs a streaming client for the specified transport so
+// the transport can be selected through configuration. The Bedrock and
+// Vertex adapters are configured from the environment, see BedrockFromEnv
+// and VertexFromEnv.
+func NewStreamer[T any](transport string, log Logger, options ...func(cln *Client)) (Streamer[T], error) {
+	switch strings.ToLower(transport) {
+	case "", TransportSSE:
+		return NewSSE[T](log, options...), nil
+
+	case TransportWS:
+		return NewWS[T](log, options...), nil
+
+	case TransportLlamaCPP:
+		// The llama.cpp adapter only knows how to produce chat chunks.
+		streamer, ok := any(NewLlamaCPP(log, options...)).(Streamer[T])
+		if !ok {
+			return nil, fmt.Errorf("transport %q only supports ChatSSE", transport)
+		}
+		return streamer, nil
+
+	case TransportBedrock:
+		streamer, ok := any(NewBedrock(log, BedrockFromEnv(), options...)).(Streamer[T])
+		if !ok {
+			return nil, fmt.Errorf("transport %q only supports ChatSSE", transport)
+		}
+		return streamer, nil
+
+	case TransportOllama:
+		streamer, ok := any(NewOllama(log, options...)).(Streamer[T])
+		if !ok {
+			return nil, fmt.Errorf("transport %q only supports ChatSSE", transport)
+		}
+		return streamer, nil
+
+	case TransportVertex:
+		streamer, ok := any(NewVertex(log, VertexFromEnv(), options...)).(Streamer[T])
+		if !ok {
+			return nil, fmt.Errorf("transport %q only supports ChatSSE", transport)
+		}
+		return streamer, nil
+	}
+
+	return nil, fmt.Errorf("unknown transport %q", transport)
+}
+
+// =============================================================================
+
+// WSClient streams chat responses over a WebSocket connection. The request
+// body is sent as the first message and every message received after that
+// is decoded as a chunk until the server sends [DONE] or closes the
+// connection.
+type WSClient[T any] struct {
+	*Client
+}
+
+// NewWS constructs a WebSocket streaming client.
+func NewWS[T any](log Logger, options ...func(cln *Client)) *WSClient[T] {
+	cln := New(log, options...)
+
+	return &WSClient[T]{
+		Client: cln,
+	}
+}
+
+// Do opens a WebSocket connection to the endpoint and streams the response
+// into the channel. The method is ignored since WebSocket connections always
+// start with a GET, it exists so the client can be used as a Streamer.
+func (cln *WSClient[T]) Do(ctx context.Context, method string, endpoint string, body D, ch chan T) error {
+	if err := cln.checkHost(endpoint); err != nil {
+		return err
+	}
+
+	if err := cln.validate(endpoint, body); err != nil {
+		return err
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Errorf("parse endpoint: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+
+	origin := url.URL{Scheme: "http", Host: u.Host}
+	if u.Scheme == "wss" {
+		origin.Scheme = "https"
+	}
+
+	cfg, err := websocket.NewConfig(u.String(), origin.String())
+	if err != nil {
+		return fmt.Errorf("websocket config: %w", err)
+	}
+	cfg.Header.Set("User-Agent", fmt.Sprintf("Ardan Labs AI Training Sample Go Client: %s", version))
+
+	if id := RequestID(ctx); id != "" {
+		cfg.Header.Set(RequestIDHeader, id)
+	}
+
+	// Only the TLS settings of a configured transport apply to WebSockets.
+	if t, ok := cln.http.Transport.(*http.Transport); ok {
+		cfg.TlsConfig = t.TLSClientConfig
+	}
+
+	conn, err := cfg.DialContext(ctx)
+	if err != nil {
+		return fmt.Errorf("websocket dial: %w", transportError(err))
+	}
+
+	if err := websocket.JSON.Send(conn, body); err != nil {
+		conn.Close()
+		return fmt.Errorf("websocket send: %w", err)
+	}
+
+	go func(ctx context.Context) {
+		defer func() {
+			conn.Close()
+			close(ch)
+		}()
+
+		// Closing the connection is the only way to unblock a receive when
+		// the context is canceled.
+		stop := context.AfterFunc(ctx, func() {
+			conn.Close()
+		})
+		defer stop()
+
+		for {
+			var msg string
+			if err := websocket.Message.Receive(conn, &msg); err != nil {
+				if !errors.Is(err, io.EOF) && ctx.Err() == nil {
+					cln.log(ctx, "wsclient: rawRequest:", "Receive", err)
+				}
+				return
+			}
+
+			// Some gateways forward the SSE framing as is.
+			msg = strings.TrimPrefix(strings.TrimSpace(msg), "data: ")
+
+			if msg == "" {
+				continue
+			}
+
+			if msg == "[DONE]" {
+				return
+			}
+
+			var v T
+			if err := json.Unmarshal([]byte(msg), &v); err != nil {
+				cln.log(ctx, "wsclient: rawRequest:", "Unmarshal", err, "msg", msg)
+
+				sendErrorChunk(ctx, ErrorTypeInvalidChunk, fmt.Sprintf("decoding stream: %s", err), ch)
+				return
+			}
+
+			select {
+			case ch <- v:
+
+			case <-ctx.Done():
+				cln.log(ctx, "wsclient: rawRequest:", "Context", ctx.Err().Error())
+				return
+			}
+		}
+	}(ctx)
+
+	return nil
+}
@@ -0,0 +1,340 @@
+// Package exif provides support for reading the EXIF metadata of JPEG and PNG
+// images, like when and where a photo was taken and with which camera.
+package exif
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned when the image has no EXIF metadata.
+var ErrNotFound = errors.New("exif metadata not found")
+
+// Metadata represents the EXIF fields that are useful for searching photos.
+// Fields that are missing in the image are left as zero values.
+type Metadata struct {
+	Taken time.Time // When the photo was taken, in the camera's local time.
+	Make  string    // Camera maker.
+	Model string    // Camera model.
+	GPS   *GPS      // Where the photo was taken, nil if unknown.
+}
+
+// Camera returns the make and model of the camera as a single string.
+func (md Metadata) Camera() string {
+	// Most cameras repeat the make in the model.
+	if md.Make == "" || strings.HasPrefix(md.Model, md.Make) {
+		return md.Model
+	}
+
+	return strings.TrimSpace(md.Make + " " + md.Model)
+}
+
+// GPS represents the location the photo was taken at in decimal degrees.
+// Altitude is in meters above sea level.
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+	Altitude  float64
+}
+
+// Read extracts the EXIF metadata from a JPEG or PNG image.
+func Read(data []byte) (Metadata, error) {
+	var tiff []byte
+	var err error
+
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8}):
+		tiff, err = jpegExif(data)
+
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		tiff, err = pngExif(data)
+
+	default:
+		return Metadata{}, errors.New("unsupported image format")
+	}
+
+	if err != nil {
+		return Metadata{}, err
+	}
+
+	return parseTIFF(tiff)
+}
+
+// =============================================================================
+
+// jpegExif returns the TIFF data stored in the APP1 segment of a JPEG.
+func jpegExif(data []byte) ([]byte, error) {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil, errors.New("invalid jpeg segment")
+		}
+
+		marker := data[i+1]
+
+		// The metadata is always before the image data.
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return nil, errors.New("invalid jpeg segment size")
+		}
+
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+
+		i += 2 + size
+	}
+
+	return nil, ErrNotFound
+}
+
+// pngExif returns the TIFF data stored in the eXIf chunk of a PNG.
+func pngExif(data []byte) ([]byte, error) {
+	for i := 8; i+8 <= len(data); {
+		size := int(binary.BigEndian.Uint32(data[i:]))
+		typ := string(data[i+4 : i+8])
+
+		if size < 0 || i+12+size > len(data) {
+			return nil, errors.New("invalid png chunk size")
+		}
+
+		switch typ {
+		case "eXIf":
+			return data[i+8 : i+8+size], nil
+
+		case "IDAT", "IEND":
+			return nil, ErrNotFound
+		}
+
+		i += 12 + size
+	}
+
+	return nil, ErrNotFound
+}
+
+// =============================================================================
+
+// Set of tags that are read.
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+	tagGPSAltitudeRef   = 0x0005
+	tagGPSAltitude      = 0x0006
+)
+
+// typeSizes is the size in bytes of each TIFF field type.
+var typeSizes = map[uint16]int{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 7: 1, 9: 4, 10: 8,
+}
+
+// entry represents a single field of an image file directory.
+type entry struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+// tiff represents the TIFF structure that holds the EXIF fields.
+type tiff struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+func parseTIFF(data []byte) (Metadata, error) {
+	if len(data) < 8 {
+		return Metadata{}, errors.New("invalid tiff header")
+	}
+
+	t := tiff{data: data}
+
+	switch string(data[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return Metadata{}, errors.New("invalid tiff byte order")
+	}
+
+	ifd0, err := t.ifd(t.order.Uint32(data[4:]))
+	if err != nil {
+		return Metadata{}, fmt.Errorf("ifd0: %w", err)
+	}
+
+	md := Metadata{
+		Make:  t.ascii(ifd0[tagMake]),
+		Model: t.ascii(ifd0[tagModel]),
+	}
+
+	taken := t.ascii(ifd0[tagDateTime])
+
+	if e, exists := ifd0[tagExifIFD]; exists {
+		if exifIFD, err := t.ifd(t.uint(e)); err == nil {
+			if original := t.ascii(exifIFD[tagDateTimeOriginal]); original != "" {
+				taken = original
+			}
+		}
+	}
+
+	if ts, err := time.Parse("2006:01:02 15:04:05", taken); err == nil {
+		md.Taken = ts
+	}
+
+	if e, exists := ifd0[tagGPSIFD]; exists {
+		if gpsIFD, err := t.ifd(t.uint(e)); err == nil {
+			md.GPS = t.gps(gpsIFD)
+		}
+	}
+
+	return md, nil
+}
+
+// ifd reads the image file directory at the offset.
+func (t tiff) ifd(offset uint32) (map[uint16]entry, error) {
+	off := int(offset)
+	if off < 8 || off+2 > len(t.data) {
+		return nil, errors.New("invalid ifd offset")
+	}
+
+	n := int(t.order.Uint16(t.data[off:]))
+	if off+2+n*12 > len(t.data) {
+		return nil, errors.New("invalid ifd size")
+	}
+
+	entries := make(map[uint16]entry, n)
+	for i := range n {
+		raw := t.data[off+2+i*12:]
+
+		tag := t.order.Uint16(raw)
+		typ := t.order.Uint16(raw[2:])
+		count := int(t.order.Uint32(raw[4:]))
+
+		size, known := typeSizes[typ]
+		if !known || count < 0 || count > len(t.data) {
+			continue
+		}
+
+		// Values that fit in 4 bytes are stored in the entry itself.
+		value := raw[8:12]
+		if size*count > 4 {
+			start := int(t.order.Uint32(raw[8:]))
+			if start < 0 || start+size*count > len(t.data) {
+				continue
+			}
+			value = t.data[start : start+size*count]
+		}
+
+		entries[tag] = entry{typ: typ, count: count, value: value}
+	}
+
+	return entries, nil
+}
+
+// gps converts the GPS fields into decimal degrees. It returns nil if the
+// latitude or longitude is missing.
+func (t tiff) gps(ifd map[uint16]entry) *GPS {
+	lat, ok := t.degrees(ifd[tagGPSLatitude])
+	if !ok {
+		return nil
+	}
+
+	lon, ok := t.degrees(ifd[tagGPSLongitude])
+	if !ok {
+		return nil
+	}
+
+	if t.ascii(ifd[tagGPSLatitudeRef]) == "S" {
+		lat = -lat
+	}
+
+	if t.ascii(ifd[tagGPSLongitudeRef]) == "W" {
+		lon = -lon
+	}
+
+	g := GPS{
+		Latitude:  lat,
+		Longitude: lon,
+	}
+
+	if alt, ok := t.rational(ifd[tagGPSAltitude], 0); ok {
+		g.Altitude = alt
+		if ref := ifd[tagGPSAltitudeRef]; len(ref.value) > 0 && ref.value[0] == 1 {
+			g.Altitude = -alt
+		}
+	}
+
+	return &g
+}
+
+// degrees converts the degrees, minutes and seconds rationals to a decimal
+// value.
+func (t tiff) degrees(e entry) (float64, bool) {
+	if e.count < 3 {
+		return 0, false
+	}
+
+	var parts [3]float64
+	for i := range parts {
+		v, ok := t.rational(e, i)
+		if !ok {
+			return 0, false
+		}
+		parts[i] = v
+	}
+
+	return parts[0] + parts[1]/60 + parts[2]/3600, true
+}
+
+// rational returns the nth unsigned rational value of the entry.
+func (t tiff) rational(e entry, n int) (float64, bool) {
+	if e.typ != 5 || n >= e.count || len(e.value) < (n+1)*8 {
+		return 0, false
+	}
+
+	num := t.order.Uint32(e.value[n*8:])
+	den := t.order.Uint32(e.value[n*8+4:])
+	if den == 0 {
+		return 0, false
+	}
+
+	return float64(num) / float64(den), true
+}
+
+// ascii returns the string value of the entry.
+func (t tiff) ascii(e entry) string {
+	if e.typ != 2 {
+		return ""
+	}
+
+	s, _, _ := strings.Cut(string(e.value), "\x00")
+
+	return strings.TrimSpace(s)
+}
+
+// uint returns the value of a SHORT or LONG entry.
+func (t tiff) uint(e entry) uint32 {
+	switch {
+	case e.typ == 3 && len(e.value) >= 2:
+		return uint32(t.order.Uint16(e.value))
+	case e.typ == 4 && len(e.value) >= 4:
+		return t.order.Uint32(e.value)
+	}
+
+	return 0
+}
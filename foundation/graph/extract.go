@@ -0,0 +1,185 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+// extractPrompt asks the model for the entities and relations in a document.
+const extractPrompt = `Extract the knowledge graph from the document below.
+
+Find the entities: people, teams, organizations, services, systems, places,
+products, events and concepts. Give each a type and a one sentence
+description based only on what the document says. Use the full name of an
+entity the way the document writes it and use the same name every time.
+
+Find the relations between the entities. The type of a relation is a short
+verb phrase in upper snake case, like LEADS, OWNS, DEPENDS_ON, STORES_DATA_IN
+or CAUSED. Only use entities you listed and only relations the document
+states.
+
+Respond with JSON only, in this format:
+
+{
+  "entities": [
+    {"name": "...", "type": "...", "description": "..."}
+  ],
+  "relations": [
+    {"from": "...", "to": "...", "type": "...", "description": "..."}
+  ]
+}
+
+Document:
+
+%s`
+
+// Extractor uses a model to extract entities and relations from documents.
+type Extractor struct {
+	cln   *client.Client
+	url   string
+	model string
+}
+
+// NewExtractor constructs an extractor that uses the model served at the
+// chat completions url.
+func NewExtractor(cln *client.Client, url string, model string) *Extractor {
+	return &Extractor{
+		cln:   cln,
+		url:   url,
+		model: model,
+	}
+}
+
+// Extract returns the entities and relations the model finds in the text.
+// The source names the document so the graph can point back to it.
+func (ex *Extractor) Extract(ctx context.Context, source string, text string) ([]Entity, []Relation, error) {
+	d := client.ChatRequest(ex.model, []client.D{
+		client.User(fmt.Sprintf(extractPrompt, text)),
+	},
+		client.WithTemperature(0.0),
+		client.WithStream(false),
+	)
+
+	var resp client.Chat
+	if err := ex.cln.Do(ctx, http.MethodPost, ex.url, d, &resp); err != nil {
+		return nil, nil, fmt.Errorf("do: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, nil, fmt.Errorf("no response from the model")
+	}
+
+	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+	content = strings.TrimPrefix(content, "```json")
+	content = strings.TrimPrefix(content, "```")
+	content = strings.TrimSuffix(content, "```")
+
+	var sg Subgraph
+	if err := json.Unmarshal([]byte(content), &sg); err != nil {
+		return nil, nil, fmt.Errorf("decoding: response: %s: %w", content, err)
+	}
+
+	entities := make([]Entity, 0, len(sg.Entities))
+	for _, e := range sg.Entities {
+		e.Name = strings.TrimSpace(e.Name)
+		if e.Name == "" {
+			continue
+		}
+
+		e.Type = strings.ToLower(strings.TrimSpace(e.Type))
+		e.Sources = []string{source}
+		e.Embedding = nil
+		entities = append(entities, e)
+	}
+
+	relations := make([]Relation, 0, len(sg.Relations))
+	for _, r := range sg.Relations {
+		r.From = strings.TrimSpace(r.From)
+		r.To = strings.TrimSpace(r.To)
+		if r.From == "" || r.To == "" {
+			continue
+		}
+
+		r.Type = relationType(r.Type)
+		r.Source = source
+		relations = append(relations, r)
+	}
+
+	return entities, relations, nil
+}
+
+// relationType turns the relation types models come up with, like
+// "depends on" or "Depends-On", into DEPENDS_ON.
+func relationType(typ string) string {
+	typ = strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToUpper(typ))
+
+	if typ = strings.Join(strings.Fields(typ), "_"); typ == "" {
+		return "RELATED_TO"
+	}
+
+	return typ
+}
+
+// =============================================================================
+
+// Seeds returns the names of the entities a traversal for the question
+// should start from. These are the entities the question mentions by name
+// followed by the k entities most similar to the question's embedding, which
+// catches entities the question refers to in other words.
+func Seeds(entities []Entity, question string, embedding vector.Data, k int) []string {
+	var seeds []string
+	add := func(name string) {
+		if !slices.Contains(seeds, name) {
+			seeds = append(seeds, name)
+		}
+	}
+
+	q := " " + words(question) + " "
+	for _, e := range entities {
+		if name := words(e.Name); name != "" && strings.Contains(q, " "+name+" ") {
+			add(e.Name)
+		}
+	}
+
+	var data []vector.Data
+	for _, e := range entities {
+		if e.Embedding != nil {
+			data = append(data, e)
+		}
+	}
+
+	results := vector.Similarity(embedding, data...)
+	slices.SortFunc(results, func(a, b vector.SimilarityResult) int {
+		switch {
+		case a.Similarity > b.Similarity:
+			return -1
+		case a.Similarity < b.Similarity:
+			return 1
+		}
+		return 0
+	})
+
+	for _, result := range results[:min(k, len(results))] {
+		add(result.DataPoint.(Entity).Name)
+	}
+
+	return seeds
+}
+
+// words returns the lowercase words of the text separated by a space, so
+// names are found in questions regardless of punctuation.
+func words(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,148 @@
+// Package graph provides a knowledge graph of the entities and relations a
+// model extracts from documents, with an embedded and a Neo4j backend.
+// Walking the graph from the entities a question mentions finds the facts
+// that are several hops away, which a similarity search over chunks misses.
+package graph
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Entity represents a person, place, thing or concept found in the
+// documents. Entities are identified by their key, so the same entity
+// mentioned in several documents is stored once with all of its sources.
+type Entity struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Description string    `json:"description,omitempty"`
+	Sources     []string  `json:"sources,omitempty"`
+	Embedding   []float32 `json:"embedding,omitempty"`
+}
+
+// Key returns the key that identifies the entity.
+func (e Entity) Key() string {
+	return Key(e.Name)
+}
+
+// Vector implements the vector.Data interface.
+func (e Entity) Vector() []float32 {
+	return e.Embedding
+}
+
+// merge adds what the other mention of the entity knows. The longest
+// description is kept since it's usually the most informative.
+func (e Entity) merge(other Entity) Entity {
+	if e.Type == "" {
+		e.Type = other.Type
+	}
+
+	if len(other.Description) > len(e.Description) {
+		e.Description = other.Description
+	}
+
+	for _, source := range other.Sources {
+		if !slices.Contains(e.Sources, source) {
+			e.Sources = append(e.Sources, source)
+		}
+	}
+
+	if other.Embedding != nil {
+		e.Embedding = other.Embedding
+	}
+
+	return e
+}
+
+// Relation represents a directed relation between two entities, like
+// "Maria Lopez" LEADS "Payments". From and To are the names of the
+// entities.
+type Relation struct {
+	From        string `json:"from"`
+	To          string `json:"to"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Source      string `json:"source,omitempty"`
+}
+
+// String implements the fmt.Stringer interface.
+func (r Relation) String() string {
+	return fmt.Sprintf("%s -[%s]-> %s", r.From, r.Type, r.To)
+}
+
+// key returns the key that identifies the relation, the same relation found
+// in several documents is stored once.
+func (r Relation) key() string {
+	return Key(r.From) + "|" + Key(r.Type) + "|" + Key(r.To)
+}
+
+// Subgraph represents the part of the graph reached by a traversal.
+type Subgraph struct {
+	Entities  []Entity   `json:"entities"`
+	Relations []Relation `json:"relations"`
+}
+
+// Facts returns the subgraph as lines of text that can be given to a model,
+// the entities with their descriptions followed by the relations.
+func (sg Subgraph) Facts() string {
+	var b strings.Builder
+
+	for _, e := range sg.Entities {
+		b.WriteString(e.Name)
+		if e.Type != "" {
+			fmt.Fprintf(&b, " (%s)", e.Type)
+		}
+		if e.Description != "" {
+			fmt.Fprintf(&b, ": %s", e.Description)
+		}
+		b.WriteString("\n")
+	}
+
+	for _, r := range sg.Relations {
+		b.WriteString(r.String())
+		if r.Description != "" {
+			fmt.Fprintf(&b, ": %s", r.Description)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// Sources returns the documents the entities and relations were found in,
+// the chunks of these documents are good candidates for RAG.
+func (sg Subgraph) Sources() []string {
+	var sources []string
+	add := func(source string) {
+		if source != "" && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+
+	for _, e := range sg.Entities {
+		for _, source := range e.Sources {
+			add(source)
+		}
+	}
+
+	for _, r := range sg.Relations {
+		add(r.Source)
+	}
+
+	return sources
+}
+
+// Store represents the behavior of a graph store backend.
+type Store interface {
+	Add(ctx context.Context, entities []Entity, relations []Relation) error
+	Entities(ctx context.Context) ([]Entity, error)
+	Traverse(ctx context.Context, seeds []string, hops int) (Subgraph, error)
+}
+
+// Key returns the key for the name of an entity, names that only differ in
+// case or spacing are the same entity.
+func Key(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
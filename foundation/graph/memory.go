@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Memory is an embedded graph store that keeps the graph in memory. It can
+// be saved to a JSON file so the extraction doesn't have to run again.
+type Memory struct {
+	mu            sync.RWMutex
+	entities      map[string]Entity
+	entityOrder   []string
+	relations     map[string]Relation
+	relationOrder []string
+	adjacent      map[string][]string // Keys of the relations of each entity.
+}
+
+// NewMemory constructs an empty graph store.
+func NewMemory() *Memory {
+	return &Memory{
+		entities:  make(map[string]Entity),
+		relations: make(map[string]Relation),
+		adjacent:  make(map[string][]string),
+	}
+}
+
+// LoadMemory constructs a graph store with the graph saved in the file.
+func LoadMemory(path string) (*Memory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	var sg Subgraph
+	if err := json.Unmarshal(data, &sg); err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+
+	m := NewMemory()
+	if err := m.Add(context.Background(), sg.Entities, sg.Relations); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Save writes the graph to the file as JSON.
+func (m *Memory) Save(path string) error {
+	m.mu.RLock()
+	sg := m.subgraph(m.entityOrder, m.relationOrder)
+	m.mu.RUnlock()
+
+	data, err := json.Marshal(sg)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// Add merges the entities and relations into the graph. The entities a
+// relation connects are added if they don't exist yet.
+func (m *Memory) Add(ctx context.Context, entities []Entity, relations []Relation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range entities {
+		if e.Key() == "" {
+			return errors.New("entity without a name")
+		}
+		m.addEntity(e)
+	}
+
+	for _, r := range relations {
+		if Key(r.From) == "" || Key(r.To) == "" {
+			return fmt.Errorf("relation %s is missing an entity", r)
+		}
+
+		m.addEntity(Entity{Name: r.From})
+		m.addEntity(Entity{Name: r.To})
+
+		key := r.key()
+		if _, exists := m.relations[key]; exists {
+			continue
+		}
+
+		m.relations[key] = r
+		m.relationOrder = append(m.relationOrder, key)
+
+		from, to := Key(r.From), Key(r.To)
+		m.adjacent[from] = append(m.adjacent[from], key)
+		m.adjacent[to] = append(m.adjacent[to], key)
+	}
+
+	return nil
+}
+
+// Entities returns the entities in the order they were added.
+func (m *Memory) Entities(ctx context.Context) ([]Entity, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entities := make([]Entity, len(m.entityOrder))
+	for i, key := range m.entityOrder {
+		entities[i] = m.entities[key]
+	}
+
+	return entities, nil
+}
+
+// Traverse returns the entities within the number of hops of the seed
+// entities and the relations between them. Relations are followed in both
+// directions since a question can start at either end.
+func (m *Memory) Traverse(ctx context.Context, seeds []string, hops int) (Subgraph, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	visited := make(map[string]bool)
+	var entities []string
+	var frontier []string
+
+	for _, seed := range seeds {
+		key := Key(seed)
+		if _, exists := m.entities[key]; exists && !visited[key] {
+			visited[key] = true
+			entities = append(entities, key)
+			frontier = append(frontier, key)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var relations []string
+
+	for range hops {
+		var next []string
+		for _, key := range frontier {
+			for _, rkey := range m.adjacent[key] {
+				if !seen[rkey] {
+					seen[rkey] = true
+					relations = append(relations, rkey)
+				}
+
+				r := m.relations[rkey]
+				for _, other := range []string{Key(r.From), Key(r.To)} {
+					if !visited[other] {
+						visited[other] = true
+						entities = append(entities, other)
+						next = append(next, other)
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+
+	return m.subgraph(entities, relations), nil
+}
+
+// addEntity merges the entity into the graph. The caller must hold the lock.
+func (m *Memory) addEntity(e Entity) {
+	key := e.Key()
+
+	existing, exists := m.entities[key]
+	if !exists {
+		m.entities[key] = e
+		m.entityOrder = append(m.entityOrder, key)
+		return
+	}
+
+	m.entities[key] = existing.merge(e)
+}
+
+// subgraph returns the entities and relations with the keys. The caller
+// must hold the lock.
+func (m *Memory) subgraph(entities []string, relations []string) Subgraph {
+	sg := Subgraph{
+		Entities:  make([]Entity, len(entities)),
+		Relations: make([]Relation, len(relations)),
+	}
+
+	for i, key := range entities {
+		sg.Entities[i] = m.entities[key]
+	}
+
+	for i, key := range relations {
+		sg.Relations[i] = m.relations[key]
+	}
+
+	return sg
+}
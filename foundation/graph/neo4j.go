@@ -0,0 +1,280 @@
+package graph
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Neo4j is a graph store backed by a Neo4j database. It talks to the HTTP
+// Query API of Neo4j 5.19 and later, so no driver is needed. Entities are
+// stored as nodes with the Entity label and relations as RELATED
+// relationships with the type as a property, since Cypher can't take a
+// relationship type as a parameter.
+type Neo4j struct {
+	http     *http.Client
+	url      string
+	user     string
+	password string
+}
+
+// NewNeo4j constructs a graph store for the database. The url is the HTTP
+// address of the server, like http://localhost:7474.
+func NewNeo4j(url string, database string, user string, password string) *Neo4j {
+	return &Neo4j{
+		http:     http.DefaultClient,
+		url:      fmt.Sprintf("%s/db/%s/query/v2", strings.TrimSuffix(url, "/"), database),
+		user:     user,
+		password: password,
+	}
+}
+
+// Add merges the entities and relations into the graph. The entities a
+// relation connects are added if they don't exist yet.
+func (n *Neo4j) Add(ctx context.Context, entities []Entity, relations []Relation) error {
+	const mergeEntities = `
+	UNWIND $entities AS e
+	MERGE (n:Entity {key: e.key})
+	ON CREATE SET n.name = e.name, n.type = e.type, n.description = e.description, n.sources = e.sources, n.embedding = e.embedding
+	ON MATCH SET
+		n.type = CASE WHEN n.type = '' THEN e.type ELSE n.type END,
+		n.description = CASE WHEN size(e.description) > size(n.description) THEN e.description ELSE n.description END,
+		n.sources = n.sources + [s IN e.sources WHERE NOT s IN n.sources],
+		n.embedding = coalesce(e.embedding, n.embedding)`
+
+	const mergeRelations = `
+	UNWIND $relations AS r
+	MATCH (a:Entity {key: r.from}), (b:Entity {key: r.to})
+	MERGE (a)-[x:RELATED {type: r.type}]->(b)
+	ON CREATE SET x.description = r.description, x.source = r.source`
+
+	params := make([]map[string]any, 0, len(entities)+2*len(relations))
+	add := func(e Entity) {
+		if e.Sources == nil {
+			e.Sources = []string{}
+		}
+
+		var embedding any
+		if e.Embedding != nil {
+			embedding = e.Embedding
+		}
+
+		params = append(params, map[string]any{
+			"key":         e.Key(),
+			"name":        e.Name,
+			"type":        e.Type,
+			"description": e.Description,
+			"sources":     e.Sources,
+			"embedding":   embedding,
+		})
+	}
+
+	for _, e := range entities {
+		add(e)
+	}
+
+	rels := make([]map[string]any, len(relations))
+	for i, r := range relations {
+		add(Entity{Name: r.From})
+		add(Entity{Name: r.To})
+
+		rels[i] = map[string]any{
+			"from":        Key(r.From),
+			"to":          Key(r.To),
+			"type":        r.Type,
+			"description": r.Description,
+			"source":      r.Source,
+		}
+	}
+
+	if _, err := n.query(ctx, mergeEntities, map[string]any{"entities": params}); err != nil {
+		return fmt.Errorf("merge entities: %w", err)
+	}
+
+	if _, err := n.query(ctx, mergeRelations, map[string]any{"relations": rels}); err != nil {
+		return fmt.Errorf("merge relations: %w", err)
+	}
+
+	return nil
+}
+
+// Entities returns the entities in the graph.
+func (n *Neo4j) Entities(ctx context.Context) ([]Entity, error) {
+	const q = `
+	MATCH (n:Entity)
+	RETURN n.name, n.type, n.description, n.sources, n.embedding`
+
+	rows, err := n.query(ctx, q, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := make([]Entity, len(rows))
+	for i, row := range rows {
+		if err := decodeEntity(row, &entities[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return entities, nil
+}
+
+// Traverse returns the entities within the number of hops of the seed
+// entities and the relations between them. Relations are followed in both
+// directions since a question can start at either end.
+func (n *Neo4j) Traverse(ctx context.Context, seeds []string, hops int) (Subgraph, error) {
+	keys := make([]string, len(seeds))
+	for i, seed := range seeds {
+		keys[i] = Key(seed)
+	}
+
+	// The bounds of a variable length pattern can't be parameters.
+	q := fmt.Sprintf(`
+	MATCH (s:Entity) WHERE s.key IN $seeds
+	OPTIONAL MATCH p = (s)-[:RELATED*1..%d]-(:Entity)
+	UNWIND CASE WHEN p IS NULL THEN [null] ELSE relationships(p) END AS r
+	WITH s, r
+	RETURN s.name, s.type, s.description, s.sources,
+		startNode(r).name, startNode(r).type, startNode(r).description, startNode(r).sources,
+		endNode(r).name, endNode(r).type, endNode(r).description, endNode(r).sources,
+		r.type, r.description, r.source`, max(hops, 1))
+
+	rows, err := n.query(ctx, q, map[string]any{"seeds": keys})
+	if err != nil {
+		return Subgraph{}, err
+	}
+
+	var sg Subgraph
+	entities := make(map[string]bool)
+	relations := make(map[string]bool)
+
+	addEntity := func(values []json.RawMessage) error {
+		var e Entity
+		if err := decodeEntity(values, &e); err != nil {
+			return err
+		}
+
+		if e.Name != "" && !entities[e.Key()] {
+			entities[e.Key()] = true
+			sg.Entities = append(sg.Entities, e)
+		}
+
+		return nil
+	}
+
+	for _, row := range rows {
+		if len(row) != 15 {
+			return Subgraph{}, fmt.Errorf("unexpected row with %d values", len(row))
+		}
+
+		for _, i := range []int{0, 4, 8} {
+			if err := addEntity(row[i : i+4]); err != nil {
+				return Subgraph{}, err
+			}
+		}
+
+		// Seeds without relations have no relation in their row.
+		var r Relation
+		if err := decode(row[4], &r.From, row[8], &r.To, row[12], &r.Type, row[13], &r.Description, row[14], &r.Source); err != nil {
+			return Subgraph{}, err
+		}
+
+		if r.From != "" && !relations[r.key()] {
+			relations[r.key()] = true
+			sg.Relations = append(sg.Relations, r)
+		}
+	}
+
+	return sg, nil
+}
+
+// =============================================================================
+
+// query runs the statement and returns the values of the rows.
+func (n *Neo4j) query(ctx context.Context, statement string, params map[string]any) ([][]json.RawMessage, error) {
+	body, err := json.Marshal(map[string]any{
+		"statement":  statement,
+		"parameters": params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(n.user, n.password)
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read: %w", err)
+	}
+
+	var result struct {
+		Data struct {
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"data"`
+		Errors []struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("decoding: response: %s: %w", data, err)
+	}
+
+	if len(result.Errors) > 0 {
+		return nil, fmt.Errorf("neo4j: %s: %s", result.Errors[0].Code, result.Errors[0].Message)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("neo4j: status %d: %s", resp.StatusCode, data)
+	}
+
+	return result.Data.Values, nil
+}
+
+// decodeEntity decodes the name, type, description, sources and, when it's
+// there, the embedding of an entity.
+func decodeEntity(values []json.RawMessage, e *Entity) error {
+	if len(values) < 4 {
+		return fmt.Errorf("unexpected entity with %d values", len(values))
+	}
+
+	if err := decode(values[0], &e.Name, values[1], &e.Type, values[2], &e.Description, values[3], &e.Sources); err != nil {
+		return err
+	}
+
+	if len(values) > 4 {
+		return decode(values[4], &e.Embedding)
+	}
+
+	return nil
+}
+
+// decode decodes pairs of values and destinations, a null leaves the
+// destination as it is.
+func decode(pairs ...any) error {
+	for i := 0; i < len(pairs); i += 2 {
+		if err := json.Unmarshal(pairs[i].(json.RawMessage), pairs[i+1]); err != nil {
+			return fmt.Errorf("decoding: value: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+// Package logger provides support for structured logging to the console and
+// a rotating file, with the session and turn taken from the context so every
+// line can be traced back to the conversation that produced it.
+package logger
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+)
+
+// Config represents where the logs are written and how much detail goes to
+// each destination.
+type Config struct {
+	Console      io.Writer  // Human readable lines, nil silences the console.
+	ConsoleLevel slog.Level // Lowest level written to the console.
+	File         io.Writer  // JSON lines, nil turns off the file log.
+	FileLevel    slog.Level // Lowest level written to the file.
+}
+
+// New constructs a logger that writes to the destinations in the config.
+func New(cfg Config) *slog.Logger {
+	var handlers []slog.Handler
+
+	if cfg.Console != nil {
+		handlers = append(handlers, slog.NewTextHandler(cfg.Console, &slog.HandlerOptions{Level: cfg.ConsoleLevel}))
+	}
+
+	if cfg.File != nil {
+		handlers = append(handlers, slog.NewJSONHandler(cfg.File, &slog.HandlerOptions{Level: cfg.FileLevel}))
+	}
+
+	return slog.New(contextHandler{handler: multiHandler(handlers)})
+}
+
+// =============================================================================
+
+type ctxKey int
+
+const (
+	sessionKey ctxKey = iota + 1
+	turnKey
+	requestKey
+)
+
+// WithSession returns a context that carries the session id, it's added to
+// every line logged with the context.
+func WithSession(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, sessionKey, id)
+}
+
+// WithTurn returns a context that carries the number of the turn in the
+// session, it's added to every line logged with the context.
+func WithTurn(ctx context.Context, turn int) context.Context {
+	return context.WithValue(ctx, turnKey, turn)
+}
+
+// WithRequestID returns a context that carries the id of a request to a
+// server, it's added to every line logged with the context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestKey, id)
+}
+
+// contextHandler adds the session, turn and request from the context to the
+// records.
+type contextHandler struct {
+	handler slog.Handler
+}
+
+func (h contextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := ctx.Value(sessionKey).(string); ok {
+		r.AddAttrs(slog.String("session", id))
+	}
+
+	if turn, ok := ctx.Value(turnKey).(int); ok {
+		r.AddAttrs(slog.Int("turn", turn))
+	}
+
+	if id, ok := ctx.Value(requestKey).(string); ok {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+
+	return h.handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{handler: h.handler.WithGroup(name)}
+}
+
+// =============================================================================
+
+// multiHandler sends the records to every handler that is enabled for the
+// level.
+type multiHandler []slog.Handler
+
+func (mh multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range mh {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (mh multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, h := range mh {
+		if h.Enabled(ctx, r.Level) {
+			errs = append(errs, h.Handle(ctx, r.Clone()))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (mh multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(multiHandler, len(mh))
+	for i, h := range mh {
+		handlers[i] = h.WithAttrs(attrs)
+	}
+
+	return handlers
+}
+
+func (mh multiHandler) WithGroup(name string) slog.Handler {
+	handlers := make(multiHandler, len(mh))
+	for i, h := range mh {
+		handlers[i] = h.WithGroup(name)
+	}
+
+	return handlers
+}
@@ -0,0 +1,198 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the format of the time added to the name of a rotated
+// file, it sorts in the order the files were rotated.
+const backupTimeFormat = "20060102T150405.000"
+
+// RotatingFile represents a log file that is rotated when it gets too big or
+// too old. Rotated files are renamed with the time of the rotation, like
+// agent.20261018T150405.000.log, and only the newest backups are kept.
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	backups int
+
+	mu      sync.Mutex
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// NewRotatingFile opens the log file at the path for appending. The file is
+// rotated when a write would make it bigger than maxSize bytes or when it's
+// older than maxAge, a zero value turns off that check. The number of
+// rotated files that are kept is set by backups, 0 keeps all of them.
+func NewRotatingFile(path string, maxSize int64, maxAge time.Duration, backups int) (*RotatingFile, error) {
+	if maxSize < 0 || maxAge < 0 || backups < 0 {
+		return nil, errors.New("max size, max age and backups can't be negative")
+	}
+
+	rf := RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		backups: backups,
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create log dir: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+
+	return &rf, nil
+}
+
+// Write implements the io.Writer interface. A single write is never split
+// across files.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	tooBig := rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize
+	tooOld := rf.maxAge > 0 && time.Since(rf.created) > rf.maxAge
+
+	if tooBig || tooOld {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+// Close closes the file. Writes after the file is closed fail.
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+
+	return err
+}
+
+// =============================================================================
+
+func (rf *RotatingFile) open() error {
+	f, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat log file: %w", err)
+	}
+
+	// The modification time is the best guess for when an existing file was
+	// started, so a file left by an old run is rotated on the first write.
+	rf.file = f
+	rf.size = info.Size()
+	rf.created = time.Now()
+	if info.Size() > 0 {
+		rf.created = info.ModTime()
+	}
+
+	return nil
+}
+
+func (rf *RotatingFile) rotate() error {
+	if rf.file != nil {
+		if err := rf.file.Close(); err != nil {
+			return fmt.Errorf("close log file: %w", err)
+		}
+		rf.file = nil
+	}
+
+	if err := os.Rename(rf.path, rf.backupName(time.Now())); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("rename log file: %w", err)
+	}
+
+	if err := rf.open(); err != nil {
+		return err
+	}
+
+	// The created time of a new file is now, not its modification time.
+	rf.created = time.Now()
+
+	return rf.removeOldBackups()
+}
+
+// backupName returns the name of the rotated file, the time goes before the
+// extension so the backups keep it. The time is moved forward if a file was
+// already rotated in the same millisecond.
+func (rf *RotatingFile) backupName(t time.Time) string {
+	ext := filepath.Ext(rf.path)
+	base := strings.TrimSuffix(rf.path, ext)
+
+	for {
+		name := fmt.Sprintf("%s.%s%s", base, t.Format(backupTimeFormat), ext)
+		if _, err := os.Stat(name); errors.Is(err, os.ErrNotExist) {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func (rf *RotatingFile) removeOldBackups() error {
+	if rf.backups == 0 {
+		return nil
+	}
+
+	ext := filepath.Ext(rf.path)
+	pattern := strings.TrimSuffix(rf.path, ext) + ".*" + ext
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("list backups: %w", err)
+	}
+
+	var backups []string
+	for _, match := range matches {
+		if match != rf.path {
+			backups = append(backups, match)
+		}
+	}
+
+	if len(backups) <= rf.backups {
+		return nil
+	}
+
+	// The names sort in the order the files were rotated.
+	slices.Sort(backups)
+
+	for _, name := range backups[:len(backups)-rf.backups] {
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("remove backup: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,588 @@
+// Package lsp provides a minimal Language Server Protocol client that talks
+// to a language server like gopls over stdio using JSON-RPC.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// Position represents a zero based line and UTF-16 character offset.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range represents a span of text in a document.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// TextEdit represents a change to a document.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// Diagnostic represents a problem reported by the server.
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// SeverityName returns the name of the diagnostic severity.
+func (d Diagnostic) SeverityName() string {
+	switch d.Severity {
+	case 1:
+		return "error"
+	case 2:
+		return "warning"
+	case 3:
+		return "info"
+	}
+
+	return "hint"
+}
+
+// WorkspaceEdit represents changes to many documents. Servers use either
+// the changes map or the document changes list.
+type WorkspaceEdit struct {
+	Changes         map[string][]TextEdit `json:"changes"`
+	DocumentChanges []struct {
+		TextDocument struct {
+			URI string `json:"uri"`
+		} `json:"textDocument"`
+		Edits []TextEdit `json:"edits"`
+	} `json:"documentChanges"`
+}
+
+// Edits returns the edits of the workspace edit by file path.
+func (we WorkspaceEdit) Edits() map[string][]TextEdit {
+	edits := make(map[string][]TextEdit)
+
+	for uri, e := range we.Changes {
+		edits[URIToPath(uri)] = append(edits[URIToPath(uri)], e...)
+	}
+
+	for _, dc := range we.DocumentChanges {
+		path := URIToPath(dc.TextDocument.URI)
+		edits[path] = append(edits[path], dc.Edits...)
+	}
+
+	return edits
+}
+
+// =============================================================================
+
+// Client represents a connection to a language server process.
+type Client struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	wmu    sync.Mutex
+	mu     sync.Mutex
+	nextID int
+	calls  map[int]chan response
+	diags  map[string][]Diagnostic
+	notify chan string
+	opened map[string]openDoc
+	done   chan struct{}
+	err    error
+}
+
+type openDoc struct {
+	version int
+	text    string
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Start runs the language server and initializes it for the workspace root.
+func Start(ctx context.Context, root string, command string, args ...string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = root
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+
+	cln := Client{
+		cmd:    cmd,
+		stdin:  stdin,
+		calls:  make(map[int]chan response),
+		diags:  make(map[string][]Diagnostic),
+		notify: make(chan string, 100),
+		opened: make(map[string]openDoc),
+		done:   make(chan struct{}),
+	}
+
+	go cln.read(stdout)
+
+	params := map[string]any{
+		"processId": os.Getpid(),
+		"rootUri":   PathToURI(root),
+		"capabilities": map[string]any{
+			"textDocument": map[string]any{
+				"hover":              map[string]any{"contentFormat": []string{"plaintext"}},
+				"rename":             map[string]any{},
+				"publishDiagnostics": map[string]any{},
+			},
+			"workspace": map[string]any{
+				"workspaceEdit": map[string]any{"documentChanges": true},
+			},
+		},
+	}
+
+	if err := cln.Call(ctx, "initialize", params, nil); err != nil {
+		cln.Close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+
+	if err := cln.Notify("initialized", map[string]any{}); err != nil {
+		cln.Close()
+		return nil, fmt.Errorf("initialized: %w", err)
+	}
+
+	return &cln, nil
+}
+
+// Close asks the language server to shut down, killing it if it doesn't.
+func (cln *Client) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := cln.Call(ctx, "shutdown", nil, nil); err == nil {
+		cln.Notify("exit", nil)
+	} else {
+		cln.cmd.Process.Kill()
+	}
+
+	cln.stdin.Close()
+
+	return cln.cmd.Wait()
+}
+
+// Call sends a request and decodes the result into the value, which can be
+// nil if the result is not needed.
+func (cln *Client) Call(ctx context.Context, method string, params any, result any) error {
+	cln.mu.Lock()
+	if cln.err != nil {
+		cln.mu.Unlock()
+		return cln.err
+	}
+	cln.nextID++
+	id := cln.nextID
+	ch := make(chan response, 1)
+	cln.calls[id] = ch
+	cln.mu.Unlock()
+
+	defer func() {
+		cln.mu.Lock()
+		delete(cln.calls, id)
+		cln.mu.Unlock()
+	}()
+
+	if err := cln.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %s", method, resp.Error.Message)
+		}
+
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(resp.Result, result)
+
+	case <-cln.done:
+		return cln.closedErr()
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification, which has no response.
+func (cln *Client) Notify(method string, params any) error {
+	msg := map[string]any{"jsonrpc": "2.0", "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+
+	return cln.write(msg)
+}
+
+// Sync makes sure the server has the current content of the file on disk,
+// opening the document the first time. It reports whether the server was
+// sent new content.
+func (cln *Client) Sync(path string) (bool, error) {
+	path = absPath(path)
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	text := string(content)
+	uri := PathToURI(path)
+
+	cln.mu.Lock()
+	doc, exists := cln.opened[path]
+	cln.mu.Unlock()
+
+	switch {
+	case !exists:
+		doc = openDoc{version: 1, text: text}
+		err = cln.Notify("textDocument/didOpen", map[string]any{
+			"textDocument": map[string]any{"uri": uri, "languageId": languageID(path), "version": doc.version, "text": text},
+		})
+
+	case doc.text != text:
+		doc = openDoc{version: doc.version + 1, text: text}
+		err = cln.Notify("textDocument/didChange", map[string]any{
+			"textDocument":   map[string]any{"uri": uri, "version": doc.version},
+			"contentChanges": []map[string]any{{"text": text}},
+		})
+
+	default:
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	cln.mu.Lock()
+	cln.opened[path] = doc
+	cln.mu.Unlock()
+
+	return true, nil
+}
+
+// Diagnostics syncs the file and waits for the server to publish the
+// diagnostics for it. Servers publish diagnostics in stages, so after a
+// publish it waits for the settle duration in case more are coming.
+func (cln *Client) Diagnostics(ctx context.Context, path string, settle time.Duration) ([]Diagnostic, error) {
+	path = absPath(path)
+
+	// Drain notifications from earlier syncs.
+	for len(cln.notify) > 0 {
+		<-cln.notify
+	}
+
+	// Edits to the other open documents can change the diagnostics of
+	// this one, like a rename of a function it calls.
+	others, err := cln.SyncOpened(path)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := cln.Sync(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cln.mu.Lock()
+	diags, exists := cln.diags[path]
+	cln.mu.Unlock()
+
+	// The server only publishes again when the content changed.
+	var settled <-chan time.Time
+	switch {
+	case !changed && !others && exists:
+		return diags, nil
+
+	case !changed && exists:
+		// The server may not publish again for this file when only the
+		// other documents changed.
+		settled = time.After(settle)
+	}
+
+	for {
+		select {
+		case p := <-cln.notify:
+			if p == path {
+				settled = time.After(settle)
+			}
+
+		case <-settled:
+			cln.mu.Lock()
+			defer cln.mu.Unlock()
+			return cln.diags[path], nil
+
+		case <-cln.done:
+			return nil, cln.closedErr()
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// SyncOpened syncs the open documents other than path, which can be empty,
+// closing the ones removed from disk. It reports whether any changed.
+func (cln *Client) SyncOpened(path string) (bool, error) {
+	cln.mu.Lock()
+	paths := make([]string, 0, len(cln.opened))
+	for p := range cln.opened {
+		if p != path {
+			paths = append(paths, p)
+		}
+	}
+	cln.mu.Unlock()
+
+	var changed bool
+	for _, p := range paths {
+		c, err := cln.Sync(p)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			cln.mu.Lock()
+			delete(cln.opened, p)
+			cln.mu.Unlock()
+
+			if err := cln.Notify("textDocument/didClose", map[string]any{
+				"textDocument": map[string]any{"uri": PathToURI(p)},
+			}); err != nil {
+				return false, err
+			}
+			changed = true
+
+		case err != nil:
+			return false, err
+		}
+
+		changed = changed || c
+	}
+
+	return changed, nil
+}
+
+// =============================================================================
+
+func (cln *Client) write(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	cln.wmu.Lock()
+	defer cln.wmu.Unlock()
+
+	if _, err := fmt.Fprintf(cln.stdin, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// read processes the messages from the server until it exits.
+func (cln *Client) read(stdout io.Reader) {
+	r := textproto.NewReader(bufio.NewReader(stdout))
+
+	var err error
+	defer func() {
+		cln.mu.Lock()
+		cln.err = fmt.Errorf("language server closed: %w", err)
+		cln.mu.Unlock()
+		close(cln.done)
+	}()
+
+	for {
+		var header textproto.MIMEHeader
+		header, err = r.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+
+		var n int
+		n, err = strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			return
+		}
+
+		body := make([]byte, n)
+		if _, err = io.ReadFull(r.R, body); err != nil {
+			return
+		}
+
+		var msg struct {
+			ID     *json.RawMessage `json:"id"`
+			Method string           `json:"method"`
+			Params json.RawMessage  `json:"params"`
+			response
+		}
+		if json.Unmarshal(body, &msg) != nil {
+			continue
+		}
+
+		switch {
+
+		// A response to one of our calls.
+		case msg.ID != nil && msg.Method == "":
+			var id int
+			if json.Unmarshal(*msg.ID, &id) != nil {
+				continue
+			}
+
+			cln.mu.Lock()
+			ch, exists := cln.calls[id]
+			cln.mu.Unlock()
+
+			if exists {
+				ch <- msg.response
+			}
+
+		// A request from the server, like workspace/configuration. We don't
+		// support any so reply with an empty result to keep it going.
+		case msg.ID != nil:
+			cln.write(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": nil})
+
+		case msg.Method == "textDocument/publishDiagnostics":
+			var p struct {
+				URI         string       `json:"uri"`
+				Diagnostics []Diagnostic `json:"diagnostics"`
+			}
+			if json.Unmarshal(msg.Params, &p) != nil {
+				continue
+			}
+
+			path := URIToPath(p.URI)
+
+			cln.mu.Lock()
+			cln.diags[path] = p.Diagnostics
+			cln.mu.Unlock()
+
+			select {
+			case cln.notify <- path:
+			default:
+			}
+		}
+	}
+}
+
+func (cln *Client) closedErr() error {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+
+	if cln.err != nil {
+		return cln.err
+	}
+
+	return errors.New("language server closed")
+}
+
+// =============================================================================
+
+// PathToURI converts a file path into a file URI.
+func PathToURI(path string) string {
+	return "file://" + filepath.ToSlash(absPath(path))
+}
+
+// absPath returns the absolute path since the server only knows about
+// absolute paths.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+
+	return abs
+}
+
+// URIToPath converts a file URI into a file path.
+func URIToPath(uri string) string {
+	return filepath.FromSlash(strings.TrimPrefix(uri, "file://"))
+}
+
+// Offset converts a position into a byte offset in the text.
+func Offset(text string, pos Position) int {
+	offset := 0
+	for range pos.Line {
+		i := strings.IndexByte(text[offset:], '\n')
+		if i == -1 {
+			return len(text)
+		}
+		offset += i + 1
+	}
+
+	units := 0
+	for i, r := range text[offset:] {
+		if units >= pos.Character || r == '\n' {
+			return offset + i
+		}
+		units += utf16.RuneLen(r)
+	}
+
+	return len(text)
+}
+
+// ApplyEdits applies the edits to the text. The edits must not overlap.
+func ApplyEdits(text string, edits []TextEdit) string {
+	type span struct {
+		start, end int
+		newText    string
+	}
+
+	spans := make([]span, len(edits))
+	for i, e := range edits {
+		spans[i] = span{Offset(text, e.Range.Start), Offset(text, e.Range.End), e.NewText}
+	}
+
+	// Apply from the end so the offsets stay valid.
+	slices.SortFunc(spans, func(a, b span) int {
+		return b.start - a.start
+	})
+
+	for _, s := range spans {
+		text = text[:s.start] + s.newText + text[s.end:]
+	}
+
+	return text
+}
+
+func languageID(path string) string {
+	switch filepath.Ext(path) {
+	case ".go":
+		return "go"
+	case ".mod":
+		return "go.mod"
+	}
+
+	return strings.TrimPrefix(filepath.Ext(path), ".")
+}
@@ -0,0 +1,335 @@
+// Package mockserver provides an OpenAI-compatible chat completions server
+// that replays scripted responses. It lets the examples and the agent be
+// tested and demoed without a model server.
+//
+//	srv := mockserver.New(
+//		mockserver.Response{ToolCalls: []mockserver.ToolCall{{Name: "tool_read_file", Arguments: client.D{"path": "go.mod"}}}},
+//		mockserver.Response{Content: "The module is github.com/ardanlabs/ai-training."},
+//	)
+//	url := srv.Start()
+//	defer srv.Close()
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Response represents a scripted response to a single chat request.
+type Response struct {
+	Content    string        // Streamed a word at a time.
+	Reasoning  string        // Streamed before the content.
+	ToolCalls  []ToolCall    // Sent after the content.
+	Status     int           // Replies with this HTTP status and the Error when set.
+	Error      string        // Sent as an error chunk after the content when Status isn't set.
+	Latency    time.Duration // Delay before the response starts.
+	ChunkDelay time.Duration // Delay between the streamed chunks.
+	Usage      *client.Usage // Estimated from the request and response when nil.
+
+	// FinishReason replaces the finish reason, like "length" for an answer
+	// that was cut off at the token limit.
+	FinishReason string
+}
+
+// ToolCall represents a tool call the model asks for.
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments client.D
+}
+
+// =============================================================================
+
+// Server represents a chat completions server that replies with the scripted
+// responses in order. The requests it receives are recorded so tests can
+// check what was sent.
+type Server struct {
+	Model string
+
+	mu        sync.Mutex
+	responses []Response
+	requests  []client.D
+	http      *httptest.Server
+}
+
+// New constructs a server that replies with the specified responses.
+func New(responses ...Response) *Server {
+	return &Server{
+		Model:     "mock",
+		responses: responses,
+	}
+}
+
+// Add appends responses to the script.
+func (s *Server) Add(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses = append(s.responses, responses...)
+}
+
+// Requests returns the request documents received so far.
+func (s *Server) Requests() []client.D {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]client.D(nil), s.requests...)
+}
+
+// Start starts the server on a local port and returns the url of the chat
+// completions endpoint.
+func (s *Server) Start() string {
+	s.http = httptest.NewServer(s)
+
+	return s.http.URL + "/v1/chat/completions"
+}
+
+// Close shuts down a server started with Start.
+func (s *Server) Close() {
+	if s.http != nil {
+		s.http.Close()
+	}
+}
+
+// ServeHTTP implements the http.Handler interface so the server can also be
+// mounted on a real listener for offline demos.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", r.Method, r.URL.Path))
+		return
+	}
+
+	var req client.D
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("decode request: %s", err))
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	if len(s.responses) == 0 {
+		s.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, "mockserver: no scripted response left")
+		return
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	s.mu.Unlock()
+
+	if !sleep(r, resp.Latency) {
+		return
+	}
+
+	if resp.Status != 0 {
+		writeError(w, resp.Status, resp.Error)
+		return
+	}
+
+	if resp.Usage == nil {
+		resp.Usage = estimateUsage(req, resp)
+	}
+
+	if stream, _ := req["stream"].(bool); stream {
+		s.stream(w, r, req, resp)
+		return
+	}
+
+	s.complete(w, resp)
+}
+
+// =============================================================================
+
+// stream writes the response as server sent events a chunk at a time.
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, req client.D, resp Response) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+
+	send := func(chunk client.D) bool {
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+
+		return sleep(r, resp.ChunkDelay)
+	}
+
+	delta := func(d client.D, finishReason any) client.D {
+		return s.chunk(client.D{"index": 0, "delta": d, "finish_reason": finishReason})
+	}
+
+	for _, word := range words(resp.Reasoning) {
+		if !send(delta(client.D{"role": "assistant", "reasoning": word}, nil)) {
+			return
+		}
+	}
+
+	for _, word := range words(resp.Content) {
+		if !send(delta(client.D{"role": "assistant", "content": word}, nil)) {
+			return
+		}
+	}
+
+	if resp.Error != "" {
+		chunk := s.chunk()
+		chunk["error"] = client.D{"message": resp.Error, "type": "server_error"}
+		send(chunk)
+		return
+	}
+
+	finishReason := client.FinishStop
+	if len(resp.ToolCalls) > 0 {
+		if !send(delta(client.D{"role": "assistant", "tool_calls": toolCalls(resp.ToolCalls)}, nil)) {
+			return
+		}
+		finishReason = client.FinishToolCalls
+	}
+	if resp.FinishReason != "" {
+		finishReason = resp.FinishReason
+	}
+
+	if !send(delta(client.D{}, finishReason)) {
+		return
+	}
+
+	if opts, _ := req["stream_options"].(map[string]any); opts["include_usage"] == true {
+		chunk := s.chunk()
+		chunk["usage"] = resp.Usage
+		if !send(chunk) {
+			return
+		}
+	}
+
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// complete writes the response as a single chat completion.
+func (s *Server) complete(w http.ResponseWriter, resp Response) {
+	if resp.Error != "" {
+		writeError(w, http.StatusInternalServerError, resp.Error)
+		return
+	}
+
+	msg := client.D{"role": "assistant", "content": resp.Content}
+	if resp.Reasoning != "" {
+		msg["reasoning"] = resp.Reasoning
+	}
+
+	finishReason := client.FinishStop
+	if len(resp.ToolCalls) > 0 {
+		msg["tool_calls"] = toolCalls(resp.ToolCalls)
+		finishReason = client.FinishToolCalls
+	}
+	if resp.FinishReason != "" {
+		finishReason = resp.FinishReason
+	}
+
+	chat := s.document("chat.completion", client.D{"index": 0, "message": msg, "finish_reason": finishReason})
+	chat["usage"] = resp.Usage
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chat)
+}
+
+func (s *Server) chunk(choices ...client.D) client.D {
+	return s.document("chat.completion.chunk", choices...)
+}
+
+func (s *Server) document(object string, choices ...client.D) client.D {
+	if choices == nil {
+		choices = []client.D{}
+	}
+
+	return client.D{
+		"id":      "chatcmpl-mock",
+		"object":  object,
+		"created": time.Now().Unix(),
+		"model":   s.Model,
+		"choices": choices,
+	}
+}
+
+// =============================================================================
+
+// toolCalls converts the tool calls to the wire format where the arguments
+// are a JSON encoded string.
+func toolCalls(calls []ToolCall) []client.D {
+	docs := make([]client.D, len(calls))
+	for i, tc := range calls {
+		id := tc.ID
+		if id == "" {
+			id = fmt.Sprintf("call_%d", i)
+		}
+
+		args, _ := json.Marshal(tc.Arguments)
+		if tc.Arguments == nil {
+			args = []byte("{}")
+		}
+
+		docs[i] = client.D{
+			"index": i,
+			"id":    id,
+			"type":  "function",
+			"function": client.D{
+				"name":      tc.Name,
+				"arguments": string(args),
+			},
+		}
+	}
+
+	return docs
+}
+
+// estimateUsage estimates the tokens at around 4 bytes per token for the
+// request and a token per streamed chunk for the response.
+func estimateUsage(req client.D, resp Response) *client.Usage {
+	data, _ := json.Marshal(req["messages"])
+
+	usage := client.Usage{
+		PromptTokens:     len(data) / 4,
+		CompletionTokens: len(words(resp.Reasoning)) + len(words(resp.Content)) + len(resp.ToolCalls),
+	}
+	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+
+	return &usage
+}
+
+// words splits the text into chunks that keep their trailing space so the
+// chunks concatenate back to the text.
+func words(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.SplitAfter(text, " ")
+}
+
+// sleep waits for the duration and reports false if the client went away.
+func sleep(r *http.Request, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+
+	select {
+	case <-time.After(d):
+		return true
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(client.D{"error": msg})
+}
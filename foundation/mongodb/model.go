@@ -11,4 +11,5 @@ type VectorIndexSettings struct {
 	NumDimensions int
 	Path          string
 	Similarity    string
+	FilterPaths   []string // Fields that can be used to filter the search.
 }
@@ -113,6 +113,22 @@ func runCreateIndexCmd(ctx context.Context, col *mongo.Collection, vectorIndexNa
 		})
 	*/
 
+	fields := []bson.D{
+		{
+			{Key: "type", Value: "vector"},
+			{Key: "numDimensions", Value: settings.NumDimensions},
+			{Key: "path", Value: settings.Path},
+			{Key: "similarity", Value: settings.Similarity},
+		},
+	}
+
+	for _, path := range settings.FilterPaths {
+		fields = append(fields, bson.D{
+			{Key: "type", Value: "filter"},
+			{Key: "path", Value: path},
+		})
+	}
+
 	idx := bson.D{
 		{Key: "createSearchIndexes", Value: col.Name()},
 		{Key: "indexes", Value: []bson.D{
@@ -120,14 +136,7 @@ func runCreateIndexCmd(ctx context.Context, col *mongo.Collection, vectorIndexNa
 				{Key: "name", Value: vectorIndexName},
 				{Key: "type", Value: "vectorSearch"},
 				{Key: "definition", Value: bson.D{
-					{Key: "fields", Value: []bson.D{
-						{
-							{Key: "type", Value: "vector"},
-							{Key: "numDimensions", Value: settings.NumDimensions},
-							{Key: "path", Value: settings.Path},
-							{Key: "similarity", Value: settings.Similarity},
-						},
-					}},
+					{Key: "fields", Value: fields},
 				}},
 			}},
 		},
@@ -0,0 +1,290 @@
+// Package scheduler provides a queue for the requests sent to a model server
+// that several sessions share, like a local GPU serving a classroom. Only a
+// fixed number of requests run at once. The others wait in the queue by
+// priority and, within a priority, take turns by session so one session
+// sending many long generations can't starve the rest.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Priority represents how urgent a request is. Higher priorities are always
+// served first.
+type Priority int
+
+// Set of priorities a request can have.
+const (
+	Low Priority = iota
+	Normal
+	High
+)
+
+// priorities is the number of priorities.
+const priorities = int(High) + 1
+
+// String returns the name of the priority.
+func (p Priority) String() string {
+	switch p {
+	case Low:
+		return "low"
+	case High:
+		return "high"
+	}
+
+	return "normal"
+}
+
+// ParsePriority returns the priority with the name, an empty name is normal.
+// It reports false for an unknown name.
+func ParsePriority(name string) (Priority, bool) {
+	switch name {
+	case "low":
+		return Low, true
+	case "normal", "":
+		return Normal, true
+	case "high":
+		return High, true
+	}
+
+	return Normal, false
+}
+
+// Stats represents the state of the scheduler and the waits of the requests
+// it served.
+type Stats struct {
+	Slots      int            `json:"slots"`
+	Running    int            `json:"running"`
+	Queued     int            `json:"queued"`
+	ByPriority map[string]int `json:"queued_by_priority"`
+	Sessions   int            `json:"queued_sessions"`
+	Served     int            `json:"served"`
+	AvgWait    time.Duration  `json:"avg_wait"`
+	MaxWait    time.Duration  `json:"max_wait"`
+}
+
+// waiter represents a request waiting for a slot.
+type waiter struct {
+	session  string
+	ready    chan struct{}
+	enqueued time.Time
+}
+
+// queue represents the requests of a priority. The sessions with requests
+// waiting are served in turn, in the order of the ring.
+type queue struct {
+	ring    []string
+	waiters map[string][]*waiter
+}
+
+// Scheduler represents a queue in front of a model server.
+type Scheduler struct {
+	mu        sync.Mutex
+	slots     int
+	running   int
+	queues    [priorities]queue
+	served    int
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+// New constructs a scheduler that runs up to slots requests at once.
+func New(slots int) *Scheduler {
+	s := Scheduler{
+		slots: max(slots, 1),
+	}
+
+	for i := range s.queues {
+		s.queues[i].waiters = make(map[string][]*waiter)
+	}
+
+	return &s
+}
+
+// Acquire waits for a slot for a request of the session. The returned
+// function gives the slot back and must be called once the request is done.
+// The wait is the time the request spent in the queue.
+func (s *Scheduler) Acquire(ctx context.Context, session string, priority Priority) (release func(), wait time.Duration, err error) {
+	priority = min(max(priority, Low), High)
+
+	s.mu.Lock()
+
+	if s.running < s.slots && s.empty() {
+		s.running++
+		s.record(0)
+		s.mu.Unlock()
+		return sync.OnceFunc(s.release), 0, nil
+	}
+
+	w := waiter{
+		session:  session,
+		ready:    make(chan struct{}),
+		enqueued: time.Now(),
+	}
+	s.queues[priority].push(&w)
+
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return sync.OnceFunc(s.release), time.Since(w.enqueued), nil
+
+	case <-ctx.Done():
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// The slot could have been granted while the context was canceled,
+		// it goes to the next request.
+		if !s.queues[priority].remove(&w) {
+			s.running--
+			s.dispatch()
+		}
+
+		return nil, time.Since(w.enqueued), ctx.Err()
+	}
+}
+
+// Stats returns the state of the scheduler.
+func (s *Scheduler) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Stats{
+		Slots:      s.slots,
+		Running:    s.running,
+		ByPriority: make(map[string]int, priorities),
+		Served:     s.served,
+		MaxWait:    s.maxWait,
+	}
+
+	sessions := make(map[string]bool)
+	for p, q := range s.queues {
+		var n int
+		for session, waiters := range q.waiters {
+			n += len(waiters)
+			sessions[session] = true
+		}
+
+		st.ByPriority[Priority(p).String()] = n
+		st.Queued += n
+	}
+	st.Sessions = len(sessions)
+
+	if s.served > 0 {
+		st.AvgWait = s.totalWait / time.Duration(s.served)
+	}
+
+	return st
+}
+
+// release gives a slot back and hands it to the next request.
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.running--
+	s.dispatch()
+}
+
+// dispatch hands the free slots to the waiting requests, the highest
+// priority first.
+func (s *Scheduler) dispatch() {
+	for s.running < s.slots {
+		var w *waiter
+		for p := High; p >= Low && w == nil; p-- {
+			w = s.queues[p].pop()
+		}
+
+		if w == nil {
+			return
+		}
+
+		s.running++
+		s.record(time.Since(w.enqueued))
+		close(w.ready)
+	}
+}
+
+// record counts a request that got a slot after waiting.
+func (s *Scheduler) record(wait time.Duration) {
+	s.served++
+	s.totalWait += wait
+	s.maxWait = max(s.maxWait, wait)
+}
+
+// empty reports whether no request is waiting.
+func (s *Scheduler) empty() bool {
+	for _, q := range s.queues {
+		if len(q.ring) > 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// =============================================================================
+
+// push adds the request to the queue of its session.
+func (q *queue) push(w *waiter) {
+	if len(q.waiters[w.session]) == 0 {
+		q.ring = append(q.ring, w.session)
+	}
+
+	q.waiters[w.session] = append(q.waiters[w.session], w)
+}
+
+// pop returns the oldest request of the next session in the ring, which goes
+// to the end of the ring if it has more requests waiting.
+func (q *queue) pop() *waiter {
+	if len(q.ring) == 0 {
+		return nil
+	}
+
+	session := q.ring[0]
+	q.ring = q.ring[1:]
+
+	waiters := q.waiters[session]
+	w := waiters[0]
+
+	if len(waiters) == 1 {
+		delete(q.waiters, session)
+	} else {
+		q.waiters[session] = waiters[1:]
+		q.ring = append(q.ring, session)
+	}
+
+	return w
+}
+
+// remove takes the request out of the queue. It reports false if the
+// request isn't waiting anymore.
+func (q *queue) remove(w *waiter) bool {
+	waiters := q.waiters[w.session]
+
+	for i, other := range waiters {
+		if other != w {
+			continue
+		}
+
+		waiters = append(waiters[:i:i], waiters[i+1:]...)
+		if len(waiters) > 0 {
+			q.waiters[w.session] = waiters
+			return true
+		}
+
+		delete(q.waiters, w.session)
+		for j, session := range q.ring {
+			if session == w.session {
+				q.ring = append(q.ring[:j:j], q.ring[j+1:]...)
+				break
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,160 @@
+// Package semcache provides a semantic cache of answers. Questions are looked
+// up by the similarity of their embeddings instead of their text, so "how do
+// I run the tests?" finds the answer to "how are the tests run?" without
+// calling the model again. Entries expire after a TTL and belong to a scope,
+// like a chat session, so answers don't leak between users.
+package semcache
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+// Config represents the settings of a cache.
+type Config struct {
+	Threshold  float32       // Minimum cosine similarity for a hit, like 0.95.
+	TTL        time.Duration // How long an answer is served, zero never expires.
+	MaxEntries int           // Oldest entries are evicted past this, zero is unlimited.
+}
+
+// Entry represents a question and the answer the model gave to it.
+type Entry struct {
+	Scope     string
+	Question  string
+	Answer    string
+	Embedding []float32
+	Created   time.Time
+	Hits      int
+}
+
+// Vector implements the vector.Data interface.
+func (e Entry) Vector() []float32 {
+	return e.Embedding
+}
+
+// Hit represents an entry found for a question.
+type Hit struct {
+	Entry
+	Similarity float32
+}
+
+// Cache represents a semantic cache of answers kept in memory. It's safe for
+// concurrent use.
+type Cache struct {
+	cfg     Config
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// New constructs a cache with the specified config.
+func New(cfg Config) *Cache {
+	return &Cache{
+		cfg: cfg,
+	}
+}
+
+// Lookup returns the cached answer of the question most similar to the
+// embedding in the scope. It reports false if no question is similar enough.
+func (c *Cache) Lookup(scope string, embedding []float32) (Hit, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+
+	best := -1
+	var similarity float32
+
+	for i, e := range c.entries {
+		if e.Scope != scope {
+			continue
+		}
+
+		s := vector.CosineSimilarity(embedding, e.Embedding)
+		if s >= c.cfg.Threshold && (best == -1 || s > similarity) {
+			best = i
+			similarity = s
+		}
+	}
+
+	if best == -1 {
+		return Hit{}, false
+	}
+
+	c.entries[best].Hits++
+
+	hit := Hit{
+		Entry:      c.entries[best],
+		Similarity: similarity,
+	}
+
+	return hit, true
+}
+
+// Store adds the answer to the question in the scope. The answer replaces
+// the one of a question that is similar enough to be served for it.
+func (c *Cache) Store(scope string, question string, answer string, embedding []float32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+
+	c.entries = slices.DeleteFunc(c.entries, func(e Entry) bool {
+		return e.Scope == scope && vector.CosineSimilarity(embedding, e.Embedding) >= c.cfg.Threshold
+	})
+
+	c.entries = append(c.entries, Entry{
+		Scope:     scope,
+		Question:  question,
+		Answer:    answer,
+		Embedding: embedding,
+		Created:   time.Now(),
+	})
+
+	if c.cfg.MaxEntries > 0 && len(c.entries) > c.cfg.MaxEntries {
+		c.entries = slices.Delete(c.entries, 0, len(c.entries)-c.cfg.MaxEntries)
+	}
+}
+
+// Clear removes the entries of the scope.
+func (c *Cache) Clear(scope string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = slices.DeleteFunc(c.entries, func(e Entry) bool {
+		return e.Scope == scope
+	})
+}
+
+// Entries returns the entries of the scope that haven't expired, oldest
+// first.
+func (c *Cache) Entries(scope string) []Entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.expire()
+
+	var entries []Entry
+	for _, e := range c.entries {
+		if e.Scope == scope {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries
+}
+
+// expire removes the entries older than the TTL. The caller must hold the
+// lock.
+func (c *Cache) expire() {
+	if c.cfg.TTL <= 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-c.cfg.TTL)
+	c.entries = slices.DeleteFunc(c.entries, func(e Entry) bool {
+		return e.Created.Before(cutoff)
+	})
+}
@@ -0,0 +1,238 @@
+// Package stream provides a typed event model for streaming chat responses.
+// Agents switch on the kind of event instead of inspecting the fields of the
+// provider's chunks, and new providers only need to map into the same events.
+package stream
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/ardanlabs/ai-training/foundation/client"
+)
+
+// Kind represents the kind of event streamed from the model.
+type Kind int
+
+// Set of kinds of events that can be streamed.
+const (
+	ContentDelta Kind = iota + 1
+	ReasoningDelta
+	ToolCallDelta
+	UsageUpdate
+	Done
+	Error
+)
+
+var kindNames = map[Kind]string{
+	ContentDelta:   "content_delta",
+	ReasoningDelta: "reasoning_delta",
+	ToolCallDelta:  "tool_call_delta",
+	UsageUpdate:    "usage_update",
+	Done:           "done",
+	Error:          "error",
+}
+
+// String implements the fmt.Stringer interface.
+func (k Kind) String() string {
+	if name, exists := kindNames[k]; exists {
+		return name
+	}
+
+	return "unknown"
+}
+
+// Event represents a single event streamed from the model. Only the fields
+// that belong to the kind of event are set.
+type Event struct {
+	Kind         Kind
+	Text         string            // ContentDelta, ReasoningDelta
+	ToolCalls    []client.ToolCall // ToolCallDelta
+	Usage        client.Usage      // UsageUpdate
+	FinishReason string            // Done, one of the client.Finish* values
+	Err          error             // Error
+}
+
+// =============================================================================
+
+// Client streams chat responses as events. It wraps any client that streams
+// ChatSSE chunks, so it works with every transport the client supports.
+type Client struct {
+	streamer client.Streamer[client.ChatSSE]
+}
+
+// New constructs a client that converts the chunks from the specified
+// streamer into events.
+func New(streamer client.Streamer[client.ChatSSE]) *Client {
+	return &Client{
+		streamer: streamer,
+	}
+}
+
+// maxResumes is the number of times a response is resumed after the
+// connection drops.
+const maxResumes = 2
+
+// resumePrompt asks the model to continue the answer the connection dropped
+// in the middle of.
+const resumePrompt = "The connection dropped while you were answering. Continue exactly where your last message stopped, without repeating anything and without an introduction."
+
+// Do makes the request and streams the events into the channel. A Done event
+// is always the last event unless the context is canceled. The channel is
+// closed when the response is complete.
+//
+// If the connection drops and the streamer couldn't resume it, the request is
+// sent again with the content delivered so far and a prompt asking the model
+// to continue from there. Responses that already asked for tool calls aren't
+// resumed.
+func (cln *Client) Do(ctx context.Context, method string, endpoint string, body client.D, ch chan Event) error {
+	chunks := make(chan client.ChatSSE, cap(ch))
+
+	if err := cln.streamer.Do(ctx, method, endpoint, body, chunks); err != nil {
+		return err
+	}
+
+	go func() {
+		defer close(ch)
+
+		send := func(evt Event) bool {
+			select {
+			case ch <- evt:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		var m mapper
+		for resumes := 0; ; resumes++ {
+			var lost bool
+			for chunk := range chunks {
+				if chunk.Error != nil && chunk.Error.Type == client.ErrorTypeConnectionLost && resumes < maxResumes {
+					if _, ok := m.resumeRequest(body); ok {
+						lost = true
+						continue
+					}
+				}
+
+				for _, evt := range m.events(chunk) {
+					if !send(evt) {
+						return
+					}
+				}
+			}
+
+			if !lost {
+				break
+			}
+
+			d, _ := m.resumeRequest(body)
+
+			chunks = make(chan client.ChatSSE, cap(ch))
+			if err := cln.streamer.Do(ctx, method, endpoint, d, chunks); err != nil {
+				if !send(Event{Kind: Error, Err: err}) {
+					return
+				}
+				break
+			}
+		}
+
+		send(Event{Kind: Done, FinishReason: m.finishReason})
+	}()
+
+	return nil
+}
+
+// =============================================================================
+
+// mapper converts chunks into events. It keeps state across chunks since some
+// models use <think> tags in the content to mark reasoning.
+type mapper struct {
+	thinking     bool
+	finishReason string
+	content      strings.Builder // Content delivered so far.
+	toolCalls    bool            // Tool calls were delivered.
+}
+
+// resumeRequest returns a copy of the request that asks the model to continue
+// from the content delivered so far. It returns false if the response can't
+// be resumed.
+func (m *mapper) resumeRequest(body client.D) (client.D, bool) {
+	if m.toolCalls {
+		return nil, false
+	}
+
+	messages, ok := body["messages"].([]client.D)
+	if !ok {
+		return nil, false
+	}
+
+	d := maps.Clone(body)
+
+	// Nothing was delivered so the request can be sent as is.
+	if m.content.Len() == 0 {
+		return d, true
+	}
+
+	d["messages"] = append(slices.Clone(messages),
+		client.Assistant(m.content.String()),
+		client.User(resumePrompt),
+	)
+
+	return d, true
+}
+
+func (m *mapper) events(chunk client.ChatSSE) []Event {
+	var events []Event
+
+	// The error is a *client.StreamError so callers can inspect it with
+	// errors.As.
+	if chunk.Error != nil {
+		events = append(events, Event{Kind: Error, Err: chunk.Error})
+	}
+
+	if chunk.Usage != nil {
+		events = append(events, Event{Kind: UsageUpdate, Usage: *chunk.Usage})
+	}
+
+	if len(chunk.Choices) == 0 {
+		return events
+	}
+
+	choice := chunk.Choices[0]
+
+	if choice.FinishReason != "" {
+		m.finishReason = choice.FinishReason
+	}
+
+	if choice.Delta.Reasoning != "" {
+		events = append(events, Event{Kind: ReasoningDelta, Text: choice.Delta.Reasoning})
+	}
+
+	switch choice.Delta.Content {
+	case "":
+
+	case "<think>":
+		m.thinking = true
+
+	case "</think>":
+		m.thinking = false
+
+	default:
+		kind := ContentDelta
+		if m.thinking {
+			kind = ReasoningDelta
+		} else {
+			m.content.WriteString(choice.Delta.Content)
+		}
+		events = append(events, Event{Kind: kind, Text: choice.Delta.Content})
+	}
+
+	if len(choice.Delta.ToolCalls) > 0 {
+		m.toolCalls = true
+		events = append(events, Event{Kind: ToolCallDelta, ToolCalls: choice.Delta.ToolCalls})
+	}
+
+	return events
+}
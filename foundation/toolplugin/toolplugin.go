@@ -0,0 +1,276 @@
+// Package toolplugin provides a client for tools implemented in separate
+// processes, so tools can be written in any language. The host starts the
+// plugin and talks to it over stdin and stdout with JSON-RPC 2.0 messages,
+// one JSON document per line. Anything the plugin writes to stderr is passed
+// through for debugging.
+//
+// A plugin answers two methods. tools/list returns the tools it provides:
+//
+//	--> {"jsonrpc":"2.0","id":1,"method":"tools/list"}
+//	<-- {"jsonrpc":"2.0","id":1,"result":{"tools":[{"name":"tool_word_count","description":"Count the words in a text.","parameters":{"type":"object","properties":{"text":{"type":"string"}},"required":["text"]},"side_effects":false}]}}
+//
+// tools/call runs a tool with the arguments from the model and returns any
+// JSON value as the result, or a JSON-RPC error when the call failed:
+//
+//	--> {"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"tool_word_count","arguments":{"text":"hello world"}}}
+//	<-- {"jsonrpc":"2.0","id":2,"result":{"words":2}}
+//
+// The plugin exits when its stdin is closed.
+package toolplugin
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Tool represents a tool provided by a plugin.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`   // JSON schema of the arguments.
+	SideEffects bool           `json:"side_effects"` // The call changes something and needs approval.
+}
+
+// Error represents an error returned by the plugin for a call.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+type response struct {
+	Result json.RawMessage `json:"result"`
+	Error  *Error          `json:"error"`
+}
+
+// The time the plugin gets to exit after its stdin is closed.
+const closeTimeout = 5 * time.Second
+
+// =============================================================================
+
+// Client represents a connection to a plugin process. It's safe for
+// concurrent use.
+type Client struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	nextID  int
+	calls   map[int]chan response
+	done    chan struct{}
+	err     error
+	once    sync.Once
+}
+
+// Start runs the plugin command. The plugin inherits the working directory
+// and the environment of the host.
+func Start(command string, args ...string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdin: %w", err)
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command, err)
+	}
+
+	cln := Client{
+		command: command,
+		cmd:     cmd,
+		stdin:   stdin,
+		calls:   make(map[int]chan response),
+		done:    make(chan struct{}),
+	}
+
+	go cln.read(stdout)
+
+	return &cln, nil
+}
+
+// Close closes the plugin's stdin so it exits, killing it if it doesn't.
+// It's safe to call more than once.
+func (cln *Client) Close() error {
+	var err error
+	cln.once.Do(func() {
+		cln.stdin.Close()
+
+		select {
+		case <-cln.done:
+		case <-time.After(closeTimeout):
+			cln.cmd.Process.Kill()
+		}
+
+		err = cln.cmd.Wait()
+	})
+
+	return err
+}
+
+// Tools returns the tools the plugin provides.
+func (cln *Client) Tools(ctx context.Context) ([]Tool, error) {
+	var result struct {
+		Tools []Tool `json:"tools"`
+	}
+
+	if err := cln.Call(ctx, "tools/list", nil, &result); err != nil {
+		return nil, err
+	}
+
+	for _, t := range result.Tools {
+		if t.Name == "" {
+			return nil, fmt.Errorf("tools/list: %s returned a tool without a name", cln.command)
+		}
+	}
+
+	return result.Tools, nil
+}
+
+// CallTool runs the tool with the arguments and returns its result.
+func (cln *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (json.RawMessage, error) {
+	params := map[string]any{
+		"name":      name,
+		"arguments": arguments,
+	}
+
+	var result json.RawMessage
+	if err := cln.Call(ctx, "tools/call", params, &result); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Call sends a request and decodes the result into the value, which can be
+// nil if the result is not needed.
+func (cln *Client) Call(ctx context.Context, method string, params any, result any) error {
+	cln.mu.Lock()
+	if cln.err != nil {
+		cln.mu.Unlock()
+		return cln.err
+	}
+	cln.nextID++
+	id := cln.nextID
+	ch := make(chan response, 1)
+	cln.calls[id] = ch
+	cln.mu.Unlock()
+
+	defer func() {
+		cln.mu.Lock()
+		delete(cln.calls, id)
+		cln.mu.Unlock()
+	}()
+
+	msg := map[string]any{"jsonrpc": "2.0", "id": id, "method": method}
+	if params != nil {
+		msg["params"] = params
+	}
+
+	if err := cln.write(msg); err != nil {
+		return err
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+
+		if result == nil || len(resp.Result) == 0 {
+			return nil
+		}
+
+		return json.Unmarshal(resp.Result, result)
+
+	case <-cln.done:
+		return cln.closedErr()
+
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// =============================================================================
+
+func (cln *Client) write(msg any) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+
+	cln.wmu.Lock()
+	defer cln.wmu.Unlock()
+
+	if _, err := cln.stdin.Write(append(body, '\n')); err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+
+	return nil
+}
+
+// read processes the responses from the plugin until it exits.
+func (cln *Client) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	defer func() {
+		err := scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+
+		cln.mu.Lock()
+		cln.err = fmt.Errorf("plugin %s closed: %w", cln.command, err)
+		cln.mu.Unlock()
+		close(cln.done)
+	}()
+
+	for scanner.Scan() {
+		var msg struct {
+			ID *int `json:"id"`
+			response
+		}
+		if json.Unmarshal(scanner.Bytes(), &msg) != nil || msg.ID == nil {
+			continue
+		}
+
+		cln.mu.Lock()
+		ch, exists := cln.calls[*msg.ID]
+		cln.mu.Unlock()
+
+		if exists {
+			ch <- msg.response
+		}
+	}
+}
+
+func (cln *Client) closedErr() error {
+	cln.mu.Lock()
+	defer cln.mu.Unlock()
+
+	if cln.err != nil {
+		return cln.err
+	}
+
+	return errors.New("plugin closed")
+}
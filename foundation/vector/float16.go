@@ -0,0 +1,169 @@
+package vector
+
+import (
+	"math"
+	"sync"
+)
+
+// Float16Vector represents an embedding stored as IEEE 754 half precision
+// floats. It takes half the memory of a []float32 embedding at the cost of
+// precision, about 3 significant decimal digits, which is usually enough to
+// rank similarity results.
+type Float16Vector []uint16
+
+// Float16Data represents data with an embedding stored as half precision
+// floats. The similarity functions use it to convert the values on the fly
+// instead of decoding the whole vector first.
+type Float16Data interface {
+	Float16() Float16Vector
+}
+
+// EncodeFloat16 converts the vector to half precision.
+func EncodeFloat16(v []float32) Float16Vector {
+	f16 := make(Float16Vector, len(v))
+	for i, f := range v {
+		f16[i] = Float32ToFloat16(f)
+	}
+
+	return f16
+}
+
+// Float16 implements the Float16Data interface.
+func (f16 Float16Vector) Float16() Float16Vector {
+	return f16
+}
+
+// Vector decodes the vector back to single precision so it implements the
+// Data interface.
+func (f16 Float16Vector) Vector() []float32 {
+	table := float16Table()
+
+	v := make([]float32, len(f16))
+	for i, h := range f16 {
+		v[i] = table[h]
+	}
+
+	return v
+}
+
+// CosineSimilarityFloat16 computes the cosine similarity between a single
+// precision vector and a half precision vector, converting the half
+// precision values as they are used.
+func CosineSimilarityFloat16(x []float32, y Float16Vector) float32 {
+	table := float16Table()
+
+	var sum, s1, s2 float64
+
+	for i := 0; i < len(x); i++ {
+		yi := table[y[i]]
+		sum += float64(x[i] * yi)
+		s1 += float64(x[i] * x[i])
+		s2 += float64(yi * yi)
+	}
+
+	if s1 == 0 || s2 == 0 {
+		return 0.0
+	}
+
+	return float32(sum / (math.Sqrt(s1) * math.Sqrt(s2)))
+}
+
+// similarity computes the similarity with the data point, using the half
+// precision embedding when the data point has one.
+func similarity(te []float32, dp Data) float32 {
+	if f16, ok := dp.(Float16Data); ok {
+		return CosineSimilarityFloat16(te, f16.Float16())
+	}
+
+	return CosineSimilarity(te, dp.Vector())
+}
+
+// =============================================================================
+
+// Float32ToFloat16 converts a single precision float to half precision,
+// rounding to the nearest even value. Values too large for half precision
+// become infinity.
+func Float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+
+	// Infinity and NaN, keep NaN a NaN.
+	case exp == 0xff:
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+
+	// Too large, overflow to infinity.
+	case exp > 127+15:
+		return sign | 0x7c00
+
+	// Normal half precision value.
+	case exp >= 127-14:
+		h := uint32(exp-127+15)<<10 | mant>>13
+		round := mant & 0x1fff
+		if round > 0x1000 || (round == 0x1000 && h&1 == 1) {
+			h++ // A carry into the exponent is still correct, up to infinity.
+		}
+		return sign | uint16(h)
+
+	// Subnormal half precision value.
+	case exp >= 127-24:
+		mant |= 0x800000
+		shift := uint32(127 - 14 - exp + 13)
+		h := mant >> shift
+		round := mant & (1<<shift - 1)
+		half := uint32(1) << (shift - 1)
+		if round > half || (round == half && h&1 == 1) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+
+	// Too small, underflow to zero.
+	return sign
+}
+
+// Float16ToFloat32 converts a half precision float to single precision. The
+// conversion is exact.
+func Float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+
+	case exp != 0:
+		return math.Float32frombits(sign | (exp-15+127)<<23 | mant<<13)
+
+	case mant == 0:
+		return math.Float32frombits(sign)
+	}
+
+	// Subnormal, normalize the mantissa.
+	e := uint32(127 - 14)
+	for mant&0x400 == 0 {
+		mant <<= 1
+		e--
+	}
+
+	return math.Float32frombits(sign | e<<23 | (mant&0x3ff)<<13)
+}
+
+// float16Table holds the single precision value of every half precision
+// value so the conversion during similarity checks is a lookup.
+var float16Table = sync.OnceValue(func() *[1 << 16]float32 {
+	var table [1 << 16]float32
+	for i := range table {
+		table[i] = Float16ToFloat32(uint16(i))
+	}
+
+	return &table
+})
@@ -0,0 +1,96 @@
+package vector_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+// encodeFloat16 converts the corpus to half precision storage.
+func encodeFloat16(corpus []vector.Data) []vector.Data {
+	corpus16 := make([]vector.Data, len(corpus))
+	for i, dp := range corpus {
+		corpus16[i] = vector.EncodeFloat16(dp.Vector())
+	}
+
+	return corpus16
+}
+
+// recall returns the fraction of the expected results found in got. The
+// corpora hold the same vectors in the same order, so the results are matched
+// by their position in their corpus.
+func recall(corpus []vector.Data, expected []vector.SimilarityResult, corpus16 []vector.Data, got []vector.SimilarityResult) float64 {
+	want := make(map[int]bool, len(expected))
+	for _, sr := range expected {
+		want[position(corpus, sr.DataPoint)] = true
+	}
+
+	var found int
+	for _, sr := range got {
+		if want[position(corpus16, sr.DataPoint)] {
+			found++
+		}
+	}
+
+	return float64(found) / float64(len(expected))
+}
+
+// position returns the index of the data point in the corpus.
+func position(corpus []vector.Data, dp vector.Data) int {
+	for i, c := range corpus {
+		switch v := c.(type) {
+		case embedding:
+			if &v[0] == &dp.(embedding)[0] {
+				return i
+			}
+		case vector.Float16Vector:
+			if &v[0] == &dp.(vector.Float16Vector)[0] {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// =============================================================================
+
+func TestFloat16RoundTrip(t *testing.T) {
+	values := []float32{0, 1, -1, 0.5, -0.25, 65504, 0.000061035156}
+
+	for _, f := range values {
+		got := vector.EncodeFloat16([]float32{f}).Vector()[0]
+		if got != f {
+			t.Errorf("float16 round trip of %v: got %v", f, got)
+		}
+	}
+}
+
+// BenchmarkSearchFloat32 and BenchmarkSearchFloat16 compare the same search
+// over single and half precision storage. Both report the bytes used to store
+// the corpus, and the float16 benchmark reports its recall of the float32 top
+// k.
+func BenchmarkSearchFloat32(b *testing.B) {
+	corpus, target := randomCorpus(benchVectors, benchDim)
+
+	for b.Loop() {
+		vector.SearchParallel(target, corpus, benchK, 0)
+	}
+
+	b.ReportMetric(float64(benchVectors*benchDim*4), "corpus-bytes")
+}
+
+func BenchmarkSearchFloat16(b *testing.B) {
+	corpus, target := randomCorpus(benchVectors, benchDim)
+	corpus16 := encodeFloat16(corpus)
+
+	var results []vector.SimilarityResult
+	for b.Loop() {
+		results = vector.SearchParallel(target, corpus16, benchK, 0)
+	}
+
+	expected := vector.SearchParallel(target, corpus, benchK, 0)
+
+	b.ReportMetric(float64(benchVectors*benchDim*2), "corpus-bytes")
+	b.ReportMetric(recall(corpus, expected, corpus16, results), "recall")
+}
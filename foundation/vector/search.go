@@ -0,0 +1,128 @@
+package vector
+
+import (
+	"container/heap"
+	"runtime"
+	"slices"
+	"sync"
+)
+
+// SearchParallel returns the k data points most similar to the target, in
+// order of similarity. The data points are split into shards that are
+// searched by separate goroutines, each keeping its own top k, and the
+// results are merged. If workers is less than 1, the number of CPUs is used.
+func SearchParallel(target Data, dataPoints []Data, k int, workers int) []SimilarityResult {
+	if k <= 0 || len(dataPoints) == 0 {
+		return nil
+	}
+
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+	workers = min(workers, len(dataPoints))
+
+	// Rounding the shard size up can leave the last workers without data
+	// points, like 5 points for 4 workers, so only the shards needed are
+	// searched.
+	shardSize := (len(dataPoints) + workers - 1) / workers
+	workers = (len(dataPoints) + shardSize - 1) / shardSize
+
+	te := target.Vector()
+	shards := make([]topK, workers)
+
+	var wg sync.WaitGroup
+	for i := range workers {
+		start := i * shardSize
+		end := min(start+shardSize, len(dataPoints))
+
+		wg.Go(func() {
+			shards[i] = searchShard(te, dataPoints[start:end], k)
+		})
+	}
+	wg.Wait()
+
+	// -------------------------------------------------------------------------
+	// Merge the top k of every shard.
+
+	var merged topK
+	for _, shard := range shards {
+		for _, sr := range shard {
+			merged.offer(sr.dp, sr.similarity, k)
+		}
+	}
+
+	return merged.results(target)
+}
+
+// searchShard returns the top k data points of a single shard.
+func searchShard(te []float32, dataPoints []Data, k int) topK {
+	var top topK
+	for _, dp := range dataPoints {
+		top.offer(dp, similarity(te, dp), k)
+	}
+
+	return top
+}
+
+// =============================================================================
+
+type scored struct {
+	dp         Data
+	similarity float32
+}
+
+// topK is a min heap holding the k most similar data points seen so far. The
+// least similar data point is at the root so it can be replaced cheaply.
+type topK []scored
+
+func (t topK) Len() int           { return len(t) }
+func (t topK) Less(i, j int) bool { return t[i].similarity < t[j].similarity }
+func (t topK) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t *topK) Push(x any)        { *t = append(*t, x.(scored)) }
+
+func (t *topK) Pop() any {
+	old := *t
+	n := len(old)
+	x := old[n-1]
+	*t = old[:n-1]
+	return x
+}
+
+// offer adds the data point if it's one of the k most similar seen so far.
+func (t *topK) offer(dp Data, similarity float32, k int) {
+	if t.Len() < k {
+		heap.Push(t, scored{dp: dp, similarity: similarity})
+		return
+	}
+
+	if similarity > (*t)[0].similarity {
+		(*t)[0] = scored{dp: dp, similarity: similarity}
+		heap.Fix(t, 0)
+	}
+}
+
+// results returns the data points ordered from most to least similar.
+func (t topK) results(target Data) []SimilarityResult {
+	sorted := slices.Clone(t)
+	slices.SortStableFunc(sorted, func(a, b scored) int {
+		switch {
+		case a.similarity > b.similarity:
+			return -1
+		case a.similarity < b.similarity:
+			return 1
+		}
+		return 0
+	})
+
+	results := make([]SimilarityResult, len(sorted))
+	for i, s := range sorted {
+		results[i] = SimilarityResult{
+			Target:     target,
+			DataPoint:  s.dp,
+			Similarity: s.similarity,
+			Percentage: s.similarity * 100,
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,119 @@
+package vector_test
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"testing"
+
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+const (
+	benchVectors = 20_000
+	benchDim     = 768
+	benchK       = 10
+)
+
+type embedding []float32
+
+func (e embedding) Vector() []float32 {
+	return e
+}
+
+// randomCorpus returns n random vectors of dim dimensions and a target.
+func randomCorpus(n int, dim int) ([]vector.Data, vector.Data) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+
+	random := func() embedding {
+		v := make(embedding, dim)
+		for i := range v {
+			v[i] = rnd.Float32()*2 - 1
+		}
+		return v
+	}
+
+	corpus := make([]vector.Data, n)
+	for i := range corpus {
+		corpus[i] = random()
+	}
+
+	return corpus, random()
+}
+
+// =============================================================================
+
+func TestSearchParallel(t *testing.T) {
+	corpus, target := randomCorpus(1_000, 64)
+
+	results := vector.Similarity(target, corpus...)
+	slices.SortFunc(results, func(a, b vector.SimilarityResult) int {
+		switch {
+		case a.Similarity > b.Similarity:
+			return -1
+		case a.Similarity < b.Similarity:
+			return 1
+		}
+		return 0
+	})
+
+	for _, workers := range []int{1, 3, 8} {
+		got := vector.SearchParallel(target, corpus, benchK, workers)
+		if len(got) != benchK {
+			t.Fatalf("workers %d: got %d results, want %d", workers, len(got), benchK)
+		}
+
+		for i := range got {
+			if got[i].Similarity != results[i].Similarity {
+				t.Errorf("workers %d: result %d has similarity %f, want %f", workers, i, got[i].Similarity, results[i].Similarity)
+			}
+		}
+	}
+}
+
+func TestSearchParallelSmallCorpus(t *testing.T) {
+	for _, n := range []int{1, 5, 9, 13} {
+		corpus, target := randomCorpus(n, 8)
+
+		for _, workers := range []int{0, 2, 4, 8, 16} {
+			got := vector.SearchParallel(target, corpus, n, workers)
+			if len(got) != n {
+				t.Errorf("%d points, workers %d: got %d results, want %d", n, workers, len(got), n)
+			}
+		}
+	}
+}
+
+// BenchmarkSimilarity is the baseline: every similarity computed by a single
+// goroutine and sorted.
+func BenchmarkSimilarity(b *testing.B) {
+	corpus, target := randomCorpus(benchVectors, benchDim)
+
+	for b.Loop() {
+		results := vector.Similarity(target, corpus...)
+		slices.SortFunc(results, func(a, b vector.SimilarityResult) int {
+			switch {
+			case a.Similarity > b.Similarity:
+				return -1
+			case a.Similarity < b.Similarity:
+				return 1
+			}
+			return 0
+		})
+	}
+}
+
+// BenchmarkSearchParallel measures how the search scales with the number of
+// workers, doubling from 1 up to the number of CPUs.
+func BenchmarkSearchParallel(b *testing.B) {
+	corpus, target := randomCorpus(benchVectors, benchDim)
+
+	for workers := 1; workers <= runtime.NumCPU(); workers *= 2 {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for b.Loop() {
+				vector.SearchParallel(target, corpus, benchK, workers)
+			}
+		})
+	}
+}
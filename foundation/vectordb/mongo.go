@@ -0,0 +1,186 @@
+package vectordb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ardanlabs/ai-training/foundation/mongodb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MongoIndexSettings returns the settings for a vector index that supports
+// the metadata filters.
+func MongoIndexSettings(numDimensions int) mongodb.VectorIndexSettings {
+	return mongodb.VectorIndexSettings{
+		NumDimensions: numDimensions,
+		Path:          "embedding",
+		Similarity:    "cosine",
+		FilterPaths:   []string{"source", "tags", "created"},
+	}
+}
+
+// Mongo is a vector store backed by a MongoDB collection with a vector index
+// created using MongoIndexSettings.
+type Mongo struct {
+	col       *mongo.Collection
+	indexName string
+}
+
+// NewMongo constructs a vector store for the collection using the specified
+// vector index.
+func NewMongo(col *mongo.Collection, indexName string) *Mongo {
+	return &Mongo{
+		col:       col,
+		indexName: indexName,
+	}
+}
+
+// Insert adds the documents to the collection.
+func (m *Mongo) Insert(ctx context.Context, docs ...Document) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	items := make([]any, len(docs))
+	for i, doc := range docs {
+		items[i] = doc
+	}
+
+	if _, err := m.col.InsertMany(ctx, items); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+
+	return nil
+}
+
+// Upsert replaces the documents of the source with the specified version of
+// its documents. Every document is upserted by its id and version in a single
+// bulk write, so saving the same version again replaces the documents instead
+// of duplicating them. The old versions are removed afterwards so searches
+// never find the source missing, although they may briefly see both versions.
+func (m *Mongo) Upsert(ctx context.Context, source string, version string, docs ...Document) error {
+	if len(docs) > 0 {
+		models := make([]mongo.WriteModel, len(docs))
+		for i, doc := range withVersion(source, version, docs) {
+			models[i] = mongo.NewReplaceOneModel().
+				SetFilter(bson.M{"id": doc.ID, "version": version}).
+				SetReplacement(doc).
+				SetUpsert(true)
+		}
+
+		if _, err := m.col.BulkWrite(ctx, models); err != nil {
+			return fmt.Errorf("upsert: %w", err)
+		}
+	}
+
+	filter := bson.M{
+		"source":  source,
+		"version": bson.M{"$ne": version},
+	}
+
+	if _, err := m.col.DeleteMany(ctx, filter); err != nil {
+		return fmt.Errorf("delete old versions: %w", err)
+	}
+
+	return nil
+}
+
+// Purge removes the documents of the source.
+func (m *Mongo) Purge(ctx context.Context, source string) error {
+	if _, err := m.col.DeleteMany(ctx, bson.M{"source": source}); err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+
+	return nil
+}
+
+// Versions returns the version of every source in the collection.
+func (m *Mongo) Versions(ctx context.Context) (map[string]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{
+			"_id":     "$source",
+			"version": bson.M{"$max": "$version"},
+		}}},
+	}
+
+	cur, err := m.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var groups []struct {
+		Source  string `bson:"_id"`
+		Version string `bson:"version"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("all: %w", err)
+	}
+
+	versions := make(map[string]string, len(groups))
+	for _, g := range groups {
+		versions[g.Source] = g.Version
+	}
+
+	return versions, nil
+}
+
+// Search returns the documents matching the filter that are most similar to
+// the embedding. The filter is applied by the vector search itself so the
+// limit is honored even when most documents don't match.
+func (m *Mongo) Search(ctx context.Context, embedding []float32, limit int, filter Filter) ([]Result, error) {
+	search := bson.M{
+		"index":       m.indexName,
+		"exact":       true,
+		"path":        "embedding",
+		"queryVector": embedding,
+		"limit":       limit,
+	}
+
+	if f := mongoFilter(filter); len(f) > 0 {
+		search["filter"] = bson.M{"$and": f}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$vectorSearch", Value: search}},
+		{{Key: "$addFields", Value: bson.M{"score": bson.M{"$meta": "vectorSearchScore"}}}},
+	}
+
+	cur, err := m.col.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, fmt.Errorf("aggregate: %w", err)
+	}
+	defer cur.Close(ctx)
+
+	var results []Result
+	if err := cur.All(ctx, &results); err != nil {
+		return nil, fmt.Errorf("all: %w", err)
+	}
+
+	return results, nil
+}
+
+// mongoFilter converts the filter into the conditions supported by the
+// $vectorSearch filter option.
+func mongoFilter(filter Filter) []bson.M {
+	var conds []bson.M
+
+	if len(filter.Sources) > 0 {
+		conds = append(conds, bson.M{"source": bson.M{"$in": filter.Sources}})
+	}
+
+	if len(filter.Tags) > 0 {
+		conds = append(conds, bson.M{"tags": bson.M{"$in": filter.Tags}})
+	}
+
+	if !filter.After.IsZero() {
+		conds = append(conds, bson.M{"created": bson.M{"$gte": filter.After}})
+	}
+
+	if !filter.Before.IsZero() {
+		conds = append(conds, bson.M{"created": bson.M{"$lt": filter.Before}})
+	}
+
+	return conds
+}
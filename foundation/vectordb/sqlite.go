@@ -0,0 +1,347 @@
+package vectordb
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/vector"
+)
+
+// SQLite is a vector store backed by a SQLite database. SQLite has no vector
+// index so the metadata filters are applied in SQL and the similarity of the
+// matching documents is computed in memory.
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite constructs a vector store using the database, creating the
+// tables if they don't exist. The caller is responsible for importing the
+// SQLite driver and closing the database.
+func NewSQLite(ctx context.Context, db *sql.DB) (*SQLite, error) {
+	const schema = `
+	CREATE TABLE IF NOT EXISTS documents (
+		id        TEXT PRIMARY KEY,
+		source    TEXT NOT NULL,
+		version   TEXT NOT NULL DEFAULT '',
+		created   INTEGER NOT NULL,
+		content   TEXT NOT NULL,
+		embedding BLOB NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS documents_source ON documents (source);
+	CREATE INDEX IF NOT EXISTS documents_created ON documents (created);
+	CREATE TABLE IF NOT EXISTS document_tags (
+		document_id TEXT NOT NULL REFERENCES documents (id) ON DELETE CASCADE,
+		tag         TEXT NOT NULL,
+		PRIMARY KEY (document_id, tag)
+	);
+	CREATE INDEX IF NOT EXISTS document_tags_tag ON document_tags (tag);`
+
+	if _, err := db.ExecContext(ctx, schema); err != nil {
+		return nil, fmt.Errorf("create schema: %w", err)
+	}
+
+	if err := migrateSQLite(ctx, db); err != nil {
+		return nil, fmt.Errorf("migrate schema: %w", err)
+	}
+
+	return &SQLite{db: db}, nil
+}
+
+// migrateSQLite adds the columns that are missing from databases created by
+// an older version of the schema. CREATE TABLE IF NOT EXISTS leaves an
+// existing table as it is.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_info('documents')`)
+	if err != nil {
+		return fmt.Errorf("table info: %w", err)
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		columns[name] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows: %w", err)
+	}
+
+	if !columns["version"] {
+		if _, err := db.ExecContext(ctx, `ALTER TABLE documents ADD COLUMN version TEXT NOT NULL DEFAULT ''`); err != nil {
+			return fmt.Errorf("add version: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Insert adds the documents to the database.
+func (s *SQLite) Insert(ctx context.Context, docs ...Document) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertDocuments(ctx, tx, docs); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// Upsert replaces the documents of the source with the specified version of
+// its documents. The old documents are removed in the same transaction so a
+// search never sees both versions.
+func (s *SQLite) Upsert(ctx context.Context, source string, version string, docs ...Document) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := purgeSource(ctx, tx, source); err != nil {
+		return err
+	}
+
+	if err := insertDocuments(ctx, tx, withVersion(source, version, docs)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// Purge removes the documents of the source.
+func (s *SQLite) Purge(ctx context.Context, source string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := purgeSource(ctx, tx, source); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+// Versions returns the version of every source in the database.
+func (s *SQLite) Versions(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT source, MAX(version) FROM documents GROUP BY source`)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]string)
+	for rows.Next() {
+		var source, version string
+		if err := rows.Scan(&source, &version); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		versions[source] = version
+	}
+
+	return versions, rows.Err()
+}
+
+// Search returns the documents matching the filter that are most similar to
+// the embedding.
+func (s *SQLite) Search(ctx context.Context, embedding []float32, limit int, filter Filter) ([]Result, error) {
+	where, args := sqliteFilter(filter)
+
+	q := `SELECT id, source, version, created, content, embedding FROM documents` + where
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []vector.Data
+	for rows.Next() {
+		var doc Document
+		var created int64
+		var blob []byte
+		if err := rows.Scan(&doc.ID, &doc.Source, &doc.Version, &created, &doc.Content, &blob); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+
+		doc.Created = time.Unix(0, created).UTC()
+		doc.Embedding = decodeEmbedding(blob)
+
+		candidates = append(candidates, doc)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+
+	// -------------------------------------------------------------------------
+	// Rank the candidates and load the tags of the top results.
+
+	ranked := vector.SearchParallel(embeddingData(embedding), candidates, limit, 0)
+
+	results := make([]Result, len(ranked))
+	for i, r := range ranked {
+		doc := r.DataPoint.(Document)
+
+		doc.Tags, err = s.tags(ctx, doc.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		results[i] = Result{
+			Document: doc,
+			Score:    float64(r.Similarity),
+		}
+	}
+
+	return results, nil
+}
+
+func insertDocuments(ctx context.Context, tx *sql.Tx, docs []Document) error {
+	for _, doc := range docs {
+		const q = `INSERT INTO documents (id, source, version, created, content, embedding) VALUES (?, ?, ?, ?, ?, ?)`
+		if _, err := tx.ExecContext(ctx, q, doc.ID, doc.Source, doc.Version, doc.Created.UnixNano(), doc.Content, encodeEmbedding(doc.Embedding)); err != nil {
+			return fmt.Errorf("insert %s: %w", doc.ID, err)
+		}
+
+		for _, tag := range doc.Tags {
+			const q = `INSERT OR IGNORE INTO document_tags (document_id, tag) VALUES (?, ?)`
+			if _, err := tx.ExecContext(ctx, q, doc.ID, tag); err != nil {
+				return fmt.Errorf("insert tag %s: %w", doc.ID, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// purgeSource removes the documents of the source and their tags. The tags
+// are removed explicitly since SQLite doesn't enforce foreign keys by default.
+func purgeSource(ctx context.Context, tx *sql.Tx, source string) error {
+	const qTags = `DELETE FROM document_tags WHERE document_id IN (SELECT id FROM documents WHERE source = ?)`
+	if _, err := tx.ExecContext(ctx, qTags, source); err != nil {
+		return fmt.Errorf("purge tags %s: %w", source, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE source = ?`, source); err != nil {
+		return fmt.Errorf("purge %s: %w", source, err)
+	}
+
+	return nil
+}
+
+func (s *SQLite) tags(ctx context.Context, id string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag FROM document_tags WHERE document_id = ? ORDER BY tag`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+// =============================================================================
+
+// Vector implements the vector.Data interface.
+func (doc Document) Vector() []float32 {
+	return doc.Embedding
+}
+
+type embeddingData []float32
+
+func (e embeddingData) Vector() []float32 {
+	return e
+}
+
+// sqliteFilter converts the filter into a WHERE clause and its arguments.
+func sqliteFilter(filter Filter) (string, []any) {
+	var conds []string
+	var args []any
+
+	if len(filter.Sources) > 0 {
+		conds = append(conds, "source IN ("+placeholders(len(filter.Sources))+")")
+		for _, source := range filter.Sources {
+			args = append(args, source)
+		}
+	}
+
+	if len(filter.Tags) > 0 {
+		conds = append(conds, "id IN (SELECT document_id FROM document_tags WHERE tag IN ("+placeholders(len(filter.Tags))+"))")
+		for _, tag := range filter.Tags {
+			args = append(args, tag)
+		}
+	}
+
+	if !filter.After.IsZero() {
+		conds = append(conds, "created >= ?")
+		args = append(args, filter.After.UnixNano())
+	}
+
+	if !filter.Before.IsZero() {
+		conds = append(conds, "created < ?")
+		args = append(args, filter.Before.UnixNano())
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// encodeEmbedding stores the embedding as little endian float32 values.
+func encodeEmbedding(embedding []float32) []byte {
+	b := make([]byte, 4*len(embedding))
+	for i, f := range embedding {
+		binary.LittleEndian.PutUint32(b[4*i:], math.Float32bits(f))
+	}
+
+	return b
+}
+
+func decodeEmbedding(b []byte) []float32 {
+	embedding := make([]float32, len(b)/4)
+	for i := range embedding {
+		embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+
+	return embedding
+}
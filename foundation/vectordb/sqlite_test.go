@@ -0,0 +1,67 @@
+package vectordb_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/ai-training/foundation/vectordb"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestSQLiteSearchSmallFilter(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	defer db.Close()
+
+	store, err := vectordb.NewSQLite(ctx, db)
+	if err != nil {
+		t.Fatalf("new store: %s", err)
+	}
+
+	// Every source has a different number of documents, so the filters
+	// match small result sets of different sizes.
+	sizes := []int{1, 5, 9, 10, 13}
+
+	var docs []vectordb.Document
+	for _, n := range sizes {
+		for i := range n {
+			docs = append(docs, vectordb.Document{
+				ID:        fmt.Sprintf("doc-%d-%d", n, i),
+				Source:    fmt.Sprintf("source-%d", n),
+				Created:   time.Now(),
+				Content:   fmt.Sprintf("chunk %d of %d", i, n),
+				Embedding: []float32{float32(i + 1), 1, 0},
+			})
+		}
+	}
+
+	if err := store.Insert(ctx, docs...); err != nil {
+		t.Fatalf("insert: %s", err)
+	}
+
+	for _, n := range sizes {
+		filter := vectordb.Filter{Sources: []string{fmt.Sprintf("source-%d", n)}}
+
+		results, err := store.Search(ctx, []float32{1, 1, 0}, 20, filter)
+		if err != nil {
+			t.Fatalf("source with %d documents: search: %s", n, err)
+		}
+
+		if len(results) != n {
+			t.Errorf("source with %d documents: got %d results, want %d", n, len(results), n)
+		}
+
+		for _, r := range results {
+			if r.Source != filter.Sources[0] {
+				t.Errorf("source with %d documents: got a result from %s", n, r.Source)
+			}
+		}
+	}
+}
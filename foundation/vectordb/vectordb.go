@@ -0,0 +1,60 @@
+// Package vectordb provides a vector store for document chunks with MongoDB
+// and SQLite backends. Searches combine vector similarity with metadata
+// filters so retrieval can be scoped to specific document sets.
+package vectordb
+
+import (
+	"context"
+	"time"
+)
+
+// Document represents a chunk of a document with its embedding and the
+// metadata that can be used to filter searches. The source identifies the
+// document the chunk was taken from and the version identifies the content
+// of the document when it was indexed, like a hash of the file.
+type Document struct {
+	ID        string    `bson:"id" json:"id"`
+	Source    string    `bson:"source" json:"source"`
+	Version   string    `bson:"version" json:"version"`
+	Tags      []string  `bson:"tags" json:"tags"`
+	Created   time.Time `bson:"created" json:"created"`
+	Content   string    `bson:"content" json:"content"`
+	Embedding []float32 `bson:"embedding" json:"-"`
+}
+
+// Result represents a document returned by a search with its similarity
+// score.
+type Result struct {
+	Document `bson:",inline"`
+	Score    float64 `bson:"score" json:"score"`
+}
+
+// Filter scopes a search to documents matching the metadata. Empty fields
+// are ignored, so the zero value matches every document.
+type Filter struct {
+	Sources []string  // Documents from any of these sources.
+	Tags    []string  // Documents with any of these tags.
+	After   time.Time // Documents created at or after this time.
+	Before  time.Time // Documents created before this time.
+}
+
+// Store represents the behavior of a vector store backend.
+type Store interface {
+	Insert(ctx context.Context, docs ...Document) error
+	Upsert(ctx context.Context, source string, version string, docs ...Document) error
+	Purge(ctx context.Context, source string) error
+	Versions(ctx context.Context) (map[string]string, error)
+	Search(ctx context.Context, embedding []float32, limit int, filter Filter) ([]Result, error)
+}
+
+// withVersion sets the source and version of the documents.
+func withVersion(source string, version string, docs []Document) []Document {
+	versioned := make([]Document, len(docs))
+	for i, doc := range docs {
+		doc.Source = source
+		doc.Version = version
+		versioned[i] = doc
+	}
+
+	return versioned
+}